@@ -0,0 +1,948 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/dto"
+	"github.com/kinyaelgrande/simple-hospital/handlers"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/openapi"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+)
+
+// Request bodies decoded into anonymous structs by the handlers
+
+type createUserRequest struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+	Role         string `json:"role"`
+	FullName     string `json:"fullName"`
+	PatientID    *int   `json:"patientId,omitempty"`
+}
+
+type credentialsRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type verifyTwoFARequest struct {
+	TempSessionID string `json:"tempSessionId" validate:"required"`
+	Code          string `json:"code" validate:"required"`
+}
+
+type enableTwoFARequest struct {
+	Secret string `json:"secret" validate:"required"`
+	Code   string `json:"code" validate:"required"`
+}
+
+type redeemTwoFAResetRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	Token    string `json:"token" validate:"required"`
+}
+
+type confirmInterpreterRequest struct {
+	Reference string `json:"reference" validate:"required,max=100"`
+}
+
+type codingQueryRequest struct {
+	Question string `json:"question" validate:"required,max=2000"`
+}
+
+type codingResponseRequest struct {
+	Response string `json:"response" validate:"required,max=2000"`
+}
+
+type removeFlagRequest struct {
+	Reason string `json:"reason" validate:"required,max=1000"`
+}
+
+type transferRequest struct {
+	BedID  int    `json:"bedId" validate:"required,gt=0"`
+	Reason string `json:"reason" validate:"max=2000"`
+}
+
+type dischargeRequest struct {
+	Summary string `json:"summary" validate:"required,max=10000"`
+}
+
+type labResultsRequest struct {
+	Results []models.LabResult `json:"results" validate:"required,min=1"`
+}
+
+type exportRequest struct {
+	Kind string `json:"kind" validate:"required,max=50"`
+}
+
+type userRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type userActiveRequest struct {
+	Active bool `json:"active"`
+}
+
+type downloadTokenRequest struct {
+	Kind       string `json:"kind" validate:"required,oneof=medical-records prescriptions document discharge-summary"`
+	ResourceID int    `json:"resourceId" validate:"required,gt=0"`
+}
+
+type bedServiceRequest struct {
+	OutOfService bool `json:"outOfService"`
+}
+
+type completeCleaningRequest struct {
+	Notes string `json:"notes" validate:"max=2000"`
+}
+
+type specialtiesRequest struct {
+	Specialties []string `json:"specialties" validate:"max=20,dive,required,max=100"`
+}
+
+type userDepartmentsRequest struct {
+	Departments []string `json:"departments" validate:"required,max=20,dive,required,max=50"`
+}
+
+type documentUploadForm struct {
+	File        openapi.File `json:"file" validate:"required"`
+	RecordID    int          `json:"recordId" validate:"omitempty,gt=0"`
+	Description string       `json:"description" validate:"max=500"`
+}
+
+type patientImageForm struct {
+	File openapi.File `json:"file" validate:"required"`
+}
+
+type acknowledgeExcursionRequest struct {
+	Notes string `json:"notes" validate:"max=2000"`
+}
+
+type quarantineRequest struct {
+	Quarantined bool `json:"quarantined"`
+}
+
+type mergePatientRequest struct {
+	DuplicateID int  `json:"duplicateId"`
+	DryRun      bool `json:"dryRun"`
+}
+
+type refillRequestBody struct {
+	Source string `json:"source" validate:"required,oneof=patient front_desk"`
+	Notes  string `json:"notes" validate:"max=2000"`
+}
+
+type sensorKeyResponse struct {
+	SensorKey string `json:"sensorKey"`
+}
+
+type recordReadingsResponse struct {
+	Recorded   int                           `json:"recorded"`
+	Excursions []models.TemperatureExcursion `json:"excursions"`
+}
+
+type breakGlassBody struct {
+	PatientID int    `json:"patientId"`
+	Reason    string `json:"reason"`
+}
+
+// describeAPI annotates the routes listed in the OpenAPI document. Routes
+// without an annotation are still listed, with their path parameters.
+func describeAPI(spec *openapi.Spec) {
+	doctor := []string{models.ROLE_DOCTOR}
+	wardStaff := []string{models.ROLE_DOCTOR, models.ROLE_NURSE}
+	housekeeping := []string{models.ROLE_HOUSEKEEPING}
+	bedStaff := []string{models.ROLE_HOUSEKEEPING, models.ROLE_DOCTOR, models.ROLE_NURSE}
+	labReaders := []string{models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_LAB_TECH}
+	pharmacist := []string{models.ROLE_PHARMACIST}
+	clinicalStaff := []string{models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PHARMACIST}
+	identityCheckers := []string{models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PHARMACIST, models.ROLE_LAB_TECH}
+	coder := []string{models.ROLE_CODER}
+	appointmentReaders := []string{models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PATIENT}
+	loginHistory := "Newest first: each password, basic auth and second-factor attempt with its outcome, IP address and user agent. " +
+		"Repeated successful basic auth from the same client is recorded once every 15 minutes. X-Total-Count gives the number of attempts."
+	loginHistoryQuery := []openapi.Param{
+		{Name: "limit", Type: "integer", Description: "Page size, 1 to 200 (default 50)"},
+		{Name: "offset", Type: "integer", Description: "Attempts to skip"},
+	}
+	prescriptionExpand := openapi.Param{Name: "expand", Type: "string",
+		Description: "patient, doctor or patient,doctor to include each prescription's patient and prescriber, joined in the same query"}
+	localTimes := "Times without an offset are facility-local (HOSPITAL_TIMEZONE); one skipped or repeated by a DST change is refused (422). " +
+		"Responses carry the facility offset."
+
+	// Auth
+	spec.Describe("POST", "/api/auth/2fa/initiate", openapi.Operation{Tag: "auth", Public: true,
+		Summary:     "Start a login",
+		Description: "Checks the password; when a second factor is enrolled, returns a temporary session to complete with /api/auth/2fa/verify or WebAuthn.",
+		Body:        credentialsRequest{}, Response: session.AuthResponse{}})
+	spec.Describe("POST", "/api/auth/2fa/verify", openapi.Operation{Tag: "auth", Public: true,
+		Summary: "Complete a login with a TOTP or backup code",
+		Description: "Returns sessionId for the X-Session-ID header, which may differ from tempSessionId. With X-Session-Mode: cookie the session is set as an httpOnly cookie instead " +
+			"and csrfToken is returned; send it as X-CSRF-Token on every POST, PUT and DELETE. The temporary session lasts SESSION_PENDING_TTL " +
+			"(15 minutes) and the session SESSION_TTL (24 hours). Requests in its second half renew it, up to SESSION_MAX_AGE (24 hours) after " +
+			"the login, renewing the cookie or, for a stateless token, returning the new one in X-New-Session-ID. With SESSION_IDLE_TIMEOUT set, " +
+			"sessions unused for that long end.",
+		Body: verifyTwoFARequest{}, Response: session.AuthResponse{}})
+	spec.Describe("POST", "/api/auth/2fa/logout", openapi.Operation{Tag: "auth", Summary: "End the current session",
+		Description: "Also clears the session cookie; a cookie session must send X-CSRF-Token."})
+	spec.Describe("GET", "/api/auth/session", openapi.Operation{Tag: "auth", Summary: "Describe the current session",
+		Description: "A cookie session gets its csrfToken instead of its sessionId.", Response: session.Session{}})
+	spec.Describe("GET", "/api/auth/sessions", openapi.Operation{Tag: "auth", Summary: "List the caller's active sessions",
+		Description: "Newest first. With MAX_SESSIONS_PER_USER set, completing a login beyond the limit ends the oldest session. " +
+			"Always empty with SESSION_MODE=stateless, where sessions are signed tokens no server keeps; sign out with /api/auth/2fa/logout instead.",
+		Response: []session.ActiveSession{}})
+	spec.Describe("DELETE", "/api/auth/sessions/{id}", openapi.Operation{Tag: "auth", Summary: "Sign out one of the caller's sessions",
+		Status: http.StatusNoContent})
+	spec.Describe("GET", "/api/auth/2fa/setup", openapi.Operation{Tag: "auth", Summary: "Generate a TOTP secret and QR code",
+		Description: "A new secret every time; it replaces the current one only once enabled. Users with 2FA enabled must send a current code in X-2FA-Code.",
+		Response:    models.TwoFASetup{}})
+	spec.Describe("POST", "/api/auth/2fa/enable", openapi.Operation{Tag: "auth", Summary: "Enable TOTP after confirming a code",
+		Description: "Users with 2FA enabled must send a current code for their existing authenticator in X-2FA-Code.",
+		Body:        enableTwoFARequest{}})
+	spec.Describe("POST", "/api/auth/2fa/reset", openapi.Operation{Tag: "auth", Public: true,
+		Summary:     "Turn off TOTP with an admin-issued reset token",
+		Description: "For users who lost their authenticator. Signs the user out of every session; enroll a new authenticator with /api/auth/2fa/setup and /api/auth/2fa/enable.",
+		Body:        redeemTwoFAResetRequest{}})
+	spec.Describe("GET", "/api/auth/webauthn/credentials", openapi.Operation{Tag: "auth", Summary: "List the caller's passkeys", Response: []models.WebAuthnCredential{}})
+	spec.Describe("DELETE", "/api/auth/webauthn/credentials/{id}", openapi.Operation{Tag: "auth", Summary: "Remove a passkey", Status: http.StatusNoContent})
+
+	// Patients
+	spec.Describe("POST", "/api/patients", openapi.Operation{Tag: "patients", Summary: "Register a patient",
+		Description: "allergies, a comma-separated list, is recorded as one active allergy per substance. In responses it summarises the " +
+			"patient's active allergies.",
+		Body: models.Patient{}, Response: models.Patient{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/patients", openapi.Operation{Tag: "patients", Summary: "List patients", Response: []models.Patient{}})
+	spec.Describe("GET", "/api/patients/export", openapi.Operation{Tag: "patients", Summary: "Export every patient",
+		Description: "Admins only, and audited. Streams the patients as they are read, with chunked transfer encoding: CSV with a header " +
+			"row, or NDJSON with one patient per line. The download is cut off after STREAM_MAX_DURATION, or when the client takes longer " +
+			"than STREAM_WRITE_TIMEOUT to accept a chunk; a truncated transfer is aborted rather than ended cleanly.",
+		Query: []openapi.Param{{Name: "format", Type: "string", Description: "csv (default) or ndjson"}}})
+	spec.Describe("GET", "/api/patients/{id}", openapi.Operation{Tag: "patients", Summary: "Get a patient", Response: models.Patient{}})
+	spec.Describe("PUT", "/api/patients/{id}", openapi.Operation{Tag: "patients", Summary: "Update a patient",
+		Description: "Refused with 409 chart_locked while another user holds the chart lock. allergies is ignored; change allergies through " +
+			"/api/patients/{patientId}/allergies.",
+		Body: models.Patient{}, Response: models.Patient{}})
+	spec.Describe("DELETE", "/api/patients/{id}", openapi.Operation{Tag: "patients", Summary: "Delete a patient", Status: http.StatusNoContent})
+	spec.Describe("GET", "/api/patients/{id}/changes", openapi.Operation{Tag: "patients", Summary: "List changes to a patient's demographics",
+		Description: "One entry per changed field, newest first, from edits and from merging a duplicate into the patient: names, date of birth, " +
+			"gender, phone, address, emergency contact, preferred language and interpreterRequired. Medical history and allergies aren't listed.",
+		Response: []models.PatientChange{}})
+	spec.Describe("GET", "/api/patients/{patientId}/lock", openapi.Operation{Tag: "patients", Summary: "Show who is editing the chart", Response: models.ChartLock{}})
+	spec.Describe("POST", "/api/patients/{patientId}/lock", openapi.Operation{Tag: "patients", Summary: "Acquire or refresh the chart lock", Response: models.ChartLock{}})
+	spec.Describe("DELETE", "/api/patients/{patientId}/lock", openapi.Operation{Tag: "patients", Summary: "Release the chart lock", Status: http.StatusNoContent})
+	spec.Describe("POST", "/api/patients/{patientId}/lock/takeover", openapi.Operation{Tag: "patients", Summary: "Ask the holder to hand over the chart",
+		Response: models.ChartLock{}, Status: http.StatusAccepted})
+	spec.Describe("GET", "/api/patients/{id}/summary", openapi.Operation{Tag: "patients", Summary: "Get a patient with their active flags",
+		Description: "flags always lists every active flag the caller's role may see.",
+		Response:    models.PatientSummary{}})
+	spec.Describe("GET", "/api/patients/{id}/timeline", openapi.Operation{Tag: "patients", Summary: "Get the patient's timeline", Roles: wardStaff,
+		Description: "Medical records, prescriptions, resulted lab orders and admissions merged newest first. item holds each entry as its own endpoint " +
+			"returns it; nurses get the nurse view of medical records. total counts the matching entries across all pages.",
+		Query: []openapi.Param{
+			{Name: "types", Type: "string", Description: "Comma-separated medical_record, prescription, lab_result or admission; all by default"},
+			{Name: "limit", Type: "integer", Description: "Page size, 1 to 200 (default 50)"},
+			{Name: "offset", Type: "integer", Description: "Entries to skip"},
+		},
+		Response: models.Timeline{}})
+	spec.Describe("POST", "/api/patients/{id}/merge", openapi.Operation{Tag: "patients", Summary: "Merge a duplicate patient into this one",
+		Description: "Moves the duplicate's medical records, lab orders, documents, prescriptions, future appointments, flags, allergies, pre-auth " +
+			"requests, outpatient claims and the photo and ID document this patient lacks, fills this patient's empty fields and appends history, then hides the duplicate from the patient list. " +
+			"Past appointments, admissions and inpatient claims stay on the duplicate. Audited. With dryRun (or ?dryRun=true) nothing changes. " +
+			"409 if either patient is already merged, the duplicate is admitted or either chart is locked by someone else.",
+		Query: []openapi.Param{{Name: "dryRun", Type: "boolean", Description: "Only report what would change"}},
+		Body:  mergePatientRequest{}, Response: models.PatientMerge{}})
+
+	// Patient flags
+	spec.Describe("GET", "/api/flag-types", openapi.Operation{Tag: "patient-flags", Summary: "List flag types and the roles that see them",
+		Response: []models.PatientFlagType{}})
+	spec.Describe("GET", "/api/patients/{patientId}/flags", openapi.Operation{Tag: "patient-flags", Summary: "List a patient's flags",
+		Description: "Only flag types visible to the caller's role are listed.",
+		Query:       []openapi.Param{{Name: "includeRemoved", Type: "boolean", Description: "Include flags that have been removed"}},
+		Response:    []models.PatientFlag{}})
+	spec.Describe("POST", "/api/patients/{patientId}/flags", openapi.Operation{Tag: "patient-flags", Summary: "Raise a flag on a patient",
+		Description: "Audited. 403 if the caller's role can't see the flag type, 409 if the patient already has it.",
+		Roles:       clinicalStaff, Body: models.PatientFlag{}, Response: models.PatientFlag{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/patients/{patientId}/flags/{id}/remove", openapi.Operation{Tag: "patient-flags", Summary: "Remove a flag",
+		Description: "Audited with the reason; the flag is kept in the history.",
+		Roles:       clinicalStaff, Body: removeFlagRequest{}, Response: models.PatientFlag{}})
+
+	// Allergies
+	spec.Describe("GET", "/api/patients/{patientId}/allergies", openapi.Operation{Tag: "allergies", Summary: "List a patient's allergies",
+		Description: "Active allergies in the order recorded; with includeInactive the inactive ones follow.",
+		Query:       []openapi.Param{{Name: "includeInactive", Type: "boolean", Description: "Include allergies marked inactive"}},
+		Response:    []models.Allergy{}})
+	spec.Describe("POST", "/api/patients/{patientId}/allergies", openapi.Operation{Tag: "allergies", Summary: "Record an allergy",
+		Description: "Audited. Active unless active is false. 409 if the patient already has an active allergy to the substance, or " +
+			"chart_locked while another user holds the chart lock.",
+		Roles: clinicalStaff, Body: models.Allergy{}, Response: models.Allergy{}, Status: http.StatusCreated})
+	spec.Describe("PUT", "/api/patients/{patientId}/allergies/{id}", openapi.Operation{Tag: "allergies", Summary: "Update an allergy",
+		Description: "Audited. Replaces every field; set active to false for an allergy that was refuted or outgrown.",
+		Roles:       clinicalStaff, Body: models.Allergy{}, Response: models.Allergy{}})
+	spec.Describe("DELETE", "/api/patients/{patientId}/allergies/{id}", openapi.Operation{Tag: "allergies", Summary: "Delete an allergy recorded in error",
+		Description: "Audited. Allergies that no longer apply should be marked inactive instead.",
+		Roles:       clinicalStaff, Status: http.StatusNoContent})
+
+	// Users
+	spec.Describe("POST", "/api/users", openapi.Operation{Tag: "users", Summary: "Create a staff or patient portal account",
+		Description: "Admins only. The account gets the role given, which must be one of the known roles (422 otherwise). A Patient account needs the patientId of an existing patient (422 otherwise, 409 if it already has one); other roles " +
+			"must not set it. Patients may only read their own patient, medical records (without doctor's notes), prescriptions and " +
+			"appointments, and manage their own account; /api/medical-records, /api/prescriptions and /api/appointments list only theirs, " +
+			"and every other route returns 403.",
+		Body: createUserRequest{}, Response: dto.User{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/users", openapi.Operation{Tag: "users", Summary: "List and search accounts",
+		Description: "Ordered by ID. X-Total-Count gives the number of users matching across all pages.",
+		Query: []openapi.Param{
+			{Name: "role", Description: "Only users with this role, e.g. Doctor (case-insensitive)"},
+			{Name: "q", Description: "Only users whose username or full name contains this, ignoring case"},
+			{Name: "active", Type: "boolean", Description: "Only active (true) or deactivated (false) accounts"},
+			{Name: "limit", Type: "integer", Description: "Page size, 1 to 1000 (default all)"},
+			{Name: "offset", Type: "integer", Description: "Users to skip"},
+		},
+		Response: []dto.User{}})
+	spec.Describe("GET", "/api/users/{id}", openapi.Operation{Tag: "users", Summary: "Get a staff account", Response: dto.User{}})
+	spec.Describe("PUT", "/api/users/{id}/role", openapi.Operation{Tag: "users", Summary: "Change a user's role (audited)",
+		Description: "Admins only. Takes effect on the user's next request. Roles can't be changed to or from Patient (422), " +
+			"and admins can't change their own (409).",
+		Body: userRoleRequest{}, Response: dto.User{}})
+	spec.Describe("GET", "/api/users/{id}/login-history", openapi.Operation{Tag: "users", Summary: "List a user's login attempts",
+		Description: "Admins only. " + loginHistory, Query: loginHistoryQuery, Response: []models.LoginEvent{}})
+	// Departments
+	spec.Describe("GET", "/api/users/{id}/departments", openapi.Operation{Tag: "departments", Summary: "List a user's departments",
+		Description: "Admins only.", Response: []models.Department{}})
+	spec.Describe("PUT", "/api/users/{id}/departments", openapi.Operation{Tag: "departments", Summary: "Set a user's departments (audited)",
+		Description: "Admins only. Replaces the user's departments with the listed codes; an empty list removes them all. Unknown or " +
+			"retired departments and patient accounts return 422; a retired department the user is already in may be kept.",
+		Body: userDepartmentsRequest{}, Response: []models.Department{}})
+	spec.Describe("GET", "/api/departments", openapi.Operation{Tag: "departments", Summary: "List departments, including retired ones",
+		Response: []models.Department{}})
+	spec.Describe("GET", "/api/departments/{code}/staff", openapi.Operation{Tag: "departments", Summary: "List a department's staff",
+		Query:    []openapi.Param{{Name: "role", Type: "string", Description: "Only staff with this role"}},
+		Response: []models.DepartmentMember{}})
+	spec.Describe("GET", "/api/events", openapi.Operation{Tag: "events", Summary: "Stream live entity changes",
+		Description: "A text/event-stream of changes committed to entities your role may see (patients, medical records, prescriptions, " +
+			"lab orders, admissions; admins see all). Each message's data is the change and its id the event ID; refetch the entity " +
+			"to update a list. Reconnecting with Last-Event-ID replays missed changes, or sends a reset event if there are too many. " +
+			"Streams end after 30 minutes and should be reopened.",
+		Query:    []openapi.Param{{Name: "types", Description: "Comma-separated entity types to receive; default all"}},
+		Response: models.EntityChange{}})
+	spec.Describe("GET", "/api/me", openapi.Operation{Tag: "users", Summary: "Get your own account", Response: dto.User{}})
+	spec.Describe("GET", "/api/me/login-history", openapi.Operation{Tag: "users", Summary: "List your own login attempts",
+		Description: loginHistory, Query: loginHistoryQuery, Response: []models.LoginEvent{}})
+	spec.Describe("PUT", "/api/me", openapi.Operation{Tag: "users", Summary: "Update your own account",
+		Description: "Only the full name and notification preferences can be changed. notifications.channel is email, sms or none (blank " +
+			"means none); email needs notifications.email and sms an E.164 notifications.phone.",
+		Body: models.ProfileUpdate{}, Response: dto.User{}})
+
+	// Medical records
+	spec.Describe("POST", "/api/medical-records", openapi.Operation{Tag: "medical-records", Summary: "Record a visit",
+		Description: "diagnosis_codes must be in the ICD-10 code table (see /api/codes/icd10); unknown codes return 422. " +
+			"visit_date may be at most 30 days ahead. doctor_notes, if given, becomes the record's first note, unsigned. " +
+			"A record written from a template (see /api/record-templates) gives template_code and its sections by key; the record is " +
+			"returned with every section of the template, in order and titled. Unknown or repeated keys, required sections left empty " +
+			"and unknown or retired templates return 422.",
+		Body: models.MedicalRecord{}, Response: models.MedicalRecord{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/medical-records", openapi.Operation{Tag: "medical-records", Summary: "List medical records",
+		Description: "Pharmacists and non-clinical roles receive only id, patient_id and visit_date; patients receive their own records without the doctor's notes.",
+		Query: []openapi.Param{{Name: "department", Type: "string", Description: "Only records written by the department's doctors; unknown departments return 404"},
+			{Name: "expand", Type: "string", Description: "patient to include each record's patient, joined in the same query; not applied to patients' own records"}},
+		Response: []models.MedicalRecordNurseView{}})
+	spec.Describe("GET", "/api/medical-records/{id}", openapi.Operation{Tag: "medical-records", Summary: "Get a medical record",
+		Description: "Nurses and lab technicians receive the nurse view without treatment plan or notes; pharmacists and non-clinical roles " +
+			"receive only id, patient_id and visit_date; patients receive their own records without the doctor's notes.",
+		Response: models.MedicalRecord{}})
+	spec.Describe("GET", "/api/patients/{patientId}/medical-records", openapi.Operation{Tag: "medical-records", Summary: "List a patient's medical records",
+		Description: "Shaped by role as for a single record.", Response: []models.MedicalRecord{}})
+	spec.Describe("GET", "/api/record-templates", openapi.Operation{Tag: "medical-records", Summary: "List visit templates", Roles: doctor,
+		Description: "Every template, retired ones included, by name.", Response: []models.RecordTemplate{}})
+	spec.Describe("GET", "/api/record-templates/{code}", openapi.Operation{Tag: "medical-records", Summary: "Get a visit template", Roles: doctor,
+		Response: models.RecordTemplate{}})
+	spec.Describe("GET", "/api/medical-records/{id}/notes", openapi.Operation{Tag: "medical-records", Summary: "List a record's notes", Roles: doctor,
+		Description: "Notes and their addenda in the order written. A record's doctor_notes is these bodies joined by blank lines.",
+		Response:    []models.Note{}})
+	spec.Describe("POST", "/api/medical-records/{id}/notes", openapi.Operation{Tag: "medical-records", Summary: "Add a note to a record", Roles: doctor,
+		Description: "The note is by the caller and unsigned: its author may edit it until they sign it. Returns 409 chart_locked while someone else holds the chart lock.",
+		Body:        models.Note{}, Response: models.Note{}, Status: http.StatusCreated})
+	spec.Describe("PUT", "/api/medical-records/{id}/notes/{noteId}", openapi.Operation{Tag: "medical-records", Summary: "Edit an unsigned note", Roles: doctor,
+		Description: "Only the author may edit a note (403 otherwise); a signed note returns 409, and is amended with an addendum instead.",
+		Body:        models.Note{}, Response: models.Note{}})
+	spec.Describe("POST", "/api/medical-records/{id}/notes/{noteId}/sign", openapi.Operation{Tag: "medical-records", Summary: "Sign a note", Roles: doctor,
+		Description: "Only the author may sign a note; once signed it can't be edited or signed again (409). Signing is audit-logged.",
+		Response:    models.Note{}})
+	spec.Describe("POST", "/api/medical-records/{id}/notes/{noteId}/addenda", openapi.Operation{Tag: "medical-records", Summary: "Add an addendum to a signed note", Roles: doctor,
+		Description: "The addendum is a new unsigned note by the caller, linked by addendumTo; an unsigned note returns 409. Any doctor may add one.",
+		Body:        models.Note{}, Response: models.Note{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/break-glass", openapi.Operation{Tag: "medical-records", Summary: "Break glass for emergency access to a patient's records",
+		Roles: []string{models.ROLE_NURSE, models.ROLE_LAB_TECH, models.ROLE_PHARMACIST},
+		Description: "Requires a reason. For BREAK_GLASS_DURATION (default 1h) the caller reads the patient's medical records in full, as a doctor does; " +
+			"each such read is audit-logged and carries X-Break-Glass-Expires. The grant is audit-logged and alerts SECURITY_ALERT_RECIPIENTS.",
+		Body: breakGlassBody{}, Response: models.BreakGlassAccess{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/codes/icd10", openapi.Operation{Tag: "medical-records", Summary: "Search ICD-10 diagnosis codes",
+		Description: "Typeahead over the ICD-10 code table: codes starting with q (the dot is optional) first, then codes whose description contains q.",
+		Query: []openapi.Param{{Name: "q", Description: "Code prefix or description text; required"},
+			{Name: "limit", Type: "integer", Description: "1-100, default 20"}},
+		Response: []models.ICD10Code{}})
+
+	// Prescriptions
+	spec.Describe("POST", "/api/prescriptions", openapi.Operation{Tag: "prescriptions", Summary: "Prescribe a medication",
+		Description: "Checked against the patient's allergies and active prescriptions; warnings return 409 prescription_warnings unless overrideReason is set. " +
+			"Give medicationId from /api/medications (an unknown ID returns 422) or free-text medication, which is linked to the catalog when it " +
+			"matches exactly one entry; a linked prescription's medication is the entry's name. Strengths in dosage are normalized, e.g. 0.5g to 500 mg. " +
+			"prescribedDate defaults to today and may be at most 30 days ahead; doctor_id defaults to you. An unknown patientId returns 422.",
+		Body: models.Prescription{}, Response: models.Prescription{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/visits", openapi.Operation{Tag: "medical-records", Summary: "Record a visit with its prescriptions", Roles: doctor,
+		Description: "Creates the medical record and prescriptions in one transaction: if any fails, none are created. Prescriptions are for the " +
+			"record's patient, by the caller and dated the visit date unless given. Each is safety-checked as for /api/prescriptions; " +
+			"warnings on any without overrideReason return 409 prescription_warnings listing them by index.",
+		Body: models.Visit{}, Response: models.Visit{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/medical-records/{id}/prescriptions", openapi.Operation{Tag: "medical-records",
+		Summary: "Add several prescriptions to a visit", Roles: doctor,
+		Description: "Takes an array of up to 20 prescriptions for the record's patient, linked to the record, by the caller and dated the " +
+			"visit date unless given. All are validated and safety-checked before any is created: failures return 422 with each item's " +
+			"errors by index, and unresolved warnings alone 409 prescription_warnings. Otherwise they are created in one transaction and " +
+			"returned in order with their IDs.",
+		Body: []models.Prescription{}, Response: []models.Prescription{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/prescriptions", openapi.Operation{Tag: "prescriptions", Summary: "List prescriptions",
+		Description: "Filters combine. Without limit every matching prescription is returned; the X-Total-Count header gives the number " +
+			"matching across all pages.",
+		Query: []openapi.Param{
+			{Name: "doctorId", Type: "integer", Description: "Only prescriptions by this prescriber"},
+			{Name: "medication", Type: "string", Description: "Only medications containing this text, ignoring case"},
+			{Name: "status", Type: "string", Description: "unsigned, active or ready"},
+			{Name: "from", Type: "string", Description: "Prescribed on or after this date, YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "Prescribed on or before this date, YYYY-MM-DD"},
+			{Name: "sort", Type: "string", Description: "id (default), prescribedDate or medication; prefix with - for descending"},
+			{Name: "limit", Type: "integer", Description: "Page size, at most 1000"},
+			{Name: "offset", Type: "integer", Description: "Matching prescriptions to skip"},
+			prescriptionExpand,
+		},
+		Response: []models.Prescription{}})
+	spec.Describe("GET", "/api/prescriptions/{id}", openapi.Operation{Tag: "prescriptions", Summary: "Get a prescription", Response: models.Prescription{}})
+	spec.Describe("GET", "/api/patients/{patientId}/prescriptions", openapi.Operation{Tag: "prescriptions", Summary: "List a patient's prescriptions",
+		Query: []openapi.Param{prescriptionExpand}, Response: []models.Prescription{}})
+	spec.Describe("POST", "/api/prescriptions/{id}/sign", openapi.Operation{Tag: "prescriptions", Summary: "Sign a prescription", Roles: doctor,
+		Description: "New prescriptions and refills are unsigned until their prescriber signs them with their password or a 2FA code. " +
+			"The signature stores a SHA-256 hash of the prescription's content and makes it active. 403 for a wrong password or code or " +
+			"another doctor's prescription, 409 if it is already signed.",
+		Body: models.PrescriptionSignature{}, Response: models.Prescription{}})
+	spec.Describe("POST", "/api/prescriptions/{id}/ready", openapi.Operation{Tag: "prescriptions", Summary: "Mark a prescription ready for collection", Roles: pharmacist,
+		Description: "Texts the patient, without naming the medication, when SMS notifications are configured. 409 if it is unsigned or already ready.",
+		Response:    models.Prescription{}})
+	spec.Describe("GET", "/api/pharmacy/prescriptions", openapi.Operation{Tag: "prescriptions", Summary: "List the dispensing worklist", Roles: pharmacist,
+		Description: "Prescriptions with their patient and prescriber names, oldest first.",
+		Query:       []openapi.Param{{Name: "status", Description: "unsigned, active or ready; default active and ready"}},
+		Response:    []models.PharmacistPrescription{}})
+	spec.Describe("GET", "/api/medications", openapi.Operation{Tag: "prescriptions", Summary: "Search the medication catalog",
+		Description: "Typeahead over catalog entries: names starting with q first, then names containing q.",
+		Query: []openapi.Param{{Name: "q", Description: "Medication name text; required"},
+			{Name: "limit", Type: "integer", Description: "1-100, default 20"}},
+		Response: []models.Medication{}})
+	spec.Describe("POST", "/api/medications", openapi.Operation{Tag: "prescriptions", Summary: "Add a medication catalog entry", Roles: pharmacist,
+		Description: "The strength is normalized and form and route lower-cased; an identical entry returns 409.",
+		Body:        models.Medication{}, Response: models.Medication{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/prescriptions/{id}/refill-requests", openapi.Operation{Tag: "prescriptions", Summary: "Request a refill",
+		Description: "source is \"patient\" for a request from the patient or \"front_desk\" for one raised by staff. 409 if one is already pending.",
+		Body:        refillRequestBody{}, Response: models.RefillRequest{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/refill-requests", openapi.Operation{Tag: "prescriptions", Summary: "List refill requests, oldest first",
+		Query:    []openapi.Param{{Name: "patientId", Type: "integer"}, {Name: "status", Type: "string", Description: "pending, approved or denied"}},
+		Response: []models.RefillRequest{}})
+	spec.Describe("GET", "/api/refill-requests/{id}", openapi.Operation{Tag: "prescriptions", Summary: "Get a refill request", Response: models.RefillRequest{}})
+	spec.Describe("PUT", "/api/refill-requests/{id}", openapi.Operation{Tag: "prescriptions", Summary: "Approve or deny a refill request", Roles: doctor,
+		Description: "Audited. Approving creates the refill prescription: a copy dated today, prescribed by the caller, with refillOf set and refillCount " +
+			"one higher; it is linked as refillPrescriptionId. Denying requires notes. 409 if the request was already decided or the chart is locked.",
+		Body: models.RefillDecision{}, Response: models.RefillRequest{}})
+
+	// Referrals
+	spec.Describe("POST", "/api/referrals", openapi.Operation{Tag: "referrals", Summary: "Refer a patient to a doctor or department", Roles: doctor,
+		Description: "Refers the patient from the caller to toDoctorId or, without one, to any doctor practising specialty. 422 for a referral to " +
+			"yourself or to a specialty no other doctor practises.",
+		Body: models.Referral{}, Response: models.Referral{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/referrals", openapi.Operation{Tag: "referrals", Summary: "List referrals, most urgent and then oldest first", Roles: doctor,
+		Description: "A doctor sees their own referrals unless doctorId is given. Inbound referrals include those to the doctor's specialties " +
+			"that no doctor has picked up yet; direction needs a doctor.",
+		Query: []openapi.Param{{Name: "direction", Type: "string", Description: "inbound or outbound"}, {Name: "doctorId", Type: "integer"},
+			{Name: "patientId", Type: "integer"}, {Name: "status", Type: "string", Description: "pending, accepted or declined"}},
+		Response: []models.Referral{}})
+	spec.Describe("GET", "/api/referrals/{id}", openapi.Operation{Tag: "referrals", Summary: "Get a referral", Roles: doctor, Response: models.Referral{}})
+	spec.Describe("PUT", "/api/referrals/{id}", openapi.Operation{Tag: "referrals", Summary: "Accept or decline a referral", Roles: doctor,
+		Description: "Audited. Only the referred doctor, or for a department referral a doctor of the department, decides; they become its " +
+			"recipient. Accepting with an appointment books it with the caller, and the referral stays pending if the booking fails. " +
+			"Declining requires notes. 409 if the referral was already decided.",
+		Body: models.ReferralDecision{}, Response: models.Referral{}})
+
+	// Lab orders
+	spec.Describe("POST", "/api/lab-orders", openapi.Operation{Tag: "labs", Summary: "Order a lab test", Roles: doctor,
+		Body: models.LabOrder{}, Response: models.LabOrder{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/lab-orders", openapi.Operation{Tag: "labs", Summary: "List lab orders", Roles: labReaders,
+		Query: []openapi.Param{{Name: "status", Description: "ordered, completed or cancelled"}}, Response: []models.LabOrder{}})
+	spec.Describe("GET", "/api/lab-orders/{id}", openapi.Operation{Tag: "labs", Summary: "Get a lab order with its results", Roles: labReaders, Response: models.LabOrder{}})
+	spec.Describe("POST", "/api/lab-orders/{id}/results", openapi.Operation{Tag: "labs", Summary: "Post results against an order", Roles: []string{models.ROLE_LAB_TECH},
+		Body: labResultsRequest{}, Response: []models.LabResult{}, Status: http.StatusCreated})
+
+	// Wards and admissions
+	spec.Describe("POST", "/api/wards", openapi.Operation{Tag: "admissions", Summary: "Create a ward", Body: models.Ward{}, Response: models.Ward{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/wards", openapi.Operation{Tag: "admissions", Summary: "List wards with beds and occupants", Roles: wardStaff, Response: []models.Ward{}})
+	spec.Describe("POST", "/api/wards/{id}/beds", openapi.Operation{Tag: "admissions", Summary: "Add a bed", Body: models.Bed{}, Response: models.Bed{}, Status: http.StatusCreated})
+	spec.Describe("PUT", "/api/beds/{id}", openapi.Operation{Tag: "admissions", Summary: "Take a bed out of or back into service", Body: bedServiceRequest{}, Status: http.StatusNoContent})
+	spec.Describe("POST", "/api/admissions", openapi.Operation{Tag: "admissions", Summary: "Admit a patient to a free bed", Roles: wardStaff,
+		Body: models.Admission{}, Response: models.Admission{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/admissions", openapi.Operation{Tag: "admissions", Summary: "List admissions", Roles: wardStaff,
+		Query: []openapi.Param{{Name: "status", Description: "admitted or discharged"}}, Response: []models.Admission{}})
+	spec.Describe("GET", "/api/admissions/{id}", openapi.Operation{Tag: "admissions", Summary: "Get an admission", Roles: wardStaff, Response: models.Admission{}})
+	spec.Describe("POST", "/api/admissions/{id}/transfer", openapi.Operation{Tag: "admissions", Summary: "Move the patient to another bed", Roles: wardStaff,
+		Body: transferRequest{}, Response: models.BedTransfer{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/admissions/{id}/discharge", openapi.Operation{Tag: "admissions", Summary: "Discharge with a summary", Roles: doctor,
+		Body: dischargeRequest{}, Response: models.Admission{}})
+	spec.Describe("POST", "/api/admissions/{id}/discharge-summaries", openapi.Operation{Tag: "admissions", Summary: "Generate a discharge summary", Roles: doctor,
+		Description: "Only for a discharged admission (409 otherwise). Collects the admission, active allergies, the diagnoses and treatment plans " +
+			"of visits during the stay, its prescriptions and the given follow-up instructions, and saves them as they are now. " +
+			"An admission can be summarized again; each summary is kept.",
+		Body: models.DischargeSummaryRequest{}, Response: models.DischargeSummary{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/patients/{patientId}/discharge-summaries", openapi.Operation{Tag: "admissions", Summary: "List a patient's discharge summaries",
+		Roles: wardStaff, Description: "Newest first.", Response: []models.DischargeSummary{}})
+	spec.Describe("GET", "/api/discharge-summaries/{id}", openapi.Operation{Tag: "admissions", Summary: "Get a discharge summary", Roles: wardStaff,
+		Response: models.DischargeSummary{}})
+	spec.Describe("GET", "/api/discharge-summaries/{id}/pdf", openapi.Operation{Tag: "admissions", Summary: "Download a discharge summary as a PDF", Roles: wardStaff,
+		Description: "Rendered from the saved summary. Browsers should use a download token (kind \"discharge-summary\") instead."})
+	spec.Describe("GET", "/api/admin/occupancy", openapi.Operation{Tag: "admin", Summary: "Bed occupancy per ward", Response: models.Occupancy{}})
+
+	// Housekeeping
+	spec.Describe("GET", "/api/housekeeping/tasks", openapi.Operation{Tag: "housekeeping", Summary: "List bed cleaning tasks", Roles: bedStaff,
+		Description: "Without a status, lists the outstanding (pending and in-progress) tasks, oldest first.",
+		Query: []openapi.Param{
+			{Name: "status", Type: "string", Description: "pending, in_progress or completed"},
+			{Name: "wardId", Type: "integer", Description: "Only tasks in this ward"},
+		},
+		Response: []models.HousekeepingTask{}})
+	spec.Describe("GET", "/api/housekeeping/tasks/{id}", openapi.Operation{Tag: "housekeeping", Summary: "Get a cleaning task", Roles: bedStaff,
+		Response: models.HousekeepingTask{}})
+	spec.Describe("POST", "/api/housekeeping/tasks/{id}/start", openapi.Operation{Tag: "housekeeping", Summary: "Start cleaning a bed", Roles: housekeeping,
+		Response: models.HousekeepingTask{}})
+	spec.Describe("POST", "/api/housekeeping/tasks/{id}/complete", openapi.Operation{Tag: "housekeeping", Summary: "Finish cleaning a bed", Roles: housekeeping,
+		Description: "The bed becomes assignable again.", Body: completeCleaningRequest{}, Response: models.HousekeepingTask{}})
+	spec.Describe("GET", "/api/admin/housekeeping/turnover", openapi.Operation{Tag: "admin", Summary: "Bed turnover time per ward",
+		Query: []openapi.Param{
+			{Name: "from", Type: "string", Description: "RFC 3339 or facility-local time; defaults to 30 days ago"},
+			{Name: "to", Type: "string", Description: "RFC 3339 or facility-local time; defaults to now"},
+		},
+		Response: models.TurnoverReport{}})
+	spec.Describe("GET", "/api/admin/notifications", openapi.Operation{Tag: "admin", Summary: "List queued notifications",
+		Description: "Newest first. Failed sends are retried with backoff until NOTIFY_MAX_ATTEMPTS, then marked failed.",
+		Query: []openapi.Param{
+			{Name: "status", Type: "string", Description: "pending, sending, sent, failed or cancelled"},
+			{Name: "limit", Type: "integer", Description: "Default 100, max 1000"},
+		},
+		Response: []models.Notification{}})
+	spec.Describe("POST", "/api/admin/notifications/{id}/retry", openapi.Operation{Tag: "admin", Summary: "Requeue a failed notification",
+		Response: models.Notification{}})
+	spec.Describe("POST", "/api/admin/webhooks", openapi.Operation{Tag: "admin", Summary: "Register a webhook",
+		Description: "The URL is POSTed each event of eventTypes (see /api/admin/webhooks/event-types) from now on, as JSON with deliveryId, eventType, " +
+			"eventId, entityType, entityId, occurredAt and data, the entity after the change. " +
+			"Bodies are signed like notification webhooks: X-Hospital-Signature is sha256=<hex HMAC-SHA256 of X-Hospital-Timestamp, \".\" and the body> " +
+			"with the secret. It must use https unless it is on this host. Failed deliveries are retried with backoff until WEBHOOK_MAX_ATTEMPTS; " +
+			"a retried delivery keeps its deliveryId.",
+		Body: models.WebhookRequest{}, Response: models.Webhook{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/admin/webhooks", openapi.Operation{Tag: "admin", Summary: "List webhooks", Response: []models.Webhook{}})
+	spec.Describe("GET", "/api/admin/webhooks/event-types", openapi.Operation{Tag: "admin", Summary: "List the event types webhooks can subscribe to",
+		Response: []string{}})
+	spec.Describe("GET", "/api/admin/webhooks/{id}", openapi.Operation{Tag: "admin", Summary: "Get a webhook", Response: models.Webhook{}})
+	spec.Describe("PUT", "/api/admin/webhooks/{id}", openapi.Operation{Tag: "admin", Summary: "Replace a webhook's settings and secret",
+		Description: "A webhook made inactive is sent nothing; reactivated, it is sent the events from then on, not those it missed.",
+		Body:        models.WebhookRequest{}, Response: models.Webhook{}})
+	spec.Describe("DELETE", "/api/admin/webhooks/{id}", openapi.Operation{Tag: "admin", Summary: "Delete a webhook and its delivery log",
+		Status: http.StatusNoContent})
+	spec.Describe("GET", "/api/admin/webhooks/{id}/deliveries", openapi.Operation{Tag: "admin", Summary: "List a webhook's deliveries, newest first",
+		Query: []openapi.Param{
+			{Name: "status", Type: "string", Description: "pending, sending, delivered or failed"},
+			{Name: "limit", Type: "integer", Description: "Default 100, max 1000"},
+		},
+		Response: []models.WebhookDelivery{}})
+	spec.Describe("POST", "/api/admin/webhooks/{id}/deliveries/{deliveryId}/retry", openapi.Operation{Tag: "admin", Summary: "Requeue a failed delivery",
+		Response: models.WebhookDelivery{}})
+	spec.Describe("GET", "/api/admin/break-glass", openapi.Operation{Tag: "admin", Summary: "Review break-glass grants, newest first",
+		Query:    []openapi.Param{{Name: "active", Type: "boolean", Description: "true leaves out expired grants"}},
+		Response: []models.BreakGlassAccess{}})
+	spec.Describe("GET", "/api/admin/reports", openapi.Operation{Tag: "admin", Summary: "List the predefined reports", Response: []models.ReportDefinition{}})
+	spec.Describe("GET", "/api/admin/reports/{name}", openapi.Operation{Tag: "admin", Summary: "Run a report",
+		Description: "Reports are aggregates over facility-local dates. format=csv streams the rows as a CSV download with the definition's columns, " +
+			"within the same limits as /api/patients/export.",
+		Query: []openapi.Param{
+			{Name: "from", Type: "string", Description: "First day (YYYY-MM-DD); defaults to 6 days ago"},
+			{Name: "to", Type: "string", Description: "Last day (YYYY-MM-DD); defaults to today"},
+			{Name: "format", Type: "string", Description: "json (default) or csv"},
+		},
+		Response: models.Report{}})
+	spec.Describe("POST", "/api/admin/report-schedules", openapi.Operation{Tag: "admin", Summary: "Email a report daily or weekly",
+		Description: "Daily reports cover the day before and are sent after facility-local midnight; weekly ones cover the previous Monday " +
+			"to Sunday and are sent on Mondays. The CSV is emailed through the notification queue, so SMTP must be configured.",
+		Body: models.ReportSchedule{}, Response: models.ReportSchedule{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/admin/report-schedules", openapi.Operation{Tag: "admin", Summary: "List report schedules", Response: []models.ReportSchedule{}})
+	spec.Describe("DELETE", "/api/admin/report-schedules/{id}", openapi.Operation{Tag: "admin", Summary: "Stop a scheduled report", Status: http.StatusNoContent})
+	spec.Describe("PUT", "/api/admin/flag-types/{code}", openapi.Operation{Tag: "admin", Summary: "Create or update a patient flag type",
+		Description: "visibleRoles lists the roles that can see, raise and remove flags of this type; admins always can.",
+		Body:        models.PatientFlagType{}, Response: models.PatientFlagType{}})
+	spec.Describe("PUT", "/api/admin/record-templates/{code}", openapi.Operation{Tag: "admin", Summary: "Create or update a visit template",
+		Description: "Section keys must be unique within the template (422 otherwise). Records already written from the template keep " +
+			"their sections and titles; \"active\": false retires it for new records.",
+		Body: models.RecordTemplate{}, Response: models.RecordTemplate{}})
+	spec.Describe("PUT", "/api/admin/departments/{code}", openapi.Operation{Tag: "admin", Summary: "Create or update a department",
+		Description: "Codes are case-insensitive, e.g. cardiology. Retiring a department with \"active\": false keeps its staff but no one " +
+			"new can be assigned to it.",
+		Body: models.Department{}, Response: models.Department{}})
+	spec.Describe("GET", "/api/admin/stats", openapi.Operation{Tag: "admin", Summary: "Dashboard statistics",
+		Description: "Totals are hospital-wide; the other figures cover the date range.",
+		Query: []openapi.Param{
+			{Name: "from", Type: "string", Description: "First day (YYYY-MM-DD); defaults to the start of the month 11 months ago"},
+			{Name: "to", Type: "string", Description: "Last day (YYYY-MM-DD); defaults to today"},
+			{Name: "top", Type: "integer", Description: "Number of medications listed (default 10, max 100)"},
+		},
+		Response: models.AdminStats{}})
+
+	// Roster and appointments
+	spec.Describe("GET", "/api/doctors", openapi.Operation{Tag: "appointments", Summary: "List doctors and their specialties", Roles: wardStaff,
+		Query: []openapi.Param{
+			{Name: "specialty", Type: "string", Description: "Only doctors with this specialty"},
+			{Name: "department", Type: "string", Description: "Only doctors assigned to this department"},
+		},
+		Response: []models.Doctor{}})
+	spec.Describe("PUT", "/api/doctors/{id}/specialties", openapi.Operation{Tag: "appointments", Summary: "Set a doctor's specialties",
+		Body: specialtiesRequest{}, Response: models.Doctor{}})
+	spec.Describe("POST", "/api/roster/shifts", openapi.Operation{Tag: "appointments", Summary: "Roster a doctor on duty",
+		Description: "A doctor's shifts may not overlap (409). " + localTimes,
+		Body:        models.DutyShift{}, Response: models.DutyShift{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/roster/shifts", openapi.Operation{Tag: "appointments", Summary: "List duty shifts", Roles: wardStaff,
+		Query: []openapi.Param{
+			{Name: "from", Type: "string", Description: "RFC 3339 or facility-local time; defaults to now"},
+			{Name: "to", Type: "string", Description: "RFC 3339 or facility-local time; defaults to 7 days after from"},
+			{Name: "doctorId", Type: "integer", Description: "Only this doctor's shifts"},
+		},
+		Response: []models.DutyShift{}})
+	spec.Describe("DELETE", "/api/roster/shifts/{id}", openapi.Operation{Tag: "appointments", Summary: "Remove a duty shift",
+		Description: "Appointments already booked in the shift are kept.", Status: http.StatusNoContent})
+	spec.Describe("POST", "/api/roster/time-off", openapi.Operation{Tag: "appointments", Summary: "Record a doctor's time off",
+		Description: "The doctor can't be booked during it, even inside a shift. Appointments already booked are kept. " + localTimes,
+		Body:        models.TimeOff{}, Response: models.TimeOff{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/roster/time-off", openapi.Operation{Tag: "appointments", Summary: "List doctors' time off", Roles: wardStaff,
+		Query: []openapi.Param{
+			{Name: "from", Type: "string", Description: "RFC 3339 or facility-local time; defaults to now"},
+			{Name: "to", Type: "string", Description: "RFC 3339 or facility-local time; defaults to 30 days after from"},
+			{Name: "doctorId", Type: "integer", Description: "Only this doctor's time off"},
+		},
+		Response: []models.TimeOff{}})
+	spec.Describe("DELETE", "/api/roster/time-off/{id}", openapi.Operation{Tag: "appointments", Summary: "Remove a doctor's time off",
+		Status: http.StatusNoContent})
+	spec.Describe("GET", "/api/doctors/{id}/availability", openapi.Operation{Tag: "appointments", Summary: "List a doctor's open slots", Roles: wardStaff,
+		Description: "Slots start at each shift's start and every slotMinutes after, and are open when no time off or scheduled appointment " +
+			"overlaps them. Booking the doctor outside these working hours is refused.",
+		Query: []openapi.Param{
+			{Name: "from", Type: "string", Description: "RFC 3339 or facility-local time; defaults to now"},
+			{Name: "to", Type: "string", Description: "RFC 3339 or facility-local time; defaults to 7 days after from, at most 31"},
+			{Name: "slotMinutes", Type: "integer", Description: "Slot length, 5 to 480 minutes (default 30)"},
+		},
+		Response: models.Availability{}})
+	spec.Describe("POST", "/api/doctors/{id}/calendar-feed", openapi.Operation{Tag: "appointments", Summary: "Issue a calendar feed URL",
+		Roles: doctor, Description: "Doctors issue their own feed; admins can issue any doctor's. The returned URL, for subscribing from a " +
+			"phone calendar, replaces any URL issued before.",
+		Response: models.CalendarFeed{}, Status: http.StatusCreated})
+	spec.Describe("DELETE", "/api/doctors/{id}/calendar-feed", openapi.Operation{Tag: "appointments", Summary: "Revoke a calendar feed URL",
+		Roles: doctor, Status: http.StatusNoContent})
+	spec.Describe("GET", "/api/doctors/{id}/appointments.ics", openapi.Operation{Tag: "appointments", Public: true,
+		Summary: "Doctor's appointments as an iCalendar feed",
+		Description: "Authenticated by the signed token in the URL from issuing the feed; a replaced or revoked token gets 404. Lists the " +
+			"appointments from 30 days ago to 180 days ahead, cancelled ones marked so calendars drop them. Events name the patient by " +
+			"initials only and leave out the reason for the visit.",
+		Query: []openapi.Param{{Name: "token", Type: "string", Description: "Feed token (required)"}}})
+	spec.Describe("GET", "/api/appointments/suggestion", openapi.Operation{Tag: "appointments", Summary: "Suggest a doctor for a slot", Roles: wardStaff,
+		Description: "Picks the qualified doctor on duty for the whole slot, without time off or another appointment in it, whose shift is least booked. " +
+			"Every doctor considered is listed with why they were or weren't eligible.",
+		Query: []openapi.Param{
+			{Name: "startsAt", Type: "string", Description: "RFC 3339 or facility-local time (required)"},
+			{Name: "endsAt", Type: "string", Description: "RFC 3339 or facility-local time (required)"},
+			{Name: "specialty", Type: "string", Description: "Only doctors with this specialty"},
+		},
+		Response: models.AssignmentSuggestion{}})
+	spec.Describe("POST", "/api/appointments", openapi.Operation{Tag: "appointments", Summary: "Book an appointment", Roles: wardStaff,
+		Description: "Without doctorId the suggested doctor is assigned and the suggestion returned in assignment (409 when nobody is eligible). " +
+			"A named doctor must be on a shift covering the slot, without time off or another appointment in it (409). " +
+			"When the patient needs an interpreter, a free rostered interpreter is reserved, or the agency is sent a request. " + localTimes,
+		Body: models.Appointment{}, Response: models.Appointment{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/appointments", openapi.Operation{Tag: "appointments", Summary: "List appointments", Roles: appointmentReaders,
+		Query: []openapi.Param{
+			{Name: "doctorId", Type: "integer", Description: "Only this doctor's appointments"},
+			{Name: "patientId", Type: "integer", Description: "Only this patient's appointments; always your own for patients"},
+			{Name: "department", Type: "string", Description: "Only appointments with doctors assigned to this department"},
+			{Name: "status", Type: "string", Description: "scheduled, cancelled or completed"},
+			{Name: "from", Type: "string", Description: "RFC 3339 or facility-local time; appointments ending after it"},
+			{Name: "to", Type: "string", Description: "RFC 3339 or facility-local time; appointments starting before it"},
+		},
+		Response: []models.Appointment{}})
+	spec.Describe("GET", "/api/appointments/{id}", openapi.Operation{Tag: "appointments", Summary: "Get an appointment", Roles: appointmentReaders,
+		Response: models.Appointment{}})
+	spec.Describe("GET", "/api/appointments/schedule", openapi.Operation{Tag: "appointments", Summary: "Daily clinic schedule", Roles: wardStaff,
+		Description: "The day's appointments that aren't cancelled, with each patient's language and interpreter booking.",
+		Query: []openapi.Param{
+			{Name: "date", Type: "string", Description: "Facility-local YYYY-MM-DD; defaults to today"},
+			{Name: "doctorId", Type: "integer", Description: "Only this doctor's appointments"},
+		},
+		Response: models.ClinicSchedule{}})
+	spec.Describe("POST", "/api/appointments/{id}/cancel", openapi.Operation{Tag: "appointments", Summary: "Cancel an appointment", Roles: wardStaff,
+		Description: "Also releases the interpreter, telling the agency if it was already sent a request, and drops any unsent reminder.",
+		Response:    models.Appointment{}})
+	spec.Describe("GET", "/api/patients/{patientId}/reminder-preferences", openapi.Operation{Tag: "appointments", Summary: "Get a patient's reminder preferences",
+		Roles: appointmentReaders, Description: "Patients are texted a reminder 24 hours and an hour before each appointment unless they opt out. " +
+			"Patients may only read their own.",
+		Response: models.ReminderPreferences{}})
+	spec.Describe("PUT", "/api/patients/{patientId}/reminder-preferences", openapi.Operation{Tag: "appointments", Summary: "Set a patient's reminder preferences",
+		Roles: appointmentReaders, Description: "dayBefore and hourBefore turn the 24-hour and one-hour reminders on or off; one left out is on. " +
+			"Reminders already queued are still sent. Patients may only set their own.",
+		Body: models.ReminderPreferences{}, Response: models.ReminderPreferences{}})
+
+	// Interpreters
+	spec.Describe("POST", "/api/interpreters", openapi.Operation{Tag: "interpreters", Summary: "Add an interpreter to the roster",
+		Body: models.Interpreter{}, Response: models.Interpreter{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/interpreters", openapi.Operation{Tag: "interpreters", Summary: "List the interpreter roster", Roles: wardStaff,
+		Query:    []openapi.Param{{Name: "language", Type: "string", Description: "Only active interpreters who speak it"}},
+		Response: []models.Interpreter{}})
+	spec.Describe("PUT", "/api/interpreters/{id}", openapi.Operation{Tag: "interpreters", Summary: "Update an interpreter",
+		Body: models.Interpreter{}, Response: models.Interpreter{}})
+	spec.Describe("GET", "/api/interpreter-bookings", openapi.Operation{Tag: "interpreters", Summary: "List interpreter bookings", Roles: wardStaff,
+		Query:    []openapi.Param{{Name: "status", Type: "string", Description: "reserved, requested, confirmed or cancelled"}},
+		Response: []models.InterpreterBooking{}})
+	spec.Describe("POST", "/api/interpreter-bookings/{id}/confirm", openapi.Operation{Tag: "interpreters", Summary: "Record the agency's confirmation",
+		Roles: wardStaff, Body: confirmInterpreterRequest{}, Response: models.InterpreterBooking{}})
+
+	// Walk-in queues
+	spec.Describe("POST", "/api/queues/{department}/entries", openapi.Operation{Tag: "queues", Summary: "Check a walk-in patient in", Roles: wardStaff,
+		Description: "Gives the patient the department's next ticket for today. Urgent patients are called before everyone of normal priority. " +
+			"409 when the patient is already waiting or being seen in the queue, or the department is retired.",
+		Body: models.QueueCheckIn{}, Response: models.QueueEntry{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/queues/{department}/entries", openapi.Operation{Tag: "queues", Summary: "Get a department's queue", Roles: wardStaff,
+		Description: "Today's patients being seen, then those waiting in the order they will be called. Estimated waits share the patients ahead " +
+			"and those being seen among the staff seeing patients, at the average time from called to finished over the last 20 patients.",
+		Response: models.Queue{}})
+	spec.Describe("POST", "/api/queues/{department}/call-next", openapi.Operation{Tag: "queues", Summary: "Call the next patient", Roles: wardStaff,
+		Description: "Calls the first waiting patient to the room given and completes the patient the caller was seeing in the department. " +
+			"409 when nobody is waiting.",
+		Body: models.QueueCall{}, Response: models.QueueEntry{}})
+	spec.Describe("GET", "/api/queue-entries/{id}", openapi.Operation{Tag: "queues", Summary: "Get a queue entry", Roles: wardStaff,
+		Response: models.QueueEntry{}})
+	spec.Describe("POST", "/api/queue-entries/{id}/complete", openapi.Operation{Tag: "queues", Summary: "Finish a called patient as seen", Roles: wardStaff,
+		Description: "409 unless the patient has been called and not finished.", Response: models.QueueEntry{}})
+	spec.Describe("POST", "/api/queue-entries/{id}/leave", openapi.Operation{Tag: "queues", Summary: "Take a patient off the queue", Roles: wardStaff,
+		Description: "For patients who left, or didn't answer when called. 409 once the entry is finished.", Response: models.QueueEntry{}})
+	spec.Describe("GET", "/api/queues/{department}", openapi.Operation{Tag: "queues", Public: true, Summary: "Queue display board",
+		Description: "Ticket numbers being served, most recently called first, and waiting with their estimated waits, for waiting-room " +
+			"displays. Shows nobody's name.",
+		Response: models.QueueBoard{}})
+
+	// Documents
+	spec.Describe("POST", "/api/patients/{patientId}/documents", openapi.Operation{Tag: "documents", Summary: "Upload a document", Roles: wardStaff,
+		Description: "PDFs and images only, detected from the file contents (415 otherwise); larger files than the configured limit get 413.",
+		Body:        documentUploadForm{}, BodyType: "multipart/form-data", Response: models.Document{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/patients/{patientId}/documents", openapi.Operation{Tag: "documents", Summary: "List a patient's documents", Roles: wardStaff,
+		Query: []openapi.Param{{Name: "recordId", Type: "integer", Description: "Only documents attached to this medical record"}}, Response: []models.Document{}})
+	spec.Describe("GET", "/api/medical-records/{id}/documents", openapi.Operation{Tag: "documents", Summary: "List a medical record's documents", Roles: wardStaff,
+		Response: []models.Document{}})
+	spec.Describe("GET", "/api/documents/{id}", openapi.Operation{Tag: "documents", Summary: "Get a document's details", Roles: wardStaff, Response: models.Document{}})
+	spec.Describe("GET", "/api/documents/{id}/content", openapi.Operation{Tag: "documents", Summary: "Download a document", Roles: wardStaff,
+		Description: "Browsers should use a download token (kind \"document\") instead."})
+	spec.Describe("DELETE", "/api/documents/{id}", openapi.Operation{Tag: "documents", Summary: "Delete a document", Roles: doctor, Status: http.StatusNoContent})
+	imageKind := openapi.Param{Name: "kind", Type: "string", Description: "photo (default) or id_document"}
+	spec.Describe("PUT", "/api/patients/{patientId}/photo", openapi.Operation{Tag: "documents", Summary: "Upload a patient's photo or ID document", Roles: wardStaff,
+		Description: "Replaces the patient's previous image of the kind and stores a JPEG thumbnail up to 160 pixels across. JPEG, PNG and GIF " +
+			"only, detected from the file contents (415 otherwise); files over the configured limit or images over 50 megapixels get 413.",
+		Query: []openapi.Param{imageKind}, Body: patientImageForm{}, BodyType: "multipart/form-data", Response: models.PatientImage{}})
+	spec.Describe("GET", "/api/patients/{patientId}/photo", openapi.Operation{Tag: "documents", Summary: "Get a patient's photo or ID document",
+		Roles: identityCheckers, Description: "The image as uploaded, for checking the patient's identity at check-in or the pharmacy counter.",
+		Query: []openapi.Param{imageKind, {Name: "thumbnail", Type: "boolean", Description: "Return the JPEG thumbnail instead"}}})
+	spec.Describe("DELETE", "/api/patients/{patientId}/photo", openapi.Operation{Tag: "documents", Summary: "Delete a patient's photo or ID document",
+		Roles: wardStaff, Query: []openapi.Param{imageKind}, Status: http.StatusNoContent})
+
+	// Vaccine cold chain
+	spec.Describe("POST", "/api/cold-chain/readings", openapi.Operation{Tag: "cold-chain", Public: true, Summary: "Upload sensor readings",
+		Description: "Authenticated by the storage unit's key in the X-Sensor-Key header. Readings outside the unit's thresholds open an excursion, returned here and listed as a pharmacy alert.",
+		Body:        handlers.RecordReadingsRequest{}, Response: recordReadingsResponse{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/cold-chain/units", openapi.Operation{Tag: "cold-chain", Summary: "Register a storage unit",
+		Description: "Thresholds default to the configured range. The sensor key is only returned here.",
+		Body:        models.StorageUnit{}, Response: models.StorageUnit{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/cold-chain/units", openapi.Operation{Tag: "cold-chain", Summary: "List storage units and open excursions", Roles: pharmacist, Response: []models.StorageUnit{}})
+	spec.Describe("PUT", "/api/cold-chain/units/{id}/thresholds", openapi.Operation{Tag: "cold-chain", Summary: "Set a unit's temperature range", Roles: pharmacist,
+		Body: handlers.ThresholdsRequest{}, Status: http.StatusNoContent})
+	spec.Describe("POST", "/api/cold-chain/units/{id}/sensor-key", openapi.Operation{Tag: "cold-chain", Summary: "Rotate a unit's sensor key", Response: sensorKeyResponse{}})
+	spec.Describe("GET", "/api/cold-chain/units/{id}/readings", openapi.Operation{Tag: "cold-chain", Summary: "List a unit's readings", Roles: pharmacist,
+		Query: []openapi.Param{{Name: "since", Description: "RFC 3339 time, default 24 hours ago"}}, Response: []models.TemperatureReading{}})
+	spec.Describe("GET", "/api/cold-chain/units/{id}/excursions", openapi.Operation{Tag: "cold-chain", Summary: "List a unit's excursions", Roles: pharmacist, Response: []models.TemperatureExcursion{}})
+	spec.Describe("GET", "/api/cold-chain/alerts", openapi.Operation{Tag: "cold-chain", Summary: "List unacknowledged excursions", Roles: pharmacist, Response: []models.TemperatureExcursion{}})
+	spec.Describe("POST", "/api/cold-chain/excursions/{id}/acknowledge", openapi.Operation{Tag: "cold-chain", Summary: "Acknowledge an excursion alert", Roles: pharmacist,
+		Body: acknowledgeExcursionRequest{}, Response: models.TemperatureExcursion{}})
+	spec.Describe("GET", "/api/cold-chain/excursions/{id}/report", openapi.Operation{Tag: "cold-chain", Summary: "Excursion report with readings and affected batches", Roles: pharmacist,
+		Response: models.ExcursionReport{}})
+	spec.Describe("POST", "/api/cold-chain/batches", openapi.Operation{Tag: "cold-chain", Summary: "Record a vaccine batch in a unit", Roles: pharmacist,
+		Body: models.VaccineBatch{}, Response: models.VaccineBatch{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/cold-chain/batches", openapi.Operation{Tag: "cold-chain", Summary: "List vaccine batches", Roles: pharmacist,
+		Query: []openapi.Param{{Name: "unitId", Type: "integer", Description: "Only batches in this storage unit"}}, Response: []models.VaccineBatch{}})
+	spec.Describe("PUT", "/api/cold-chain/batches/{id}/quarantine", openapi.Operation{Tag: "cold-chain", Summary: "Quarantine or release a batch", Roles: pharmacist,
+		Body: quarantineRequest{}, Status: http.StatusNoContent})
+
+	// Pre-authorization and claims
+	spec.Describe("POST", "/api/preauth/requirements", openapi.Operation{Tag: "billing", Summary: "Flag an item as needing pre-authorization",
+		Description: "An empty payer applies the flag to every payer.",
+		Body:        models.PreAuthRequirement{}, Response: models.PreAuthRequirement{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/preauth/requirements", openapi.Operation{Tag: "billing", Summary: "List items needing pre-authorization", Roles: clinicalStaff,
+		Response: []models.PreAuthRequirement{}})
+	spec.Describe("DELETE", "/api/preauth/requirements/{id}", openapi.Operation{Tag: "billing", Summary: "Remove a pre-authorization flag", Status: http.StatusNoContent})
+	spec.Describe("POST", "/api/preauth", openapi.Operation{Tag: "billing", Summary: "Request pre-authorization", Roles: clinicalStaff,
+		Body: models.PreAuthRequest{}, Response: models.PreAuthRequest{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/preauth", openapi.Operation{Tag: "billing", Summary: "List pre-authorization requests", Roles: clinicalStaff,
+		Query: []openapi.Param{
+			{Name: "patientId", Type: "integer", Description: "Only this patient's requests"},
+			{Name: "status", Description: "pending, submitted, approved or denied"},
+		}, Response: []models.PreAuthRequest{}})
+	spec.Describe("GET", "/api/preauth/{id}", openapi.Operation{Tag: "billing", Summary: "Get a pre-authorization request", Roles: clinicalStaff, Response: models.PreAuthRequest{}})
+	spec.Describe("POST", "/api/preauth/{id}/submit", openapi.Operation{Tag: "billing", Summary: "Submit a pending request to the payer's API", Roles: clinicalStaff,
+		Description: "409 when the payer has no API; record its decision with /decision instead. 502 when the payer's API fails.",
+		Response:    models.PreAuthRequest{}})
+	spec.Describe("POST", "/api/preauth/{id}/refresh", openapi.Operation{Tag: "billing", Summary: "Fetch the payer's decision", Roles: clinicalStaff, Response: models.PreAuthRequest{}})
+	spec.Describe("POST", "/api/preauth/{id}/decision", openapi.Operation{Tag: "billing", Summary: "Record the payer's decision", Roles: clinicalStaff,
+		Body: models.PreAuthDecision{}, Response: models.PreAuthRequest{}})
+	spec.Describe("POST", "/api/claims", openapi.Operation{Tag: "billing", Summary: "Draft a claim",
+		Description: "Items without a preAuthId are linked to the patient's latest approved request for the same item and payer. " +
+			"encounterType and encounterId name the patient's completed encounter being billed; 422 when it isn't one. " +
+			"Without a policyId the patient's verified policy with the payer valid today is linked, and coverage splits the total " +
+			"into the payer's share and the patient's responsibility; 422 when policyId is another patient's or payer's.",
+		Body: models.Claim{}, Response: models.Claim{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/claims", openapi.Operation{Tag: "billing", Summary: "List claims",
+		Query: []openapi.Param{{Name: "status", Description: "draft or submitted"}}, Response: []models.Claim{}})
+	spec.Describe("GET", "/api/claims/{id}", openapi.Operation{Tag: "billing", Summary: "Get a claim with its items", Response: models.Claim{}})
+	spec.Describe("POST", "/api/claims/{id}/submit", openapi.Operation{Tag: "billing", Summary: "Submit a claim",
+		Description: "Refused with 409 coding_incomplete while the claim's encounter must be coded and isn't, " +
+			"and with 409 preauth_required while any flagged item lacks an approved pre-authorization. " +
+			"A claim drafted without a policy is linked to one verified since; 409 when its policy isn't verified.",
+		Response: models.Claim{}})
+	spec.Describe("POST", "/api/patients/{patientId}/insurance", openapi.Operation{Tag: "billing", Summary: "Add an insurance policy", Roles: wardStaff,
+		Description: "The policy is unverified, and isn't applied to claims, until an admin verifies it with the payer. " +
+			"400 when validTo is before validFrom; 409 when the patient already has the payer's policy number.",
+		Body: models.InsurancePolicy{}, Response: models.InsurancePolicy{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/patients/{patientId}/insurance", openapi.Operation{Tag: "billing", Summary: "List a patient's insurance policies",
+		Roles: wardStaff, Description: "Latest starting first.", Response: []models.InsurancePolicy{}})
+	spec.Describe("GET", "/api/insurance/{id}", openapi.Operation{Tag: "billing", Summary: "Get an insurance policy", Roles: wardStaff,
+		Response: models.InsurancePolicy{}})
+	spec.Describe("PUT", "/api/insurance/{id}", openapi.Operation{Tag: "billing", Summary: "Update an insurance policy", Roles: wardStaff,
+		Description: "The policy goes back to unverified until it is verified again.",
+		Body:        models.InsurancePolicy{}, Response: models.InsurancePolicy{}})
+	spec.Describe("POST", "/api/insurance/{id}/verification", openapi.Operation{Tag: "billing", Summary: "Record a policy's verification",
+		Description: "Whether the payer confirmed (verified) or refused (rejected) the policy.",
+		Body:        models.InsuranceVerification{}, Response: models.InsurancePolicy{}})
+
+	// Clinical coding
+	spec.Describe("GET", "/api/coding/worklist", openapi.Operation{Tag: "coding", Summary: "List encounters waiting for coding", Roles: coder,
+		Description: "Uncoded encounters and those whose query the doctor has answered, oldest first.",
+		Query:       []openapi.Param{{Name: "encounterType", Description: "outpatient or inpatient"}}, Response: []models.EncounterCoding{}})
+	spec.Describe("GET", "/api/coding/queries", openapi.Operation{Tag: "coding", Summary: "List open coding queries on your encounters", Roles: doctor,
+		Query:    []openapi.Param{{Name: "doctorId", Type: "integer", Description: "Admins only; every doctor's when omitted"}},
+		Response: []models.EncounterCoding{}})
+	spec.Describe("GET", "/api/coding/encounters/{type}/{id}", openapi.Operation{Tag: "coding", Summary: "Get an encounter's coding",
+		Roles: []string{models.ROLE_CODER, models.ROLE_DOCTOR}, Response: models.EncounterCoding{}})
+	spec.Describe("PUT", "/api/coding/encounters/{type}/{id}/codes", openapi.Operation{Tag: "coding", Summary: "Assign ICD-10 and procedure codes", Roles: coder,
+		Description: "Replaces any earlier codes. 409 while a query is waiting for the doctor.",
+		Body:        models.EncounterCodes{}, Response: models.EncounterCoding{}})
+	spec.Describe("POST", "/api/coding/encounters/{type}/{id}/query", openapi.Operation{Tag: "coding", Summary: "Query the encounter's doctor", Roles: coder,
+		Description: "Blocks billing of the encounter until the doctor answers and it is coded.",
+		Body:        codingQueryRequest{}, Response: models.EncounterCoding{}})
+	spec.Describe("POST", "/api/coding/encounters/{type}/{id}/respond", openapi.Operation{Tag: "coding", Summary: "Answer a coding query", Roles: doctor,
+		Description: "Only the encounter's doctor may answer. Returns the encounter to the coders' worklist.",
+		Body:        codingResponseRequest{}, Response: models.EncounterCoding{}})
+
+	// Admin and operations
+	spec.Describe("GET", "/api/deprecations", openapi.Operation{Tag: "meta", Summary: "List deprecated routes and their usage", Response: []middleware.Deprecation{}})
+	spec.Describe("GET", "/api/admin/db/queries", openapi.Operation{Tag: "admin", Summary: "Database query stats",
+		Description: "Each statement's calls, errors, rows and durations since the server started or the reset-query-stats ops action ran. " +
+			"Statements slower than DB_SLOW_QUERY_THRESHOLD are also logged, with text parameters redacted.",
+		Query: []openapi.Param{
+			{Name: "sort", Description: "total (default), mean, max or calls; the largest first"},
+			{Name: "limit", Type: "integer", Description: "Number of statements listed (default 50, max 1000)"},
+		},
+		Response: models.QueryStats{}})
+	spec.Describe("GET", "/api/admin/ops", openapi.Operation{Tag: "admin", Summary: "List operational remediations", Response: []services.OpsAction{}})
+	spec.Describe("POST", "/api/admin/ops/{action}", openapi.Operation{Tag: "admin", Summary: "Run an operational remediation (audited)"})
+	spec.Describe("GET", "/api/admin/audit-logs/verify", openapi.Operation{Tag: "admin", Summary: "Verify the audit log's hash chain",
+		Description: "Each audit entry stores the previous entry's hash and a hash of its own content with it, and the table refuses updates and " +
+			"deletes. Walks the chain oldest first; when valid is false, brokenAt is the first entry that was altered or follows a removed one. " +
+			"Keep headHash to also detect entries removed from the end later.",
+		Response: models.AuditChainVerification{}})
+	spec.Describe("POST", "/api/admin/users/{id}/2fa-reset", openapi.Operation{Tag: "admin", Summary: "Issue a one-time 2FA reset token",
+		Description: "The token is valid for 24 hours and replaces any earlier unused one. It is only shown in this response.",
+		Response:    models.TwoFAReset{}, Status: http.StatusCreated})
+	spec.Describe("PUT", "/api/admin/users/{id}/active", openapi.Operation{Tag: "admin", Summary: "Deactivate or reactivate an account (audited)",
+		Description: "A deactivated account can't log in and its sessions are ended; it keeps its history and can be reactivated. " +
+			"Admins can't deactivate themselves (409).",
+		Body: userActiveRequest{}, Response: dto.User{}})
+	spec.Describe("POST", "/api/admin/api-keys", openapi.Operation{Tag: "admin", Summary: "Issue an API key for a machine integration",
+		Description: "The key belongs to userId, an active staff account other than an admin, whose role still applies, and can only call the routes " +
+			"its scopes cover (see /api/admin/api-keys/scopes), sent in the X-API-Key header. The key is only shown in this response; " +
+			"a 422 means the user can't have keys.",
+		Body: models.APIKeyRequest{}, Response: models.APIKey{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/admin/api-keys", openapi.Operation{Tag: "admin", Summary: "List API keys, newest first",
+		Query: []openapi.Param{{Name: "userId", Type: "integer", Description: "Only this user's keys"}}, Response: []models.APIKey{}})
+	spec.Describe("GET", "/api/admin/api-keys/scopes", openapi.Operation{Tag: "admin", Summary: "List API key scopes and the routes each covers",
+		Response: []models.APIKeyScope{}})
+	spec.Describe("GET", "/api/admin/api-keys/{id}", openapi.Operation{Tag: "admin", Summary: "Get an API key", Response: models.APIKey{}})
+	spec.Describe("POST", "/api/admin/api-keys/{id}/rotate", openapi.Operation{Tag: "admin", Summary: "Rotate an API key",
+		Description: "Issues a new key with the same user, name, scopes and expiry. The old key is revoked at once, or with graceMinutes keeps working " +
+			"that long while the integration switches over. Rotating a revoked, expired or already rotated key is a 409.",
+		Body: models.APIKeyRotation{}, Response: models.APIKey{}, Status: http.StatusCreated})
+	spec.Describe("POST", "/api/admin/api-keys/{id}/revoke", openapi.Operation{Tag: "admin", Summary: "Revoke an API key",
+		Description: "The key stops working at once. Revoking a revoked key is a 409.", Response: models.APIKey{}})
+	spec.Describe("POST", "/api/admin/exports", openapi.Operation{Tag: "admin", Summary: "Start a bulk export",
+		Description: "kind is audit-log or clinical-events. The export is written in the background as NDJSON chunks of EXPORT_CHUNK_ROWS rows; " +
+			"poll the manifest and fetch each chunk as it appears.",
+		Body: exportRequest{}, Response: models.Export{}, Status: http.StatusAccepted})
+	spec.Describe("GET", "/api/admin/exports", openapi.Operation{Tag: "admin", Summary: "List bulk exports", Response: []models.Export{}})
+	spec.Describe("GET", "/api/admin/exports/{id}", openapi.Operation{Tag: "admin", Summary: "Get an export's manifest", Response: models.Export{}})
+	spec.Describe("GET", "/api/admin/exports/{id}/chunks/{index}", openapi.Operation{Tag: "admin", Summary: "Download an export chunk",
+		Description: "Supports Range and If-Range to resume an interrupted download. The ETag is the chunk's SHA-256, as listed in the manifest."})
+	spec.Describe("DELETE", "/api/admin/exports/{id}", openapi.Operation{Tag: "admin", Summary: "Delete a finished export and its files",
+		Status: http.StatusNoContent})
+	spec.Describe("POST", "/api/admin/backups", openapi.Operation{Tag: "admin", Summary: "Back up the database",
+		Description: "Writes a consistent copy of the SQLite database to BACKUP_DIR while it stays in use, then deletes the oldest backups " +
+			"beyond BACKUP_KEEP. Backups are also taken every BACKUP_INTERVAL when set. 501 on PostgreSQL.",
+		Response: models.Backup{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/admin/backups", openapi.Operation{Tag: "admin", Summary: "List database backups, newest first",
+		Response: []models.Backup{}})
+	spec.Describe("POST", "/api/admin/backups/{name}/restore", openapi.Operation{Tag: "admin", Summary: "Restore the database from a backup",
+		Description: "Checks the backup's integrity, backs up the current database as safetyBackup, then replaces it with the backup and " +
+			"migrates it to the current schema. Everything written since the backup was taken is lost; restore safetyBackup to undo. " +
+			"Sessions stay signed in.",
+		Response: models.BackupRestore{}})
+
+	// Downloads
+	spec.Describe("POST", "/api/downloads", openapi.Operation{Tag: "downloads", Summary: "Mint a single-use download link",
+		Description: "The link is valid for one minute, for one download, and only while the minting session lasts.",
+		Body:        downloadTokenRequest{}, Response: models.DownloadToken{}, Status: http.StatusCreated})
+	spec.Describe("GET", "/api/downloads/{token}", openapi.Operation{Tag: "downloads", Public: true, Summary: "Download a file with a token",
+		Description: "For browser navigations, which can't send an Authorization header. Each download is audit-logged."})
+
+	// Public
+	spec.Describe("GET", "/health", openapi.Operation{Tag: "meta", Public: true, Summary: "Health check",
+		Description: "Reports the time in UTC and in the hospital's zone (HOSPITAL_TIMEZONE)."})
+	spec.Describe("GET", "/health/live", openapi.Operation{Tag: "meta", Public: true, Summary: "Liveness check",
+		Description: "200 whenever the process can serve HTTP; no dependencies are checked."})
+	spec.Describe("GET", "/health/ready", openapi.Operation{Tag: "meta", Public: true, Summary: "Readiness check",
+		Description: "Pings the database and runs a trivial query, and for SQLite checks the free space on the database's filesystem " +
+			"against HEALTH_MIN_FREE_DISK. Reports each check's status and latency; 503 when any fails or exceeds HEALTH_CHECK_TIMEOUT.",
+		Response: models.HealthReport{}})
+	spec.Describe("GET", "/metrics", openapi.Operation{Tag: "meta", Public: true, Summary: "Prometheus metrics",
+		Description: "Prometheus text format: HTTP requests and latency by route template and status, database statement durations, " +
+			"active sessions, failed logins and 2FA verifications. Requires METRICS_TOKEN as a bearer token when it is set."})
+	spec.Describe("GET", "/api/probes/synthetic", openapi.Operation{Tag: "meta", Public: true, Summary: "Run a synthetic transaction for uptime monitors",
+		Description: "Authenticated by PROBE_TOKEN in the X-Probe-Token header; 404 when no token is configured. Creates, reads back and deletes " +
+			"a patient marked synthetic, which never appears in patient lists, lookups or reports. 503 with the failed step if any step fails; " +
+			"synthetic patients a failed probe leaves behind are purged after SYNTHETIC_PURGE_AFTER.",
+		Response: models.ProbeResult{}})
+	spec.Describe("GET", "/api/public/stats", openapi.Operation{Tag: "meta", Public: true, Summary: "De-identified monthly statistics",
+		Description: "Covers closed calendar months only. Counts whose noisy value falls below the suppression threshold are " +
+			"withheld and the rest carry differential privacy noise.",
+		Query: []openapi.Param{{Name: "months", Type: "integer", Description: "1-36, default 12"}}, Response: services.PublicStats{}})
+	spec.Describe("GET", "/api/openapi.json", openapi.Operation{Tag: "meta", Public: true, Summary: "This document"})
+	spec.Describe("GET", "/api/docs", openapi.Operation{Tag: "meta", Public: true, Summary: "Swagger UI"})
+}
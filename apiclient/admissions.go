@@ -0,0 +1,78 @@
+package apiclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// CreateWard adds a ward; admins only
+func (c *Client) CreateWard(ctx context.Context, ward *models.Ward) (*models.Ward, error) {
+	var created models.Ward
+	if _, err := c.Do(ctx, http.MethodPost, "/api/wards", nil, ward, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// CreateBed adds a bed to a ward; admins only
+func (c *Client) CreateBed(ctx context.Context, wardID int, bed *models.Bed) (*models.Bed, error) {
+	var created models.Bed
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/wards/%s/beds", wardID), nil, bed, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Admit admits a patient to a free bed
+func (c *Client) Admit(ctx context.Context, admission *models.Admission) (*models.Admission, error) {
+	var created models.Admission
+	if _, err := c.Do(ctx, http.MethodPost, "/api/admissions", nil, admission, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Discharge closes an admission with a discharge note
+func (c *Client) Discharge(ctx context.Context, admissionID int, note string) (*models.Admission, error) {
+	var admission models.Admission
+	body := map[string]string{"summary": note}
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/admissions/%s/discharge", admissionID), nil, body, &admission); err != nil {
+		return nil, err
+	}
+	return &admission, nil
+}
+
+// GenerateDischargeSummary summarizes a discharged admission from the chart
+// with the given follow-up instructions; IsConflict reports an admission
+// that hasn't been discharged
+func (c *Client) GenerateDischargeSummary(ctx context.Context, admissionID int, followUp string) (*models.DischargeSummary, error) {
+	var summary models.DischargeSummary
+	body := models.DischargeSummaryRequest{FollowUpInstructions: followUp}
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/admissions/%s/discharge-summaries", admissionID), nil, body, &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// ListDischargeSummaries lists a patient's discharge summaries, newest first
+func (c *Client) ListDischargeSummaries(ctx context.Context, patientID int) ([]models.DischargeSummary, error) {
+	summaries := []models.DischargeSummary{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s/discharge-summaries", patientID), nil, nil, &summaries)
+	return summaries, err
+}
+
+// DischargeSummaryPDF returns a discharge summary rendered as a PDF
+func (c *Client) DischargeSummaryPDF(ctx context.Context, id int) ([]byte, error) {
+	resp, err := c.send(ctx, http.MethodGet, c.baseURL+pathf("/api/discharge-summaries/%s/pdf", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, c.decode(resp, nil)
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
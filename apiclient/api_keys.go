@@ -0,0 +1,45 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// IssueAPIKey issues a key for a machine integration's user; the key in
+// the result is only ever returned here. Admins only.
+func (c *Client) IssueAPIKey(ctx context.Context, request models.APIKeyRequest) (*models.APIKey, error) {
+	var key models.APIKey
+	if _, err := c.Do(ctx, http.MethodPost, "/api/admin/api-keys", nil, request, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListAPIKeys lists the API keys, newest first
+func (c *Client) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	_, err := c.Do(ctx, http.MethodGet, "/api/admin/api-keys", nil, nil, &keys)
+	return keys, err
+}
+
+// RotateAPIKey replaces a key with a new one, keeping the old one working
+// for graceMinutes; IsConflict reports a key already revoked or rotated
+func (c *Client) RotateAPIKey(ctx context.Context, id, graceMinutes int) (*models.APIKey, error) {
+	var key models.APIKey
+	body := models.APIKeyRotation{GraceMinutes: graceMinutes}
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/admin/api-keys/%s/rotate", id), nil, body, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey stops a key working at once
+func (c *Client) RevokeAPIKey(ctx context.Context, id int) (*models.APIKey, error) {
+	var key models.APIKey
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/admin/api-keys/%s/revoke", id), nil, nil, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
@@ -0,0 +1,154 @@
+package apiclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// AppointmentQuery filters ListAppointments; the filters combine
+type AppointmentQuery struct {
+	DoctorID  int
+	PatientID int
+	// Department limits the appointments to those with its doctors
+	Department string
+	// Status is "scheduled", "cancelled" or "completed"
+	Status string
+	// From and To select appointments overlapping the period
+	From time.Time
+	To   time.Time
+}
+
+func (q AppointmentQuery) values() url.Values {
+	values := url.Values{}
+	if q.DoctorID > 0 {
+		values.Set("doctorId", strconv.Itoa(q.DoctorID))
+	}
+	if q.PatientID > 0 {
+		values.Set("patientId", strconv.Itoa(q.PatientID))
+	}
+	if q.Department != "" {
+		values.Set("department", q.Department)
+	}
+	if q.Status != "" {
+		values.Set("status", q.Status)
+	}
+	if !q.From.IsZero() {
+		values.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		values.Set("to", q.To.Format(time.RFC3339))
+	}
+	return values
+}
+
+// ListAppointments lists the appointments matching filter
+func (c *Client) ListAppointments(ctx context.Context, filter AppointmentQuery) ([]models.Appointment, error) {
+	appointments := []models.Appointment{}
+	_, err := c.Do(ctx, http.MethodGet, "/api/appointments", filter.values(), nil, &appointments)
+	return appointments, err
+}
+
+// GetAppointment returns an appointment
+func (c *Client) GetAppointment(ctx context.Context, id int) (*models.Appointment, error) {
+	var appointment models.Appointment
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/appointments/%s", id), nil, nil, &appointment); err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// BookAppointment books an appointment. Without a DoctorID the suggested
+// doctor is assigned. A doctor who is off duty or busy fails it with
+// IsConflict.
+func (c *Client) BookAppointment(ctx context.Context, appointment *models.Appointment) (*models.Appointment, error) {
+	var booked models.Appointment
+	if _, err := c.Do(ctx, http.MethodPost, "/api/appointments", nil, appointment, &booked); err != nil {
+		return nil, err
+	}
+	return &booked, nil
+}
+
+// CancelAppointment cancels an appointment
+func (c *Client) CancelAppointment(ctx context.Context, id int) (*models.Appointment, error) {
+	var appointment models.Appointment
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/appointments/%s/cancel", id), nil, nil, &appointment); err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// IssueCalendarFeed mints a doctor's appointment feed URL, replacing the one
+// issued before. Doctors may only issue their own.
+func (c *Client) IssueCalendarFeed(ctx context.Context, doctorID int) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/doctors/%s/calendar-feed", doctorID), nil, nil, &feed); err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// RevokeCalendarFeed stops a doctor's feed URL working
+func (c *Client) RevokeCalendarFeed(ctx context.Context, doctorID int) error {
+	_, err := c.Do(ctx, http.MethodDelete, pathf("/api/doctors/%s/calendar-feed", doctorID), nil, nil, nil)
+	return err
+}
+
+// GetCalendarFeed fetches the iCalendar file at a feed's URL. The URL's
+// token authenticates it, so any client, even one without credentials, can.
+func (c *Client) GetCalendarFeed(ctx context.Context, feedURL string) ([]byte, error) {
+	resp, err := c.send(ctx, http.MethodGet, c.baseURL+feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, c.decode(resp, nil)
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// GetReminderPreferences returns which appointment reminders a patient is texted
+func (c *Client) GetReminderPreferences(ctx context.Context, patientID int) (*models.ReminderPreferences, error) {
+	var prefs models.ReminderPreferences
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s/reminder-preferences", patientID), nil, nil, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// SetReminderPreferences turns a patient's 24-hour and one-hour appointment
+// reminders on or off
+func (c *Client) SetReminderPreferences(ctx context.Context, patientID int, dayBefore, hourBefore bool) (*models.ReminderPreferences, error) {
+	var prefs models.ReminderPreferences
+	body := models.ReminderPreferences{DayBefore: dayBefore, HourBefore: hourBefore}
+	if _, err := c.Do(ctx, http.MethodPut, pathf("/api/patients/%s/reminder-preferences", patientID), nil, body, &prefs); err != nil {
+		return nil, err
+	}
+	return &prefs, nil
+}
+
+// DoctorQuery filters ListDoctors
+type DoctorQuery struct {
+	Specialty  string
+	Department string
+}
+
+// ListDoctors lists the doctors and their specialties
+func (c *Client) ListDoctors(ctx context.Context, filter DoctorQuery) ([]models.Doctor, error) {
+	query := url.Values{}
+	if filter.Specialty != "" {
+		query.Set("specialty", filter.Specialty)
+	}
+	if filter.Department != "" {
+		query.Set("department", filter.Department)
+	}
+	doctors := []models.Doctor{}
+	_, err := c.Do(ctx, http.MethodGet, "/api/doctors", query, nil, &doctors)
+	return doctors, err
+}
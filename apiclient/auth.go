@@ -0,0 +1,110 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/pquerna/otp/totp"
+)
+
+// ErrTwoFASetupRequired is returned by Login for an account that has no
+// second factor enrolled yet, which can't start a session until it has
+var ErrTwoFASetupRequired = errors.New("2FA setup required before logging in")
+
+// LoginChallenge is a login whose password has been checked and that awaits
+// a second factor
+type LoginChallenge struct {
+	TempSessionID string `json:"tempSessionId"`
+	// SecondFactors lists the ways the login can be completed: "totp"
+	// (which also accepts backup codes) and "webauthn"
+	SecondFactors []string `json:"secondFactors"`
+}
+
+// User is an account as the API returns it
+type User struct {
+	ID            int                            `json:"id"`
+	Username      string                         `json:"username"`
+	Role          string                         `json:"role"`
+	FullName      string                         `json:"fullName"`
+	TwoFAEnabled  bool                           `json:"twoFactorEnabled"`
+	Notifications models.NotificationPreferences `json:"notifications"`
+	PatientID     *int                           `json:"patientId,omitempty"`
+	Active        bool                           `json:"active"`
+	LastLoginAt   *time.Time                     `json:"lastLoginAt,omitempty"`
+}
+
+// Login checks a username and password and starts a login to complete
+// with VerifyCode
+func (c *Client) Login(ctx context.Context, username, password string) (*LoginChallenge, error) {
+	body := map[string]string{"username": username, "password": password}
+	var challenge LoginChallenge
+	if _, err := c.Do(ctx, http.MethodPost, "/api/auth/2fa/initiate", nil, body, &challenge); err != nil {
+		if hasStatus(err, http.StatusPreconditionRequired) {
+			return nil, ErrTwoFASetupRequired
+		}
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// VerifyCode completes a login with a TOTP or backup code; the client then
+// makes its calls in the new session
+func (c *Client) VerifyCode(ctx context.Context, challenge *LoginChallenge, code string) error {
+	body := map[string]string{"tempSessionId": challenge.TempSessionID, "code": code}
+	var verified struct {
+		SessionID string `json:"sessionId"`
+	}
+	if _, err := c.Do(ctx, http.MethodPost, "/api/auth/2fa/verify", nil, body, &verified); err != nil {
+		return err
+	}
+	if verified.SessionID == "" {
+		return errors.New("login verified without a session ID")
+	}
+	c.setSession(verified.SessionID)
+	return nil
+}
+
+// LoginWithCode logs in with a username, password and the code returned by
+// code, e.g. TOTP
+func (c *Client) LoginWithCode(ctx context.Context, username, password string, code func() (string, error)) error {
+	challenge, err := c.Login(ctx, username, password)
+	if err != nil {
+		return err
+	}
+	value, err := code()
+	if err != nil {
+		return err
+	}
+	return c.VerifyCode(ctx, challenge, value)
+}
+
+// TOTP returns a code source for LoginWithCode that generates the current
+// code from the account's base32 TOTP secret, for service accounts that
+// keep it alongside their password
+func TOTP(secret string) func() (string, error) {
+	return func() (string, error) {
+		return totp.GenerateCode(secret, time.Now())
+	}
+}
+
+// Logout ends the client's session
+func (c *Client) Logout(ctx context.Context) error {
+	if c.SessionID() == "" {
+		return nil
+	}
+	_, err := c.Do(ctx, http.MethodPost, "/api/auth/2fa/logout", nil, nil, nil)
+	c.setSession("")
+	return err
+}
+
+// Me returns the account the client is authenticated as
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var user User
+	if _, err := c.Do(ctx, http.MethodGet, "/api/me", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
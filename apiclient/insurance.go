@@ -0,0 +1,44 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// CreateInsurancePolicy adds an unverified policy to a patient
+func (c *Client) CreateInsurancePolicy(ctx context.Context, patientID int, policy *models.InsurancePolicy) (*models.InsurancePolicy, error) {
+	var created models.InsurancePolicy
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/patients/%s/insurance", patientID), nil, policy, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListInsurancePolicies lists a patient's policies, latest starting first
+func (c *Client) ListInsurancePolicies(ctx context.Context, patientID int) ([]models.InsurancePolicy, error) {
+	policies := []models.InsurancePolicy{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s/insurance", patientID), nil, nil, &policies)
+	return policies, err
+}
+
+// VerifyInsurancePolicy records the payer's verification, verified or
+// rejected, of a policy; admins only
+func (c *Client) VerifyInsurancePolicy(ctx context.Context, id int, status, notes string) (*models.InsurancePolicy, error) {
+	var policy models.InsurancePolicy
+	body := models.InsuranceVerification{Status: status, Notes: notes}
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/insurance/%s/verification", id), nil, body, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// CreateClaim drafts a claim; admins only
+func (c *Client) CreateClaim(ctx context.Context, claim *models.Claim) (*models.Claim, error) {
+	var created models.Claim
+	if _, err := c.Do(ctx, http.MethodPost, "/api/claims", nil, claim, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
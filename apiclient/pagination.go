@@ -0,0 +1,88 @@
+package apiclient
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// DefaultPageSize is how many items the All methods fetch per request
+const DefaultPageSize = 200
+
+// Page is one page of a listing that supports ?limit= and ?offset=
+type Page[T any] struct {
+	Items []T
+	// Offset is the position of the first item in the whole listing
+	Offset int
+	// Total is how many items match across all pages
+	Total int
+}
+
+// More reports whether items follow this page
+func (p *Page[T]) More() bool {
+	return p.Offset+len(p.Items) < p.Total
+}
+
+// PageQuery selects a page; a zero Limit returns every item in one page
+type PageQuery struct {
+	Limit  int
+	Offset int
+}
+
+func (q PageQuery) set(values url.Values) {
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+}
+
+// getPage fetches a page of path, reading the total from X-Total-Count
+func getPage[T any](ctx context.Context, c *Client, path string, query url.Values, page PageQuery) (*Page[T], error) {
+	page.set(query)
+	result := &Page[T]{Items: []T{}, Offset: page.Offset}
+	header, err := c.Do(ctx, http.MethodGet, path, query, nil, &result.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Total = page.Offset + len(result.Items)
+	if total, err := strconv.Atoi(header.Get(totalCountHeader)); err == nil {
+		result.Total = total
+	}
+	return result, nil
+}
+
+// Paginate yields every item of a listing, fetching pages of pageSize with
+// fetch as they are needed. Iteration stops at the first error, which is
+// yielded with a zero item.
+func Paginate[T any](ctx context.Context, pageSize int, fetch func(ctx context.Context, page PageQuery) (*Page[T], error)) iter.Seq2[T, error] {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return func(yield func(T, error) bool) {
+		query := PageQuery{Limit: pageSize}
+		for {
+			page, err := fetch(ctx, query)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			// An empty page ends the listing even if items were removed
+			// meanwhile, leaving the total stale
+			if len(page.Items) == 0 || !page.More() {
+				return
+			}
+			query.Offset += len(page.Items)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// ListPatients lists every patient
+func (c *Client) ListPatients(ctx context.Context) ([]models.Patient, error) {
+	patients := []models.Patient{}
+	_, err := c.Do(ctx, http.MethodGet, "/api/patients", nil, nil, &patients)
+	return patients, err
+}
+
+// ExportPatients reads the admin patient export as it streams, calling fn
+// with each patient in turn. It isn't retried: a failure part way through
+// returns an error after fn has seen the patients before it.
+func (c *Client) ExportPatients(ctx context.Context, fn func(patient models.Patient) error) error {
+	resp, err := c.send(ctx, http.MethodGet, c.baseURL+"/api/patients/export?format="+models.STREAM_FORMAT_NDJSON, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return c.decode(resp, nil)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var patient models.Patient
+		if err := decoder.Decode(&patient); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(patient); err != nil {
+			return err
+		}
+	}
+}
+
+// GetPatient returns a patient; IsNotFound reports a missing one
+func (c *Client) GetPatient(ctx context.Context, id int) (*models.Patient, error) {
+	var patient models.Patient
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s", id), nil, nil, &patient); err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+// CreatePatient registers a patient and returns it as stored
+func (c *Client) CreatePatient(ctx context.Context, patient *models.Patient) (*models.Patient, error) {
+	var created models.Patient
+	if _, err := c.Do(ctx, http.MethodPost, "/api/patients", nil, patient, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdatePatient replaces a patient's details. It fails with IsConflict
+// while someone else holds the chart lock.
+func (c *Client) UpdatePatient(ctx context.Context, id int, patient *models.Patient) (*models.Patient, error) {
+	var updated models.Patient
+	if _, err := c.Do(ctx, http.MethodPut, pathf("/api/patients/%s", id), nil, patient, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ListPatientChanges lists who changed the patient's demographic fields,
+// newest first
+func (c *Client) ListPatientChanges(ctx context.Context, id int) ([]models.PatientChange, error) {
+	changes := []models.PatientChange{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s/changes", id), nil, nil, &changes)
+	return changes, err
+}
+
+// DeletePatient deletes a patient
+func (c *Client) DeletePatient(ctx context.Context, id int) error {
+	_, err := c.Do(ctx, http.MethodDelete, pathf("/api/patients/%s", id), nil, nil, nil)
+	return err
+}
+
+// ListAllergies lists a patient's recorded allergies
+func (c *Client) ListAllergies(ctx context.Context, patientID int) ([]models.Allergy, error) {
+	allergies := []models.Allergy{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s/allergies", patientID), nil, nil, &allergies)
+	return allergies, err
+}
+
+// MedicalRecordQuery filters ListMedicalRecords
+type MedicalRecordQuery struct {
+	// Department limits the records to those written by its doctors
+	Department string
+}
+
+// ListMedicalRecords lists medical records. The server shapes records by
+// the caller's role, so fields the caller may not see are left empty.
+func (c *Client) ListMedicalRecords(ctx context.Context, filter MedicalRecordQuery) ([]models.MedicalRecord, error) {
+	query := url.Values{}
+	if filter.Department != "" {
+		query.Set("department", filter.Department)
+	}
+	records := []models.MedicalRecord{}
+	_, err := c.Do(ctx, http.MethodGet, "/api/medical-records", query, nil, &records)
+	return records, err
+}
+
+// ListPatientMedicalRecords lists a patient's medical records, shaped by
+// role as for ListMedicalRecords
+func (c *Client) ListPatientMedicalRecords(ctx context.Context, patientID int) ([]models.MedicalRecord, error) {
+	records := []models.MedicalRecord{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s/medical-records", patientID), nil, nil, &records)
+	return records, err
+}
+
+// GetMedicalRecord returns a medical record, shaped by role as for
+// ListMedicalRecords
+func (c *Client) GetMedicalRecord(ctx context.Context, id int) (*models.MedicalRecord, error) {
+	var record models.MedicalRecord
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/medical-records/%s", id), nil, nil, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// CreateMedicalRecord records a visit
+func (c *Client) CreateMedicalRecord(ctx context.Context, record *models.MedicalRecord) (*models.MedicalRecord, error) {
+	var created models.MedicalRecord
+	if _, err := c.Do(ctx, http.MethodPost, "/api/medical-records", nil, record, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListRecordTemplates lists the visit templates records can be written
+// from (doctors)
+func (c *Client) ListRecordTemplates(ctx context.Context) ([]models.RecordTemplate, error) {
+	templates := []models.RecordTemplate{}
+	_, err := c.Do(ctx, http.MethodGet, "/api/record-templates", nil, nil, &templates)
+	return templates, err
+}
+
+// SaveRecordTemplate creates or updates the visit template with
+// template.Code (admins)
+func (c *Client) SaveRecordTemplate(ctx context.Context, template *models.RecordTemplate) (*models.RecordTemplate, error) {
+	var saved models.RecordTemplate
+	if _, err := c.Do(ctx, http.MethodPut, pathf("/api/admin/record-templates/%s", template.Code), nil, template, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// ListNotes lists a medical record's notes, addenda included, in the order
+// they were written
+func (c *Client) ListNotes(ctx context.Context, recordID int) ([]models.Note, error) {
+	notes := []models.Note{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/medical-records/%s/notes", recordID), nil, nil, &notes)
+	return notes, err
+}
+
+// AddNote writes an unsigned note on a medical record
+func (c *Client) AddNote(ctx context.Context, recordID int, body string) (*models.Note, error) {
+	return c.writeNote(ctx, http.MethodPost, pathf("/api/medical-records/%s/notes", recordID), body)
+}
+
+// UpdateNote replaces the body of one of your unsigned notes
+func (c *Client) UpdateNote(ctx context.Context, recordID, noteID int, body string) (*models.Note, error) {
+	return c.writeNote(ctx, http.MethodPut, pathf("/api/medical-records/%s/notes/%s", recordID, noteID), body)
+}
+
+// SignNote signs one of your notes, after which it can't be changed
+func (c *Client) SignNote(ctx context.Context, recordID, noteID int) (*models.Note, error) {
+	var note models.Note
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/medical-records/%s/notes/%s/sign", recordID, noteID), nil, nil, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// AddAddendum writes an unsigned addendum to a signed note
+func (c *Client) AddAddendum(ctx context.Context, recordID, noteID int, body string) (*models.Note, error) {
+	return c.writeNote(ctx, http.MethodPost, pathf("/api/medical-records/%s/notes/%s/addenda", recordID, noteID), body)
+}
+
+func (c *Client) writeNote(ctx context.Context, method, path, body string) (*models.Note, error) {
+	var note models.Note
+	if _, err := c.Do(ctx, method, path, nil, &models.Note{Body: body}, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
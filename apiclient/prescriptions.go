@@ -0,0 +1,104 @@
+package apiclient
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// PrescriptionQuery filters ListPrescriptions; the filters combine
+type PrescriptionQuery struct {
+	DoctorID int
+	// Medication matches medications containing it, ignoring case
+	Medication string
+	// Status is "unsigned", "active" or "ready"
+	Status string
+	// From and To bound the prescribed date, YYYY-MM-DD, inclusive
+	From string
+	To   string
+	// Sort is "id" (the default), "prescribedDate" or "medication",
+	// prefixed with "-" to reverse it
+	Sort string
+	// Expand names the related records to include summaries of, e.g.
+	// models.EXPAND_PATIENT and models.EXPAND_DOCTOR
+	Expand []string
+}
+
+func (q PrescriptionQuery) values() url.Values {
+	values := url.Values{}
+	if q.DoctorID > 0 {
+		values.Set("doctorId", strconv.Itoa(q.DoctorID))
+	}
+	for name, value := range map[string]string{"medication": q.Medication, "status": q.Status, "from": q.From, "to": q.To, "sort": q.Sort} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	if len(q.Expand) > 0 {
+		values.Set("expand", strings.Join(q.Expand, ","))
+	}
+	return values
+}
+
+// ListPrescriptions returns a page of the prescriptions matching filter
+func (c *Client) ListPrescriptions(ctx context.Context, filter PrescriptionQuery, page PageQuery) (*Page[models.Prescription], error) {
+	return getPage[models.Prescription](ctx, c, "/api/prescriptions", filter.values(), page)
+}
+
+// AllPrescriptions yields every prescription matching filter, a page at a time
+func (c *Client) AllPrescriptions(ctx context.Context, filter PrescriptionQuery) iter.Seq2[models.Prescription, error] {
+	return Paginate(ctx, DefaultPageSize, func(ctx context.Context, page PageQuery) (*Page[models.Prescription], error) {
+		return c.ListPrescriptions(ctx, filter, page)
+	})
+}
+
+// ListPatientPrescriptions lists a patient's prescriptions
+func (c *Client) ListPatientPrescriptions(ctx context.Context, patientID int) ([]models.Prescription, error) {
+	prescriptions := []models.Prescription{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/patients/%s/prescriptions", patientID), nil, nil, &prescriptions)
+	return prescriptions, err
+}
+
+// GetPrescription returns a prescription
+func (c *Client) GetPrescription(ctx context.Context, id int) (*models.Prescription, error) {
+	var prescription models.Prescription
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/prescriptions/%s", id), nil, nil, &prescription); err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+// CreatePrescription prescribes a medication. Safety warnings fail it with
+// IsConflict, the warnings in the APIError's Details, unless the
+// prescription gives an override reason.
+func (c *Client) CreatePrescription(ctx context.Context, prescription *models.Prescription) (*models.Prescription, error) {
+	var created models.Prescription
+	if _, err := c.Do(ctx, http.MethodPost, "/api/prescriptions", nil, prescription, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// SignPrescription signs one of the caller's prescriptions, confirmed with
+// their password or a 2FA code, so the pharmacy can dispense it (doctors)
+func (c *Client) SignPrescription(ctx context.Context, id int, signature models.PrescriptionSignature) (*models.Prescription, error) {
+	var prescription models.Prescription
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/prescriptions/%s/sign", id), nil, signature, &prescription); err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+// MarkPrescriptionReady marks a prescription ready for collection (pharmacists)
+func (c *Client) MarkPrescriptionReady(ctx context.Context, id int) (*models.Prescription, error) {
+	var prescription models.Prescription
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/prescriptions/%s/ready", id), nil, nil, &prescription); err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
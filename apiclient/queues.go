@@ -0,0 +1,66 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// CheckIn checks a walk-in patient in to a department's queue; IsConflict
+// reports a patient already in it
+func (c *Client) CheckIn(ctx context.Context, department string, checkIn models.QueueCheckIn) (*models.QueueEntry, error) {
+	var entry models.QueueEntry
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/queues/%s/entries", department), nil, checkIn, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetQueue returns a department's queue today, with estimated waits
+func (c *Client) GetQueue(ctx context.Context, department string) (*models.Queue, error) {
+	var queue models.Queue
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/queues/%s/entries", department), nil, nil, &queue); err != nil {
+		return nil, err
+	}
+	return &queue, nil
+}
+
+// GetQueueBoard returns a department's queue as a waiting-room display
+// shows it; it needs no login
+func (c *Client) GetQueueBoard(ctx context.Context, department string) (*models.QueueBoard, error) {
+	var board models.QueueBoard
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/queues/%s", department), nil, nil, &board); err != nil {
+		return nil, err
+	}
+	return &board, nil
+}
+
+// CallNext calls the next waiting patient to room, completing the one the
+// caller was seeing; IsConflict reports an empty queue
+func (c *Client) CallNext(ctx context.Context, department, room string) (*models.QueueEntry, error) {
+	var entry models.QueueEntry
+	body := models.QueueCall{Room: room}
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/queues/%s/call-next", department), nil, body, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// CompleteQueueEntry finishes a called patient as seen
+func (c *Client) CompleteQueueEntry(ctx context.Context, id int) (*models.QueueEntry, error) {
+	return c.finishQueueEntry(ctx, pathf("/api/queue-entries/%s/complete", id))
+}
+
+// LeaveQueue takes a patient who left or didn't answer off the queue
+func (c *Client) LeaveQueue(ctx context.Context, id int) (*models.QueueEntry, error) {
+	return c.finishQueueEntry(ctx, pathf("/api/queue-entries/%s/leave", id))
+}
+
+func (c *Client) finishQueueEntry(ctx context.Context, path string) (*models.QueueEntry, error) {
+	var entry models.QueueEntry
+	if _, err := c.Do(ctx, http.MethodPost, path, nil, nil, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
@@ -0,0 +1,85 @@
+package apiclient
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// UserQuery filters ListUsers; the filters combine
+type UserQuery struct {
+	// Role matches case-insensitively, e.g. "doctor"
+	Role string
+	// Search matches usernames and full names containing it, ignoring case
+	Search string
+	// Active, when set, selects active (true) or deactivated (false) accounts
+	Active *bool
+}
+
+func (q UserQuery) values() url.Values {
+	values := url.Values{}
+	if q.Role != "" {
+		values.Set("role", q.Role)
+	}
+	if q.Search != "" {
+		values.Set("q", q.Search)
+	}
+	if q.Active != nil {
+		values.Set("active", strconv.FormatBool(*q.Active))
+	}
+	return values
+}
+
+// ListUsers returns a page of the accounts matching filter, ordered by ID
+func (c *Client) ListUsers(ctx context.Context, filter UserQuery, page PageQuery) (*Page[User], error) {
+	return getPage[User](ctx, c, "/api/users", filter.values(), page)
+}
+
+// AllUsers yields every account matching filter, a page at a time
+func (c *Client) AllUsers(ctx context.Context, filter UserQuery) iter.Seq2[User, error] {
+	return Paginate(ctx, DefaultPageSize, func(ctx context.Context, page PageQuery) (*Page[User], error) {
+		return c.ListUsers(ctx, filter, page)
+	})
+}
+
+// GetUser returns an account
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
+	var user User
+	if _, err := c.Do(ctx, http.MethodGet, pathf("/api/users/%s", id), nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ListDepartments lists the departments, including retired ones
+func (c *Client) ListDepartments(ctx context.Context) ([]models.Department, error) {
+	departments := []models.Department{}
+	_, err := c.Do(ctx, http.MethodGet, "/api/departments", nil, nil, &departments)
+	return departments, err
+}
+
+// SaveDepartment creates a department or updates the one with its code;
+// admins only
+func (c *Client) SaveDepartment(ctx context.Context, department *models.Department) (*models.Department, error) {
+	var saved models.Department
+	if _, err := c.Do(ctx, http.MethodPut, pathf("/api/admin/departments/%s", department.Code), nil, department, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// ListDepartmentStaff lists a department's staff, only those with role
+// unless it is empty
+func (c *Client) ListDepartmentStaff(ctx context.Context, code, role string) ([]models.DepartmentMember, error) {
+	query := url.Values{}
+	if role != "" {
+		query.Set("role", role)
+	}
+	members := []models.DepartmentMember{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/departments/%s/staff", code), query, nil, &members)
+	return members, err
+}
@@ -0,0 +1,55 @@
+package apiclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// CreateWebhook registers a webhook to be sent events from now on; admins only
+func (c *Client) CreateWebhook(ctx context.Context, request models.WebhookRequest) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if _, err := c.Do(ctx, http.MethodPost, "/api/admin/webhooks", nil, request, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// UpdateWebhook replaces a webhook's settings and secret
+func (c *Client) UpdateWebhook(ctx context.Context, id int, request models.WebhookRequest) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if _, err := c.Do(ctx, http.MethodPut, pathf("/api/admin/webhooks/%s", id), nil, request, &webhook); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (c *Client) DeleteWebhook(ctx context.Context, id int) error {
+	_, err := c.Do(ctx, http.MethodDelete, pathf("/api/admin/webhooks/%s", id), nil, nil, nil)
+	return err
+}
+
+// ListWebhookDeliveries lists a webhook's most recent deliveries, only
+// those with status unless it is empty
+func (c *Client) ListWebhookDeliveries(ctx context.Context, id int, status string) ([]models.WebhookDelivery, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	deliveries := []models.WebhookDelivery{}
+	_, err := c.Do(ctx, http.MethodGet, pathf("/api/admin/webhooks/%s/deliveries", id), query, nil, &deliveries)
+	return deliveries, err
+}
+
+// RetryWebhookDelivery requeues a failed delivery; IsConflict reports one
+// that hasn't failed
+func (c *Client) RetryWebhookDelivery(ctx context.Context, id, deliveryID int) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if _, err := c.Do(ctx, http.MethodPost, pathf("/api/admin/webhooks/%s/deliveries/%s/retry", id, deliveryID), nil, nil, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
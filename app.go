@@ -0,0 +1,891 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	gorillaHandlers "github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/config"
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/handlers"
+	"github.com/kinyaelgrande/simple-hospital/metrics"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/openapi"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+	"github.com/kinyaelgrande/simple-hospital/services/payer"
+	"github.com/kinyaelgrande/simple-hospital/services/privacy"
+	"github.com/kinyaelgrande/simple-hospital/services/storage"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/kinyaelgrande/simple-hospital/tracing"
+)
+
+// app is the API the server serves: the services over the open database,
+// their routes and the background workers they rely on. main serves it on
+// the configured listeners; the end-to-end tests serve it in-process.
+type app struct {
+	// handler serves the routes with CORS, the security headers and the
+	// request metrics around them
+	handler http.Handler
+	router  *mux.Router
+	// spec documents router
+	spec *openapi.Spec
+	// seedService creates the first admin account and the demo data
+	seedService *services.SeedService
+
+	exportService *services.ExportService
+	workers       []func(ctx context.Context)
+}
+
+// newApp builds the services and routes from cfg. The database must be
+// open; nothing runs in the background until start.
+func newApp(cfg *config.Config) (*app, error) {
+	// The ICD-10 table diagnosis codes are checked against: the built-in
+	// starter set, with ICD10_CODES_FILE loaded over it when set
+	icd10Service := services.NewICD10Service()
+	if _, err := icd10Service.LoadStarter(context.Background()); err != nil {
+		return nil, fmt.Errorf("loading the ICD-10 starter codes failed: %w", err)
+	}
+	if cfg.ICD10CodesFile != "" {
+		file, err := os.Open(cfg.ICD10CodesFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ICD10_CODES_FILE: %w", err)
+		}
+		n, err := icd10Service.Seed(context.Background(), file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("loading ICD10_CODES_FILE failed: %w", err)
+		}
+		slog.Info("ICD-10 codes loaded", "file", cfg.ICD10CodesFile, "codes", n)
+	}
+
+	// Outbound email, SMS and webhook notifications are queued in the
+	// database and sent by a background worker
+	notificationProviders, err := notifications.Open(cfg.Notifications)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification settings: %w", err)
+	}
+	securityRecipients, err := notifications.ParseRecipients(cfg.SecurityAlertRecipients)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SECURITY_ALERT_RECIPIENTS: %w", err)
+	}
+	interpreterAgency, err := notifications.ParseRecipients(cfg.InterpreterAgencyRecipients)
+	if err != nil {
+		return nil, fmt.Errorf("invalid INTERPRETER_AGENCY_RECIPIENTS: %w", err)
+	}
+	// Claims for these encounter types wait for clinical coding
+	var codingRequired []string
+	for _, encounterType := range strings.Split(cfg.CodingRequiredEncounters, ",") {
+		switch encounterType = strings.TrimSpace(encounterType); encounterType {
+		case "":
+		case models.ENCOUNTER_OUTPATIENT, models.ENCOUNTER_INPATIENT:
+			codingRequired = append(codingRequired, encounterType)
+		default:
+			return nil, fmt.Errorf("invalid CODING_REQUIRED_ENCOUNTERS: unknown encounter type %q", encounterType)
+		}
+	}
+	notificationService := services.NewNotificationService(notificationProviders, securityRecipients, cfg.NotificationMaxAttempts)
+
+	// Services over the SQLite repositories
+	userService := services.NewUserService(services.NewSQLiteUserRepo())
+	patientService := services.NewPatientService(services.NewSQLitePatientRepo())
+	medicalRecordService := services.NewMedicalRecordService(services.NewSQLiteMedicalRecordRepo())
+	prescriptionService := services.NewPrescriptionService(services.NewSQLitePrescriptionRepo(), notificationService)
+	visitService := services.NewVisitService(medicalRecordService, prescriptionService)
+
+	// Creates the first admin account, and the demo data when asked for
+	a := &app{seedService: services.NewSeedService(userService, patientService, visitService)}
+
+	// Queued notifications, appointment reminders, scheduled reports and
+	// backups run in the background while serving
+	a.background(func(ctx context.Context) { notificationService.Run(ctx, cfg.NotificationPollInterval) })
+	webhookService := services.NewWebhookService(cfg.WebhookMaxAttempts)
+	a.background(func(ctx context.Context) { webhookService.Run(ctx, cfg.WebhookPollInterval) })
+	reportService := services.NewReportService(notificationService)
+	a.background(func(ctx context.Context) { reportService.Run(ctx, cfg.ReportPollInterval) })
+	reminderService := services.NewReminderService(notificationService)
+	a.background(func(ctx context.Context) { reminderService.Run(ctx, cfg.ReminderPollInterval) })
+	backupService, err := services.NewBackupService(cfg.BackupDir, cfg.BackupKeep)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup directory: %w", err)
+	}
+	if cfg.BackupInterval > 0 {
+		if database.CurrentDialect().Name() != database.SQLite {
+			return nil, errors.New("BACKUP_INTERVAL is only supported for SQLite; back up PostgreSQL with its own tools")
+		}
+		a.background(func(ctx context.Context) { backupService.Run(ctx, cfg.BackupInterval) })
+	}
+
+	// Create handlers
+	patientFlagService := services.NewPatientFlagService()
+	streamLimits := handlers.StreamLimits{MaxDuration: cfg.StreamMaxDuration, WriteTimeout: cfg.StreamWriteTimeout}
+	patientHandler := handlers.NewPatientHandler(patientService, patientFlagService, streamLimits)
+	patientFlagHandler := handlers.NewPatientFlagHandler(patientFlagService)
+	loginEventService := services.NewLoginEventService()
+	userHandler := handlers.NewUserHandler(userService, notificationService, loginEventService)
+	breakGlassService := services.NewBreakGlassService(cfg.BreakGlassDuration, notificationService)
+	medicalRecordHandler := handlers.NewMedicalRecordHandler(medicalRecordService, breakGlassService)
+	prescriptionHandler := handlers.NewPrescriptionHandler(prescriptionService)
+	visitHandler := handlers.NewVisitHandler(visitService)
+	labHandler := handlers.NewLabHandler()
+	admissionHandler := handlers.NewAdmissionHandler()
+	dischargeSummaryService := services.NewDischargeSummaryService(medicalRecordService, prescriptionService)
+	dischargeSummaryHandler := handlers.NewDischargeSummaryHandler(dischargeSummaryService)
+	housekeepingHandler := handlers.NewHousekeepingHandler(services.NewHousekeepingService())
+	rosterHandler := handlers.NewRosterHandler(services.NewRosterService())
+	interpreterService := services.NewInterpreterService(notificationService, interpreterAgency)
+	interpreterHandler := handlers.NewInterpreterHandler(interpreterService)
+	appointmentService := services.NewAppointmentService(notificationService, interpreterService)
+	appointmentHandler := handlers.NewAppointmentHandler(appointmentService)
+	reminderHandler := handlers.NewReminderHandler(reminderService)
+	chartLockHandler := handlers.NewChartLockHandler()
+	authHandler := handlers.NewAuthHandler()
+	twoFAHandler := handlers.NewTwoFAHandler(userService, notificationService)
+	logoutHandler := handlers.NewLogoutHandler()
+	eventHandler := handlers.NewEventHandler()
+	changeStreamHandler := handlers.NewChangeStreamHandler(services.Changes, services.NewEventService())
+	coldChainHandler := handlers.NewColdChainHandler(services.NewColdChainService(cfg.ColdChainMinTemp, cfg.ColdChainMaxTemp))
+	codingService := services.NewCodingService(codingRequired)
+	codingHandler := handlers.NewCodingHandler(codingService)
+	icd10Handler := handlers.NewICD10Handler(icd10Service)
+	medicationHandler := handlers.NewMedicationHandler(services.NewMedicationService())
+	claimHandler := handlers.NewClaimHandler(services.NewClaimService(codingService))
+	insuranceHandler := handlers.NewInsuranceHandler(services.NewInsuranceService())
+
+	// Insurance pre-authorization: payers with an API get requests submitted
+	// directly, the rest are recorded by staff
+	preAuthService := services.NewPreAuthService()
+	for name, baseURL := range cfg.PayerAPIs {
+		preAuthService.RegisterPayer(name, payer.NewHTTPClient(baseURL))
+	}
+	preAuthHandler := handlers.NewPreAuthHandler(preAuthService)
+	opsService := services.NewOpsService()
+
+	// Single session store shared by the auth middleware and endpoints
+	sessionStore, err := newSessionStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	apiKeyService := services.NewAPIKeyService()
+	authMiddleware := session.NewAuthMiddleware(userService, sessionStore, loginEventService, apiKeyService, cfg.SessionLifetimes)
+	sessionHandler := session.NewHandler(userService, sessionStore, notificationService, services.NewTwoFAResetService(), loginEventService)
+	webAuthnHandler := handlers.NewWebAuthnHandler(userService, sessionStore, loginEventService)
+
+	// Patient documents are stored on disk or in an S3-compatible bucket
+	documentStore, err := storage.Open(cfg.Documents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document storage: %w", err)
+	}
+	documentService := services.NewDocumentService(documentStore)
+	documentHandler := handlers.NewDocumentHandler(documentService, cfg.DocumentMaxBytes)
+
+	// Files served to browser navigations through single-use download tokens
+	downloadService := services.NewDownloadService()
+	downloadService.Register(models.DOWNLOAD_MEDICAL_RECORDS, models.ENTITY_PATIENT, []string{models.ROLE_DOCTOR},
+		medicalRecordService.ExportPatientRecords)
+	downloadService.Register(models.DOWNLOAD_PRESCRIPTIONS, models.ENTITY_PATIENT, []string{models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PHARMACIST},
+		prescriptionService.ExportPatientPrescriptions)
+	downloadService.Register(models.DOWNLOAD_DOCUMENT, models.ENTITY_DOCUMENT, []string{models.ROLE_DOCTOR, models.ROLE_NURSE},
+		documentService.DownloadDocument)
+	downloadService.Register(models.DOWNLOAD_DISCHARGE_SUMMARY, models.ENTITY_DISCHARGE_SUMMARY, []string{models.ROLE_DOCTOR, models.ROLE_NURSE},
+		dischargeSummaryService.DownloadSummary)
+	downloadHandler := handlers.NewDownloadHandler(downloadService, sessionStore)
+
+	// Doctors' appointments as iCalendar feeds for their phone calendars
+	if cfg.CalendarFeedSecret == "" {
+		slog.Warn("CALENDAR_FEED_SECRET is not set; calendar feed URLs stop working when the server restarts")
+	}
+	calendarFeedHandler := handlers.NewCalendarFeedHandler(services.NewCalendarFeedService(appointmentService, cfg.CalendarFeedSecret))
+
+	// Bulk exports written as resumable chunk files
+	if cfg.ExportChunkRows < 1 {
+		return nil, errors.New("EXPORT_CHUNK_ROWS must be at least 1")
+	}
+	exportService, err := services.NewExportService(cfg.ExportDir, cfg.ExportChunkRows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export directory: %w", err)
+	}
+	a.exportService = exportService
+	exportService.Register(models.EXPORT_AUDIT_LOG, services.NewAuditService().ExportAll)
+	exportService.Register(models.EXPORT_CLINICAL_EVENTS, services.NewEventService().ExportAll)
+	exportHandler := handlers.NewExportHandler(exportService)
+	patientMergeHandler := handlers.NewPatientMergeHandler(services.NewPatientMergeService())
+	timelineHandler := handlers.NewTimelineHandler(services.NewTimelineService(patientService, medicalRecordService, prescriptionService))
+
+	router := mux.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Use(middleware.QueryTimeout(cfg.QueryTimeout))
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.WriteError(w, http.StatusNotFound, "Route not found")
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.WriteError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+
+	// Legacy routes keep working until their sunset date but announce it in
+	// Deprecation/Sunset headers; usage is listed at GET /api/deprecations
+	deprecations := middleware.NewDeprecations()
+	deprecatedAt := time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+	legacySunset := time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+	for _, entry := range []middleware.Deprecation{
+		{Path: "/login", Replacement: "/api/auth/2fa/initiate", Reason: "Basic auth login without a second factor"},
+		{Path: "/logout", Replacement: "/api/auth/2fa/logout", Reason: "Unversioned path outside /api"},
+		{Path: "/api/auth/login", Replacement: "/api/auth/2fa/initiate", Reason: "Alias of the former session-based endpoint"},
+		{Path: "/api/auth/verify-2fa", Replacement: "/api/auth/2fa/verify", Reason: "Alias of the former session-based endpoint"},
+		{Path: "/api/auth/logout", Replacement: "/api/auth/2fa/logout", Reason: "Alias of the former session-based endpoint"},
+		{Path: "/api/auth/2fa/debug/sessions", Reason: "Debug route"},
+		{Path: "/api/2fa/debug/time", Reason: "Debug route"},
+		{Path: "/api/2fa/debug/generate", Reason: "Debug route"},
+	} {
+		entry.DeprecatedAt = deprecatedAt
+		entry.Sunset = legacySunset
+		deprecations.Register(entry)
+	}
+	router.Use(deprecations.Middleware)
+
+	// Health check endpoint (no auth required)
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"status":    "healthy",
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"localTime": timezone.Now().Format(time.RFC3339),
+			"timezone":  timezone.Location().String(),
+			"service":   "Hospital Management System",
+		})
+	}).Methods("GET")
+	// Liveness and readiness for orchestrators: ready probes the database and
+	// the disk and answers 503 when either fails
+	healthHandler := handlers.NewHealthHandler(services.NewHealthService(cfg.HealthCheckTimeout, uint64(max(cfg.HealthMinFreeDisk, 0))))
+	router.HandleFunc("/health/live", healthHandler.Live).Methods("GET")
+	router.HandleFunc("/health/ready", healthHandler.Ready).Methods("GET")
+
+	// Prometheus metrics, authenticated by METRICS_TOKEN when it is set
+	metrics.RegisterActiveSessions(sessionStore.Count)
+	router.Handle("/metrics", metrics.Handler(cfg.MetricsToken)).Methods("GET")
+
+	// De-identified public statistics (no auth required): small counts are
+	// suppressed and the rest carry differential privacy noise
+	publisher := privacy.NewPublisher(cfg.StatsEpsilon, cfg.StatsMinCount, cfg.StatsNoiseKey)
+	publicStatsHandler := handlers.NewPublicStatsHandler(services.NewPublicStatsService(publisher))
+	router.HandleFunc("/api/public/stats", publicStatsHandler.GetStats).Methods("GET")
+
+	// OpenAPI document generated from the routes below and the annotations
+	// in api_docs.go, with a Swagger UI to browse it (no auth required)
+	apiSpec := openapi.New("Hospital Management System API", "1.0.0")
+	describeAPI(apiSpec)
+	router.HandleFunc("/api/openapi.json", apiSpec.Handler(router)).Methods("GET")
+	router.HandleFunc("/api/docs", openapi.SwaggerUI("/api/openapi.json")).Methods("GET")
+
+	// Waiting-room displays show department queues by ticket number only (no
+	// auth required)
+	queueService := services.NewQueueService()
+	queueHandler := handlers.NewQueueHandler(queueService)
+	router.HandleFunc("/api/queues/{department}", queueHandler.GetBoard).Methods("GET")
+
+	// The download token in the URL is the credential (no auth middleware)
+	router.HandleFunc("/api/downloads/{token}", downloadHandler.Download).Methods("GET")
+	// So is the signed token of a doctor's calendar feed
+	router.HandleFunc("/api/doctors/{id}/appointments.ics", calendarFeedHandler.GetFeed).Methods("GET")
+
+	// Uptime monitors authenticate with the probe token
+	probeService := services.NewProbeService(cfg.SyntheticPurgeAfter)
+	a.background(probeService.Run)
+	router.HandleFunc("/api/probes/synthetic", handlers.NewProbeHandler(probeService, cfg.ProbeToken).Synthetic).Methods("GET")
+
+	// Fridge sensors authenticate with their storage unit's sensor key
+	router.HandleFunc("/api/cold-chain/readings", coldChainHandler.RecordReadings).Methods("POST")
+
+	// Public authentication endpoints (no auth middleware)
+	authRouter := router.PathPrefix("/api/auth").Subrouter()
+
+	// Login and 2FA endpoints
+	authRouter.HandleFunc("/2fa/initiate", sessionHandler.Login).Methods("POST")
+	authRouter.HandleFunc("/2fa/verify", sessionHandler.Verify2FA).Methods("POST")
+	authRouter.HandleFunc("/2fa/logout", sessionHandler.Logout).Methods("POST")
+	authRouter.HandleFunc("/2fa/transition", sessionHandler.Transition).Methods("POST")
+	authRouter.HandleFunc("/session", sessionHandler.GetSessionInfo).Methods("GET")
+	authRouter.Handle("/sessions", authMiddleware.Authenticate(http.HandlerFunc(sessionHandler.ListSessions))).Methods("GET")
+	authRouter.Handle("/sessions/{id}", authMiddleware.Authenticate(http.HandlerFunc(sessionHandler.RevokeSession))).Methods("DELETE")
+	// 2FA setup endpoints (work with basic auth)
+	authRouter.HandleFunc("/2fa/setup", sessionHandler.Setup2FA).Methods("GET")
+	authRouter.HandleFunc("/2fa/enable", sessionHandler.Enable2FA).Methods("POST")
+	// Lost authenticator recovery with an admin-issued reset token
+	authRouter.HandleFunc("/2fa/reset", sessionHandler.RedeemTwoFAReset).Methods("POST")
+
+	// Aliases kept for clients of the former session-based endpoints
+	authRouter.HandleFunc("/login", sessionHandler.Login).Methods("POST")
+	authRouter.HandleFunc("/verify-2fa", sessionHandler.Verify2FA).Methods("POST")
+	authRouter.HandleFunc("/logout", sessionHandler.Logout).Methods("POST")
+
+	// WebAuthn (passkey / security key) endpoints - an alternative second factor to TOTP
+	authRouter.HandleFunc("/webauthn/login/begin", webAuthnHandler.BeginLogin).Methods("POST")
+	authRouter.HandleFunc("/webauthn/login/finish", webAuthnHandler.FinishLogin).Methods("POST")
+	authRouter.Handle("/webauthn/register/begin", authMiddleware.Authenticate(http.HandlerFunc(webAuthnHandler.BeginRegistration))).Methods("POST")
+	authRouter.Handle("/webauthn/register/finish", authMiddleware.Authenticate(http.HandlerFunc(webAuthnHandler.FinishRegistration))).Methods("POST")
+	authRouter.Handle("/webauthn/credentials", authMiddleware.Authenticate(http.HandlerFunc(webAuthnHandler.ListCredentials))).Methods("GET")
+	authRouter.Handle("/webauthn/credentials/{id}", authMiddleware.Authenticate(http.HandlerFunc(webAuthnHandler.DeleteCredential))).Methods("DELETE")
+
+	// Legacy login route with basic auth
+	router.Handle("/login", authMiddleware.Authenticate(http.HandlerFunc(authHandler.Login))).Methods("POST")
+
+	// Debug endpoints
+	router.HandleFunc("/api/auth/2fa/debug/sessions", func(w http.ResponseWriter, r *http.Request) {
+		response.WriteJSON(w, http.StatusOK, map[string]interface{}{
+			"totalSessions": sessionStore.Count(),
+			"currentTime":   time.Now().UTC().Format(time.RFC3339),
+			"localTime":     timezone.Now().Format(time.RFC3339),
+			"timezone":      timezone.Location().String(),
+		})
+	}).Methods("GET")
+
+	logoutRouter := router.PathPrefix("/").Subrouter()
+	logoutRouter.Handle("/logout", authMiddleware.Authenticate(http.HandlerFunc(logoutHandler.BasicAuthLogout))).Methods("POST", "GET")
+	logoutRouter.Handle("/api/auth/logout-basic", authMiddleware.Authenticate(http.HandlerFunc(logoutHandler.BasicAuthLogout))).Methods("POST", "GET")
+	logoutRouter.Handle("/api/logout/soft", authMiddleware.Authenticate(http.HandlerFunc(logoutHandler.SoftLogout))).Methods("POST", "GET")
+	logoutRouter.Handle("/api/logout/force", authMiddleware.Authenticate(http.HandlerFunc(logoutHandler.ForceLogout))).Methods("POST", "GET")
+	logoutRouter.Handle("/api/logout/redirect", authMiddleware.Authenticate(http.HandlerFunc(logoutHandler.LogoutWithRedirect))).Methods("POST", "GET")
+	logoutRouter.HandleFunc("/api/logout/status", logoutHandler.LogoutStatus).Methods("GET")
+	logoutRouter.Handle("/api/auth/clear", authMiddleware.Authenticate(http.HandlerFunc(authHandler.ClearAuth))).Methods("POST", "GET")
+
+	// Development mode - check environment variable
+	devMode := os.Getenv("DEV_MODE") == "true"
+	var chaos *middleware.Chaos
+	if devMode {
+		slog.Info("Development mode enabled - 2FA requirement bypassed")
+
+		// Fault injection for resilience testing, configured via /api/admin/chaos
+		chaos = middleware.NewChaos("/api/admin/chaos")
+		router.Use(chaos.Middleware)
+	}
+
+	// Protected routes (supports both basic auth and 2FA sessions)
+	protectedRouter := router.PathPrefix("/api").Subrouter()
+	protectedRouter.Use(authMiddleware.Authenticate)
+	protectedRouter.Use(middleware.NewReadYourWrites().Middleware)
+
+	// Patient portal accounts may only read their own patient's chart,
+	// prescriptions and appointments, and manage their own account; every
+	// other route is refused to them. Listings are narrowed to their patient.
+	patientScope := middleware.NewPatientScope()
+	patientScope.Allow("GET", "/api/me")
+	patientScope.Allow("PUT", "/api/me")
+	patientScope.Allow("GET", "/api/me/login-history")
+	for _, path := range []string{"/api/2fa/setup", "/api/2fa/status"} {
+		patientScope.Allow("GET", path)
+	}
+	for _, path := range []string{"/api/2fa/enable", "/api/2fa/disable", "/api/2fa/verify"} {
+		patientScope.Allow("POST", path)
+	}
+	patientScope.Own("GET", "/api/patients/{id}", "id")
+	patientScope.Own("GET", "/api/patients/{patientId}/medical-records", "patientId")
+	patientScope.Own("GET", "/api/patients/{patientId}/prescriptions", "patientId")
+	patientScope.Own("GET", "/api/patients/{patientId}/allergies", "patientId")
+	patientScope.Own("GET", "/api/patients/{patientId}/reminder-preferences", "patientId")
+	patientScope.Own("PUT", "/api/patients/{patientId}/reminder-preferences", "patientId")
+	patientScope.Owned("GET", "/api/medical-records/{id}", medicalRecordService.PatientOf)
+	patientScope.Owned("GET", "/api/prescriptions/{id}", prescriptionService.PatientOf)
+	patientScope.Owned("GET", "/api/appointments/{id}", appointmentService.PatientOf)
+	patientScope.Rewrite("GET", "/api/medical-records", http.HandlerFunc(medicalRecordHandler.GetMedicalRecordsByPatient), "patientId")
+	patientScope.Rewrite("GET", "/api/prescriptions", http.HandlerFunc(prescriptionHandler.GetPrescriptionsByPatient), "patientId")
+	patientScope.Filter("GET", "/api/appointments", "patientId")
+	protectedRouter.Use(patientScope.Middleware)
+
+	protectedRouter.HandleFunc("/downloads", downloadHandler.CreateToken).Methods("POST")
+
+	deprecationHandler := handlers.NewDeprecationHandler(deprecations)
+	protectedRouter.HandleFunc("/deprecations", deprecationHandler.ListDeprecations).Methods("GET")
+
+	// Patient endpoints; only admins merge duplicate registrations or export
+	// every patient, and the timeline is for doctors and nurses
+	requireAdmin := middleware.RequireRole()
+	requireClinician := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE)
+	protectedRouter.HandleFunc("/patients", patientHandler.CreatePatient).Methods("POST")
+	protectedRouter.Handle("/patients/export", requireAdmin(http.HandlerFunc(patientHandler.ExportPatients))).Methods("GET")
+	protectedRouter.HandleFunc("/patients/{id}", patientHandler.GetPatient).Methods("GET")
+	protectedRouter.HandleFunc("/patients", patientHandler.GetAllPatients).Methods("GET")
+	protectedRouter.HandleFunc("/patients/{id}", patientHandler.UpdatePatient).Methods("PUT")
+	protectedRouter.HandleFunc("/patients/{id}", patientHandler.DeletePatient).Methods("DELETE")
+	protectedRouter.HandleFunc("/patients/{id}/summary", patientHandler.GetSummary).Methods("GET")
+	protectedRouter.HandleFunc("/patients/{id}/changes", patientHandler.GetPatientChanges).Methods("GET")
+	protectedRouter.Handle("/patients/{id}/timeline", requireClinician(http.HandlerFunc(timelineHandler.GetTimeline))).Methods("GET")
+	protectedRouter.Handle("/patients/{id}/merge", requireAdmin(http.HandlerFunc(patientMergeHandler.MergePatient))).Methods("POST")
+
+	// Patient flags (fall risk, safeguarding, ...): each flag type is only
+	// visible to the roles configured on it; clinical staff raise and remove them
+	requireFlagEditor := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PHARMACIST)
+	protectedRouter.HandleFunc("/flag-types", patientFlagHandler.GetFlagTypes).Methods("GET")
+	protectedRouter.HandleFunc("/patients/{patientId}/flags", patientFlagHandler.GetFlags).Methods("GET")
+	protectedRouter.Handle("/patients/{patientId}/flags", requireFlagEditor(http.HandlerFunc(patientFlagHandler.AddFlag))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/flags/{id}/remove", requireFlagEditor(http.HandlerFunc(patientFlagHandler.RemoveFlag))).Methods("POST")
+
+	// Allergies: anyone with access to the patient reads them; clinical staff
+	// record and correct them
+	requireAllergyEditor := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PHARMACIST)
+	allergyHandler := handlers.NewAllergyHandler(services.NewAllergyService())
+	protectedRouter.HandleFunc("/patients/{patientId}/allergies", allergyHandler.GetAllergies).Methods("GET")
+	protectedRouter.Handle("/patients/{patientId}/allergies", requireAllergyEditor(http.HandlerFunc(allergyHandler.AddAllergy))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/allergies/{id}", requireAllergyEditor(http.HandlerFunc(allergyHandler.UpdateAllergy))).Methods("PUT")
+	protectedRouter.Handle("/patients/{patientId}/allergies/{id}", requireAllergyEditor(http.HandlerFunc(allergyHandler.DeleteAllergy))).Methods("DELETE")
+
+	// Advisory chart locks: the editing clinician holds the lock and other
+	// users' writes to the chart are refused until it is released or expires
+	protectedRouter.HandleFunc("/patients/{patientId}/lock", chartLockHandler.GetLock).Methods("GET")
+	protectedRouter.HandleFunc("/patients/{patientId}/lock", chartLockHandler.AcquireLock).Methods("POST")
+	protectedRouter.HandleFunc("/patients/{patientId}/lock", chartLockHandler.ReleaseLock).Methods("DELETE")
+	protectedRouter.HandleFunc("/patients/{patientId}/lock/takeover", chartLockHandler.RequestTakeover).Methods("POST")
+
+	// User endpoints
+	protectedRouter.Handle("/users", requireAdmin(http.HandlerFunc(userHandler.CreateUser))).Methods("POST")
+	protectedRouter.HandleFunc("/users", userHandler.GetUsers).Methods("GET")
+	protectedRouter.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET")
+	protectedRouter.Handle("/users/{id}/role", requireAdmin(http.HandlerFunc(userHandler.UpdateRole))).Methods("PUT")
+	protectedRouter.Handle("/users/{id}/login-history", requireAdmin(http.HandlerFunc(userHandler.GetLoginHistory))).Methods("GET")
+	protectedRouter.HandleFunc("/events", changeStreamHandler.Stream).Methods("GET")
+	protectedRouter.HandleFunc("/me", userHandler.GetMe).Methods("GET")
+	protectedRouter.HandleFunc("/me", userHandler.UpdateMe).Methods("PUT")
+	protectedRouter.HandleFunc("/me/login-history", userHandler.GetMyLoginHistory).Methods("GET")
+
+	// Departments: admins set them up and assign staff to them; doctors,
+	// appointments and medical records can be listed by department
+	departmentHandler := handlers.NewDepartmentHandler(services.NewDepartmentService())
+	protectedRouter.HandleFunc("/departments", departmentHandler.GetDepartments).Methods("GET")
+	protectedRouter.HandleFunc("/departments/{code}/staff", departmentHandler.GetMembers).Methods("GET")
+	protectedRouter.Handle("/users/{id}/departments", requireAdmin(http.HandlerFunc(departmentHandler.GetUserDepartments))).Methods("GET")
+	protectedRouter.Handle("/users/{id}/departments", requireAdmin(http.HandlerFunc(departmentHandler.SetUserDepartments))).Methods("PUT")
+
+	// Medical Record endpoints
+	protectedRouter.HandleFunc("/medical-records", medicalRecordHandler.CreateMedicalRecord).Methods("POST")
+	protectedRouter.HandleFunc("/medical-records", medicalRecordHandler.GetMedicalRecords).Methods("GET")
+	protectedRouter.HandleFunc("/medical-records/{id}", medicalRecordHandler.GetMedicalRecord).Methods("GET")
+	protectedRouter.HandleFunc("/codes/icd10", icd10Handler.Search).Methods("GET")
+	protectedRouter.HandleFunc("/patients/{patientId}/medical-records", medicalRecordHandler.GetMedicalRecordsByPatient).Methods("GET")
+
+	// Break-glass: emergency access to a patient's full records, alerted and audited
+	breakGlassHandler := handlers.NewBreakGlassHandler(breakGlassService)
+	requireBreakGlass := middleware.RequireRole(models.ROLE_NURSE, models.ROLE_LAB_TECH, models.ROLE_PHARMACIST)
+	protectedRouter.Handle("/break-glass", requireBreakGlass(http.HandlerFunc(breakGlassHandler.BreakGlass))).Methods("POST")
+
+	// Prescription endpoints
+	protectedRouter.HandleFunc("/prescriptions", prescriptionHandler.CreatePrescription).Methods("POST")
+	protectedRouter.HandleFunc("/prescriptions", prescriptionHandler.GetPrescriptions).Methods("GET")
+	protectedRouter.HandleFunc("/prescriptions/{id}", prescriptionHandler.GetPrescription).Methods("GET")
+	protectedRouter.HandleFunc("/patients/{patientId}/prescriptions", prescriptionHandler.GetPrescriptionsByPatient).Methods("GET")
+
+	// Lab order endpoints: doctors order tests, lab technicians post results
+	requireDoctor := middleware.RequireRole(models.ROLE_DOCTOR)
+	requireLabTech := middleware.RequireRole(models.ROLE_LAB_TECH)
+	requireLabReader := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_LAB_TECH)
+	protectedRouter.Handle("/lab-orders", requireDoctor(http.HandlerFunc(labHandler.CreateLabOrder))).Methods("POST")
+	protectedRouter.Handle("/lab-orders", requireLabReader(http.HandlerFunc(labHandler.GetLabOrders))).Methods("GET")
+	protectedRouter.Handle("/lab-orders/{id}", requireLabReader(http.HandlerFunc(labHandler.GetLabOrder))).Methods("GET")
+	protectedRouter.Handle("/lab-orders/{id}/results", requireLabTech(http.HandlerFunc(labHandler.AddResults))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/lab-orders", requireLabReader(http.HandlerFunc(labHandler.GetLabOrdersByPatient))).Methods("GET")
+
+	// Visit endpoint: a medical record and its prescriptions in one transaction
+	protectedRouter.Handle("/visits", requireDoctor(http.HandlerFunc(visitHandler.CreateVisit))).Methods("POST")
+	protectedRouter.Handle("/medical-records/{id}/prescriptions", requireDoctor(http.HandlerFunc(visitHandler.AddPrescriptions))).Methods("POST")
+	protectedRouter.Handle("/medical-records/{id}/lab-orders", requireLabReader(http.HandlerFunc(labHandler.GetLabOrdersByRecord))).Methods("GET")
+
+	// Clinical notes: doctors write notes on a record, edit their own until
+	// they sign them, then amend signed notes with addenda
+	noteHandler := handlers.NewNoteHandler(services.NewNoteService(), medicalRecordService)
+	protectedRouter.Handle("/medical-records/{id}/notes", requireDoctor(http.HandlerFunc(noteHandler.GetNotes))).Methods("GET")
+	protectedRouter.Handle("/medical-records/{id}/notes", requireDoctor(http.HandlerFunc(noteHandler.AddNote))).Methods("POST")
+	protectedRouter.Handle("/medical-records/{id}/notes/{noteId}", requireDoctor(http.HandlerFunc(noteHandler.UpdateNote))).Methods("PUT")
+	protectedRouter.Handle("/medical-records/{id}/notes/{noteId}/sign", requireDoctor(http.HandlerFunc(noteHandler.SignNote))).Methods("POST")
+	protectedRouter.Handle("/medical-records/{id}/notes/{noteId}/addenda", requireDoctor(http.HandlerFunc(noteHandler.AddAddendum))).Methods("POST")
+
+	// Visit templates: the sections a record written from one is made of
+	recordTemplateHandler := handlers.NewRecordTemplateHandler(services.NewRecordTemplateService())
+	protectedRouter.Handle("/record-templates", requireDoctor(http.HandlerFunc(recordTemplateHandler.GetTemplates))).Methods("GET")
+	protectedRouter.Handle("/record-templates/{code}", requireDoctor(http.HandlerFunc(recordTemplateHandler.GetTemplate))).Methods("GET")
+
+	// Wards, beds and admissions: admins manage beds, doctors and nurses admit and
+	// transfer patients, doctors discharge them
+	requireWardStaff := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE)
+	protectedRouter.Handle("/wards", requireAdmin(http.HandlerFunc(admissionHandler.CreateWard))).Methods("POST")
+	protectedRouter.Handle("/wards", requireWardStaff(http.HandlerFunc(admissionHandler.GetWards))).Methods("GET")
+	protectedRouter.Handle("/wards/{id}/beds", requireAdmin(http.HandlerFunc(admissionHandler.CreateBed))).Methods("POST")
+	protectedRouter.Handle("/beds/{id}", requireAdmin(http.HandlerFunc(admissionHandler.UpdateBed))).Methods("PUT")
+	protectedRouter.Handle("/admissions", requireWardStaff(http.HandlerFunc(admissionHandler.Admit))).Methods("POST")
+	protectedRouter.Handle("/admissions", requireWardStaff(http.HandlerFunc(admissionHandler.GetAdmissions))).Methods("GET")
+	protectedRouter.Handle("/admissions/{id}", requireWardStaff(http.HandlerFunc(admissionHandler.GetAdmission))).Methods("GET")
+	protectedRouter.Handle("/admissions/{id}/transfer", requireWardStaff(http.HandlerFunc(admissionHandler.Transfer))).Methods("POST")
+	protectedRouter.Handle("/admissions/{id}/discharge", requireDoctor(http.HandlerFunc(admissionHandler.Discharge))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/admissions", requireWardStaff(http.HandlerFunc(admissionHandler.GetAdmissionsByPatient))).Methods("GET")
+
+	// Discharge summaries: doctors generate them for discharged admissions;
+	// doctors and nurses read them as JSON or PDF
+	protectedRouter.Handle("/admissions/{id}/discharge-summaries", requireDoctor(http.HandlerFunc(dischargeSummaryHandler.Generate))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/discharge-summaries", requireWardStaff(http.HandlerFunc(dischargeSummaryHandler.GetPatientSummaries))).Methods("GET")
+	protectedRouter.Handle("/discharge-summaries/{id}", requireWardStaff(http.HandlerFunc(dischargeSummaryHandler.GetSummary))).Methods("GET")
+	protectedRouter.Handle("/discharge-summaries/{id}/pdf", requireWardStaff(http.HandlerFunc(dischargeSummaryHandler.GetSummaryPDF))).Methods("GET")
+
+	// Bed cleaning: vacated beds get a housekeeping task and can't be assigned
+	// until housekeeping completes it; ward staff can see the queue
+	requireHousekeeping := middleware.RequireRole(models.ROLE_HOUSEKEEPING)
+	requireBedStaff := middleware.RequireRole(models.ROLE_HOUSEKEEPING, models.ROLE_DOCTOR, models.ROLE_NURSE)
+	protectedRouter.Handle("/housekeeping/tasks", requireBedStaff(http.HandlerFunc(housekeepingHandler.GetTasks))).Methods("GET")
+	protectedRouter.Handle("/housekeeping/tasks/{id}", requireBedStaff(http.HandlerFunc(housekeepingHandler.GetTask))).Methods("GET")
+	protectedRouter.Handle("/housekeeping/tasks/{id}/start", requireHousekeeping(http.HandlerFunc(housekeepingHandler.StartCleaning))).Methods("POST")
+	protectedRouter.Handle("/housekeeping/tasks/{id}/complete", requireHousekeeping(http.HandlerFunc(housekeepingHandler.CompleteCleaning))).Methods("POST")
+
+	// Duty roster and appointments: admins roster doctors, record their
+	// specialties and time off; ward staff book appointments within doctors'
+	// working hours, with the least-loaded doctor on duty suggested when the
+	// booking doesn't name one. Patients may look up their own appointments
+	// and choose which reminders they are texted. Doctors subscribe to their
+	// own appointments through a calendar feed.
+	requireAppointmentReader := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PATIENT)
+	protectedRouter.Handle("/doctors", requireWardStaff(http.HandlerFunc(rosterHandler.GetDoctors))).Methods("GET")
+	protectedRouter.Handle("/doctors/{id}/specialties", requireAdmin(http.HandlerFunc(rosterHandler.SetSpecialties))).Methods("PUT")
+	protectedRouter.Handle("/roster/shifts", requireAdmin(http.HandlerFunc(rosterHandler.CreateShift))).Methods("POST")
+	protectedRouter.Handle("/roster/shifts", requireWardStaff(http.HandlerFunc(rosterHandler.GetShifts))).Methods("GET")
+	protectedRouter.Handle("/roster/shifts/{id}", requireAdmin(http.HandlerFunc(rosterHandler.DeleteShift))).Methods("DELETE")
+	protectedRouter.Handle("/roster/time-off", requireAdmin(http.HandlerFunc(rosterHandler.CreateTimeOff))).Methods("POST")
+	protectedRouter.Handle("/roster/time-off", requireWardStaff(http.HandlerFunc(rosterHandler.GetTimeOff))).Methods("GET")
+	protectedRouter.Handle("/roster/time-off/{id}", requireAdmin(http.HandlerFunc(rosterHandler.DeleteTimeOff))).Methods("DELETE")
+	protectedRouter.Handle("/doctors/{id}/availability", requireWardStaff(http.HandlerFunc(rosterHandler.GetAvailability))).Methods("GET")
+	protectedRouter.Handle("/doctors/{id}/calendar-feed", requireDoctor(http.HandlerFunc(calendarFeedHandler.IssueFeed))).Methods("POST")
+	protectedRouter.Handle("/doctors/{id}/calendar-feed", requireDoctor(http.HandlerFunc(calendarFeedHandler.RevokeFeed))).Methods("DELETE")
+	protectedRouter.Handle("/appointments/suggestion", requireWardStaff(http.HandlerFunc(appointmentHandler.Suggest))).Methods("GET")
+	protectedRouter.Handle("/appointments/schedule", requireWardStaff(http.HandlerFunc(appointmentHandler.GetSchedule))).Methods("GET")
+	protectedRouter.Handle("/appointments", requireWardStaff(http.HandlerFunc(appointmentHandler.Book))).Methods("POST")
+	protectedRouter.Handle("/appointments", requireAppointmentReader(http.HandlerFunc(appointmentHandler.GetAppointments))).Methods("GET")
+	protectedRouter.Handle("/appointments/{id}", requireAppointmentReader(http.HandlerFunc(appointmentHandler.GetAppointment))).Methods("GET")
+	protectedRouter.Handle("/appointments/{id}/cancel", requireWardStaff(http.HandlerFunc(appointmentHandler.Cancel))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/reminder-preferences", requireAppointmentReader(http.HandlerFunc(reminderHandler.GetPreferences))).Methods("GET")
+	protectedRouter.Handle("/patients/{patientId}/reminder-preferences", requireAppointmentReader(http.HandlerFunc(reminderHandler.SetPreferences))).Methods("PUT")
+
+	// Walk-in queues: ward staff check patients in to a department's queue
+	// and call them in order, urgent first
+	protectedRouter.Handle("/queues/{department}/entries", requireWardStaff(http.HandlerFunc(queueHandler.CheckIn))).Methods("POST")
+	protectedRouter.Handle("/queues/{department}/entries", requireWardStaff(http.HandlerFunc(queueHandler.GetQueue))).Methods("GET")
+	protectedRouter.Handle("/queues/{department}/call-next", requireWardStaff(http.HandlerFunc(queueHandler.CallNext))).Methods("POST")
+	protectedRouter.Handle("/queue-entries/{id}", requireWardStaff(http.HandlerFunc(queueHandler.GetEntry))).Methods("GET")
+	protectedRouter.Handle("/queue-entries/{id}/complete", requireWardStaff(http.HandlerFunc(queueHandler.Complete))).Methods("POST")
+	protectedRouter.Handle("/queue-entries/{id}/leave", requireWardStaff(http.HandlerFunc(queueHandler.Leave))).Methods("POST")
+
+	// Interpreters: patients who need one get a rostered interpreter reserved
+	// with each appointment, or an agency request when nobody is free
+	protectedRouter.Handle("/interpreters", requireAdmin(http.HandlerFunc(interpreterHandler.CreateInterpreter))).Methods("POST")
+	protectedRouter.Handle("/interpreters", requireWardStaff(http.HandlerFunc(interpreterHandler.GetInterpreters))).Methods("GET")
+	protectedRouter.Handle("/interpreters/{id}", requireAdmin(http.HandlerFunc(interpreterHandler.UpdateInterpreter))).Methods("PUT")
+	protectedRouter.Handle("/interpreter-bookings", requireWardStaff(http.HandlerFunc(interpreterHandler.GetBookings))).Methods("GET")
+	protectedRouter.Handle("/interpreter-bookings/{id}/confirm", requireWardStaff(http.HandlerFunc(interpreterHandler.Confirm))).Methods("POST")
+
+	// Vaccine cold chain: admins register storage units and their sensors,
+	// pharmacists track batches and handle temperature excursion alerts
+	requirePharmacist := middleware.RequireRole(models.ROLE_PHARMACIST)
+	protectedRouter.Handle("/cold-chain/units", requireAdmin(http.HandlerFunc(coldChainHandler.CreateUnit))).Methods("POST")
+	protectedRouter.Handle("/cold-chain/units", requirePharmacist(http.HandlerFunc(coldChainHandler.GetUnits))).Methods("GET")
+	protectedRouter.Handle("/cold-chain/units/{id}/thresholds", requirePharmacist(http.HandlerFunc(coldChainHandler.SetThresholds))).Methods("PUT")
+	protectedRouter.Handle("/cold-chain/units/{id}/sensor-key", requireAdmin(http.HandlerFunc(coldChainHandler.RotateSensorKey))).Methods("POST")
+	protectedRouter.Handle("/cold-chain/units/{id}/readings", requirePharmacist(http.HandlerFunc(coldChainHandler.GetReadings))).Methods("GET")
+	protectedRouter.Handle("/cold-chain/units/{id}/excursions", requirePharmacist(http.HandlerFunc(coldChainHandler.GetExcursions))).Methods("GET")
+	protectedRouter.Handle("/cold-chain/alerts", requirePharmacist(http.HandlerFunc(coldChainHandler.GetAlerts))).Methods("GET")
+	protectedRouter.Handle("/cold-chain/excursions/{id}/acknowledge", requirePharmacist(http.HandlerFunc(coldChainHandler.AcknowledgeExcursion))).Methods("POST")
+	protectedRouter.Handle("/cold-chain/excursions/{id}/report", requirePharmacist(http.HandlerFunc(coldChainHandler.GetExcursionReport))).Methods("GET")
+	protectedRouter.Handle("/cold-chain/batches", requirePharmacist(http.HandlerFunc(coldChainHandler.CreateBatch))).Methods("POST")
+	protectedRouter.Handle("/cold-chain/batches", requirePharmacist(http.HandlerFunc(coldChainHandler.GetBatches))).Methods("GET")
+	protectedRouter.Handle("/cold-chain/batches/{id}/quarantine", requirePharmacist(http.HandlerFunc(coldChainHandler.QuarantineBatch))).Methods("PUT")
+
+	// Pharmacy: the patient is texted when their prescription is ready to collect
+	protectedRouter.Handle("/prescriptions/{id}/sign", requireDoctor(http.HandlerFunc(prescriptionHandler.SignPrescription))).Methods("POST")
+	protectedRouter.Handle("/prescriptions/{id}/ready", requirePharmacist(http.HandlerFunc(prescriptionHandler.MarkReady))).Methods("POST")
+	protectedRouter.Handle("/pharmacy/prescriptions", requirePharmacist(http.HandlerFunc(prescriptionHandler.GetPharmacyWorklist))).Methods("GET")
+
+	// Medication catalog: anyone can search it, pharmacists maintain it
+	protectedRouter.HandleFunc("/medications", medicationHandler.Search).Methods("GET")
+	protectedRouter.Handle("/medications", requirePharmacist(http.HandlerFunc(medicationHandler.CreateMedication))).Methods("POST")
+
+	// Refill requests: any staff member records one for a patient; doctors
+	// approve them, which writes the refill prescription, or deny them
+	refillHandler := handlers.NewRefillHandler(services.NewRefillService())
+	protectedRouter.HandleFunc("/prescriptions/{id}/refill-requests", refillHandler.CreateRequest).Methods("POST")
+	protectedRouter.HandleFunc("/refill-requests", refillHandler.GetRequests).Methods("GET")
+	protectedRouter.HandleFunc("/refill-requests/{id}", refillHandler.GetRequest).Methods("GET")
+	protectedRouter.Handle("/refill-requests/{id}", requireDoctor(http.HandlerFunc(refillHandler.Decide))).Methods("PUT")
+
+	// Referrals: a doctor refers a patient to a colleague or a department;
+	// the receiving doctor accepts, optionally booking an appointment, or declines
+	referralHandler := handlers.NewReferralHandler(services.NewReferralService(appointmentService))
+	protectedRouter.Handle("/referrals", requireDoctor(http.HandlerFunc(referralHandler.CreateReferral))).Methods("POST")
+	protectedRouter.Handle("/referrals", requireDoctor(http.HandlerFunc(referralHandler.GetReferrals))).Methods("GET")
+	protectedRouter.Handle("/referrals/{id}", requireDoctor(http.HandlerFunc(referralHandler.GetReferral))).Methods("GET")
+	protectedRouter.Handle("/referrals/{id}", requireDoctor(http.HandlerFunc(referralHandler.Decide))).Methods("PUT")
+
+	// Patient documents: doctors and nurses attach and read scans, PDFs and
+	// images; only doctors delete them
+	protectedRouter.Handle("/patients/{patientId}/documents", requireWardStaff(http.HandlerFunc(documentHandler.UploadDocument))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/documents", requireWardStaff(http.HandlerFunc(documentHandler.GetPatientDocuments))).Methods("GET")
+	protectedRouter.Handle("/medical-records/{id}/documents", requireWardStaff(http.HandlerFunc(documentHandler.GetRecordDocuments))).Methods("GET")
+	protectedRouter.Handle("/documents/{id}", requireWardStaff(http.HandlerFunc(documentHandler.GetDocument))).Methods("GET")
+	protectedRouter.Handle("/documents/{id}/content", requireWardStaff(http.HandlerFunc(documentHandler.GetDocumentContent))).Methods("GET")
+	protectedRouter.Handle("/documents/{id}", requireDoctor(http.HandlerFunc(documentHandler.DeleteDocument))).Methods("DELETE")
+
+	// Patient photo and ID document: ward staff capture them at check-in;
+	// everyone who hands patients medication or takes samples sees them
+	patientImageHandler := handlers.NewPatientImageHandler(services.NewPatientImageService(documentStore), cfg.PatientImageMaxBytes)
+	requireIdentityCheck := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PHARMACIST, models.ROLE_LAB_TECH)
+	protectedRouter.Handle("/patients/{patientId}/photo", requireWardStaff(http.HandlerFunc(patientImageHandler.SaveImage))).Methods("PUT")
+	protectedRouter.Handle("/patients/{patientId}/photo", requireIdentityCheck(http.HandlerFunc(patientImageHandler.GetImage))).Methods("GET")
+	protectedRouter.Handle("/patients/{patientId}/photo", requireWardStaff(http.HandlerFunc(patientImageHandler.DeleteImage))).Methods("DELETE")
+
+	// Insurance pre-authorization and claims: clinical staff request approval
+	// for flagged procedures and medications, admins maintain the flags and
+	// bill payers. Ward staff record patients' policies; admins verify them
+	// with the payer before they apply to claims.
+	requireClinicalStaff := middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_PHARMACIST)
+	protectedRouter.Handle("/preauth/requirements", requireAdmin(http.HandlerFunc(preAuthHandler.CreateRequirement))).Methods("POST")
+	protectedRouter.Handle("/preauth/requirements", requireClinicalStaff(http.HandlerFunc(preAuthHandler.GetRequirements))).Methods("GET")
+	protectedRouter.Handle("/preauth/requirements/{id}", requireAdmin(http.HandlerFunc(preAuthHandler.DeleteRequirement))).Methods("DELETE")
+	protectedRouter.Handle("/preauth", requireClinicalStaff(http.HandlerFunc(preAuthHandler.CreateRequest))).Methods("POST")
+	protectedRouter.Handle("/preauth", requireClinicalStaff(http.HandlerFunc(preAuthHandler.GetRequests))).Methods("GET")
+	protectedRouter.Handle("/preauth/{id}", requireClinicalStaff(http.HandlerFunc(preAuthHandler.GetRequest))).Methods("GET")
+	protectedRouter.Handle("/preauth/{id}/submit", requireClinicalStaff(http.HandlerFunc(preAuthHandler.Submit))).Methods("POST")
+	protectedRouter.Handle("/preauth/{id}/refresh", requireClinicalStaff(http.HandlerFunc(preAuthHandler.Refresh))).Methods("POST")
+	protectedRouter.Handle("/preauth/{id}/decision", requireClinicalStaff(http.HandlerFunc(preAuthHandler.RecordDecision))).Methods("POST")
+	protectedRouter.Handle("/claims", requireAdmin(http.HandlerFunc(claimHandler.CreateClaim))).Methods("POST")
+	protectedRouter.Handle("/claims", requireAdmin(http.HandlerFunc(claimHandler.GetClaims))).Methods("GET")
+	protectedRouter.Handle("/claims/{id}", requireAdmin(http.HandlerFunc(claimHandler.GetClaim))).Methods("GET")
+	protectedRouter.Handle("/claims/{id}/submit", requireAdmin(http.HandlerFunc(claimHandler.SubmitClaim))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/insurance", requireWardStaff(http.HandlerFunc(insuranceHandler.CreatePolicy))).Methods("POST")
+	protectedRouter.Handle("/patients/{patientId}/insurance", requireWardStaff(http.HandlerFunc(insuranceHandler.GetPolicies))).Methods("GET")
+	protectedRouter.Handle("/insurance/{id}", requireWardStaff(http.HandlerFunc(insuranceHandler.GetPolicy))).Methods("GET")
+	protectedRouter.Handle("/insurance/{id}", requireWardStaff(http.HandlerFunc(insuranceHandler.UpdatePolicy))).Methods("PUT")
+	protectedRouter.Handle("/insurance/{id}/verification", requireAdmin(http.HandlerFunc(insuranceHandler.VerifyPolicy))).Methods("POST")
+
+	// Clinical coding: completed encounters wait on the coders' worklist for
+	// ICD-10 and procedure codes; coders query the encounter's doctor when the
+	// documentation doesn't support coding
+	requireCoder := middleware.RequireRole(models.ROLE_CODER)
+	requireCodingReader := middleware.RequireRole(models.ROLE_CODER, models.ROLE_DOCTOR)
+	protectedRouter.Handle("/coding/worklist", requireCoder(http.HandlerFunc(codingHandler.GetWorklist))).Methods("GET")
+	protectedRouter.Handle("/coding/queries", requireDoctor(http.HandlerFunc(codingHandler.GetQueries))).Methods("GET")
+	protectedRouter.Handle("/coding/encounters/{type}/{id}", requireCodingReader(http.HandlerFunc(codingHandler.GetEncounter))).Methods("GET")
+	protectedRouter.Handle("/coding/encounters/{type}/{id}/codes", requireCoder(http.HandlerFunc(codingHandler.AssignCodes))).Methods("PUT")
+	protectedRouter.Handle("/coding/encounters/{type}/{id}/query", requireCoder(http.HandlerFunc(codingHandler.Query))).Methods("POST")
+	protectedRouter.Handle("/coding/encounters/{type}/{id}/respond", requireDoctor(http.HandlerFunc(codingHandler.Respond))).Methods("POST")
+
+	// Two Factor Authentication endpoints (protected routes)
+	twoFARouter := protectedRouter.PathPrefix("/2fa").Subrouter()
+	twoFARouter.HandleFunc("/setup", twoFAHandler.GenerateTwoFASetup).Methods("GET")
+	twoFARouter.HandleFunc("/enable", twoFAHandler.EnableTwoFA).Methods("POST")
+	twoFARouter.HandleFunc("/disable", twoFAHandler.DisableTwoFA).Methods("POST")
+	twoFARouter.HandleFunc("/status", twoFAHandler.GetTwoFAStatus).Methods("GET")
+	twoFARouter.HandleFunc("/verify", twoFAHandler.VerifyTwoFACode).Methods("POST")
+	twoFARouter.HandleFunc("/debug/time", twoFAHandler.GetServerTime).Methods("GET")
+	twoFARouter.HandleFunc("/debug/generate", twoFAHandler.GenerateCurrentTOTP).Methods("POST")
+
+	// Admin-only session management endpoints
+	adminRouter := protectedRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.RequireRole(models.ROLE_ADMIN))
+	adminRouter.HandleFunc("/sessions/clear-all", sessionHandler.ClearAllSessions).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/2fa-reset", sessionHandler.IssueTwoFAReset).Methods("POST")
+	adminRouter.HandleFunc("/users/{id}/active", sessionHandler.SetUserActive).Methods("PUT")
+
+	// API keys for machine integrations, scoped to a few routes each
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	adminRouter.HandleFunc("/api-keys", apiKeyHandler.IssueKey).Methods("POST")
+	adminRouter.HandleFunc("/api-keys", apiKeyHandler.GetKeys).Methods("GET")
+	adminRouter.HandleFunc("/api-keys/scopes", apiKeyHandler.GetScopes).Methods("GET")
+	adminRouter.HandleFunc("/api-keys/{id}", apiKeyHandler.GetKey).Methods("GET")
+	adminRouter.HandleFunc("/api-keys/{id}/rotate", apiKeyHandler.RotateKey).Methods("POST")
+	adminRouter.HandleFunc("/api-keys/{id}/revoke", apiKeyHandler.RevokeKey).Methods("POST")
+
+	// Clinical event log and replay/projection
+	adminRouter.HandleFunc("/events", eventHandler.GetEvents).Methods("GET")
+	adminRouter.HandleFunc("/events/replay", eventHandler.Replay).Methods("POST")
+	adminRouter.HandleFunc("/events/{entityType}/{entityId}/projection", eventHandler.GetProjection).Methods("GET")
+
+	// Real-time bed occupancy
+	adminRouter.HandleFunc("/occupancy", admissionHandler.GetOccupancy).Methods("GET")
+	adminRouter.HandleFunc("/housekeeping/turnover", housekeepingHandler.GetTurnover).Methods("GET")
+
+	// Notification queue
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	adminRouter.HandleFunc("/notifications", notificationHandler.GetNotifications).Methods("GET")
+	adminRouter.HandleFunc("/notifications/{id}/retry", notificationHandler.Retry).Methods("POST")
+
+	// Webhooks, sent clinical events as they happen
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	adminRouter.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	adminRouter.HandleFunc("/webhooks", webhookHandler.GetWebhooks).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/event-types", webhookHandler.GetEventTypes).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/{id}", webhookHandler.GetWebhook).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PUT")
+	adminRouter.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	adminRouter.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.GetDeliveries).Methods("GET")
+	adminRouter.HandleFunc("/webhooks/{id}/deliveries/{deliveryId}/retry", webhookHandler.RetryDelivery).Methods("POST")
+	adminRouter.HandleFunc("/break-glass", breakGlassHandler.GetBreakGlassAccess).Methods("GET")
+
+	// Reports, run on demand as JSON or CSV, or emailed on a schedule
+	reportHandler := handlers.NewReportHandler(reportService, streamLimits)
+	adminRouter.HandleFunc("/reports", reportHandler.GetReports).Methods("GET")
+	adminRouter.HandleFunc("/reports/{name}", reportHandler.RunReport).Methods("GET")
+	adminRouter.HandleFunc("/report-schedules", reportHandler.CreateSchedule).Methods("POST")
+	adminRouter.HandleFunc("/report-schedules", reportHandler.GetSchedules).Methods("GET")
+	adminRouter.HandleFunc("/report-schedules/{id}", reportHandler.DeleteSchedule).Methods("DELETE")
+
+	// Patient flag types and which roles see them
+	adminRouter.HandleFunc("/flag-types/{code}", patientFlagHandler.SaveFlagType).Methods("PUT")
+
+	// Departments
+	adminRouter.HandleFunc("/departments/{code}", departmentHandler.SaveDepartment).Methods("PUT")
+
+	// Visit templates
+	adminRouter.HandleFunc("/record-templates/{code}", recordTemplateHandler.SaveTemplate).Methods("PUT")
+
+	// Dashboard statistics
+	adminStatsHandler := handlers.NewAdminStatsHandler(services.NewAdminStatsService(sessionStore.Count))
+	adminRouter.HandleFunc("/stats", adminStatsHandler.GetStats).Methods("GET")
+
+	// Database statements by duration and frequency; the slow ones are
+	// logged as they happen
+	queryStatsHandler := handlers.NewQueryStatsHandler(services.NewQueryStatsService())
+	adminRouter.HandleFunc("/db/queries", queryStatsHandler.GetStats).Methods("GET")
+
+	// Operational remediations (audited)
+	opsHandler := handlers.NewOpsHandler(opsService)
+	adminRouter.HandleFunc("/ops", opsHandler.ListActions).Methods("GET")
+	adminRouter.HandleFunc("/ops/{action}", opsHandler.RunAction).Methods("POST")
+
+	// Tamper-evidence check of the hash-chained audit log
+	auditHandler := handlers.NewAuditHandler(services.NewAuditService())
+	adminRouter.HandleFunc("/audit-logs/verify", auditHandler.VerifyChain).Methods("GET")
+
+	// Database backups
+	backupHandler := handlers.NewBackupHandler(backupService)
+	adminRouter.HandleFunc("/backups", backupHandler.CreateBackup).Methods("POST")
+	adminRouter.HandleFunc("/backups", backupHandler.GetBackups).Methods("GET")
+	adminRouter.HandleFunc("/backups/{name}/restore", backupHandler.RestoreBackup).Methods("POST")
+
+	// Bulk exports
+	adminRouter.HandleFunc("/exports", exportHandler.StartExport).Methods("POST")
+	adminRouter.HandleFunc("/exports", exportHandler.GetExports).Methods("GET")
+	adminRouter.HandleFunc("/exports/{id}", exportHandler.GetExport).Methods("GET")
+	adminRouter.HandleFunc("/exports/{id}", exportHandler.DeleteExport).Methods("DELETE")
+	adminRouter.HandleFunc("/exports/{id}/chunks/{index}", exportHandler.GetChunk).Methods("GET")
+
+	// Chaos endpoints (DEV_MODE only)
+	if chaos != nil {
+		chaosHandler := handlers.NewChaosHandler(chaos)
+		adminRouter.HandleFunc("/chaos", chaosHandler.ListRules).Methods("GET")
+		adminRouter.HandleFunc("/chaos", chaosHandler.AddRule).Methods("POST")
+		adminRouter.HandleFunc("/chaos", chaosHandler.ClearRules).Methods("DELETE")
+		adminRouter.HandleFunc("/chaos/{id}", chaosHandler.DeleteRule).Methods("DELETE")
+	}
+
+	// CORS configuration with proper headers for 2FA; the allowed origins
+	// and security headers come from the APP_ENV profile and its overrides
+	corsHandler := gorillaHandlers.CORS(
+		gorillaHandlers.AllowedOriginValidator(cfg.Security.OriginAllowed),
+		gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+		gorillaHandlers.AllowedHeaders([]string{
+			"Content-Type",
+			"Authorization",
+			"X-2FA-Session-ID",
+			"X-2FA-Code",
+			"X-New-2FA-Session-ID",
+			"X-Session-ID",
+			"Range",
+			"If-Range",
+			session.ModeHeader,
+			session.CSRFHeader,
+			middleware.ReadAfterHeader,
+			tracing.RequestIDHeader,
+			"traceparent",
+		}),
+		gorillaHandlers.ExposedHeaders([]string{
+			"X-New-2FA-Session-ID",
+			session.NewSessionHeader,
+			"Accept-Ranges",
+			"Content-Range",
+			"ETag",
+			"WWW-Authenticate",
+			middleware.ConsistencyTokenHeader,
+			tracing.RequestIDHeader,
+			handlers.TotalCountHeader,
+			"Deprecation",
+			"Sunset",
+			"Link",
+		}),
+		gorillaHandlers.AllowCredentials(),
+	)(metrics.Instrument(router))
+	a.handler = middleware.SecurityHeaders(cfg.Security)(corsHandler)
+	slog.Info("Security profile", "profile", cfg.Security.Profile, "corsOrigins", len(cfg.Security.AllowedOrigins))
+
+	a.router, a.spec = router, apiSpec
+	return a, nil
+}
+
+// start recovers the exports the last shutdown interrupted and runs the
+// background workers until ctx is done
+func (a *app) start(ctx context.Context) error {
+	if err := a.exportService.FailInterrupted(ctx); err != nil {
+		return fmt.Errorf("failed to recover exports: %w", err)
+	}
+	for _, worker := range a.workers {
+		go worker(ctx)
+	}
+	return nil
+}
+
+// background adds a worker for start to run
+func (a *app) background(worker func(ctx context.Context)) {
+	a.workers = append(a.workers, worker)
+}
+
+// newSessionStore keeps sessions in the configured Redis, so servers behind
+// a load balancer share logins, or in memory when there is none. A Redis
+// that can't be reached at startup falls back to memory, which keeps a
+// single server usable but logs users out when they reach another one. In
+// stateless mode no server keeps sessions: they are signed tokens.
+func newSessionStore(cfg *config.Config) (session.Store, error) {
+	if err := cfg.SessionLifetimes.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid session lifetimes: %w", err)
+	}
+
+	switch cfg.SessionMode {
+	case "stateful":
+	case "stateless":
+		if len(cfg.SessionTokenSecret) < session.MinTokenSecretLength {
+			return nil, fmt.Errorf("SESSION_MODE=stateless needs SESSION_TOKEN_SECRET of at least %d bytes, shared by every server", session.MinTokenSecretLength)
+		}
+		if cfg.MaxSessionsPerUser > 0 {
+			slog.Warn("MAX_SESSIONS_PER_USER is not enforced for stateless sessions")
+		}
+		if cfg.SessionRedis.URL != "" {
+			slog.Warn("SESSION_REDIS_URL is not used for stateless sessions")
+		}
+		if cfg.SessionLifetimes.IdleTimeout > 0 {
+			slog.Warn("SESSION_IDLE_TIMEOUT is not enforced for stateless sessions")
+		}
+		slog.Info("Sessions are stateless signed tokens")
+		return session.NewTokenStore([]byte(cfg.SessionTokenSecret), services.NewSessionRevocationService(), cfg.SessionLifetimes), nil
+	default:
+		return nil, fmt.Errorf("unknown SESSION_MODE %q: use stateful or stateless", cfg.SessionMode)
+	}
+
+	if cfg.SessionRedis.URL == "" {
+		return session.NewMemoryStore(cfg.MaxSessionsPerUser, cfg.SessionLifetimes), nil
+	}
+	store, err := session.NewRedisStore(cfg.SessionRedis, cfg.MaxSessionsPerUser, cfg.SessionLifetimes)
+	if err != nil {
+		slog.Error("Redis session store unavailable, keeping sessions in memory", "error", err)
+		return session.NewMemoryStore(cfg.MaxSessionsPerUser, cfg.SessionLifetimes), nil
+	}
+	slog.Info("Sessions are stored in Redis", "prefix", cfg.SessionRedis.KeyPrefix)
+	return store, nil
+}
@@ -202,6 +202,8 @@ export function UserManagement() {
                     <SelectItem value="doctor">Doctor</SelectItem>
                     <SelectItem value="nurse">Nurse</SelectItem>
                     <SelectItem value="pharmacist">Pharmacist</SelectItem>
+                    <SelectItem value="labtechnician">Lab Technician</SelectItem>
+                    <SelectItem value="housekeeping">Housekeeping</SelectItem>
                   </SelectContent>
                 </Select>
               </div>
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// oversized is longer than any field the API accepts
+var oversized = strings.Repeat("A", 1<<20)
+
+// missingID is a well-formed ID that should not exist, so body cases reach
+// validation without touching real rows
+const missingID = "999999"
+
+// fuzzCase is one request to send
+type fuzzCase struct {
+	Name  string
+	Path  string
+	Query url.Values
+	Body  []byte
+}
+
+// cases builds the malformed requests for an endpoint: bad path and query
+// parameters, unparseable bodies, wrong types and oversized strings
+func (s *spec) cases(e endpoint) []fuzzCase {
+	var cases []fuzzCase
+	validPath := fillPath(e.Path, missingID)
+	sch := s.bodySchema(e.Op)
+	validBody := []byte(nil)
+	if sch != nil {
+		validBody, _ = json.Marshal(s.sample(sch))
+	}
+
+	if strings.Contains(e.Path, "{") {
+		for _, value := range []string{"abc", "-1", "0", "1.5", "99999999999999999999", "%00", url.PathEscape(oversized[:4096])} {
+			cases = append(cases, fuzzCase{Name: "path param " + truncate(value), Path: fillPath(e.Path, value), Body: validBody})
+		}
+	}
+
+	for _, param := range e.Op.Parameters {
+		if param.In != "query" {
+			continue
+		}
+		for _, value := range []string{"abc", "-1", "99999999999999999999", "%00", oversized[:4096]} {
+			cases = append(cases, fuzzCase{
+				Name:  "query " + param.Name + "=" + truncate(value),
+				Path:  validPath,
+				Query: url.Values{param.Name: {value}},
+				Body:  validBody,
+			})
+		}
+	}
+
+	if sch == nil {
+		return cases
+	}
+
+	for name, body := range map[string]string{
+		"malformed JSON":         `{"`,
+		"empty body":             ``,
+		"null body":              `null`,
+		"array body":             `[]`,
+		"string body":            `"fuzz"`,
+		"empty object":           `{}`,
+		"trailing garbage":       string(validBody) + `}}`,
+		"deeply nested document": strings.Repeat(`{"a":`, 10000) + `1` + strings.Repeat(`}`, 10000),
+	} {
+		cases = append(cases, fuzzCase{Name: name, Path: validPath, Body: []byte(body)})
+	}
+
+	for _, field := range sortedKeys(sch.Properties) {
+		prop := s.resolve(sch.Properties[field])
+		for name, value := range wrongValues(prop) {
+			object, ok := s.sample(sch).(map[string]any)
+			if !ok {
+				break
+			}
+			object[field] = value
+			body, _ := json.Marshal(object)
+			cases = append(cases, fuzzCase{Name: field + ": " + name, Path: validPath, Body: body})
+		}
+	}
+
+	sort.SliceStable(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases
+}
+
+// wrongValues are values of the wrong type, or out of range, for a property
+func wrongValues(prop *schema) map[string]any {
+	values := map[string]any{"null": nil}
+	if prop == nil {
+		return values
+	}
+
+	switch prop.Type {
+	case "string":
+		values["number instead of string"] = 12345
+		values["object instead of string"] = map[string]any{"a": 1}
+		values["oversized string"] = oversized
+		values["control characters"] = "\x00\x1b[31m‮"
+		if prop.Format == "date" || prop.Format == "date-time" {
+			values["invalid date"] = "2026-13-45"
+		}
+	case "integer", "number":
+		values["string instead of number"] = "fuzz"
+		values["negative number"] = -1
+		values["huge number"] = 1e300
+		values["fraction"] = 1.5
+	case "boolean":
+		values["string instead of boolean"] = "fuzz"
+		values["number instead of boolean"] = 2
+	case "array":
+		values["object instead of array"] = map[string]any{"a": 1}
+		values["huge array"] = make([]int, 100000)
+	default:
+		values["string instead of object"] = "fuzz"
+		values["array instead of object"] = []any{1, 2}
+	}
+	return values
+}
+
+// sample builds a plausible value for a schema, used as the baseline that
+// individual fields are corrupted from
+func (s *spec) sample(sch *schema) any {
+	sch = s.resolve(sch)
+	if sch == nil {
+		return nil
+	}
+	if len(sch.Enum) > 0 {
+		return sch.Enum[0]
+	}
+
+	switch sch.Type {
+	case "string":
+		switch sch.Format {
+		case "date":
+			return "2026-01-15"
+		case "date-time":
+			return "2026-01-15T09:30:00Z"
+		}
+		return "fuzz"
+	case "integer", "number":
+		return 1
+	case "boolean":
+		return true
+	case "array":
+		return []any{s.sample(sch.Items)}
+	default:
+		object := map[string]any{}
+		for name, prop := range sch.Properties {
+			object[name] = s.sample(prop)
+		}
+		return object
+	}
+}
+
+// fillPath replaces every {param} in a path template with value
+func fillPath(template, value string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(template, "{")
+		end := strings.Index(template, "}")
+		if start < 0 || end < start {
+			b.WriteString(template)
+			return b.String()
+		}
+		b.WriteString(template[:start])
+		b.WriteString(value)
+		template = template[end+1:]
+	}
+}
+
+func sortedKeys(m map[string]*schema) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func truncate(value string) string {
+	if len(value) > 24 {
+		return value[:24] + "..."
+	}
+	return value
+}
@@ -0,0 +1,151 @@
+// Command apifuzz reads the server's OpenAPI spec and sends every endpoint
+// malformed payloads, oversized strings, wrong types and bad path and query
+// parameters. Every response must be a structured 4xx error: a 5xx, a dropped
+// connection (usually a handler panic) or a non-JSON error body is reported
+// and the command exits non-zero.
+//
+// Run it against a throwaway server backed by an in-memory database:
+//
+//	DB_PATH=:memory: go run . &
+//	go run ./cmd/apifuzz -spec https://localhost:8443/api/openapi.json
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// finding is a response that broke the error contract
+type finding struct {
+	Endpoint endpoint
+	Case     string
+	Problem  string
+}
+
+type fuzzer struct {
+	base     string
+	username string
+	password string
+	client   *http.Client
+}
+
+func main() {
+	base := flag.String("addr", "https://localhost:8443", "base URL of the server under test")
+	specLocation := flag.String("spec", "", "OpenAPI spec file or URL (default <addr>/api/openapi.json)")
+	username := flag.String("user", "admin", "user to authenticate as (basic auth)")
+	password := flag.String("password", os.Getenv("ADMIN_PASSWORD"), "password for -user (default $ADMIN_PASSWORD)")
+	// Chaos rules would sabotage the run, and the event stream never ends
+	skip := flag.String("skip", "^/api/(admin/chaos|events$)", "skip paths matching this regular expression")
+	insecure := flag.Bool("k", true, "accept the server's self-signed certificate")
+	flag.Parse()
+
+	if *specLocation == "" {
+		*specLocation = strings.TrimSuffix(*base, "/") + "/api/openapi.json"
+	}
+	skipPattern, err := regexp.Compile(*skip)
+	if err != nil {
+		log.Fatal("Invalid -skip pattern:", err)
+	}
+
+	s, err := loadSpec(*specLocation, *insecure)
+	if err != nil {
+		log.Fatal("Failed to load spec:", err)
+	}
+
+	f := &fuzzer{
+		base:     strings.TrimSuffix(*base, "/"),
+		username: *username,
+		password: *password,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure}},
+		},
+	}
+
+	var findings []finding
+	sent := 0
+	for _, e := range s.endpoints() {
+		if *skip != "" && skipPattern.MatchString(e.Path) {
+			continue
+		}
+		for _, c := range s.cases(e) {
+			sent++
+			if problem := f.send(e, c); problem != "" {
+				findings = append(findings, finding{Endpoint: e, Case: c.Name, Problem: problem})
+			}
+		}
+	}
+
+	for _, fd := range findings {
+		fmt.Printf("FAIL %s %s [%s]: %s\n", fd.Endpoint.Method, fd.Endpoint.Path, fd.Case, fd.Problem)
+	}
+	fmt.Printf("%d requests, %d findings\n", sent, len(findings))
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// send issues one case and returns what was wrong with the response, or ""
+func (f *fuzzer) send(e endpoint, c fuzzCase) string {
+	target := f.base + c.Path
+	if len(c.Query) > 0 {
+		target += "?" + c.Query.Encode()
+	}
+
+	var body io.Reader
+	if c.Body != nil {
+		body = bytes.NewReader(c.Body)
+	}
+	req, err := http.NewRequest(e.Method, target, body)
+	if err != nil {
+		// Some malformed paths can't even be expressed as a request
+		return ""
+	}
+	if !e.Op.public() {
+		req.SetBasicAuth(f.username, f.password)
+	}
+	if c.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "no response (handler panic?): " + err.Error()
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Sprintf("status %d: %s", resp.StatusCode, snippet(data))
+	case resp.StatusCode >= 400:
+		var envelope struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &envelope); err != nil || envelope.Error.Code == "" || envelope.Error.Message == "" {
+			return fmt.Sprintf("status %d without a structured error body: %s", resp.StatusCode, snippet(data))
+		}
+	}
+	return ""
+}
+
+func snippet(data []byte) string {
+	text := strings.TrimSpace(string(data))
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return text
+}
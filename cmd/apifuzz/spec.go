@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The subset of OpenAPI 3 the fuzzer needs to build requests
+
+type spec struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []parameter  `json:"parameters"`
+	RequestBody *requestBody `json:"requestBody"`
+	// Security is an empty list on public operations
+	Security *[]any `json:"security"`
+}
+
+// public reports whether the operation is documented as needing no credentials
+func (op *operation) public() bool {
+	return op.Security != nil && len(*op.Security) == 0
+}
+
+type parameter struct {
+	Name   string  `json:"name"`
+	In     string  `json:"in"`
+	Schema *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Format     string             `json:"format"`
+	Enum       []any              `json:"enum"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	MaxLength  *int               `json:"maxLength"`
+}
+
+// endpoint is one method on one path template
+type endpoint struct {
+	Method string
+	Path   string
+	Op     *operation
+}
+
+// loadSpec reads the spec from a file or, for http(s) locations, from the server
+func loadSpec(location string, insecure bool) (*spec, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}}}
+		resp, err := client.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", location, resp.Status)
+		}
+		data, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data, err = os.ReadFile(location)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+	return &s, nil
+}
+
+// endpoints lists every operation in a stable order
+func (s *spec) endpoints() []endpoint {
+	var endpoints []endpoint
+	for path, methods := range s.Paths {
+		for method, op := range methods {
+			endpoints = append(endpoints, endpoint{Method: strings.ToUpper(method), Path: path, Op: op})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
+
+// resolve follows a local "#/components/schemas/Name" reference
+func (s *spec) resolve(sch *schema) *schema {
+	for depth := 0; sch != nil && sch.Ref != "" && depth < 10; depth++ {
+		sch = s.Components.Schemas[strings.TrimPrefix(sch.Ref, "#/components/schemas/")]
+	}
+	return sch
+}
+
+// bodySchema returns the JSON request body schema, if the operation takes one
+func (s *spec) bodySchema(op *operation) *schema {
+	if op.RequestBody == nil {
+		return nil
+	}
+	content, ok := op.RequestBody.Content["application/json"]
+	if !ok {
+		return nil
+	}
+	return s.resolve(content.Schema)
+}
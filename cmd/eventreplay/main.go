@@ -0,0 +1,53 @@
+// Command eventreplay rebuilds entity projections from the ClinicalEvents log
+// and prints them as JSON, e.g.
+//
+//	go run ./cmd/eventreplay -type patient
+//	go run ./cmd/eventreplay -type prescription -id 12
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+func main() {
+	entityType := flag.String("type", "", "entity type to replay (patient, medical_record, prescription)")
+	entityID := flag.Int("id", 0, "replay a single entity instead of the whole type")
+	flag.Parse()
+
+	if *entityType == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := database.InitDB(); err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+	defer database.GetDB().Close()
+
+	ctx := context.Background()
+	eventService := services.NewEventService()
+
+	var (
+		result any
+		err    error
+	)
+	if *entityID != 0 {
+		result, err = eventService.Project(ctx, *entityType, *entityID)
+	} else {
+		result, err = eventService.Replay(ctx, *entityType)
+	}
+	if err != nil {
+		log.Fatal("Replay failed:", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
@@ -0,0 +1,146 @@
+// Command hospitalctl performs operational tasks for when the web UI can't:
+// creating accounts, resetting passwords and 2FA, running migrations,
+// exporting patients and signing everyone out. It works on the database
+// directly, configured by the same environment as the server (DB_PATH or
+// DATABASE_URL, ENCRYPTION_KEYS, SESSION_MODE, ...), so it runs whether or
+// not the server is up, e.g.
+//
+//	hospitalctl migrate
+//	hospitalctl users create jdoe --role doctor --name "Jane Doe"
+//	hospitalctl users reset-password jdoe
+//	hospitalctl users disable-2fa jdoe
+//	hospitalctl patients export --out patients.ndjson
+//	hospitalctl sessions clear
+//
+// Opening the database applies any pending migrations, as the server does.
+// Every change is audit-logged as a system action naming the operator.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/config"
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// app is the state shared by the commands: the server configuration, with
+// the database opened on first use
+type app struct {
+	cfg    *config.Config
+	dbPath string
+	opened bool
+}
+
+func newRootCommand() *cobra.Command {
+	a := &app{}
+	root := &cobra.Command{
+		Use:          "hospitalctl",
+		Short:        "Operational tasks for the hospital server",
+		SilenceUsage: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			a.cfg = config.Load()
+			if a.dbPath != "" {
+				a.cfg.Database.Path = a.dbPath
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if a.opened {
+				database.GetDB().Close()
+			}
+		},
+	}
+	root.PersistentFlags().StringVar(&a.dbPath, "db", "", "SQLite database path, overriding DB_PATH")
+
+	root.AddCommand(a.migrateCommand(), a.usersCommand(), a.patientsCommand(), a.sessionsCommand())
+	return root
+}
+
+// openDatabase opens the database as the server would, with the facility
+// timezone and encryption keys set up so values read back decrypted
+func (a *app) openDatabase() error {
+	if a.opened {
+		return nil
+	}
+
+	time.Local = time.UTC
+	facilityZone, err := time.LoadLocation(a.cfg.FacilityTimezone)
+	if err != nil {
+		return fmt.Errorf("invalid HOSPITAL_TIMEZONE: %v", err)
+	}
+	timezone.Init(facilityZone)
+
+	if len(a.cfg.EncryptionKeys) > 0 {
+		keyID := a.cfg.EncryptionKeyID
+		if keyID == "" && len(a.cfg.EncryptionKeys) == 1 {
+			for id := range a.cfg.EncryptionKeys {
+				keyID = id
+			}
+		}
+		keyring, err := encryption.NewKeyring(keyID, a.cfg.EncryptionKeys)
+		if err != nil {
+			return fmt.Errorf("invalid encryption keys: %v", err)
+		}
+		encryption.Init(keyring)
+	}
+
+	if err := database.Open(a.cfg.Database); err != nil {
+		return fmt.Errorf("opening the database: %v", err)
+	}
+	a.opened = true
+	return nil
+}
+
+// audit logs an action taken with hospitalctl. There is no user to
+// attribute it to, so it is logged as a system action naming the operator's
+// OS account.
+func (a *app) audit(ctx context.Context, action, entityType string, entityID int, details map[string]any) error {
+	if details == nil {
+		details = map[string]any{}
+	}
+	details["source"] = "hospitalctl"
+	details["operator"] = operator()
+	return services.NewAuditService().Log(ctx, database.GetDB(), 0, action, entityType, entityID, details)
+}
+
+func operator() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+func (a *app) migrateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Bring the database schema up to date",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := a.openDatabase(); err != nil {
+				return err
+			}
+			version, err := database.SchemaVersion(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Schema is at version %d (%s)\n", version, database.CurrentDialect().Name())
+			if latest := database.LatestSchemaVersion(); version > latest {
+				fmt.Fprintf(cmd.ErrOrStderr(), "The database has migrations newer than this build, which stops at %d\n", latest)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/spf13/cobra"
+)
+
+func (a *app) patientsCommand() *cobra.Command {
+	patients := &cobra.Command{
+		Use:   "patients",
+		Short: "Work with patient records",
+	}
+	patients.AddCommand(a.exportPatientsCommand())
+	return patients
+}
+
+func (a *app) exportPatientsCommand() *cobra.Command {
+	var out string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export every patient as NDJSON",
+		Long: "Write every patient's registration details, decrypted, one JSON object per line, " +
+			"to --out or stdout. The file holds identifiable patient data; store it accordingly.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := a.openDatabase(); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			var w io.Writer = cmd.OutOrStdout()
+			if out != "" {
+				file, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				w = file
+			}
+			encoder := json.NewEncoder(w)
+			exported := 0
+			err := services.NewPatientService(services.NewSQLitePatientRepo()).EachPatient(ctx, func(patient models.Patient) error {
+				exported++
+				return encoder.Encode(patient)
+			})
+			if err != nil {
+				return err
+			}
+
+			details := map[string]any{"patients": exported, "out": out}
+			if err := a.audit(ctx, models.AUDIT_PATIENTS_EXPORTED, models.ENTITY_PATIENT, 0, details); err != nil {
+				return err
+			}
+			if out != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d patients to %s\n", exported, out)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&out, "out", "o", "", "write to this new file, readable only by its owner, instead of stdout")
+	return cmd
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/apiclient"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+	"github.com/spf13/cobra"
+)
+
+func (a *app) sessionsCommand() *cobra.Command {
+	sessions := &cobra.Command{
+		Use:   "sessions",
+		Short: "Manage login sessions",
+	}
+	sessions.AddCommand(a.clearSessionsCommand())
+	return sessions
+}
+
+func (a *app) clearSessionsCommand() *cobra.Command {
+	var server, username, code string
+	var insecure bool
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Sign every user out",
+		Long: "End every session. Stateless session tokens are revoked in the database and sessions in " +
+			"SESSION_REDIS_URL are deleted there. Sessions kept in a server's memory can only be ended by that " +
+			"server: pass --server and --username to have an admin clear them over the API, with the password " +
+			"and, unless --code is given, the 2FA code read from stdin.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if server != "" {
+				return clearSessionsViaAPI(cmd, server, username, code, insecure)
+			}
+
+			ctx := cmd.Context()
+			switch {
+			case a.cfg.SessionMode == "stateless":
+				if err := a.openDatabase(); err != nil {
+					return err
+				}
+				if err := services.NewSessionRevocationService().RevokeAll(ctx); err != nil {
+					return err
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "Revoked every session token")
+			case a.cfg.SessionRedis.URL != "":
+				store, err := session.NewRedisStore(a.cfg.SessionRedis, 0, a.cfg.SessionLifetimes)
+				if err != nil {
+					return fmt.Errorf("SESSION_REDIS_URL: %v", err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Cleared %d sessions\n", store.Clear())
+				if err := a.openDatabase(); err != nil {
+					return err
+				}
+			default:
+				return errors.New("sessions are kept in the server's memory; clear them over the API with --server")
+			}
+			return a.audit(ctx, models.AUDIT_SESSIONS_CLEARED, models.ENTITY_USER, 0, map[string]any{"mode": a.cfg.SessionMode})
+		},
+	}
+	cmd.Flags().StringVar(&server, "server", "", "clear the sessions over the API of the server at this URL, e.g. https://localhost:8443")
+	cmd.Flags().StringVar(&username, "username", "", "with --server, the admin to log in as")
+	cmd.Flags().StringVar(&code, "code", "", "with --server, the admin's TOTP or backup code")
+	cmd.Flags().BoolVar(&insecure, "insecure", false, "with --server, skip TLS certificate verification, e.g. for a self-signed certificate")
+	return cmd
+}
+
+// clearSessionsViaAPI logs in as an admin and has the server clear its
+// sessions, which it reports like any admin's
+func clearSessionsViaAPI(cmd *cobra.Command, server, username, code string, insecure bool) error {
+	if username == "" {
+		return errors.New("--server needs --username, an admin account")
+	}
+	stdin := bufio.NewReader(cmd.InOrStdin())
+	password, err := prompt(cmd, stdin, "Password: ")
+	if err != nil {
+		return err
+	}
+
+	httpClient := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}},
+	}
+	client := apiclient.New(server, apiclient.WithHTTPClient(httpClient))
+	ctx := cmd.Context()
+	err = client.LoginWithCode(ctx, username, password, func() (string, error) {
+		if code != "" {
+			return code, nil
+		}
+		return prompt(cmd, stdin, "2FA code: ")
+	})
+	if err != nil {
+		return fmt.Errorf("logging in: %w", err)
+	}
+
+	// The admin's own session goes with the rest, so it is only logged out
+	// when clearing fails
+	var cleared struct {
+		ClearedSessions int `json:"clearedSessions"`
+	}
+	if _, err := client.Do(ctx, http.MethodPost, "/api/admin/sessions/clear-all", nil, nil, &cleared); err != nil {
+		client.Logout(ctx)
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Cleared %d sessions\n", cleared.ClearedSessions)
+	return nil
+}
+
+// prompt asks on stderr for a line of stdin
+func prompt(cmd *cobra.Command, stdin *bufio.Reader, label string) (string, error) {
+	fmt.Fprint(cmd.ErrOrStderr(), label)
+	line, err := stdin.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("no %s given", strings.ToLower(strings.TrimSuffix(label, ": ")))
+	}
+	return line, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/spf13/cobra"
+)
+
+func (a *app) usersCommand() *cobra.Command {
+	users := &cobra.Command{
+		Use:   "users",
+		Short: "Create accounts and recover locked-out ones",
+	}
+	users.AddCommand(a.createUserCommand(), a.resetPasswordCommand(), a.disableTwoFACommand())
+	return users
+}
+
+func (a *app) createUserCommand() *cobra.Command {
+	var role, fullName string
+	var patientID int
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "create USERNAME",
+		Short: "Create an account",
+		Long: "Create an account with a random password, printed once, or one read from stdin with --password-stdin. " +
+			"The user enrolls a second factor on their first login.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			canonical, ok := models.CanonicalRole(role)
+			if !ok {
+				return fmt.Errorf("--role must be one of %s", strings.Join(models.Roles(), ", "))
+			}
+			if canonical == models.ROLE_PATIENT && patientID == 0 {
+				return errors.New("a Patient account needs --patient-id, the patient it belongs to")
+			}
+			password, generated, err := newPassword(cmd.InOrStdin(), passwordStdin)
+			if err != nil {
+				return err
+			}
+			if err := a.openDatabase(); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			user := models.User{Username: args[0], Role: canonical, FullName: fullName}
+			if patientID != 0 {
+				if _, err := services.NewPatientService(services.NewSQLitePatientRepo()).GetPatient(ctx, patientID); err != nil {
+					return fmt.Errorf("patient %d: %w", patientID, notFound(err))
+				}
+				user.PatientID = &patientID
+			}
+			users := newUserService()
+			if _, err := users.GetUserByUsername(ctx, user.Username); err == nil {
+				return fmt.Errorf("a user named %q already exists", user.Username)
+			}
+			if err := users.CreateUserWithPassword(ctx, &user, password); err != nil {
+				return err
+			}
+			if err := a.audit(ctx, models.AUDIT_USER_CREATED, models.ENTITY_USER, user.UserID, map[string]any{"role": user.Role}); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %s user %q (id %d)\n", user.Role, user.Username, user.UserID)
+			if generated {
+				fmt.Fprintf(cmd.OutOrStdout(), "Password: %s\n", password)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&role, "role", "", "the account's role, e.g. doctor (required)")
+	cmd.Flags().StringVar(&fullName, "name", "", "the user's full name")
+	cmd.Flags().IntVar(&patientID, "patient-id", 0, "for a Patient account, the patient it belongs to")
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "read the password from the first line of stdin")
+	cmd.MarkFlagRequired("role")
+	return cmd
+}
+
+func (a *app) resetPasswordCommand() *cobra.Command {
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "reset-password USERNAME",
+		Short: "Set a new password for an account",
+		Long: "Set a random password, printed once, or one read from stdin with --password-stdin. " +
+			"Sessions the user already has stay open.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, generated, err := newPassword(cmd.InOrStdin(), passwordStdin)
+			if err != nil {
+				return err
+			}
+			if err := a.openDatabase(); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			users := newUserService()
+			user, err := lookupUser(ctx, users, args[0])
+			if err != nil {
+				return err
+			}
+			if err := users.ResetPassword(ctx, user.UserID, password); err != nil {
+				return err
+			}
+			if err := a.audit(ctx, models.AUDIT_USER_PASSWORD_RESET, models.ENTITY_USER, user.UserID, nil); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Password of %q reset\n", user.Username)
+			if generated {
+				fmt.Fprintf(cmd.OutOrStdout(), "Password: %s\n", password)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "read the password from the first line of stdin")
+	return cmd
+}
+
+func (a *app) disableTwoFACommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable-2fa USERNAME",
+		Short: "Turn off an account's authenticator app",
+		Long: "Clear an account's TOTP secret and backup codes, as redeeming a 2FA reset token does, " +
+			"so the user enrolls a new authenticator on their next login. Security keys stay registered.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := a.openDatabase(); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			users := newUserService()
+			user, err := lookupUser(ctx, users, args[0])
+			if err != nil {
+				return err
+			}
+			if !user.TwoFAEnabled {
+				fmt.Fprintf(cmd.OutOrStdout(), "%q has no authenticator app enrolled\n", user.Username)
+				return nil
+			}
+			if err := users.GetTwoFAService().DisableTwoFA(ctx, user.UserID); err != nil {
+				return err
+			}
+			if err := a.audit(ctx, models.AUDIT_TWOFA_RESET, models.ENTITY_USER, user.UserID, nil); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "2FA disabled for %q\n", user.Username)
+			return nil
+		},
+	}
+}
+
+func newUserService() *services.UserService {
+	return services.NewUserService(services.NewSQLiteUserRepo())
+}
+
+func lookupUser(ctx context.Context, users *services.UserService, username string) (*models.User, error) {
+	user, err := users.GetUserByUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", username, notFound(err))
+	}
+	return user, nil
+}
+
+// notFound words a missing row for the operator
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("not found")
+	}
+	return err
+}
+
+// newPassword reads a password from the first line of stdin, or generates a
+// random one, reporting which
+func newPassword(stdin io.Reader, fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		return rand.Text(), true, nil
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if len(password) < services.MinPasswordLength {
+		return "", false, fmt.Errorf("the password must be at least %d characters", services.MinPasswordLength)
+	}
+	return password, false, nil
+}
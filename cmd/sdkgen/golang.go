@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// goGenerator writes a Go client package with a struct per schema and a
+// method per operation
+type goGenerator struct {
+	spec *spec
+	b    strings.Builder
+}
+
+func generateGo(s *spec, pkg string) ([]byte, error) {
+	g := &goGenerator{spec: s}
+	g.printf("// Code generated by sdkgen from %s %s; DO NOT EDIT.\n\n", s.Info.Title, s.Info.Version)
+	g.printf("// Package %s is a typed client for the %s.\n", pkg, s.Info.Title)
+	g.printf("package %s\n\n", pkg)
+	g.printf("import (\n\"bytes\"\n\"context\"\n\"encoding/json\"\n\"fmt\"\n\"io\"\n\"net/http\"\n\"net/url\"\n\"strings\"\n\"time\"\n)\n\n")
+	g.printf("// time is only needed by some schemas\nvar _ time.Time\n\n")
+	g.printf("%s", goRuntime)
+
+	for _, name := range sortedKeys(s.Components.Schemas) {
+		sch := s.Components.Schemas[name]
+		g.printf("type %s %s\n\n", goTypeName(name), g.typeOf(sch, true))
+	}
+
+	g.printf("// OperationRoles lists the roles allowed to call each operation, by\n")
+	g.printf("// operation ID. Operations not listed are open to any authenticated user.\n")
+	g.printf("var OperationRoles = map[string][]string{\n")
+	for _, e := range s.endpoints() {
+		if len(e.Op.Roles) > 0 {
+			g.printf("%q: {%s},\n", e.Op.OperationID, quoteAll(e.Op.Roles))
+		}
+	}
+	g.printf("}\n\n")
+
+	for _, e := range s.endpoints() {
+		g.operation(e)
+	}
+
+	source, err := format.Source([]byte(g.b.String()))
+	if err != nil {
+		return []byte(g.b.String()), fmt.Errorf("format generated Go: %w", err)
+	}
+	return source, nil
+}
+
+func (g *goGenerator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.b, format, args...)
+}
+
+// typeOf returns the Go type for a schema; required fields and named types
+// aren't pointers
+func (g *goGenerator) typeOf(sch *schema, required bool) string {
+	if sch == nil {
+		return "json.RawMessage"
+	}
+	if sch.Ref != "" {
+		return pointerIf(sch.Nullable, goTypeName(sch.refName()))
+	}
+
+	var t string
+	switch sch.Type {
+	case "string":
+		switch sch.Format {
+		case "date-time":
+			t = "time.Time"
+		case "binary", "byte":
+			return "[]byte"
+		default:
+			t = "string"
+		}
+	case "integer":
+		t = "int"
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	case "array":
+		return "[]" + g.typeOf(sch.Items, true)
+	case "object":
+		if len(sch.Properties) == 0 {
+			return "map[string]" + g.typeOf(sch.AdditionalProperties, true)
+		}
+		return g.structOf(sch)
+	default:
+		return "json.RawMessage"
+	}
+	return pointerIf(sch.Nullable || !required && t == "time.Time", t)
+}
+
+func (g *goGenerator) structOf(sch *schema) string {
+	var b strings.Builder
+	b.WriteString("struct {\n")
+	for _, name := range sortedKeys(sch.Properties) {
+		required := contains(sch.Required, name)
+		tag := name
+		if !required {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s %s `json:%q`\n", pascal(name), g.typeOf(sch.Properties[name], required), tag)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (g *goGenerator) operation(e endpoint) {
+	name := pascal(e.Op.OperationID)
+	pathParams, queryParams := e.pathParams(), e.queryParams()
+	contentType, body := e.body()
+	status, result := e.result()
+
+	if len(queryParams) > 0 {
+		g.printf("// %sQuery holds the query parameters of %s\n", name, name)
+		g.printf("type %sQuery struct {\n", name)
+		for _, p := range queryParams {
+			if p.Description != "" {
+				g.printf("%s", comment("//", p.Description))
+			}
+			g.printf("%s %s\n", pascal(p.Name), pointerIf(true, g.typeOf(p.Schema, true)))
+		}
+		g.printf("}\n\n")
+		g.printf("func (q *%sQuery) values() url.Values {\nvalues := url.Values{}\nif q == nil {\nreturn values\n}\n", name)
+		for _, p := range queryParams {
+			field := pascal(p.Name)
+			g.printf("if q.%s != nil {\nvalues.Set(%q, fmt.Sprint(*q.%s))\n}\n", field, p.Name, field)
+		}
+		g.printf("return values\n}\n\n")
+	}
+
+	if e.Op.Summary != "" {
+		g.printf("// %s: %s (%s %s).\n", name, e.Op.Summary, e.Method, e.Path)
+	} else {
+		g.printf("// %s calls %s %s.\n", name, e.Method, e.Path)
+	}
+	if e.Op.Description != "" {
+		g.printf("//\n%s", comment("//", e.Op.Description))
+	}
+	g.printf("//\n// Roles: %s\n", e.roles())
+
+	args := []string{"ctx context.Context"}
+	names := map[string]string{}
+	for _, p := range pathParams {
+		arg := goIdent(camel(p.Name))
+		names[p.Name] = arg
+		args = append(args, arg+" "+g.typeOf(p.Schema, true))
+	}
+	jsonBody := contentType == "application/json"
+	switch {
+	case body != nil && jsonBody && body.Ref != "":
+		args = append(args, "body *"+goTypeName(body.refName()))
+	case body != nil && jsonBody:
+		args = append(args, "body "+g.typeOf(body, true))
+	case body != nil:
+		args = append(args, "body io.Reader", "contentType string")
+	}
+	if len(queryParams) > 0 {
+		args = append(args, "query *"+name+"Query")
+	}
+
+	returns, failed := "error", "err"
+	switch {
+	case result != nil && result.Ref != "":
+		returns, failed = "(*"+goTypeName(result.refName())+", error)", "nil, err"
+	case result != nil:
+		returns, failed = "("+g.typeOf(result, true)+", error)", "out, err"
+	case status != http.StatusNoContent:
+		returns, failed = "([]byte, error)", "nil, err"
+	}
+	g.printf("func (c *Client) %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	path := strconv.Quote(e.Path)
+	path = pathParamPattern.ReplaceAllStringFunc(path, func(match string) string {
+		return `" + url.PathEscape(fmt.Sprint(` + names[strings.Trim(match, "{}")] + `)) + "`
+	})
+	path = strings.TrimSuffix(strings.TrimPrefix(path, `"" + `), ` + ""`)
+	g.printf("path := %s\n", path)
+
+	switch {
+	case result != nil && result.Ref != "":
+		g.printf("var out %s\n", goTypeName(result.refName()))
+	case result != nil:
+		g.printf("var out %s\n", g.typeOf(result, true))
+	case status != http.StatusNoContent:
+		g.printf("var out []byte\n")
+	}
+
+	query := "nil"
+	if len(queryParams) > 0 {
+		query = "query.values()"
+	}
+	reader := "nil, \"\""
+	switch {
+	case body != nil && jsonBody:
+		g.printf("encoded, err := json.Marshal(body)\nif err != nil {\nreturn %s\n}\n", failed)
+		reader = "bytes.NewReader(encoded), \"application/json\""
+	case body != nil:
+		reader = "body, contentType"
+	}
+
+	call := fmt.Sprintf("c.do(ctx, %q, path, %s, %s, &out)", e.Method, query, reader)
+	switch {
+	case result != nil && result.Ref != "":
+		g.printf("if err := %s; err != nil {\nreturn nil, err\n}\nreturn &out, nil\n}\n\n", call)
+	case result != nil, status != http.StatusNoContent:
+		assign := ":="
+		if body != nil && jsonBody {
+			assign = "="
+		}
+		g.printf("err %s %s\nreturn out, err\n}\n\n", assign, call)
+	default:
+		g.printf("return %s\n}\n\n", strings.Replace(call, "&out", "nil", 1))
+	}
+}
+
+// goTypeName names a schema's type, steering clear of the runtime's identifiers
+func goTypeName(name string) string {
+	name = pascal(name)
+	switch name {
+	case "Client", "New", "WithBasicAuth", "WithSession", "APIError", "OperationRoles":
+		return name + "Schema"
+	}
+	return name
+}
+
+func pointerIf(condition bool, t string) string {
+	if condition && !strings.HasPrefix(t, "*") && !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") {
+		return "*" + t
+	}
+	return t
+}
+
+// goIdent avoids parameter names that clash with keywords or the generated locals
+func goIdent(name string) string {
+	switch {
+	case token.IsKeyword(name), name == "ctx", name == "path", name == "body", name == "query", name == "out", name == "err",
+		name == "encoded", name == "c", name == "contentType":
+		return name + "Param"
+	}
+	return name
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// goRuntime is the hand-written part of the Go client: the Client, its
+// authentication helpers, request plumbing and error type
+const goRuntime = `// Client calls the API. Set Authorize to add credentials to each request,
+// e.g. WithBasicAuth or WithSession.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Authorize  func(*http.Request)
+}
+
+// New returns a client for the server at baseURL, e.g. "https://localhost:8443"
+func New(baseURL string, authorize func(*http.Request)) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient, Authorize: authorize}
+}
+
+// WithBasicAuth authenticates with a username and password, for users without
+// a second factor and for scripts
+func WithBasicAuth(username, password string) func(*http.Request) {
+	return func(r *http.Request) { r.SetBasicAuth(username, password) }
+}
+
+// WithSession authenticates with a session ID returned by logging in
+func WithSession(sessionID string) func(*http.Request) {
+	return func(r *http.Request) { r.Header.Set("X-Session-ID", sessionID) }
+}
+
+// APIError is a non-2xx response in the API's error envelope
+type APIError struct {
+	StatusCode int
+	Code       string          ` + "`json:\"code\"`" + `
+	Message    string          ` + "`json:\"message\"`" + `
+	Details    json.RawMessage ` + "`json:\"details,omitempty\"`" + `
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// do sends the request and decodes a JSON response into out; a *[]byte out
+// receives the raw body
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, out any) error {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Authorize != nil {
+		c.Authorize(req)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Code: "http_error", Message: resp.Status}
+		var envelope struct {
+			Error *APIError ` + "`json:\"error\"`" + `
+		}
+		if json.Unmarshal(data, &envelope) == nil && envelope.Error != nil {
+			envelope.Error.StatusCode = resp.StatusCode
+			apiErr = envelope.Error
+		}
+		return apiErr
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*out = data
+		return nil
+	default:
+		return json.Unmarshal(data, out)
+	}
+}
+
+`
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The subset of OpenAPI 3 the generators need
+
+type spec struct {
+	Info struct {
+		Title   string `json:"title"`
+		Version string `json:"version"`
+	} `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Description string               `json:"description"`
+	Parameters  []parameter          `json:"parameters"`
+	RequestBody *content             `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+	// Security is an empty list on public operations
+	Security *[]any `json:"security"`
+	// Roles lists the roles allowed to call the operation; absent means any
+	// authenticated user
+	Roles []string `json:"x-roles"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type content struct {
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type response struct {
+	content
+	Description string `json:"description"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	AdditionalProperties *schema            `json:"additionalProperties"`
+}
+
+// refName returns the component name a schema refers to, or ""
+func (s *schema) refName() string {
+	return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+}
+
+// endpoint is one method on one path template
+type endpoint struct {
+	Method string
+	Path   string
+	Op     *operation
+}
+
+func (e endpoint) public() bool {
+	return e.Op.Security != nil && len(*e.Op.Security) == 0
+}
+
+// pathParams lists the path parameters in the order they appear in the path
+func (e endpoint) pathParams() []parameter {
+	var params []parameter
+	for _, p := range e.Op.Parameters {
+		if p.In == "path" {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+func (e endpoint) queryParams() []parameter {
+	var params []parameter
+	for _, p := range e.Op.Parameters {
+		if p.In == "query" {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// body returns the request content type and schema, if the operation takes a body
+func (e endpoint) body() (string, *schema) {
+	if e.Op.RequestBody == nil {
+		return "", nil
+	}
+	for _, contentType := range sortedKeys(e.Op.RequestBody.Content) {
+		return contentType, e.Op.RequestBody.Content[contentType].Schema
+	}
+	return "", nil
+}
+
+// result returns the success status and its JSON schema, nil when the
+// response isn't JSON or has no body
+func (e endpoint) result() (int, *schema) {
+	for _, status := range sortedKeys(e.Op.Responses) {
+		var code int
+		if _, err := fmt.Sscan(status, &code); err != nil || code >= 300 {
+			continue
+		}
+		if c, ok := e.Op.Responses[status].Content["application/json"]; ok {
+			return code, c.Schema
+		}
+		return code, nil
+	}
+	return http.StatusOK, nil
+}
+
+// roles describes who may call the operation, for doc comments
+func (e endpoint) roles() string {
+	switch {
+	case e.public():
+		return "public"
+	case len(e.Op.Roles) > 0:
+		return strings.Join(e.Op.Roles, ", ")
+	default:
+		return "any authenticated user"
+	}
+}
+
+// loadSpec reads the spec from a file or, for http(s) locations, from the server
+func loadSpec(location string, client *http.Client) (*spec, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		resp, err := client.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: %s", location, resp.Status)
+		}
+		data, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data, err = os.ReadFile(location)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse spec: %w", err)
+	}
+	return &s, nil
+}
+
+// endpoints lists every operation in a stable order
+func (s *spec) endpoints() []endpoint {
+	var endpoints []endpoint
+	for path, methods := range s.Paths {
+		for method, op := range methods {
+			endpoints = append(endpoints, endpoint{Method: strings.ToUpper(method), Path: path, Op: op})
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+	return endpoints
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// words splits an identifier such as "patient_id", "x-roles" or "patientId"
+// at separators; camel case is left to the caller
+func words(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+// pascal turns an identifier into PascalCase, e.g. "doctor_id" -> "DoctorId"
+func pascal(name string) string {
+	var b strings.Builder
+	for _, word := range words(name) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	result := b.String()
+	if result == "" || unicode.IsDigit(rune(result[0])) {
+		result = "X" + result
+	}
+	return result
+}
+
+// camel turns an identifier into camelCase, e.g. "patient_id" -> "patientId"
+func camel(name string) string {
+	result := pascal(name)
+	return strings.ToLower(result[:1]) + result[1:]
+}
+
+// comment wraps text as line comments with the given prefix
+func comment(prefix, text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		b.WriteString(strings.TrimRight(prefix+" "+line, " ") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// tsGenerator writes a TypeScript module with an interface per schema and a
+// client method per operation, for the SPA and integration scripts
+type tsGenerator struct {
+	spec *spec
+	b    strings.Builder
+}
+
+func generateTypeScript(s *spec) []byte {
+	g := &tsGenerator{spec: s}
+	g.printf("// Code generated by sdkgen from %s %s; DO NOT EDIT.\n\n", s.Info.Title, s.Info.Version)
+
+	for _, name := range sortedKeys(s.Components.Schemas) {
+		sch := s.Components.Schemas[name]
+		if sch.Type == "object" && len(sch.Properties) > 0 {
+			g.printf("export interface %s %s\n\n", tsTypeName(name), g.typeOf(sch, 0))
+		} else {
+			g.printf("export type %s = %s;\n\n", tsTypeName(name), g.typeOf(sch, 0))
+		}
+	}
+
+	g.printf("/** The roles allowed to call each operation, by operation ID. Operations not listed are open to any authenticated user. */\n")
+	g.printf("export const operationRoles: Record<string, string[]> = {\n")
+	for _, e := range s.endpoints() {
+		if len(e.Op.Roles) > 0 {
+			g.printf("  %s: [%s],\n", e.Op.OperationID, quoteAll(e.Op.Roles))
+		}
+	}
+	g.printf("};\n\n")
+	g.printf("%s", tsRuntime)
+
+	g.printf("export class HmsClient extends BaseClient {\n")
+	for _, e := range s.endpoints() {
+		g.operation(e)
+	}
+	g.printf("}\n")
+	return []byte(g.b.String())
+}
+
+func (g *tsGenerator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.b, format, args...)
+}
+
+func (g *tsGenerator) typeOf(sch *schema, depth int) string {
+	if sch == nil {
+		return "unknown"
+	}
+	t := g.baseType(sch, depth)
+	if sch.Nullable {
+		t += " | null"
+	}
+	return t
+}
+
+func (g *tsGenerator) baseType(sch *schema, depth int) string {
+	if sch.Ref != "" {
+		return tsTypeName(sch.refName())
+	}
+	if len(sch.Enum) > 0 {
+		values := make([]string, len(sch.Enum))
+		for i, value := range sch.Enum {
+			values[i] = strconv.Quote(fmt.Sprint(value))
+		}
+		return strings.Join(values, " | ")
+	}
+
+	switch sch.Type {
+	case "string":
+		if sch.Format == "binary" {
+			return "Blob"
+		}
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		item := g.typeOf(sch.Items, depth)
+		if strings.ContainsAny(item, " |") {
+			return "Array<" + item + ">"
+		}
+		return item + "[]"
+	case "object":
+		if len(sch.Properties) == 0 {
+			return "Record<string, " + g.typeOf(sch.AdditionalProperties, depth) + ">"
+		}
+		indent := strings.Repeat("  ", depth+1)
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, name := range sortedKeys(sch.Properties) {
+			optional := "?"
+			if contains(sch.Required, name) {
+				optional = ""
+			}
+			fmt.Fprintf(&b, "%s%s%s: %s;\n", indent, tsKey(name), optional, g.typeOf(sch.Properties[name], depth+1))
+		}
+		b.WriteString(strings.Repeat("  ", depth) + "}")
+		return b.String()
+	default:
+		return "unknown"
+	}
+}
+
+func (g *tsGenerator) operation(e endpoint) {
+	pathParams, queryParams := e.pathParams(), e.queryParams()
+	contentType, body := e.body()
+	status, result := e.result()
+
+	if e.Op.Summary != "" {
+		g.printf("  /**\n   * %s (%s %s).\n", e.Op.Summary, e.Method, e.Path)
+	} else {
+		g.printf("  /**\n   * %s %s.\n", e.Method, e.Path)
+	}
+	if e.Op.Description != "" {
+		g.printf("   *\n%s", comment("   *", e.Op.Description))
+	}
+	g.printf("   *\n   * Roles: %s\n   */\n", e.roles())
+
+	var args []string
+	names := map[string]string{}
+	for _, p := range pathParams {
+		arg := camel(p.Name)
+		names[p.Name] = arg
+		args = append(args, arg+": "+g.typeOf(p.Schema, 1))
+	}
+	if body != nil {
+		args = append(args, "body: "+g.typeOf(body, 1))
+	}
+	if len(queryParams) > 0 {
+		var fields []string
+		for _, p := range queryParams {
+			fields = append(fields, tsKey(p.Name)+"?: "+g.typeOf(p.Schema, 1))
+		}
+		args = append(args, "query?: { "+strings.Join(fields, "; ")+" }")
+	}
+
+	returns, kind := "void", "none"
+	switch {
+	case result != nil:
+		returns, kind = g.typeOf(result, 1), "json"
+	case status != http.StatusNoContent:
+		returns, kind = "Response", "raw"
+	}
+
+	path := pathParamPattern.ReplaceAllStringFunc(e.Path, func(match string) string {
+		return "${encodeURIComponent(String(" + names[strings.Trim(match, "{}")] + "))}"
+	})
+
+	options := []string{fmt.Sprintf("kind: %q", kind)}
+	if len(queryParams) > 0 {
+		options = append(options, "query")
+	}
+	if body != nil {
+		options = append(options, "body", fmt.Sprintf("contentType: %q", contentType))
+	}
+	g.printf("  %s(%s): Promise<%s> {\n", e.Op.OperationID, strings.Join(args, ", "), returns)
+	g.printf("    return this.request(%q, `%s`, { %s }) as Promise<%s>;\n  }\n\n", e.Method, path, strings.Join(options, ", "), returns)
+}
+
+// tsTypeName names a schema's type, steering clear of the runtime's identifiers
+func tsTypeName(name string) string {
+	name = pascal(name)
+	switch name {
+	case "HmsClient", "BaseClient", "ClientOptions", "RequestOptions", "ApiError":
+		return name + "Schema"
+	}
+	return name
+}
+
+// tsKey quotes property names that aren't plain identifiers
+func tsKey(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
+
+// tsRuntime is the hand-written part of the TypeScript client
+const tsRuntime = `/** Whether role may call the operation, e.g. to hide actions the user can't take. Admins may call everything. */
+export function canCall(operationId: string, role: string): boolean {
+  const roles = operationRoles[operationId];
+  return !roles || roles.some((allowed) => allowed.toLowerCase() === role.toLowerCase());
+}
+
+export interface ClientOptions {
+  /** Server origin, e.g. "https://localhost:8443"; empty for same-origin requests */
+  baseUrl?: string;
+  /** Headers sent with every request, e.g. X-Session-ID or Authorization */
+  headers?: Record<string, string>;
+  /** "include" to send the session cookie cross-origin */
+  credentials?: RequestCredentials;
+  /** The session's CSRF token, sent on state-changing requests in cookie mode */
+  csrfToken?: string;
+  fetch?: typeof fetch;
+}
+
+/** A non-2xx response in the API's error envelope */
+export class ApiError extends Error {
+  constructor(
+    readonly status: number,
+    readonly code: string,
+    message: string,
+    readonly details?: unknown,
+  ) {
+    super(message);
+    this.name = "ApiError";
+  }
+}
+
+type RequestOptions = {
+  kind: "json" | "raw" | "none";
+  query?: Record<string, string | number | boolean | undefined>;
+  body?: unknown;
+  contentType?: string;
+};
+
+class BaseClient {
+  constructor(protected options: ClientOptions = {}) {}
+
+  /** Sets the CSRF token returned by a cookie-mode login */
+  setCsrfToken(token: string | undefined): void {
+    this.options.csrfToken = token;
+  }
+
+  protected async request(method: string, path: string, { kind, query, body, contentType }: RequestOptions): Promise<unknown> {
+    let url = (this.options.baseUrl ?? "") + path;
+    if (query) {
+      const params = new URLSearchParams();
+      for (const [key, value] of Object.entries(query)) {
+        if (value !== undefined) params.set(key, String(value));
+      }
+      const encoded = params.toString();
+      if (encoded) url += "?" + encoded;
+    }
+
+    const headers: Record<string, string> = { Accept: "application/json", ...this.options.headers };
+    let payload: BodyInit | undefined;
+    if (body !== undefined) {
+      if (contentType === "application/json") {
+        headers["Content-Type"] = contentType;
+        payload = JSON.stringify(body);
+      } else {
+        // FormData sets its own multipart boundary
+        payload = body as BodyInit;
+      }
+    }
+    if (this.options.csrfToken && !["GET", "HEAD", "OPTIONS"].includes(method)) {
+      headers["X-CSRF-Token"] = this.options.csrfToken;
+    }
+
+    const response = await (this.options.fetch ?? fetch)(url, {
+      method,
+      headers,
+      body: payload,
+      credentials: this.options.credentials,
+    });
+    if (!response.ok) {
+      let error: { code?: string; message?: string; details?: unknown } = {};
+      try {
+        error = (await response.json()).error ?? {};
+      } catch {
+        // not an error envelope
+      }
+      throw new ApiError(response.status, error.code ?? "http_error", error.message ?? response.statusText, error.details);
+    }
+
+    switch (kind) {
+      case "json":
+        return response.json();
+      case "raw":
+        return response;
+      default:
+        return undefined;
+    }
+  }
+}
+
+`
@@ -0,0 +1,467 @@
+// Package config reads server settings from the environment
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/server"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+	"github.com/kinyaelgrande/simple-hospital/services/storage"
+	"github.com/kinyaelgrande/simple-hospital/tracing"
+)
+
+// Config holds settings that were previously hard-coded in main
+type Config struct {
+	// HTTPSAddr is the public TLS listener
+	HTTPSAddr string
+	// RedirectAddr serves plain HTTP redirects to HTTPS; empty disables it
+	RedirectAddr string
+	// MTLSAddr is an optional HTTPS listener for internal integrations that
+	// requires a client certificate signed by TLS.ClientCAFile
+	MTLSAddr string
+	// TLS configures the HTTPS certificate: files reloaded on SIGHUP, or
+	// ACME for the configured hostnames
+	TLS server.TLSOptions
+	// Security holds the allowed CORS origins and the security headers,
+	// starting from the APP_ENV profile ("dev" by default, or "prod")
+	Security middleware.SecurityOptions
+	// InternalAddr is an optional plaintext listener for a reverse proxy that terminates TLS
+	InternalAddr string
+	// UnixSocket is an optional Unix socket path serving plaintext to a local proxy
+	UnixSocket string
+	// ShutdownTimeout bounds how long in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration
+	// Database holds the PostgreSQL URL or SQLite path and the connection
+	// pool settings
+	Database database.Options
+	// QueryTimeout bounds the database work of a single request; zero disables it
+	QueryTimeout time.Duration
+	// StatsEpsilon is the differential privacy budget per published statistic
+	StatsEpsilon float64
+	// StatsMinCount suppresses published counts below this size
+	StatsMinCount int
+	// StatsNoiseKey seeds the published noise; empty uses a random key per process
+	StatsNoiseKey string
+	// ColdChainMinTemp and ColdChainMaxTemp (°C) are the thresholds for new
+	// vaccine storage units that don't specify their own
+	ColdChainMinTemp float64
+	ColdChainMaxTemp float64
+	// PayerAPIs maps insurance payer names to the base URLs of their
+	// pre-authorization APIs; other payers' decisions are recorded manually
+	PayerAPIs map[string]string
+	// Documents configures where uploaded patient documents are stored
+	Documents storage.Options
+	// DocumentMaxBytes limits the size of a single document upload
+	DocumentMaxBytes int64
+	// PatientImageMaxBytes limits the size of an uploaded patient photo or
+	// ID document scan, which is kept in the document store
+	PatientImageMaxBytes int64
+	// CalendarFeedSecret signs doctors' appointment feed URLs and must be the
+	// same on every server; empty uses a random key per process, so feed URLs
+	// stop working when the server restarts
+	CalendarFeedSecret string
+	// EncryptionKeys maps key ids to base64 AES-256 keys for the encrypted
+	// columns, from ENCRYPTION_KEYS or the file named by ENCRYPTION_KEYS_FILE
+	// (e.g. a secret written by a KMS agent). Empty disables encryption.
+	EncryptionKeys map[string]string
+	// EncryptionKeyID picks the key new values are encrypted with; it may be
+	// omitted when only one key is configured
+	EncryptionKeyID string
+	// Notifications configures the email, SMS and webhook providers; channels
+	// left unconfigured send nothing
+	Notifications notifications.Options
+	// SecurityAlertRecipients lists "channel:address" entries that receive
+	// security alerts, e.g. "email:security@example.org,webhook:#security"
+	SecurityAlertRecipients string
+	// NotificationPollInterval is how often the worker looks for due notifications
+	NotificationPollInterval time.Duration
+	// ReportPollInterval is how often the worker looks for scheduled reports that are due
+	ReportPollInterval time.Duration
+	// ReminderPollInterval is how often the worker looks for appointments
+	// whose reminders have come due
+	ReminderPollInterval time.Duration
+	// NotificationMaxAttempts is how many times a notification is tried before it fails
+	NotificationMaxAttempts int
+	// WebhookPollInterval is how often the worker looks for new events to
+	// send to webhooks and for deliveries due a retry
+	WebhookPollInterval time.Duration
+	// WebhookMaxAttempts is how many times a webhook delivery is tried before it fails
+	WebhookMaxAttempts int
+	// InterpreterAgencyRecipients lists "channel:address" entries that receive
+	// interpreter requests no rostered interpreter can cover
+	InterpreterAgencyRecipients string
+	// CodingRequiredEncounters lists the encounter types ("outpatient",
+	// "inpatient") whose claims can't be submitted until the encounter is coded
+	CodingRequiredEncounters string
+	// FacilityTimezone is the IANA zone the hospital schedules in, e.g.
+	// "Africa/Kigali", from HOSPITAL_TIMEZONE or the older FACILITY_TIMEZONE.
+	// Timestamps are stored in UTC and shown in this zone.
+	FacilityTimezone string
+	// MaxSessionsPerUser caps each user's concurrent logins; the oldest
+	// session is ended when another completes. Zero means no limit.
+	MaxSessionsPerUser int
+	// SessionRedis shares sessions between servers through Redis, from
+	// SESSION_REDIS_URL; without one, or when it can't be reached at
+	// startup, sessions are kept in memory
+	SessionRedis session.RedisOptions
+	// SessionMode is "stateful", the default, to keep sessions in memory or
+	// Redis, or "stateless" to hand out signed session tokens any replica
+	// can check, so no server keeps sessions
+	SessionMode string
+	// SessionTokenSecret signs stateless session tokens and must be the same
+	// on every replica; it is required in stateless mode
+	SessionTokenSecret string
+	// SessionLifetimes bound pending and authenticated sessions, from
+	// SESSION_PENDING_TTL, SESSION_TTL, SESSION_IDLE_TIMEOUT and
+	// SESSION_MAX_AGE
+	SessionLifetimes session.Lifetimes
+	// ExportDir holds the chunk files of bulk exports
+	ExportDir string
+	// ExportChunkRows is the number of rows per export chunk file
+	ExportChunkRows int
+	// StreamMaxDuration cuts short a download streamed from the database,
+	// like GET /api/patients/export, after this long
+	StreamMaxDuration time.Duration
+	// StreamWriteTimeout is how long a streamed download's client may take
+	// to accept each chunk before the download is abandoned
+	StreamWriteTimeout time.Duration
+	// HealthCheckTimeout fails a readiness check that takes longer
+	HealthCheckTimeout time.Duration
+	// HealthMinFreeDisk is the free space, in bytes, the SQLite file's
+	// filesystem needs for the server to report ready
+	HealthMinFreeDisk int64
+	// BackupDir holds the SQLite database backups
+	BackupDir string
+	// BackupInterval is how often the database is backed up automatically;
+	// zero leaves backups to admins and the backup command
+	BackupInterval time.Duration
+	// BackupKeep is how many of the newest backups are kept; zero keeps all
+	BackupKeep int
+	// ProbeToken authenticates external uptime monitors calling the synthetic
+	// probe; empty disables the probe
+	ProbeToken string
+	// SyntheticPurgeAfter is how long a synthetic probe patient may outlive a
+	// failed probe before the purge removes it
+	SyntheticPurgeAfter time.Duration
+	// ICD10CodesFile is a tab-separated code table (code, description)
+	// loaded over the built-in starter set at startup; empty loads only the
+	// starter set
+	ICD10CodesFile string
+	// MetricsToken is the bearer token Prometheus must send to scrape
+	// /metrics; empty leaves the endpoint open
+	MetricsToken string
+	// BreakGlassDuration is how long an emergency break-glass grant gives a
+	// clinician the full view of a patient's medical records
+	BreakGlassDuration time.Duration
+	// AdminUsername and AdminPassword are the admin account created when
+	// there is no admin yet. Without a password a random one is generated
+	// and printed once.
+	AdminUsername string
+	AdminPassword string
+	// DemoPassword is the password of the demo staff loaded by
+	// -seed-demo-data; empty generates one
+	DemoPassword string
+	// Tracing configures exporting request and database spans to an
+	// OpenTelemetry collector, from the standard OTEL_* variables
+	Tracing tracing.Options
+	// Debug writes debug records, from LOG_LEVEL=debug. They may hold request
+	// bodies and patient details, so it is for development only.
+	Debug bool
+}
+
+// Load reads the configuration from the environment, applying defaults
+func Load() *Config {
+	return &Config{
+		HTTPSAddr:                   getEnv("HTTPS_ADDR", ":8443"),
+		RedirectAddr:                getEnv("HTTP_REDIRECT_ADDR", ":8080"),
+		MTLSAddr:                    os.Getenv("MTLS_ADDR"),
+		TLS:                         loadTLS(),
+		Security:                    loadSecurity(),
+		InternalAddr:                os.Getenv("INTERNAL_HTTP_ADDR"),
+		UnixSocket:                  os.Getenv("UNIX_SOCKET"),
+		ShutdownTimeout:             getDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		Database:                    loadDatabase(),
+		QueryTimeout:                getDuration("DB_QUERY_TIMEOUT", 10*time.Second),
+		StatsEpsilon:                getFloat("STATS_EPSILON", 1.0),
+		StatsMinCount:               getInt("STATS_MIN_COUNT", 10),
+		StatsNoiseKey:               os.Getenv("STATS_NOISE_KEY"),
+		ColdChainMinTemp:            getFloat("COLD_CHAIN_MIN_TEMP", 2.0),
+		ColdChainMaxTemp:            getFloat("COLD_CHAIN_MAX_TEMP", 8.0),
+		PayerAPIs:                   getMap("PREAUTH_PAYER_APIS"),
+		Documents:                   loadDocumentStorage(),
+		DocumentMaxBytes:            int64(getInt("DOCUMENT_MAX_BYTES", 20<<20)),
+		PatientImageMaxBytes:        int64(getInt("PATIENT_IMAGE_MAX_BYTES", 5<<20)),
+		CalendarFeedSecret:          os.Getenv("CALENDAR_FEED_SECRET"),
+		EncryptionKeys:              loadEncryptionKeys(),
+		EncryptionKeyID:             os.Getenv("ENCRYPTION_KEY_ID"),
+		Notifications:               loadNotifications(),
+		SecurityAlertRecipients:     os.Getenv("SECURITY_ALERT_RECIPIENTS"),
+		NotificationPollInterval:    getDuration("NOTIFY_POLL_INTERVAL", 15*time.Second),
+		ReportPollInterval:          getDuration("REPORT_POLL_INTERVAL", time.Minute),
+		ReminderPollInterval:        getDuration("REMINDER_POLL_INTERVAL", time.Minute),
+		NotificationMaxAttempts:     getInt("NOTIFY_MAX_ATTEMPTS", 8),
+		WebhookPollInterval:         getDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		WebhookMaxAttempts:          getInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		InterpreterAgencyRecipients: os.Getenv("INTERPRETER_AGENCY_RECIPIENTS"),
+		CodingRequiredEncounters:    getEnv("CODING_REQUIRED_ENCOUNTERS", "outpatient,inpatient"),
+		FacilityTimezone:            getEnv("HOSPITAL_TIMEZONE", getEnv("FACILITY_TIMEZONE", "UTC")),
+		MaxSessionsPerUser:          getInt("MAX_SESSIONS_PER_USER", 0),
+		SessionRedis:                loadSessionRedis(),
+		SessionMode:                 getEnv("SESSION_MODE", "stateful"),
+		SessionTokenSecret:          os.Getenv("SESSION_TOKEN_SECRET"),
+		SessionLifetimes:            loadSessionLifetimes(),
+		ExportDir:                   getEnv("EXPORT_DIR", "data/exports"),
+		ExportChunkRows:             getInt("EXPORT_CHUNK_ROWS", 10000),
+		StreamMaxDuration:           getDuration("STREAM_MAX_DURATION", 10*time.Minute),
+		StreamWriteTimeout:          getDuration("STREAM_WRITE_TIMEOUT", 30*time.Second),
+		HealthCheckTimeout:          getDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		HealthMinFreeDisk:           int64(getInt("HEALTH_MIN_FREE_DISK", 100<<20)),
+		BackupDir:                   getEnv("BACKUP_DIR", "data/backups"),
+		BackupInterval:              getDuration("BACKUP_INTERVAL", 0),
+		BackupKeep:                  getInt("BACKUP_KEEP", 14),
+		ProbeToken:                  os.Getenv("PROBE_TOKEN"),
+		SyntheticPurgeAfter:         getDuration("SYNTHETIC_PURGE_AFTER", 10*time.Minute),
+		ICD10CodesFile:              os.Getenv("ICD10_CODES_FILE"),
+		MetricsToken:                os.Getenv("METRICS_TOKEN"),
+		BreakGlassDuration:          getDuration("BREAK_GLASS_DURATION", time.Hour),
+		AdminUsername:               getEnv("ADMIN_USERNAME", "admin"),
+		AdminPassword:               os.Getenv("ADMIN_PASSWORD"),
+		DemoPassword:                os.Getenv("DEMO_PASSWORD"),
+		Tracing:                     loadTracing(),
+		Debug:                       strings.EqualFold(getEnv("LOG_LEVEL", "info"), "debug"),
+	}
+}
+
+func loadDatabase() database.Options {
+	defaults := database.DefaultOptions()
+	return database.Options{
+		URL:                 os.Getenv("DATABASE_URL"),
+		Path:                getEnv("DB_PATH", defaults.Path),
+		MaxOpenConns:        getInt("DB_MAX_OPEN_CONNS", defaults.MaxOpenConns),
+		MaxIdleConns:        getInt("DB_MAX_IDLE_CONNS", defaults.MaxIdleConns),
+		ConnMaxIdleTime:     getDuration("DB_CONN_MAX_IDLE_TIME", defaults.ConnMaxIdleTime),
+		BusyTimeout:         getDuration("DB_BUSY_TIMEOUT", defaults.BusyTimeout),
+		StatementCacheSize:  getInt("DB_STATEMENT_CACHE_SIZE", defaults.StatementCacheSize),
+		ReplicaURL:          os.Getenv("DATABASE_REPLICA_URL"),
+		ReadOnlyReplica:     getBool("DB_READ_REPLICA", false),
+		ReplicaMaxOpenConns: getInt("DB_REPLICA_MAX_OPEN_CONNS", 0),
+		SlowQueryThreshold:  getDuration("DB_SLOW_QUERY_THRESHOLD", defaults.SlowQueryThreshold),
+	}
+}
+
+func loadSessionRedis() session.RedisOptions {
+	return session.RedisOptions{
+		URL:       os.Getenv("SESSION_REDIS_URL"),
+		KeyPrefix: getEnv("SESSION_REDIS_PREFIX", "hospital:"),
+		Timeout:   getDuration("SESSION_REDIS_TIMEOUT", 2*time.Second),
+	}
+}
+
+func loadSessionLifetimes() session.Lifetimes {
+	defaults := session.DefaultLifetimes
+	return session.Lifetimes{
+		Pending:       getDuration("SESSION_PENDING_TTL", defaults.Pending),
+		Authenticated: getDuration("SESSION_TTL", defaults.Authenticated),
+		IdleTimeout:   getDuration("SESSION_IDLE_TIMEOUT", defaults.IdleTimeout),
+		MaxAge:        getDuration("SESSION_MAX_AGE", defaults.MaxAge),
+	}
+}
+
+func loadTLS() server.TLSOptions {
+	var hosts []string
+	for _, host := range strings.Split(os.Getenv("ACME_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return server.TLSOptions{
+		CertFile:         getEnv("TLS_CERT_FILE", "certs/server.crt"),
+		KeyFile:          getEnv("TLS_KEY_FILE", "certs/server.key"),
+		ACMEHosts:        hosts,
+		ACMECacheDir:     getEnv("ACME_CACHE_DIR", "data/acme"),
+		ACMEEmail:        os.Getenv("ACME_EMAIL"),
+		ACMEDirectoryURL: os.Getenv("ACME_DIRECTORY_URL"),
+		ClientCAFile:     os.Getenv("MTLS_CLIENT_CA_FILE"),
+	}
+}
+
+// loadSecurity starts from the APP_ENV profile's defaults and applies
+// CORS_ALLOWED_ORIGINS (comma-separated; "off" allows none), HSTS_MAX_AGE,
+// CONTENT_SECURITY_POLICY and REFERRER_POLICY over them
+func loadSecurity() middleware.SecurityOptions {
+	profile := getEnv("APP_ENV", "dev")
+	opts, ok := middleware.SecurityProfiles[profile]
+	if !ok {
+		log.Fatalf("APP_ENV must be dev or prod, not %q", profile)
+	}
+
+	if origins, set := os.LookupEnv("CORS_ALLOWED_ORIGINS"); set {
+		opts.AllowedOrigins = nil
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" && origin != "off" {
+				opts.AllowedOrigins = append(opts.AllowedOrigins, origin)
+			}
+		}
+	}
+	opts.HSTSMaxAge = getDuration("HSTS_MAX_AGE", opts.HSTSMaxAge)
+	opts.ContentSecurityPolicy = getEnv("CONTENT_SECURITY_POLICY", opts.ContentSecurityPolicy)
+	opts.ReferrerPolicy = getEnv("REFERRER_POLICY", opts.ReferrerPolicy)
+	return opts
+}
+
+func loadDocumentStorage() storage.Options {
+	return storage.Options{
+		Backend:   getEnv("DOCUMENT_STORAGE", storage.BackendDisk),
+		Dir:       getEnv("DOCUMENT_DIR", "data/documents"),
+		Endpoint:  os.Getenv("DOCUMENT_S3_ENDPOINT"),
+		Bucket:    os.Getenv("DOCUMENT_S3_BUCKET"),
+		Region:    os.Getenv("DOCUMENT_S3_REGION"),
+		AccessKey: os.Getenv("DOCUMENT_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("DOCUMENT_S3_SECRET_KEY"),
+	}
+}
+
+func loadNotifications() notifications.Options {
+	return notifications.Options{
+		SMTPAddr:      os.Getenv("NOTIFY_SMTP_ADDR"),
+		SMTPUsername:  os.Getenv("NOTIFY_SMTP_USERNAME"),
+		SMTPPassword:  os.Getenv("NOTIFY_SMTP_PASSWORD"),
+		SMTPFrom:      os.Getenv("NOTIFY_SMTP_FROM"),
+		SMSBaseURL:    os.Getenv("NOTIFY_SMS_BASE_URL"),
+		SMSAccountSID: os.Getenv("NOTIFY_SMS_ACCOUNT_SID"),
+		SMSAuthToken:  os.Getenv("NOTIFY_SMS_AUTH_TOKEN"),
+		SMSFrom:       os.Getenv("NOTIFY_SMS_FROM"),
+		WebhookURL:    os.Getenv("NOTIFY_WEBHOOK_URL"),
+		WebhookSecret: os.Getenv("NOTIFY_WEBHOOK_SECRET"),
+	}
+}
+
+// loadTracing reads the OTLP/HTTP traces URL from
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT with
+// /v1/traces appended, and the ratio of traces kept from
+// OTEL_TRACES_SAMPLER_ARG
+func loadTracing() tracing.Options {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint == "" && base != "" {
+		endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+	}
+	return tracing.Options{
+		Endpoint:    endpoint,
+		Headers:     getMap("OTEL_EXPORTER_OTLP_HEADERS"),
+		ServiceName: getEnv("OTEL_SERVICE_NAME", "simple-hospital"),
+		SampleRatio: getFloat("OTEL_TRACES_SAMPLER_ARG", 1.0),
+	}
+}
+
+// loadEncryptionKeys reads "id=key" pairs, separated by commas or newlines,
+// from ENCRYPTION_KEYS_FILE if set and ENCRYPTION_KEYS otherwise
+func loadEncryptionKeys() map[string]string {
+	path := os.Getenv("ENCRYPTION_KEYS_FILE")
+	if path == "" {
+		return getMap("ENCRYPTION_KEYS")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read ENCRYPTION_KEYS_FILE: %v", err)
+	}
+	return parseMap("ENCRYPTION_KEYS_FILE", strings.ReplaceAll(string(data), "\n", ","))
+}
+
+// getEnv returns the variable or fallback when unset. Setting a variable to
+// "off" yields an empty string, disabling optional listeners.
+func getEnv(key, fallback string) string {
+	value, set := os.LookupEnv(key)
+	if !set {
+		return fallback
+	}
+	if value == "off" {
+		return ""
+	}
+	return value
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+func getInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func getBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+func getFloat(key string, fallback float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %g", key, value, fallback)
+		return fallback
+	}
+	return f
+}
+
+// getMap parses "name=value,name=value" pairs, skipping malformed entries
+func getMap(key string) map[string]string {
+	return parseMap(key, os.Getenv(key))
+}
+
+func parseMap(key, value string) map[string]string {
+	pairs := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			log.Printf("Invalid %s entry %q, skipping", key, entry)
+			continue
+		}
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return pairs
+}
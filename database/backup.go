@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrBackupUnsupported is returned by Backup and Restore unless the database
+// is a SQLite file; PostgreSQL is backed up with its own tools
+var ErrBackupUnsupported = errors.New("backups are only supported for a SQLite database file")
+
+func backupSupported() bool {
+	return dialect.Name() == SQLite && options.Path != MemoryPath
+}
+
+// Backup writes a consistent copy of the live database to path, which must
+// not exist yet. VACUUM INTO reads a single snapshot, so requests keep
+// reading and writing while it runs.
+func Backup(ctx context.Context, path string) error {
+	if !backupSupported() {
+		return ErrBackupUnsupported
+	}
+	_, err := DB.ExecContext(ctx, `VACUUM INTO ?`, path)
+	return err
+}
+
+// CheckBackup opens the SQLite file at path read-only and runs SQLite's
+// integrity check on it
+func CheckBackup(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup failed its integrity check: %s", result)
+	}
+	return nil
+}
+
+// Restore replaces the contents of the live database with the SQLite file at
+// path using SQLite's online backup API, then brings its schema up to date,
+// so a backup taken before a migration can be restored. Pooled connections
+// see the restored data as soon as it completes; writes that were in
+// progress wait for it on busy_timeout. A read replica is not restored.
+func Restore(ctx context.Context, path string) error {
+	if !backupSupported() {
+		return ErrBackupUnsupported
+	}
+
+	source, err := (&sqlite3.SQLiteDriver{}).Open(fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %v", err)
+	}
+	defer source.Close()
+
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = RetryOnBusy(ctx, func() error {
+		return conn.Raw(func(driverConn any) error {
+			destination := driverConn.(*instrumentedConn).SQLiteConn
+			backup, err := destination.Backup("main", source.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			// One step copies every page under a single lock, so no request
+			// sees a half-restored database
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore backup: %v", err)
+	}
+
+	if err := createTables(); err != nil {
+		return err
+	}
+	return runMigrations()
+}
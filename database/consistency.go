@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+type consistencyKey struct{}
+
+// WithPrimaryReads marks ctx as requiring reads from the primary database,
+// because the caller recently wrote data it expects to read back
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, true)
+}
+
+// PrimaryReadsRequired reports whether ctx was marked by WithPrimaryReads
+func PrimaryReadsRequired(ctx context.Context) bool {
+	required, _ := ctx.Value(consistencyKey{}).(bool)
+	return required
+}
+
+// ReadDB returns the database reads for ctx should use. Reads that must see
+// the caller's own writes always go to the primary; the others, reports and
+// lists among them, are served by the replica when one is configured. Reads
+// inside a transaction use the transaction instead.
+func ReadDB(ctx context.Context) *sql.DB {
+	if PrimaryReadsRequired(ctx) || replica == nil {
+		return DB
+	}
+	return replica
+}
@@ -9,20 +9,54 @@ import (
 
 var DB *sql.DB
 
-// Initialize database
-func InitDB() (err error) {
-	DB, err = sql.Open("sqlite3", "./hospital.db")
+// replica is an optional read-only copy of DB, opened from
+// Options.ReplicaURL or ReadOnlyReplica; nil means all reads use DB
+var replica *sql.DB
+
+// InitDB opens the database with DefaultOptions
+func InitDB() error {
+	return Open(DefaultOptions())
+}
+
+// Open opens the database with the given pool settings and brings the
+// schema up to date: PostgreSQL when opts.URL is a postgres:// URL,
+// otherwise SQLite in WAL mode
+func Open(opts Options) (err error) {
+	dialect = dialectFor(opts)
+	// Set first: new SQLite connections size their statement cache from it
+	options = opts
+	if dialect.Name() == Postgres {
+		DB, err = openPostgres(opts.URL)
+	} else {
+		DB, err = sql.Open(driverName, opts.dsn())
+	}
 	if err != nil {
 		log.Fatal(err)
 		return err
 	}
 
+	DB.SetMaxOpenConns(opts.MaxOpenConns)
+	DB.SetMaxIdleConns(opts.MaxIdleConns)
+	DB.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	if dialect.Name() == SQLite && opts.Path == MemoryPath {
+		// The in-memory database is dropped when its last connection closes
+		DB.SetMaxIdleConns(max(opts.MaxIdleConns, 1))
+		DB.SetConnMaxIdleTime(0)
+	}
+
 	// Create tables
 	err = createTables()
 	if err != nil {
 		return err
 	}
 
+	if err := runMigrations(); err != nil {
+		return err
+	}
+
+	if replica, err = openReplica(opts); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -80,13 +114,77 @@ func createTables() error {
             FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
             FOREIGN KEY (doctor_id) REFERENCES Users(user_id)
         );`,
+		`CREATE TABLE IF NOT EXISTS WebAuthnCredentials (
+            webauthn_credential_id INTEGER PRIMARY KEY,
+            user_id INTEGER NOT NULL,
+            credential_id TEXT NOT NULL UNIQUE,
+            name TEXT,
+            credential_data TEXT NOT NULL,
+            created_at DATETIME NOT NULL,
+            last_used_at DATETIME,
+            FOREIGN KEY (user_id) REFERENCES Users(user_id)
+        );`,
+		`CREATE TABLE IF NOT EXISTS ClinicalEvents (
+            event_id INTEGER PRIMARY KEY,
+            entity_type TEXT NOT NULL,
+            entity_id INTEGER NOT NULL,
+            event_type TEXT NOT NULL,
+            payload TEXT NOT NULL,
+            occurred_at DATETIME NOT NULL
+        );`,
+		`CREATE INDEX IF NOT EXISTS idx_clinical_events_entity ON ClinicalEvents (entity_type, entity_id);`,
+		// Events are append-only: reject any attempt to rewrite or remove history
+		`CREATE TRIGGER IF NOT EXISTS clinical_events_no_update BEFORE UPDATE ON ClinicalEvents
+			BEGIN
+				SELECT RAISE(ABORT, 'ClinicalEvents is append-only');
+			END;`,
+		`CREATE TRIGGER IF NOT EXISTS clinical_events_no_delete BEFORE DELETE ON ClinicalEvents
+			BEGIN
+				SELECT RAISE(ABORT, 'ClinicalEvents is append-only');
+			END;`,
+		`CREATE TABLE IF NOT EXISTS AuditLogs (
+            audit_log_id INTEGER PRIMARY KEY,
+            user_id INTEGER,
+            action TEXT NOT NULL,
+            entity_type TEXT,
+            entity_id INTEGER,
+            details TEXT,
+            created_at DATETIME NOT NULL,
+            FOREIGN KEY (user_id) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_entity ON AuditLogs (entity_type, entity_id);`,
+		`CREATE TABLE IF NOT EXISTS DrugInteractions (
+            drug_interaction_id INTEGER PRIMARY KEY,
+            drug_a TEXT NOT NULL,
+            drug_b TEXT NOT NULL,
+            severity TEXT CHECK(severity IN ('minor', 'moderate', 'major')),
+            description TEXT NOT NULL,
+            UNIQUE (drug_a, drug_b)
+        );`,
+		// Well-known interactions; extend by inserting rows (names are lowercase generic names)
+		`INSERT INTO DrugInteractions (drug_a, drug_b, severity, description) VALUES
+            ('warfarin', 'aspirin', 'major', 'Increased risk of bleeding'),
+            ('warfarin', 'ibuprofen', 'major', 'Increased risk of bleeding'),
+            ('warfarin', 'fluconazole', 'major', 'Fluconazole raises warfarin levels; risk of bleeding'),
+            ('simvastatin', 'clarithromycin', 'major', 'Risk of myopathy and rhabdomyolysis'),
+            ('sildenafil', 'nitroglycerin', 'major', 'Severe hypotension'),
+            ('methotrexate', 'trimethoprim', 'major', 'Increased methotrexate toxicity'),
+            ('digoxin', 'amiodarone', 'major', 'Amiodarone raises digoxin levels'),
+            ('tramadol', 'fluoxetine', 'major', 'Risk of serotonin syndrome and seizures'),
+            ('linezolid', 'sertraline', 'major', 'Risk of serotonin syndrome'),
+            ('ciprofloxacin', 'tizanidine', 'major', 'Ciprofloxacin raises tizanidine levels; severe hypotension'),
+            ('lisinopril', 'spironolactone', 'moderate', 'Risk of hyperkalemia'),
+            ('clopidogrel', 'omeprazole', 'moderate', 'Reduced antiplatelet effect of clopidogrel'),
+            ('metformin', 'prednisolone', 'minor', 'Corticosteroids may raise blood glucose')
+            ON CONFLICT DO NOTHING;`,
 	}
 
-	for _, query := range queries {
-		_, err := DB.Exec(query)
-		if err != nil {
-			log.Fatal("Error creating table:", err)
-			return err
+	for _, query := range append(dialect.bootstrap(), queries...) {
+		for _, statement := range dialect.Schema(query) {
+			if _, err := DB.Exec(statement); err != nil {
+				log.Fatal("Error creating table:", err)
+				return err
+			}
 		}
 	}
 
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Dialect is the SQL flavour of the database in use. Services write
+// portable SQL with ? placeholders; the schema in createTables and the
+// migrations is written for SQLite and translated by Schema, and the
+// PostgreSQL driver rewrites placeholders as statements run.
+type Dialect interface {
+	// Name is "sqlite" or "postgres"
+	Name() string
+	// Schema translates a SQLite DDL statement into the statements that
+	// create the same schema in this dialect
+	Schema(statement string) []string
+	// bootstrap is run once before the tables are created
+	bootstrap() []string
+}
+
+// Dialect names
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+// dialect is the dialect of the open database
+var dialect Dialect = sqliteDialect{}
+
+// CurrentDialect returns the dialect of the open database
+func CurrentDialect() Dialect {
+	return dialect
+}
+
+// dialectFor picks PostgreSQL for a postgres:// URL and SQLite otherwise
+func dialectFor(opts Options) Dialect {
+	if isPostgresURL(opts.URL) {
+		return postgresDialect{}
+	}
+	return sqliteDialect{}
+}
+
+func isPostgresURL(url string) bool {
+	return strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://")
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return SQLite }
+
+func (sqliteDialect) Schema(statement string) []string { return []string{statement} }
+
+func (sqliteDialect) bootstrap() []string { return nil }
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return Postgres }
+
+var (
+	// rowidKey is SQLite's auto-assigned INTEGER PRIMARY KEY
+	rowidKey     = regexp.MustCompile(`(?i)\bINTEGER PRIMARY KEY(\s+AUTOINCREMENT)?\b`)
+	datetimeType = regexp.MustCompile(`(?i)\bDATETIME\b`)
+	realType     = regexp.MustCompile(`(?i)\bREAL\b`)
+	blobType     = regexp.MustCompile(`(?i)\bBLOB\b`)
+	// noCase is a NOCASE column, which PostgreSQL wants collated right
+	// after the type rather than after the constraints
+	noCase          = regexp.MustCompile(`(?i)\bTEXT\b([^,\n]*?)\s+COLLATE NOCASE\b`)
+	viewIfNotExists = regexp.MustCompile(`(?i)^\s*CREATE VIEW IF NOT EXISTS\b`)
+	// abortTrigger is the only trigger form the schema uses: one that
+	// rejects a statement outright
+	abortTrigger = regexp.MustCompile(`(?is)^\s*CREATE TRIGGER IF NOT EXISTS (\w+) (BEFORE|AFTER) (INSERT|UPDATE|DELETE) ON (\w+)\s+BEGIN\s+SELECT RAISE\(ABORT, '([^']*)'\);\s+END;?\s*$`)
+)
+
+// Schema maps SQLite's types and syntax to PostgreSQL: rowid keys become
+// SERIAL, DATETIME becomes TIMESTAMPTZ, NOCASE columns use a
+// case-insensitive ICU collation and RAISE(ABORT) triggers become trigger
+// functions
+func (postgresDialect) Schema(statement string) []string {
+	if m := abortTrigger.FindStringSubmatch(statement); m != nil {
+		name, timing, event, table, message := m[1], m[2], m[3], m[4], m[5]
+		return []string{
+			fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger LANGUAGE plpgsql AS $$
+            BEGIN
+                RAISE EXCEPTION '%s';
+            END $$;`, name, message),
+			fmt.Sprintf(`CREATE OR REPLACE TRIGGER %s %s %s ON %s FOR EACH ROW EXECUTE FUNCTION %s();`,
+				name, timing, event, table, name),
+		}
+	}
+
+	statement = rowidKey.ReplaceAllString(statement, "SERIAL PRIMARY KEY")
+	statement = datetimeType.ReplaceAllString(statement, "TIMESTAMPTZ")
+	statement = realType.ReplaceAllString(statement, "DOUBLE PRECISION")
+	statement = blobType.ReplaceAllString(statement, "BYTEA")
+	statement = noCase.ReplaceAllString(statement, "TEXT COLLATE nocase$1")
+	statement = viewIfNotExists.ReplaceAllString(statement, "CREATE OR REPLACE VIEW")
+	return []string{statement}
+}
+
+// bootstrap creates the nocase collation, which compares case-insensitively
+// like SQLite's NOCASE
+func (postgresDialect) bootstrap() []string {
+	return []string{
+		`CREATE COLLATION IF NOT EXISTS nocase (provider = icu, locale = 'und-u-ks-level2', deterministic = false);`,
+	}
+}
+
+// rebind rewrites ? placeholders as PostgreSQL's $1, $2, ..., leaving
+// question marks in string literals, quoted identifiers and comments alone
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+2])
+			i += end + 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				b.WriteString(query[i:])
+				return b.String()
+			}
+			b.WriteString(query[i : i+end+1])
+			i += end
+		case c == '?':
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
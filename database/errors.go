@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Constraints a write can violate, as reported by Violation
+const (
+	ViolationUnique     = "unique"
+	ViolationForeignKey = "foreign_key"
+	ViolationOther      = "other"
+)
+
+// PostgreSQL error codes the services distinguish
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+	pgLockNotAvailable     = "55P03"
+	pgQueryCanceled        = "57014"
+)
+
+// Violation reports which kind of constraint err violated, if any
+func Violation(err error) (string, bool) {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return ViolationUnique, true
+		case sqlite3.ErrConstraintForeignKey:
+			return ViolationForeignKey, true
+		}
+		return ViolationOther, true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code[:2] == "23" {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return ViolationUnique, true
+		case pgForeignKeyViolation:
+			return ViolationForeignKey, true
+		}
+		return ViolationOther, true
+	}
+	return "", false
+}
+
+// IsInterrupted reports whether err is a statement cut off by its context
+func IsInterrupted(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrInterrupt
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgQueryCanceled
+}
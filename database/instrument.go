@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kinyaelgrande/simple-hospital/tracing"
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// driverName is the SQLite driver wrapped to time every statement for the
+// metrics endpoint and trace those run for a traced request
+const driverName = "sqlite3-instrumented"
+
+// statementSpan starts the trace span of a statement, named after its verb
+// (SELECT, INSERT, ...), which records nothing when ctx isn't being traced.
+// The statement text has only placeholders, so no patient data reaches the
+// traces.
+func statementSpan(ctx context.Context, system, query string) trace.Span {
+	span := tracing.Child(ctx, strings.ToUpper(statementVerb(query)), trace.SpanKindClient)
+	span.SetAttributes(attribute.String("db.system", system), attribute.String("db.statement", query))
+	return span
+}
+
+// statementVerb returns the first word of query
+func statementVerb(query string) string {
+	verb := strings.TrimSpace(query)
+	if i := strings.IndexFunc(verb, unicode.IsSpace); i > 0 {
+		verb = verb[:i]
+	}
+	return verb
+}
+
+func init() {
+	sql.Register(driverName, instrumentedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+type instrumentedDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d instrumentedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn.(*sqlite3.SQLiteConn), newStmtCache(options.StatementCacheSize)}, nil
+}
+
+// instrumentedConn times the statements database/sql runs directly on the
+// connection, which is every statement the services run, and reuses their
+// prepared statements from its cache
+type instrumentedConn struct {
+	*sqlite3.SQLiteConn
+	statements *stmtCache
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	span := statementSpan(ctx, "sqlite", query)
+	args = storedArgs(args, true)
+	result, err := c.exec(ctx, query, args)
+	observeStatement(ctx, "exec", query, args, time.Since(start), rowsAffected(result), err)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c *instrumentedConn) exec(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !cacheableExec(query) {
+		return c.SQLiteConn.ExecContext(ctx, query, args)
+	}
+	cached, err := c.statements.acquire(ctx, c.SQLiteConn, query)
+	if err != nil {
+		return nil, err
+	}
+	if cached == nil {
+		return c.SQLiteConn.ExecContext(ctx, query, args)
+	}
+	defer c.statements.release(cached)
+
+	bound, err := bindArgs(cached.stmt, args)
+	if err != nil {
+		return nil, err
+	}
+	return cached.stmt.ExecContext(ctx, bound)
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	span := statementSpan(ctx, "sqlite", query)
+	args = storedArgs(args, true)
+	rows, release, err := c.query(ctx, query, args)
+	if err != nil {
+		observeStatement(ctx, "query", query, args, time.Since(start), 0, err)
+		tracing.End(span, err)
+		return nil, err
+	}
+	sqliteRows := rows.(*sqlite3.SQLiteRows)
+	return &instrumentedRows{SQLiteRows: sqliteRows, statement: newStatementRun(ctx, query, args, start), span: span, release: release,
+		isDate: dateColumns(sqliteRows.DeclTypes())}, nil
+}
+
+// query runs query on its cached statement when it can, returning the
+// function that makes the statement available again once the rows close
+func (c *instrumentedConn) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, func(), error) {
+	cached, err := c.statements.acquire(ctx, c.SQLiteConn, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cached == nil {
+		rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+		return rows, nil, err
+	}
+
+	bound, err := bindArgs(cached.stmt, args)
+	if err != nil {
+		c.statements.release(cached)
+		return nil, nil, err
+	}
+	rows, err := cached.stmt.QueryContext(ctx, bound)
+	if err != nil {
+		c.statements.release(cached)
+		return nil, nil, err
+	}
+	return rows, func() { c.statements.release(cached) }, nil
+}
+
+// Close finalizes the cached statements, then closes the connection
+func (c *instrumentedConn) Close() error {
+	c.statements.close()
+	return c.SQLiteConn.Close()
+}
+
+// instrumentedRows records the query when its rows are closed, since SQLite
+// does the work of a query as the rows are read, and returns DATE columns as
+// YYYY-MM-DD text
+type instrumentedRows struct {
+	*sqlite3.SQLiteRows
+	statement *statementRun
+	span      trace.Span
+	// release returns a cached statement to the cache; nil if the rows
+	// aren't from one
+	release func()
+	isDate  []bool
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	if err := r.SQLiteRows.Next(dest); err != nil {
+		return err
+	}
+	r.statement.rows++
+	calendarDates(dest, r.isDate)
+	return nil
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.SQLiteRows.Close()
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+	r.statement.finish(err)
+	tracing.End(r.span, err)
+	return err
+}
@@ -0,0 +1,1780 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/dosage"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+)
+
+// migration evolves the schema created by createTables. Migrations run in
+// version order, each in its own transaction, and are recorded in
+// SchemaMigrations so they apply exactly once. Never edit a released
+// migration; append a new one instead.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "add lab technician role", func(tx *sql.Tx) error {
+		return rebuildUsersRoleCheck(tx, []string{"Admin", "Doctor", "Nurse", "Pharmacist", "LabTechnician"})
+	}},
+	{2, "create lab orders and results", execAll(
+		`CREATE TABLE LabOrders (
+            lab_order_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            record_id INTEGER NOT NULL,
+            ordered_by INTEGER NOT NULL,
+            test_name TEXT NOT NULL,
+            priority TEXT NOT NULL DEFAULT 'routine' CHECK(priority IN ('routine', 'urgent', 'stat')),
+            status TEXT NOT NULL DEFAULT 'ordered' CHECK(status IN ('ordered', 'completed', 'cancelled')),
+            notes TEXT,
+            ordered_at DATETIME NOT NULL,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (record_id) REFERENCES MedicalRecords(record_id),
+            FOREIGN KEY (ordered_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_lab_orders_patient ON LabOrders (patient_id);`,
+		`CREATE TABLE LabResults (
+            lab_result_id INTEGER PRIMARY KEY,
+            lab_order_id INTEGER NOT NULL,
+            analyte TEXT NOT NULL,
+            value TEXT NOT NULL,
+            unit TEXT,
+            reference_low REAL,
+            reference_high REAL,
+            reference_range TEXT,
+            flag TEXT NOT NULL CHECK(flag IN ('normal', 'low', 'high', 'critical', 'abnormal')),
+            comment TEXT,
+            resulted_by INTEGER NOT NULL,
+            resulted_at DATETIME NOT NULL,
+            FOREIGN KEY (lab_order_id) REFERENCES LabOrders(lab_order_id),
+            FOREIGN KEY (resulted_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_lab_results_order ON LabResults (lab_order_id);`,
+	)},
+	{3, "create wards, beds and admissions", execAll(
+		`CREATE TABLE Wards (
+            ward_id INTEGER PRIMARY KEY,
+            name TEXT NOT NULL UNIQUE,
+            description TEXT
+        );`,
+		`CREATE TABLE Beds (
+            bed_id INTEGER PRIMARY KEY,
+            ward_id INTEGER NOT NULL,
+            label TEXT NOT NULL,
+            out_of_service BOOLEAN NOT NULL DEFAULT FALSE,
+            UNIQUE (ward_id, label),
+            FOREIGN KEY (ward_id) REFERENCES Wards(ward_id)
+        );`,
+		`CREATE TABLE Admissions (
+            admission_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            bed_id INTEGER NOT NULL,
+            admitted_by INTEGER NOT NULL,
+            reason TEXT NOT NULL,
+            status TEXT NOT NULL DEFAULT 'admitted' CHECK(status IN ('admitted', 'discharged')),
+            admitted_at DATETIME NOT NULL,
+            discharged_at DATETIME,
+            discharged_by INTEGER,
+            discharge_summary TEXT,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (bed_id) REFERENCES Beds(bed_id),
+            FOREIGN KEY (admitted_by) REFERENCES Users(user_id),
+            FOREIGN KEY (discharged_by) REFERENCES Users(user_id)
+        );`,
+		// A bed holds one patient and a patient is in one bed at a time
+		`CREATE UNIQUE INDEX idx_admissions_active_bed ON Admissions (bed_id) WHERE status = 'admitted';`,
+		`CREATE UNIQUE INDEX idx_admissions_active_patient ON Admissions (patient_id) WHERE status = 'admitted';`,
+		`CREATE TABLE BedTransfers (
+            transfer_id INTEGER PRIMARY KEY,
+            admission_id INTEGER NOT NULL,
+            from_bed_id INTEGER NOT NULL,
+            to_bed_id INTEGER NOT NULL,
+            transferred_by INTEGER NOT NULL,
+            reason TEXT,
+            transferred_at DATETIME NOT NULL,
+            FOREIGN KEY (admission_id) REFERENCES Admissions(admission_id),
+            FOREIGN KEY (from_bed_id) REFERENCES Beds(bed_id),
+            FOREIGN KEY (to_bed_id) REFERENCES Beds(bed_id),
+            FOREIGN KEY (transferred_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_bed_transfers_admission ON BedTransfers (admission_id);`,
+	)},
+	{4, "create chart locks", execAll(
+		`CREATE TABLE ChartLocks (
+            patient_id INTEGER PRIMARY KEY,
+            holder_id INTEGER NOT NULL,
+            acquired_at DATETIME NOT NULL,
+            expires_at DATETIME NOT NULL,
+            takeover_requested_by INTEGER,
+            takeover_requested_at DATETIME,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (holder_id) REFERENCES Users(user_id),
+            FOREIGN KEY (takeover_requested_by) REFERENCES Users(user_id)
+        );`,
+	)},
+	{5, "create cold chain monitoring", execAll(
+		`CREATE TABLE StorageUnits (
+            unit_id INTEGER PRIMARY KEY,
+            name TEXT NOT NULL UNIQUE,
+            location TEXT,
+            min_temp REAL NOT NULL,
+            max_temp REAL NOT NULL,
+            sensor_key_hash TEXT NOT NULL UNIQUE,
+            created_at DATETIME NOT NULL,
+            CHECK (min_temp < max_temp)
+        );`,
+		`CREATE TABLE TemperatureReadings (
+            reading_id INTEGER PRIMARY KEY,
+            unit_id INTEGER NOT NULL,
+            temperature REAL NOT NULL,
+            recorded_at DATETIME NOT NULL,
+            received_at DATETIME NOT NULL,
+            FOREIGN KEY (unit_id) REFERENCES StorageUnits(unit_id)
+        );`,
+		`CREATE INDEX idx_temperature_readings_unit ON TemperatureReadings (unit_id, recorded_at);`,
+		`CREATE TABLE TemperatureExcursions (
+            excursion_id INTEGER PRIMARY KEY,
+            unit_id INTEGER NOT NULL,
+            started_at DATETIME NOT NULL,
+            ended_at DATETIME,
+            lowest_temp REAL NOT NULL,
+            highest_temp REAL NOT NULL,
+            min_temp REAL NOT NULL,
+            max_temp REAL NOT NULL,
+            acknowledged_by INTEGER,
+            acknowledged_at DATETIME,
+            notes TEXT,
+            FOREIGN KEY (unit_id) REFERENCES StorageUnits(unit_id),
+            FOREIGN KEY (acknowledged_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE UNIQUE INDEX idx_temperature_excursions_open ON TemperatureExcursions (unit_id) WHERE ended_at IS NULL;`,
+		`CREATE TABLE VaccineBatches (
+            batch_id INTEGER PRIMARY KEY,
+            unit_id INTEGER NOT NULL,
+            vaccine_name TEXT NOT NULL,
+            lot_number TEXT NOT NULL,
+            quantity INTEGER NOT NULL CHECK (quantity >= 0),
+            expiry_date DATE NOT NULL,
+            quarantined BOOLEAN NOT NULL DEFAULT FALSE,
+            created_at DATETIME NOT NULL,
+            FOREIGN KEY (unit_id) REFERENCES StorageUnits(unit_id)
+        );`,
+		`CREATE INDEX idx_vaccine_batches_unit ON VaccineBatches (unit_id);`,
+		`CREATE TABLE ExcursionBatches (
+            excursion_id INTEGER NOT NULL,
+            batch_id INTEGER NOT NULL,
+            PRIMARY KEY (excursion_id, batch_id),
+            FOREIGN KEY (excursion_id) REFERENCES TemperatureExcursions(excursion_id),
+            FOREIGN KEY (batch_id) REFERENCES VaccineBatches(batch_id)
+        );`,
+	)},
+	{6, "create insurance pre-authorization and claims", execAll(
+		`CREATE TABLE PreAuthRequirements (
+            requirement_id INTEGER PRIMARY KEY,
+            item_type TEXT NOT NULL CHECK (item_type IN ('procedure', 'medication')),
+            code TEXT NOT NULL COLLATE NOCASE,
+            payer TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+            description TEXT,
+            created_at DATETIME NOT NULL,
+            UNIQUE (item_type, code, payer)
+        );`,
+		`CREATE TABLE PreAuthRequests (
+            preauth_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            item_type TEXT NOT NULL CHECK (item_type IN ('procedure', 'medication')),
+            code TEXT NOT NULL COLLATE NOCASE,
+            payer TEXT NOT NULL COLLATE NOCASE,
+            justification TEXT NOT NULL,
+            status TEXT NOT NULL CHECK (status IN ('pending', 'submitted', 'approved', 'denied')),
+            authorization_number TEXT,
+            payer_reference TEXT,
+            requested_by INTEGER NOT NULL,
+            requested_at DATETIME NOT NULL,
+            submitted_at DATETIME,
+            decided_by INTEGER,
+            decided_at DATETIME,
+            decision_notes TEXT,
+            CHECK (status != 'approved' OR authorization_number IS NOT NULL),
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (requested_by) REFERENCES Users(user_id),
+            FOREIGN KEY (decided_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_preauth_requests_patient ON PreAuthRequests (patient_id, item_type, code);`,
+		`CREATE TABLE Claims (
+            claim_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            payer TEXT NOT NULL COLLATE NOCASE,
+            status TEXT NOT NULL CHECK (status IN ('draft', 'submitted')),
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            submitted_by INTEGER,
+            submitted_at DATETIME,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (created_by) REFERENCES Users(user_id),
+            FOREIGN KEY (submitted_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE TABLE ClaimItems (
+            item_id INTEGER PRIMARY KEY,
+            claim_id INTEGER NOT NULL,
+            item_type TEXT NOT NULL CHECK (item_type IN ('procedure', 'medication')),
+            code TEXT NOT NULL COLLATE NOCASE,
+            description TEXT,
+            amount_cents INTEGER NOT NULL CHECK (amount_cents >= 0),
+            preauth_id INTEGER,
+            FOREIGN KEY (claim_id) REFERENCES Claims(claim_id),
+            FOREIGN KEY (preauth_id) REFERENCES PreAuthRequests(preauth_id)
+        );`,
+		`CREATE INDEX idx_claim_items_claim ON ClaimItems (claim_id);`,
+	)},
+	{7, "create patient documents", execAll(
+		`CREATE TABLE Documents (
+            document_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            record_id INTEGER,
+            filename TEXT NOT NULL,
+            content_type TEXT NOT NULL,
+            size_bytes INTEGER NOT NULL,
+            sha256 TEXT NOT NULL,
+            description TEXT,
+            storage_key TEXT NOT NULL UNIQUE,
+            uploaded_by INTEGER NOT NULL,
+            uploaded_at DATETIME NOT NULL,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (record_id) REFERENCES MedicalRecords(record_id),
+            FOREIGN KEY (uploaded_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_documents_patient ON Documents (patient_id);`,
+		`CREATE INDEX idx_documents_record ON Documents (record_id);`,
+	)},
+	{8, "add housekeeping role and tasks", func(tx *sql.Tx) error {
+		if err := rebuildUsersRoleCheck(tx, []string{"Admin", "Doctor", "Nurse", "Pharmacist", "LabTechnician", "Housekeeping"}); err != nil {
+			return err
+		}
+		return execAll(
+			`CREATE TABLE HousekeepingTasks (
+            task_id INTEGER PRIMARY KEY,
+            bed_id INTEGER NOT NULL,
+            admission_id INTEGER,
+            reason TEXT NOT NULL CHECK(reason IN ('discharge', 'transfer')),
+            status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'in_progress', 'completed')),
+            vacated_at DATETIME NOT NULL,
+            started_at DATETIME,
+            started_by INTEGER,
+            completed_at DATETIME,
+            completed_by INTEGER,
+            notes TEXT,
+            FOREIGN KEY (bed_id) REFERENCES Beds(bed_id),
+            FOREIGN KEY (admission_id) REFERENCES Admissions(admission_id),
+            FOREIGN KEY (started_by) REFERENCES Users(user_id),
+            FOREIGN KEY (completed_by) REFERENCES Users(user_id)
+        );`,
+			// A bed has at most one cleaning outstanding
+			`CREATE UNIQUE INDEX idx_housekeeping_open_bed ON HousekeepingTasks (bed_id) WHERE status <> 'completed';`,
+			`CREATE INDEX idx_housekeeping_completed ON HousekeepingTasks (completed_at);`,
+		)(tx)
+	}},
+	{9, "record patient registration time", execAll(
+		`ALTER TABLE Patients ADD COLUMN registered_at DATETIME;`,
+		// Patients created before this migration take the time of their creation event, when there is one
+		`UPDATE Patients SET registered_at = (
+            SELECT MIN(occurred_at) FROM ClinicalEvents
+            WHERE entity_type = 'patient' AND entity_id = Patients.patient_id AND event_type = 'patient_created'
+        );`,
+		`CREATE INDEX idx_patients_registered ON Patients (registered_at);`,
+	)},
+	{10, "create appointments and duty roster", execAll(
+		`CREATE TABLE DoctorSpecialties (
+            doctor_id INTEGER NOT NULL,
+            specialty TEXT NOT NULL COLLATE NOCASE,
+            PRIMARY KEY (doctor_id, specialty),
+            FOREIGN KEY (doctor_id) REFERENCES Users(user_id)
+        );`,
+		`CREATE TABLE DutyShifts (
+            shift_id INTEGER PRIMARY KEY,
+            doctor_id INTEGER NOT NULL,
+            starts_at DATETIME NOT NULL,
+            ends_at DATETIME NOT NULL,
+            created_by INTEGER NOT NULL,
+            CHECK (ends_at > starts_at),
+            FOREIGN KEY (doctor_id) REFERENCES Users(user_id),
+            FOREIGN KEY (created_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_duty_shifts_doctor ON DutyShifts (doctor_id, starts_at);`,
+		`CREATE TABLE Appointments (
+            appointment_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            doctor_id INTEGER NOT NULL,
+            specialty TEXT,
+            starts_at DATETIME NOT NULL,
+            ends_at DATETIME NOT NULL,
+            reason TEXT,
+            status TEXT NOT NULL DEFAULT 'scheduled' CHECK(status IN ('scheduled', 'cancelled', 'completed')),
+            booked_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            CHECK (ends_at > starts_at),
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (doctor_id) REFERENCES Users(user_id),
+            FOREIGN KEY (booked_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_appointments_doctor ON Appointments (doctor_id, starts_at);`,
+		`CREATE INDEX idx_appointments_patient ON Appointments (patient_id, starts_at);`,
+	)},
+	{11, "create notification queue and prescription ready status", execAll(
+		`CREATE TABLE Notifications (
+            notification_id INTEGER PRIMARY KEY,
+            kind TEXT NOT NULL,
+            channel TEXT NOT NULL CHECK(channel IN ('email', 'sms', 'webhook')),
+            recipient TEXT NOT NULL,
+            subject TEXT,
+            body TEXT NOT NULL,
+            entity_type TEXT,
+            entity_id INTEGER,
+            status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'sending', 'sent', 'failed', 'cancelled')),
+            attempts INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at DATETIME NOT NULL,
+            last_error TEXT,
+            created_at DATETIME NOT NULL,
+            sent_at DATETIME
+        );`,
+		`CREATE INDEX idx_notifications_due ON Notifications (status, next_attempt_at);`,
+		`CREATE INDEX idx_notifications_entity ON Notifications (entity_type, entity_id);`,
+		`ALTER TABLE Prescriptions ADD COLUMN ready_at DATETIME;`,
+		`ALTER TABLE Prescriptions ADD COLUMN ready_by INTEGER REFERENCES Users(user_id);`,
+	)},
+	{12, "create patient flags", execAll(
+		`CREATE TABLE PatientFlagTypes (
+            code TEXT PRIMARY KEY,
+            label TEXT NOT NULL,
+            description TEXT,
+            visible_roles TEXT NOT NULL,
+            active BOOLEAN NOT NULL DEFAULT TRUE
+        );`,
+		`INSERT INTO PatientFlagTypes (code, label, description, visible_roles) VALUES
+            ('fall_risk', 'Fall risk', 'Needs assistance when mobilising', 'Doctor,Nurse,Pharmacist,LabTechnician,Housekeeping'),
+            ('violence_risk', 'Violence risk', 'History of violent or aggressive behaviour', 'Doctor,Nurse,Pharmacist,LabTechnician,Housekeeping'),
+            ('safeguarding', 'Safeguarding concern', 'Open safeguarding concern; details are with the safeguarding lead', 'Doctor,Nurse'),
+            ('interpreter_needed', 'Interpreter needed', 'Book an interpreter for consultations', 'Doctor,Nurse,Pharmacist,LabTechnician');`,
+		`CREATE TABLE PatientFlags (
+            flag_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            flag_type TEXT NOT NULL,
+            note TEXT,
+            added_by INTEGER NOT NULL,
+            added_at DATETIME NOT NULL,
+            removed_by INTEGER,
+            removed_at DATETIME,
+            removal_reason TEXT,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (flag_type) REFERENCES PatientFlagTypes(code),
+            FOREIGN KEY (added_by) REFERENCES Users(user_id),
+            FOREIGN KEY (removed_by) REFERENCES Users(user_id)
+        );`,
+		// A flag type is raised at most once at a time per patient
+		`CREATE UNIQUE INDEX idx_patient_flags_active ON PatientFlags (patient_id, flag_type) WHERE removed_at IS NULL;`,
+	)},
+	{13, "create interpreter roster and bookings", execAll(
+		`ALTER TABLE Patients ADD COLUMN preferred_language TEXT;`,
+		`ALTER TABLE Patients ADD COLUMN interpreter_required BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`CREATE TABLE Interpreters (
+            interpreter_id INTEGER PRIMARY KEY,
+            full_name TEXT NOT NULL,
+            languages TEXT NOT NULL,
+            contact TEXT,
+            active BOOLEAN NOT NULL DEFAULT TRUE
+        );`,
+		`CREATE TABLE InterpreterBookings (
+            booking_id INTEGER PRIMARY KEY,
+            appointment_id INTEGER NOT NULL UNIQUE,
+            language TEXT NOT NULL,
+            kind TEXT NOT NULL CHECK(kind IN ('internal', 'external')),
+            interpreter_id INTEGER,
+            status TEXT NOT NULL CHECK(status IN ('reserved', 'requested', 'confirmed', 'cancelled')),
+            external_reference TEXT,
+            created_at DATETIME NOT NULL,
+            confirmed_at DATETIME,
+            FOREIGN KEY (appointment_id) REFERENCES Appointments(appointment_id),
+            FOREIGN KEY (interpreter_id) REFERENCES Interpreters(interpreter_id)
+        );`,
+		`CREATE INDEX idx_interpreter_bookings_interpreter ON InterpreterBookings (interpreter_id, status);`,
+	)},
+	{14, "add coder role and encounter coding", func(tx *sql.Tx) error {
+		if err := rebuildUsersRoleCheck(tx, []string{"Admin", "Doctor", "Nurse", "Pharmacist", "LabTechnician", "Housekeeping", "Coder"}); err != nil {
+			return err
+		}
+		return execAll(
+			`CREATE TABLE EncounterCodings (
+            encounter_type TEXT NOT NULL CHECK(encounter_type IN ('outpatient', 'inpatient')),
+            encounter_id INTEGER NOT NULL,
+            status TEXT NOT NULL CHECK(status IN ('queried', 'answered', 'coded')),
+            diagnosis_codes TEXT,
+            procedure_codes TEXT,
+            coded_by INTEGER,
+            coded_at DATETIME,
+            query TEXT,
+            queried_by INTEGER,
+            queried_at DATETIME,
+            doctor_response TEXT,
+            responded_at DATETIME,
+            PRIMARY KEY (encounter_type, encounter_id),
+            FOREIGN KEY (coded_by) REFERENCES Users(user_id),
+            FOREIGN KEY (queried_by) REFERENCES Users(user_id)
+        );`,
+			`ALTER TABLE Claims ADD COLUMN encounter_type TEXT CHECK(encounter_type IN ('outpatient', 'inpatient'));`,
+			`ALTER TABLE Claims ADD COLUMN encounter_id INTEGER;`,
+		)(tx)
+	}},
+	{15, "create 2FA reset tokens", execAll(
+		`CREATE TABLE TwoFAResets (
+            token_hash TEXT PRIMARY KEY,
+            user_id INTEGER NOT NULL,
+            issued_by INTEGER NOT NULL,
+            issued_at DATETIME NOT NULL,
+            expires_at DATETIME NOT NULL,
+            redeemed_at DATETIME,
+            FOREIGN KEY (user_id) REFERENCES Users(user_id),
+            FOREIGN KEY (issued_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_twofa_resets_user ON TwoFAResets (user_id);`,
+	)},
+	{16, "hash 2FA backup codes", hashBackupCodes},
+	{17, "normalize timestamps to UTC", normalizeTimestamps},
+	{18, "create chunked exports", execAll(
+		`CREATE TABLE Exports (
+            export_id INTEGER PRIMARY KEY,
+            kind TEXT NOT NULL,
+            status TEXT NOT NULL CHECK(status IN ('running', 'completed', 'failed')),
+            error TEXT,
+            requested_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            completed_at DATETIME,
+            FOREIGN KEY (requested_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE TABLE ExportChunks (
+            export_id INTEGER NOT NULL,
+            chunk_index INTEGER NOT NULL,
+            rows INTEGER NOT NULL,
+            bytes INTEGER NOT NULL,
+            sha256 TEXT NOT NULL,
+            PRIMARY KEY (export_id, chunk_index),
+            FOREIGN KEY (export_id) REFERENCES Exports(export_id)
+        );`,
+	)},
+	{19, "track merged duplicate patients", execAll(
+		`ALTER TABLE Patients ADD COLUMN merged_into INTEGER REFERENCES Patients(patient_id);`,
+		`ALTER TABLE Patients ADD COLUMN merged_at DATETIME;`,
+	)},
+	{20, "mark synthetic probe patients", execAll(
+		`ALTER TABLE Patients ADD COLUMN synthetic BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`CREATE INDEX idx_patients_synthetic ON Patients (registered_at) WHERE synthetic;`,
+	)},
+	{21, "create prescription refill requests", execAll(
+		`ALTER TABLE Prescriptions ADD COLUMN refill_of INTEGER REFERENCES Prescriptions(prescription_id);`,
+		`ALTER TABLE Prescriptions ADD COLUMN refill_count INTEGER NOT NULL DEFAULT 0;`,
+		`CREATE TABLE RefillRequests (
+            refill_request_id INTEGER PRIMARY KEY,
+            prescription_id INTEGER NOT NULL,
+            patient_id INTEGER NOT NULL,
+            source TEXT NOT NULL,
+            notes TEXT,
+            status TEXT NOT NULL,
+            requested_by INTEGER NOT NULL,
+            requested_at DATETIME NOT NULL,
+            decided_by INTEGER,
+            decided_at DATETIME,
+            decision_notes TEXT,
+            refill_prescription_id INTEGER,
+            FOREIGN KEY (prescription_id) REFERENCES Prescriptions(prescription_id),
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (requested_by) REFERENCES Users(user_id),
+            FOREIGN KEY (decided_by) REFERENCES Users(user_id),
+            FOREIGN KEY (refill_prescription_id) REFERENCES Prescriptions(prescription_id)
+        );`,
+		`CREATE UNIQUE INDEX idx_refill_requests_pending ON RefillRequests (prescription_id) WHERE status = 'pending';`,
+		`CREATE INDEX idx_refill_requests_status ON RefillRequests (status, requested_at);`,
+	)},
+	{22, "create doctor time off", execAll(
+		`CREATE TABLE DoctorTimeOff (
+            time_off_id INTEGER PRIMARY KEY,
+            doctor_id INTEGER NOT NULL,
+            starts_at DATETIME NOT NULL,
+            ends_at DATETIME NOT NULL,
+            reason TEXT,
+            created_by INTEGER NOT NULL,
+            CHECK (ends_at > starts_at),
+            FOREIGN KEY (doctor_id) REFERENCES Users(user_id),
+            FOREIGN KEY (created_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_doctor_time_off_doctor ON DoctorTimeOff (doctor_id, starts_at);`,
+	)},
+	{23, "create ICD-10 codes and medical record diagnosis codes", execAll(
+		`CREATE TABLE ICD10Codes (
+            code TEXT PRIMARY KEY,
+            description TEXT NOT NULL
+        );`,
+		`CREATE TABLE MedicalRecordDiagnosisCodes (
+            record_id INTEGER NOT NULL,
+            code TEXT NOT NULL,
+            position INTEGER NOT NULL,
+            PRIMARY KEY (record_id, code),
+            FOREIGN KEY (record_id) REFERENCES MedicalRecords(record_id),
+            FOREIGN KEY (code) REFERENCES ICD10Codes(code)
+        );`,
+		`CREATE INDEX idx_record_diagnosis_codes_code ON MedicalRecordDiagnosisCodes (code);`,
+	)},
+	{24, "create break-glass access grants", execAll(
+		`CREATE TABLE BreakGlassAccess (
+            access_id INTEGER PRIMARY KEY,
+            user_id INTEGER NOT NULL,
+            patient_id INTEGER NOT NULL,
+            reason TEXT NOT NULL,
+            granted_at DATETIME NOT NULL,
+            expires_at DATETIME NOT NULL,
+            FOREIGN KEY (user_id) REFERENCES Users(user_id),
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id)
+        );`,
+		`CREATE INDEX idx_break_glass_user_patient ON BreakGlassAccess (user_id, patient_id, expires_at);`,
+		`CREATE INDEX idx_break_glass_granted ON BreakGlassAccess (granted_at);`,
+	)},
+	{25, "add staff notification preferences", execAll(
+		`ALTER TABLE Users ADD COLUMN notify_channel TEXT NOT NULL DEFAULT 'none';`,
+		`ALTER TABLE Users ADD COLUMN notify_email TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE Users ADD COLUMN notify_phone TEXT NOT NULL DEFAULT '';`,
+	)},
+	{26, "create the medication catalog and link prescriptions to it", func(tx *sql.Tx) error {
+		err := execAll(
+			`CREATE TABLE Medications (
+            medication_id INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            form TEXT NOT NULL,
+            strength TEXT NOT NULL,
+            route TEXT NOT NULL
+        );`,
+			`CREATE UNIQUE INDEX idx_medications_entry ON Medications (lower(name), form, strength, route);`,
+			`ALTER TABLE Prescriptions ADD COLUMN medication_id INTEGER REFERENCES Medications(medication_id);`,
+		)(tx)
+		if err != nil {
+			return err
+		}
+		if err := loadStarterMedications(tx); err != nil {
+			return err
+		}
+		return linkPrescriptionMedications(tx)
+	}},
+	{27, "add medication drug classes and scheduled reports", execAll(
+		`ALTER TABLE Medications ADD COLUMN drug_class TEXT;`,
+		`UPDATE Medications SET drug_class = 'Antibiotic' WHERE lower(name) IN ('amoxicillin', 'azithromycin', 'ceftriaxone', 'cefalexin', 'ciprofloxacin', 'cotrimoxazole', 'doxycycline', 'gentamicin', 'metronidazole', 'nitrofurantoin');`,
+		`UPDATE Medications SET drug_class = 'Antimalarial' WHERE lower(name) IN ('artemether-lumefantrine', 'artesunate');`,
+		`UPDATE Medications SET drug_class = 'Analgesic' WHERE lower(name) IN ('paracetamol', 'ibuprofen', 'diclofenac', 'morphine');`,
+		`UPDATE Medications SET drug_class = 'Antithrombotic' WHERE lower(name) IN ('aspirin', 'warfarin');`,
+		`UPDATE Medications SET drug_class = 'Antihypertensive' WHERE lower(name) IN ('amlodipine', 'enalapril', 'losartan', 'nifedipine');`,
+		`UPDATE Medications SET drug_class = 'Diuretic' WHERE lower(name) IN ('furosemide', 'hydrochlorothiazide');`,
+		`UPDATE Medications SET drug_class = 'Antidiabetic' WHERE lower(name) IN ('metformin', 'glibenclamide', 'insulin glargine');`,
+		`UPDATE Medications SET drug_class = 'Lipid-lowering' WHERE lower(name) IN ('atorvastatin');`,
+		`UPDATE Medications SET drug_class = 'Bronchodilator' WHERE lower(name) IN ('salbutamol');`,
+		`UPDATE Medications SET drug_class = 'Antifungal' WHERE lower(name) IN ('fluconazole');`,
+		`UPDATE Medications SET drug_class = 'Acid suppressant' WHERE lower(name) IN ('omeprazole');`,
+		`UPDATE Medications SET drug_class = 'Corticosteroid' WHERE lower(name) IN ('prednisolone');`,
+		`UPDATE Medications SET drug_class = 'Supplement' WHERE lower(name) IN ('ferrous sulfate', 'folic acid', 'zinc sulfate', 'oral rehydration salts');`,
+		`CREATE TABLE ReportSchedules (
+            schedule_id INTEGER PRIMARY KEY,
+            report TEXT NOT NULL,
+            frequency TEXT NOT NULL CHECK(frequency IN ('daily', 'weekly')),
+            recipient TEXT NOT NULL,
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            next_run_at DATETIME NOT NULL,
+            last_run_at DATETIME,
+            FOREIGN KEY (created_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_report_schedules_next_run ON ReportSchedules (next_run_at);`,
+	)},
+	{28, "report foreign key violations", reportForeignKeyViolations},
+	{29, "rebuild role views", dropRoleViews},
+	{30, "add patient portal accounts", func(tx *sql.Tx) error {
+		// Renaming the rebuilt Users fails while a view still references the
+		// dropped one
+		if err := dropRoleViews(tx); err != nil {
+			return err
+		}
+		if err := rebuildUsersRoleCheck(tx, []string{"Admin", "Doctor", "Nurse", "Pharmacist", "LabTechnician", "Housekeeping", "Coder", "Patient"}); err != nil {
+			return err
+		}
+		return execAll(
+			`ALTER TABLE Users ADD COLUMN patient_id INTEGER REFERENCES Patients(patient_id);`,
+			`CREATE UNIQUE INDEX idx_users_patient ON Users (patient_id) WHERE patient_id IS NOT NULL;`,
+		)(tx)
+	}},
+	{31, "chain audit log entries", chainAuditLogs},
+	{32, "link prescriptions to their visit", execAll(
+		`ALTER TABLE Prescriptions ADD COLUMN record_id INTEGER REFERENCES MedicalRecords(record_id);`,
+		`CREATE INDEX idx_prescriptions_record ON Prescriptions (record_id);`,
+	)},
+	{33, "deactivate user accounts", execAll(
+		`ALTER TABLE Users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;`,
+	)},
+	{34, "record login events", execAll(
+		`CREATE TABLE LoginEvents (
+            login_event_id INTEGER PRIMARY KEY,
+            user_id INTEGER,
+            username TEXT NOT NULL,
+            method TEXT NOT NULL CHECK(method IN ('basic', 'session', '2fa')),
+            success BOOLEAN NOT NULL,
+            failure_reason TEXT,
+            ip_address TEXT NOT NULL,
+            user_agent TEXT NOT NULL,
+            created_at DATETIME NOT NULL,
+            FOREIGN KEY (user_id) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_login_events_user ON LoginEvents (user_id, created_at);`,
+		`ALTER TABLE Users ADD COLUMN last_login_at DATETIME;`,
+	)},
+	{35, "create referrals", execAll(
+		`CREATE TABLE Referrals (
+            referral_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            from_doctor_id INTEGER NOT NULL,
+            to_doctor_id INTEGER,
+            specialty TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+            reason TEXT NOT NULL,
+            urgency TEXT NOT NULL CHECK(urgency IN ('routine', 'urgent', 'emergency')),
+            status TEXT NOT NULL CHECK(status IN ('pending', 'accepted', 'declined')),
+            created_at DATETIME NOT NULL,
+            decided_at DATETIME,
+            decision_notes TEXT,
+            appointment_id INTEGER,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (from_doctor_id) REFERENCES Users(user_id),
+            FOREIGN KEY (to_doctor_id) REFERENCES Users(user_id),
+            FOREIGN KEY (appointment_id) REFERENCES Appointments(appointment_id)
+        );`,
+		`CREATE INDEX idx_referrals_to_doctor ON Referrals (to_doctor_id, status);`,
+		`CREATE INDEX idx_referrals_from_doctor ON Referrals (from_doctor_id, status);`,
+		`CREATE INDEX idx_referrals_specialty ON Referrals (specialty, status);`,
+	)},
+	{36, "move patient allergies to their own table", moveAllergies},
+	{37, "create departments", execAll(
+		`CREATE TABLE Departments (
+            code TEXT PRIMARY KEY COLLATE NOCASE,
+            name TEXT NOT NULL,
+            description TEXT,
+            active BOOLEAN NOT NULL DEFAULT TRUE
+        );`,
+		`CREATE TABLE UserDepartments (
+            user_id INTEGER NOT NULL,
+            department_code TEXT NOT NULL COLLATE NOCASE,
+            assigned_at DATETIME NOT NULL,
+            PRIMARY KEY (user_id, department_code),
+            FOREIGN KEY (user_id) REFERENCES Users(user_id),
+            FOREIGN KEY (department_code) REFERENCES Departments(code)
+        );`,
+		`CREATE INDEX idx_user_departments_department ON UserDepartments (department_code);`,
+	)},
+	{38, "share login state between servers", execAll(
+		`CREATE TABLE RevokedSessions (
+            token_id TEXT PRIMARY KEY,
+            expires_at DATETIME NOT NULL
+        );`,
+		`CREATE INDEX idx_revoked_sessions_expiry ON RevokedSessions (expires_at);`,
+		`ALTER TABLE Users ADD COLUMN sessions_revoked_at DATETIME;`,
+		`CREATE TABLE WebAuthnCeremonies (
+            ceremony_key TEXT PRIMARY KEY,
+            session_data TEXT NOT NULL,
+            expires_at DATETIME NOT NULL
+        );`,
+		`CREATE TABLE DownloadTokens (
+            token_hash TEXT PRIMARY KEY,
+            kind TEXT NOT NULL,
+            resource_id INTEGER NOT NULL,
+            user_id INTEGER NOT NULL,
+            session_id TEXT NOT NULL DEFAULT '',
+            expires_at DATETIME NOT NULL,
+            FOREIGN KEY (user_id) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_download_tokens_expiry ON DownloadTokens (expires_at);`,
+	)},
+	{39, "record patient demographic changes", execAll(
+		`CREATE TABLE PatientChanges (
+            change_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            field TEXT NOT NULL,
+            old_value TEXT NOT NULL,
+            new_value TEXT NOT NULL,
+            changed_by INTEGER NOT NULL,
+            changed_at DATETIME NOT NULL,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (changed_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_patient_changes_patient ON PatientChanges (patient_id, changed_at);`,
+	)},
+	{40, "move doctor notes to their own table", moveDoctorNotes},
+	{41, "create discharge summaries", execAll(
+		`CREATE TABLE DischargeSummaries (
+            summary_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            admission_id INTEGER NOT NULL,
+            generated_by INTEGER NOT NULL,
+            generated_at DATETIME NOT NULL,
+            content TEXT NOT NULL,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (admission_id) REFERENCES Admissions(admission_id),
+            FOREIGN KEY (generated_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_discharge_summaries_patient ON DischargeSummaries (patient_id, generated_at);`,
+	)},
+	{42, "schedule appointment reminders", execAll(
+		`CREATE TABLE ReminderPreferences (
+            patient_id INTEGER PRIMARY KEY,
+            day_before BOOLEAN NOT NULL,
+            hour_before BOOLEAN NOT NULL,
+            updated_by INTEGER NOT NULL,
+            updated_at DATETIME NOT NULL,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (updated_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE TABLE AppointmentReminders (
+            appointment_id INTEGER NOT NULL,
+            reminder TEXT NOT NULL,
+            notification_id INTEGER,
+            queued_at DATETIME NOT NULL,
+            PRIMARY KEY (appointment_id, reminder),
+            FOREIGN KEY (appointment_id) REFERENCES Appointments(appointment_id),
+            FOREIGN KEY (notification_id) REFERENCES Notifications(notification_id)
+        );`,
+		// Reminders were queued at booking until now; they count as the
+		// day-before reminder so the scheduler doesn't send it again
+		`INSERT INTO AppointmentReminders (appointment_id, reminder, notification_id, queued_at)
+            SELECT entity_id, '24h', MAX(notification_id), MAX(created_at) FROM Notifications
+            WHERE kind = 'appointment_reminder' AND entity_type = 'appointment'
+            GROUP BY entity_id;`,
+	)},
+	{43, "create walk-in queues", execAll(
+		`CREATE TABLE QueueEntries (
+            entry_id INTEGER PRIMARY KEY,
+            department_code TEXT NOT NULL COLLATE NOCASE,
+            queue_date TEXT NOT NULL,
+            ticket INTEGER NOT NULL,
+            patient_id INTEGER NOT NULL,
+            priority TEXT NOT NULL CHECK(priority IN ('normal', 'urgent')),
+            reason TEXT,
+            status TEXT NOT NULL CHECK(status IN ('waiting', 'called', 'completed', 'left')),
+            room TEXT,
+            checked_in_by INTEGER NOT NULL,
+            checked_in_at DATETIME NOT NULL,
+            called_by INTEGER,
+            called_at DATETIME,
+            finished_at DATETIME,
+            UNIQUE (department_code, queue_date, ticket),
+            FOREIGN KEY (department_code) REFERENCES Departments(code),
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (checked_in_by) REFERENCES Users(user_id),
+            FOREIGN KEY (called_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_queue_entries_department ON QueueEntries (department_code, queue_date, status);`,
+	)},
+	{44, "store dates and timestamps as RFC 3339", normalizeStoredTimes},
+	{45, "create API keys", execAll(
+		`CREATE TABLE ApiKeys (
+            key_id INTEGER PRIMARY KEY,
+            user_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            prefix TEXT NOT NULL UNIQUE,
+            key_hash TEXT NOT NULL UNIQUE,
+            scopes TEXT NOT NULL,
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            expires_at DATETIME,
+            last_used_at DATETIME,
+            revoked_at DATETIME,
+            revoked_by INTEGER,
+            replaced_by INTEGER,
+            FOREIGN KEY (user_id) REFERENCES Users(user_id),
+            FOREIGN KEY (created_by) REFERENCES Users(user_id),
+            FOREIGN KEY (revoked_by) REFERENCES Users(user_id),
+            FOREIGN KEY (replaced_by) REFERENCES ApiKeys(key_id)
+        );`,
+		`CREATE INDEX idx_api_keys_user ON ApiKeys (user_id);`,
+	)},
+	{46, "create webhooks", execAll(
+		`CREATE TABLE Webhooks (
+            webhook_id INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            url TEXT NOT NULL,
+            secret TEXT NOT NULL,
+            event_types TEXT NOT NULL,
+            active BOOLEAN NOT NULL,
+            last_event_id INTEGER NOT NULL,
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            updated_at DATETIME NOT NULL,
+            FOREIGN KEY (created_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE TABLE WebhookDeliveries (
+            delivery_id INTEGER PRIMARY KEY,
+            webhook_id INTEGER NOT NULL,
+            event_id INTEGER NOT NULL,
+            event_type TEXT NOT NULL,
+            status TEXT NOT NULL CHECK(status IN ('pending', 'sending', 'delivered', 'failed')),
+            attempts INTEGER NOT NULL,
+            next_attempt_at DATETIME NOT NULL,
+            response_status INTEGER,
+            last_error TEXT,
+            created_at DATETIME NOT NULL,
+            delivered_at DATETIME,
+            UNIQUE (webhook_id, event_id),
+            FOREIGN KEY (webhook_id) REFERENCES Webhooks(webhook_id),
+            FOREIGN KEY (event_id) REFERENCES ClinicalEvents(event_id)
+        );`,
+		`CREATE INDEX idx_webhook_deliveries_due ON WebhookDeliveries (status, next_attempt_at);`,
+	)},
+	{47, "create insurance policies", execAll(
+		`CREATE TABLE InsurancePolicies (
+            policy_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            payer TEXT NOT NULL COLLATE NOCASE,
+            policy_number TEXT NOT NULL,
+            holder_name TEXT,
+            coverage_class TEXT NOT NULL,
+            coverage_percent INTEGER NOT NULL CHECK(coverage_percent BETWEEN 0 AND 100),
+            copay_cents INTEGER NOT NULL CHECK(copay_cents >= 0),
+            valid_from DATE NOT NULL,
+            valid_to DATE,
+            verification_status TEXT NOT NULL CHECK(verification_status IN ('unverified', 'verified', 'rejected')),
+            verified_by INTEGER,
+            verified_at DATETIME,
+            verification_notes TEXT,
+            created_by INTEGER NOT NULL,
+            created_at DATETIME NOT NULL,
+            updated_at DATETIME NOT NULL,
+            UNIQUE (patient_id, payer, policy_number),
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (verified_by) REFERENCES Users(user_id),
+            FOREIGN KEY (created_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_insurance_policies_patient ON InsurancePolicies (patient_id);`,
+		`ALTER TABLE Claims ADD COLUMN policy_id INTEGER REFERENCES InsurancePolicies(policy_id);`,
+	)},
+	{48, "sign prescriptions", func(tx *sql.Tx) error {
+		// Prescriptions written before signatures were required count as
+		// signed by their prescriber, without a hash, so they can still be
+		// dispensed
+		err := execAll(
+			`ALTER TABLE Prescriptions ADD COLUMN signed_by INTEGER REFERENCES Users(user_id);`,
+			`ALTER TABLE Prescriptions ADD COLUMN signed_at DATETIME;`,
+			`ALTER TABLE Prescriptions ADD COLUMN signature_hash TEXT;`,
+		)(tx)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE Prescriptions SET signed_by = doctor_id, signed_at = ?`, time.Now().UTC()); err != nil {
+			return err
+		}
+		return rebuildRoleViews(tx)
+	}},
+	{49, "create record templates", execAll(
+		`CREATE TABLE RecordTemplates (
+            code TEXT PRIMARY KEY,
+            name TEXT NOT NULL,
+            description TEXT,
+            sections TEXT NOT NULL,
+            active BOOLEAN NOT NULL DEFAULT TRUE
+        );`,
+		`INSERT INTO RecordTemplates (code, name, description, sections) VALUES
+            ('annual_physical', 'Annual physical', 'Yearly preventive check-up', '[
+                {"key": "history", "title": "Interval history", "required": true},
+                {"key": "vitals", "title": "Vital signs", "hint": "BP, pulse, temperature, weight, BMI", "required": true},
+                {"key": "examination", "title": "Physical examination", "required": true},
+                {"key": "screening", "title": "Screening and immunizations", "required": false},
+                {"key": "plan", "title": "Assessment and plan", "required": true}]'),
+            ('post_op_follow_up', 'Post-op follow-up', 'Review after a surgical procedure', '[
+                {"key": "procedure", "title": "Procedure", "hint": "What was done and when", "required": true},
+                {"key": "wound", "title": "Wound assessment", "required": true},
+                {"key": "pain", "title": "Pain and medication", "required": false},
+                {"key": "complications", "title": "Complications", "required": false},
+                {"key": "plan", "title": "Plan and next review", "required": true}]');`,
+		`ALTER TABLE MedicalRecords ADD COLUMN template_code TEXT REFERENCES RecordTemplates(code);`,
+		`ALTER TABLE MedicalRecords ADD COLUMN sections TEXT;`,
+	)},
+	{50, "create patient images", execAll(
+		`CREATE TABLE PatientImages (
+            patient_id INTEGER NOT NULL,
+            kind TEXT NOT NULL CHECK (kind IN ('photo', 'id_document')),
+            content_type TEXT NOT NULL,
+            size_bytes INTEGER NOT NULL,
+            width INTEGER NOT NULL,
+            height INTEGER NOT NULL,
+            sha256 TEXT NOT NULL,
+            storage_key TEXT NOT NULL UNIQUE,
+            thumbnail_key TEXT NOT NULL UNIQUE,
+            uploaded_by INTEGER NOT NULL,
+            uploaded_at DATETIME NOT NULL,
+            PRIMARY KEY (patient_id, kind),
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (uploaded_by) REFERENCES Users(user_id)
+        );`,
+	)},
+	{51, "create calendar feeds", execAll(
+		`CREATE TABLE CalendarFeeds (
+            doctor_id INTEGER PRIMARY KEY,
+            generation INTEGER NOT NULL,
+            issued_by INTEGER NOT NULL,
+            issued_at DATETIME NOT NULL,
+            revoked_at DATETIME,
+            FOREIGN KEY (doctor_id) REFERENCES Users(user_id),
+            FOREIGN KEY (issued_by) REFERENCES Users(user_id)
+        );`,
+	)},
+	{52, "keep encrypted fields out of event payloads", scrubEventPayloads},
+}
+
+func runMigrations() error {
+	for _, statement := range dialect.Schema(`CREATE TABLE IF NOT EXISTS SchemaMigrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT NOT NULL,
+            applied_at DATETIME NOT NULL
+        );`) {
+		if _, err := DB.Exec(statement); err != nil {
+			return fmt.Errorf("failed to create SchemaMigrations: %v", err)
+		}
+	}
+
+	var current int
+	if err := DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM SchemaMigrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	// SQLite can't rebuild a table that others reference while foreign keys
+	// are enforced, so migrations run on a connection with them off, which
+	// can only be switched outside a transaction
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if dialect.Name() == SQLite {
+		if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO SchemaMigrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.version, m.name, time.Now()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %d: %s", m.version, m.name)
+	}
+
+	return nil
+}
+
+// SchemaVersion returns the latest migration applied to the database
+func SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM SchemaMigrations`).Scan(&version)
+	return version, err
+}
+
+// LatestSchemaVersion is the migration this build brings the database up to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// reportForeignKeyViolations logs rows written before SQLite enforced
+// foreign keys that reference missing rows. They are left for an operator
+// to repair, since any automatic fix would delete clinical data. PostgreSQL
+// has always enforced them.
+func reportForeignKeyViolations(tx *sql.Tx) error {
+	if dialect.Name() != SQLite {
+		return nil
+	}
+
+	rows, err := tx.Query(`SELECT "table", COUNT(*) FROM pragma_foreign_key_check GROUP BY "table" ORDER BY "table"`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table string
+		var count int
+		if err := rows.Scan(&table, &count); err != nil {
+			return err
+		}
+		log.Printf("Warning: %d rows in %s reference missing rows; see PRAGMA foreign_key_check", count, table)
+	}
+	return rows.Err()
+}
+
+// execAll builds a migration step from SQLite DDL statements, translated
+// for the database in use
+func execAll(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			for _, translated := range dialect.Schema(statement) {
+				if _, err := tx.Exec(translated); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// hashBackupCodes replaces plaintext 2FA backup codes with the sha256 hashes
+// the auth package verifies against
+func hashBackupCodes(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT user_id, two_fa_backup_codes FROM Users WHERE COALESCE(two_fa_backup_codes, '') <> ''`)
+	if err != nil {
+		return err
+	}
+	stored := map[int]string{}
+	for rows.Next() {
+		var userID int
+		var codes string
+		if err := rows.Scan(&userID, &codes); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[userID] = codes
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for userID, codes := range stored {
+		var plaintext []string
+		if err := json.Unmarshal([]byte(codes), &plaintext); err != nil {
+			return fmt.Errorf("user %d: unreadable backup codes: %v", userID, err)
+		}
+		hashes := make([]string, len(plaintext))
+		for i, code := range plaintext {
+			sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+			hashes[i] = "sha256:" + hex.EncodeToString(sum[:])
+		}
+		hashed, err := json.Marshal(hashes)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE Users SET two_fa_backup_codes = ? WHERE user_id = ?`, string(hashed), userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	usersTable = regexp.MustCompile(`^CREATE TABLE "?Users"?`)
+	roleCheck  = regexp.MustCompile(`CHECK\s*\(\s*role IN \([^)]*\)\s*\)`)
+)
+
+// rebuildUsersRoleCheck recreates Users with a new role CHECK constraint,
+// since SQLite can't alter constraints in place. The copy keeps whatever
+// columns Users has by then. PostgreSQL replaces the constraint instead.
+func rebuildUsersRoleCheck(tx *sql.Tx, roles []string) error {
+	quoted := make([]string, len(roles))
+	for i, role := range roles {
+		quoted[i] = "'" + role + "'"
+	}
+
+	if dialect.Name() == Postgres {
+		_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE Users DROP CONSTRAINT IF EXISTS users_role_check,
+            ADD CONSTRAINT users_role_check CHECK (role IN (%s));`, strings.Join(quoted, ", ")))
+		return err
+	}
+
+	var schema string
+	if err := tx.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'Users'`).Scan(&schema); err != nil {
+		return err
+	}
+	if !usersTable.MatchString(schema) || !roleCheck.MatchString(schema) {
+		return fmt.Errorf("unexpected Users schema: %s", schema)
+	}
+	schema = usersTable.ReplaceAllString(schema, "CREATE TABLE Users_new")
+	schema = roleCheck.ReplaceAllString(schema, fmt.Sprintf("CHECK(role IN (%s))", strings.Join(quoted, ", ")))
+
+	for _, statement := range []string{
+		schema,
+		`INSERT INTO Users_new SELECT * FROM Users`,
+		`DROP TABLE Users`,
+		`ALTER TABLE Users_new RENAME TO Users`,
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chainAuditLogs links the existing audit log entries into a hash chain,
+// oldest first, and then makes the log append-only
+func chainAuditLogs(tx *sql.Tx) error {
+	err := execAll(
+		`ALTER TABLE AuditLogs ADD COLUMN prev_hash TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE AuditLogs ADD COLUMN hash TEXT NOT NULL DEFAULT '';`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT audit_log_id, COALESCE(user_id, 0), action, COALESCE(entity_type, ''), COALESCE(entity_id, 0),
+                  COALESCE(details, ''), created_at
+              FROM AuditLogs ORDER BY audit_log_id`)
+	if err != nil {
+		return err
+	}
+	var entries []models.AuditLog
+	for rows.Next() {
+		var entry models.AuditLog
+		var details string
+		if err := rows.Scan(&entry.AuditLogID, &entry.UserID, &entry.Action, &entry.EntityType, &entry.EntityID, &details, &entry.CreatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		entry.Details = json.RawMessage(details)
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	prevHash := ""
+	for _, entry := range entries {
+		hash := entry.ChainHash(prevHash)
+		if _, err := tx.Exec(`UPDATE AuditLogs SET prev_hash = ?, hash = ? WHERE audit_log_id = ?`, prevHash, hash, entry.AuditLogID); err != nil {
+			return err
+		}
+		prevHash = hash
+	}
+
+	return execAll(
+		`CREATE TRIGGER IF NOT EXISTS audit_logs_no_update BEFORE UPDATE ON AuditLogs
+			BEGIN
+				SELECT RAISE(ABORT, 'AuditLogs is append-only');
+			END;`,
+		`CREATE TRIGGER IF NOT EXISTS audit_logs_no_delete BEFORE DELETE ON AuditLogs
+			BEGIN
+				SELECT RAISE(ABORT, 'AuditLogs is append-only');
+			END;`,
+	)(tx)
+}
+
+// roleViews are the views that limit what each role reads, in the order
+// they are created. They read the current schema, so only the latest
+// migration that changes one rebuilds them; earlier ones that needed them
+// gone just drop them.
+var roleViews = []struct{ name, query string }{
+	// nurse_medical_records_view is a record without its treatment plan and
+	// doctor's notes, for nurses and lab technicians
+	{"nurse_medical_records_view", `SELECT record_id, patient_id, visit_date, diagnosis FROM MedicalRecords`},
+	// pharmacist_prescriptions_view is the dispensing worklist: each
+	// prescription with the patient and prescriber names the pharmacy needs
+	{"pharmacist_prescriptions_view", `SELECT p.prescription_id, p.patient_id, pt.first_name || ' ' || pt.last_name AS patient_name,
+            COALESCE(u.full_name, '') AS prescriber_name, p.prescribed_date, p.medication, p.medication_id, COALESCE(p.dosage, '') AS dosage,
+            COALESCE(p.duration, '') AS duration, COALESCE(p.instructions, '') AS instructions,
+            CASE WHEN p.signed_at IS NULL THEN 'unsigned' WHEN p.ready_at IS NULL THEN 'active' ELSE 'ready' END AS status,
+            p.ready_at, p.refill_count
+        FROM Prescriptions p
+        JOIN Patients pt ON pt.patient_id = p.patient_id
+        LEFT JOIN Users u ON u.user_id = p.doctor_id`},
+}
+
+// rebuildRoleViews drops and recreates the role views, so databases whose
+// views were created against an older schema pick up the current one, then
+// reads each: SQLite only resolves a view's tables when it is queried.
+func rebuildRoleViews(tx *sql.Tx) error {
+	for _, view := range roleViews {
+		if _, err := tx.Exec(`DROP VIEW IF EXISTS ` + view.name); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`CREATE VIEW ` + view.name + ` AS ` + view.query); err != nil {
+			return fmt.Errorf("failed to create %s: %v", view.name, err)
+		}
+		if _, err := tx.Exec(`SELECT * FROM ` + view.name + ` WHERE 1 = 0`); err != nil {
+			return fmt.Errorf("%s is unreadable: %v", view.name, err)
+		}
+	}
+	return nil
+}
+
+// dropRoleViews drops the role views until a later migration rebuilds them
+func dropRoleViews(tx *sql.Tx) error {
+	for _, view := range roleViews {
+		if _, err := tx.Exec(`DROP VIEW IF EXISTS ` + view.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteTimestamp is the layout go-sqlite3 writes time.Time values in
+const sqliteTimestamp = "2006-01-02 15:04:05.999999999-07:00"
+
+// normalizeTimestamps rewrites DATETIME values written with a non-UTC offset,
+// as they were when the server ran in a local zone, to UTC so they compare
+// and sort correctly as text. PostgreSQL stores them as TIMESTAMPTZ, which
+// needs no rewriting.
+func normalizeTimestamps(tx *sql.Tx) error {
+	if dialect.Name() == Postgres {
+		return nil
+	}
+
+	tables, err := queryStrings(tx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		columns, err := queryStrings(tx, `SELECT name FROM pragma_table_info(?) WHERE upper(type) IN ('DATETIME', 'TIMESTAMP')`, table)
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if err := normalizeColumn(tx, table, column); err != nil {
+				return fmt.Errorf("%s.%s: %w", table, column, err)
+			}
+		}
+	}
+	return nil
+}
+
+func normalizeColumn(tx *sql.Tx, table, column string) error {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT rowid, %[1]q FROM %[2]q
+        WHERE typeof(%[1]q) = 'text' AND %[1]q NOT LIKE '%%+00:00' AND (%[1]q LIKE '%%+__:__' OR %[1]q LIKE '%%-__:__')`, column, table))
+	if err != nil {
+		return err
+	}
+	converted := map[int64]string{}
+	for rows.Next() {
+		var rowID int64
+		var value string
+		if err := rows.Scan(&rowID, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		t, err := time.Parse(sqliteTimestamp, strings.Replace(value, "T", " ", 1))
+		if err != nil {
+			continue
+		}
+		converted[rowID] = t.UTC().Format(sqliteTimestamp)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for rowID, value := range converted {
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %q SET %q = ? WHERE rowid = ?`, table, column), value, rowID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyTimestamps are the layouts DATETIME values were stored in before
+// TimestampLayout, tried in order; those without an offset are UTC
+var legacyTimestamps = []string{sqliteTimestamp, time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04", "2006-01-02T15:04", DateLayout}
+
+// normalizeStoredTimes rewrites SQLite's DATE values to YYYY-MM-DD and its
+// DATETIME values to TimestampLayout. Dates written back after being read
+// as timestamps ("1990-01-02T00:00:00Z") keep their day; values that can't
+// be read as either are left as they are. PostgreSQL's DATE and TIMESTAMPTZ
+// columns need no rewriting.
+//
+// The append-only tables' update guards are lifted while their timestamps
+// are rewritten: only the text changes, not the instant, so the audit log's
+// hash chain, computed from the instant, still verifies.
+func normalizeStoredTimes(tx *sql.Tx) error {
+	if dialect.Name() == Postgres {
+		return nil
+	}
+
+	tables, err := queryStrings(tx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := normalizeTableTimes(tx, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeTableTimes(tx *sql.Tx, table string) error {
+	return liftUpdateGuards(tx, table, func() error {
+		dates, err := queryStrings(tx, `SELECT name FROM pragma_table_info(?) WHERE upper(type) = 'DATE'`, table)
+		if err != nil {
+			return err
+		}
+		for _, column := range dates {
+			if err := rewriteColumn(tx, table, column, "????-??-??", storedDate); err != nil {
+				return fmt.Errorf("%s.%s: %w", table, column, err)
+			}
+		}
+
+		timestamps, err := queryStrings(tx, `SELECT name FROM pragma_table_info(?) WHERE upper(type) IN ('DATETIME', 'TIMESTAMP')`, table)
+		if err != nil {
+			return err
+		}
+		for _, column := range timestamps {
+			if err := rewriteColumn(tx, table, column, "????-??-??T??:??:??.?????????Z", storedTimestamp); err != nil {
+				return fmt.Errorf("%s.%s: %w", table, column, err)
+			}
+		}
+		return nil
+	})
+}
+
+// liftUpdateGuards runs rewrite with the append-only table's update guards
+// lifted, for migrations that must correct rows in place. PostgreSQL
+// disables its trigger functions; SQLite's triggers are dropped and
+// recreated.
+func liftUpdateGuards(tx *sql.Tx, table string, rewrite func() error) error {
+	if dialect.Name() == Postgres {
+		if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s DISABLE TRIGGER USER`, table)); err != nil {
+			return err
+		}
+		if err := rewrite(); err != nil {
+			return err
+		}
+		_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ENABLE TRIGGER USER`, table))
+		return err
+	}
+
+	guards, err := queryStrings(tx, `SELECT name FROM sqlite_master
+        WHERE type = 'trigger' AND tbl_name = ? AND sql LIKE '%BEFORE UPDATE%RAISE(ABORT%'`, table)
+	if err != nil {
+		return err
+	}
+	guardSQL := make([]string, len(guards))
+	for i, guard := range guards {
+		if err := tx.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = ?`, guard).Scan(&guardSQL[i]); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TRIGGER %q`, guard)); err != nil {
+			return err
+		}
+	}
+
+	if err := rewrite(); err != nil {
+		return err
+	}
+
+	for _, statement := range guardSQL {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteColumn replaces the column's text values that don't match the
+// stored glob with convert's result, where it has one
+func rewriteColumn(tx *sql.Tx, table, column, stored string, convert func(string) (string, bool)) error {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT rowid, CAST(%[1]q AS TEXT) FROM %[2]q
+        WHERE typeof(%[1]q) = 'text' AND %[1]q <> '' AND NOT (%[1]q GLOB ? AND length(%[1]q) = ?)`, column, table), stored, len(stored))
+	if err != nil {
+		return err
+	}
+	converted := map[int64]string{}
+	for rows.Next() {
+		var rowID int64
+		var value string
+		if err := rows.Scan(&rowID, &value); err != nil {
+			rows.Close()
+			return err
+		}
+		if value, ok := convert(strings.TrimSpace(value)); ok {
+			converted[rowID] = value
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for rowID, value := range converted {
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE %q SET %q = ? WHERE rowid = ?`, table, column), value, rowID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedDate returns the YYYY-MM-DD day a legacy date value starts with
+func storedDate(value string) (string, bool) {
+	if len(value) < len(DateLayout) {
+		return "", false
+	}
+	day, err := time.Parse(DateLayout, value[:len(DateLayout)])
+	if err != nil {
+		return "", false
+	}
+	return day.Format(DateLayout), true
+}
+
+// storedTimestamp returns a legacy timestamp value in TimestampLayout
+func storedTimestamp(value string) (string, bool) {
+	for _, layout := range legacyTimestamps {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(TimestampLayout), true
+		}
+	}
+	return "", false
+}
+
+func queryStrings(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// moveAllergies replaces the free-text Patients.allergies column with the
+// Allergies table, recording each comma-, semicolon- or line-separated
+// entry as an active allergy without a severity. "None" and "NKDA" are
+// dropped, as they say there is nothing to record.
+func moveAllergies(tx *sql.Tx) error {
+	err := execAll(
+		`CREATE TABLE Allergies (
+            allergy_id INTEGER PRIMARY KEY,
+            patient_id INTEGER NOT NULL,
+            substance TEXT NOT NULL,
+            reaction TEXT,
+            severity TEXT NOT NULL DEFAULT '' CHECK(severity IN ('', 'mild', 'moderate', 'severe')),
+            onset_date TEXT,
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            recorded_by INTEGER,
+            recorded_at DATETIME NOT NULL,
+            updated_at DATETIME,
+            FOREIGN KEY (patient_id) REFERENCES Patients(patient_id),
+            FOREIGN KEY (recorded_by) REFERENCES Users(user_id)
+        );`,
+		`CREATE INDEX idx_allergies_patient ON Allergies (patient_id, active);`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT patient_id, allergies FROM Patients WHERE COALESCE(allergies, '') <> ''`)
+	if err != nil {
+		return err
+	}
+	type patientAllergies struct {
+		id    int
+		value string
+	}
+	var patients []patientAllergies
+	for rows.Next() {
+		var p patientAllergies
+		if err := rows.Scan(&p.id, &p.value); err != nil {
+			rows.Close()
+			return err
+		}
+		patients = append(patients, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The column as it was encrypted before this migration
+	column := encryption.Column{Table: "Patients", IDColumn: "patient_id", Name: "allergies"}
+	now := time.Now().UTC()
+	moved := 0
+	for _, p := range patients {
+		text, err := encryption.Open(column, p.id, p.value)
+		if err != nil {
+			return fmt.Errorf("patient %d: %v", p.id, err)
+		}
+		for _, substance := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' || r == '\n' }) {
+			substance = strings.TrimSpace(substance)
+			if substance == "" || strings.EqualFold(substance, "none") || strings.EqualFold(substance, "nkda") {
+				continue
+			}
+			result, err := tx.Exec(`INSERT INTO Allergies (patient_id, substance, recorded_at) VALUES (?, '', ?)`, p.id, now)
+			if err != nil {
+				return err
+			}
+			allergyID, _ := result.LastInsertId()
+			if err := encryption.Store(context.Background(), tx, encryption.AllergySubstance, int(allergyID), substance); err != nil {
+				return err
+			}
+			moved++
+		}
+	}
+	log.Printf("Moved %d allergies of %d patients to the Allergies table", moved, len(patients))
+
+	return execAll(`ALTER TABLE Patients DROP COLUMN allergies;`)(tx)
+}
+
+// moveDoctorNotes turns each medical record's doctor notes into the
+// record's first note, signed by the record's doctor as of the visit, since
+// they were final as written
+func moveDoctorNotes(tx *sql.Tx) error {
+	err := execAll(
+		`CREATE TABLE Notes (
+            note_id INTEGER PRIMARY KEY,
+            record_id INTEGER NOT NULL,
+            author_id INTEGER NOT NULL,
+            body TEXT NOT NULL,
+            addendum_to INTEGER,
+            created_at DATETIME NOT NULL,
+            updated_at DATETIME,
+            signed_at DATETIME,
+            FOREIGN KEY (record_id) REFERENCES MedicalRecords(record_id),
+            FOREIGN KEY (author_id) REFERENCES Users(user_id),
+            FOREIGN KEY (addendum_to) REFERENCES Notes(note_id)
+        );`,
+		`CREATE INDEX idx_notes_record ON Notes (record_id, created_at);`,
+	)(tx)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT record_id, doctor_id, visit_date, doctor_notes FROM MedicalRecords WHERE COALESCE(doctor_notes, '') <> ''`)
+	if err != nil {
+		return err
+	}
+	type recordNotes struct {
+		id, doctorID int
+		visitDate    time.Time
+		value        string
+	}
+	var records []recordNotes
+	for rows.Next() {
+		var r recordNotes
+		if err := rows.Scan(&r.id, &r.doctorID, &r.visitDate, &r.value); err != nil {
+			rows.Close()
+			return err
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The column as it was encrypted before this migration
+	column := encryption.Column{Table: "MedicalRecords", IDColumn: "record_id", Name: "doctor_notes"}
+	for _, r := range records {
+		text, err := encryption.Open(column, r.id, r.value)
+		if err != nil {
+			return fmt.Errorf("medical record %d: %v", r.id, err)
+		}
+		result, err := tx.Exec(`INSERT INTO Notes (record_id, author_id, body, created_at, signed_at) VALUES (?, ?, '', ?, ?)`,
+			r.id, r.doctorID, r.visitDate, r.visitDate)
+		if err != nil {
+			return err
+		}
+		noteID, _ := result.LastInsertId()
+		if err := encryption.Store(context.Background(), tx, encryption.NoteBody, int(noteID), text); err != nil {
+			return err
+		}
+	}
+	log.Printf("Moved the doctor notes of %d medical records to the Notes table", len(records))
+
+	return execAll(`ALTER TABLE MedicalRecords DROP COLUMN doctor_notes;`)(tx)
+}
+
+// starterMedications is the catalog the medications migration starts with
+//
+//go:embed medications.tsv
+var starterMedications []byte
+
+func loadStarterMedications(tx *sql.Tx) error {
+	scanner := bufio.NewScanner(bytes.NewReader(starterMedications))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 4 {
+			return fmt.Errorf("medications.tsv line %d: want name, form, strength and route", line)
+		}
+		_, err := tx.Exec(`INSERT INTO Medications (name, form, strength, route) VALUES (?, ?, ?, ?)`,
+			fields[0], fields[1], dosage.NormalizeStrength(fields[2]), fields[3])
+		if err != nil {
+			return fmt.Errorf("medications.tsv line %d: %v", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// linkPrescriptionMedications fuzzy-matches the free-text medication of
+// existing prescriptions against the catalog. Prescriptions that match no
+// entry, or several equally well, are left unlinked for a pharmacist.
+func linkPrescriptionMedications(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT medication_id, name, strength FROM Medications`)
+	if err != nil {
+		return err
+	}
+	var catalog []dosage.Entry
+	for rows.Next() {
+		var entry dosage.Entry
+		if err := rows.Scan(&entry.ID, &entry.Name, &entry.Strength); err != nil {
+			rows.Close()
+			return err
+		}
+		catalog = append(catalog, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.Query(`SELECT prescription_id, medication, COALESCE(dosage, '') FROM Prescriptions`)
+	if err != nil {
+		return err
+	}
+	links := map[int]int{}
+	total := 0
+	for rows.Next() {
+		var prescriptionID int
+		var medication, dose string
+		if err := rows.Scan(&prescriptionID, &medication, &dose); err != nil {
+			rows.Close()
+			return err
+		}
+		total++
+		if medicationID, ok := dosage.Match(medication, dose, catalog); ok {
+			links[prescriptionID] = medicationID
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for prescriptionID, medicationID := range links {
+		if _, err := tx.Exec(`UPDATE Prescriptions SET medication_id = ? WHERE prescription_id = ?`, medicationID, prescriptionID); err != nil {
+			return err
+		}
+	}
+	log.Printf("Linked %d of %d prescriptions to the medication catalog", len(links), total)
+	return nil
+}
+
+// scrubbedEventFields are the encrypted fields the snapshots in patient
+// and medical record events carried in plaintext before they were left out
+var scrubbedEventFields = map[string][]string{
+	"patient":        {"medicalHistory", "allergies"},
+	"medical_record": {"doctor_notes"},
+}
+
+// scrubEventPayloads removes scrubbedEventFields from the events already
+// recorded, lifting the event log's update guard to do so. Only the
+// payloads change; events are neither added nor removed.
+func scrubEventPayloads(tx *sql.Tx) error {
+	type event struct {
+		id      int
+		payload string
+	}
+	var scrubbed []event
+	for entityType, fields := range scrubbedEventFields {
+		rows, err := tx.Query(`SELECT event_id, payload FROM ClinicalEvents WHERE entity_type = ?`, entityType)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var e event
+			if err := rows.Scan(&e.id, &e.payload); err != nil {
+				rows.Close()
+				return err
+			}
+			var object map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(e.payload), &object); err != nil || object == nil {
+				continue
+			}
+			changed := false
+			for _, field := range fields {
+				if _, ok := object[field]; ok {
+					delete(object, field)
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+			data, err := json.Marshal(object)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			e.payload = string(data)
+			scrubbed = append(scrubbed, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	if len(scrubbed) == 0 {
+		return nil
+	}
+
+	err := liftUpdateGuards(tx, "ClinicalEvents", func() error {
+		for _, e := range scrubbed {
+			if _, err := tx.Exec(`UPDATE ClinicalEvents SET payload = ? WHERE event_id = ?`, e.payload, e.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Removed encrypted fields from %d event payloads", len(scrubbed))
+	return nil
+}
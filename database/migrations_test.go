@@ -0,0 +1,91 @@
+package database
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestRoleViews checks the columns each role view exposes once every
+// migration has run: the nurse view must never gain the treatment plan or
+// doctor's notes, and the pharmacy worklist reads its columns by name
+func TestRoleViews(t *testing.T) {
+	options := DefaultOptions()
+	options.Path = filepath.Join(t.TempDir(), "hospital.db")
+	if err := Open(options); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Close() })
+
+	for view, want := range map[string][]string{
+		"nurse_medical_records_view": {"record_id", "patient_id", "visit_date", "diagnosis"},
+		"pharmacist_prescriptions_view": {"prescription_id", "patient_id", "patient_name", "prescriber_name", "prescribed_date",
+			"medication", "medication_id", "dosage", "duration", "instructions", "status", "ready_at", "refill_count"},
+	} {
+		rows, err := DB.Query(`SELECT * FROM ` + view + ` WHERE 1 = 0`)
+		if err != nil {
+			t.Fatalf("%s: %v", view, err)
+		}
+		columns, err := rows.Columns()
+		rows.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", view, err)
+		}
+		if !slices.Equal(columns, want) {
+			t.Errorf("%s has columns %v, want %v", view, columns, want)
+		}
+	}
+}
+
+// TestScrubEventPayloads checks the encrypted fields are removed from the
+// events already recorded, and that the event log is append-only again
+// afterwards
+func TestScrubEventPayloads(t *testing.T) {
+	options := DefaultOptions()
+	options.Path = filepath.Join(t.TempDir(), "hospital.db")
+	if err := Open(options); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { DB.Close() })
+
+	events := []struct {
+		entityType, payload, want string
+	}{
+		{"patient", `{"id":1,"firstName":"Ada","medicalHistory":"Asthma","allergies":"Penicillin"}`, `{"firstName":"Ada","id":1}`},
+		{"medical_record", `{"id":2,"diagnosis":"Bronchitis","doctor_notes":"Chest clear"}`, `{"diagnosis":"Bronchitis","id":2}`},
+		{"prescription", `{"id":3,"medication":"Amoxicillin"}`, `{"id":3,"medication":"Amoxicillin"}`},
+	}
+	for i, e := range events {
+		_, err := DB.Exec(`INSERT INTO ClinicalEvents (entity_type, entity_id, event_type, payload, occurred_at) VALUES (?, ?, 'created', ?, ?)`,
+			e.entityType, i+1, e.payload, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scrubEventPayloads(tx); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, e := range events {
+		var payload string
+		if err := DB.QueryRow(`SELECT payload FROM ClinicalEvents WHERE entity_id = ?`, i+1).Scan(&payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload != e.want {
+			t.Errorf("%s event payload is %s, want %s", e.entityType, payload, e.want)
+		}
+	}
+	if _, err := DB.Exec(`UPDATE ClinicalEvents SET payload = '{}'`); err == nil {
+		t.Error("events can be updated after the scrub")
+	}
+}
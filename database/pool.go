@@ -0,0 +1,83 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Options controls how the SQLite database is opened and pooled
+type Options struct {
+	// URL selects PostgreSQL when it is a postgres:// or postgresql:// URL;
+	// otherwise the SQLite file at Path is used
+	URL string
+	// Path is the SQLite database file
+	Path string
+	// MaxOpenConns caps concurrent connections. WAL mode lets readers run
+	// alongside the single writer, so this mostly bounds parallel reads.
+	MaxOpenConns int
+	// MaxIdleConns is how many connections are kept open between requests
+	MaxIdleConns int
+	// ConnMaxIdleTime closes connections that have been idle this long
+	ConnMaxIdleTime time.Duration
+	// BusyTimeout is how long a SQLite statement waits for another writer's
+	// lock before failing with "database is locked"
+	BusyTimeout time.Duration
+	// StatementCacheSize is how many prepared statements each SQLite
+	// connection keeps for reuse; 0 prepares every statement afresh
+	StatementCacheSize int
+	// ReplicaURL is a PostgreSQL read replica of URL that serves reads
+	// which needn't see the caller's own writes, such as reports and lists
+	ReplicaURL string
+	// ReadOnlyReplica opens a second, read-only SQLite pool on Path for
+	// those reads, so they don't queue behind writers for connections
+	ReadOnlyReplica bool
+	// ReplicaMaxOpenConns caps the replica's connections; 0 uses MaxOpenConns
+	ReplicaMaxOpenConns int
+	// SlowQueryThreshold logs statements taking longer, with their text
+	// and numeric parameters shown; 0 logs none
+	SlowQueryThreshold time.Duration
+}
+
+// DefaultOptions is used by InitDB and by tools that don't load the server config
+func DefaultOptions() Options {
+	return Options{
+		Path:               "./hospital.db",
+		MaxOpenConns:       10,
+		MaxIdleConns:       5,
+		ConnMaxIdleTime:    5 * time.Minute,
+		BusyTimeout:        5 * time.Second,
+		StatementCacheSize: 256,
+		SlowQueryThreshold: 500 * time.Millisecond,
+	}
+}
+
+// MemoryPath opens a throwaway in-memory database, e.g. for the API fuzzer
+const MemoryPath = ":memory:"
+
+// options holds the settings the database was opened with
+var options = DefaultOptions()
+
+// PoolOptions returns the settings the database was opened with
+func PoolOptions() Options {
+	return options
+}
+
+// dsn enables WAL journaling, foreign key enforcement and the busy timeout on
+// every pooled connection.
+// Transactions begin IMMEDIATE so a writer takes the lock up front and waits
+// on busy_timeout, rather than failing when upgrading from a read lock.
+func (o Options) dsn() string {
+	if o.Path == MemoryPath {
+		// Pooled connections share one named in-memory database; WAL does not apply
+		return fmt.Sprintf("file:hospital?mode=memory&cache=shared&_busy_timeout=%d&_txlock=immediate&_foreign_keys=on",
+			o.BusyTimeout.Milliseconds())
+	}
+	return fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate&_synchronous=NORMAL&_foreign_keys=on",
+		o.Path, o.BusyTimeout.Milliseconds())
+}
+
+// replicaDSN opens Path read-only. The primary has already put it in WAL
+// mode, so its readers see each commit as soon as it is made.
+func (o Options) replicaDSN() string {
+	return fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d&_query_only=1", o.Path, o.BusyTimeout.Milliseconds())
+}
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/kinyaelgrande/simple-hospital/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// openPostgres connects to a PostgreSQL URL. Transactions are serializable
+// so concurrent writers see the same single-writer behaviour as SQLite;
+// serialization failures are retried by WithTx like SQLite's busy errors.
+func openPostgres(url string) (*sql.DB, error) {
+	config, err := pgx.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	if _, set := config.RuntimeParams["default_transaction_isolation"]; !set {
+		config.RuntimeParams["default_transaction_isolation"] = "serializable"
+	}
+	return sql.OpenDB(postgresConnector{stdlib.GetConnector(*config)}), nil
+}
+
+type postgresConnector struct {
+	driver.Connector
+}
+
+func (c postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{conn.(*stdlib.Conn)}, nil
+}
+
+// postgresConn runs the services' SQLite-style statements on PostgreSQL:
+// ? placeholders are rebound and inserts into tables with a SERIAL key
+// return the new key so LastInsertId works. Statements are timed for the
+// metrics endpoint and traced like SQLite's.
+type postgresConn struct {
+	*stdlib.Conn
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.PrepareContext(ctx, rebind(query))
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	span := statementSpan(ctx, "postgresql", query)
+	args = storedArgs(args, false)
+	result, err := c.exec(ctx, rebind(query), args)
+	observeStatement(ctx, "exec", query, args, time.Since(start), rowsAffected(result), err)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c *postgresConn) exec(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if table := insertTable(query); table != "" {
+		key, err := c.serialKey(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			return c.insertReturning(ctx, query, key, args)
+		}
+	}
+	return c.Conn.ExecContext(ctx, query, args)
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	span := statementSpan(ctx, "postgresql", query)
+	args = storedArgs(args, false)
+	rows, err := c.Conn.QueryContext(ctx, rebind(query), args)
+	if err != nil {
+		observeStatement(ctx, "query", query, args, time.Since(start), 0, err)
+		tracing.End(span, err)
+		return nil, err
+	}
+	pgRows := rows.(*stdlib.Rows)
+	types := make([]string, len(pgRows.Columns()))
+	for i := range types {
+		types[i] = pgRows.ColumnTypeDatabaseTypeName(i)
+	}
+	return &postgresRows{pgRows, newStatementRun(ctx, query, args, start), span, dateColumns(types)}, nil
+}
+
+// insertReturning runs an insert with RETURNING key, reporting the last
+// returned key as the insert ID
+func (c *postgresConn) insertReturning(ctx context.Context, query, key string, args []driver.NamedValue) (driver.Result, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";") + " RETURNING " + key
+	rows, err := c.Conn.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := insertResult{}
+	dest := make([]driver.Value, 1)
+	for {
+		if err := rows.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if id, ok := dest[0].(int64); ok {
+			result.id = id
+		}
+		result.rows++
+	}
+	return result, nil
+}
+
+// serialKeys caches each table's SERIAL key column, "" for tables without one
+var serialKeys sync.Map
+
+func (c *postgresConn) serialKey(ctx context.Context, table string) (string, error) {
+	if key, ok := serialKeys.Load(table); ok {
+		return key.(string), nil
+	}
+
+	rows, err := c.Conn.QueryContext(ctx, `SELECT column_name FROM information_schema.columns
+              WHERE table_schema = current_schema() AND table_name = $1 AND column_default LIKE 'nextval(%'`,
+		[]driver.NamedValue{{Ordinal: 1, Value: table}})
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	key := ""
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err == nil {
+		key, _ = dest[0].(string)
+	} else if err != io.EOF {
+		return "", err
+	}
+	serialKeys.Store(table, key)
+	return key, nil
+}
+
+// insertInto matches an INSERT that doesn't already return anything
+var insertInto = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+"?(\w+)"?`)
+
+// insertTable returns the lower-cased table an INSERT without RETURNING
+// writes to, or "" for any other statement
+func insertTable(query string) string {
+	m := insertInto.FindStringSubmatch(query)
+	if m == nil || strings.Contains(strings.ToUpper(query), "RETURNING") {
+		return ""
+	}
+	return strings.ToLower(m[1])
+}
+
+type insertResult struct {
+	id   int64
+	rows int64
+}
+
+func (r insertResult) LastInsertId() (int64, error) { return r.id, nil }
+
+func (r insertResult) RowsAffected() (int64, error) { return r.rows, nil }
+
+// postgresRows records the query when its rows are closed and returns DATE
+// columns as YYYY-MM-DD text, as SQLite's rows do
+type postgresRows struct {
+	*stdlib.Rows
+	statement *statementRun
+	span      trace.Span
+	isDate    []bool
+}
+
+func (r *postgresRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	r.statement.rows++
+	calendarDates(dest, r.isDate)
+	return nil
+}
+
+func (r *postgresRows) Close() error {
+	err := r.Rows.Close()
+	r.statement.finish(err)
+	tracing.End(r.span, err)
+	return err
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/logging"
+	"github.com/kinyaelgrande/simple-hospital/metrics"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// maxTrackedStatements bounds the statements aggregated; the services'
+// statements number in the hundreds, so more means ad hoc SQL is being run
+const maxTrackedStatements = 2000
+
+// queryStats aggregates each statement's runs for the admin endpoint
+var queryStats = struct {
+	sync.Mutex
+	since      time.Time
+	dropped    int64
+	statements map[string]*models.QueryStat
+}{since: time.Now(), statements: map[string]*models.QueryStat{}}
+
+// observeStatement records a statement the instrumented drivers finished:
+// in the metrics, in the query stats and, when it took longer than
+// Options.SlowQueryThreshold, in the log with its parameters redacted
+func observeStatement(ctx context.Context, operation, query string, args []driver.NamedValue, duration time.Duration, rows int64, err error) {
+	metrics.ObserveQuery(operation, duration)
+
+	statement := strings.Join(strings.Fields(query), " ")
+	threshold := options.SlowQueryThreshold
+	slow := threshold > 0 && duration > threshold
+	ms := milliseconds(duration)
+
+	queryStats.Lock()
+	stat, ok := queryStats.statements[statement]
+	if !ok && len(queryStats.statements) < maxTrackedStatements {
+		stat = &models.QueryStat{Statement: statement}
+		queryStats.statements[statement] = stat
+	}
+	if stat == nil {
+		queryStats.dropped++
+	} else {
+		stat.Calls++
+		stat.Rows += rows
+		stat.TotalMs += ms
+		stat.MaxMs = max(stat.MaxMs, ms)
+		if err != nil {
+			stat.Errors++
+		}
+		if slow {
+			stat.SlowCalls++
+		}
+	}
+	queryStats.Unlock()
+
+	if slow {
+		attrs := []any{"operation", operation, "durationMs", ms, "rows", rows, "statement", statement, "params", redactedArgs(args)}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		slog.WarnContext(ctx, "Slow query", attrs...)
+	}
+}
+
+// statementRun is a query whose rows are still being read; it is observed
+// once they are closed
+type statementRun struct {
+	ctx   context.Context
+	query string
+	args  []driver.NamedValue
+	start time.Time
+	rows  int64
+}
+
+func newStatementRun(ctx context.Context, query string, args []driver.NamedValue, start time.Time) *statementRun {
+	return &statementRun{ctx: ctx, query: query, args: args, start: start}
+}
+
+func (r *statementRun) finish(err error) {
+	observeStatement(r.ctx, "query", r.query, r.args, time.Since(r.start), r.rows, err)
+}
+
+// rowsAffected is the rows an exec changed, 0 when it failed or the driver
+// doesn't count them
+func rowsAffected(result driver.Result) int64 {
+	if result == nil {
+		return 0
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// redactedArgs shows a statement's numbers, booleans and NULLs, which are
+// IDs, counts and flags, and hides its text and blobs, which may be patient
+// data or credentials
+func redactedArgs(args []driver.NamedValue) []any {
+	values := make([]any, len(args))
+	for i, arg := range args {
+		switch arg.Value.(type) {
+		case nil, int64, float64, bool:
+			values[i] = arg.Value
+		default:
+			values[i] = logging.Redacted
+		}
+	}
+	return values
+}
+
+// QueryStats returns the statements run since the stats were last reset,
+// sorted by sortBy, one of the QUERY_STATS_SORT_* values, the largest first,
+// limit of them at most
+func QueryStats(sortBy string, limit int) models.QueryStats {
+	queryStats.Lock()
+	stats := models.QueryStats{
+		Since:           queryStats.since,
+		SlowThresholdMs: milliseconds(options.SlowQueryThreshold),
+		Dropped:         queryStats.dropped,
+		Statements:      make([]models.QueryStat, 0, len(queryStats.statements)),
+	}
+	for _, stat := range queryStats.statements {
+		stats.Statements = append(stats.Statements, *stat)
+	}
+	queryStats.Unlock()
+
+	key := func(stat models.QueryStat) float64 {
+		switch sortBy {
+		case models.QUERY_STATS_SORT_MEAN:
+			return stat.MeanMs
+		case models.QUERY_STATS_SORT_MAX:
+			return stat.MaxMs
+		case models.QUERY_STATS_SORT_CALLS:
+			return float64(stat.Calls)
+		default:
+			return stat.TotalMs
+		}
+	}
+	for i := range stats.Statements {
+		stats.Statements[i].MeanMs = stats.Statements[i].TotalMs / float64(stats.Statements[i].Calls)
+	}
+	slices.SortFunc(stats.Statements, func(a, b models.QueryStat) int {
+		return cmp.Or(cmp.Compare(key(b), key(a)), strings.Compare(a.Statement, b.Statement))
+	})
+	if len(stats.Statements) > limit {
+		stats.Statements = stats.Statements[:limit]
+	}
+	return stats
+}
+
+// ResetQueryStats discards the aggregated statements, returning how many there were
+func ResetQueryStats() int {
+	queryStats.Lock()
+	defer queryStats.Unlock()
+	count := len(queryStats.statements)
+	queryStats.since = time.Now()
+	queryStats.dropped = 0
+	queryStats.statements = map[string]*models.QueryStat{}
+	return count
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// openReplica opens the read-only pool reads go to, if opts configure one.
+// It is opened after migrations so it never sees a partial schema.
+func openReplica(opts Options) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	switch {
+	case dialect.Name() == Postgres && opts.ReplicaURL != "":
+		db, err = openPostgres(opts.ReplicaURL)
+	case dialect.Name() == SQLite && opts.ReadOnlyReplica:
+		if opts.Path == MemoryPath {
+			log.Printf("The read-only replica isn't available for the in-memory database; reads use the primary")
+			return nil, nil
+		}
+		db, err = sql.Open(driverName, opts.replicaDSN())
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	maxOpen := opts.ReplicaMaxOpenConns
+	if maxOpen <= 0 {
+		maxOpen = opts.MaxOpenConns
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(min(opts.MaxIdleConns, maxOpen))
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Replica returns the read-only pool serving ReadDB, nil when reads use the
+// primary
+func Replica() *sql.DB {
+	return replica
+}
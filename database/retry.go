@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// busyRetries is how many more times a write is attempted after
+// busy_timeout has already expired
+const busyRetries = 4
+
+// IsBusy reports whether err is SQLite's "database is locked" or "table is
+// locked", or a PostgreSQL transaction that lost to a concurrent one
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected || pgErr.Code == pgLockNotAvailable
+	}
+	return false
+}
+
+// RetryOnBusy runs fn again with jittered backoff while it fails because
+// another connection holds the write lock. fn must be safe to repeat.
+// It gives up early once ctx is done.
+func RetryOnBusy(ctx context.Context, fn func() error) error {
+	backoff := 25 * time.Millisecond
+
+	var err error
+	for attempt := 0; attempt <= busyRetries; attempt++ {
+		if err = fn(); !IsBusy(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+// WithTx runs fn in a write transaction, committing if it returns nil.
+// The whole transaction is retried if the database is busy, so fn must not
+// have side effects outside tx beyond setting its results; use AfterCommit
+// for those. If ctx carries a transaction from InTx, fn runs in that one and
+// is committed with it.
+func WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if tx, ok := TxFromContext(ctx); ok {
+		return fn(tx)
+	}
+
+	return RetryOnBusy(ctx, func() error {
+		tx, err := DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		hooks := &[]func(){}
+		commitHooks.Store(tx, hooks)
+		defer commitHooks.Delete(tx)
+		defer tx.Rollback()
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		for _, hook := range *hooks {
+			hook()
+		}
+		return nil
+	})
+}
+
+// commitHooks maps each open WithTx transaction to the functions to run
+// once it commits
+var commitHooks sync.Map
+
+// AfterCommit runs fn once tx has committed, or never if it rolls back.
+// Only transactions begun by WithTx run hooks.
+func AfterCommit(tx *sql.Tx, fn func()) {
+	if hooks, ok := commitHooks.Load(tx); ok {
+		pending := hooks.(*[]func())
+		*pending = append(*pending, fn)
+	}
+}
+
+type txKey struct{}
+
+// InTx runs fn with a write transaction in its context, committing if fn
+// returns nil. Service calls that write through WithTx with that context
+// join the transaction rather than starting their own, so writes across
+// related entities commit or roll back together. Reads through ReadDB don't
+// see the transaction's uncommitted writes. Like WithTx, the whole of fn is
+// retried if the database is busy.
+func InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return fn(ctx)
+	}
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		return fn(context.WithValue(ctx, txKey{}, tx))
+	})
+}
+
+// TxFromContext returns the transaction InTx put in ctx
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
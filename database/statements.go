@@ -0,0 +1,151 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// stmtCache keeps a SQLite connection's prepared statements by their text,
+// so the queries the services run on every request are parsed once per
+// connection instead of on each call. The least recently used statement is
+// finalized when the cache is full. PostgreSQL needs no such cache: pgx
+// keeps one per connection already (see statement_cache_capacity).
+type stmtCache struct {
+	mutex    sync.Mutex
+	capacity int
+	// recent holds the *cachedStmt, most recently used first
+	recent  *list.List
+	byQuery map[string]*list.Element
+}
+
+// cachedStmt is a prepared statement in a stmtCache
+type cachedStmt struct {
+	query string
+	stmt  *sqlite3.SQLiteStmt
+	// busy is set while rows read from the statement are open. Running it
+	// again would reset those rows, so a nested run of the same query, e.g.
+	// inside a loop over its rows, prepares a statement of its own.
+	busy bool
+	// evicted is set when the statement left the cache while busy; it is
+	// finalized once its rows are closed
+	evicted bool
+}
+
+// newStmtCache returns a cache of up to capacity statements, or nil, which
+// caches nothing, when capacity isn't positive
+func newStmtCache(capacity int) *stmtCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &stmtCache{capacity: capacity, recent: list.New(), byQuery: map[string]*list.Element{}}
+}
+
+// acquire returns the prepared statement for query, preparing it on conn
+// the first time, and marks it busy until release. It returns nil when the
+// query isn't cached: the cache is disabled, the query has several
+// statements, or its statement is busy.
+func (c *stmtCache) acquire(ctx context.Context, conn *sqlite3.SQLiteConn, query string) (*cachedStmt, error) {
+	if c == nil || !singleStatement(query) {
+		return nil, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.byQuery[query]; ok {
+		cached := element.Value.(*cachedStmt)
+		if cached.busy {
+			return nil, nil
+		}
+		c.recent.MoveToFront(element)
+		cached.busy = true
+		return cached, nil
+	}
+
+	stmt, err := conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedStmt{query: query, stmt: stmt.(*sqlite3.SQLiteStmt), busy: true}
+	c.byQuery[query] = c.recent.PushFront(cached)
+	if c.recent.Len() > c.capacity {
+		oldest := c.recent.Remove(c.recent.Back()).(*cachedStmt)
+		delete(c.byQuery, oldest.query)
+		if oldest.busy {
+			oldest.evicted = true
+		} else {
+			oldest.stmt.Close()
+		}
+	}
+	return cached, nil
+}
+
+// release makes a statement from acquire available again
+func (c *stmtCache) release(cached *cachedStmt) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached.busy = false
+	if cached.evicted {
+		cached.stmt.Close()
+	}
+}
+
+// close finalizes every statement, before the connection closes
+func (c *stmtCache) close() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for element := c.recent.Front(); element != nil; element = element.Next() {
+		element.Value.(*cachedStmt).stmt.Close()
+	}
+	c.recent.Init()
+	clear(c.byQuery)
+}
+
+// singleStatement reports whether query is one statement. The driver runs
+// the statements of a multi-statement query one after another, which a
+// single prepared statement can't. A semicolon in a string literal only
+// keeps the query out of the cache.
+func singleStatement(query string) bool {
+	query = strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+	return query != "" && !strings.Contains(query, ";")
+}
+
+// cacheableExec reports whether the driver's Exec of query leaves its
+// statement finished. Exec steps a statement once, so one that returns
+// rows, like a SELECT, PRAGMA or INSERT ... RETURNING, would be left
+// holding its read lock until the next run reset it.
+func cacheableExec(query string) bool {
+	switch strings.ToUpper(statementVerb(query)) {
+	case "INSERT", "UPDATE", "DELETE", "REPLACE":
+		return !strings.Contains(strings.ToUpper(query), "RETURNING")
+	}
+	return false
+}
+
+// bindArgs picks the arguments of a single-statement query as the driver
+// does when it prepares the query itself: the positional ones it has
+// placeholders for, then any named ones
+func bindArgs(stmt *sqlite3.SQLiteStmt, args []driver.NamedValue) ([]driver.NamedValue, error) {
+	placeholders := stmt.NumInput()
+	if len(args) < placeholders {
+		return nil, fmt.Errorf("not enough args to execute query: want %d got %d", placeholders, len(args))
+	}
+	bound := append([]driver.NamedValue(nil), args[:placeholders]...)
+	for _, arg := range args[placeholders:] {
+		if arg.Name != "" {
+			bound = append(bound, arg)
+		}
+	}
+	for i := range bound {
+		bound[i].Ordinal = i + 1
+	}
+	return bound, nil
+}
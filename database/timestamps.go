@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql/driver"
+	"strings"
+	"time"
+)
+
+// TimestampLayout is the layout timestamps are stored in on SQLite: RFC 3339
+// in UTC with a fixed nine-digit fraction, so stored values sort and compare
+// as text in time order. PostgreSQL stores them as TIMESTAMPTZ.
+const TimestampLayout = "2006-01-02T15:04:05.000000000Z"
+
+// DateLayout is the layout of calendar dates (DATE columns) on both
+// databases: dates of birth, visit dates and the like aren't instants, so
+// they are kept and returned as plain YYYY-MM-DD with no zone
+const DateLayout = "2006-01-02"
+
+// storedArgs converts time arguments to how they are stored: UTC, and on
+// SQLite the text of TimestampLayout rather than the driver's own layout,
+// which keeps the offset of whatever zone the time was in
+func storedArgs(args []driver.NamedValue, asText bool) []driver.NamedValue {
+	for i, arg := range args {
+		t, ok := arg.Value.(time.Time)
+		if !ok {
+			continue
+		}
+		if asText {
+			args[i].Value = t.UTC().Format(TimestampLayout)
+		} else {
+			args[i].Value = t.UTC()
+		}
+	}
+	return args
+}
+
+// calendarDates replaces the times the drivers read DATE columns as with
+// their YYYY-MM-DD text; isDate reports the columns declared DATE. An empty
+// or unreadable legacy SQLite value comes back as "".
+func calendarDates(dest []driver.Value, isDate []bool) {
+	for i, value := range dest {
+		if i >= len(isDate) || !isDate[i] {
+			continue
+		}
+		if t, ok := value.(time.Time); ok {
+			if t.IsZero() {
+				dest[i] = ""
+			} else {
+				dest[i] = t.Format(DateLayout)
+			}
+		}
+	}
+}
+
+// dateColumns reports which of the columns with these declared types are
+// DATE columns
+func dateColumns(types []string) []bool {
+	isDate := make([]bool, len(types))
+	for i, name := range types {
+		isDate[i] = strings.EqualFold(name, "DATE")
+	}
+	return isDate
+}
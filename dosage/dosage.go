@@ -0,0 +1,190 @@
+// Package dosage normalizes medication strengths such as "500MG" or "0.5 g"
+// to one spelling and matches free-text medication names against the
+// medication catalog
+package dosage
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// amount is a number with a unit, optionally per an amount of another unit,
+// e.g. "500mg", "0.5 G", "250 mg/5 ml", "40 IU"
+var amount = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*((?:mcg|µg|ug|mg|g|ml|l|iu|units?|mmol)\b|%)(?:\s*/\s*(\d+(?:\.\d+)?)?\s*(ml|l|g|dose)\b)?`)
+
+// units maps each unit spelling to its canonical unit and the factor that
+// converts to it: masses are converted to mg and volumes to ml
+var units = map[string]struct {
+	unit   string
+	factor float64
+}{
+	"mcg": {"mg", 0.001}, "µg": {"mg", 0.001}, "ug": {"mg", 0.001},
+	"mg": {"mg", 1}, "g": {"mg", 1000},
+	"ml": {"ml", 1}, "l": {"ml", 1000},
+	"iu": {"IU", 1}, "unit": {"IU", 1}, "units": {"IU", 1},
+	"mmol": {"mmol", 1}, "%": {"%", 1},
+	"dose": {"dose", 1},
+}
+
+// NormalizeStrength rewrites every amount in text in canonical units:
+// "0.5G" becomes "500 mg", "1000mg" becomes "1 g", "250MG/5ML" becomes
+// "250 mg/5 ml" and "1 L" becomes "1000 ml". The rest of the text is left
+// as it is.
+func NormalizeStrength(text string) string {
+	return amount.ReplaceAllStringFunc(text, func(match string) string {
+		m := amount.FindStringSubmatch(match)
+		normalized := formatAmount(m[1], m[2])
+		if m[4] != "" {
+			per := m[3]
+			if per == "" {
+				per = "1"
+			}
+			normalized += "/" + formatAmount(per, m[4])
+		}
+		return normalized
+	})
+}
+
+// Strength returns the first amount in text, normalized, or ""
+func Strength(text string) string {
+	match := amount.FindString(text)
+	if match == "" {
+		return ""
+	}
+	return NormalizeStrength(match)
+}
+
+func formatAmount(number, unit string) string {
+	value, err := strconv.ParseFloat(number, 64)
+	canonical, known := units[strings.ToLower(unit)]
+	if err != nil || !known {
+		return number + " " + unit
+	}
+
+	value *= canonical.factor
+	// Masses use whichever of mcg, mg and g keeps the number at least 1
+	if canonical.unit == "mg" && value < 1 {
+		return strconv.FormatFloat(value*1000, 'f', -1, 64) + " mcg"
+	}
+	if canonical.unit == "mg" && value >= 1000 {
+		return strconv.FormatFloat(value/1000, 'f', -1, 64) + " g"
+	}
+	if canonical.unit == "%" {
+		return strconv.FormatFloat(value, 'f', -1, 64) + "%"
+	}
+	if canonical.unit == "dose" && value == 1 {
+		return canonical.unit
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64) + " " + canonical.unit
+}
+
+// Entry is a catalog medication as far as matching is concerned
+type Entry struct {
+	ID       int
+	Name     string
+	Strength string
+}
+
+// Match finds the catalog entry a free-text medication refers to. The name
+// must match an entry's name exactly, as a whole phrase within the text, or
+// within a small edit distance for typos. A strength in the text must match
+// the entry's; otherwise the strength in dose, if any entry has it, picks
+// between entries of that name. ok is false when nothing matches or the
+// text is ambiguous between several entries.
+func Match(text, dose string, entries []Entry) (id int, ok bool) {
+	name := words(amount.ReplaceAllString(text, " "))
+	if name == "" {
+		return 0, false
+	}
+
+	// Candidates are ranked by how closely the names match; only the best rank counts
+	best := -1
+	var candidates []Entry
+	for _, entry := range entries {
+		rank := nameRank(name, words(entry.Name))
+		if rank < 0 || (best >= 0 && rank > best) {
+			continue
+		}
+		if best < 0 || rank < best {
+			best, candidates = rank, nil
+		}
+		candidates = append(candidates, entry)
+	}
+
+	if strength := Strength(text); strength != "" {
+		candidates = withStrength(candidates, strength)
+	} else if strength := Strength(dose); strength != "" {
+		if same := withStrength(candidates, strength); len(same) > 0 {
+			candidates = same
+		}
+	}
+	if len(candidates) != 1 {
+		return 0, false
+	}
+	return candidates[0].ID, true
+}
+
+func withStrength(entries []Entry, strength string) []Entry {
+	var same []Entry
+	for _, entry := range entries {
+		if Strength(entry.Strength) == strength {
+			same = append(same, entry)
+		}
+	}
+	return same
+}
+
+// nameRank scores how well a catalog name matches the text's name: 0 for
+// the same words, 1 when the catalog name appears in the text, 2 for a
+// near miss and -1 for no match
+func nameRank(text, name string) int {
+	switch {
+	case name == "":
+		return -1
+	case text == name:
+		return 0
+	case strings.Contains(" "+text+" ", " "+name+" "):
+		return 1
+	case len(name) >= 5 && levenshtein(text, name) <= maxTypos(name):
+		return 2
+	default:
+		return -1
+	}
+}
+
+// maxTypos allows one typo in short names and two in longer ones
+func maxTypos(name string) int {
+	if len(name) < 9 {
+		return 1
+	}
+	return 2
+}
+
+// words lower-cases text and reduces it to single-spaced words
+func words(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-')
+	}), " ")
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,165 @@
+// Package dto holds the response shapes sent to clients in place of the
+// models, and Serialize, which picks the shape for the requester's role:
+//
+//   - password hashes and 2FA secrets never leave the server
+//   - nurses and lab technicians get medical records without the treatment
+//     plan or doctor's notes
+//   - patients get their own medical records without the doctor's notes
+//   - pharmacists and other non-clinical roles get medical records without
+//     the diagnosis either
+//
+// Handlers write through WriteJSON so every endpoint returning these models
+// applies the same rules.
+package dto
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// User is a staff or patient portal account as clients see it
+type User struct {
+	ID            int                            `json:"id"`
+	Username      string                         `json:"username"`
+	Role          string                         `json:"role"`
+	FullName      string                         `json:"fullName"`
+	TwoFAEnabled  bool                           `json:"twoFactorEnabled"`
+	Notifications models.NotificationPreferences `json:"notifications"`
+	PatientID     *int                           `json:"patientId,omitempty"`
+	Active        bool                           `json:"active"`
+	LastLoginAt   *time.Time                     `json:"lastLoginAt,omitempty"`
+}
+
+// MedicalRecordSummary is a medical record without the doctor's notes, for
+// the patient it is about
+type MedicalRecordSummary struct {
+	ID             int      `json:"id"`
+	PatientID      int      `json:"patient_id"`
+	VisitDate      string   `json:"visit_date"`
+	Diagnosis      string   `json:"diagnosis"`
+	TreatmentPlan  string   `json:"treatment_plan"`
+	DiagnosisCodes []string `json:"diagnosis_codes"`
+}
+
+// MedicalRecordVisit is a medical record stripped to when the visit was,
+// for roles that may not see the diagnosis
+type MedicalRecordVisit struct {
+	ID        int    `json:"id"`
+	PatientID int    `json:"patient_id"`
+	VisitDate string `json:"visit_date"`
+}
+
+// NewUser shapes a user; the role is lower-cased as the SPA expects
+func NewUser(user *models.User) User {
+	return User{
+		ID:            user.UserID,
+		Username:      user.Username,
+		Role:          strings.ToLower(user.Role),
+		FullName:      user.FullName,
+		TwoFAEnabled:  user.TwoFAEnabled,
+		Notifications: user.Notifications,
+		PatientID:     user.PatientID,
+		Active:        user.Active,
+		LastLoginAt:   user.LastLoginAt,
+	}
+}
+
+// Serialize returns body shaped for role. Models without a response shape
+// are returned as they are.
+func Serialize(role string, body any) any {
+	switch v := body.(type) {
+	case models.User:
+		return NewUser(&v)
+	case *models.User:
+		return NewUser(v)
+	case []models.User:
+		return mapSlice(v, func(user models.User) any { return NewUser(&user) })
+	case []*models.User:
+		return mapSlice(v, func(user *models.User) any { return NewUser(user) })
+	case models.MedicalRecord:
+		return medicalRecord(role, &v)
+	case *models.MedicalRecord:
+		return medicalRecord(role, v)
+	case []models.MedicalRecord:
+		return mapSlice(v, func(record models.MedicalRecord) any { return medicalRecord(role, &record) })
+	case models.MedicalRecordNurseView:
+		return nurseRecord(role, &v)
+	case *models.MedicalRecordNurseView:
+		return nurseRecord(role, v)
+	case []models.MedicalRecordNurseView:
+		return mapSlice(v, func(record models.MedicalRecordNurseView) any { return nurseRecord(role, &record) })
+	case *models.Timeline:
+		timeline := *v
+		timeline.Entries = make([]models.TimelineEntry, len(v.Entries))
+		for i, entry := range v.Entries {
+			entry.Item = Serialize(role, entry.Item)
+			timeline.Entries[i] = entry
+		}
+		return &timeline
+	default:
+		return body
+	}
+}
+
+// WriteJSON writes body shaped for the authenticated user's role
+func WriteJSON(w http.ResponseWriter, r *http.Request, status int, body any) {
+	role := ""
+	if user, ok := middleware.GetUserFromContext(r); ok {
+		role = user.Role
+	}
+	WriteJSONAs(w, role, status, body)
+}
+
+// WriteJSONAs writes body shaped for role rather than the requester's, e.g.
+// the full record for a clinician with break-glass access
+func WriteJSONAs(w http.ResponseWriter, role string, status int, body any) {
+	response.WriteJSON(w, status, Serialize(role, body))
+}
+
+func medicalRecord(role string, record *models.MedicalRecord) any {
+	switch role {
+	case models.ROLE_ADMIN, models.ROLE_DOCTOR:
+		return record
+	case models.ROLE_NURSE, models.ROLE_LAB_TECH:
+		return models.MedicalRecordNurseView{
+			RecordID:  record.RecordID,
+			PatientID: record.PatientID,
+			VisitDate: record.VisitDate,
+			Diagnosis: record.Diagnosis,
+		}
+	case models.ROLE_PATIENT:
+		return MedicalRecordSummary{
+			ID:             record.RecordID,
+			PatientID:      record.PatientID,
+			VisitDate:      record.VisitDate,
+			Diagnosis:      record.Diagnosis,
+			TreatmentPlan:  record.TreatmentPlan,
+			DiagnosisCodes: record.DiagnosisCodes,
+		}
+	default:
+		return MedicalRecordVisit{ID: record.RecordID, PatientID: record.PatientID, VisitDate: record.VisitDate}
+	}
+}
+
+func nurseRecord(role string, record *models.MedicalRecordNurseView) any {
+	switch role {
+	case models.ROLE_ADMIN, models.ROLE_DOCTOR, models.ROLE_NURSE, models.ROLE_LAB_TECH:
+		return record
+	default:
+		return MedicalRecordVisit{ID: record.RecordID, PatientID: record.PatientID, VisitDate: record.VisitDate}
+	}
+}
+
+// mapSlice shapes each element, keeping an empty list rather than null
+func mapSlice[T any](values []T, shape func(T) any) []any {
+	shaped := make([]any, len(values))
+	for i, value := range values {
+		shaped[i] = shape(value)
+	}
+	return shaped
+}
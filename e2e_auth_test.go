@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/apiclient"
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+)
+
+func TestAuth(t *testing.T) {
+	t.Run("login needs the second factor", loginNeedsSecondFactor)
+	t.Run("new accounts must enroll 2FA", enrollmentRequired)
+	t.Run("logout ends the session", logout)
+	t.Run("security key users can't skip their key", securityKeyRequired)
+	t.Run("sessions are only verified once", verifiedOnce)
+	t.Run("re-enrolling needs the current second factor", reEnrollment)
+}
+
+func TestAccessControl(t *testing.T) {
+	t.Run("patient portal sees only its own chart", patientPortal)
+	t.Run("staff can't use admin endpoints", adminOnly)
+}
+
+func loginNeedsSecondFactor(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+
+	client := e2e.newClient()
+	if _, err := client.Login(ctx, doctor.User.Username, "wrong-password"); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("wrong password: want 401, got %v", err)
+	}
+	challenge, err := client.Login(ctx, doctor.User.Username, doctor.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(challenge.SecondFactors, "totp") {
+		t.Fatalf("second factors %v don't include totp", challenge.SecondFactors)
+	}
+
+	// The pending session can't be used before the code is verified
+	pending := e2e.newClient(apiclient.WithSession(challenge.TempSessionID))
+	if _, err := pending.Me(ctx); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("pending session: want 401, got %v", err)
+	}
+	if err := client.VerifyCode(ctx, challenge, "000000"); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("wrong code: want 401, got %v", err)
+	}
+
+	code := doctor.code(t)
+	if err := client.VerifyCode(ctx, challenge, code); err != nil {
+		t.Fatal(err)
+	}
+	me, err := client.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Roles come back in the web client's lowercase spelling
+	if role, _ := models.CanonicalRole(me.Role); me.Username != doctor.User.Username || role != models.ROLE_DOCTOR || !me.TwoFAEnabled {
+		t.Fatalf("logged in as %+v", me)
+	}
+}
+
+func enrollmentRequired(t *testing.T) {
+	ctx := t.Context()
+	user, password := e2e.createUser(t, &models.User{Role: models.ROLE_NURSE})
+	if _, err := e2e.newClient().Login(ctx, user.Username, password); !errors.Is(err, apiclient.ErrTwoFASetupRequired) {
+		t.Fatalf("want ErrTwoFASetupRequired, got %v", err)
+	}
+}
+
+func logout(t *testing.T) {
+	ctx := t.Context()
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	sessionID := nurse.Client.SessionID()
+	if err := nurse.Client.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e2e.newClient(apiclient.WithSession(sessionID)).Me(ctx); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("logged out session: want 401, got %v", err)
+	}
+}
+
+func patientPortal(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+
+	own, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, patient := range []*models.Patient{own, other} {
+		if _, err := doctor.Client.CreatePrescription(ctx, newPrescription(patient.PatientID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	portal := e2e.patientAccount(t, own.PatientID)
+	if _, err := portal.Client.GetPatient(ctx, own.PatientID); err != nil {
+		t.Fatalf("reading their own chart: %v", err)
+	}
+	if _, err := portal.Client.GetPatient(ctx, other.PatientID); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("reading another patient: want 403, got %v", err)
+	}
+	if _, err := portal.Client.CreatePatient(ctx, newPatient()); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("registering a patient: want 403, got %v", err)
+	}
+
+	page, err := portal.Client.ListPrescriptions(ctx, apiclient.PrescriptionQuery{}, apiclient.PageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].PatientID != own.PatientID {
+		t.Fatalf("the portal lists %d prescriptions, want only the patient's one", len(page.Items))
+	}
+}
+
+func adminOnly(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	if _, err := doctor.Client.Do(ctx, http.MethodPost, "/api/users", nil, &models.User{Username: "intruder", Role: models.ROLE_ADMIN, FullName: "Intruder"}, nil); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("doctor creating an admin: want 403, got %v", err)
+	}
+	if _, err := doctor.Client.Do(ctx, http.MethodGet, "/api/admin/stats", nil, nil, nil); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("doctor reading admin stats: want 403, got %v", err)
+	}
+
+	page, err := e2e.admin.Client.ListUsers(ctx, apiclient.UserQuery{Role: models.ROLE_DOCTOR}, apiclient.PageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(page.Items, func(u apiclient.User) bool { return u.ID == doctor.User.ID }) {
+		t.Fatal("the admin's user list is missing the doctor")
+	}
+}
+
+func securityKeyRequired(t *testing.T) {
+	ctx := t.Context()
+	user, password := e2e.createUser(t, &models.User{Role: models.ROLE_NURSE})
+	// A registered key is all the server looks at before the assertion, so
+	// one is recorded directly rather than through a WebAuthn ceremony
+	_, err := database.GetDB().ExecContext(ctx, `INSERT INTO WebAuthnCredentials (user_id, credential_id, name, credential_data, created_at)
+                                                 VALUES (?, ?, ?, ?, ?)`, user.ID, "e2e-key-"+user.Username, "E2E key", "{}", time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, header := range []http.Header{
+		{},
+		{"X-2FA-Code": {"123456"}},
+		{"X-Session-ID": {"basic-auth"}},
+	} {
+		header.Set("Authorization", basicAuth(user.Username, password))
+		var body session.AuthResponse
+		status := rawRequest(t, http.MethodGet, "/api/me", header, &body)
+		if status != http.StatusUnauthorized {
+			t.Fatalf("password only, with %v: want 401, got %d", header, status)
+		}
+		if header.Get("X-2FA-Code") == "" && (!body.Requires2FA || !slices.Equal(body.SecondFactors, []string{session.SECOND_FACTOR_WEBAUTHN})) {
+			t.Fatalf("password only, with %v: got %+v, want the security key asked for", header, body)
+		}
+	}
+
+	var body session.AuthResponse
+	header := http.Header{"Authorization": {basicAuth(user.Username, password)}}
+	if status := rawRequest(t, http.MethodPost, "/api/auth/2fa/transition", header, &body); status != http.StatusOK ||
+		!body.Requires2FA || body.TempSessionID == "" {
+		t.Fatalf("transition: got %d %+v, want a pending session", status, body)
+	}
+	if _, err := e2e.newClient(apiclient.WithSession(body.TempSessionID)).Me(ctx); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("the pending session: want 401, got %v", err)
+	}
+}
+
+// rawRequest sends a request with header, for the exchanges apiclient
+// doesn't make, and decodes the response into out
+func rawRequest(t *testing.T, method, path string, header http.Header, out any) int {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, e2e.server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := e2e.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("%s %s: decoding the response: %v", method, path, err)
+	}
+	return resp.StatusCode
+}
+
+// basicAuth is the Authorization header value for username and password
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func verifiedOnce(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	client := e2e.newClient()
+	challenge, err := client.Login(ctx, doctor.User.Username, doctor.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending, authenticated struct {
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	if _, err := e2e.newClient(apiclient.WithSession(challenge.TempSessionID)).Do(ctx, http.MethodGet, "/api/auth/session", nil, nil, &pending); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.VerifyCode(ctx, challenge, doctor.code(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(ctx, http.MethodGet, "/api/auth/session", nil, nil, &authenticated); err != nil {
+		t.Fatal(err)
+	}
+	// The maximum session age counts from the password, not the code
+	if !authenticated.CreatedAt.Equal(pending.CreatedAt) {
+		t.Fatalf("the session was created at %s once verified, want %s as when pending", authenticated.CreatedAt, pending.CreatedAt)
+	}
+
+	body := map[string]string{"sessionId": client.SessionID(), "code": doctor.code(t)}
+	if _, err := e2e.newClient().Do(ctx, http.MethodPost, "/api/auth/2fa/verify", nil, body, nil); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("verifying an authenticated session: want 401, got %v", err)
+	}
+	var response session.AuthResponse
+	header := http.Header{"X-Session-ID": {client.SessionID()}, "X-2FA-Code": {doctor.code(t)}}
+	if status := rawRequest(t, http.MethodGet, "/api/me", header, &response); status != http.StatusUnauthorized {
+		t.Fatalf("sending a code with an authenticated session: want 401, got %d", status)
+	}
+}
+
+func reEnrollment(t *testing.T) {
+	ctx := t.Context()
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	header := http.Header{"Authorization": {basicAuth(nurse.User.Username, nurse.Password)}}
+	var setup struct {
+		SecretKey string `json:"secretKey"`
+	}
+	if status := rawRequest(t, http.MethodGet, "/api/auth/2fa/setup", header, &setup); status != http.StatusUnauthorized || setup.SecretKey != "" {
+		t.Fatalf("password only: want 401 and no secret, got %d and %q", status, setup.SecretKey)
+	}
+
+	header.Set("X-2FA-Code", nurse.code(t))
+	if status := rawRequest(t, http.MethodGet, "/api/auth/2fa/setup", header, &setup); status != http.StatusOK {
+		t.Fatalf("with the current code: want 200, got %d", status)
+	}
+	if setup.SecretKey == "" || setup.SecretKey == nurse.TOTPSecret {
+		t.Fatalf("setup gave %q, want a fresh secret", setup.SecretKey)
+	}
+	// Until the new secret is enabled, the enrolled one still logs in
+	if err := e2e.newClient().LoginWithCode(ctx, nurse.User.Username, nurse.Password, nurse.Code); err != nil {
+		t.Fatalf("logging in with the enrolled secret after setup: %v", err)
+	}
+}
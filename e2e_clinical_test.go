@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/kinyaelgrande/simple-hospital/apiclient"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+func TestClinical(t *testing.T) {
+	t.Run("doctor records a visit and prescribes", doctorRecordsAndPrescribes)
+	t.Run("nurse sees the nurse view of records", nurseView)
+	t.Run("pharmacist marks prescriptions ready", pharmacistDispenses)
+	t.Run("listings expand the patient and prescriber", expandedListings)
+	t.Run("signed notes take addenda, not edits", signedNotes)
+	t.Run("records follow their visit template", recordTemplates)
+	t.Run("discharge summary collects the stay", dischargeSummary)
+}
+
+func doctorRecordsAndPrescribes(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+
+	patient, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatalf("creating the patient: %v", err)
+	}
+	record, err := doctor.Client.CreateMedicalRecord(ctx, newMedicalRecord(patient.PatientID))
+	if err != nil {
+		t.Fatalf("recording the visit: %v", err)
+	}
+	if record.DoctorID != doctor.User.ID {
+		t.Fatalf("record written by %d, want the doctor %d", record.DoctorID, doctor.User.ID)
+	}
+	prescription, err := doctor.Client.CreatePrescription(ctx, newPrescription(patient.PatientID))
+	if err != nil {
+		t.Fatalf("prescribing: %v", err)
+	}
+	if prescription.MedicationID == nil {
+		t.Fatalf("%q wasn't matched to the medication catalog", prescription.Medication)
+	}
+
+	records, err := doctor.Client.ListPatientMedicalRecords(ctx, patient.PatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].RecordID != record.RecordID || records[0].DoctorNotes == "" {
+		t.Fatalf("the patient's records are %+v, want the visit with its notes", records)
+	}
+	prescriptions, err := doctor.Client.ListPatientPrescriptions(ctx, patient.PatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prescriptions) != 1 || prescriptions[0].PrescriptionID != prescription.PrescriptionID {
+		t.Fatalf("the patient's prescriptions are %+v, want the one written", prescriptions)
+	}
+	if prescriptions[0].Status != models.PRESCRIPTION_STATUS_UNSIGNED {
+		t.Fatalf("the new prescription is %q, want unsigned", prescriptions[0].Status)
+	}
+
+	code := doctor.code(t)
+	if _, err := doctor.Client.SignPrescription(ctx, prescription.PrescriptionID, models.PrescriptionSignature{Code: code}); err != nil {
+		t.Fatalf("signing with a 2FA code: %v", err)
+	}
+	active, err := doctor.Client.ListPrescriptions(ctx, apiclient.PrescriptionQuery{Status: models.PRESCRIPTION_STATUS_ACTIVE}, apiclient.PageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(active.Items, func(p models.Prescription) bool { return p.PrescriptionID == prescription.PrescriptionID }) {
+		t.Fatal("the signed prescription isn't listed with status=active")
+	}
+}
+
+func nurseView(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	nurse := e2e.account(t, models.ROLE_NURSE)
+
+	patient, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := doctor.Client.CreateMedicalRecord(ctx, newMedicalRecord(patient.PatientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen, err := nurse.Client.GetMedicalRecord(ctx, record.RecordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Diagnosis != record.Diagnosis {
+		t.Fatalf("nurse sees diagnosis %q, want %q", seen.Diagnosis, record.Diagnosis)
+	}
+	if seen.TreatmentPlan != "" || seen.DoctorNotes != "" {
+		t.Fatal("nurse sees the treatment plan or doctor notes")
+	}
+}
+
+func pharmacistDispenses(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	pharmacist := e2e.account(t, models.ROLE_PHARMACIST)
+
+	patient, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prescription, err := doctor.Client.CreatePrescription(ctx, newPrescription(patient.PatientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pharmacist.Client.MarkPrescriptionReady(ctx, prescription.PrescriptionID); !apiclient.IsConflict(err) {
+		t.Fatalf("marking an unsigned prescription ready: want 409, got %v", err)
+	}
+	wrong := models.PrescriptionSignature{Password: doctor.Password + "x"}
+	if _, err := doctor.Client.SignPrescription(ctx, prescription.PrescriptionID, wrong); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("signing with a wrong password: want 403, got %v", err)
+	}
+	signed, err := doctor.Client.SignPrescription(ctx, prescription.PrescriptionID, models.PrescriptionSignature{Password: doctor.Password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Status != models.PRESCRIPTION_STATUS_ACTIVE || signed.SignatureHash != signed.ContentHash() {
+		t.Fatalf("signed prescription has status %q and hash %q", signed.Status, signed.SignatureHash)
+	}
+
+	if _, err := nurse.Client.MarkPrescriptionReady(ctx, prescription.PrescriptionID); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("nurse marking ready: want 403, got %v", err)
+	}
+	ready, err := pharmacist.Client.MarkPrescriptionReady(ctx, prescription.PrescriptionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready.Status != models.PRESCRIPTION_STATUS_READY {
+		t.Fatalf("status is %q after marking ready", ready.Status)
+	}
+	if _, err := pharmacist.Client.MarkPrescriptionReady(ctx, prescription.PrescriptionID); !apiclient.IsConflict(err) {
+		t.Fatalf("marking ready twice: want 409, got %v", err)
+	}
+
+	page, err := doctor.Client.ListPrescriptions(ctx, apiclient.PrescriptionQuery{Status: models.PRESCRIPTION_STATUS_READY}, apiclient.PageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(page.Items, func(p models.Prescription) bool { return p.PrescriptionID == prescription.PrescriptionID }) {
+		t.Fatal("the ready prescription isn't listed with status=ready")
+	}
+}
+
+func expandedListings(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	nurse := e2e.account(t, models.ROLE_NURSE)
+
+	patient, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prescription, err := doctor.Client.CreatePrescription(ctx, newPrescription(patient.PatientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := doctor.Client.CreateMedicalRecord(ctx, newMedicalRecord(patient.PatientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := doctor.Client.ListPrescriptions(ctx, apiclient.PrescriptionQuery{
+		DoctorID: doctor.User.ID,
+		Expand:   []string{models.EXPAND_PATIENT, models.EXPAND_DOCTOR},
+	}, apiclient.PageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].PrescriptionID != prescription.PrescriptionID {
+		t.Fatalf("the doctor's prescriptions are %+v, want the one written", page.Items)
+	}
+	listed := page.Items[0]
+	if listed.Patient == nil || listed.Patient.ID != patient.PatientID || listed.Patient.LastName != patient.LastName {
+		t.Fatalf("expanded patient is %+v, want %s", listed.Patient, patient.LastName)
+	}
+	if listed.Doctor == nil || listed.Doctor.ID != doctor.User.ID || listed.Doctor.FullName != doctor.User.FullName {
+		t.Fatalf("expanded prescriber is %+v, want %s", listed.Doctor, doctor.User.FullName)
+	}
+
+	// Without ?expand= the listing keeps its plain shape
+	plain, err := doctor.Client.ListPrescriptions(ctx, apiclient.PrescriptionQuery{DoctorID: doctor.User.ID}, apiclient.PageQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.Items) != 1 || plain.Items[0].Patient != nil || plain.Items[0].Doctor != nil {
+		t.Fatal("the listing expanded without ?expand=")
+	}
+	if _, err := doctor.Client.Do(ctx, http.MethodGet, "/api/prescriptions", url.Values{"expand": {"pharmacy"}}, nil, nil); !hasStatus(err, http.StatusBadRequest) {
+		t.Fatalf("unknown expansion: want 400, got %v", err)
+	}
+
+	var records []models.MedicalRecordNurseView
+	if _, err := nurse.Client.Do(ctx, http.MethodGet, "/api/medical-records", url.Values{"expand": {models.EXPAND_PATIENT}}, nil, &records); err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(records, func(r models.MedicalRecordNurseView) bool { return r.RecordID == record.RecordID })
+	if i < 0 || records[i].Patient == nil || records[i].Patient.ID != patient.PatientID {
+		t.Fatal("the nurse view doesn't expand the record's patient")
+	}
+}
+
+func signedNotes(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	colleague := e2e.account(t, models.ROLE_DOCTOR)
+	patient, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := doctor.Client.CreateMedicalRecord(ctx, newMedicalRecord(patient.PatientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notes, err := doctor.Client.ListNotes(ctx, record.RecordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || notes[0].Body != record.DoctorNotes || notes[0].Author.ID != doctor.User.ID || notes[0].SignedAt != nil {
+		t.Fatalf("the record's notes are %+v, want its doctor_notes as an unsigned note by the doctor", notes)
+	}
+	note := notes[0]
+	if _, err := colleague.Client.UpdateNote(ctx, record.RecordID, note.NoteID, "Overwritten"); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("editing a colleague's note: want 403, got %v", err)
+	}
+	if _, err := doctor.Client.UpdateNote(ctx, record.RecordID, note.NoteID, "Productive cough for a week, chest clear"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doctor.Client.SignNote(ctx, record.RecordID, note.NoteID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doctor.Client.UpdateNote(ctx, record.RecordID, note.NoteID, "Changed after signing"); !hasStatus(err, http.StatusConflict) {
+		t.Fatalf("editing a signed note: want 409, got %v", err)
+	}
+
+	addendum, err := colleague.Client.AddAddendum(ctx, record.RecordID, note.NoteID, "Chest X-ray clear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addendum.AddendumTo == nil || *addendum.AddendumTo != note.NoteID {
+		t.Fatalf("addendum %+v doesn't name the note %d", addendum, note.NoteID)
+	}
+	seen, err := doctor.Client.GetMedicalRecord(ctx, record.RecordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Productive cough for a week, chest clear\n\nChest X-ray clear"; seen.DoctorNotes != want {
+		t.Fatalf("doctor_notes is %q, want %q", seen.DoctorNotes, want)
+	}
+}
+
+func recordTemplates(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	template, err := e2e.admin.Client.SaveRecordTemplate(ctx, &models.RecordTemplate{Code: "asthma_review", Name: "Asthma review", Active: true,
+		Sections: []models.TemplateSection{
+			{Key: "symptoms", Title: "Symptom control", Required: true},
+			{Key: "technique", Title: "Inhaler technique"},
+			{Key: "plan", Title: "Action plan", Required: true},
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err := doctor.Client.ListRecordTemplates(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(templates, func(listed models.RecordTemplate) bool { return listed.Code == template.Code }) {
+		t.Fatalf("the templates listed are %+v, want %s among them", templates, template.Code)
+	}
+
+	patient, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := newMedicalRecord(patient.PatientID)
+	record.TemplateCode = template.Code
+	record.Sections = []models.RecordSection{{Key: "plan", Content: "Step up to a preventer inhaler"}}
+	if _, err := doctor.Client.CreateMedicalRecord(ctx, record); !hasStatus(err, http.StatusUnprocessableEntity) {
+		t.Fatalf("leaving out a required section: want 422, got %v", err)
+	}
+	record.Sections = append(record.Sections, models.RecordSection{Key: "symptoms", Content: "Night waking twice a week"})
+	created, err := doctor.Client.CreateMedicalRecord(ctx, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := doctor.Client.GetMedicalRecord(ctx, created.RecordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, section := range fetched.Sections {
+		keys = append(keys, section.Key)
+	}
+	if fetched.TemplateCode != template.Code || !slices.Equal(keys, []string{"symptoms", "technique", "plan"}) ||
+		fetched.Sections[0].Title != "Symptom control" || fetched.Sections[2].Content != "Step up to a preventer inhaler" {
+		t.Fatalf("the record's sections are %+v, want the template's in order", fetched.Sections)
+	}
+}
+
+func dischargeSummary(t *testing.T) {
+	ctx := t.Context()
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	ward, err := e2e.admin.Client.CreateWard(ctx, &models.Ward{Name: "Discharge Ward"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bed, err := e2e.admin.Client.CreateBed(ctx, ward.WardID, &models.Bed{Label: "D1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patient, err := doctor.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	admission, err := doctor.Client.Admit(ctx, &models.Admission{PatientID: patient.PatientID, BedID: bed.BedID, Reason: "Worsening bronchitis"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := doctor.Client.CreateMedicalRecord(ctx, newMedicalRecord(patient.PatientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prescription, err := doctor.Client.CreatePrescription(ctx, newPrescription(patient.PatientID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := doctor.Client.GenerateDischargeSummary(ctx, admission.AdmissionID, "Review in clinic"); !hasStatus(err, http.StatusConflict) {
+		t.Fatalf("summarizing an open admission: want 409, got %v", err)
+	}
+	if _, err := doctor.Client.Discharge(ctx, admission.AdmissionID, "Improved on antibiotics"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nurse.Client.GenerateDischargeSummary(ctx, admission.AdmissionID, "Review in clinic"); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("nurse generating a summary: want 403, got %v", err)
+	}
+	summary, err := doctor.Client.GenerateDischargeSummary(ctx, admission.AdmissionID, "Review in clinic in two weeks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := summary.Content
+	if content.Admission.Notes != "Improved on antibiotics" || content.Admission.Bed != "D1" || content.FollowUpInstructions != "Review in clinic in two weeks" {
+		t.Fatalf("unexpected admission in the summary: %+v", content)
+	}
+	if len(content.Diagnoses) != 1 || content.Diagnoses[0].RecordID != record.RecordID || len(content.Treatments) != 1 {
+		t.Fatalf("the summary's diagnoses are %+v and treatments %+v, want the visit's", content.Diagnoses, content.Treatments)
+	}
+	if len(content.Prescriptions) != 1 || content.Prescriptions[0].PrescriptionID != prescription.PrescriptionID {
+		t.Fatalf("the summary's prescriptions are %+v, want the one written", content.Prescriptions)
+	}
+
+	summaries, err := nurse.Client.ListDischargeSummaries(ctx, patient.PatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].SummaryID != summary.SummaryID {
+		t.Fatalf("the patient's summaries are %+v, want the one generated", summaries)
+	}
+	document, err := nurse.Client.DischargeSummaryPDF(ctx, summary.SummaryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(document, []byte("%PDF-")) || !bytes.Contains(document, []byte("Review in clinic in two weeks")) {
+		t.Fatalf("the summary's PDF doesn't look right: %.100q", document)
+	}
+}
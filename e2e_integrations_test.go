@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/apiclient"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+func TestIntegrations(t *testing.T) {
+	t.Run("doctors subscribe to their appointments", calendarFeed)
+	t.Run("integrations call only their key's scopes", apiKeys)
+	t.Run("webhooks are sent signed events", webhooks)
+}
+
+func calendarFeed(t *testing.T) {
+	ctx := t.Context()
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	colleague := e2e.account(t, models.ROLE_DOCTOR)
+
+	start := time.Now().UTC().Truncate(time.Hour).Add(48 * time.Hour)
+	shift := models.DutyShift{DoctorID: doctor.User.ID, StartsAt: start, EndsAt: start.Add(8 * time.Hour)}
+	if _, err := e2e.admin.Client.Do(ctx, http.MethodPost, "/api/roster/shifts", nil, shift, nil); err != nil {
+		t.Fatal(err)
+	}
+	registration := newPatient()
+	registration.FirstName, registration.LastName = "Grace", "Hopper"
+	patient, err := nurse.Client.CreatePatient(ctx, registration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appointment, err := nurse.Client.BookAppointment(ctx, &models.Appointment{PatientID: patient.PatientID, DoctorID: doctor.User.ID,
+		StartsAt: start.Add(time.Hour), EndsAt: start.Add(90 * time.Minute), Reason: "Follow-up on biopsy results"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := colleague.Client.IssueCalendarFeed(ctx, doctor.User.ID); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("issuing another doctor's feed: want 403, got %v", err)
+	}
+	feed, err := doctor.Client.IssueCalendarFeed(ctx, doctor.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous := e2e.newClient()
+	calendar, err := anonymous.GetCalendarFeed(ctx, feed.URL)
+	if err != nil {
+		t.Fatalf("fetching the feed without logging in: %v", err)
+	}
+	uid := fmt.Sprintf("UID:appointment-%d@", appointment.AppointmentID)
+	if !bytes.Contains(calendar, []byte(uid)) || !bytes.Contains(calendar, []byte("SUMMARY:Appointment: G.H.\r\n")) ||
+		!bytes.Contains(calendar, []byte("DTSTART:"+start.Add(time.Hour).Format("20060102T150405Z"))) {
+		t.Fatalf("the feed doesn't list the appointment by the patient's initials:\n%s", calendar)
+	}
+	if bytes.Contains(calendar, []byte("Hopper")) || bytes.Contains(calendar, []byte("biopsy")) {
+		t.Fatalf("the feed shows the patient's name or the reason for the visit:\n%s", calendar)
+	}
+	if _, err := anonymous.GetCalendarFeed(ctx, feed.URL+"x"); !hasStatus(err, http.StatusNotFound) {
+		t.Fatalf("fetching the feed with a tampered token: want 404, got %v", err)
+	}
+
+	if _, err := nurse.Client.CancelAppointment(ctx, appointment.AppointmentID); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := doctor.Client.IssueCalendarFeed(ctx, doctor.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anonymous.GetCalendarFeed(ctx, feed.URL); !hasStatus(err, http.StatusNotFound) {
+		t.Fatalf("fetching a replaced feed URL: want 404, got %v", err)
+	}
+	if calendar, err = anonymous.GetCalendarFeed(ctx, replaced.URL); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(calendar, []byte(uid)) || !bytes.Contains(calendar, []byte("STATUS:CANCELLED")) {
+		t.Fatalf("the feed doesn't mark the cancelled appointment:\n%s", calendar)
+	}
+
+	if err := doctor.Client.RevokeCalendarFeed(ctx, doctor.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anonymous.GetCalendarFeed(ctx, replaced.URL); !hasStatus(err, http.StatusNotFound) {
+		t.Fatalf("fetching a revoked feed: want 404, got %v", err)
+	}
+}
+
+func apiKeys(t *testing.T) {
+	ctx := t.Context()
+	analyzer := e2e.account(t, models.ROLE_LAB_TECH)
+	patient, err := e2e.admin.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e2e.admin.Client.IssueAPIKey(ctx, models.APIKeyRequest{UserID: e2e.admin.User.ID, Name: "Admin key",
+		Scopes: []string{models.API_KEY_SCOPE_PATIENTS_READ}}); !hasStatus(err, http.StatusUnprocessableEntity) {
+		t.Fatalf("issuing a key to an admin: want 422, got %v", err)
+	}
+	issued, err := e2e.admin.Client.IssueAPIKey(ctx, models.APIKeyRequest{UserID: analyzer.User.ID, Name: "Chemistry analyzer",
+		Scopes: []string{models.API_KEY_SCOPE_PATIENTS_READ}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.Key == "" || issued.Prefix == "" || issued.Key[:len(issued.Prefix)] != issued.Prefix {
+		t.Fatalf("issued key %q doesn't start with its prefix %q", issued.Key, issued.Prefix)
+	}
+
+	keyed := e2e.newClient(apiclient.WithAPIKey(issued.Key))
+	if _, err := keyed.GetPatient(ctx, patient.PatientID); err != nil {
+		t.Fatalf("reading a patient with the key: %v", err)
+	}
+	if _, err := keyed.CreatePatient(ctx, newPatient()); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("creating a patient outside the key's scopes: want 403, got %v", err)
+	}
+
+	rotated, err := e2e.admin.Client.RotateAPIKey(ctx, issued.KeyID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyed.GetPatient(ctx, patient.PatientID); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("rotated key: want 401, got %v", err)
+	}
+	if _, err := e2e.admin.Client.RotateAPIKey(ctx, issued.KeyID, 0); !hasStatus(err, http.StatusConflict) {
+		t.Fatalf("rotating a rotated key: want 409, got %v", err)
+	}
+	keyed = e2e.newClient(apiclient.WithAPIKey(rotated.Key))
+	if _, err := keyed.GetPatient(ctx, patient.PatientID); err != nil {
+		t.Fatalf("reading a patient with the new key: %v", err)
+	}
+
+	if _, err := e2e.admin.Client.RevokeAPIKey(ctx, rotated.KeyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyed.GetPatient(ctx, patient.PatientID); !hasStatus(err, http.StatusUnauthorized) {
+		t.Fatalf("revoked key: want 401, got %v", err)
+	}
+}
+
+func webhooks(t *testing.T) {
+	ctx := t.Context()
+	const secret = "e2e-webhook-secret-0123456789"
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	request := models.WebhookRequest{Name: "Registry", URL: "http://registry.example.org/hooks", Secret: secret,
+		EventTypes: []string{models.WEBHOOK_PATIENT_CREATED}}
+	if _, err := e2e.admin.Client.CreateWebhook(ctx, request); !hasStatus(err, http.StatusBadRequest) {
+		t.Fatalf("registering a plain HTTP webhook on another host: want 400, got %v", err)
+	}
+	request.URL = receiver.URL
+	webhook, err := e2e.admin.Client.CreateWebhook(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e2e.admin.Client.DeleteWebhook(ctx, webhook.WebhookID)
+
+	patient, err := e2e.admin.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r *http.Request
+	var body []byte
+	select {
+	case r = <-received:
+		body = <-bodies
+	case <-time.After(10 * time.Second):
+		t.Fatal("no webhook delivery within 10 seconds")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.Header.Get("X-Hospital-Timestamp") + "."))
+	mac.Write(body)
+	if r.Header.Get("X-Hospital-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("delivery signature %q doesn't match the body", r.Header.Get("X-Hospital-Signature"))
+	}
+	var payload models.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.EventType != models.WEBHOOK_PATIENT_CREATED || payload.EntityID != patient.PatientID {
+		t.Fatalf("delivered %+v, want patient %d's creation", payload, patient.PatientID)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := e2e.admin.Client.ListWebhookDeliveries(ctx, webhook.WebhookID, models.WEBHOOK_DELIVERY_DELIVERED)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && deliveries[0].DeliveryID == payload.DeliveryID {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivered deliveries are %+v, want delivery %d", deliveries, payload.DeliveryID)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+func TestPatients(t *testing.T) {
+	t.Run("admin streams the patient export", patientExport)
+	t.Run("demographic edits are traced field by field", patientChanges)
+	t.Run("patients opt out of appointment reminders", reminderOptOut)
+	t.Run("walk-ins are called urgent first", walkInQueue)
+	t.Run("claims apply the verified insurance policy", insuranceCoverage)
+	t.Run("events leave out the encrypted fields", eventPayloads)
+}
+
+func patientExport(t *testing.T) {
+	ctx := t.Context()
+	created, err := e2e.admin.Client.CreatePatient(ctx, &models.Patient{FirstName: "Export", LastName: "Patient", DateOfBirth: "1985-03-04",
+		Gender: "Female", Address: "=HYPERLINK(\"https://example.com\")"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	err = e2e.admin.Client.ExportPatients(ctx, func(patient models.Patient) error {
+		found = found || (patient.PatientID == created.PatientID && patient.Address == created.Address)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found {
+		t.Fatal("the export is missing the new patient")
+	}
+
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	if err := doctor.Client.ExportPatients(ctx, func(models.Patient) error { return nil }); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("doctor exporting patients: want 403, got %v", err)
+	}
+}
+
+func patientChanges(t *testing.T) {
+	ctx := t.Context()
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	patient, err := nurse.Client.CreatePatient(ctx, &models.Patient{FirstName: "Traced", LastName: "Patient", DateOfBirth: "1990-07-08",
+		Gender: "Male", ContactInfo: "+15550100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited := *patient
+	edited.ContactInfo = "+15550199"
+	edited.DateOfBirth = "1990-07-08"
+	if _, err := nurse.Client.UpdatePatient(ctx, patient.PatientID, &edited); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := nurse.Client.ListPatientChanges(ctx, patient.PatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want only the phone number's", len(changes))
+	}
+	if change := changes[0]; change.Field != "phone" || change.OldValue != "+15550100" || change.NewValue != "+15550199" ||
+		change.ChangedBy.ID != nurse.User.ID {
+		t.Fatalf("unexpected change %+v", change)
+	}
+}
+
+func reminderOptOut(t *testing.T) {
+	ctx := t.Context()
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	own, err := nurse.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := nurse.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portal := e2e.patientAccount(t, own.PatientID)
+
+	prefs, err := portal.Client.GetReminderPreferences(ctx, own.PatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !prefs.DayBefore || !prefs.HourBefore {
+		t.Fatalf("new patients' preferences are %+v, want both reminders on", prefs)
+	}
+	if _, err := portal.Client.SetReminderPreferences(ctx, own.PatientID, true, false); err != nil {
+		t.Fatalf("opting out of their own reminder: %v", err)
+	}
+	if _, err := portal.Client.SetReminderPreferences(ctx, other.PatientID, false, false); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("opting another patient out: want 403, got %v", err)
+	}
+
+	prefs, err = nurse.Client.GetReminderPreferences(ctx, own.PatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !prefs.DayBefore || prefs.HourBefore || prefs.UpdatedBy == nil || *prefs.UpdatedBy != portal.User.ID {
+		t.Fatalf("the saved preferences are %+v, want only the day-before reminder, set by the patient", prefs)
+	}
+}
+
+func walkInQueue(t *testing.T) {
+	ctx := t.Context()
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	doctor := e2e.account(t, models.ROLE_DOCTOR)
+	department, err := e2e.admin.Client.SaveDepartment(ctx, &models.Department{Code: "walkin", Name: "Walk-in Clinic", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []*models.QueueEntry
+	for _, priority := range []string{models.QUEUE_PRIORITY_NORMAL, models.QUEUE_PRIORITY_NORMAL, models.QUEUE_PRIORITY_URGENT} {
+		patient, err := nurse.Client.CreatePatient(ctx, newPatient())
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := nurse.Client.CheckIn(ctx, department.Code, models.QueueCheckIn{PatientID: patient.PatientID, Priority: priority})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	first, second, urgent := entries[0], entries[1], entries[2]
+	if _, err := nurse.Client.CheckIn(ctx, department.Code, models.QueueCheckIn{PatientID: first.PatientID}); !hasStatus(err, http.StatusConflict) {
+		t.Fatalf("checking a queued patient in again: want 409, got %v", err)
+	}
+
+	queue, err := nurse.Client.GetQueue(ctx, department.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Waiting) != 3 || queue.Waiting[0].EntryID != urgent.EntryID || queue.Waiting[1].EntryID != first.EntryID {
+		t.Fatalf("the queue is %+v, want the urgent patient first, then in check-in order", queue.Waiting)
+	}
+	if *queue.Waiting[0].EstimatedWaitMinutes > *queue.Waiting[2].EstimatedWaitMinutes {
+		t.Fatalf("the first patient's estimated wait is longer than the last's: %+v", queue.Waiting)
+	}
+
+	called, err := doctor.Client.CallNext(ctx, department.Code, "Room 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called.EntryID != urgent.EntryID || called.Status != models.QUEUE_STATUS_CALLED {
+		t.Fatalf("called %+v, want the urgent patient", called)
+	}
+	if called, err = doctor.Client.CallNext(ctx, department.Code, "Room 2"); err != nil {
+		t.Fatal(err)
+	}
+	if called.EntryID != first.EntryID {
+		t.Fatalf("called %+v next, want the first walk-in", called)
+	}
+	if _, err := nurse.Client.LeaveQueue(ctx, second.EntryID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doctor.Client.CallNext(ctx, department.Code, "Room 2"); !hasStatus(err, http.StatusConflict) {
+		t.Fatalf("calling from an empty queue: want 409, got %v", err)
+	}
+
+	queue, err = nurse.Client.GetQueue(ctx, department.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue.Called) != 1 || queue.Called[0].EntryID != first.EntryID || len(queue.Waiting) != 0 {
+		t.Fatalf("the queue is %+v, want only the first walk-in being seen; the urgent patient is done", queue)
+	}
+	board, err := e2e.newClient().GetQueueBoard(ctx, department.Code)
+	if err != nil {
+		t.Fatalf("reading the board without logging in: %v", err)
+	}
+	if len(board.NowServing) != 1 || board.NowServing[0].Ticket != first.Ticket || board.NowServing[0].Room != "Room 2" {
+		t.Fatalf("the board shows %+v, want the first walk-in's ticket in Room 2", board)
+	}
+}
+
+func insuranceCoverage(t *testing.T) {
+	ctx := t.Context()
+	nurse := e2e.account(t, models.ROLE_NURSE)
+	patient, err := nurse.Client.CreatePatient(ctx, newPatient())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := nurse.Client.CreateInsurancePolicy(ctx, patient.PatientID, &models.InsurancePolicy{
+		Payer: "E2E Health", PolicyNumber: "POL-1", CoverageClass: "gold",
+		CoveragePercent: 80, CopayCents: 1000, ValidFrom: "2020-01-01",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.VerificationStatus != models.INSURANCE_STATUS_UNVERIFIED {
+		t.Fatalf("a new policy is %q, want unverified", policy.VerificationStatus)
+	}
+	if _, err := nurse.Client.VerifyInsurancePolicy(ctx, policy.PolicyID, models.INSURANCE_STATUS_VERIFIED, ""); !hasStatus(err, http.StatusForbidden) {
+		t.Fatalf("nurse verifying a policy: want 403, got %v", err)
+	}
+
+	claim := &models.Claim{PatientID: patient.PatientID, Payer: "E2E Health",
+		Items: []models.ClaimItem{{ItemType: "procedure", Code: "E2E-1", AmountCents: 11000}}}
+	draft, err := e2e.admin.Client.CreateClaim(ctx, claim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if draft.PolicyID != nil {
+		t.Fatalf("the unverified policy was linked to a claim")
+	}
+
+	if _, err := e2e.admin.Client.VerifyInsurancePolicy(ctx, policy.PolicyID, models.INSURANCE_STATUS_VERIFIED, "Confirmed by phone"); err != nil {
+		t.Fatal(err)
+	}
+	covered, err := e2e.admin.Client.CreateClaim(ctx, claim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.ClaimCoverage{TotalCents: 11000, CopayCents: 1000, CoveredCents: 8000, PatientResponsibilityCents: 3000}
+	if covered.PolicyID == nil || *covered.PolicyID != policy.PolicyID || covered.Coverage == nil || *covered.Coverage != want {
+		t.Fatalf("claim coverage is %+v under policy %v, want %+v", covered.Coverage, covered.PolicyID, want)
+	}
+}
+
+func eventPayloads(t *testing.T) {
+	ctx := t.Context()
+	registration := newPatient()
+	registration.MedicalHistory = "Asthma since childhood"
+	registration.Allergies = "Penicillin"
+	patient, err := e2e.admin.Client.CreatePatient(ctx, registration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := *patient
+	edited.MedicalHistory += "; inhaler as needed"
+	if _, err := e2e.admin.Client.UpdatePatient(ctx, patient.PatientID, &edited); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []models.ClinicalEvent
+	path := fmt.Sprintf("/api/admin/events?entityType=%s&entityId=%d", models.ENTITY_PATIENT, patient.PatientID)
+	if _, err := e2e.admin.Client.Do(ctx, http.MethodGet, path, nil, nil, &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events for the patient, want its creation and update", len(events))
+	}
+	for _, event := range events {
+		var payload map[string]any
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload["lastName"] != patient.LastName {
+			t.Errorf("%s event payload %v is missing the patient's snapshot", event.EventType, payload)
+		}
+		for _, field := range []string{"medicalHistory", "allergies"} {
+			if _, ok := payload[field]; ok {
+				t.Errorf("%s event payload has the encrypted %s", event.EventType, field)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+// The end-to-end tests serve the whole API in-process, on a temporary
+// SQLite database, and drive it through apiclient as users of each role.
+// Every test shares the one server TestMain starts, so each creates the
+// accounts and records it needs rather than relying on another's.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/apiclient"
+	"github.com/kinyaelgrande/simple-hospital/config"
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/logging"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/pquerna/otp/totp"
+)
+
+// e2e is the server TestMain starts and its bootstrap admin
+var e2e *fixtures
+
+// testEnv is the whole environment the server is configured from: the
+// test's own is cleared first, so a developer's DATABASE_URL or
+// SESSION_REDIS_URL can't point the tests at real data
+var testEnv = map[string]string{
+	"ADMIN_USERNAME": "admin",
+	"ADMIN_PASSWORD": rand.Text(),
+	// Webhooks are polled for often so their test doesn't wait long
+	"WEBHOOK_POLL_INTERVAL": "200ms",
+	"DB_READ_REPLICA":       "true",
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests runs the tests against a server on a temporary database, which
+// is removed afterwards. The server's log is printed if any test fails.
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "hms-e2e-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	var logs lockedBuffer
+	server, stop, err := startServer(dir, &logs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Starting the server failed: %v\n%s", err, logs.String())
+		return 1
+	}
+	defer stop()
+
+	e2e = &fixtures{server: server}
+	if e2e.admin, err = e2e.enroll(context.Background(), testEnv["ADMIN_USERNAME"], testEnv["ADMIN_PASSWORD"]); err != nil {
+		fmt.Fprintf(os.Stderr, "Setting up fixtures failed: admin: %v\n%s", err, logs.String())
+		return 1
+	}
+
+	code := m.Run()
+	if code != 0 {
+		fmt.Fprintf(os.Stderr, "\nServer log:\n%s", logs.String())
+	}
+	return code
+}
+
+// startServer configures the server from testEnv, with its database and
+// files in dir, and serves it with httptest. Logs go to logs.
+func startServer(dir string, logs *lockedBuffer) (*httptest.Server, func(), error) {
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if name != "PATH" && name != "HOME" && name != "TMPDIR" {
+			os.Unsetenv(name)
+		}
+	}
+	for name, value := range testEnv {
+		os.Setenv(name, value)
+	}
+	// Relative paths, such as the document and export directories, land in dir
+	if err := os.Chdir(dir); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := config.Load()
+	logging.Init(logs, false)
+	time.Local = time.UTC
+	timezone.Init(time.UTC)
+	if err := database.Open(cfg.Database); err != nil {
+		return nil, nil, err
+	}
+
+	app, err := newApp(cfg)
+	if err != nil {
+		database.GetDB().Close()
+		return nil, nil, err
+	}
+	if err := seed(context.Background(), cfg, app.seedService, false); err != nil {
+		database.GetDB().Close()
+		return nil, nil, err
+	}
+	workers, stopWorkers := context.WithCancel(context.Background())
+	if err := app.start(workers); err != nil {
+		stopWorkers()
+		database.GetDB().Close()
+		return nil, nil, err
+	}
+
+	server := httptest.NewServer(app.handler)
+	return server, func() {
+		server.Close()
+		stopWorkers()
+		database.GetDB().Close()
+	}, nil
+}
+
+// account is a user the fixtures created and logged in, with an
+// authenticator app enrolled
+type account struct {
+	User       apiclient.User
+	Password   string
+	TOTPSecret string
+	// Client is logged in as the account
+	Client *apiclient.Client
+}
+
+// Code returns the account's current TOTP code, in the shape
+// apiclient.LoginWithCode asks for it
+func (a *account) Code() (string, error) {
+	return totp.GenerateCode(a.TOTPSecret, time.Now())
+}
+
+// code returns the account's current TOTP code
+func (a *account) code(t *testing.T) string {
+	t.Helper()
+	code, err := a.Code()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// fixtures creates accounts on the server, as its bootstrap admin
+type fixtures struct {
+	server *httptest.Server
+	// admin is the bootstrap admin, logged in
+	admin *account
+
+	mutex sync.Mutex
+	next  int
+}
+
+// newClient returns a client for the server that isn't logged in
+func (f *fixtures) newClient(options ...apiclient.Option) *apiclient.Client {
+	options = append([]apiclient.Option{apiclient.WithHTTPClient(f.server.Client())}, options...)
+	return apiclient.New(f.server.URL, options...)
+}
+
+// account creates a staff account with role, e.g. models.ROLE_DOCTOR, and
+// logs it in with its second factor
+func (f *fixtures) account(t *testing.T, role string) *account {
+	t.Helper()
+	user, password := f.createUser(t, &models.User{Role: role})
+	account, err := f.enroll(t.Context(), user.Username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
+
+// patientAccount creates the patient portal account of patientID and logs
+// it in with its second factor
+func (f *fixtures) patientAccount(t *testing.T, patientID int) *account {
+	t.Helper()
+	user, password := f.createUser(t, &models.User{Role: models.ROLE_PATIENT, PatientID: &patientID})
+	account, err := f.enroll(t.Context(), user.Username, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
+
+// createUser creates an account without enrolling a second factor, so it
+// can't log in yet. A blank username or full name is made up from the
+// role. It returns the account and its password.
+func (f *fixtures) createUser(t *testing.T, user *models.User) (*apiclient.User, string) {
+	t.Helper()
+	f.mutex.Lock()
+	f.next++
+	n := f.next
+	f.mutex.Unlock()
+	if user.Username == "" {
+		user.Username = fmt.Sprintf("%s.%d", strings.ToLower(user.Role), n)
+	}
+	if user.FullName == "" {
+		user.FullName = fmt.Sprintf("E2E %s %d", user.Role, n)
+	}
+
+	var created apiclient.User
+	if _, err := f.admin.Client.Do(t.Context(), http.MethodPost, "/api/users", nil, user, &created); err != nil {
+		t.Fatalf("creating %s: %v", user.Username, err)
+	}
+	// The API gives new accounts the initial password <username>123
+	return &created, user.Username + "123"
+}
+
+// enroll sets up an authenticator app for an account, as a new user does
+// with their password before first logging in, then logs in with it
+func (f *fixtures) enroll(ctx context.Context, username, password string) (*account, error) {
+	basic := f.newClient(apiclient.WithBasicAuth(username, password))
+	var setup struct {
+		SecretKey string `json:"secretKey"`
+	}
+	if _, err := basic.Do(ctx, http.MethodGet, "/api/auth/2fa/setup", nil, nil, &setup); err != nil {
+		return nil, fmt.Errorf("2FA setup: %w", err)
+	}
+	account := &account{Password: password, TOTPSecret: setup.SecretKey}
+	code, err := account.Code()
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]string{"secret": setup.SecretKey, "code": code}
+	if _, err := basic.Do(ctx, http.MethodPost, "/api/auth/2fa/enable", nil, body, nil); err != nil {
+		return nil, fmt.Errorf("enabling 2FA: %w", err)
+	}
+
+	account.Client = f.newClient()
+	if err := account.Client.LoginWithCode(ctx, username, password, account.Code); err != nil {
+		return nil, fmt.Errorf("logging in: %w", err)
+	}
+	me, err := account.Client.Me(ctx)
+	if err != nil {
+		return nil, err
+	}
+	account.User = *me
+	return account, nil
+}
+
+// sequence makes the names factories give unique, so records made by
+// different tests never look like duplicates of each other
+var sequence atomic.Int64
+
+// newPatient returns a valid patient registration to adjust and create
+func newPatient() *models.Patient {
+	n := sequence.Add(1)
+	return &models.Patient{
+		FirstName:        "Test",
+		LastName:         fmt.Sprintf("Patient%d", n),
+		DateOfBirth:      "1985-06-15",
+		Gender:           "Female",
+		ContactInfo:      fmt.Sprintf("+1555%07d", n),
+		Address:          "1 Test Street",
+		EmergencyContact: "Next of Kin",
+	}
+}
+
+// newMedicalRecord returns a valid visit record for patientID, dated today,
+// with a treatment plan and notes the nurse view must leave out
+func newMedicalRecord(patientID int) *models.MedicalRecord {
+	return &models.MedicalRecord{
+		PatientID:     patientID,
+		VisitDate:     time.Now().Format("2006-01-02"),
+		Diagnosis:     "Acute bronchitis",
+		TreatmentPlan: "Rest and fluids; review in a week",
+		DoctorNotes:   "Productive cough for five days, chest clear",
+	}
+}
+
+// newPrescription returns a valid prescription for patientID, of a catalog
+// medication with no interactions to warn about
+func newPrescription(patientID int) *models.Prescription {
+	return &models.Prescription{
+		PatientID:    patientID,
+		Medication:   "Amoxicillin",
+		Dosage:       "500 mg",
+		Duration:     "7 days",
+		Instructions: "Three times a day with food",
+	}
+}
+
+// hasStatus reports whether err is an API error with status
+func hasStatus(err error, status int) bool {
+	var apiErr *apiclient.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// lockedBuffer collects the server's log, written from request goroutines
+// while tests run
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// AdminStatsHandler serves the admin dashboard statistics
+type AdminStatsHandler struct {
+	service *services.AdminStatsService
+}
+
+func NewAdminStatsHandler(service *services.AdminStatsService) *AdminStatsHandler {
+	return &AdminStatsHandler{service: service}
+}
+
+// GetStats returns counts and monthly trends for the facility-local dates
+// ?from= to ?to= (YYYY-MM-DD, inclusive). The range defaults to the last 12
+// calendar months and may span at most 5 years. ?top= limits the medications
+// listed (default 10, max 100).
+func (h *AdminStatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	now := timezone.Now()
+	to := timezone.StartOfDay(now)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -11, 0)
+
+	query := r.URL.Query()
+	var err error
+	if value := query.Get("from"); value != "" {
+		if from, err = timezone.ParseDate(value); err != nil {
+			response.WriteError(w, http.StatusBadRequest, "from must be a date (YYYY-MM-DD)")
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = timezone.ParseDate(value); err != nil {
+			response.WriteError(w, http.StatusBadRequest, "to must be a date (YYYY-MM-DD)")
+			return
+		}
+	}
+	if to.Before(from) {
+		response.WriteError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+	if to.After(from.AddDate(5, 0, 0)) {
+		response.WriteError(w, http.StatusBadRequest, "The date range may span at most 5 years")
+		return
+	}
+
+	top := 10
+	if value := query.Get("top"); value != "" {
+		top, err = strconv.Atoi(value)
+		if err != nil || top < 1 || top > 100 {
+			response.WriteError(w, http.StatusBadRequest, "top must be between 1 and 100")
+			return
+		}
+	}
+
+	stats, err := h.service.GetStats(r.Context(), from, to, top)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type AdmissionHandler struct {
+	service *services.AdmissionService
+}
+
+func NewAdmissionHandler() *AdmissionHandler {
+	return &AdmissionHandler{
+		service: services.NewAdmissionService(),
+	}
+}
+
+func (h *AdmissionHandler) CreateWard(w http.ResponseWriter, r *http.Request) {
+	var ward models.Ward
+	if err := json.NewDecoder(r.Body).Decode(&ward); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&ward); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.CreateWard(r.Context(), &ward); err != nil {
+		response.WriteServiceError(w, err, "Ward not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, ward)
+}
+
+// GetWards lists wards with their beds and current occupants
+func (h *AdmissionHandler) GetWards(w http.ResponseWriter, r *http.Request) {
+	wards, err := h.service.GetWards(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, wards)
+}
+
+// CreateBed adds a bed to the ward in the path
+func (h *AdmissionHandler) CreateBed(w http.ResponseWriter, r *http.Request) {
+	wardID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid ward ID")
+		return
+	}
+
+	var bed models.Bed
+	if err := json.NewDecoder(r.Body).Decode(&bed); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&bed); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	bed.WardID = wardID
+	if err := h.service.CreateBed(r.Context(), &bed); err != nil {
+		response.WriteServiceError(w, err, "Ward not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, bed)
+}
+
+// UpdateBed takes a bed out of or back into service: {"outOfService": true}
+func (h *AdmissionHandler) UpdateBed(w http.ResponseWriter, r *http.Request) {
+	bedID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid bed ID")
+		return
+	}
+
+	var req struct {
+		OutOfService bool `json:"outOfService"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.service.SetBedOutOfService(r.Context(), bedID, req.OutOfService); err != nil {
+		if errors.Is(err, services.ErrBedUnavailable) {
+			response.WriteError(w, http.StatusConflict, "Bed is occupied; transfer the patient first")
+			return
+		}
+		response.WriteServiceError(w, err, "Bed not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Admit admits a patient to a free bed
+func (h *AdmissionHandler) Admit(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var admission models.Admission
+	if err := json.NewDecoder(r.Body).Decode(&admission); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&admission); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	admission.AdmittedBy = user.UserID
+	if err := h.service.Admit(r.Context(), &admission); err != nil {
+		writeAdmissionError(w, err, "Patient or bed not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, admission)
+}
+
+// GetAdmissions lists admissions, filtered by ?status=admitted|discharged
+func (h *AdmissionHandler) GetAdmissions(w http.ResponseWriter, r *http.Request) {
+	admissions, err := h.service.GetAdmissions(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, admissions)
+}
+
+func (h *AdmissionHandler) GetAdmission(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid admission ID")
+		return
+	}
+
+	admission, err := h.service.GetAdmission(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Admission not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, admission)
+}
+
+// GetAdmissionsByPatient lists a patient's admissions, newest first
+func (h *AdmissionHandler) GetAdmissionsByPatient(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	admissions, err := h.service.GetAdmissionsByPatient(r.Context(), patientID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, admissions)
+}
+
+// Transfer moves the patient to another bed: {"bedId": 7, "reason": "..."}
+func (h *AdmissionHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid admission ID")
+		return
+	}
+
+	var req struct {
+		BedID  int    `json:"bedId" validate:"required,gt=0"`
+		Reason string `json:"reason" validate:"max=2000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	transfer, err := h.service.Transfer(r.Context(), id, req.BedID, user.UserID, req.Reason)
+	if err != nil {
+		writeAdmissionError(w, err, "Admission or bed not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, transfer)
+}
+
+// Discharge closes the admission with a discharge summary: {"summary": "..."}
+func (h *AdmissionHandler) Discharge(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid admission ID")
+		return
+	}
+
+	var req struct {
+		Summary string `json:"summary" validate:"required,max=10000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	admission, err := h.service.Discharge(r.Context(), id, user.UserID, req.Summary)
+	if err != nil {
+		writeAdmissionError(w, err, "Admission not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, admission)
+}
+
+// GetOccupancy reports occupied and free beds per ward (admins)
+func (h *AdmissionHandler) GetOccupancy(w http.ResponseWriter, r *http.Request) {
+	occupancy, err := h.service.GetOccupancy(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, occupancy)
+}
+
+func writeAdmissionError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrBedUnavailable):
+		response.WriteError(w, http.StatusConflict, "Bed is occupied, out of service or awaiting cleaning")
+	case errors.Is(err, services.ErrAlreadyAdmitted):
+		response.WriteError(w, http.StatusConflict, "Patient is already admitted")
+	case errors.Is(err, services.ErrAdmissionClosed):
+		response.WriteError(w, http.StatusConflict, "Admission is already discharged")
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
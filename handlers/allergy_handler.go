@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// AllergyHandler exposes patients' structured allergy records. Writes are
+// chart edits, so they respect the chart lock.
+type AllergyHandler struct {
+	service *services.AllergyService
+	locks   *services.ChartLockService
+}
+
+func NewAllergyHandler(service *services.AllergyService) *AllergyHandler {
+	return &AllergyHandler{
+		service: service,
+		locks:   services.NewChartLockService(),
+	}
+}
+
+// GetAllergies lists a patient's active allergies; ?includeInactive=true
+// adds the ones marked inactive
+func (h *AllergyHandler) GetAllergies(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	includeInactive := r.URL.Query().Get("includeInactive") == "true"
+	allergies, err := h.service.GetAllergies(r.Context(), patientID, includeInactive)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, allergies)
+}
+
+// AddAllergy records an allergy; it is active unless the body says otherwise
+func (h *AllergyHandler) AddAllergy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	allergy := models.Allergy{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&allergy); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&allergy); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if !chartWritable(w, r, h.locks, patientID, user.UserID) {
+		return
+	}
+
+	allergy.PatientID = patientID
+	if err := h.service.AddAllergy(r.Context(), &allergy, user.UserID); err != nil {
+		writeAllergyError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, allergy)
+}
+
+// UpdateAllergy replaces an allergy's substance, reaction, severity, onset
+// date and active flag
+func (h *AllergyHandler) UpdateAllergy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid allergy ID")
+		return
+	}
+
+	allergy := models.Allergy{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&allergy); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&allergy); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if !chartWritable(w, r, h.locks, patientID, user.UserID) {
+		return
+	}
+
+	updated, err := h.service.UpdateAllergy(r.Context(), patientID, id, &allergy, user.UserID)
+	if err != nil {
+		writeAllergyError(w, err, "Allergy not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, updated)
+}
+
+// DeleteAllergy removes an allergy recorded in error
+func (h *AllergyHandler) DeleteAllergy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid allergy ID")
+		return
+	}
+
+	if !chartWritable(w, r, h.locks, patientID, user.UserID) {
+		return
+	}
+
+	if err := h.service.DeleteAllergy(r.Context(), patientID, id, user.UserID); err != nil {
+		writeAllergyError(w, err, "Allergy not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAllergyError(w http.ResponseWriter, err error, notFoundMessage string) {
+	if errors.Is(err, services.ErrAllergyRecorded) {
+		response.WriteError(w, http.StatusConflict, err.Error())
+		return
+	}
+	response.WriteServiceError(w, err, notFoundMessage)
+}
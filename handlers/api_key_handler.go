@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// APIKeyHandler lets admins issue, rotate and revoke the API keys of
+// machine integrations
+type APIKeyHandler struct {
+	service *services.APIKeyService
+}
+
+func NewAPIKeyHandler(service *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// IssueKey mints a key; the response is the only time the key is shown
+func (h *APIKeyHandler) IssueKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request models.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&request); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	key, err := h.service.Issue(r.Context(), request, user.UserID)
+	if err != nil {
+		writeAPIKeyError(w, err, "User not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	response.WriteJSON(w, http.StatusCreated, key)
+}
+
+// GetKeys lists keys, optionally only those of the userId query parameter
+func (h *APIKeyHandler) GetKeys(w http.ResponseWriter, r *http.Request) {
+	var userID int
+	if raw := r.URL.Query().Get("userId"); raw != "" {
+		var err error
+		if userID, err = strconv.Atoi(raw); err != nil {
+			response.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+	}
+
+	keys, err := h.service.GetKeys(r.Context(), userID)
+	if err != nil {
+		response.WriteServiceError(w, err, "API keys not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) GetKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	key, err := h.service.GetKey(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "API key not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, key)
+}
+
+// GetScopes lists the scopes keys can be issued with and the routes of each
+func (h *APIKeyHandler) GetScopes(w http.ResponseWriter, r *http.Request) {
+	response.WriteJSON(w, http.StatusOK, models.APIKeyScopes())
+}
+
+// RotateKey replaces a key with a new one, returned like an issued key
+func (h *APIKeyHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	var rotation models.APIKeyRotation
+	if err := json.NewDecoder(r.Body).Decode(&rotation); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&rotation); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	key, err := h.service.Rotate(r.Context(), id, rotation.GraceMinutes, user.UserID)
+	if err != nil {
+		writeAPIKeyError(w, err, "API key not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	response.WriteJSON(w, http.StatusCreated, key)
+}
+
+// RevokeKey stops a key working at once
+func (h *APIKeyHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	key, err := h.service.Revoke(r.Context(), id, user.UserID)
+	if err != nil {
+		writeAPIKeyError(w, err, "API key not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, key)
+}
+
+func writeAPIKeyError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyExpiry):
+		response.WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrAPIKeyUser):
+		response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrAPIKeyState):
+		response.WriteError(w, http.StatusConflict, err.Error())
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
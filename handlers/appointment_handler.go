@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type AppointmentHandler struct {
+	service *services.AppointmentService
+}
+
+func NewAppointmentHandler(service *services.AppointmentService) *AppointmentHandler {
+	return &AppointmentHandler{service: service}
+}
+
+// Suggest returns the doctor a booking for ?startsAt= to ?endsAt= would be
+// assigned, optionally requiring ?specialty=, with the load of every doctor
+// considered
+func (h *AppointmentHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("startsAt") == "" || query.Get("endsAt") == "" {
+		response.WriteError(w, http.StatusBadRequest, "startsAt and endsAt are required")
+		return
+	}
+	start, ok := parseTimeParam(w, query.Get("startsAt"), "startsAt", time.Time{})
+	if !ok {
+		return
+	}
+	end, ok := parseTimeParam(w, query.Get("endsAt"), "endsAt", time.Time{})
+	if !ok {
+		return
+	}
+	if !end.After(start) {
+		response.WriteError(w, http.StatusBadRequest, "endsAt must be after startsAt")
+		return
+	}
+
+	suggestion, err := h.service.Suggest(r.Context(), query.Get("specialty"), start, end)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, suggestion)
+}
+
+// Book books an appointment. Leaving out doctorId assigns the suggested
+// doctor; naming one overrides the suggestion.
+func (h *AppointmentHandler) Book(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var appointment models.Appointment
+	if err := json.NewDecoder(r.Body).Decode(&appointment); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	if err := validation.Struct(&appointment); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	appointment.BookedBy = user.UserID
+	if err := h.service.Book(r.Context(), &appointment); err != nil {
+		writeAppointmentError(w, err, "Patient or doctor not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, appointment)
+}
+
+// GetAppointments lists appointments, filtered by ?doctorId=, ?patientId=,
+// ?department=, ?status= and the ?from= to ?to= window
+func (h *AppointmentHandler) GetAppointments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filter services.AppointmentFilter
+	var ok bool
+
+	if filter.From, ok = parseTimeParam(w, query.Get("from"), "from", time.Time{}); !ok {
+		return
+	}
+	if filter.To, ok = parseTimeParam(w, query.Get("to"), "to", time.Time{}); !ok {
+		return
+	}
+
+	filter.Department = query.Get("department")
+	filter.Status = query.Get("status")
+	switch filter.Status {
+	case "", models.APPOINTMENT_STATUS_SCHEDULED, models.APPOINTMENT_STATUS_CANCELLED, models.APPOINTMENT_STATUS_COMPLETED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be scheduled, cancelled or completed")
+		return
+	}
+
+	for name, target := range map[string]*int{"doctorId": &filter.DoctorID, "patientId": &filter.PatientID} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		*target = id
+	}
+
+	appointments, err := h.service.GetAppointments(r.Context(), filter)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, appointments)
+}
+
+// GetSchedule returns the clinic schedule for the facility-local day ?date=
+// (YYYY-MM-DD; default today), optionally for one ?doctorId=, with each
+// patient's interpreter booking
+func (h *AppointmentHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	day := timezone.StartOfDay(time.Now())
+	if value := query.Get("date"); value != "" {
+		var err error
+		if day, err = timezone.ParseDate(value); err != nil {
+			response.WriteError(w, http.StatusBadRequest, "date must be YYYY-MM-DD")
+			return
+		}
+	}
+
+	var doctorID int
+	if value := query.Get("doctorId"); value != "" {
+		var err error
+		doctorID, err = strconv.Atoi(value)
+		if err != nil || doctorID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid doctorId")
+			return
+		}
+	}
+
+	schedule, err := h.service.GetSchedule(r.Context(), day, doctorID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, schedule)
+}
+
+func (h *AppointmentHandler) GetAppointment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid appointment ID")
+		return
+	}
+
+	appointment, err := h.service.GetAppointment(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Appointment not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, appointment)
+}
+
+func (h *AppointmentHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid appointment ID")
+		return
+	}
+
+	appointment, err := h.service.Cancel(r.Context(), id)
+	if err != nil {
+		writeAppointmentError(w, err, "Appointment not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, appointment)
+}
+
+func writeAppointmentError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrDoctorBooked):
+		response.WriteError(w, http.StatusConflict, "Doctor already has an appointment at this time")
+	case errors.Is(err, services.ErrNoDoctorAvailable):
+		response.WriteError(w, http.StatusConflict, "No qualified doctor is on duty and free at this time")
+	case errors.Is(err, services.ErrOffDuty):
+		response.WriteError(w, http.StatusConflict, "Doctor is not working at this time; see their availability")
+	case errors.Is(err, services.ErrAppointmentClosed):
+		response.WriteError(w, http.StatusConflict, "Appointment is no longer scheduled")
+	default:
+		writeRosterError(w, err, notFoundMessage)
+	}
+}
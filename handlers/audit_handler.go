@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// AuditHandler serves integrity checks on the audit log
+type AuditHandler struct {
+	service *services.AuditService
+}
+
+func NewAuditHandler(service *services.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// VerifyChain walks the audit log's hash chain and reports whether it is
+// intact or the first entry where it breaks. A broken chain is still a 200;
+// valid says which.
+func (h *AuditHandler) VerifyChain(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.VerifyChain(r.Context())
+	if err != nil {
+		response.WriteServiceError(w, err, "Audit log not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// BackupHandler takes, lists and restores database backups (admins)
+type BackupHandler struct {
+	service *services.BackupService
+}
+
+func NewBackupHandler(service *services.BackupService) *BackupHandler {
+	return &BackupHandler{service: service}
+}
+
+// CreateBackup backs up the database now
+func (h *BackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	backup, err := h.service.Create(r.Context(), user.UserID)
+	if err != nil {
+		writeBackupError(w, err)
+		return
+	}
+	response.WriteJSON(w, http.StatusCreated, backup)
+}
+
+// GetBackups lists the backups, newest first
+func (h *BackupHandler) GetBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.service.List(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, backups)
+}
+
+// RestoreBackup replaces the database with the named backup. The response
+// names the backup taken just before, which undoes the restore.
+func (h *BackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	restore, err := h.service.Restore(r.Context(), mux.Vars(r)["name"], user.UserID)
+	if err != nil {
+		writeBackupError(w, err)
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, restore)
+}
+
+func writeBackupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownBackup):
+		response.WriteError(w, http.StatusNotFound, "Backup not found")
+	case errors.Is(err, services.ErrBackupUnsupported):
+		response.WriteError(w, http.StatusNotImplemented, err.Error())
+	default:
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type BreakGlassHandler struct {
+	service *services.BreakGlassService
+}
+
+func NewBreakGlassHandler(service *services.BreakGlassService) *BreakGlassHandler {
+	return &BreakGlassHandler{service: service}
+}
+
+// BreakGlass grants the caller emergency access to a patient's full
+// medical records for a limited time
+func (h *BreakGlassHandler) BreakGlass(w http.ResponseWriter, r *http.Request) {
+	var access models.BreakGlassAccess
+	if err := json.NewDecoder(r.Body).Decode(&access); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	access.Reason = strings.TrimSpace(access.Reason)
+
+	if err := validation.Struct(&access); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.service.Grant(r.Context(), user, &access); err != nil {
+		if errors.Is(err, services.ErrBreakGlassRole) {
+			response.WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, access)
+}
+
+// GetBreakGlassAccess lists grants for review, newest first; ?active=true
+// leaves out expired ones
+func (h *BreakGlassHandler) GetBreakGlassAccess(w http.ResponseWriter, r *http.Request) {
+	grants, err := h.service.List(r.Context(), r.URL.Query().Get("active") == "true")
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, grants)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// CalendarFeedHandler lets doctors subscribe to their appointments from a
+// phone calendar. Doctors issue and revoke their own feed URL; admins can
+// do either for any doctor.
+type CalendarFeedHandler struct {
+	service *services.CalendarFeedService
+}
+
+func NewCalendarFeedHandler(service *services.CalendarFeedService) *CalendarFeedHandler {
+	return &CalendarFeedHandler{service: service}
+}
+
+// IssueFeed mints a new feed URL, invalidating the doctor's previous one
+func (h *CalendarFeedHandler) IssueFeed(w http.ResponseWriter, r *http.Request) {
+	user, doctorID, ok := feedOwner(w, r)
+	if !ok {
+		return
+	}
+
+	feed, err := h.service.Issue(r.Context(), doctorID, user.UserID)
+	if err != nil {
+		writeRosterError(w, err, "Doctor not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, feed)
+}
+
+func (h *CalendarFeedHandler) RevokeFeed(w http.ResponseWriter, r *http.Request) {
+	user, doctorID, ok := feedOwner(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Revoke(r.Context(), doctorID, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Calendar feed not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFeed serves the iCalendar file. It needs no credentials: the signed
+// token in the URL is one, since calendar apps can't log in.
+func (h *CalendarFeedHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	doctorID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid doctor ID")
+		return
+	}
+
+	body, err := h.service.Feed(r.Context(), doctorID, r.URL.Query().Get("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidFeedToken) {
+			response.WriteError(w, http.StatusNotFound, "Calendar feed is invalid or has been revoked")
+			return
+		}
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="appointments.ics"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The token is in the URL; keep it out of Referer headers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// feedOwner reads the doctor from the path, writing a 403 unless the user
+// is that doctor or an admin
+func feedOwner(w http.ResponseWriter, r *http.Request) (*models.User, int, bool) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, 0, false
+	}
+
+	doctorID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid doctor ID")
+		return nil, 0, false
+	}
+	if user.Role != models.ROLE_ADMIN && user.UserID != doctorID {
+		response.WriteError(w, http.StatusForbidden, "Doctors can only manage their own calendar feed")
+		return nil, 0, false
+	}
+	return user, doctorID, true
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+const (
+	// changeHeartbeat keeps idle streams from being closed by proxies
+	changeHeartbeat = 25 * time.Second
+	// maxChangeStream ends each stream after this long so the client
+	// reconnects and is authenticated again, e.g. after logging out
+	maxChangeStream = 30 * time.Minute
+	// changeReplayLimit bounds how many missed changes a reconnecting client
+	// is sent; beyond that it is told to reload instead
+	changeReplayLimit = 500
+)
+
+// ChangeStreamHandler streams live entity changes as server-sent events
+type ChangeStreamHandler struct {
+	bus    *services.ChangeBus
+	events *services.EventService
+}
+
+func NewChangeStreamHandler(bus *services.ChangeBus, events *services.EventService) *ChangeStreamHandler {
+	return &ChangeStreamHandler{bus: bus, events: events}
+}
+
+// Stream sends each committed change the caller's role may see as an SSE
+// message whose data is the change and whose id is the event ID. ?types=
+// limits it to a comma-separated list of entity types. A client
+// reconnecting with Last-Event-ID is first sent the changes it missed, or a
+// "reset" event if there are too many, meaning it should reload its lists.
+func (h *ChangeStreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	lastID := 0
+	if value := r.Header.Get("Last-Event-ID"); value != "" {
+		var err error
+		if lastID, err = strconv.Atoi(value); err != nil || lastID < 0 {
+			response.WriteError(w, http.StatusBadRequest, "Last-Event-ID must be an event ID")
+			return
+		}
+	}
+	types := map[string]bool{}
+	if value := r.URL.Query().Get("types"); value != "" {
+		for _, entityType := range strings.Split(value, ",") {
+			types[strings.TrimSpace(entityType)] = true
+		}
+	}
+	visible := func(change models.EntityChange) bool {
+		return models.SeesChanges(user.Role, change.EntityType) && (len(types) == 0 || types[change.EntityType])
+	}
+
+	// Subscribe before replaying so nothing committed in between is missed
+	sub := h.bus.Subscribe()
+	defer sub.Unsubscribe()
+
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(change models.EntityChange) error {
+		data, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", change.EventID, data); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+
+	if lastID > 0 {
+		missed, err := h.events.GetEvents(r.Context(), "", 0, lastID, changeReplayLimit)
+		if err != nil {
+			return
+		}
+		if len(missed) == changeReplayLimit {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+			missed = nil
+		}
+		for _, event := range missed {
+			change := models.EntityChange{EventID: event.EventID, EntityType: event.EntityType, EntityID: event.EntityID,
+				EventType: event.EventType, OccurredAt: event.OccurredAt}
+			if visible(change) {
+				if err := send(change); err != nil {
+					return
+				}
+			}
+			lastID = event.EventID
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(changeHeartbeat)
+	defer heartbeat.Stop()
+	expired := time.After(maxChangeStream)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil || controller.Flush() != nil {
+				return
+			}
+		case change, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if change.EventID <= lastID || !visible(change) {
+				continue
+			}
+			if err := send(change); err != nil {
+				return
+			}
+		}
+	}
+}
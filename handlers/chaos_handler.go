@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// ChaosHandler manages fault-injection rules (DEV_MODE only)
+type ChaosHandler struct {
+	chaos *middleware.Chaos
+}
+
+func NewChaosHandler(chaos *middleware.Chaos) *ChaosHandler {
+	return &ChaosHandler{chaos: chaos}
+}
+
+// ListRules returns the active fault-injection rules
+func (h *ChaosHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	response.WriteJSON(w, http.StatusOK, h.chaos.Rules())
+}
+
+// AddRule activates a rule, e.g.
+// {"pathPrefix": "/api/patients", "methods": ["GET"], "latencyMs": 2000, "errorRate": 0.3, "errorStatus": 503, "dropRate": 0.1}
+func (h *ChaosHandler) AddRule(w http.ResponseWriter, r *http.Request) {
+	var rule middleware.ChaosRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	rule, err := h.chaos.AddRule(rule)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, rule)
+}
+
+// DeleteRule deactivates a single rule
+func (h *ChaosHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid rule ID")
+		return
+	}
+
+	if !h.chaos.RemoveRule(id) {
+		response.WriteError(w, http.StatusNotFound, "Rule not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClearRules deactivates every rule
+func (h *ChaosHandler) ClearRules(w http.ResponseWriter, r *http.Request) {
+	h.chaos.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// ChartLockHandler exposes the advisory edit lock on a patient's chart
+type ChartLockHandler struct {
+	service *services.ChartLockService
+}
+
+func NewChartLockHandler() *ChartLockHandler {
+	return &ChartLockHandler{
+		service: services.NewChartLockService(),
+	}
+}
+
+// GetLock shows who is editing the chart, if anyone
+func (h *ChartLockHandler) GetLock(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	lock, err := h.service.Get(r.Context(), patientID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Chart is not locked")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, lock)
+}
+
+// AcquireLock takes the lock, or refreshes it when called again by the holder
+func (h *ChartLockHandler) AcquireLock(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	lock, err := h.service.Acquire(r.Context(), patientID, user.UserID)
+	if err != nil {
+		writeChartLockError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, lock)
+}
+
+// ReleaseLock drops the holder's lock; admins can release anyone's
+func (h *ChartLockHandler) ReleaseLock(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	err = h.service.Release(r.Context(), patientID, user.UserID, user.Role == models.ROLE_ADMIN)
+	if err != nil {
+		if errors.Is(err, services.ErrNotLockHolder) {
+			response.WriteError(w, http.StatusForbidden, "Only the holder can release this lock; request a takeover instead")
+			return
+		}
+		response.WriteServiceError(w, err, "Chart is not locked")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequestTakeover asks the holder to hand over the chart
+func (h *ChartLockHandler) RequestTakeover(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	lock, err := h.service.RequestTakeover(r.Context(), patientID, user.UserID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Chart is not locked")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusAccepted, lock)
+}
+
+// chartWritable reports whether the user may write to the patient's chart,
+// writing the error response if not
+func chartWritable(w http.ResponseWriter, r *http.Request, locks *services.ChartLockService, patientID, userID int) bool {
+	if err := locks.CheckWritable(r.Context(), patientID, userID); err != nil {
+		writeChartLockError(w, err, "Patient not found")
+		return false
+	}
+	return true
+}
+
+// writeChartLockError reports a chart locked by someone else as 409 chart_locked
+// with the lock in the details, so clients can show who is editing
+func writeChartLockError(w http.ResponseWriter, err error, notFoundMessage string) {
+	var locked *services.ChartLockedError
+	if errors.As(err, &locked) {
+		response.WriteErrorDetails(w, http.StatusConflict, "chart_locked", locked.Error(),
+			map[string]any{"lock": locked.Lock})
+		return
+	}
+	response.WriteServiceError(w, err, notFoundMessage)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type ClaimHandler struct {
+	service *services.ClaimService
+}
+
+func NewClaimHandler(service *services.ClaimService) *ClaimHandler {
+	return &ClaimHandler{service: service}
+}
+
+// CreateClaim drafts a claim
+func (h *ClaimHandler) CreateClaim(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var claim models.Claim
+	if err := json.NewDecoder(r.Body).Decode(&claim); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&claim); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	claim.CreatedBy = user.UserID
+	if err := h.service.CreateClaim(r.Context(), &claim); err != nil {
+		switch {
+		case errors.Is(err, services.ErrPreAuthMismatch):
+			response.WriteError(w, http.StatusUnprocessableEntity, "preAuthId does not cover this patient, payer and item")
+		case errors.Is(err, services.ErrEncounterMismatch):
+			response.WriteError(w, http.StatusUnprocessableEntity, "encounterId is not a completed encounter of this patient")
+		case errors.Is(err, services.ErrPolicyMismatch):
+			response.WriteError(w, http.StatusUnprocessableEntity, "policyId is not this patient's policy with the payer")
+		default:
+			response.WriteServiceError(w, err, "Patient not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, claim)
+}
+
+// GetClaims lists claims, filtered by ?status=draft|submitted
+func (h *ClaimHandler) GetClaims(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != models.CLAIM_STATUS_DRAFT && status != models.CLAIM_STATUS_SUBMITTED {
+		response.WriteError(w, http.StatusBadRequest, "status must be draft or submitted")
+		return
+	}
+
+	claims, err := h.service.GetClaims(r.Context(), status)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, claims)
+}
+
+func (h *ClaimHandler) GetClaim(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid claim ID")
+		return
+	}
+
+	claim, err := h.service.GetClaim(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Claim not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, claim)
+}
+
+// SubmitClaim submits a draft claim; items that need pre-authorization must
+// have an approval, an encounter that must be coded must be coded and a
+// linked insurance policy must be verified
+func (h *ClaimHandler) SubmitClaim(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid claim ID")
+		return
+	}
+
+	claim, err := h.service.SubmitClaim(r.Context(), id, user.UserID)
+	if err != nil {
+		var missing *services.PreAuthMissingError
+		var uncoded *services.CodingIncompleteError
+		switch {
+		case errors.As(err, &uncoded):
+			response.WriteErrorDetails(w, http.StatusConflict, "coding_incomplete",
+				"The claim's encounter must be coded before submission",
+				map[string]any{"encounterType": uncoded.EncounterType, "encounterId": uncoded.EncounterID, "status": uncoded.Status})
+		case errors.As(err, &missing):
+			response.WriteErrorDetails(w, http.StatusConflict, "preauth_required",
+				"Claim items need an approved pre-authorization before submission",
+				map[string]any{"items": missing.Items})
+		case errors.Is(err, services.ErrClaimSubmitted):
+			response.WriteError(w, http.StatusConflict, "Claim has already been submitted")
+		case errors.Is(err, services.ErrPolicyNotVerified):
+			response.WriteError(w, http.StatusConflict, "The claim's insurance policy must be verified before submission")
+		default:
+			response.WriteServiceError(w, err, "Claim not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, claim)
+}
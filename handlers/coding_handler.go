@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type CodingHandler struct {
+	service *services.CodingService
+}
+
+func NewCodingHandler(service *services.CodingService) *CodingHandler {
+	return &CodingHandler{service: service}
+}
+
+// GetWorklist lists the encounters waiting for a coder, filtered by
+// ?encounterType=outpatient|inpatient
+func (h *CodingHandler) GetWorklist(w http.ResponseWriter, r *http.Request) {
+	encounterType := r.URL.Query().Get("encounterType")
+	if encounterType != "" && !validEncounterType(encounterType) {
+		response.WriteError(w, http.StatusBadRequest, "encounterType must be outpatient or inpatient")
+		return
+	}
+
+	encounters, err := h.service.GetWorklist(r.Context(), encounterType)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, encounters)
+}
+
+// GetQueries lists the open coding queries on the doctor's encounters;
+// admins see every doctor's, or one doctor's with ?doctorId=
+func (h *CodingHandler) GetQueries(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	doctorID := user.UserID
+	if user.Role == models.ROLE_ADMIN {
+		doctorID = 0
+		if value := r.URL.Query().Get("doctorId"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				response.WriteError(w, http.StatusBadRequest, "Invalid doctor ID")
+				return
+			}
+			doctorID = id
+		}
+	}
+
+	encounters, err := h.service.GetQueries(r.Context(), doctorID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, encounters)
+}
+
+func (h *CodingHandler) GetEncounter(w http.ResponseWriter, r *http.Request) {
+	encounterType, id, ok := encounterFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	encounter, err := h.service.GetEncounter(r.Context(), encounterType, id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Encounter not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, encounter)
+}
+
+// AssignCodes records the encounter's ICD-10 diagnosis and procedure codes
+func (h *CodingHandler) AssignCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	encounterType, id, ok := encounterFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var codes models.EncounterCodes
+	if err := json.NewDecoder(r.Body).Decode(&codes); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&codes); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	encounter, err := h.service.AssignCodes(r.Context(), encounterType, id, codes, user.UserID)
+	if err != nil {
+		writeCodingError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, encounter)
+}
+
+// Query sends the encounter back to its doctor with the coder's question
+func (h *CodingHandler) Query(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	encounterType, id, ok := encounterFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Question string `json:"question" validate:"required,max=2000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	encounter, err := h.service.Query(r.Context(), encounterType, id, req.Question, user.UserID)
+	if err != nil {
+		writeCodingError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, encounter)
+}
+
+// Respond answers a coding query on one of the doctor's encounters; admins
+// can answer for any doctor
+func (h *CodingHandler) Respond(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	encounterType, id, ok := encounterFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Response string `json:"response" validate:"required,max=2000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	encounter, err := h.service.Respond(r.Context(), encounterType, id, req.Response, user.UserID, user.Role == models.ROLE_ADMIN)
+	if err != nil {
+		writeCodingError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, encounter)
+}
+
+// encounterFromPath reads the {type} and {id} path variables, writing a 400
+// when either is invalid
+func encounterFromPath(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	vars := mux.Vars(r)
+	if !validEncounterType(vars["type"]) {
+		response.WriteError(w, http.StatusBadRequest, "Encounter type must be outpatient or inpatient")
+		return "", 0, false
+	}
+
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid encounter ID")
+		return "", 0, false
+	}
+	return vars["type"], id, true
+}
+
+func validEncounterType(encounterType string) bool {
+	return encounterType == models.ENCOUNTER_OUTPATIENT || encounterType == models.ENCOUNTER_INPATIENT
+}
+
+func writeCodingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrCodingQueried):
+		response.WriteError(w, http.StatusConflict, "Encounter is waiting for the doctor to answer a coding query")
+	case errors.Is(err, services.ErrCodingNotQueried):
+		response.WriteError(w, http.StatusConflict, "Encounter has no open coding query")
+	case errors.Is(err, services.ErrNotEncounterDoctor):
+		response.WriteError(w, http.StatusForbidden, "Only the encounter's doctor can answer its coding query")
+	default:
+		response.WriteServiceError(w, err, "Encounter not found")
+	}
+}
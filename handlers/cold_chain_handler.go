@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// SensorKeyHeader carries a storage unit's sensor key on reading uploads
+const SensorKeyHeader = "X-Sensor-Key"
+
+type ColdChainHandler struct {
+	service *services.ColdChainService
+}
+
+func NewColdChainHandler(service *services.ColdChainService) *ColdChainHandler {
+	return &ColdChainHandler{service: service}
+}
+
+// RecordReadingsRequest is a batch of readings uploaded by one sensor
+type RecordReadingsRequest struct {
+	Readings []models.TemperatureReading `json:"readings" validate:"required,min=1,max=1000,dive"`
+}
+
+// ThresholdsRequest sets a storage unit's acceptable range in °C
+type ThresholdsRequest struct {
+	MinTemp *float64 `json:"minTemp" validate:"required"`
+	MaxTemp *float64 `json:"maxTemp" validate:"required"`
+}
+
+// RecordReadings ingests readings from a fridge sensor, authenticated by
+// its sensor key rather than a user
+func (h *ColdChainHandler) RecordReadings(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(SensorKeyHeader)
+	if key == "" {
+		response.WriteError(w, http.StatusUnauthorized, "Sensor key required")
+		return
+	}
+
+	var req RecordReadingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	excursions, err := h.service.RecordReadings(r.Context(), key, req.Readings)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSensorKey) {
+			response.WriteError(w, http.StatusUnauthorized, "Invalid sensor key")
+			return
+		}
+		response.WriteServiceError(w, err, "Storage unit not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, map[string]any{
+		"recorded":   len(req.Readings),
+		"excursions": excursions,
+	})
+}
+
+// CreateUnit registers a storage unit; the response carries its sensor key
+func (h *ColdChainHandler) CreateUnit(w http.ResponseWriter, r *http.Request) {
+	var unit models.StorageUnit
+	if err := json.NewDecoder(r.Body).Decode(&unit); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&unit); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	unit.OpenExcursion = nil
+	if err := h.service.CreateUnit(r.Context(), &unit); err != nil {
+		writeColdChainError(w, err, "Storage unit not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, unit)
+}
+
+// GetUnits lists storage units and whether each is currently out of range
+func (h *ColdChainHandler) GetUnits(w http.ResponseWriter, r *http.Request) {
+	units, err := h.service.GetUnits(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, units)
+}
+
+// SetThresholds changes a unit's acceptable range for future readings
+func (h *ColdChainHandler) SetThresholds(w http.ResponseWriter, r *http.Request) {
+	unitID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid storage unit ID")
+		return
+	}
+
+	var req ThresholdsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.SetThresholds(r.Context(), unitID, *req.MinTemp, *req.MaxTemp); err != nil {
+		writeColdChainError(w, err, "Storage unit not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateSensorKey issues a new sensor key for a unit, revoking the old one
+func (h *ColdChainHandler) RotateSensorKey(w http.ResponseWriter, r *http.Request) {
+	unitID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid storage unit ID")
+		return
+	}
+
+	key, err := h.service.RotateSensorKey(r.Context(), unitID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Storage unit not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, map[string]string{"sensorKey": key})
+}
+
+// GetReadings lists a unit's readings, by default for the last 24 hours.
+// ?since= takes an RFC 3339 time.
+func (h *ColdChainHandler) GetReadings(w http.ResponseWriter, r *http.Request) {
+	unitID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid storage unit ID")
+		return
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			response.WriteError(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+	}
+
+	readings, err := h.service.GetReadings(r.Context(), unitID, since)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, readings)
+}
+
+// GetExcursions lists a unit's excursions
+func (h *ColdChainHandler) GetExcursions(w http.ResponseWriter, r *http.Request) {
+	unitID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid storage unit ID")
+		return
+	}
+
+	excursions, err := h.service.GetExcursions(r.Context(), unitID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, excursions)
+}
+
+// GetAlerts lists excursions pharmacy staff have not yet acknowledged
+func (h *ColdChainHandler) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := h.service.GetAlerts(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, alerts)
+}
+
+// AcknowledgeExcursion clears an alert: {"notes": "..."}
+func (h *ColdChainHandler) AcknowledgeExcursion(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	excursionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid excursion ID")
+		return
+	}
+
+	var req struct {
+		Notes string `json:"notes" validate:"max=2000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	excursion, err := h.service.Acknowledge(r.Context(), excursionID, user.UserID, req.Notes)
+	if err != nil {
+		response.WriteServiceError(w, err, "Excursion not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, excursion)
+}
+
+// GetExcursionReport returns an excursion's readings and affected batches
+func (h *ColdChainHandler) GetExcursionReport(w http.ResponseWriter, r *http.Request) {
+	excursionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid excursion ID")
+		return
+	}
+
+	report, err := h.service.GetExcursionReport(r.Context(), excursionID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Excursion not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, report)
+}
+
+// CreateBatch records a vaccine batch placed in a storage unit
+func (h *ColdChainHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	var batch models.VaccineBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&batch); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	batch.Quarantined = false
+	if err := h.service.CreateBatch(r.Context(), &batch); err != nil {
+		response.WriteServiceError(w, err, "Storage unit not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, batch)
+}
+
+// GetBatches lists vaccine batches, filtered by ?unitId=
+func (h *ColdChainHandler) GetBatches(w http.ResponseWriter, r *http.Request) {
+	unitID := 0
+	if value := r.URL.Query().Get("unitId"); value != "" {
+		var err error
+		unitID, err = strconv.Atoi(value)
+		if err != nil || unitID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid storage unit ID")
+			return
+		}
+	}
+
+	batches, err := h.service.GetBatches(r.Context(), unitID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, batches)
+}
+
+// QuarantineBatch quarantines or releases a batch: {"quarantined": true}
+func (h *ColdChainHandler) QuarantineBatch(w http.ResponseWriter, r *http.Request) {
+	batchID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid batch ID")
+		return
+	}
+
+	var req struct {
+		Quarantined bool `json:"quarantined"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.service.SetQuarantined(r.Context(), batchID, req.Quarantined); err != nil {
+		response.WriteServiceError(w, err, "Batch not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeColdChainError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidThresholds):
+		response.WriteError(w, http.StatusUnprocessableEntity, "Minimum temperature must be below maximum")
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
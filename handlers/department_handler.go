@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// DepartmentHandler manages departments and who is assigned to them
+type DepartmentHandler struct {
+	service *services.DepartmentService
+}
+
+func NewDepartmentHandler(service *services.DepartmentService) *DepartmentHandler {
+	return &DepartmentHandler{service: service}
+}
+
+// GetDepartments lists the departments, including retired ones
+func (h *DepartmentHandler) GetDepartments(w http.ResponseWriter, r *http.Request) {
+	departments, err := h.service.GetDepartments(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, departments)
+}
+
+// SaveDepartment creates or updates the department named in the path (admins)
+func (h *DepartmentHandler) SaveDepartment(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Departments are active unless the body retires them with "active": false
+	department := models.Department{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&department); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	department.Code = mux.Vars(r)["code"]
+
+	if err := validation.Struct(&department); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.SaveDepartment(r.Context(), &department, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Department not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, department)
+}
+
+// GetMembers lists the staff assigned to a department, filtered by ?role=
+func (h *DepartmentHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	role := r.URL.Query().Get("role")
+	if role != "" {
+		canonical, ok := models.CanonicalRole(role)
+		if !ok {
+			response.WriteError(w, http.StatusBadRequest, "Invalid role")
+			return
+		}
+		role = canonical
+	}
+
+	members, err := h.service.GetMembers(r.Context(), mux.Vars(r)["code"], role)
+	if err != nil {
+		response.WriteServiceError(w, err, "Department not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, members)
+}
+
+// GetUserDepartments lists the departments a user is assigned to (admins)
+func (h *DepartmentHandler) GetUserDepartments(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	departments, err := h.service.GetUserDepartments(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "User not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, departments)
+}
+
+// SetUserDepartments replaces a staff member's departments (admins):
+// {"departments": ["cardiology"]}
+func (h *DepartmentHandler) SetUserDepartments(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req struct {
+		Departments []string `json:"departments" validate:"required,max=20,dive,required,max=50"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	departments, err := h.service.SetUserDepartments(r.Context(), id, req.Departments, admin.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownDepartment), errors.Is(err, services.ErrDepartmentInactive),
+			errors.Is(err, services.ErrPatientDepartment):
+			validation.WriteError(w, validation.Errors{{Field: "departments", Message: err.Error()}})
+		default:
+			response.WriteServiceError(w, err, "User not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, departments)
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// DeprecationHandler lists the deprecated routes and how much they are still used
+type DeprecationHandler struct {
+	deprecations *middleware.Deprecations
+}
+
+func NewDeprecationHandler(deprecations *middleware.Deprecations) *DeprecationHandler {
+	return &DeprecationHandler{deprecations: deprecations}
+}
+
+// ListDeprecations returns every deprecated route with its sunset date and usage
+func (h *DeprecationHandler) ListDeprecations(w http.ResponseWriter, r *http.Request) {
+	response.WriteJSON(w, http.StatusOK, h.deprecations.List())
+}
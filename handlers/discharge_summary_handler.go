@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// DischargeSummaryHandler generates discharge summaries for admissions and
+// serves the saved ones as JSON or PDF
+type DischargeSummaryHandler struct {
+	service *services.DischargeSummaryService
+}
+
+func NewDischargeSummaryHandler(service *services.DischargeSummaryService) *DischargeSummaryHandler {
+	return &DischargeSummaryHandler{service: service}
+}
+
+// Generate summarizes the discharged admission in the path, with the
+// caller's follow-up instructions
+func (h *DischargeSummaryHandler) Generate(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	admissionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid admission ID")
+		return
+	}
+
+	var req models.DischargeSummaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	summary, err := h.service.Generate(r.Context(), admissionID, req, user.UserID)
+	if err != nil {
+		if errors.Is(err, services.ErrAdmissionOpen) {
+			response.WriteError(w, http.StatusConflict, err.Error())
+			return
+		}
+		response.WriteServiceError(w, err, "Admission not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusCreated, summary)
+}
+
+// GetPatientSummaries lists the patient's discharge summaries, newest first
+func (h *DischargeSummaryHandler) GetPatientSummaries(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	summaries, err := h.service.GetSummaries(r.Context(), patientID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, summaries)
+}
+
+func (h *DischargeSummaryHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid discharge summary ID")
+		return
+	}
+
+	summary, err := h.service.GetSummary(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Discharge summary not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, summary)
+}
+
+// GetSummaryPDF sends the saved summary rendered as a PDF
+func (h *DischargeSummaryHandler) GetSummaryPDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid discharge summary ID")
+		return
+	}
+
+	download, err := h.service.DownloadSummary(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Discharge summary not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", download.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(download.Body)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download.Filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(download.Body)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type DocumentHandler struct {
+	service  *services.DocumentService
+	locks    *services.ChartLockService
+	maxBytes int64
+}
+
+// NewDocumentHandler accepts uploads of up to maxBytes
+func NewDocumentHandler(service *services.DocumentService, maxBytes int64) *DocumentHandler {
+	return &DocumentHandler{
+		service:  service,
+		locks:    services.NewChartLockService(),
+		maxBytes: maxBytes,
+	}
+}
+
+// UploadDocument attaches a file to the patient in the path. The multipart
+// form carries the file in "file" and optional "recordId" and "description".
+func (h *DocumentHandler) UploadDocument(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	// Leave room for the form's other fields and part headers
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes+64<<10)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Documents are limited to %d bytes", h.maxBytes))
+			return
+		}
+		response.WriteError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		validation.WriteError(w, validation.Errors{{Field: "file", Message: "file is required"}})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.maxBytes+1))
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	if int64(len(data)) > h.maxBytes {
+		response.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Documents are limited to %d bytes", h.maxBytes))
+		return
+	}
+
+	doc := models.Document{
+		PatientID:   patientID,
+		Filename:    header.Filename,
+		Description: r.FormValue("description"),
+		UploadedBy:  user.UserID,
+	}
+	if len(doc.Description) > 500 {
+		validation.WriteError(w, validation.Errors{{Field: "description", Message: "description must be at most 500 characters"}})
+		return
+	}
+	if value := r.FormValue("recordId"); value != "" {
+		recordID, err := strconv.Atoi(value)
+		if err != nil || recordID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid medical record ID")
+			return
+		}
+		doc.RecordID = &recordID
+	}
+
+	if !chartWritable(w, r, h.locks, patientID, user.UserID) {
+		return
+	}
+
+	if err := h.service.Upload(r.Context(), &doc, data); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnsupportedDocumentType):
+			response.WriteError(w, http.StatusUnsupportedMediaType, "Documents must be PDF, JPEG, PNG, GIF, WebP, BMP or TIFF files")
+		case errors.Is(err, services.ErrDocumentRecordMismatch):
+			response.WriteError(w, http.StatusUnprocessableEntity, "Medical record belongs to a different patient")
+		default:
+			response.WriteServiceError(w, err, "Patient or medical record not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, doc)
+}
+
+// GetPatientDocuments lists a patient's documents, filtered by ?recordId=
+func (h *DocumentHandler) GetPatientDocuments(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	recordID := 0
+	if value := r.URL.Query().Get("recordId"); value != "" {
+		recordID, err = strconv.Atoi(value)
+		if err != nil || recordID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid medical record ID")
+			return
+		}
+	}
+
+	documents, err := h.service.GetDocuments(r.Context(), patientID, recordID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, documents)
+}
+
+// GetRecordDocuments lists the documents attached to a medical record
+func (h *DocumentHandler) GetRecordDocuments(w http.ResponseWriter, r *http.Request) {
+	recordID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid medical record ID")
+		return
+	}
+
+	documents, err := h.service.GetRecordDocuments(r.Context(), recordID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, documents)
+}
+
+func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	doc, err := h.service.GetDocument(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Document not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, doc)
+}
+
+// GetDocumentContent streams the file. Browsers should mint a download
+// token instead, since navigations can't carry an Authorization header.
+func (h *DocumentHandler) GetDocumentContent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	doc, body, err := h.service.OpenDocument(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Document not found")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", doc.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(doc.SizeBytes, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", doc.Filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid document ID")
+		return
+	}
+
+	doc, err := h.service.GetDocument(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Document not found")
+		return
+	}
+	if !chartWritable(w, r, h.locks, doc.PatientID, user.UserID) {
+		return
+	}
+
+	if err := h.service.DeleteDocument(r.Context(), id, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Document not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
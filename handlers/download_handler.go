@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// DownloadHandler mints download tokens for authenticated users and serves
+// the files to browser navigations that present one
+type DownloadHandler struct {
+	service  *services.DownloadService
+	sessions session.Store
+}
+
+func NewDownloadHandler(service *services.DownloadService, sessions session.Store) *DownloadHandler {
+	return &DownloadHandler{service: service, sessions: sessions}
+}
+
+// CreateToken mints a single-use link: {"kind": "prescriptions", "resourceId": 12}
+func (h *DownloadHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Kind       string `json:"kind" validate:"required,max=50"`
+		ResourceID int    `json:"resourceId" validate:"required,gt=0"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	token, err := h.service.Issue(r.Context(), user, req.Kind, req.ResourceID, session.IDFromRequest(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownDownload):
+			response.WriteError(w, http.StatusBadRequest, "Unknown download kind")
+		case errors.Is(err, services.ErrDownloadForbidden):
+			response.WriteError(w, http.StatusForbidden, "Insufficient permissions")
+		default:
+			response.WriteError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, token)
+}
+
+// Download redeems a token from the URL. It needs no credentials: the token
+// is one, and it stops working after one use, a minute, or the session ending.
+func (h *DownloadHandler) Download(w http.ResponseWriter, r *http.Request) {
+	sessionActive := func(sessionID string) bool {
+		_, ok := h.sessions.Get(sessionID)
+		return ok
+	}
+
+	download, err := h.service.Redeem(r.Context(), mux.Vars(r)["token"], sessionActive)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidDownloadToken) {
+			response.WriteError(w, http.StatusNotFound, "Download link is invalid or has expired")
+			return
+		}
+		response.WriteServiceError(w, err, "File not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", download.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", download.Filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The token is in the URL; keep it out of Referer headers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	w.Write(download.Body)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+type EventHandler struct {
+	service *services.EventService
+}
+
+func NewEventHandler() *EventHandler {
+	return &EventHandler{
+		service: services.NewEventService(),
+	}
+}
+
+// GetEvents lists clinical events, filtered by ?entityType=&entityId= and
+// paged with ?after=<last event id>&limit=
+func (h *EventHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	entityID, _ := strconv.Atoi(query.Get("entityId"))
+	afterID, _ := strconv.Atoi(query.Get("after"))
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	events, err := h.service.GetEvents(r.Context(), query.Get("entityType"), entityID, afterID, limit)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, events)
+}
+
+// GetProjection rebuilds one entity's state from its event history
+func (h *EventHandler) GetProjection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	entityID, err := strconv.Atoi(vars["entityId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid entity ID")
+		return
+	}
+
+	projection, err := h.service.Project(r.Context(), vars["entityType"], entityID)
+	if err != nil {
+		response.WriteServiceError(w, err, "No events found for entity")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, projection)
+}
+
+// Replay replays the full event log for ?entityType= and returns every projection
+func (h *EventHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	entityType := r.URL.Query().Get("entityType")
+	if entityType == "" {
+		response.WriteError(w, http.StatusBadRequest, "entityType is required")
+		return
+	}
+
+	projections, err := h.service.Replay(r.Context(), entityType)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, projections)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// parseExpand reads the comma-separated ?expand= of a listing, which may
+// name the related records in allowed (models.EXPAND_ values). On an
+// unknown name it writes a 400 and returns false.
+func parseExpand(w http.ResponseWriter, r *http.Request, allowed ...string) (models.Expand, bool) {
+	var expand models.Expand
+	value := r.URL.Query().Get("expand")
+	if value == "" {
+		return expand, true
+	}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == models.EXPAND_PATIENT && slices.Contains(allowed, name):
+			expand.Patient = true
+		case name == models.EXPAND_DOCTOR && slices.Contains(allowed, name):
+			expand.Doctor = true
+		default:
+			response.WriteError(w, http.StatusBadRequest, "expand may only name "+strings.Join(allowed, " and "))
+			return expand, false
+		}
+	}
+	return expand, true
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// ExportHandler starts bulk exports and serves their chunks (admins)
+type ExportHandler struct {
+	service *services.ExportService
+}
+
+func NewExportHandler(service *services.ExportService) *ExportHandler {
+	return &ExportHandler{service: service}
+}
+
+// StartExport starts an export in the background: {"kind": "audit-log"}.
+// Poll the manifest for its chunks.
+func (h *ExportHandler) StartExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Kind string `json:"kind" validate:"required,max=50"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	export, err := h.service.Start(r.Context(), req.Kind, user.UserID)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownExport) {
+			response.WriteError(w, http.StatusBadRequest, "Unknown export kind")
+			return
+		}
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/admin/exports/%d", export.ExportID))
+	response.WriteJSON(w, http.StatusAccepted, export)
+}
+
+func (h *ExportHandler) GetExports(w http.ResponseWriter, r *http.Request) {
+	exports, err := h.service.GetExports(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, exports)
+}
+
+// GetExport returns the export's manifest
+func (h *ExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	export, err := h.service.GetExport(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Export not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, export)
+}
+
+// GetChunk serves one chunk file. Range and If-Range requests resume an
+// interrupted download; the ETag is the chunk's SHA-256.
+func (h *ExportHandler) GetChunk(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid chunk index")
+		return
+	}
+
+	export, err := h.service.GetExport(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Export not found")
+		return
+	}
+
+	file, chunk, err := h.service.OpenChunk(r.Context(), id, index, user.UserID, r.Header.Get("Range") != "")
+	if err != nil {
+		response.WriteServiceError(w, err, "Chunk not found")
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", services.ChunkFilename(export.Kind, id, index)))
+	w.Header().Set("ETag", `"`+chunk.SHA256+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", export.CreatedAt, file)
+}
+
+// DeleteExport removes a finished export and its files
+func (h *ExportHandler) DeleteExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	if err := h.service.DeleteExport(r.Context(), id, user.UserID); err != nil {
+		if errors.Is(err, services.ErrExportRunning) {
+			response.WriteError(w, http.StatusConflict, "Export is still running")
+			return
+		}
+		response.WriteServiceError(w, err, "Export not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// HealthHandler serves the liveness and readiness checks orchestrators poll
+// (no auth required)
+type HealthHandler struct {
+	service *services.HealthService
+}
+
+func NewHealthHandler(service *services.HealthService) *HealthHandler {
+	return &HealthHandler{service: service}
+}
+
+// Live answers 200 whenever the process can serve HTTP at all. It checks no
+// dependencies, so an outage of the database doesn't get the server restarted.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	response.WriteJSON(w, http.StatusOK, map[string]any{
+		"status":    models.HEALTH_STATUS_OK,
+		"checkedAt": time.Now(),
+	})
+}
+
+// Ready checks the database and disk, answering 200 when they all pass and
+// 503 otherwise, so traffic is only routed to a server that can handle it
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.service.Ready(r.Context())
+	status := http.StatusOK
+	if report.Status != models.HEALTH_STATUS_OK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	response.WriteJSON(w, status, report)
+}
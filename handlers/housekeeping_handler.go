@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type HousekeepingHandler struct {
+	service *services.HousekeepingService
+}
+
+func NewHousekeepingHandler(service *services.HousekeepingService) *HousekeepingHandler {
+	return &HousekeepingHandler{service: service}
+}
+
+// GetTasks lists housekeeping tasks, filtered by
+// ?status=pending|in_progress|completed and ?wardId=. Without a status it
+// lists the outstanding tasks.
+func (h *HousekeepingHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.HOUSEKEEPING_STATUS_PENDING, models.HOUSEKEEPING_STATUS_IN_PROGRESS, models.HOUSEKEEPING_STATUS_COMPLETED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be pending, in_progress or completed")
+		return
+	}
+
+	wardID := 0
+	if value := r.URL.Query().Get("wardId"); value != "" {
+		var err error
+		wardID, err = strconv.Atoi(value)
+		if err != nil || wardID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid ward ID")
+			return
+		}
+	}
+
+	tasks, err := h.service.GetTasks(r.Context(), status, wardID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, tasks)
+}
+
+func (h *HousekeepingHandler) GetTask(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid housekeeping task ID")
+		return
+	}
+
+	task, err := h.service.GetTask(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Housekeeping task not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, task)
+}
+
+// StartCleaning marks the task in progress
+func (h *HousekeepingHandler) StartCleaning(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid housekeeping task ID")
+		return
+	}
+
+	task, err := h.service.StartCleaning(r.Context(), id, user.UserID)
+	if err != nil {
+		if errors.Is(err, services.ErrHousekeepingTaskState) {
+			response.WriteError(w, http.StatusConflict, "Cleaning has already started")
+			return
+		}
+		response.WriteServiceError(w, err, "Housekeeping task not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, task)
+}
+
+// CompleteCleaning marks the task completed, releasing the bed: {"notes": "..."}
+func (h *HousekeepingHandler) CompleteCleaning(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid housekeeping task ID")
+		return
+	}
+
+	var req struct {
+		Notes string `json:"notes" validate:"max=2000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	task, err := h.service.CompleteCleaning(r.Context(), id, user.UserID, req.Notes)
+	if err != nil {
+		if errors.Is(err, services.ErrHousekeepingTaskState) {
+			response.WriteError(w, http.StatusConflict, "Cleaning is already completed")
+			return
+		}
+		response.WriteServiceError(w, err, "Housekeeping task not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, task)
+}
+
+// GetTurnover reports bed turnover per ward (admins). ?from= and ?to= take
+// RFC 3339 or facility-local times and default to the last 30 days.
+func (h *HousekeepingHandler) GetTurnover(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	from, ok := parseTimeParam(w, r.URL.Query().Get("from"), "from", now.AddDate(0, 0, -30))
+	if !ok {
+		return
+	}
+	to, ok := parseTimeParam(w, r.URL.Query().Get("to"), "to", now)
+	if !ok {
+		return
+	}
+	if !from.Before(to) {
+		response.WriteError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	report, err := h.service.GetTurnover(r.Context(), from, to)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, report)
+}
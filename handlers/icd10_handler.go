@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+type ICD10Handler struct {
+	service *services.ICD10Service
+}
+
+func NewICD10Handler(service *services.ICD10Service) *ICD10Handler {
+	return &ICD10Handler{service: service}
+}
+
+// Search is the diagnosis code typeahead: codes matching ?q= by code prefix
+// or description, at most ?limit= of them (default 20, at most 100)
+func (h *ICD10Handler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		response.WriteError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 100 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+	}
+
+	codes, err := h.service.Search(r.Context(), q, limit)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, codes)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// InsuranceHandler records patients' insurance policies and their
+// verification with the payer
+type InsuranceHandler struct {
+	service *services.InsuranceService
+}
+
+func NewInsuranceHandler(service *services.InsuranceService) *InsuranceHandler {
+	return &InsuranceHandler{service: service}
+}
+
+// CreatePolicy adds a policy to a patient; it applies to claims once verified
+func (h *InsuranceHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var policy models.InsurancePolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&policy); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	policy.PatientID = patientID
+	policy.CreatedBy = user.UserID
+	if err := h.service.CreatePolicy(r.Context(), &policy); err != nil {
+		writeInsuranceError(w, err, "Patient not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusCreated, policy)
+}
+
+// GetPolicies lists a patient's policies, latest starting first
+func (h *InsuranceHandler) GetPolicies(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	policies, err := h.service.GetPolicies(r.Context(), patientID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, policies)
+}
+
+func (h *InsuranceHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid policy ID")
+		return
+	}
+
+	policy, err := h.service.GetPolicy(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Policy not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, policy)
+}
+
+// UpdatePolicy replaces a policy's details, which sets it back to unverified
+func (h *InsuranceHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid policy ID")
+		return
+	}
+
+	var policy models.InsurancePolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&policy); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	updated, err := h.service.UpdatePolicy(r.Context(), id, &policy, user.UserID)
+	if err != nil {
+		writeInsuranceError(w, err, "Policy not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, updated)
+}
+
+// VerifyPolicy records the payer's confirmation or rejection of a policy
+func (h *InsuranceHandler) VerifyPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid policy ID")
+		return
+	}
+
+	var verification models.InsuranceVerification
+	if err := json.NewDecoder(r.Body).Decode(&verification); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&verification); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	policy, err := h.service.Verify(r.Context(), id, verification, user.UserID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Policy not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, policy)
+}
+
+func writeInsuranceError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrPolicyDates):
+		response.WriteError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
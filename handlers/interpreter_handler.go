@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type InterpreterHandler struct {
+	service *services.InterpreterService
+}
+
+func NewInterpreterHandler(service *services.InterpreterService) *InterpreterHandler {
+	return &InterpreterHandler{service: service}
+}
+
+// CreateInterpreter adds an interpreter to the roster (admins)
+func (h *InterpreterHandler) CreateInterpreter(w http.ResponseWriter, r *http.Request) {
+	interpreter := models.Interpreter{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&interpreter); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&interpreter); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.CreateInterpreter(r.Context(), &interpreter); err != nil {
+		response.WriteServiceError(w, err, "Interpreter not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, interpreter)
+}
+
+// UpdateInterpreter replaces an interpreter's details; "active": false takes
+// them off the roster for new bookings (admins)
+func (h *InterpreterHandler) UpdateInterpreter(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid interpreter ID")
+		return
+	}
+
+	interpreter := models.Interpreter{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&interpreter); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&interpreter); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.UpdateInterpreter(r.Context(), id, &interpreter); err != nil {
+		response.WriteServiceError(w, err, "Interpreter not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, interpreter)
+}
+
+// GetInterpreters lists the roster; ?language= lists only the active
+// interpreters who speak it
+func (h *InterpreterHandler) GetInterpreters(w http.ResponseWriter, r *http.Request) {
+	interpreters, err := h.service.GetInterpreters(r.Context(), r.URL.Query().Get("language"))
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, interpreters)
+}
+
+// GetBookings lists interpreter bookings, filtered by ?status=; use
+// ?status=requested for the agency requests still awaiting confirmation
+func (h *InterpreterHandler) GetBookings(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.INTERPRETER_STATUS_RESERVED, models.INTERPRETER_STATUS_REQUESTED, models.INTERPRETER_STATUS_CONFIRMED,
+		models.INTERPRETER_STATUS_CANCELLED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be reserved, requested, confirmed or cancelled")
+		return
+	}
+
+	bookings, err := h.service.GetBookings(r.Context(), status)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, bookings)
+}
+
+// Confirm records the agency's confirmation of a request with its reference
+func (h *InterpreterHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid booking ID")
+		return
+	}
+
+	var req struct {
+		Reference string `json:"reference" validate:"required,max=100"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	booking, err := h.service.Confirm(r.Context(), id, req.Reference)
+	if err != nil {
+		if errors.Is(err, services.ErrInterpreterBookingState) {
+			response.WriteError(w, http.StatusConflict, "Only requested external bookings can be confirmed")
+			return
+		}
+		response.WriteServiceError(w, err, "Interpreter booking not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, booking)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type LabHandler struct {
+	service *services.LabService
+}
+
+func NewLabHandler() *LabHandler {
+	return &LabHandler{
+		service: services.NewLabService(),
+	}
+}
+
+// CreateLabOrder orders a test for the medical record in the body (doctors)
+func (h *LabHandler) CreateLabOrder(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var order models.LabOrder
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&order); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	order.OrderedBy = user.UserID
+	if err := h.service.CreateLabOrder(r.Context(), &order); err != nil {
+		response.WriteServiceError(w, err, "Medical record not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, order)
+}
+
+// GetLabOrders lists lab orders, filtered by ?status=
+func (h *LabHandler) GetLabOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := h.service.GetLabOrders(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, orders)
+}
+
+func (h *LabHandler) GetLabOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid lab order ID")
+		return
+	}
+
+	order, err := h.service.GetLabOrder(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Lab order not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, order)
+}
+
+// AddResults posts results for an order and completes it (lab staff)
+func (h *LabHandler) AddResults(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid lab order ID")
+		return
+	}
+
+	var req struct {
+		Results []models.LabResult `json:"results" validate:"required,min=1,dive"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	results, err := h.service.AddResults(r.Context(), id, user.UserID, req.Results)
+	if err != nil {
+		if errors.Is(err, services.ErrLabOrderClosed) {
+			response.WriteError(w, http.StatusConflict, "Lab order already has results or was cancelled")
+			return
+		}
+		response.WriteServiceError(w, err, "Lab order not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, results)
+}
+
+// GetLabOrdersByPatient lists a patient's orders with their results, newest first
+func (h *LabHandler) GetLabOrdersByPatient(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	orders, err := h.service.GetLabOrdersByPatient(r.Context(), patientID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, orders)
+}
+
+// GetLabOrdersByRecord lists the orders placed from a medical record
+func (h *LabHandler) GetLabOrdersByRecord(w http.ResponseWriter, r *http.Request) {
+	recordID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid record ID")
+		return
+	}
+
+	orders, err := h.service.GetLabOrdersByRecord(r.Context(), recordID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, orders)
+}
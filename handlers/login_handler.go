@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
-	"strings"
 
+	"github.com/kinyaelgrande/simple-hospital/dto"
 	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
 )
 
 type AuthHandler struct{}
@@ -21,23 +21,15 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// The user is already in the context from middleware
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "Authentication failed", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "Authentication failed")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	response := map[string]interface{}{
+	body := map[string]interface{}{
 		"message": "Login successful",
-		"user": map[string]interface{}{
-			"id":               user.UserID,
-			"username":         user.Username,
-			"role":             strings.ToLower(user.Role),
-			"fullName":         user.FullName,
-			"twoFactorEnabled": user.TwoFAEnabled,
-		},
+		"user":    dto.NewUser(user),
 	}
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusOK, body)
 }
 
 // Logout endpoint - clears authentication by sending 401 with WWW-Authenticate header
@@ -45,29 +37,25 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	// Clear any cached credentials by sending a 401 response
 	// This forces the browser to forget Basic Auth credentials
 	w.Header().Set("WWW-Authenticate", "Basic realm=\"Hospital System - Logged Out\"")
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusUnauthorized)
 
-	response := map[string]interface{}{
+	body := map[string]interface{}{
 		"message": "Logged out successfully",
 		"status":  "unauthorized",
 		"action":  "Please close browser or use incognito mode for complete logout",
 	}
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusUnauthorized, body)
 }
 
 // ClearAuth endpoint - alternative logout method that returns success but instructs browser cleanup
 func (h *AuthHandler) ClearAuth(w http.ResponseWriter, r *http.Request) {
 	// Return success but with instructions to clear browser cache
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Clear-Site-Data", "\"cache\", \"cookies\", \"storage\"")
-	w.WriteHeader(http.StatusOK)
 
-	response := map[string]interface{}{
+	body := map[string]interface{}{
 		"message":     "Authentication cleared",
 		"success":     true,
 		"instruction": "Browser authentication cache should be cleared",
 		"note":        "For complete logout, close browser or use incognito mode",
 	}
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusOK, body)
 }
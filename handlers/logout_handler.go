@@ -1,11 +1,11 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
 )
 
 type LogoutHandler struct {
@@ -40,7 +40,6 @@ func (h *LogoutHandler) BasicAuthLogout(w http.ResponseWriter, r *http.Request)
 
 	// Force browser to forget credentials with 401 and new realm
 	w.Header().Set("WWW-Authenticate", "Basic realm=\"Hospital System - Logged Out - Please Re-authenticate\"")
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
@@ -48,9 +47,7 @@ func (h *LogoutHandler) BasicAuthLogout(w http.ResponseWriter, r *http.Request)
 	// Try to clear site data (modern browsers)
 	w.Header().Set("Clear-Site-Data", "\"cache\", \"cookies\", \"storage\", \"executionContexts\"")
 
-	w.WriteHeader(http.StatusUnauthorized)
-
-	response := LogoutResponse{
+	body := LogoutResponse{
 		Message:   "User " + username + " logged out successfully",
 		Success:   true,
 		Method:    "basic_auth_invalidation",
@@ -62,7 +59,7 @@ func (h *LogoutHandler) BasicAuthLogout(w http.ResponseWriter, r *http.Request)
 		},
 	}
 
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusUnauthorized, body)
 }
 
 // SoftLogout provides a "soft" logout that doesn't force 401
@@ -75,15 +72,12 @@ func (h *LogoutHandler) SoftLogout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set headers to prevent caching
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
 	w.Header().Set("Clear-Site-Data", "\"cache\", \"cookies\", \"storage\"")
 
-	w.WriteHeader(http.StatusOK)
-
-	response := LogoutResponse{
+	body := LogoutResponse{
 		Message:   "User " + username + " logout initiated",
 		Success:   true,
 		Method:    "soft_logout",
@@ -95,7 +89,7 @@ func (h *LogoutHandler) SoftLogout(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusOK, body)
 }
 
 // ForceLogout aggressively tries to clear all authentication
@@ -111,7 +105,6 @@ func (h *LogoutHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set aggressive cache clearing headers
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate, private")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "Thu, 01 Jan 1970 00:00:00 GMT")
@@ -124,9 +117,7 @@ func (h *LogoutHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Frame-Options", "DENY")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
-	w.WriteHeader(http.StatusUnauthorized)
-
-	response := LogoutResponse{
+	body := LogoutResponse{
 		Message:   "User " + username + " forcibly logged out",
 		Success:   true,
 		Method:    "force_logout",
@@ -139,7 +130,7 @@ func (h *LogoutHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusUnauthorized, body)
 }
 
 // LogoutStatus checks if a user/session has been logged out
@@ -168,8 +159,7 @@ func (h *LogoutHandler) LogoutStatus(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	response.WriteJSON(w, http.StatusOK, status)
 }
 
 // ClearInvalidatedSessions cleans up old invalidated sessions (maintenance)
@@ -204,12 +194,9 @@ func (h *LogoutHandler) LogoutWithRedirect(w http.ResponseWriter, r *http.Reques
 
 	// Clear authentication
 	w.Header().Set("WWW-Authenticate", "Basic realm=\"Logged Out - Redirecting\"")
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Clear-Site-Data", "\"cache\", \"cookies\", \"storage\"")
 
-	w.WriteHeader(http.StatusUnauthorized)
-
-	response := map[string]interface{}{
+	body := map[string]interface{}{
 		"message":      "User " + username + " logged out",
 		"success":      true,
 		"redirect_url": redirectURL,
@@ -221,7 +208,7 @@ func (h *LogoutHandler) LogoutWithRedirect(w http.ResponseWriter, r *http.Reques
 		},
 	}
 
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusUnauthorized, body)
 }
 
 // IsSessionInvalidated checks if a session key has been invalidated
@@ -1,25 +1,32 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/dto"
 	"github.com/kinyaelgrande/simple-hospital/middleware"
 	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
 	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
 )
 
 type MedicalRecordHandler struct {
-	service *services.MedicalRecordService
+	service    *services.MedicalRecordService
+	breakGlass *services.BreakGlassService
+	locks      *services.ChartLockService
 }
 
-func NewMedicalRecordHandler() *MedicalRecordHandler {
+func NewMedicalRecordHandler(service *services.MedicalRecordService, breakGlass *services.BreakGlassService) *MedicalRecordHandler {
 	return &MedicalRecordHandler{
-		service: services.NewMedicalRecordService(),
+		service:    service,
+		breakGlass: breakGlass,
+		locks:      services.NewChartLockService(),
 	}
 }
 
@@ -28,55 +35,58 @@ func (h *MedicalRecordHandler) CreateMedicalRecord(w http.ResponseWriter, r *htt
 
 	var record models.MedicalRecord
 	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if err := h.service.CreateMedicalRecord(&record); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
+	if record.DoctorID == 0 {
+		record.DoctorID = user.UserID
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(record)
-}
-
-func (h *MedicalRecordHandler) GetMedicalRecords(w http.ResponseWriter, r *http.Request) {
-	// middleware.RequireRole(models.ROLE_DOCTOR, models.ROLE_NURSE)
-
-	// user, ok := middleware.GetUserFromContext(r)
-	// if !ok {
-	// 	fmt.Printf("GetMedicalRecords: User not authenticated\n")
-	// 	http.Error(w, "User not authenticated", http.StatusUnauthorized)
-	// 	return
-	// }
-
-	// fmt.Printf("GetMedicalRecords: User role = %s\n", user.Role)
+	if err := validation.Struct(&record); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+	if !chartWritable(w, r, h.locks, record.PatientID, user.UserID) {
+		return
+	}
 
-	var (
-		records interface{}
-		err     error
-	)
+	if err := h.service.CreateMedicalRecord(r.Context(), &record); err != nil {
+		if errors.Is(err, services.ErrUnknownDiagnosisCode) || isTemplateError(err) {
+			response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrUnknownPatient) {
+			validation.WriteError(w, validation.Errors{{Field: "patient_id", Message: "patient_id must reference an existing patient"}})
+			return
+		}
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
 
-	records, err = h.service.GetNurseViewRecords()
+	dto.WriteJSON(w, r, http.StatusCreated, record)
+}
 
-	// if user.Role == models.ROLE_NURSE {
-	// 	fmt.Printf("GetMedicalRecords: Fetching nurse view records\n")
-	// 	records, err = h.service.GetNurseViewRecords()
-	// } else {
-	// 	fmt.Printf("GetMedicalRecords: Fetching full medical records\n")
-	// 	records, err = h.service.GetMedicalRecords()
-	// }
+// GetMedicalRecords lists records in the nurse view, filtered by
+// ?department=; ?expand=patient includes a summary of each one's patient
+func (h *MedicalRecordHandler) GetMedicalRecords(w http.ResponseWriter, r *http.Request) {
+	expand, ok := parseExpand(w, r, models.EXPAND_PATIENT)
+	if !ok {
+		return
+	}
 
+	records, err := h.service.GetNurseViewRecords(r.Context(), r.URL.Query().Get("department"), expand.Patient)
 	if err != nil {
-		fmt.Printf("GetMedicalRecords: Error fetching records: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.WriteServiceError(w, err, "Department not found")
 		return
 	}
 
-	fmt.Printf("GetMedicalRecords: Successfully fetched records, returning response\n")
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(records)
+	dto.WriteJSON(w, r, http.StatusOK, records)
 }
 
 func (h *MedicalRecordHandler) GetMedicalRecord(w http.ResponseWriter, r *http.Request) {
@@ -84,35 +94,43 @@ func (h *MedicalRecordHandler) GetMedicalRecord(w http.ResponseWriter, r *http.R
 
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid record ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid record ID")
 		return
 	}
 
+	var access *models.BreakGlassAccess
+	if models.CanBreakGlass(user.Role) {
+		access, err = h.breakGlass.ActiveForRecord(r.Context(), user.UserID, id)
+		if err != nil {
+			response.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	var record interface{}
-	if user.Role == models.ROLE_NURSE {
-		record, err = h.service.GetNurseRecord(id)
+	if access == nil && (user.Role == models.ROLE_NURSE || user.Role == models.ROLE_LAB_TECH) {
+		record, err = h.service.GetNurseRecord(r.Context(), id)
 	} else {
-		record, err = h.service.GetMedicalRecord(id)
+		record, err = h.service.GetMedicalRecord(r.Context(), id)
 	}
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Medical record not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		response.WriteServiceError(w, err, "Medical record not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(record)
+	if access != nil {
+		h.writeBreakGlass(w, r, access, models.ENTITY_MEDICAL_RECORD, id, record)
+		return
+	}
+	dto.WriteJSON(w, r, http.StatusOK, record)
 }
 
 func (h *MedicalRecordHandler) GetMedicalRecordsByPatient(w http.ResponseWriter, r *http.Request) {
@@ -120,33 +138,59 @@ func (h *MedicalRecordHandler) GetMedicalRecordsByPatient(w http.ResponseWriter,
 
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	vars := mux.Vars(r)
 	patientId, err := strconv.Atoi(vars["patientId"])
 	if err != nil {
-		http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
 		return
 	}
 
+	var access *models.BreakGlassAccess
+	if models.CanBreakGlass(user.Role) {
+		access, err = h.breakGlass.Active(r.Context(), user.UserID, patientId)
+		if err != nil {
+			response.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	var records interface{}
-	if user.Role == models.ROLE_NURSE {
-		records, err = h.service.GetNurseRecordsByPatient(patientId)
+	if access == nil && (user.Role == models.ROLE_NURSE || user.Role == models.ROLE_LAB_TECH) {
+		records, err = h.service.GetNurseRecordsByPatient(r.Context(), patientId)
 	} else {
-		records, err = h.service.GetMedicalRecordsByPatient(patientId)
+		records, err = h.service.GetMedicalRecordsByPatient(r.Context(), patientId)
 	}
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "No medical records found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		response.WriteServiceError(w, err, "No medical records found")
+		return
+	}
+
+	if access != nil {
+		h.writeBreakGlass(w, r, access, models.ENTITY_PATIENT, patientId, records)
 		return
 	}
+	dto.WriteJSON(w, r, http.StatusOK, records)
+}
+
+// writeBreakGlass writes the full records read under break-glass access,
+// audit-logging the read first so nothing is disclosed unrecorded
+func (h *MedicalRecordHandler) writeBreakGlass(w http.ResponseWriter, r *http.Request, access *models.BreakGlassAccess, entityType string, entityID int, body any) {
+	if err := h.breakGlass.LogAccess(r.Context(), access, entityType, entityID); err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("X-Break-Glass-Expires", access.ExpiresAt.Format(time.RFC3339))
+	dto.WriteJSONAs(w, models.ROLE_DOCTOR, http.StatusOK, body)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(records)
+// isTemplateError reports whether err is a record's sections not fitting
+// its template, or the template being unknown or retired
+func isTemplateError(err error) bool {
+	return errors.Is(err, services.ErrUnknownTemplate) || errors.Is(err, services.ErrTemplateInactive) ||
+		errors.Is(err, services.ErrRecordSections)
 }
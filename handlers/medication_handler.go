@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type MedicationHandler struct {
+	service *services.MedicationService
+}
+
+func NewMedicationHandler(service *services.MedicationService) *MedicationHandler {
+	return &MedicationHandler{service: service}
+}
+
+// Search is the medication typeahead: catalog entries whose name contains
+// ?q=, at most ?limit= of them (default 20, at most 100)
+func (h *MedicationHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		response.WriteError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	limit := 20
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 100 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+	}
+
+	medications, err := h.service.Search(r.Context(), q, limit)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, medications)
+}
+
+// CreateMedication adds a catalog entry; an identical entry is a 409
+func (h *MedicationHandler) CreateMedication(w http.ResponseWriter, r *http.Request) {
+	var medication models.Medication
+	if err := json.NewDecoder(r.Body).Decode(&medication); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&medication); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.Create(r.Context(), &medication); err != nil {
+		response.WriteServiceError(w, err, "Medication not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, medication)
+}
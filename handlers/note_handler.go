@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// NoteHandler exposes the clinical notes on medical records. Writing a
+// note is a chart edit, so it respects the chart lock; signing doesn't
+// change the chart's content and may happen while someone else holds it.
+type NoteHandler struct {
+	service *services.NoteService
+	records *services.MedicalRecordService
+	locks   *services.ChartLockService
+}
+
+func NewNoteHandler(service *services.NoteService, records *services.MedicalRecordService) *NoteHandler {
+	return &NoteHandler{
+		service: service,
+		records: records,
+		locks:   services.NewChartLockService(),
+	}
+}
+
+// GetNotes lists a record's notes, addenda included, in the order written
+func (h *NoteHandler) GetNotes(w http.ResponseWriter, r *http.Request) {
+	recordID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid medical record ID")
+		return
+	}
+
+	notes, err := h.service.GetNotes(r.Context(), recordID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Medical record not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, notes)
+}
+
+// AddNote writes an unsigned note on the record by the caller
+func (h *NoteHandler) AddNote(w http.ResponseWriter, r *http.Request) {
+	user, recordID, note, ok := h.noteRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.AddNote(r.Context(), recordID, note, user.UserID); err != nil {
+		writeNoteError(w, err, "Medical record not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusCreated, note)
+}
+
+// AddAddendum writes an unsigned addendum by the caller to a signed note
+func (h *NoteHandler) AddAddendum(w http.ResponseWriter, r *http.Request) {
+	noteID, err := strconv.Atoi(mux.Vars(r)["noteId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid note ID")
+		return
+	}
+	user, recordID, addendum, ok := h.noteRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.AddAddendum(r.Context(), recordID, noteID, addendum, user.UserID); err != nil {
+		writeNoteError(w, err, "Note not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusCreated, addendum)
+}
+
+// UpdateNote replaces the body of the caller's unsigned note
+func (h *NoteHandler) UpdateNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := strconv.Atoi(mux.Vars(r)["noteId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid note ID")
+		return
+	}
+	user, recordID, note, ok := h.noteRequest(w, r)
+	if !ok {
+		return
+	}
+
+	updated, err := h.service.UpdateNote(r.Context(), recordID, noteID, note.Body, user.UserID)
+	if err != nil {
+		writeNoteError(w, err, "Note not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, updated)
+}
+
+// SignNote signs the caller's note, locking it against further edits
+func (h *NoteHandler) SignNote(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	vars := mux.Vars(r)
+	recordID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid medical record ID")
+		return
+	}
+	noteID, err := strconv.Atoi(vars["noteId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid note ID")
+		return
+	}
+
+	note, err := h.service.SignNote(r.Context(), recordID, noteID, user.UserID)
+	if err != nil {
+		writeNoteError(w, err, "Note not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, note)
+}
+
+// noteRequest reads the caller, the record ID and a note body for a write
+// to the record's chart, writing the error response if any is missing or
+// the chart is locked by someone else
+func (h *NoteHandler) noteRequest(w http.ResponseWriter, r *http.Request) (*models.User, int, *models.Note, bool) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, 0, nil, false
+	}
+
+	recordID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid medical record ID")
+		return nil, 0, nil, false
+	}
+
+	var note models.Note
+	if err := json.NewDecoder(r.Body).Decode(&note); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return nil, 0, nil, false
+	}
+	if err := validation.Struct(&note); err != nil {
+		validation.WriteError(w, err)
+		return nil, 0, nil, false
+	}
+
+	patientID, err := h.records.PatientOf(r.Context(), recordID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Medical record not found")
+		return nil, 0, nil, false
+	}
+	if !chartWritable(w, r, h.locks, patientID, user.UserID) {
+		return nil, 0, nil, false
+	}
+	return user, recordID, &note, true
+}
+
+// writeNoteError reports edits to a signed note and addenda to an unsigned
+// one as 409, and someone else's note as 403
+func writeNoteError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrNoteSigned), errors.Is(err, services.ErrNoteUnsigned):
+		response.WriteError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrNotNoteAuthor):
+		response.WriteError(w, http.StatusForbidden, err.Error())
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
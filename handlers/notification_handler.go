@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+type NotificationHandler struct {
+	service *services.NotificationService
+}
+
+func NewNotificationHandler(service *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{service: service}
+}
+
+// GetNotifications lists the newest queued notifications, filtered by
+// ?status=; ?limit= defaults to 100 (max 1000)
+func (h *NotificationHandler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.NOTIFICATION_STATUS_PENDING, models.NOTIFICATION_STATUS_SENDING, models.NOTIFICATION_STATUS_SENT,
+		models.NOTIFICATION_STATUS_FAILED, models.NOTIFICATION_STATUS_CANCELLED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be pending, sending, sent, failed or cancelled")
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+	}
+
+	notifications, err := h.service.GetNotifications(r.Context(), status, limit)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, notifications)
+}
+
+// Retry requeues a failed notification
+func (h *NotificationHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	notification, err := h.service.Retry(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, services.ErrNotificationState) {
+			response.WriteError(w, http.StatusConflict, "Only failed notifications can be retried")
+			return
+		}
+		response.WriteServiceError(w, err, "Notification not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, notification)
+}
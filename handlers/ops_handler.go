@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// OpsHandler exposes audited operational remediations to admins
+type OpsHandler struct {
+	service *services.OpsService
+}
+
+func NewOpsHandler(service *services.OpsService) *OpsHandler {
+	return &OpsHandler{service: service}
+}
+
+// ListActions lists the remediations that can be run
+func (h *OpsHandler) ListActions(w http.ResponseWriter, r *http.Request) {
+	response.WriteJSON(w, http.StatusOK, h.service.Actions())
+}
+
+// RunAction runs the remediation named in the path
+func (h *OpsHandler) RunAction(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	name := mux.Vars(r)["action"]
+	result, err := h.service.Run(r.Context(), name, user.UserID)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownOpsAction) {
+			response.WriteError(w, http.StatusNotFound, "Unknown ops action: "+name)
+			return
+		}
+		response.WriteErrorDetails(w, http.StatusInternalServerError, response.CodeInternal, err.Error(), result)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, map[string]any{
+		"action": name,
+		"result": result,
+	})
+}
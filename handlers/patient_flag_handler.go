@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// PatientFlagHandler exposes patient risk flags. Every response is limited
+// to the flag types the caller's role may see.
+type PatientFlagHandler struct {
+	service *services.PatientFlagService
+}
+
+func NewPatientFlagHandler(service *services.PatientFlagService) *PatientFlagHandler {
+	return &PatientFlagHandler{service: service}
+}
+
+// GetFlagTypes lists the configured flag types
+func (h *PatientFlagHandler) GetFlagTypes(w http.ResponseWriter, r *http.Request) {
+	flagTypes, err := h.service.GetFlagTypes(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, flagTypes)
+}
+
+// SaveFlagType creates or updates the flag type named in the path (admins)
+func (h *PatientFlagHandler) SaveFlagType(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Types are active unless the body retires them with "active": false
+	flagType := models.PatientFlagType{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&flagType); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	flagType.Code = mux.Vars(r)["code"]
+
+	if err := validation.Struct(&flagType); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.SaveFlagType(r.Context(), &flagType, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Flag type not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, flagType)
+}
+
+// GetFlags lists a patient's active flags; ?includeRemoved=true adds the
+// flags that have been taken down
+func (h *PatientFlagHandler) GetFlags(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	includeRemoved := r.URL.Query().Get("includeRemoved") == "true"
+	flags, err := h.service.GetFlags(r.Context(), patientID, user.Role, includeRemoved)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, flags)
+}
+
+// AddFlag raises a flag on a patient
+func (h *PatientFlagHandler) AddFlag(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var flag models.PatientFlag
+	if err := json.NewDecoder(r.Body).Decode(&flag); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&flag); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	flag.PatientID = patientID
+	flag.AddedBy = user.UserID
+	if err := h.service.AddFlag(r.Context(), &flag, user.Role); err != nil {
+		writePatientFlagError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, flag)
+}
+
+// RemoveFlag takes a flag down; a reason is required for the audit trail
+func (h *PatientFlagHandler) RemoveFlag(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid flag ID")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" validate:"required,max=1000"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	flag, err := h.service.RemoveFlag(r.Context(), patientID, id, user.UserID, user.Role, req.Reason)
+	if err != nil {
+		writePatientFlagError(w, err, "Flag not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, flag)
+}
+
+func writePatientFlagError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrFlagTypeHidden):
+		response.WriteError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrFlagTypeInactive):
+		response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, services.ErrFlagRaised), errors.Is(err, services.ErrFlagRemoved):
+		response.WriteError(w, http.StatusConflict, err.Error())
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
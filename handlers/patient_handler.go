@@ -1,115 +1,218 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
 	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
 	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/kinyaelgrande/simple-hospital/validation"
 )
 
 type PatientHandler struct {
 	service *services.PatientService
+	locks   *services.ChartLockService
+	flags   *services.PatientFlagService
+	exports StreamLimits
 }
 
-func NewPatientHandler() *PatientHandler {
+func NewPatientHandler(service *services.PatientService, flags *services.PatientFlagService, exports StreamLimits) *PatientHandler {
 	return &PatientHandler{
-		service: services.NewPatientService(),
+		service: service,
+		locks:   services.NewChartLockService(),
+		flags:   flags,
+		exports: exports,
 	}
 }
 
 func (h *PatientHandler) CreatePatient(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("CreatePatient handler called for patient creation\n")
 	var patient models.Patient
 	if err := json.NewDecoder(r.Body).Decode(&patient); err != nil {
-		fmt.Printf("Error decoding patient JSON: %v\n", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	fmt.Printf("Creating patient: %s %s\n", patient.FirstName, patient.LastName)
-	if err := h.service.CreatePatient(&patient); err != nil {
-		fmt.Printf("Error creating patient in service: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := validation.Struct(&patient); err != nil {
+		validation.WriteError(w, err)
 		return
 	}
 
-	fmt.Printf("Patient created successfully with ID: %d\n", patient.PatientID)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(patient)
+	slog.Debug("Creating patient", "patient", patient)
+	if err := h.service.CreatePatient(r.Context(), &patient); err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	slog.Debug("Patient created", "patientId", patient.PatientID)
+	response.WriteJSON(w, http.StatusCreated, patient)
 }
 
 func (h *PatientHandler) GetPatient(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
 		return
 	}
 
-	patient, err := h.service.GetPatient(id)
+	patient, err := h.service.GetPatient(r.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Patient not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		response.WriteServiceError(w, err, "Patient not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(patient)
+	response.WriteJSON(w, http.StatusOK, patient)
+}
+
+// GetSummary returns the patient with their active flags. The flags the
+// caller's role may see are always included so they can't be missed.
+func (h *PatientHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	patient, err := h.service.GetPatient(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	flags, err := h.flags.GetFlags(r.Context(), id, user.Role, false)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, models.PatientSummary{Patient: patient, Flags: flags})
 }
 
 func (h *PatientHandler) GetAllPatients(w http.ResponseWriter, r *http.Request) {
-	patients, err := h.service.GetAllPatients()
+	patients, err := h.service.GetAllPatients(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, patients)
+}
+
+// ExportPatients streams every patient as a ?format=csv (the default) or
+// ndjson download, read from the database as it is sent
+func (h *PatientHandler) ExportPatients(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case "", models.STREAM_FORMAT_CSV:
+		format = models.STREAM_FORMAT_CSV
+	case models.STREAM_FORMAT_NDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		response.WriteError(w, http.StatusBadRequest, services.ErrUnknownStreamFormat.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(patients)
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	filename := fmt.Sprintf("patients-%s.%s", timezone.Now().Format("2006-01-02"), format)
+	h.exports.stream(w, r, contentType, filename, func(ctx context.Context, out io.Writer) error {
+		return h.service.ExportPatients(ctx, user.UserID, format, out)
+	})
 }
 
 func (h *PatientHandler) UpdatePatient(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
 		return
 	}
 
 	var patient models.Patient
 	if err := json.NewDecoder(r.Body).Decode(&patient); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if err := h.service.UpdatePatient(id, &patient); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := validation.Struct(&patient); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	if !chartWritable(w, r, h.locks, id, user.UserID) {
+		return
+	}
+
+	if err := h.service.UpdatePatient(r.Context(), id, &patient, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
 		return
 	}
 
 	patient.PatientID = id
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(patient)
+	response.WriteJSON(w, http.StatusOK, patient)
+}
+
+// GetPatientChanges lists who changed which of the patient's demographic
+// fields, from what to what, newest first
+func (h *PatientHandler) GetPatientChanges(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	changes, err := h.service.GetPatientChanges(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, changes)
 }
 
 func (h *PatientHandler) DeletePatient(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	if !chartWritable(w, r, h.locks, id, user.UserID) {
 		return
 	}
 
-	if err := h.service.DeletePatient(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.DeletePatient(r.Context(), id); err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
 		return
 	}
 
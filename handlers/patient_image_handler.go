@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// PatientImageHandler serves the patient photo and ID document scan staff
+// check a patient's identity against. ?kind=id_document selects the ID
+// document; the photo is the default.
+type PatientImageHandler struct {
+	service  *services.PatientImageService
+	locks    *services.ChartLockService
+	maxBytes int64
+}
+
+// NewPatientImageHandler accepts images of up to maxBytes
+func NewPatientImageHandler(service *services.PatientImageService, maxBytes int64) *PatientImageHandler {
+	return &PatientImageHandler{
+		service:  service,
+		locks:    services.NewChartLockService(),
+		maxBytes: maxBytes,
+	}
+}
+
+// SaveImage stores the image in the multipart form's "file", replacing the
+// patient's previous one of the kind
+func (h *PatientImageHandler) SaveImage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, kind, ok := imageTarget(w, r)
+	if !ok {
+		return
+	}
+
+	// Leave room for the part headers
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBytes+64<<10)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Patient images are limited to %d bytes", h.maxBytes))
+			return
+		}
+		response.WriteError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		validation.WriteError(w, validation.Errors{{Field: "file", Message: "file is required"}})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.maxBytes+1))
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid multipart form")
+		return
+	}
+	if int64(len(data)) > h.maxBytes {
+		response.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Patient images are limited to %d bytes", h.maxBytes))
+		return
+	}
+
+	if !chartWritable(w, r, h.locks, patientID, user.UserID) {
+		return
+	}
+
+	img := models.PatientImage{PatientID: patientID, Kind: kind, UploadedBy: user.UserID}
+	if err := h.service.Save(r.Context(), &img, data); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnsupportedImageType):
+			response.WriteError(w, http.StatusUnsupportedMediaType, "Patient images must be JPEG, PNG or GIF files")
+		case errors.Is(err, services.ErrImageDimensions):
+			response.WriteError(w, http.StatusRequestEntityTooLarge, "Image dimensions are too large")
+		default:
+			response.WriteServiceError(w, err, "Patient not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, img)
+}
+
+// GetImage streams the image, or its JPEG thumbnail with ?thumbnail=true
+func (h *PatientImageHandler) GetImage(w http.ResponseWriter, r *http.Request) {
+	patientID, kind, ok := imageTarget(w, r)
+	if !ok {
+		return
+	}
+	thumbnail := r.URL.Query().Get("thumbnail") == "true"
+
+	img, body, err := h.service.OpenImage(r.Context(), patientID, kind, thumbnail)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient image not found")
+		return
+	}
+	defer body.Close()
+
+	contentType := img.ContentType
+	if thumbnail {
+		contentType = "image/jpeg"
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(img.SizeBytes, 10))
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, body)
+}
+
+func (h *PatientImageHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, kind, ok := imageTarget(w, r)
+	if !ok {
+		return
+	}
+	if !chartWritable(w, r, h.locks, patientID, user.UserID) {
+		return
+	}
+
+	if err := h.service.DeleteImage(r.Context(), patientID, kind, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Patient image not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// imageTarget reads the patient from the path and the image kind from
+// ?kind=, writing a 400 if either is invalid
+func imageTarget(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return 0, "", false
+	}
+
+	kind := r.URL.Query().Get("kind")
+	switch kind {
+	case "":
+		kind = models.PATIENT_IMAGE_PHOTO
+	case models.PATIENT_IMAGE_PHOTO, models.PATIENT_IMAGE_ID_DOCUMENT:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "kind must be photo or id_document")
+		return 0, "", false
+	}
+	return patientID, kind, true
+}
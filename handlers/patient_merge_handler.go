@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// PatientMergeHandler merges duplicate patient registrations (admins)
+type PatientMergeHandler struct {
+	service *services.PatientMergeService
+}
+
+func NewPatientMergeHandler(service *services.PatientMergeService) *PatientMergeHandler {
+	return &PatientMergeHandler{service: service}
+}
+
+// MergePatient merges {"duplicateId": N} into the patient in the path.
+// With "dryRun": true (or ?dryRun=true) it only reports what would change.
+func (h *PatientMergeHandler) MergePatient(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	primaryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var req struct {
+		DuplicateID int  `json:"duplicateId" validate:"required,gt=0"`
+		DryRun      bool `json:"dryRun"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	dryRun := req.DryRun || r.URL.Query().Get("dryRun") == "true"
+	merge, err := h.service.Merge(r.Context(), primaryID, req.DuplicateID, user.UserID, dryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMergeSelf):
+			response.WriteError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrPatientMerged), errors.Is(err, services.ErrMergeAdmitted):
+			response.WriteError(w, http.StatusConflict, err.Error())
+		default:
+			writeChartLockError(w, err, "Patient not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, merge)
+}
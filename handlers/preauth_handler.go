@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type PreAuthHandler struct {
+	service *services.PreAuthService
+}
+
+func NewPreAuthHandler(service *services.PreAuthService) *PreAuthHandler {
+	return &PreAuthHandler{service: service}
+}
+
+// CreateRequirement flags a procedure or medication as needing pre-authorization
+func (h *PreAuthHandler) CreateRequirement(w http.ResponseWriter, r *http.Request) {
+	var requirement models.PreAuthRequirement
+	if err := json.NewDecoder(r.Body).Decode(&requirement); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&requirement); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.CreateRequirement(r.Context(), &requirement); err != nil {
+		response.WriteServiceError(w, err, "Requirement not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, requirement)
+}
+
+func (h *PreAuthHandler) GetRequirements(w http.ResponseWriter, r *http.Request) {
+	requirements, err := h.service.GetRequirements(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, requirements)
+}
+
+func (h *PreAuthHandler) DeleteRequirement(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid requirement ID")
+		return
+	}
+
+	if err := h.service.DeleteRequirement(r.Context(), id); err != nil {
+		response.WriteServiceError(w, err, "Requirement not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateRequest records a pending pre-authorization request
+func (h *PreAuthHandler) CreateRequest(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req models.PreAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	req.RequestedBy = user.UserID
+	if err := h.service.CreateRequest(r.Context(), &req); err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, req)
+}
+
+// GetRequests lists requests, filtered by ?patientId= and ?status=
+func (h *PreAuthHandler) GetRequests(w http.ResponseWriter, r *http.Request) {
+	patientID := 0
+	if value := r.URL.Query().Get("patientId"); value != "" {
+		var err error
+		patientID, err = strconv.Atoi(value)
+		if err != nil || patientID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+			return
+		}
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.PREAUTH_STATUS_PENDING, models.PREAUTH_STATUS_SUBMITTED, models.PREAUTH_STATUS_APPROVED, models.PREAUTH_STATUS_DENIED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be pending, submitted, approved or denied")
+		return
+	}
+
+	requests, err := h.service.GetRequests(r.Context(), patientID, status)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, requests)
+}
+
+func (h *PreAuthHandler) GetRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid pre-authorization ID")
+		return
+	}
+
+	req, err := h.service.GetRequest(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Pre-authorization not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, req)
+}
+
+// Submit sends a pending request to the payer's API
+func (h *PreAuthHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid pre-authorization ID")
+		return
+	}
+
+	req, err := h.service.Submit(r.Context(), id, user.UserID)
+	if err != nil {
+		writePreAuthError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, req)
+}
+
+// Refresh fetches the payer's decision on a submitted request
+func (h *PreAuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid pre-authorization ID")
+		return
+	}
+
+	req, err := h.service.Refresh(r.Context(), id)
+	if err != nil {
+		writePreAuthError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, req)
+}
+
+// RecordDecision records a decision received outside the payer API
+func (h *PreAuthHandler) RecordDecision(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid pre-authorization ID")
+		return
+	}
+
+	var decision models.PreAuthDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&decision); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	req, err := h.service.RecordDecision(r.Context(), id, user.UserID, &decision)
+	if err != nil {
+		writePreAuthError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, req)
+}
+
+func writePreAuthError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoPayerAPI):
+		response.WriteError(w, http.StatusConflict, "Payer has no API; record the decision manually")
+	case errors.Is(err, services.ErrPreAuthNotPending):
+		response.WriteError(w, http.StatusConflict, "Pre-authorization has already been submitted")
+	case errors.Is(err, services.ErrPreAuthNotSubmitted):
+		response.WriteError(w, http.StatusConflict, "Pre-authorization is not awaiting a payer decision")
+	case errors.Is(err, services.ErrPreAuthDecided):
+		response.WriteError(w, http.StatusConflict, "Pre-authorization has already been decided")
+	case errors.Is(err, services.ErrPayerUnavailable):
+		response.WriteError(w, http.StatusBadGateway, err.Error())
+	default:
+		response.WriteServiceError(w, err, "Pre-authorization not found")
+	}
+}
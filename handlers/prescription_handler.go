@@ -1,102 +1,322 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
 	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
 	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/kinyaelgrande/simple-hospital/validation"
 )
 
 type PrescriptionHandler struct {
 	service *services.PrescriptionService
+	locks   *services.ChartLockService
 }
 
-func NewPrescriptionHandler() *PrescriptionHandler {
+func NewPrescriptionHandler(service *services.PrescriptionService) *PrescriptionHandler {
 	return &PrescriptionHandler{
-		service: services.NewPrescriptionService(),
+		service: service,
+		locks:   services.NewChartLockService(),
 	}
 }
 
 func (h *PrescriptionHandler) CreatePrescription(w http.ResponseWriter, r *http.Request) {
-	fmt.Printf("CreatePrescription handler called\n")
 	var prescription models.Prescription
 	if err := json.NewDecoder(r.Body).Decode(&prescription); err != nil {
-		fmt.Printf("Error decoding prescription JSON: %v\n", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	slog.Debug("Creating prescription", "prescription", prescription)
 
-	fmt.Printf("Decoded prescription: %+v\n", prescription)
-	spew.Dump("prescription", prescription)
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if prescription.DoctorID == 0 {
+		prescription.DoctorID = user.UserID
+	}
+	if prescription.PrescribedDate == "" {
+		prescription.PrescribedDate = timezone.Now().Format("2006-01-02")
+	}
+	// Only the visit endpoints link a prescription to a visit's record
+	prescription.RecordID = nil
+
+	if err := validation.Struct(&prescription); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
 
-	if err := h.service.CreatePrescription(&prescription); err != nil {
-		fmt.Printf("Error creating prescription in service: %v\n", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !chartWritable(w, r, h.locks, prescription.PatientID, user.UserID) {
 		return
 	}
 
-	fmt.Printf("Prescription created successfully with ID: %d\n", prescription.PrescriptionID)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(prescription)
+	warnings, err := h.service.CheckPrescription(r.Context(), &prescription)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownMedication) {
+			response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrUnknownPatient) {
+			validation.WriteError(w, validation.Errors{{Field: "patientId", Message: "patientId must reference an existing patient"}})
+			return
+		}
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	if len(warnings) == 0 {
+		err = h.service.CreatePrescription(r.Context(), &prescription)
+	} else {
+		if prescription.OverrideReason == "" {
+			response.WriteErrorDetails(w, http.StatusConflict, "prescription_warnings",
+				"Prescription has safety warnings; resubmit with overrideReason to proceed",
+				map[string]any{"warnings": warnings})
+			return
+		}
+		if user.Role != models.ROLE_DOCTOR && user.Role != models.ROLE_ADMIN {
+			response.WriteError(w, http.StatusForbidden, "Only a doctor can override prescription warnings")
+			return
+		}
+		err = h.service.CreateOverriddenPrescription(r.Context(), &prescription, user.UserID, warnings)
+	}
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	slog.Debug("Prescription created", "prescriptionId", prescription.PrescriptionID)
+	response.WriteJSON(w, http.StatusCreated, prescription)
 }
 
+// TotalCountHeader carries how many items a paged listing matched across
+// all pages
+const TotalCountHeader = "X-Total-Count"
+
+// GetPrescriptions lists prescriptions, optionally only those by ?doctorId=,
+// whose medication contains ?medication=, with ?status= active or ready, or
+// prescribed between ?from= and ?to= (YYYY-MM-DD, inclusive). ?sort= is id
+// (the default), prescribedDate or medication, prefixed with - to reverse
+// it; ?limit= (at most 1000) and ?offset= page the result, and the
+// X-Total-Count header gives the number matching across all pages.
+// ?expand=patient,doctor includes summaries of each one's patient and
+// prescriber.
 func (h *PrescriptionHandler) GetPrescriptions(w http.ResponseWriter, r *http.Request) {
-	prescriptions, err := h.service.GetPrescriptions()
+	query := r.URL.Query()
+	filter := services.PrescriptionFilter{Medication: strings.TrimSpace(query.Get("medication"))}
+
+	if value := query.Get("doctorId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid doctorId")
+			return
+		}
+		filter.DoctorID = id
+	}
+
+	filter.Status = query.Get("status")
+	switch filter.Status {
+	case "", models.PRESCRIPTION_STATUS_UNSIGNED, models.PRESCRIPTION_STATUS_ACTIVE, models.PRESCRIPTION_STATUS_READY:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be unsigned, active or ready")
+		return
+	}
+
+	for name, target := range map[string]*string{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			response.WriteError(w, http.StatusBadRequest, name+" must be a date in YYYY-MM-DD format")
+			return
+		}
+		*target = value
+	}
+
+	order := query.Get("sort")
+	filter.Sort, filter.Descending = strings.TrimPrefix(order, "-"), strings.HasPrefix(order, "-")
+	switch filter.Sort {
+	case "", models.PRESCRIPTION_SORT_ID, models.PRESCRIPTION_SORT_PRESCRIBED_DATE, models.PRESCRIPTION_SORT_MEDICATION:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "sort must be id, prescribedDate or medication, optionally prefixed with -")
+		return
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			response.WriteError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		filter.Offset = offset
+	}
+
+	var ok bool
+	if filter.Expand, ok = parseExpand(w, r, models.EXPAND_PATIENT, models.EXPAND_DOCTOR); !ok {
+		return
+	}
+
+	prescriptions, total, err := h.service.GetPrescriptions(r.Context(), filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(prescriptions)
+	w.Header().Set(TotalCountHeader, strconv.Itoa(total))
+	response.WriteJSON(w, http.StatusOK, prescriptions)
 }
 
 func (h *PrescriptionHandler) GetPrescription(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid prescription ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid prescription ID")
 		return
 	}
 
-	prescription, err := h.service.GetPrescription(id)
+	prescription, err := h.service.GetPrescription(r.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Prescription not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		response.WriteServiceError(w, err, "Prescription not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(prescription)
+	response.WriteJSON(w, http.StatusOK, prescription)
 }
 
+// GetPrescriptionsByPatient lists a patient's prescriptions; ?expand= works
+// as for GetPrescriptions
 func (h *PrescriptionHandler) GetPrescriptionsByPatient(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	patientId, err := strconv.Atoi(vars["patientId"])
 	if err != nil {
-		http.Error(w, "Invalid patient ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	expand, ok := parseExpand(w, r, models.EXPAND_PATIENT, models.EXPAND_DOCTOR)
+	if !ok {
+		return
+	}
+
+	prescriptions, _, err := h.service.GetPrescriptions(r.Context(), services.PrescriptionFilter{PatientID: patientId, Expand: expand})
+	if err != nil {
+		response.WriteServiceError(w, err, "No prescriptions found for patient")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, prescriptions)
+}
+
+// SignPrescription records the prescriber's electronic signature, confirmed
+// with their password or a 2FA code, which lets the pharmacy dispense it
+func (h *PrescriptionHandler) SignPrescription(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid prescription ID")
+		return
+	}
+
+	var signature models.PrescriptionSignature
+	if err := json.NewDecoder(r.Body).Decode(&signature); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&signature); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	prescription, err := h.service.Sign(r.Context(), id, user.UserID, signature)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSignatureCredentials):
+			response.WriteError(w, http.StatusForbidden, "Invalid password or code")
+		case errors.Is(err, services.ErrPrescriptionSigner):
+			response.WriteError(w, http.StatusForbidden, "Only the prescribing doctor can sign a prescription")
+		case errors.Is(err, services.ErrPrescriptionSigned):
+			response.WriteError(w, http.StatusConflict, "Prescription is already signed")
+		default:
+			response.WriteServiceError(w, err, "Prescription not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, prescription)
+}
+
+// GetPharmacyWorklist lists prescriptions for dispensing, filtered by
+// ?status=unsigned, active or ready
+func (h *PrescriptionHandler) GetPharmacyWorklist(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.PRESCRIPTION_STATUS_UNSIGNED, models.PRESCRIPTION_STATUS_ACTIVE, models.PRESCRIPTION_STATUS_READY:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be unsigned, active or ready")
+		return
+	}
+
+	worklist, err := h.service.GetPharmacyWorklist(r.Context(), status)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, worklist)
+}
+
+// MarkReady tells the patient their prescription is ready for collection
+func (h *PrescriptionHandler) MarkReady(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid prescription ID")
 		return
 	}
 
-	prescriptions, err := h.service.GetPrescriptionsByPatient(patientId)
+	prescription, err := h.service.MarkReady(r.Context(), id, user.UserID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "No prescriptions found for patient", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, services.ErrPrescriptionUnsigned):
+			response.WriteError(w, http.StatusConflict, "Prescription has not been signed by its prescriber")
+			return
+		case errors.Is(err, services.ErrPrescriptionReady):
+			response.WriteError(w, http.StatusConflict, "Prescription is already ready for collection")
+			return
 		}
+		response.WriteServiceError(w, err, "Prescription not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(prescriptions)
+	response.WriteJSON(w, http.StatusOK, prescription)
 }
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// ProbeTokenHeader carries the probe token configured for uptime monitors
+const ProbeTokenHeader = "X-Probe-Token"
+
+// ProbeHandler serves synthetic transaction probes to external uptime
+// monitors, authenticated by the probe token rather than a user
+type ProbeHandler struct {
+	service *services.ProbeService
+	token   string
+}
+
+func NewProbeHandler(service *services.ProbeService, token string) *ProbeHandler {
+	return &ProbeHandler{service: service, token: token}
+}
+
+// Synthetic runs a synthetic create, read and delete of a patient. It
+// answers 200 when every step succeeded and 503 otherwise, so monitors can
+// alert on the status alone.
+func (h *ProbeHandler) Synthetic(w http.ResponseWriter, r *http.Request) {
+	if h.token == "" {
+		response.WriteError(w, http.StatusNotFound, "Probes are disabled")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(ProbeTokenHeader)), []byte(h.token)) != 1 {
+		response.WriteError(w, http.StatusUnauthorized, "Invalid probe token")
+		return
+	}
+
+	result := h.service.Synthetic(r.Context())
+	status := http.StatusOK
+	if result.Status != models.PROBE_STATUS_OK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	response.WriteJSON(w, status, result)
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// PublicStatsHandler serves de-identified aggregate statistics without authentication
+type PublicStatsHandler struct {
+	service *services.PublicStatsService
+}
+
+func NewPublicStatsHandler(service *services.PublicStatsService) *PublicStatsHandler {
+	return &PublicStatsHandler{service: service}
+}
+
+// GetStats returns noisy monthly visit and admission figures for the last ?months= months (default 12, max 36)
+func (h *PublicStatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	months := 12
+	if value := r.URL.Query().Get("months"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 36 {
+			response.WriteError(w, http.StatusBadRequest, "months must be between 1 and 36")
+			return
+		}
+		months = parsed
+	}
+
+	stats, err := h.service.GetStats(r.Context(), months)
+	if err != nil {
+		response.WriteServiceError(w, err, "No statistics available")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, stats)
+}
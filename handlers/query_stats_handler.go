@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// QueryStatsHandler serves the database query stats to admins
+type QueryStatsHandler struct {
+	service *services.QueryStatsService
+}
+
+func NewQueryStatsHandler(service *services.QueryStatsService) *QueryStatsHandler {
+	return &QueryStatsHandler{service: service}
+}
+
+// GetStats lists the statements run, the largest by ?sort=total|mean|max|calls
+// first (default total); ?limit= caps them (default 50, max 1000)
+func (h *QueryStatsHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	sortBy := r.URL.Query().Get("sort")
+	switch sortBy {
+	case "":
+		sortBy = models.QUERY_STATS_SORT_TOTAL
+	case models.QUERY_STATS_SORT_TOTAL, models.QUERY_STATS_SORT_MEAN, models.QUERY_STATS_SORT_MAX, models.QUERY_STATS_SORT_CALLS:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "sort must be total, mean, max or calls")
+		return
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+	}
+
+	response.WriteJSON(w, http.StatusOK, h.service.GetStats(sortBy, limit))
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// QueueHandler exposes the departments' walk-in queues: check-in and
+// calling patients for staff, and a ticket-only board for waiting-room
+// displays
+type QueueHandler struct {
+	service *services.QueueService
+}
+
+func NewQueueHandler(service *services.QueueService) *QueueHandler {
+	return &QueueHandler{service: service}
+}
+
+// CheckIn adds a walk-in patient to the department's queue in the path
+func (h *QueueHandler) CheckIn(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var checkIn models.QueueCheckIn
+	if err := json.NewDecoder(r.Body).Decode(&checkIn); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&checkIn); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	entry, err := h.service.CheckIn(r.Context(), mux.Vars(r)["department"], checkIn, user.UserID)
+	if err != nil {
+		writeQueueError(w, err, "Patient not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusCreated, entry)
+}
+
+// GetQueue returns the department's queue with each waiting patient's
+// estimated wait
+func (h *QueueHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := h.service.GetQueue(r.Context(), mux.Vars(r)["department"])
+	if err != nil {
+		response.WriteServiceError(w, err, "Department not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, queue)
+}
+
+// GetBoard returns the department's queue as tickets only, for displays
+func (h *QueueHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	board, err := h.service.GetBoard(r.Context(), mux.Vars(r)["department"])
+	if err != nil {
+		response.WriteServiceError(w, err, "Department not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	response.WriteJSON(w, http.StatusOK, board)
+}
+
+// CallNext calls the first waiting patient to the caller's room
+func (h *QueueHandler) CallNext(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var call models.QueueCall
+	if err := json.NewDecoder(r.Body).Decode(&call); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&call); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	entry, err := h.service.CallNext(r.Context(), mux.Vars(r)["department"], call.Room, user.UserID)
+	if err != nil {
+		writeQueueError(w, err, "Department not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, entry)
+}
+
+func (h *QueueHandler) GetEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid queue entry ID")
+		return
+	}
+
+	entry, err := h.service.GetEntry(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Queue entry not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, entry)
+}
+
+// Complete finishes a called patient as seen
+func (h *QueueHandler) Complete(w http.ResponseWriter, r *http.Request) {
+	h.finish(w, r, h.service.Complete)
+}
+
+// Leave takes a patient who left or didn't answer off the queue
+func (h *QueueHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	h.finish(w, r, h.service.Leave)
+}
+
+func (h *QueueHandler) finish(w http.ResponseWriter, r *http.Request, finish func(ctx context.Context, id int) (*models.QueueEntry, error)) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid queue entry ID")
+		return
+	}
+
+	entry, err := finish(r.Context(), id)
+	if err != nil {
+		writeQueueError(w, err, "Queue entry not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, entry)
+}
+
+func writeQueueError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrUnknownDepartment):
+		response.WriteError(w, http.StatusNotFound, "Department not found")
+	case errors.Is(err, services.ErrDepartmentInactive), errors.Is(err, services.ErrAlreadyQueued),
+		errors.Is(err, services.ErrQueueEmpty), errors.Is(err, services.ErrQueueEntryState):
+		response.WriteError(w, http.StatusConflict, err.Error())
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// RecordTemplateHandler exposes the visit templates medical records are
+// written from
+type RecordTemplateHandler struct {
+	service *services.RecordTemplateService
+}
+
+func NewRecordTemplateHandler(service *services.RecordTemplateService) *RecordTemplateHandler {
+	return &RecordTemplateHandler{service: service}
+}
+
+// GetTemplates lists the configured templates
+func (h *RecordTemplateHandler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.service.GetTemplates(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, templates)
+}
+
+func (h *RecordTemplateHandler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, err := h.service.GetTemplate(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		response.WriteServiceError(w, err, "Record template not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, template)
+}
+
+// SaveTemplate creates or updates the template named in the path (admins)
+func (h *RecordTemplateHandler) SaveTemplate(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	// Templates are active unless the body retires them with "active": false
+	template := models.RecordTemplate{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	template.Code = mux.Vars(r)["code"]
+
+	if err := validation.Struct(&template); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.SaveTemplate(r.Context(), &template, user.UserID); err != nil {
+		if errors.Is(err, services.ErrTemplateSectionKeys) {
+			response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		response.WriteServiceError(w, err, "Record template not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, template)
+}
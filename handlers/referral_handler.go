@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// ReferralHandler takes doctors' referrals and the receiving doctors'
+// decisions on them
+type ReferralHandler struct {
+	service *services.ReferralService
+}
+
+func NewReferralHandler(service *services.ReferralService) *ReferralHandler {
+	return &ReferralHandler{service: service}
+}
+
+// CreateReferral refers a patient from the calling doctor to toDoctorId or
+// to the department in specialty
+func (h *ReferralHandler) CreateReferral(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var referral models.Referral
+	if err := json.NewDecoder(r.Body).Decode(&referral); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&referral); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	referral.FromDoctorID = user.UserID
+	created, err := h.service.Create(r.Context(), &referral)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownPatient):
+			validation.WriteError(w, validation.Errors{{Field: "patientId", Message: "patientId must reference an existing patient"}})
+		case errors.Is(err, services.ErrSelfReferral):
+			validation.WriteError(w, validation.Errors{{Field: "toDoctorId", Message: "You can't refer a patient to yourself"}})
+		case errors.Is(err, services.ErrNotADoctor):
+			validation.WriteError(w, validation.Errors{{Field: "toDoctorId", Message: "toDoctorId must be a doctor"}})
+		case errors.Is(err, services.ErrNoSpecialist):
+			validation.WriteError(w, validation.Errors{{Field: "specialty", Message: "No other doctor practises this specialty"}})
+		default:
+			response.WriteServiceError(w, err, "Doctor not found")
+		}
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/referrals/%d", created.ReferralID))
+	response.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GetReferrals lists referrals, most urgent and then oldest first. A
+// doctor's list defaults to their own; ?doctorId= picks another doctor's
+// and ?direction= inbound or outbound narrows it, alongside ?patientId= and
+// ?status=.
+func (h *ReferralHandler) GetReferrals(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := services.ReferralFilter{Direction: query.Get("direction"), Status: query.Get("status")}
+	if user.Role == models.ROLE_DOCTOR {
+		filter.DoctorID = user.UserID
+	}
+
+	for name, target := range map[string]*int{"doctorId": &filter.DoctorID, "patientId": &filter.PatientID} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid "+name)
+			return
+		}
+		*target = id
+	}
+
+	switch filter.Direction {
+	case "", models.REFERRAL_DIRECTION_INBOUND, models.REFERRAL_DIRECTION_OUTBOUND:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "direction must be inbound or outbound")
+		return
+	}
+	if filter.Direction != "" && filter.DoctorID == 0 {
+		response.WriteError(w, http.StatusBadRequest, "direction needs a doctorId")
+		return
+	}
+
+	switch filter.Status {
+	case "", models.REFERRAL_STATUS_PENDING, models.REFERRAL_STATUS_ACCEPTED, models.REFERRAL_STATUS_DECLINED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be pending, accepted or declined")
+		return
+	}
+
+	referrals, err := h.service.GetReferrals(r.Context(), filter)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, referrals)
+}
+
+func (h *ReferralHandler) GetReferral(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid referral ID")
+		return
+	}
+
+	referral, err := h.service.GetReferral(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Referral not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, referral)
+}
+
+// Decide accepts or declines a pending referral addressed to the calling
+// doctor or their department, booking the appointment given on accepting
+func (h *ReferralHandler) Decide(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid referral ID")
+		return
+	}
+
+	var decision models.ReferralDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	if err := validation.Struct(&decision); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	referral, err := h.service.Decide(r.Context(), id, user.UserID, &decision)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrReferralDecided):
+			response.WriteError(w, http.StatusConflict, "Referral has already been decided")
+		case errors.Is(err, services.ErrNotReferralRecipient):
+			response.WriteError(w, http.StatusForbidden, "Referral is not addressed to you or your department")
+		default:
+			writeAppointmentError(w, err, "Referral not found")
+		}
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, referral)
+}
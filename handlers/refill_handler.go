@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// RefillHandler takes prescription refill requests and doctors' decisions on them
+type RefillHandler struct {
+	service *services.RefillService
+	locks   *services.ChartLockService
+}
+
+func NewRefillHandler(service *services.RefillService) *RefillHandler {
+	return &RefillHandler{
+		service: service,
+		locks:   services.NewChartLockService(),
+	}
+}
+
+// CreateRequest records a refill request for the prescription in the path,
+// as asked by the patient or raised by the front desk
+func (h *RefillHandler) CreateRequest(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	prescriptionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid prescription ID")
+		return
+	}
+
+	var req models.RefillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	req.RequestedBy = user.UserID
+	created, err := h.service.CreateRequest(r.Context(), prescriptionID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrRefillPending) {
+			response.WriteError(w, http.StatusConflict, "Prescription already has a pending refill request")
+			return
+		}
+		response.WriteServiceError(w, err, "Prescription not found")
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/refill-requests/%d", created.RefillRequestID))
+	response.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GetRequests lists refill requests, oldest first, filtered by ?patientId= and ?status=
+func (h *RefillHandler) GetRequests(w http.ResponseWriter, r *http.Request) {
+	patientID := 0
+	if value := r.URL.Query().Get("patientId"); value != "" {
+		var err error
+		patientID, err = strconv.Atoi(value)
+		if err != nil || patientID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+			return
+		}
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.REFILL_STATUS_PENDING, models.REFILL_STATUS_APPROVED, models.REFILL_STATUS_DENIED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be pending, approved or denied")
+		return
+	}
+
+	requests, err := h.service.GetRequests(r.Context(), patientID, status)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, requests)
+}
+
+func (h *RefillHandler) GetRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid refill request ID")
+		return
+	}
+
+	req, err := h.service.GetRequest(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Refill request not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, req)
+}
+
+// Decide approves or denies a pending refill request. Approving writes the
+// refill prescription, so the patient's chart must not be locked by someone else.
+func (h *RefillHandler) Decide(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid refill request ID")
+		return
+	}
+
+	var decision models.RefillDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&decision); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	req, err := h.service.GetRequest(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Refill request not found")
+		return
+	}
+	if decision.Status == models.REFILL_STATUS_APPROVED && !chartWritable(w, r, h.locks, req.PatientID, user.UserID) {
+		return
+	}
+
+	req, err = h.service.Decide(r.Context(), id, user.UserID, &decision)
+	if err != nil {
+		if errors.Is(err, services.ErrRefillDecided) {
+			response.WriteError(w, http.StatusConflict, "Refill request has already been decided")
+			return
+		}
+		response.WriteServiceError(w, err, "Refill request not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, req)
+}
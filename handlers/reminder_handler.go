@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// ReminderHandler exposes the appointment reminders a patient is texted
+type ReminderHandler struct {
+	service *services.ReminderService
+}
+
+func NewReminderHandler(service *services.ReminderService) *ReminderHandler {
+	return &ReminderHandler{service: service}
+}
+
+// GetPreferences returns the patient's reminder preferences
+func (h *ReminderHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	prefs, err := h.service.GetPreferences(r.Context(), patientID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, prefs)
+}
+
+// SetPreferences saves the patient's reminder preferences
+func (h *ReminderHandler) SetPreferences(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["patientId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	// A reminder left out of the body stays on
+	prefs := models.ReminderPreferences{DayBefore: true, HourBefore: true}
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	prefs.PatientID = patientID
+
+	if err := h.service.SetPreferences(r.Context(), &prefs, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, prefs)
+}
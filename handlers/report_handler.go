@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// ReportHandler runs the predefined reports and manages their email schedules
+type ReportHandler struct {
+	service *services.ReportService
+	limits  StreamLimits
+}
+
+func NewReportHandler(service *services.ReportService, limits StreamLimits) *ReportHandler {
+	return &ReportHandler{service: service, limits: limits}
+}
+
+// GetReports lists the predefined reports
+func (h *ReportHandler) GetReports(w http.ResponseWriter, r *http.Request) {
+	response.WriteJSON(w, http.StatusOK, h.service.Definitions())
+}
+
+// RunReport runs a report over the facility-local dates ?from= to ?to=
+// (YYYY-MM-DD, inclusive), by default the last 7 days up to today, spanning
+// at most 5 years. ?format=csv streams it as a CSV download instead of JSON.
+func (h *ReportHandler) RunReport(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	to := timezone.StartOfDay(timezone.Now())
+	from := to.AddDate(0, 0, -6)
+
+	query := r.URL.Query()
+	var err error
+	if value := query.Get("from"); value != "" {
+		if from, err = timezone.ParseDate(value); err != nil {
+			response.WriteError(w, http.StatusBadRequest, "from must be a date (YYYY-MM-DD)")
+			return
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = timezone.ParseDate(value); err != nil {
+			response.WriteError(w, http.StatusBadRequest, "to must be a date (YYYY-MM-DD)")
+			return
+		}
+	}
+	if to.Before(from) {
+		response.WriteError(w, http.StatusBadRequest, "from must not be after to")
+		return
+	}
+	if to.After(from.AddDate(5, 0, 0)) {
+		response.WriteError(w, http.StatusBadRequest, "The date range may span at most 5 years")
+		return
+	}
+
+	switch query.Get("format") {
+	case "", "json":
+		report, err := h.service.Report(r.Context(), name, from, to)
+		if errors.Is(err, services.ErrUnknownReport) {
+			response.WriteError(w, http.StatusNotFound, "Report not found")
+			return
+		} else if err != nil {
+			response.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, report)
+	case "csv":
+		h.writeCSV(w, r, name, from, to)
+	default:
+		response.WriteError(w, http.StatusBadRequest, "format must be json or csv")
+	}
+}
+
+// writeCSV streams the report as it is read from the database
+func (h *ReportHandler) writeCSV(w http.ResponseWriter, r *http.Request, name string, from, to time.Time) {
+	if _, err := h.service.Definition(name); err != nil {
+		response.WriteError(w, http.StatusNotFound, "Report not found")
+		return
+	}
+
+	h.limits.stream(w, r, "text/csv; charset=utf-8", services.ReportFilename(name, from, to), func(ctx context.Context, out io.Writer) error {
+		return h.service.WriteCSV(ctx, name, from, to, out)
+	})
+}
+
+// CreateSchedule schedules a report to be emailed daily or weekly
+func (h *ReportHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule models.ReportSchedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&schedule); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.service.CreateSchedule(r.Context(), &schedule, user.UserID); err != nil {
+		if errors.Is(err, services.ErrUnknownReport) {
+			response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		response.WriteServiceError(w, err, "Report schedule not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, schedule)
+}
+
+func (h *ReportHandler) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.service.GetSchedules(r.Context())
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, schedules)
+}
+
+func (h *ReportHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid report schedule ID")
+		return
+	}
+
+	if err := h.service.DeleteSchedule(r.Context(), id); err != nil {
+		response.WriteServiceError(w, err, "Report schedule not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
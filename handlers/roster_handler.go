@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type RosterHandler struct {
+	service *services.RosterService
+}
+
+func NewRosterHandler(service *services.RosterService) *RosterHandler {
+	return &RosterHandler{service: service}
+}
+
+// GetDoctors lists doctors and their specialties, filtered by ?specialty=
+// and ?department=
+func (h *RosterHandler) GetDoctors(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	doctors, err := h.service.GetDoctors(r.Context(), query.Get("specialty"), query.Get("department"))
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, doctors)
+}
+
+// SetSpecialties replaces a doctor's specialties: {"specialties": ["cardiology"]}
+func (h *RosterHandler) SetSpecialties(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid doctor ID")
+		return
+	}
+
+	var req struct {
+		Specialties []string `json:"specialties" validate:"max=20,dive,required,max=100"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&req); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	doctor, err := h.service.SetSpecialties(r.Context(), id, req.Specialties)
+	if err != nil {
+		writeRosterError(w, err, "Doctor not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, doctor)
+}
+
+// CreateShift rosters a doctor on duty
+func (h *RosterHandler) CreateShift(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var shift models.DutyShift
+	if err := json.NewDecoder(r.Body).Decode(&shift); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	if err := validation.Struct(&shift); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	shift.CreatedBy = user.UserID
+	if err := h.service.CreateShift(r.Context(), &shift); err != nil {
+		writeRosterError(w, err, "Doctor not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, shift)
+}
+
+// GetShifts lists shifts overlapping ?from= to ?to= (default the next 7
+// days), optionally for ?doctorId=
+func (h *RosterHandler) GetShifts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, ok := parseTimeParam(w, query.Get("from"), "from", time.Now())
+	if !ok {
+		return
+	}
+	to, ok := parseTimeParam(w, query.Get("to"), "to", from.AddDate(0, 0, 7))
+	if !ok {
+		return
+	}
+
+	doctorID := 0
+	if value := query.Get("doctorId"); value != "" {
+		var err error
+		doctorID, err = strconv.Atoi(value)
+		if err != nil || doctorID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid doctor ID")
+			return
+		}
+	}
+
+	shifts, err := h.service.GetShifts(r.Context(), doctorID, from, to)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, shifts)
+}
+
+func (h *RosterHandler) DeleteShift(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid shift ID")
+		return
+	}
+
+	if err := h.service.DeleteShift(r.Context(), id); err != nil {
+		response.WriteServiceError(w, err, "Shift not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateTimeOff records time off for a doctor
+func (h *RosterHandler) CreateTimeOff(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var timeOff models.TimeOff
+	if err := json.NewDecoder(r.Body).Decode(&timeOff); err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	if err := validation.Struct(&timeOff); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	timeOff.CreatedBy = user.UserID
+	if err := h.service.CreateTimeOff(r.Context(), &timeOff); err != nil {
+		writeRosterError(w, err, "Doctor not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, timeOff)
+}
+
+// GetTimeOff lists time off overlapping ?from= to ?to= (default the next 30
+// days), optionally for ?doctorId=
+func (h *RosterHandler) GetTimeOff(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, ok := parseTimeParam(w, query.Get("from"), "from", time.Now())
+	if !ok {
+		return
+	}
+	to, ok := parseTimeParam(w, query.Get("to"), "to", from.AddDate(0, 0, 30))
+	if !ok {
+		return
+	}
+
+	doctorID := 0
+	if value := query.Get("doctorId"); value != "" {
+		var err error
+		doctorID, err = strconv.Atoi(value)
+		if err != nil || doctorID < 1 {
+			response.WriteError(w, http.StatusBadRequest, "Invalid doctor ID")
+			return
+		}
+	}
+
+	periods, err := h.service.GetTimeOff(r.Context(), doctorID, from, to)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, periods)
+}
+
+func (h *RosterHandler) DeleteTimeOff(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid time off ID")
+		return
+	}
+
+	if err := h.service.DeleteTimeOff(r.Context(), id); err != nil {
+		response.WriteServiceError(w, err, "Time off not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAvailability lists the doctor's open slots between ?from= and ?to=
+// (default the next 7 days, at most 31), ?slotMinutes= long (default 30)
+func (h *RosterHandler) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid doctor ID")
+		return
+	}
+
+	query := r.URL.Query()
+	from, ok := parseTimeParam(w, query.Get("from"), "from", time.Now())
+	if !ok {
+		return
+	}
+	to, ok := parseTimeParam(w, query.Get("to"), "to", from.AddDate(0, 0, 7))
+	if !ok {
+		return
+	}
+	if !to.After(from) || to.After(from.AddDate(0, 0, 31)) {
+		response.WriteError(w, http.StatusBadRequest, "to must be after from and at most 31 days later")
+		return
+	}
+
+	slotMinutes := 30
+	if value := query.Get("slotMinutes"); value != "" {
+		slotMinutes, err = strconv.Atoi(value)
+		if err != nil || slotMinutes < 5 || slotMinutes > 480 {
+			response.WriteError(w, http.StatusBadRequest, "slotMinutes must be between 5 and 480")
+			return
+		}
+	}
+
+	availability, err := h.service.GetAvailability(r.Context(), id, from, to, time.Duration(slotMinutes)*time.Minute)
+	if err != nil {
+		writeRosterError(w, err, "Doctor not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, availability)
+}
+
+// parseTimeParam parses an optional query parameter holding an RFC 3339 time
+// or a facility-local wall time, writing a 400 and returning false when it is
+// malformed or names a local time a DST transition skips or repeats
+func parseTimeParam(w http.ResponseWriter, value, name string, fallback time.Time) (time.Time, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	t, err := timezone.Parse(value)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, name+": "+err.Error())
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// writeBodyError answers a request body that failed to decode: 422 when it
+// names a local time a DST transition skips or repeats, otherwise 400
+func writeBodyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, timezone.ErrNonexistentLocalTime) || errors.Is(err, timezone.ErrAmbiguousLocalTime) {
+		response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+}
+
+func writeRosterError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrNotADoctor):
+		response.WriteError(w, http.StatusUnprocessableEntity, "User is not a doctor")
+	case errors.Is(err, services.ErrShiftOverlap):
+		response.WriteError(w, http.StatusConflict, "Shift overlaps another shift for the same doctor")
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// streamFlushBytes is how much of a streamed download is buffered before
+// it is sent on as a chunk
+const streamFlushBytes = 32 << 10
+
+// StreamLimits bound a download written row by row as it is read from the
+// database, in place of the request timeouts that suit ordinary requests
+type StreamLimits struct {
+	// MaxDuration cuts the download short after this long
+	MaxDuration time.Duration
+	// WriteTimeout is how long the client may take to accept each chunk
+	WriteTimeout time.Duration
+}
+
+// stream sends what write writes as a chunked download. The writes block
+// while the client falls behind, which holds write's database cursor back
+// with it, and fail once the client stops reading for WriteTimeout. If write
+// fails before anything was sent its error is written as usual; after that
+// the connection is aborted, so the client sees a truncated transfer rather
+// than a complete-looking file.
+func (l StreamLimits) stream(w http.ResponseWriter, r *http.Request, contentType, filename string,
+	write func(ctx context.Context, out io.Writer) error) {
+	ctx, cancel := middleware.WithoutQueryTimeout(r)
+	defer cancel()
+	if l.MaxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, l.MaxDuration)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	out := &streamWriter{w: w, controller: http.NewResponseController(w), timeout: l.WriteTimeout}
+	err := out.extendDeadline()
+	if err == nil {
+		err = write(ctx, out)
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err == nil {
+		return
+	}
+
+	if !out.started {
+		w.Header().Del("Content-Disposition")
+		response.WriteServiceError(w, err, "Not found")
+		return
+	}
+	slog.Error("Streamed download cut short", "path", r.URL.Path, "bytes", out.written, "error", err)
+	panic(http.ErrAbortHandler)
+}
+
+// streamWriter flushes a streamed download every streamFlushBytes, giving
+// the client a fresh WriteTimeout to take each chunk
+type streamWriter struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	timeout    time.Duration
+	started    bool
+	written    int64
+	pending    int
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.started = true
+	n, err := s.w.Write(p)
+	s.written += int64(n)
+	s.pending += n
+	if err == nil && s.pending >= streamFlushBytes {
+		err = s.Flush()
+	}
+	return n, err
+}
+
+// Flush sends what has been written so far
+func (s *streamWriter) Flush() error {
+	s.pending = 0
+	if err := s.controller.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return s.extendDeadline()
+}
+
+// extendDeadline replaces the server's write timeout, which would cut off
+// any long download, with one for the next chunk
+func (s *streamWriter) extendDeadline() error {
+	var deadline time.Time
+	if s.timeout > 0 {
+		deadline = time.Now().Add(s.timeout)
+	}
+	if err := s.controller.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/dto"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// TimelineHandler serves a patient's longitudinal view
+type TimelineHandler struct {
+	service *services.TimelineService
+}
+
+func NewTimelineHandler(service *services.TimelineService) *TimelineHandler {
+	return &TimelineHandler{service: service}
+}
+
+// GetTimeline returns a page of the patient's timeline, filtered by
+// ?types= (comma-separated) and paged with ?limit= and ?offset=. Nurses see
+// medical records in the nurse view.
+func (h *TimelineHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	patientID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+
+	var types []string
+	if value := r.URL.Query().Get("types"); value != "" {
+		for _, entryType := range strings.Split(value, ",") {
+			entryType = strings.TrimSpace(entryType)
+			switch entryType {
+			case models.TIMELINE_MEDICAL_RECORD, models.TIMELINE_PRESCRIPTION, models.TIMELINE_LAB_RESULT, models.TIMELINE_ADMISSION:
+				types = append(types, entryType)
+			default:
+				response.WriteError(w, http.StatusBadRequest, "types must be medical_record, prescription, lab_result or admission")
+				return
+			}
+		}
+	}
+
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 200 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 200")
+			return
+		}
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			response.WriteError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+	}
+
+	nurseView := user.Role == models.ROLE_NURSE
+	timeline, err := h.service.GetTimeline(r.Context(), patientID, types, nurseView, limit, offset)
+	if err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	dto.WriteJSON(w, r, http.StatusOK, timeline)
+}
@@ -2,21 +2,29 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/kinyaelgrande/simple-hospital/dto"
 	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/response"
 	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
 	"github.com/pquerna/otp/totp"
 )
 
 type TwoFAHandler struct {
-	userService *services.UserService
+	userService   *services.UserService
+	notifications *services.NotificationService
 }
 
-func NewTwoFAHandler(userService *services.UserService) *TwoFAHandler {
+// NewTwoFAHandler raises a security alert through notifications when a user
+// turns 2FA off
+func NewTwoFAHandler(userService *services.UserService, notifications *services.NotificationService) *TwoFAHandler {
 	return &TwoFAHandler{
-		userService: userService,
+		userService:   userService,
+		notifications: notifications,
 	}
 }
 
@@ -24,26 +32,25 @@ func NewTwoFAHandler(userService *services.UserService) *TwoFAHandler {
 func (h *TwoFAHandler) GenerateTwoFASetup(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	twoFAService := h.userService.GetTwoFAService()
-	setup, err := twoFAService.GenerateTwoFASetup(user.Username)
+	setup, err := twoFAService.GenerateTwoFASetup(r.Context(), user.Username)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(setup)
+	response.WriteJSON(w, http.StatusOK, setup)
 }
 
 // EnableTwoFA enables 2FA for the authenticated user
 func (h *TwoFAHandler) EnableTwoFA(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
@@ -54,69 +61,68 @@ func (h *TwoFAHandler) EnableTwoFA(w http.ResponseWriter, r *http.Request) {
 
 	var req EnableRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	twoFAService := h.userService.GetTwoFAService()
-	backupCodes, err := twoFAService.EnableTwoFA(user.UserID, req.Secret, req.Code)
+	backupCodes, err := twoFAService.EnableTwoFA(r.Context(), user.UserID, req.Secret, req.Code)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	response := map[string]interface{}{
+	body := map[string]interface{}{
 		"message":     "2FA enabled successfully",
 		"backupCodes": backupCodes,
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusOK, body)
 }
 
 // DisableTwoFA disables 2FA for the authenticated user
 func (h *TwoFAHandler) DisableTwoFA(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	twoFAService := h.userService.GetTwoFAService()
-	err := twoFAService.DisableTwoFA(user.UserID)
+	err := twoFAService.DisableTwoFA(r.Context(), user.UserID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "2FA disabled successfully"})
+	h.notifications.SecurityAlert(r.Context(), "Two-factor authentication disabled",
+		fmt.Sprintf("%s (user %d) disabled two-factor authentication on their account.", user.Username, user.UserID))
+	response.WriteJSON(w, http.StatusOK, map[string]string{"message": "2FA disabled successfully"})
 }
 
 // GetTwoFAStatus gets the 2FA status for the authenticated user
 func (h *TwoFAHandler) GetTwoFAStatus(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
 	twoFAService := h.userService.GetTwoFAService()
-	enabled, err := twoFAService.GetUserTwoFAStatus(user.UserID)
+	enabled, err := twoFAService.GetUserTwoFAStatus(r.Context(), user.UserID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"enabled": enabled, "user": user})
+	response.WriteJSON(w, http.StatusOK, map[string]any{"enabled": enabled, "user": dto.NewUser(user)})
 }
 
 // VerifyTwoFACode verifies a 2FA code (for testing purposes)
 func (h *TwoFAHandler) VerifyTwoFACode(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
@@ -126,40 +132,41 @@ func (h *TwoFAHandler) VerifyTwoFACode(w http.ResponseWriter, r *http.Request) {
 
 	var req VerifyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	twoFAService := h.userService.GetTwoFAService()
-	valid, err := twoFAService.VerifyTwoFA(user.UserID, req.Code)
+	valid, err := twoFAService.VerifyTwoFA(r.Context(), user.UserID, req.Code)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"valid": valid})
+	response.WriteJSON(w, http.StatusOK, map[string]bool{"valid": valid})
 }
 
-// GetServerTime returns the current server time for debugging time sync issues
+// GetServerTime returns the current time in UTC and in the hospital's zone
+// for debugging time sync issues
 func (h *TwoFAHandler) GetServerTime(w http.ResponseWriter, r *http.Request) {
-	serverTime := time.Now()
+	serverTime := time.Now().UTC()
 
-	response := map[string]interface{}{
+	body := map[string]interface{}{
 		"serverTime": serverTime.Format(time.RFC3339),
 		"unix":       serverTime.Unix(),
-		"utc":        serverTime.UTC().Format(time.RFC3339),
+		"utc":        serverTime.Format(time.RFC3339),
+		"localTime":  timezone.In(serverTime).Format(time.RFC3339),
+		"timezone":   timezone.Location().String(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusOK, body)
 }
 
 // GenerateCurrentTOTP generates the current TOTP code for debugging
 func (h *TwoFAHandler) GenerateCurrentTOTP(w http.ResponseWriter, r *http.Request) {
 	_, ok := middleware.GetUserFromContext(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
 
@@ -169,28 +176,31 @@ func (h *TwoFAHandler) GenerateCurrentTOTP(w http.ResponseWriter, r *http.Reques
 
 	var req GenerateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if req.Secret == "" {
-		http.Error(w, "Secret is required", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Secret is required")
 		return
 	}
 
-	// Generate current TOTP code
-	currentCode, err := totp.GenerateCode(req.Secret, time.Now())
+	// Generate current TOTP code. Codes depend only on the Unix time, so the
+	// hospital's zone is reported for reading the times, not for the code.
+	now := time.Now().UTC()
+	currentCode, err := totp.GenerateCode(req.Secret, now)
 	if err != nil {
-		http.Error(w, "Failed to generate TOTP code", http.StatusInternalServerError)
+		response.WriteError(w, http.StatusInternalServerError, "Failed to generate TOTP code")
 		return
 	}
 
-	response := map[string]interface{}{
+	body := map[string]interface{}{
 		"currentCode": currentCode,
-		"serverTime":  time.Now().Format(time.RFC3339),
-		"unix":        time.Now().Unix(),
+		"serverTime":  now.Format(time.RFC3339),
+		"unix":        now.Unix(),
+		"localTime":   timezone.In(now).Format(time.RFC3339),
+		"timezone":    timezone.Location().String(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	response.WriteJSON(w, http.StatusOK, body)
 }
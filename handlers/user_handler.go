@@ -1,86 +1,299 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/dto"
 	"github.com/kinyaelgrande/simple-hospital/middleware"
 	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
 	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
 )
 
 type UserHandler struct {
-	service *services.UserService
+	service       *services.UserService
+	notifications *services.NotificationService
+	logins        *services.LoginEventService
 }
 
-func NewUserHandler() *UserHandler {
+// NewUserHandler raises a security alert through notifications when an
+// admin account is created, and reads login history from logins
+func NewUserHandler(service *services.UserService, notifications *services.NotificationService, logins *services.LoginEventService) *UserHandler {
 	return &UserHandler{
-		service: services.NewUserService(),
+		service:       service,
+		notifications: notifications,
+		logins:        logins,
 	}
 }
 
+// CreateUser creates an account with the role it is given (admins)
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	middleware.RequireRole(models.ROLE_ADMIN)
 	var user models.User
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if err := h.service.CreateUser(&user); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Canonical before validating, so the patientId rules see "Patient"
+	if role, ok := models.CanonicalRole(user.Role); ok {
+		user.Role = role
+	}
+	if err := validation.Struct(&user); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if err := h.service.CreateUser(r.Context(), &user); err != nil {
+		if errors.Is(err, services.ErrUnknownPatient) {
+			validation.WriteError(w, validation.Errors{{Field: "patientId", Message: "patientId must reference an existing patient"}})
+			return
+		}
+		response.WriteServiceError(w, err, "User not found")
 		return
 	}
+	if user.Role == models.ROLE_ADMIN {
+		creator := "unknown"
+		if admin, ok := middleware.GetUserFromContext(r); ok {
+			creator = admin.Username
+		}
+		h.notifications.SecurityAlert(r.Context(), "Admin account created",
+			fmt.Sprintf("%s created the admin account %s (user %d).", creator, user.Username, user.UserID))
+	}
 
-	// TODO: create a user response model
-	user.PasswordHash = ""
-	user.Role = strings.ToLower(user.Role)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	dto.WriteJSON(w, r, http.StatusCreated, user)
 }
 
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		response.WriteError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	user, err := h.service.GetUser(id)
+	user, err := h.service.GetUser(r.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		response.WriteServiceError(w, err, "User not found")
 		return
 	}
 
-	// TODO: create a user response model
-	user.PasswordHash = ""
-	user.Role = strings.ToLower(user.Role)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	dto.WriteJSON(w, r, http.StatusOK, user)
 }
 
+// GetUsers lists users, optionally only those with ?role=, whose username or
+// full name contains ?q=, or with ?active= true or false. ?limit= (at most
+// 1000) and ?offset= page the result, and the X-Total-Count header gives the
+// number matching across all pages.
 func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.service.GetUsers()
+	query := r.URL.Query()
+	filter := services.UserFilter{Query: strings.TrimSpace(query.Get("q"))}
+
+	if value := query.Get("role"); value != "" {
+		role, ok := models.CanonicalRole(value)
+		if !ok {
+			response.WriteError(w, http.StatusBadRequest, "role must be one of "+strings.Join(models.Roles(), ", "))
+			return
+		}
+		filter.Role = role
+	}
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			response.WriteError(w, http.StatusBadRequest, "active must be true or false")
+			return
+		}
+		filter.Active = &active
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			response.WriteError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+		filter.Offset = offset
+	}
+
+	users, total, err := h.service.SearchUsers(r.Context(), filter)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set(TotalCountHeader, strconv.Itoa(total))
+	dto.WriteJSON(w, r, http.StatusOK, users)
+}
+
+// GetMe returns the signed-in user's own account
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	current, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	user, err := h.service.GetUser(r.Context(), current.UserID)
+	if err != nil {
+		response.WriteServiceError(w, err, "User not found")
+		return
+	}
+
+	dto.WriteJSON(w, r, http.StatusOK, user)
+}
+
+// UpdateMe lets the signed-in user change their full name and notification
+// preferences; the username, role and credentials stay with the admins and
+// the 2FA endpoints
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	current, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var profile models.ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := validation.Struct(&profile); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	user, err := h.service.UpdateProfile(r.Context(), current.UserID, &profile)
+	if err != nil {
+		response.WriteServiceError(w, err, "User not found")
+		return
+	}
+
+	dto.WriteJSON(w, r, http.StatusOK, user)
+}
+
+// UpdateRole changes a user's role (admins). Body: {"role": "Nurse"}.
+func (h *UserHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	// TODO: create a user response model
-	for i := range users {
-		users[i].PasswordHash = ""
-		users[i].Role = strings.ToLower(users[i].Role)
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	role, ok := models.CanonicalRole(req.Role)
+	if !ok {
+		validation.WriteError(w, validation.Errors{{Field: "role", Message: "role must be one of " + strings.Join(models.Roles(), ", ")}})
+		return
+	}
+	if id == admin.UserID {
+		response.WriteError(w, http.StatusConflict, "You cannot change your own role")
+		return
+	}
+
+	previous, err := h.service.GetUser(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "User not found")
+		return
+	}
+	user, err := h.service.ChangeRole(r.Context(), id, role, admin.UserID)
+	if err != nil {
+		if errors.Is(err, services.ErrPatientRoleChange) {
+			validation.WriteError(w, validation.Errors{{Field: "role", Message: err.Error()}})
+			return
+		}
+		response.WriteServiceError(w, err, "User not found")
+		return
+	}
+	if user.Role == models.ROLE_ADMIN && previous.Role != models.ROLE_ADMIN {
+		h.notifications.SecurityAlert(r.Context(), "User promoted to admin",
+			fmt.Sprintf("%s made %s (user %d) an admin; they were %s.", admin.Username, user.Username, user.UserID, previous.Role))
+	}
+
+	dto.WriteJSON(w, r, http.StatusOK, user)
+}
+
+// GetLoginHistory lists a user's authentication attempts, newest first
+// (admins)
+func (h *UserHandler) GetLoginHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if _, err := h.service.GetUser(r.Context(), id); err != nil {
+		response.WriteServiceError(w, err, "User not found")
+		return
+	}
+	h.writeLoginHistory(w, r, id)
+}
+
+// GetMyLoginHistory lists the signed-in user's own authentication attempts,
+// newest first, so they can spot logins that weren't theirs
+func (h *UserHandler) GetMyLoginHistory(w http.ResponseWriter, r *http.Request) {
+	current, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	h.writeLoginHistory(w, r, current.UserID)
+}
+
+// writeLoginHistory writes the page of the user's login events picked by
+// ?limit= (1 to 200, default 50) and ?offset=, with the total across all
+// pages in X-Total-Count
+func (h *UserHandler) writeLoginHistory(w http.ResponseWriter, r *http.Request, userID int) {
+	var err error
+	limit := 50
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 200 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 200")
+			return
+		}
+	}
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			response.WriteError(w, http.StatusBadRequest, "offset must be a non-negative integer")
+			return
+		}
+	}
+
+	events, total, err := h.logins.History(r.Context(), userID, limit, offset)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	w.Header().Set(TotalCountHeader, strconv.Itoa(total))
+	response.WriteJSON(w, http.StatusOK, events)
 }
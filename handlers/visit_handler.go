@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+type VisitHandler struct {
+	service *services.VisitService
+	locks   *services.ChartLockService
+}
+
+func NewVisitHandler(service *services.VisitService) *VisitHandler {
+	return &VisitHandler{
+		service: service,
+		locks:   services.NewChartLockService(),
+	}
+}
+
+// CreateVisit creates a medical record and its prescriptions atomically.
+// Prescriptions are for the record's patient, by the signed-in doctor unless
+// given, and dated the visit date unless given. Safety warnings on any
+// prescription reject the whole visit with 409 unless that prescription has
+// an overrideReason.
+func (h *VisitHandler) CreateVisit(w http.ResponseWriter, r *http.Request) {
+	var visit models.Visit
+	if err := json.NewDecoder(r.Body).Decode(&visit); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if visit.Record.DoctorID == 0 {
+		visit.Record.DoctorID = user.UserID
+	}
+	for i := range visit.Prescriptions {
+		prescription := &visit.Prescriptions[i]
+		prescription.PatientID = visit.Record.PatientID
+		if prescription.DoctorID == 0 {
+			prescription.DoctorID = visit.Record.DoctorID
+		}
+		if prescription.PrescribedDate == "" {
+			prescription.PrescribedDate = visit.Record.VisitDate
+		}
+	}
+
+	if err := validation.Struct(&visit); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	if !chartWritable(w, r, h.locks, visit.Record.PatientID, user.UserID) {
+		return
+	}
+
+	warnings, err := h.service.CheckPrescriptions(r.Context(), &visit)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownMedication) {
+			response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if errors.Is(err, services.ErrUnknownPatient) {
+			validation.WriteError(w, validation.Errors{{Field: "record.patient_id", Message: "record.patient_id must reference an existing patient"}})
+			return
+		}
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	var unresolved []map[string]any
+	for i, found := range warnings {
+		if len(found) > 0 && visit.Prescriptions[i].OverrideReason == "" {
+			unresolved = append(unresolved, map[string]any{"index": i, "warnings": found})
+		}
+	}
+	if len(unresolved) > 0 {
+		response.WriteErrorDetails(w, http.StatusConflict, "prescription_warnings",
+			"Prescriptions have safety warnings; resubmit them with overrideReason to proceed",
+			map[string]any{"prescriptions": unresolved})
+		return
+	}
+
+	if err := h.service.CreateVisit(r.Context(), &visit, user.UserID, warnings); err != nil {
+		if errors.Is(err, services.ErrUnknownDiagnosisCode) || isTemplateError(err) {
+			response.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, visit)
+}
+
+// maxVisitPrescriptions caps the prescriptions added to a visit at once, as
+// models.Visit does for a new visit
+const maxVisitPrescriptions = 20
+
+// AddPrescriptions creates several prescriptions for an earlier visit at
+// once: an array of prescriptions for the record's patient, linked to the
+// record, by the signed-in doctor unless given and dated the visit date
+// unless given. Every item is validated and safety-checked first; if any
+// fails, none are created and the errors or warnings are reported per item
+// by index, with 409 when only unresolved warnings remain. Otherwise they
+// are created in one transaction and returned in order with their IDs.
+func (h *VisitHandler) AddPrescriptions(w http.ResponseWriter, r *http.Request) {
+	recordID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid medical record ID")
+		return
+	}
+
+	var prescriptions []models.Prescription
+	if err := json.NewDecoder(r.Body).Decode(&prescriptions); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(prescriptions) == 0 || len(prescriptions) > maxVisitPrescriptions {
+		validation.WriteError(w, validation.Errors{{Field: "prescriptions",
+			Message: "prescriptions must list between 1 and " + strconv.Itoa(maxVisitPrescriptions) + " items"}})
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	record, err := h.service.GetRecord(r.Context(), recordID)
+	if err != nil {
+		response.WriteServiceError(w, err, "Medical record not found")
+		return
+	}
+	if !chartWritable(w, r, h.locks, record.PatientID, user.UserID) {
+		return
+	}
+
+	warnings := make([][]models.PrescriptionWarning, len(prescriptions))
+	var invalid, unresolved []map[string]any
+	for i := range prescriptions {
+		prescription := &prescriptions[i]
+		prescription.PatientID = record.PatientID
+		prescription.RecordID = &record.RecordID
+		if prescription.DoctorID == 0 {
+			prescription.DoctorID = user.UserID
+		}
+		if prescription.PrescribedDate == "" {
+			prescription.PrescribedDate = record.VisitDate
+		}
+
+		if err := validation.Struct(prescription); err != nil {
+			var fieldErrors validation.Errors
+			if !errors.As(err, &fieldErrors) {
+				response.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			invalid = append(invalid, map[string]any{"index": i, "errors": fieldErrors})
+			continue
+		}
+
+		found, err := h.service.CheckPrescription(r.Context(), prescription)
+		if errors.Is(err, services.ErrUnknownMedication) {
+			invalid = append(invalid, map[string]any{"index": i,
+				"errors": validation.Errors{{Field: "medicationId", Message: err.Error()}}})
+			continue
+		}
+		if err != nil {
+			response.WriteServiceError(w, err, "Patient not found")
+			return
+		}
+		warnings[i] = found
+		if len(found) > 0 && prescription.OverrideReason == "" {
+			unresolved = append(unresolved, map[string]any{"index": i, "warnings": found})
+		}
+	}
+
+	if len(invalid) > 0 {
+		response.WriteErrorDetails(w, http.StatusUnprocessableEntity, response.CodeValidationFailed,
+			"Prescriptions failed validation; none were created", map[string]any{"prescriptions": append(invalid, unresolved...)})
+		return
+	}
+	if len(unresolved) > 0 {
+		response.WriteErrorDetails(w, http.StatusConflict, "prescription_warnings",
+			"Prescriptions have safety warnings; resubmit them with overrideReason to proceed",
+			map[string]any{"prescriptions": unresolved})
+		return
+	}
+
+	if err := h.service.AddPrescriptions(r.Context(), prescriptions, user.UserID, warnings); err != nil {
+		response.WriteServiceError(w, err, "Patient not found")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, prescriptions)
+}
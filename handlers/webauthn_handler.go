@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+)
+
+// WebAuthnHandler exposes passkey/security key registration and the
+// WebAuthn alternative to TOTP codes during 2FA login
+type WebAuthnHandler struct {
+	userService  *services.UserService
+	sessionStore session.Store
+	logins       *services.LoginEventService
+}
+
+// NewWebAuthnHandler records security key logins through logins
+func NewWebAuthnHandler(userService *services.UserService, sessionStore session.Store, logins *services.LoginEventService) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		userService:  userService,
+		sessionStore: sessionStore,
+		logins:       logins,
+	}
+}
+
+// BeginRegistration returns the credential creation options for the authenticated user
+func (h *WebAuthnHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	options, err := h.userService.GetWebAuthnService().BeginRegistration(r.Context(), user)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, options)
+}
+
+// FinishRegistration verifies the authenticator attestation and stores the credential.
+// The optional ?name= query parameter labels the key (e.g. "YubiKey", "Laptop")
+func (h *WebAuthnHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	credential, err := h.userService.GetWebAuthnService().FinishRegistration(r.Context(), user, r.URL.Query().Get("name"), r)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, credential)
+}
+
+// ListCredentials lists the authenticated user's security keys
+func (h *WebAuthnHandler) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	credentials, err := h.userService.GetWebAuthnService().ListCredentials(r.Context(), user.UserID)
+	if err != nil {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, credentials)
+}
+
+// DeleteCredential removes one of the authenticated user's security keys
+func (h *WebAuthnHandler) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid credential ID")
+		return
+	}
+
+	if err := h.userService.GetWebAuthnService().DeleteCredential(r.Context(), user.UserID, id); err != nil {
+		response.WriteServiceError(w, err, "Credential not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginLogin returns assertion options for a pending 2FA session created by /api/auth/2fa/initiate
+func (h *WebAuthnHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	type BeginLoginRequest struct {
+		SessionID string `json:"sessionId"`
+	}
+
+	var req BeginLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	pending, exists := h.sessionStore.Get(req.SessionID)
+	if !exists || pending.Authenticated {
+		response.WriteError(w, http.StatusUnauthorized, "Invalid or expired 2FA session. Please login again.")
+		return
+	}
+
+	user, err := h.userService.GetUser(r.Context(), pending.UserID)
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	options, err := h.userService.GetWebAuthnService().BeginLogin(r.Context(), user, pending.SessionID)
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, options)
+}
+
+// FinishLogin verifies the assertion and marks the 2FA session (?sessionId=)
+// as authenticated, returning the session ID to use from then on or setting
+// it as a cookie in cookie mode
+func (h *WebAuthnHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("sessionId")
+	pending, exists := h.sessionStore.Get(sessionID)
+	if !exists || pending.Authenticated {
+		response.WriteError(w, http.StatusUnauthorized, "Invalid or expired 2FA session. Please login again.")
+		return
+	}
+
+	user, err := h.userService.GetUser(r.Context(), pending.UserID)
+	if err != nil {
+		response.WriteError(w, http.StatusUnauthorized, "User not found")
+		return
+	}
+
+	if err := h.userService.GetWebAuthnService().FinishLogin(r.Context(), user, sessionID, r); err != nil {
+		session.RecordLogin(r, h.logins, user.UserID, user.Username, models.LOGIN_METHOD_2FA, models.LOGIN_FAILURE_SECOND_FACTOR, false)
+		response.WriteError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// Stateless session tokens are replaced once authenticated
+	sessionID, ok := h.sessionStore.MarkAuthenticated(sessionID)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "Session expired during verification")
+		return
+	}
+	session.RecordLogin(r, h.logins, user.UserID, user.Username, models.LOGIN_METHOD_2FA, "", true)
+
+	body := session.AuthResponse{
+		Success:   true,
+		Message:   "2FA verification successful",
+		SessionID: sessionID,
+	}
+	if session.WantsCookie(r) && !session.IssueCookie(w, h.sessionStore, sessionID, &body) {
+		response.WriteError(w, http.StatusUnauthorized, "Session expired during verification")
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, body)
+}
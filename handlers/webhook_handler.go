@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/validation"
+)
+
+// WebhookHandler lets admins register the webhooks external systems are
+// sent events on, and inspect and retry their deliveries
+type WebhookHandler struct {
+	service *services.WebhookService
+}
+
+func NewWebhookHandler(service *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var request models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&request); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	webhook, err := h.service.Create(r.Context(), request, user.UserID)
+	if err != nil {
+		writeWebhookError(w, err, "Webhook not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.service.GetWebhooks(r.Context())
+	if err != nil {
+		response.WriteServiceError(w, err, "Webhooks not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	webhook, err := h.service.GetWebhook(r.Context(), id)
+	if err != nil {
+		response.WriteServiceError(w, err, "Webhook not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, webhook)
+}
+
+// UpdateWebhook replaces a webhook's settings, including its secret
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	var request models.WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := validation.Struct(&request); err != nil {
+		validation.WriteError(w, err)
+		return
+	}
+
+	webhook, err := h.service.Update(r.Context(), id, request, user.UserID)
+	if err != nil {
+		writeWebhookError(w, err, "Webhook not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		response.WriteError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id, user.UserID); err != nil {
+		response.WriteServiceError(w, err, "Webhook not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetEventTypes lists the event types webhooks can subscribe to
+func (h *WebhookHandler) GetEventTypes(w http.ResponseWriter, r *http.Request) {
+	response.WriteJSON(w, http.StatusOK, models.WebhookEventTypes())
+}
+
+// GetDeliveries is a webhook's delivery log, most recent first
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.WEBHOOK_DELIVERY_PENDING, models.WEBHOOK_DELIVERY_SENDING, models.WEBHOOK_DELIVERY_DELIVERED, models.WEBHOOK_DELIVERY_FAILED:
+	default:
+		response.WriteError(w, http.StatusBadRequest, "status must be pending, sending, delivered or failed")
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 1000 {
+			response.WriteError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+	}
+
+	deliveries, err := h.service.GetDeliveries(r.Context(), id, status, limit)
+	if err != nil {
+		response.WriteServiceError(w, err, "Webhook not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, deliveries)
+}
+
+// RetryDelivery requeues a failed delivery
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["deliveryId"])
+	if err != nil {
+		response.WriteError(w, http.StatusBadRequest, "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := h.service.RetryDelivery(r.Context(), id, deliveryID)
+	if err != nil {
+		writeWebhookError(w, err, "Delivery not found")
+		return
+	}
+	response.WriteJSON(w, http.StatusOK, delivery)
+}
+
+func writeWebhookError(w http.ResponseWriter, err error, notFoundMessage string) {
+	switch {
+	case errors.Is(err, services.ErrWebhookURL):
+		response.WriteError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrWebhookDeliveryState):
+		response.WriteError(w, http.StatusConflict, err.Error())
+	default:
+		response.WriteServiceError(w, err, notFoundMessage)
+	}
+}
@@ -0,0 +1,168 @@
+// Load scenario for the hot endpoints, with the p95 targets from docs.md
+// ("Performance") as thresholds, so k6 exits non-zero when one is missed:
+//
+//	k6 run -e BASE_URL=https://localhost:8443 -e USERNAME=loadtest \
+//	  -e PASSWORD=... -e TOTP_SECRET=... loadtest/k6.js
+//
+// The account needs 2FA enabled and read access to patients and
+// prescriptions, e.g. a doctor. Run it against a staging server with
+// production-sized data, never production: it logs in many times a second.
+
+import http from 'k6/http';
+import crypto from 'k6/crypto';
+import { check, fail } from 'k6';
+
+const BASE_URL = __ENV.BASE_URL || 'https://localhost:8443';
+const USERNAME = __ENV.USERNAME;
+const PASSWORD = __ENV.PASSWORD;
+const TOTP_SECRET = __ENV.TOTP_SECRET;
+
+export const options = {
+  // The development server's certificate is self-signed
+  insecureSkipTLSVerify: true,
+  scenarios: {
+    patients: {
+      executor: 'constant-arrival-rate',
+      exec: 'listPatients',
+      rate: 20,
+      timeUnit: '1s',
+      duration: '1m',
+      preAllocatedVUs: 20,
+    },
+    prescriptions: {
+      executor: 'constant-arrival-rate',
+      exec: 'patientPrescriptions',
+      rate: 100,
+      timeUnit: '1s',
+      duration: '1m',
+      preAllocatedVUs: 20,
+    },
+    expanded: {
+      executor: 'constant-arrival-rate',
+      exec: 'expandedPrescriptions',
+      rate: 20,
+      timeUnit: '1s',
+      duration: '1m',
+      preAllocatedVUs: 10,
+    },
+    login: {
+      executor: 'constant-arrival-rate',
+      exec: 'login',
+      rate: 5,
+      timeUnit: '1s',
+      duration: '1m',
+      preAllocatedVUs: 10,
+    },
+  },
+  thresholds: {
+    'http_req_failed': ['rate<0.01'],
+    'http_req_duration{endpoint:patients}': ['p(95)<300'],
+    'http_req_duration{endpoint:prescriptions}': ['p(95)<50'],
+    'http_req_duration{endpoint:expanded}': ['p(95)<100'],
+    'http_req_duration{endpoint:login}': ['p(95)<500'],
+  },
+};
+
+// setup logs in once for the read scenarios and collects the patients whose
+// prescriptions they read
+export function setup() {
+  if (!USERNAME || !PASSWORD || !TOTP_SECRET) {
+    fail('USERNAME, PASSWORD and TOTP_SECRET are required');
+  }
+  const sessionId = startSession();
+  const res = http.get(`${BASE_URL}/api/patients`, { headers: { 'X-Session-ID': sessionId } });
+  if (res.status !== 200) {
+    fail(`listing patients: ${res.status} ${res.body}`);
+  }
+  const patientIds = res.json().map((p) => p.id);
+  if (patientIds.length === 0) {
+    fail('the server has no patients; load some first, e.g. with seed -seed-demo-data');
+  }
+  return { sessionId, patientIds };
+}
+
+export function listPatients(data) {
+  const res = http.get(`${BASE_URL}/api/patients`, {
+    headers: { 'X-Session-ID': data.sessionId },
+    tags: { endpoint: 'patients' },
+  });
+  check(res, { 'patients 200': (r) => r.status === 200 });
+}
+
+export function patientPrescriptions(data) {
+  const id = data.patientIds[Math.floor(Math.random() * data.patientIds.length)];
+  const res = http.get(`${BASE_URL}/api/patients/${id}/prescriptions`, {
+    headers: { 'X-Session-ID': data.sessionId },
+    tags: { endpoint: 'prescriptions', name: '/api/patients/{id}/prescriptions' },
+  });
+  check(res, { 'prescriptions 200': (r) => r.status === 200 });
+}
+
+export function expandedPrescriptions(data) {
+  const res = http.get(`${BASE_URL}/api/prescriptions?limit=50&expand=patient,doctor`, {
+    headers: { 'X-Session-ID': data.sessionId },
+    tags: { endpoint: 'expanded' },
+  });
+  check(res, { 'expanded 200': (r) => r.status === 200 });
+}
+
+// login measures both steps of a login, then logs out so the account
+// doesn't run into MAX_SESSIONS_PER_USER
+export function login() {
+  const sessionId = startSession({ endpoint: 'login' });
+  http.post(`${BASE_URL}/api/auth/2fa/logout`, null, {
+    headers: { 'X-Session-ID': sessionId },
+    tags: { endpoint: 'logout' },
+  });
+}
+
+export function teardown(data) {
+  http.post(`${BASE_URL}/api/auth/2fa/logout`, null, { headers: { 'X-Session-ID': data.sessionId } });
+}
+
+function startSession(tags) {
+  const params = { headers: { 'Content-Type': 'application/json' }, tags: tags || {} };
+  const initiate = http.post(`${BASE_URL}/api/auth/2fa/initiate`,
+    JSON.stringify({ username: USERNAME, password: PASSWORD }), params);
+  if (!check(initiate, { 'initiate 200': (r) => r.status === 200 })) {
+    fail(`initiating login: ${initiate.status} ${initiate.body}`);
+  }
+  const verify = http.post(`${BASE_URL}/api/auth/2fa/verify`,
+    JSON.stringify({ tempSessionId: initiate.json('tempSessionId'), code: totp(TOTP_SECRET) }), params);
+  if (!check(verify, { 'verify 200': (r) => r.status === 200 })) {
+    fail(`verifying login: ${verify.status} ${verify.body}`);
+  }
+  return verify.json('sessionId');
+}
+
+// totp returns the current RFC 6238 code (SHA-1, 6 digits, 30 s) for a
+// base32 secret, as an authenticator app would
+function totp(secret) {
+  const counter = new Uint8Array(8);
+  let step = Math.floor(Date.now() / 1000 / 30);
+  for (let i = 7; i >= 0; i--) {
+    counter[i] = step & 0xff;
+    step = Math.floor(step / 256);
+  }
+  const hex = crypto.hmac('sha1', base32Decode(secret), counter.buffer, 'hex');
+  const offset = parseInt(hex.slice(-1), 16);
+  const code = (parseInt(hex.substr(offset * 2, 8), 16) & 0x7fffffff) % 1000000;
+  return String(code).padStart(6, '0');
+}
+
+function base32Decode(input) {
+  const alphabet = 'ABCDEFGHIJKLMNOPQRSTUVWXYZ234567';
+  const clean = input.toUpperCase().replace(/=+$/, '');
+  const bytes = [];
+  let bits = 0;
+  let value = 0;
+  for (const c of clean) {
+    value = (value << 5) | alphabet.indexOf(c);
+    bits += 5;
+    if (bits >= 8) {
+      bytes.push((value >>> (bits - 8)) & 0xff);
+      bits -= 8;
+    }
+  }
+  return new Uint8Array(bytes).buffer;
+}
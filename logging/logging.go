@@ -0,0 +1,69 @@
+// Package logging sets up the server's log output so that, at the normal
+// level, nothing that could carry patient data or credentials reaches it.
+//
+// Debug records, which may hold request bodies and the structs decoded from
+// them, are only written in debug mode (LOG_LEVEL=debug). Attributes are
+// redacted by key whatever the level: credentials such as passwords, 2FA
+// codes, secrets, API keys and session IDs always; request bodies, users
+// and patient records unless in debug mode. Messages are written as given, so values
+// that identify a session go in through Fingerprint rather than as is.
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the value of a redacted attribute
+const Redacted = "[REDACTED]"
+
+// credentialKeys are redacted at every level
+var credentialKeys = map[string]bool{
+	"password": true, "newpassword": true, "code": true, "totp": true, "backupcode": true, "backupcodes": true,
+	"secret": true, "token": true, "session": true, "sessionid": true, "tempsessionid": true,
+	"authorization": true, "cookie": true, "apikey": true,
+}
+
+// detailKeys may hold patient data and are redacted unless in debug mode
+var detailKeys = map[string]bool{
+	"body": true, "request": true, "user": true, "patient": true, "prescription": true, "record": true,
+	"notes": true, "diagnosis": true, "medicalhistory": true,
+}
+
+// Init makes the default logger write text records to w, at debug level
+// when debug is set and info otherwise. The log package's output goes
+// through it too.
+func Init(w io.Writer, debug bool) {
+	level := slog.LevelInfo
+	if debug {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			return redact(attr, debug)
+		},
+	})))
+}
+
+// redact blanks attr's value if its key is sensitive at this level
+func redact(attr slog.Attr, debug bool) slog.Attr {
+	key := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(attr.Key))
+	if credentialKeys[key] || (!debug && detailKeys[key]) {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// Fingerprint stands in for a session ID or token in logs: enough to match
+// up entries about the same one, not enough to use it
+func Fingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:4])
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -8,6 +9,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"flag"
 	"fmt"
 	"log"
 	"log/slog"
@@ -15,19 +17,22 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	gorillaHandlers "github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/config"
 	"github.com/kinyaelgrande/simple-hospital/database"
-	"github.com/kinyaelgrande/simple-hospital/handlers"
-	"github.com/kinyaelgrande/simple-hospital/middleware"
-	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/logging"
+	"github.com/kinyaelgrande/simple-hospital/server"
 	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+	"github.com/kinyaelgrande/simple-hospital/services/masking"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"github.com/kinyaelgrande/simple-hospital/tracing"
 )
 
-func generateSelfSignedCert() error {
+func generateSelfSignedCert(certPath, keyPath string) error {
 	// Generate private key
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -61,12 +66,12 @@ func generateSelfSignedCert() error {
 	}
 
 	// Create certs directory if it doesn't exist
-	if err := os.MkdirAll("certs", 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(certPath), 0755); err != nil {
 		return fmt.Errorf("failed to create certs directory: %v", err)
 	}
 
 	// Save certificate
-	certOut, err := os.Create("certs/server.crt")
+	certOut, err := os.Create(certPath)
 	if err != nil {
 		return fmt.Errorf("failed to create cert file: %v", err)
 	}
@@ -75,7 +80,10 @@ func generateSelfSignedCert() error {
 	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: certDER})
 
 	// Save private key
-	keyOut, err := os.Create("certs/server.key")
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0755); err != nil {
+		return fmt.Errorf("failed to create certs directory: %v", err)
+	}
+	keyOut, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to create key file: %v", err)
 	}
@@ -88,233 +96,324 @@ func generateSelfSignedCert() error {
 
 	pem.Encode(keyOut, &pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyDER})
 
-	slog.Info("Self-signed certificate generated: certs/server.crt and certs/server.key")
+	slog.Info("Self-signed certificate generated", "cert", certPath, "key", keyPath)
+	return nil
+}
+
+// seed creates the admin account if there is no admin yet and loads the
+// demo data if demo is set. Generated passwords are printed once, here.
+func seed(ctx context.Context, cfg *config.Config, seedService *services.SeedService, demo bool) error {
+	generated, created, err := seedService.BootstrapAdmin(ctx, cfg.AdminUsername, cfg.AdminPassword)
+	if err != nil {
+		return fmt.Errorf("creating the admin account failed: %v", err)
+	}
+	if created {
+		slog.Info("Admin account created", "username", cfg.AdminUsername)
+	}
+	if generated != "" {
+		fmt.Printf("\nGenerated password for admin account %q: %s\nIt is shown only once; sign in and set up 2FA.\n\n",
+			cfg.AdminUsername, generated)
+	}
+
+	if !demo {
+		return nil
+	}
+	summary, generated, err := seedService.SeedDemoData(ctx, cfg.DemoPassword)
+	if err != nil {
+		return fmt.Errorf("loading demo data failed: %v", err)
+	}
+	if summary.Users == 0 {
+		slog.Info("Demo data already loaded")
+		return nil
+	}
+	slog.Info("Demo data loaded", "users", summary.Users, "patients", summary.Patients, "visits", summary.Visits,
+		"prescriptions", summary.Prescriptions)
+	if generated != "" {
+		fmt.Printf("\nGenerated password for the demo.* accounts: %s\n\n", generated)
+	}
+	return nil
+}
+
+// backup runs the backup command: it backs up the database, or with list
+// prints the backups, newest first. restore restores the named backup.
+func backup(ctx context.Context, backupService *services.BackupService, command string, list bool, from string) error {
+	switch {
+	case command == "restore":
+		if from == "" {
+			return fmt.Errorf("restore needs -from, the name of a backup; list them with backup -list")
+		}
+		restore, err := backupService.Restore(ctx, from, 0)
+		if err != nil {
+			return fmt.Errorf("restoring %s failed: %v", from, err)
+		}
+		slog.Info("Backup restored", "backup", restore.Restored.Name, "safetyBackup", restore.SafetyBackup.Name)
+	case list:
+		backups, err := backupService.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, backup := range backups {
+			fmt.Printf("%s\t%d\t%s\n", backup.Name, backup.SizeBytes, backup.CreatedAt.Format(time.RFC3339))
+		}
+	default:
+		backup, err := backupService.Create(ctx, 0)
+		if err != nil {
+			return fmt.Errorf("backup failed: %v", err)
+		}
+		slog.Info("Backup written", "backup", backup.Name, "bytes", backup.SizeBytes)
+	}
 	return nil
 }
 
 func main() {
+	cfg := config.Load()
+	logging.Init(os.Stderr, cfg.Debug)
+	if cfg.Debug {
+		slog.Warn("Debug logging is on; request details, which may include patient data, are logged")
+	}
+
+	// "serve", the default, runs the server; "seed" creates the first admin
+	// and, with -seed-demo-data, the demo data, then exits. "backup" and
+	// "restore" back up and restore the database in BACKUP_DIR, and may be
+	// run alongside the server.
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve", "seed", "backup", "restore":
+	default:
+		log.Fatalf("Unknown command %q: use serve, seed, backup or restore", command)
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	maskExport := flags.String("mask-export", os.Getenv("MASK_EXPORT"), "write a de-identified copy of the database to this path and exit")
+	encryptColumns := flags.Bool("encrypt-columns", false, "encrypt plaintext sensitive columns and re-encrypt values under retired keys or in the old format, then exit")
+	openAPIOut := flags.String("openapi", "", "write the OpenAPI document to this path and exit, e.g. for generating the client SDKs")
+	seedDemoData := flags.Bool("seed-demo-data", false, "load demo staff, patients and visits for testing, unless already loaded")
+	listBackups := flags.Bool("list", false, "with backup, list the backups instead of taking one")
+	restoreFrom := flags.String("from", "", "with restore, the name of the backup to restore")
+	flags.Parse(args)
+
+	// Timestamps are stored in UTC whatever the host's zone; the facility
+	// zone is only applied at the API boundary
+	time.Local = time.UTC
+	facilityZone, err := time.LoadLocation(cfg.FacilityTimezone)
+	if err != nil {
+		log.Fatal("Invalid HOSPITAL_TIMEZONE: ", err)
+	}
+	timezone.Init(facilityZone)
+
+	// Medical history, allergies, doctor notes and 2FA secrets are encrypted
+	// at rest once keys are configured
+	var keyring *encryption.Keyring
+	if len(cfg.EncryptionKeys) > 0 {
+		keyID := cfg.EncryptionKeyID
+		if keyID == "" && len(cfg.EncryptionKeys) == 1 {
+			for id := range cfg.EncryptionKeys {
+				keyID = id
+			}
+		}
+		var err error
+		if keyring, err = encryption.NewKeyring(keyID, cfg.EncryptionKeys); err != nil {
+			log.Fatal("Invalid encryption keys: ", err)
+		}
+		encryption.Init(keyring)
+	} else {
+		slog.Warn("ENCRYPTION_KEYS is not set; sensitive columns are stored in plaintext")
+	}
+
 	// Initialize database
 	slog.Info("Initializing database")
-	if err := database.InitDB(); err != nil {
+	if err := database.Open(cfg.Database); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
-	slog.Info("Database initialized")
+	slog.Info("Database initialized", "dialect", database.CurrentDialect().Name())
 	defer database.GetDB().Close()
 
-	userService := services.NewUserService()
+	// Staging export mode: names, contacts and notes are scrambled
+	// deterministically per patient using MASK_EXPORT_KEY
+	if *maskExport != "" {
+		key := os.Getenv("MASK_EXPORT_KEY")
+		if key == "" {
+			log.Fatal("MASK_EXPORT_KEY must be set for --mask-export")
+		}
+		if err := masking.Export(*maskExport, key); err != nil {
+			log.Fatal("Masked export failed:", err)
+		}
+		return
+	}
 
-	// create an admin user
-	admin := models.User{
-		Username:     "admin",
-		PasswordHash: "password",
-		Role:         models.ROLE_ADMIN,
-		FullName:     "Admin User",
+	// Online backups of the SQLite database on demand; the server also takes
+	// them every BACKUP_INTERVAL
+	if command == "backup" || command == "restore" {
+		backupService, err := services.NewBackupService(cfg.BackupDir, cfg.BackupKeep)
+		if err != nil {
+			log.Fatal("Failed to open backup directory:", err)
+		}
+		if err := backup(context.Background(), backupService, command, *listBackups, *restoreFrom); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	err := userService.CreateUser(&admin)
-	if err != nil && !strings.Contains(err.Error(), "UNIQUE constraint failed") {
-		log.Fatal("Error creating admin user:", err)
+
+	// Key migration mode: encrypts rows written before encryption was enabled
+	// and moves rows off old keys after ENCRYPTION_KEY_ID changes, or off
+	// the enc:v1 format that bound values only to their column
+	if *encryptColumns {
+		if keyring == nil {
+			log.Fatal("ENCRYPTION_KEYS must be set for --encrypt-columns")
+		}
+		n, err := encryption.RewrapColumns(context.Background(), database.GetDB(), keyring)
+		if err != nil {
+			log.Fatal("Encrypting columns failed: ", err)
+		}
+		slog.Info("Sensitive columns encrypted", "rewritten", n)
+		return
 	}
-	if err == nil {
-		slog.Info("Admin user created successfully")
-	} else {
-		slog.Info("Admin user already exists")
-	}
-
-	// Create handlers
-	patientHandler := handlers.NewPatientHandler()
-	userHandler := handlers.NewUserHandler()
-	medicalRecordHandler := handlers.NewMedicalRecordHandler()
-	prescriptionHandler := handlers.NewPrescriptionHandler()
-	authHandler := handlers.NewAuthHandler()
-	twoFAHandler := handlers.NewTwoFAHandler(userService)
-	sessionAuthHandler := handlers.NewSessionAuthHandler(userService)
-	logoutHandler := handlers.NewLogoutHandler()
-
-	// Auth middleware - create single instance to share session manager
-	authMiddleware := middleware.NewAuthMiddleware(userService)
-	improvedAuthMiddleware := middleware.NewImprovedAuthMiddleware(userService)
-
-	router := mux.NewRouter()
-
-	// Health check endpoint (no auth required)
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		response := map[string]interface{}{
-			"status":    "healthy",
-			"timestamp": time.Now().Format(time.RFC3339),
-			"service":   "Hospital Management System",
+
+	// Request and database spans go to the OpenTelemetry collector, if one
+	// is configured; either way each response carries its request ID
+	if err := tracing.Init(cfg.Tracing); err != nil {
+		log.Fatal("Invalid tracing configuration: ", err)
+	}
+	app, err := newApp(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The first admin account, and the demo data when asked for
+	if err := seed(context.Background(), cfg, app.seedService, *seedDemoData); err != nil {
+		log.Fatal(err)
+	}
+	if command == "seed" {
+		return
+	}
+
+	// Spec dump mode: the document is built from the routes newApp registered
+	if *openAPIOut != "" {
+		document, err := app.spec.Build(app.router)
+		if err != nil {
+			log.Fatal("Building the OpenAPI document failed: ", err)
+		}
+		data, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			log.Fatal("Encoding the OpenAPI document failed: ", err)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-	}).Methods("GET")
-
-	// Public authentication endpoints (no auth middleware)
-	authRouter := router.PathPrefix("/api/auth").Subrouter()
-
-	// 2FA authentication endpoints
-	authRouter.HandleFunc("/2fa/initiate", improvedAuthMiddleware.Create2FAEndpoint()).Methods("POST")
-	authRouter.HandleFunc("/2fa/verify", improvedAuthMiddleware.Verify2FAEndpoint()).Methods("POST")
-	authRouter.HandleFunc("/2fa/logout", improvedAuthMiddleware.LogoutEndpoint()).Methods("POST")
-	authRouter.HandleFunc("/2fa/transition", improvedAuthMiddleware.BasicAuthTo2FATransitionEndpoint()).Methods("POST")
-	// 2FA setup endpoints (work with basic auth)
-	authRouter.HandleFunc("/2fa/setup", improvedAuthMiddleware.Setup2FAEndpoint()).Methods("GET")
-	authRouter.HandleFunc("/2fa/enable", improvedAuthMiddleware.Enable2FAEndpoint()).Methods("POST")
-
-	// Session-based authentication routes (alternative implementation)
-	authRouter.HandleFunc("/login", sessionAuthHandler.Login).Methods("POST")
-	authRouter.HandleFunc("/verify-2fa", sessionAuthHandler.Verify2FA).Methods("POST")
-	authRouter.HandleFunc("/logout", sessionAuthHandler.Logout).Methods("POST")
-	authRouter.HandleFunc("/session", sessionAuthHandler.GetSessionInfo).Methods("GET")
-
-	// Legacy login route with basic auth
-	router.Handle("/login", improvedAuthMiddleware.SmartAuth(http.HandlerFunc(authHandler.Login))).Methods("POST")
-
-	// Debug endpoints
-	router.HandleFunc("/api/auth/2fa/debug/sessions", func(w http.ResponseWriter, r *http.Request) {
-		sessionManager := improvedAuthMiddleware.GetTwoFASessionManager()
-		sessionCount := sessionManager.GetSessionCount()
-
-		response := map[string]interface{}{
-			"totalSessions": sessionCount,
-			"currentTime":   time.Now().Format(time.RFC3339),
+		if err := os.WriteFile(*openAPIOut, append(data, '\n'), 0o644); err != nil {
+			log.Fatal("Writing the OpenAPI document failed: ", err)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-	}).Methods("GET")
-
-	logoutRouter := router.PathPrefix("/").Subrouter()
-	logoutRouter.Handle("/logout", authMiddleware.BasicAuth(http.HandlerFunc(logoutHandler.BasicAuthLogout))).Methods("POST", "GET")
-	logoutRouter.Handle("/api/auth/logout-basic", authMiddleware.BasicAuth(http.HandlerFunc(logoutHandler.BasicAuthLogout))).Methods("POST", "GET")
-	logoutRouter.Handle("/api/logout/soft", authMiddleware.BasicAuth(http.HandlerFunc(logoutHandler.SoftLogout))).Methods("POST", "GET")
-	logoutRouter.Handle("/api/logout/force", authMiddleware.BasicAuth(http.HandlerFunc(logoutHandler.ForceLogout))).Methods("POST", "GET")
-	logoutRouter.Handle("/api/logout/redirect", authMiddleware.BasicAuth(http.HandlerFunc(logoutHandler.LogoutWithRedirect))).Methods("POST", "GET")
-	logoutRouter.HandleFunc("/api/logout/status", logoutHandler.LogoutStatus).Methods("GET")
-	logoutRouter.Handle("/api/auth/clear", authMiddleware.BasicAuth(http.HandlerFunc(authHandler.ClearAuth))).Methods("POST", "GET")
-
-	// Development mode - check environment variable
-	devMode := os.Getenv("DEV_MODE") == "true"
-	if devMode {
-		slog.Info("Development mode enabled - 2FA requirement bypassed")
-	}
-
-	// Protected routes with improved authentication (supports both basic auth and 2FA sessions)
-	protectedRouter := router.PathPrefix("/api").Subrouter()
-	protectedRouter.Use(authMiddleware.WebappBasicAuth)
-
-	// Patient endpoints
-	protectedRouter.HandleFunc("/patients", patientHandler.CreatePatient).Methods("POST")
-	protectedRouter.HandleFunc("/patients/{id}", patientHandler.GetPatient).Methods("GET")
-	protectedRouter.HandleFunc("/patients", patientHandler.GetAllPatients).Methods("GET")
-	protectedRouter.HandleFunc("/patients/{id}", patientHandler.UpdatePatient).Methods("PUT")
-	protectedRouter.HandleFunc("/patients/{id}", patientHandler.DeletePatient).Methods("DELETE")
-
-	// User endpoints
-	protectedRouter.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
-	protectedRouter.HandleFunc("/users", userHandler.GetUsers).Methods("GET")
-	protectedRouter.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET")
-
-	// Medical Record endpoints
-	protectedRouter.HandleFunc("/medical-records", medicalRecordHandler.CreateMedicalRecord).Methods("POST")
-	protectedRouter.HandleFunc("/medical-records", medicalRecordHandler.GetMedicalRecords).Methods("GET")
-	protectedRouter.HandleFunc("/medical-records/{id}", medicalRecordHandler.GetMedicalRecord).Methods("GET")
-	protectedRouter.HandleFunc("/patients/{patientId}/medical-records", medicalRecordHandler.GetMedicalRecordsByPatient).Methods("GET")
-
-	// Prescription endpoints
-	protectedRouter.HandleFunc("/prescriptions", prescriptionHandler.CreatePrescription).Methods("POST")
-	protectedRouter.HandleFunc("/prescriptions", prescriptionHandler.GetPrescriptions).Methods("GET")
-	protectedRouter.HandleFunc("/prescriptions/{id}", prescriptionHandler.GetPrescription).Methods("GET")
-	protectedRouter.HandleFunc("/patients/{patientId}/prescriptions", prescriptionHandler.GetPrescriptionsByPatient).Methods("GET")
-
-	// Two Factor Authentication endpoints (protected routes)
-	twoFARouter := protectedRouter.PathPrefix("/2fa").Subrouter()
-	twoFARouter.HandleFunc("/setup", twoFAHandler.GenerateTwoFASetup).Methods("GET")
-	twoFARouter.HandleFunc("/enable", twoFAHandler.EnableTwoFA).Methods("POST")
-	twoFARouter.HandleFunc("/disable", twoFAHandler.DisableTwoFA).Methods("POST")
-	twoFARouter.HandleFunc("/status", twoFAHandler.GetTwoFAStatus).Methods("GET")
-	twoFARouter.HandleFunc("/verify", twoFAHandler.VerifyTwoFACode).Methods("POST")
-	twoFARouter.HandleFunc("/debug/time", twoFAHandler.GetServerTime).Methods("GET")
-	twoFARouter.HandleFunc("/debug/generate", twoFAHandler.GenerateCurrentTOTP).Methods("POST")
-
-	// Admin-only session management endpoints
-	adminRouter := protectedRouter.PathPrefix("/admin").Subrouter()
-	adminRouter.HandleFunc("/sessions/clear-all", improvedAuthMiddleware.ClearAllSessionsEndpoint()).Methods("POST")
-
-	// Check if SSL certificates exist, generate if not
-	certPath := "certs/server.crt"
-	keyPath := "certs/server.key"
-
-	if _, err := os.Stat(certPath); os.IsNotExist(err) {
-		if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-			slog.Info("SSL certificates not found, generating self-signed certificates...")
-			if err := generateSelfSignedCert(); err != nil {
+		slog.Info("OpenAPI document written", "path", *openAPIOut)
+		return
+	}
+
+	// Queued notifications, appointment reminders, scheduled reports and
+	// backups run in the background while serving
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	if err := app.start(workers); err != nil {
+		log.Fatal(err)
+	}
+
+	// Without ACME, development servers generate a self-signed certificate
+	// when there is none; production ones must be given theirs
+	certPath, keyPath := cfg.TLS.CertFile, cfg.TLS.KeyFile
+	if len(cfg.TLS.ACMEHosts) == 0 {
+		_, certErr := os.Stat(certPath)
+		_, keyErr := os.Stat(keyPath)
+		switch {
+		case os.IsNotExist(certErr) != os.IsNotExist(keyErr):
+			log.Fatalf("Only one of TLS_CERT_FILE (%s) and TLS_KEY_FILE (%s) exists", certPath, keyPath)
+		case !os.IsNotExist(certErr):
+		case cfg.Security.Profile == "prod":
+			log.Fatalf("No TLS certificate at %s: set TLS_CERT_FILE and TLS_KEY_FILE, or ACME_HOSTS, for APP_ENV=prod", certPath)
+		default:
+			slog.Warn("SSL certificates not found, generating a self-signed certificate for development", "cert", certPath, "key", keyPath)
+			if err := generateSelfSignedCert(certPath, keyPath); err != nil {
 				log.Fatal("Failed to generate SSL certificates:", err)
 			}
 		}
 	}
-
-	// CORS configuration with proper headers for 2FA
-	corsHandler := gorillaHandlers.CORS(
-		gorillaHandlers.AllowedOrigins([]string{
-			"http://localhost:5173",
-			"https://localhost:5173",
-			"http://localhost:3000",
-			"https://localhost:3000",
-		}),
-		gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		gorillaHandlers.AllowedHeaders([]string{
-			"Content-Type",
-			"Authorization",
-			"X-2FA-Session-ID",
-			"X-2FA-Code",
-			"X-New-2FA-Session-ID",
-		}),
-		gorillaHandlers.ExposedHeaders([]string{
-			"X-New-2FA-Session-ID",
-			"WWW-Authenticate",
-		}),
-		gorillaHandlers.AllowCredentials(),
-	)(router)
+	tlsManager, err := server.NewTLSManager(cfg.TLS)
+	if err != nil {
+		log.Fatal("Invalid TLS settings: ", err)
+	}
+	if cfg.MTLSAddr != "" && !tlsManager.MutualTLS() {
+		log.Fatal("MTLS_CLIENT_CA_FILE must be set for MTLS_ADDR")
+	}
+	// Certificates rotated on disk are picked up on SIGHUP
+	go tlsManager.ReloadOnSIGHUP(workers)
 
 	// TLS configuration
 	tlsConfig := &tls.Config{
 		MinVersion: tls.VersionTLS12,
+		// ECDSA suites are for the certificates ACME issues
 		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
 			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
 			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
 			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
 		},
 	}
 
-	server := &http.Server{
-		Addr:         ":8443",
-		Handler:      corsHandler,
-		TLSConfig:    tlsConfig,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	newServer := func(handler http.Handler) *http.Server {
+		srv := &http.Server{
+			Handler:      handler,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		// Shutdown waits for handlers, so end the open change streams
+		srv.RegisterOnShutdown(services.Changes.Close)
+		return srv
 	}
 
-	// Start HTTP redirect server
-	go func() {
-		redirectHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			target := "https://" + r.Host + r.URL.Path
-			if len(r.URL.RawQuery) > 0 {
-				target += "?" + r.URL.RawQuery
-			}
-			http.Redirect(w, r, target, http.StatusPermanentRedirect)
-		})
+	servers := server.NewManager(cfg.ShutdownTimeout)
+
+	httpsServer := newServer(app.handler)
+	httpsServer.TLSConfig = tlsManager.Config(tlsConfig)
+	servers.Add(server.Listener{Name: "https", Network: "tcp", Address: cfg.HTTPSAddr, Server: httpsServer, TLS: true})
 
-		slog.Info("HTTP redirect server started on port 8080")
-		log.Fatal(http.ListenAndServe(":8080", redirectHandler))
-	}()
+	// Internal integrations authenticate the connection with a client certificate
+	if cfg.MTLSAddr != "" {
+		mtlsServer := newServer(app.handler)
+		mtlsServer.TLSConfig = tlsManager.ClientAuthConfig(tlsConfig)
+		servers.Add(server.Listener{Name: "mtls", Network: "tcp", Address: cfg.MTLSAddr, Server: mtlsServer, TLS: true})
+	}
+
+	// The redirect listener also answers ACME HTTP-01 challenges
+	if cfg.RedirectAddr != "" {
+		redirect := tlsManager.HTTPHandler(server.RedirectToHTTPS(cfg.HTTPSAddr))
+		servers.Add(server.Listener{Name: "http-redirect", Network: "tcp", Address: cfg.RedirectAddr, Server: newServer(redirect)})
+	}
+	// Plaintext listeners for a reverse proxy that terminates TLS in front of the app
+	if cfg.InternalAddr != "" {
+		servers.Add(server.Listener{Name: "internal", Network: "tcp", Address: cfg.InternalAddr, Server: newServer(app.handler)})
+	}
+	if cfg.UnixSocket != "" {
+		servers.Add(server.Listener{Name: "unix", Network: "unix", Address: cfg.UnixSocket, Server: newServer(app.handler)})
+	}
 
-	slog.Info("HTTPS server started on port 8443")
 	slog.Info("Available endpoints:")
-	slog.Info("  Health check: GET /health")
+	slog.Info("  Health check: GET /health, /health/live, /health/ready")
 	slog.Info("  2FA Auth: POST /api/auth/2fa/initiate")
 	slog.Info("  2FA Verify: POST /api/auth/2fa/verify")
 	slog.Info("  2FA Logout: POST /api/auth/2fa/logout")
+	slog.Info("  WebAuthn: POST /api/auth/webauthn/{register,login}/{begin,finish}")
+	slog.Info("  API docs: GET /api/docs (OpenAPI at /api/openapi.json)")
 	slog.Info("  Protected API: /api/* (requires authentication)")
 	slog.Info("  Admin endpoints: /api/admin/* (requires admin role)")
 
-	log.Fatal(server.ListenAndServeTLS(certPath, keyPath))
+	err = servers.Run(context.Background())
+	// Send the spans still waiting to be exported
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	tracing.Shutdown(flushCtx)
+	cancel()
+	if err != nil {
+		slog.Error("Server stopped with error", "error", err)
+		database.GetDB().Close()
+		os.Exit(1)
+	}
 }
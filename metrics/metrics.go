@@ -0,0 +1,142 @@
+// Package metrics holds the Prometheus metrics served at /metrics: HTTP
+// requests by route and status, database statement durations, active
+// sessions, failed logins and 2FA verifications.
+//
+// The collectors are registered on a registry of their own rather than the
+// client library's global one, so only the metrics listed here (plus the Go
+// runtime and process collectors) are exposed.
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Second factors counted by TwoFAVerification
+const (
+	// FACTOR_CODE is a TOTP or backup code
+	FACTOR_CODE     = "code"
+	FACTOR_WEBAUTHN = "webauthn"
+)
+
+// Results of a 2FA verification
+const (
+	RESULT_SUCCESS = "success"
+	RESULT_FAILURE = "failure"
+)
+
+// unmatchedRoute labels requests that matched no route, so scanners probing
+// random paths can't create a series per path
+const unmatchedRoute = "unmatched"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hospital_http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hospital_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hospital_db_query_duration_seconds",
+		Help:    "Database statement duration by operation (query or exec); queries are timed until their rows are closed.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation"})
+
+	failedLogins = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hospital_failed_logins_total",
+		Help: "Logins refused for an unknown username or a wrong password.",
+	})
+
+	twoFAVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hospital_2fa_verifications_total",
+		Help: "Second-factor verifications by factor (code or webauthn) and result.",
+	}, []string{"factor", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		dbDuration,
+		failedLogins,
+		twoFAVerifications,
+	)
+}
+
+// RegisterActiveSessions reports count as the number of live sessions each
+// time the metrics are scraped
+func RegisterActiveSessions(count func() int) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "hospital_active_sessions",
+		Help: "Live login sessions, including those waiting for a second factor.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// ObserveQuery records how long a database statement took
+func ObserveQuery(operation string, duration time.Duration) {
+	dbDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// FailedLogin counts a refused username and password
+func FailedLogin() {
+	failedLogins.Inc()
+}
+
+// TwoFAVerification counts a second-factor verification
+func TwoFAVerification(factor string, valid bool) {
+	result := RESULT_FAILURE
+	if valid {
+		result = RESULT_SUCCESS
+	}
+	twoFAVerifications.WithLabelValues(factor, result).Inc()
+}
+
+// Instrument wraps the router, counting and timing every request by the
+// template of the route it matched (e.g. /api/patients/{id}) so IDs in
+// paths don't each become a series
+func Instrument(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if template, err := match.Route.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		captured := httpsnoop.CaptureMetrics(router, w, r)
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(captured.Code)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(captured.Duration.Seconds())
+	})
+}
+
+// Handler serves the metrics in the Prometheus text format. When token is
+// set, scrapers must send it as a bearer token.
+func Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Invalid metrics token", http.StatusUnauthorized)
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
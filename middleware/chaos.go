@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// ChaosRule injects faults into requests whose path starts with PathPrefix
+// (and, if set, whose method is in Methods). Rates are probabilities in [0, 1].
+type ChaosRule struct {
+	ID              int      `json:"id"`
+	PathPrefix      string   `json:"pathPrefix"`
+	Methods         []string `json:"methods,omitempty"`
+	LatencyMs       int      `json:"latencyMs"`
+	LatencyJitterMs int      `json:"latencyJitterMs"`
+	ErrorRate       float64  `json:"errorRate"`
+	ErrorStatus     int      `json:"errorStatus"`
+	DropRate        float64  `json:"dropRate"`
+}
+
+// Validate checks that the rule is usable and fills in defaults
+func (rule *ChaosRule) Validate() error {
+	if !strings.HasPrefix(rule.PathPrefix, "/") {
+		return fmt.Errorf("pathPrefix must start with /")
+	}
+	if rule.LatencyMs < 0 || rule.LatencyJitterMs < 0 {
+		return fmt.Errorf("latency must not be negative")
+	}
+	if rule.ErrorRate < 0 || rule.ErrorRate > 1 || rule.DropRate < 0 || rule.DropRate > 1 {
+		return fmt.Errorf("errorRate and dropRate must be between 0 and 1")
+	}
+	if rule.ErrorStatus == 0 {
+		rule.ErrorStatus = http.StatusServiceUnavailable
+	}
+	if rule.ErrorStatus < 500 || rule.ErrorStatus > 599 {
+		return fmt.Errorf("errorStatus must be a 5xx status")
+	}
+	for i, method := range rule.Methods {
+		rule.Methods[i] = strings.ToUpper(method)
+	}
+	return nil
+}
+
+func (rule *ChaosRule) matches(r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+		return false
+	}
+	return len(rule.Methods) == 0 || slices.Contains(rule.Methods, r.Method)
+}
+
+// Chaos holds the fault-injection rules configured through the admin
+// endpoint. It is only installed in DEV_MODE.
+type Chaos struct {
+	rules  []ChaosRule
+	nextID int
+	// exempt paths are never disturbed so the rules can always be removed
+	exempt string
+	mutex  sync.RWMutex
+}
+
+func NewChaos(exemptPrefix string) *Chaos {
+	return &Chaos{nextID: 1, exempt: exemptPrefix}
+}
+
+// Rules returns a copy of the active rules
+func (c *Chaos) Rules() []ChaosRule {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return slices.Clone(c.rules)
+}
+
+// AddRule validates and activates a rule, returning it with its ID set
+func (c *Chaos) AddRule(rule ChaosRule) (ChaosRule, error) {
+	if err := rule.Validate(); err != nil {
+		return rule, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	rule.ID = c.nextID
+	c.nextID++
+	c.rules = append(c.rules, rule)
+	return rule, nil
+}
+
+// RemoveRule deactivates a rule, reporting whether it existed
+func (c *Chaos) RemoveRule(id int) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, rule := range c.rules {
+		if rule.ID == id {
+			c.rules = slices.Delete(c.rules, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear removes every rule
+func (c *Chaos) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rules = nil
+}
+
+func (c *Chaos) match(r *http.Request) (ChaosRule, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	for _, rule := range c.rules {
+		if rule.matches(r) {
+			return rule, true
+		}
+	}
+	return ChaosRule{}, false
+}
+
+// Middleware applies the first matching rule: latency first, then either a
+// dropped connection or an injected 5xx response
+func (c *Chaos) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.exempt != "" && strings.HasPrefix(r.URL.Path, c.exempt) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule, ok := c.match(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		delay := time.Duration(rule.LatencyMs) * time.Millisecond
+		if rule.LatencyJitterMs > 0 {
+			delay += time.Duration(rand.IntN(rule.LatencyJitterMs+1)) * time.Millisecond
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if rule.DropRate > 0 && rand.Float64() < rule.DropRate {
+			log.Printf("Chaos: dropping connection for %s %s (rule %d)", r.Method, r.URL.Path, rule.ID)
+			// net/http closes the connection (or resets the HTTP/2 stream) without logging
+			panic(http.ErrAbortHandler)
+		}
+
+		if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+			log.Printf("Chaos: injecting %d for %s %s (rule %d)", rule.ErrorStatus, r.Method, r.URL.Path, rule.ID)
+			response.WriteError(w, rule.ErrorStatus, "Injected fault")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+const (
+	// ConsistencyTokenHeader is returned on successful writes; clients echo it
+	// in ReadAfterHeader so their next reads see the write
+	ConsistencyTokenHeader = "X-Consistency-Token"
+	ReadAfterHeader        = "X-Read-After"
+)
+
+// ReadYourWrites routes a client's reads to the primary database for a short
+// window after it writes, so a replica lagging behind can't serve it stale
+// data. Recent writers are recognised by their user (the session flag) or by
+// the consistency token header for clients sharing an account.
+type ReadYourWrites struct {
+	window     time.Duration
+	lastWrites map[int]time.Time
+	mutex      sync.Mutex
+}
+
+// NewReadYourWrites uses READ_YOUR_WRITES_WINDOW (a duration, default 5s)
+// as the upper bound on replica lag
+func NewReadYourWrites() *ReadYourWrites {
+	window := 5 * time.Second
+	if value := os.Getenv("READ_YOUR_WRITES_WINDOW"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Invalid READ_YOUR_WRITES_WINDOW %q, using %s", value, window)
+		} else {
+			window = parsed
+		}
+	}
+
+	return &ReadYourWrites{
+		window:     window,
+		lastWrites: make(map[int]time.Time),
+	}
+}
+
+// Middleware must run after authentication so the user is known
+func (c *ReadYourWrites) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := GetUserFromContext(r)
+
+		if c.requiresPrimary(r, user) {
+			r = r.WithContext(database.WithPrimaryReads(r.Context()))
+		}
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Issue the token before the handler writes the response headers
+		now := time.Now()
+		w.Header().Set(ConsistencyTokenHeader, strconv.FormatInt(now.UnixMilli(), 10))
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if user != nil && recorder.status < 400 {
+			c.mutex.Lock()
+			c.lastWrites[user.UserID] = now
+			c.mutex.Unlock()
+		}
+	})
+}
+
+func (c *ReadYourWrites) requiresPrimary(r *http.Request, user *models.User) bool {
+	cutoff := time.Now().Add(-c.window)
+
+	if token := r.Header.Get(ReadAfterHeader); token != "" {
+		if millis, err := strconv.ParseInt(token, 10, 64); err == nil && time.UnixMilli(millis).After(cutoff) {
+			return true
+		}
+	}
+
+	if user == nil {
+		return false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	lastWrite, exists := c.lastWrites[user.UserID]
+	if exists && !lastWrite.After(cutoff) {
+		delete(c.lastWrites, user.UserID)
+		return false
+	}
+	return exists
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
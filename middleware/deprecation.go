@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Deprecation describes a legacy route that still works but is scheduled for
+// removal. Usage counts requests since startup so we can tell when it is safe
+// to delete the route.
+type Deprecation struct {
+	Path         string     `json:"path"`
+	Replacement  string     `json:"replacement,omitempty"`
+	Reason       string     `json:"reason"`
+	DeprecatedAt time.Time  `json:"deprecatedAt"`
+	Sunset       time.Time  `json:"sunset"`
+	Usage        int64      `json:"usage"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// Deprecations is the registry of deprecated routes, keyed by mux path template
+type Deprecations struct {
+	entries map[string]*Deprecation
+	mutex   sync.RWMutex
+}
+
+func NewDeprecations() *Deprecations {
+	return &Deprecations{entries: make(map[string]*Deprecation)}
+}
+
+// Register marks the route with this path template as deprecated
+func (d *Deprecations) Register(entry Deprecation) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	entry.Usage = 0
+	entry.LastUsedAt = nil
+	d.entries[entry.Path] = &entry
+}
+
+// List returns the deprecated routes sorted by sunset date, soonest first
+func (d *Deprecations) List() []Deprecation {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	list := make([]Deprecation, 0, len(d.entries))
+	for _, entry := range d.entries {
+		list = append(list, *entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Sunset.Equal(list[j].Sunset) {
+			return list[i].Sunset.Before(list[j].Sunset)
+		}
+		return list[i].Path < list[j].Path
+	})
+	return list
+}
+
+// Middleware adds the Deprecation (RFC 9745), Sunset (RFC 8594) and
+// successor Link headers to requests matching a deprecated route and counts
+// the usage. It must be installed with Router.Use so the route is known.
+func (d *Deprecations) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		d.mutex.Lock()
+		entry, exists := d.entries[path]
+		if exists {
+			now := time.Now()
+			entry.Usage++
+			entry.LastUsedAt = &now
+		}
+		d.mutex.Unlock()
+
+		if exists {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", entry.DeprecatedAt.Unix()))
+			w.Header().Set("Sunset", entry.Sunset.UTC().Format(http.TimeFormat))
+			if entry.Replacement != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, entry.Replacement))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// PatientScope confines Patient accounts to their own patient's chart on the
+// routes they share with staff. Each rule names a route by method and mux
+// path template and says how a patient's request to it is narrowed to their
+// patient; any route without a rule is refused. Staff requests pass through
+// untouched.
+type PatientScope struct {
+	rules map[string]patientRule
+}
+
+// patientRule serves a patient's request for patientID or refuses it
+type patientRule func(w http.ResponseWriter, r *http.Request, patientID int, next http.Handler)
+
+func NewPatientScope() *PatientScope {
+	return &PatientScope{rules: make(map[string]patientRule)}
+}
+
+// Allow lets patients use the route as it is, e.g. their own account
+func (s *PatientScope) Allow(method, path string) {
+	s.rules[method+" "+path] = func(w http.ResponseWriter, r *http.Request, patientID int, next http.Handler) {
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Own lets patients use the route when its path variable is their patient ID
+func (s *PatientScope) Own(method, path, variable string) {
+	s.rules[method+" "+path] = func(w http.ResponseWriter, r *http.Request, patientID int, next http.Handler) {
+		if mux.Vars(r)[variable] != strconv.Itoa(patientID) {
+			response.WriteError(w, http.StatusForbidden, "Patients may only access their own records")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Owned lets patients use the route when owner says the entity named by its
+// {id} path variable belongs to their patient
+func (s *PatientScope) Owned(method, path string, owner func(ctx context.Context, id int) (int, error)) {
+	s.rules[method+" "+path] = func(w http.ResponseWriter, r *http.Request, patientID int, next http.Handler) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			response.WriteError(w, http.StatusBadRequest, "Invalid ID")
+			return
+		}
+		owningPatient, err := owner(r.Context(), id)
+		if err != nil {
+			response.WriteServiceError(w, err, "Not found")
+			return
+		}
+		if owningPatient != patientID {
+			response.WriteError(w, http.StatusForbidden, "Patients may only access their own records")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Filter lets patients use a listing route with its query parameter forced
+// to their patient ID, whatever they asked for
+func (s *PatientScope) Filter(method, path, param string) {
+	s.rules[method+" "+path] = func(w http.ResponseWriter, r *http.Request, patientID int, next http.Handler) {
+		query := r.URL.Query()
+		query.Set(param, strconv.Itoa(patientID))
+		r.URL.RawQuery = query.Encode()
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Rewrite serves patients handler in place of the route, with its path
+// variable set to their patient ID; for listings whose per-patient variant
+// is a different route
+func (s *PatientScope) Rewrite(method, path string, handler http.Handler, variable string) {
+	s.rules[method+" "+path] = func(w http.ResponseWriter, r *http.Request, patientID int, next http.Handler) {
+		handler.ServeHTTP(w, mux.SetURLVars(r, map[string]string{variable: strconv.Itoa(patientID)}))
+	}
+}
+
+// Middleware applies the rule for the matched route to Patient accounts. It
+// must be installed with Router.Use after authentication so the route and
+// user are known.
+func (s *PatientScope) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := GetUserFromContext(r)
+		if !ok || user.Role != models.ROLE_PATIENT {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user.PatientID == nil {
+			response.WriteError(w, http.StatusForbidden, "Account is not linked to a patient")
+			return
+		}
+
+		var rule patientRule
+		if route := mux.CurrentRoute(r); route != nil {
+			if path, err := route.GetPathTemplate(); err == nil {
+				rule = s.rules[r.Method+" "+path]
+			}
+		}
+		if rule == nil {
+			response.WriteError(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		rule(w, r, *user.PatientID, next)
+	})
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// QueryTimeout bounds each request's context, and so every database call
+// made with it, to timeout. Queries still running when it expires are
+// cancelled and the handler gets a context error. A zero timeout disables it.
+// Server-sent event streams, which stay open, are left unbounded, and a
+// streamed download can set it aside with WithoutQueryTimeout.
+func QueryTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.WithValue(r.Context(), untimedContextKey{}, r.Context()), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// untimedContextKey holds the request's context from before QueryTimeout
+type untimedContextKey struct{}
+
+// WithoutQueryTimeout returns the request's context, with every value set on
+// it, free of QueryTimeout's deadline but still cancelled when the client
+// goes away. Callers bound the work some other way and call cancel when done.
+func WithoutQueryTimeout(r *http.Request) (context.Context, context.CancelFunc) {
+	untimed, ok := r.Context().Value(untimedContextKey{}).(context.Context)
+	if !ok {
+		untimed = r.Context()
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	stop := context.AfterFunc(untimed, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
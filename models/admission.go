@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+const (
+	ADMISSION_STATUS_ADMITTED   = "admitted"
+	ADMISSION_STATUS_DISCHARGED = "discharged"
+)
+
+// Ward groups beds, e.g. "Maternity" or "ICU"
+type Ward struct {
+	WardID      int    `json:"id"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	Beds        []Bed  `json:"beds,omitempty"`
+}
+
+// Bed is a bed in a ward. AdmissionID and PatientID are set while it is
+// occupied, and Housekeeping while it is waiting to be cleaned.
+type Bed struct {
+	BedID        int    `json:"id"`
+	WardID       int    `json:"wardId"`
+	Label        string `json:"label" validate:"required,max=50"`
+	OutOfService bool   `json:"outOfService"`
+	AdmissionID  *int   `json:"admissionId,omitempty"`
+	PatientID    *int   `json:"patientId,omitempty"`
+	Housekeeping string `json:"housekeeping,omitempty"`
+}
+
+// Admission is an inpatient stay. BedID is the current bed; earlier beds are in Transfers.
+type Admission struct {
+	AdmissionID      int           `json:"id"`
+	PatientID        int           `json:"patientId" validate:"required,gt=0"`
+	BedID            int           `json:"bedId" validate:"required,gt=0"`
+	AdmittedBy       int           `json:"admittedBy"`
+	Reason           string        `json:"reason" validate:"required,max=2000"`
+	Status           string        `json:"status"`
+	AdmittedAt       time.Time     `json:"admittedAt"`
+	DischargedAt     *time.Time    `json:"dischargedAt,omitempty"`
+	DischargedBy     *int          `json:"dischargedBy,omitempty"`
+	DischargeSummary string        `json:"dischargeSummary,omitempty"`
+	Transfers        []BedTransfer `json:"transfers,omitempty"`
+}
+
+// BedTransfer records a move between beds during an admission
+type BedTransfer struct {
+	TransferID    int       `json:"id"`
+	AdmissionID   int       `json:"admissionId"`
+	FromBedID     int       `json:"fromBedId"`
+	ToBedID       int       `json:"toBedId"`
+	TransferredBy int       `json:"transferredBy"`
+	Reason        string    `json:"reason"`
+	TransferredAt time.Time `json:"transferredAt"`
+}
+
+// WardOccupancy is a point-in-time count of a ward's beds
+type WardOccupancy struct {
+	WardID        int     `json:"wardId"`
+	WardName      string  `json:"wardName"`
+	TotalBeds     int     `json:"totalBeds"`
+	Occupied      int     `json:"occupied"`
+	Available     int     `json:"available"`
+	Cleaning      int     `json:"cleaning"`
+	OutOfService  int     `json:"outOfService"`
+	OccupancyRate float64 `json:"occupancyRate"`
+}
+
+// Occupancy is the hospital-wide occupancy report
+type Occupancy struct {
+	Wards         []WardOccupancy `json:"wards"`
+	TotalBeds     int             `json:"totalBeds"`
+	Occupied      int             `json:"occupied"`
+	Available     int             `json:"available"`
+	Cleaning      int             `json:"cleaning"`
+	OutOfService  int             `json:"outOfService"`
+	OccupancyRate float64         `json:"occupancyRate"`
+	GeneratedAt   time.Time       `json:"generatedAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Allergy severities; an allergy migrated from free text or recorded without
+// one has no severity
+const (
+	ALLERGY_SEVERITY_MILD     = "mild"
+	ALLERGY_SEVERITY_MODERATE = "moderate"
+	ALLERGY_SEVERITY_SEVERE   = "severe"
+)
+
+// Allergy is a substance a patient reacts to. An inactive allergy (refuted
+// or outgrown) is kept for the record but left out of the patient's
+// allergies summary and the prescription checks.
+type Allergy struct {
+	AllergyID int    `json:"id"`
+	PatientID int    `json:"patientId"`
+	Substance string `json:"substance" validate:"required,max=200"`
+	Reaction  string `json:"reaction,omitempty" validate:"max=500"`
+	Severity  string `json:"severity,omitempty" validate:"omitempty,oneof=mild moderate severe"`
+	OnsetDate string `json:"onsetDate,omitempty" validate:"omitempty,pastdate"`
+	Active    bool   `json:"active"`
+	// RecordedBy is unset for allergies migrated from the free-text field
+	RecordedBy *int       `json:"recordedBy,omitempty"`
+	RecordedAt time.Time  `json:"recordedAt"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+const (
+	APPOINTMENT_STATUS_SCHEDULED = "scheduled"
+	APPOINTMENT_STATUS_CANCELLED = "cancelled"
+	APPOINTMENT_STATUS_COMPLETED = "completed"
+)
+
+// Appointment is a booked consultation with a doctor. Bookings without a
+// doctor are assigned the suggested doctor and carry the suggestion in
+// Assignment so reception can see why and rebook with someone else.
+// Patients who need an interpreter get one booked with the appointment.
+type Appointment struct {
+	AppointmentID int                   `json:"id"`
+	PatientID     int                   `json:"patientId" validate:"required,gt=0"`
+	DoctorID      int                   `json:"doctorId" validate:"omitempty,gt=0"`
+	DoctorName    string                `json:"doctorName,omitempty"`
+	Specialty     string                `json:"specialty,omitempty" validate:"max=100"`
+	StartsAt      time.Time             `json:"startsAt" validate:"required"`
+	EndsAt        time.Time             `json:"endsAt" validate:"required,gtfield=StartsAt"`
+	Reason        string                `json:"reason" validate:"max=2000"`
+	Status        string                `json:"status"`
+	BookedBy      int                   `json:"bookedBy"`
+	CreatedAt     time.Time             `json:"createdAt"`
+	Assignment    *AssignmentSuggestion `json:"assignment,omitempty"`
+	Interpreter   *InterpreterBooking   `json:"interpreter,omitempty"`
+}
+
+// UnmarshalJSON accepts startsAt and endsAt as RFC 3339 times or as
+// facility-local wall times
+func (a *Appointment) UnmarshalJSON(data []byte) error {
+	type plain Appointment
+	body := struct {
+		*plain
+		StartsAt timezone.Time `json:"startsAt"`
+		EndsAt   timezone.Time `json:"endsAt"`
+	}{plain: (*plain)(a)}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	a.StartsAt, a.EndsAt = body.StartsAt.Time, body.EndsAt.Time
+	return nil
+}
+
+// DutyShift is a period a doctor is rostered on duty
+type DutyShift struct {
+	ShiftID    int       `json:"id"`
+	DoctorID   int       `json:"doctorId" validate:"required,gt=0"`
+	DoctorName string    `json:"doctorName,omitempty"`
+	StartsAt   time.Time `json:"startsAt" validate:"required"`
+	EndsAt     time.Time `json:"endsAt" validate:"required,gtfield=StartsAt"`
+	CreatedBy  int       `json:"createdBy"`
+}
+
+// UnmarshalJSON accepts startsAt and endsAt as RFC 3339 times or as
+// facility-local wall times
+func (d *DutyShift) UnmarshalJSON(data []byte) error {
+	type plain DutyShift
+	body := struct {
+		*plain
+		StartsAt timezone.Time `json:"startsAt"`
+		EndsAt   timezone.Time `json:"endsAt"`
+	}{plain: (*plain)(d)}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	d.StartsAt, d.EndsAt = body.StartsAt.Time, body.EndsAt.Time
+	return nil
+}
+
+// TimeOff is a period a doctor is away, e.g. on leave. Appointments can't
+// be booked with them during it, even inside a shift.
+type TimeOff struct {
+	TimeOffID  int       `json:"id"`
+	DoctorID   int       `json:"doctorId" validate:"required,gt=0"`
+	DoctorName string    `json:"doctorName,omitempty"`
+	StartsAt   time.Time `json:"startsAt" validate:"required"`
+	EndsAt     time.Time `json:"endsAt" validate:"required,gtfield=StartsAt"`
+	Reason     string    `json:"reason" validate:"max=500"`
+	CreatedBy  int       `json:"createdBy"`
+}
+
+// UnmarshalJSON accepts startsAt and endsAt as RFC 3339 times or as
+// facility-local wall times
+func (t *TimeOff) UnmarshalJSON(data []byte) error {
+	type plain TimeOff
+	body := struct {
+		*plain
+		StartsAt timezone.Time `json:"startsAt"`
+		EndsAt   timezone.Time `json:"endsAt"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	t.StartsAt, t.EndsAt = body.StartsAt.Time, body.EndsAt.Time
+	return nil
+}
+
+// Slot is an open period a doctor can be booked for
+type Slot struct {
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+}
+
+// Availability lists a doctor's open slots between From and To: the parts
+// of their shifts not taken by time off or scheduled appointments, cut into
+// SlotMinutes-long slots from the start of each shift
+type Availability struct {
+	DoctorID    int       `json:"doctorId"`
+	DoctorName  string    `json:"doctorName"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	SlotMinutes int       `json:"slotMinutes"`
+	Slots       []Slot    `json:"slots"`
+}
+
+// Doctor is a doctor with the specialties used to match bookings
+type Doctor struct {
+	DoctorID    int      `json:"id"`
+	FullName    string   `json:"fullName"`
+	Specialties []string `json:"specialties"`
+}
+
+// AssignmentCandidate explains how one doctor was considered for a booking.
+// Load is the share of the covering shift already booked, counting the new
+// appointment's time as free.
+type AssignmentCandidate struct {
+	DoctorID      int        `json:"doctorId"`
+	DoctorName    string     `json:"doctorName"`
+	Eligible      bool       `json:"eligible"`
+	Reasons       []string   `json:"reasons,omitempty"`
+	ShiftStartsAt *time.Time `json:"shiftStartsAt,omitempty"`
+	ShiftEndsAt   *time.Time `json:"shiftEndsAt,omitempty"`
+	BookedInShift int        `json:"bookedInShift"`
+	BookedMinutes int        `json:"bookedMinutes"`
+	Load          float64    `json:"load"`
+}
+
+// AssignmentSuggestion is the least-loaded eligible doctor for a slot, with
+// every doctor considered. Doctor is nil when nobody is eligible.
+type AssignmentSuggestion struct {
+	Doctor      *AssignmentCandidate  `json:"doctor"`
+	Explanation string                `json:"explanation"`
+	Specialty   string                `json:"specialty,omitempty"`
+	StartsAt    time.Time             `json:"startsAt"`
+	EndsAt      time.Time             `json:"endsAt"`
+	Candidates  []AssignmentCandidate `json:"candidates"`
+}
+
+// ReminderPreferences says which appointment reminders a patient is texted.
+// Patients without saved preferences get both.
+type ReminderPreferences struct {
+	PatientID int `json:"patientId"`
+	// DayBefore is the reminder 24 hours before an appointment
+	DayBefore bool `json:"dayBefore"`
+	// HourBefore is the reminder an hour before an appointment
+	HourBefore bool       `json:"hourBefore"`
+	UpdatedBy  *int       `json:"updatedBy,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
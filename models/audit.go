@@ -0,0 +1,112 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AUDIT_PRESCRIPTION_OVERRIDE       = "prescription_warning_override"
+	AUDIT_PRESCRIPTION_SIGNED         = "prescription_signed"
+	AUDIT_PREAUTH_SUBMITTED           = "preauth_submitted"
+	AUDIT_PREAUTH_DECISION            = "preauth_decision"
+	AUDIT_CLAIM_SUBMITTED             = "claim_submitted"
+	AUDIT_DOCUMENT_UPLOADED           = "document_uploaded"
+	AUDIT_DOCUMENT_DELETED            = "document_deleted"
+	AUDIT_PATIENT_IMAGE_SAVED         = "patient_image_saved"
+	AUDIT_PATIENT_IMAGE_DELETED       = "patient_image_deleted"
+	AUDIT_PATIENT_FLAG_ADDED          = "patient_flag_added"
+	AUDIT_PATIENT_FLAG_REMOVED        = "patient_flag_removed"
+	AUDIT_FLAG_TYPE_SAVED             = "flag_type_saved"
+	AUDIT_DEPARTMENT_SAVED            = "department_saved"
+	AUDIT_RECORD_TEMPLATE_SAVED       = "record_template_saved"
+	AUDIT_ALLERGY_ADDED               = "allergy_added"
+	AUDIT_ALLERGY_UPDATED             = "allergy_updated"
+	AUDIT_ALLERGY_DELETED             = "allergy_deleted"
+	AUDIT_ENCOUNTER_CODED             = "encounter_coded"
+	AUDIT_CODING_QUERY                = "coding_query"
+	AUDIT_TWOFA_RESET_ISSUED          = "twofa_reset_issued"
+	AUDIT_TWOFA_RESET                 = "twofa_reset"
+	AUDIT_EXPORT_STARTED              = "export_started"
+	AUDIT_EXPORT_DELETED              = "export_deleted"
+	AUDIT_PATIENT_MERGED              = "patient_merged"
+	AUDIT_REFILL_DECISION             = "refill_decision"
+	AUDIT_REFERRAL_DECISION           = "referral_decision"
+	AUDIT_BREAK_GLASS                 = "break_glass"
+	AUDIT_BREAK_GLASS_ACCESS          = "break_glass_access"
+	AUDIT_BACKUP_CREATED              = "backup_created"
+	AUDIT_BACKUP_RESTORED             = "backup_restored"
+	AUDIT_USER_DEACTIVATED            = "user_deactivated"
+	AUDIT_USER_REACTIVATED            = "user_reactivated"
+	AUDIT_USER_ROLE_CHANGED           = "user_role_changed"
+	AUDIT_USER_DEPARTMENTS_SET        = "user_departments_set"
+	AUDIT_USER_CREATED                = "user_created"
+	AUDIT_USER_PASSWORD_RESET         = "user_password_reset"
+	AUDIT_PATIENTS_EXPORTED           = "patients_exported"
+	AUDIT_SESSIONS_CLEARED            = "sessions_cleared"
+	AUDIT_NOTE_SIGNED                 = "note_signed"
+	AUDIT_DISCHARGE_SUMMARY_GENERATED = "discharge_summary_generated"
+	AUDIT_API_KEY_ISSUED              = "api_key_issued"
+	AUDIT_API_KEY_ROTATED             = "api_key_rotated"
+	AUDIT_API_KEY_REVOKED             = "api_key_revoked"
+	AUDIT_CALENDAR_FEED_ISSUED        = "calendar_feed_issued"
+	AUDIT_CALENDAR_FEED_REVOKED       = "calendar_feed_revoked"
+	AUDIT_WEBHOOK_SAVED               = "webhook_saved"
+	AUDIT_WEBHOOK_DELETED             = "webhook_deleted"
+	AUDIT_INSURANCE_POLICY_SAVED      = "insurance_policy_saved"
+	AUDIT_INSURANCE_VERIFIED          = "insurance_verified"
+	// AUDIT_DOWNLOAD_PREFIX is followed by the download kind, e.g. "download:prescriptions"
+	AUDIT_DOWNLOAD_PREFIX = "download:"
+	// AUDIT_OPS_PREFIX is followed by the ops action name, e.g. "ops:flush-caches"
+	AUDIT_OPS_PREFIX = "ops:"
+)
+
+// AuditLog records a security- or safety-relevant action and who performed it
+type AuditLog struct {
+	AuditLogID int             `json:"id"`
+	UserID     int             `json:"userId"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType,omitempty"`
+	EntityID   int             `json:"entityId,omitempty"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	// PrevHash is the Hash of the entry before this one, empty for the first
+	PrevHash string `json:"prevHash"`
+	// Hash is ChainHash(PrevHash), linking the entry into the tamper-evident
+	// chain
+	Hash string `json:"hash"`
+}
+
+// ChainHash is the hex SHA-256 of prevHash and the entry's content, so
+// altering, removing or reordering entries breaks the chain after them. The
+// ID isn't covered; the chain fixes the order.
+func (e *AuditLog) ChainHash(prevHash string) string {
+	content, _ := json.Marshal(struct {
+		PrevHash   string `json:"prevHash"`
+		UserID     int    `json:"userId"`
+		Action     string `json:"action"`
+		EntityType string `json:"entityType"`
+		EntityID   int    `json:"entityId"`
+		Details    string `json:"details"`
+		CreatedAt  string `json:"createdAt"`
+	}{prevHash, e.UserID, e.Action, e.EntityType, e.EntityID, string(e.Details), e.CreatedAt.UTC().Format(time.RFC3339Nano)})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditChainVerification is the result of walking the audit log's hash chain
+type AuditChainVerification struct {
+	Valid bool `json:"valid"`
+	// Checked is how many entries were verified, up to and including the
+	// first broken one
+	Checked int `json:"checked"`
+	// HeadHash is the last entry's hash when the chain is intact; recording
+	// it elsewhere also catches entries later removed from the end
+	HeadHash string `json:"headHash,omitempty"`
+	// BrokenAt is the first entry whose link or content doesn't match, and
+	// Reason says which
+	BrokenAt int    `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Backup is a copy of the SQLite database in the backup directory, named
+// after when it was taken
+type Backup struct {
+	Name      string    `json:"name"`
+	SizeBytes int64     `json:"sizeBytes"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BackupRestore reports a restore and the backup of the database taken just
+// before it, which undoes the restore
+type BackupRestore struct {
+	Restored     Backup `json:"restored"`
+	SafetyBackup Backup `json:"safetyBackup"`
+}
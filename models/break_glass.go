@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// breakGlassRoles are the clinical roles whose view of medical records is
+// limited but who may need the full chart in an emergency. Doctors and
+// admins already see everything.
+var breakGlassRoles = []string{ROLE_NURSE, ROLE_LAB_TECH, ROLE_PHARMACIST}
+
+// CanBreakGlass reports whether a user with role may request break-glass access
+func CanBreakGlass(role string) bool {
+	for _, allowed := range breakGlassRoles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// BreakGlassAccess is an emergency grant letting a clinician read a
+// patient's full medical records, beyond their role's usual view, until it
+// expires. Granting it and each read made under it are audit-logged.
+type BreakGlassAccess struct {
+	AccessID  int       `json:"id"`
+	UserID    int       `json:"userId"`
+	PatientID int       `json:"patientId" validate:"required,gt=0"`
+	Reason    string    `json:"reason" validate:"required,max=1000"`
+	GrantedAt time.Time `json:"grantedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// CalendarFeed is a doctor's subscription link to their appointments as an
+// iCalendar feed. Calendar apps can't send credentials, so the URL carries a
+// signed token; issuing a new feed invalidates the previous URL.
+type CalendarFeed struct {
+	DoctorID int       `json:"doctorId"`
+	URL      string    `json:"url"`
+	IssuedBy int       `json:"issuedBy"`
+	IssuedAt time.Time `json:"issuedAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// ChartLock is an advisory lock a clinician holds on a patient's chart while
+// editing it. Other users can see who holds it and ask to take it over.
+type ChartLock struct {
+	PatientID             int        `json:"patientId"`
+	HolderID              int        `json:"holderId"`
+	HolderName            string     `json:"holderName"`
+	AcquiredAt            time.Time  `json:"acquiredAt"`
+	ExpiresAt             time.Time  `json:"expiresAt"`
+	TakeoverRequestedBy   *int       `json:"takeoverRequestedBy,omitempty"`
+	TakeoverRequesterName string     `json:"takeoverRequesterName,omitempty"`
+	TakeoverRequestedAt   *time.Time `json:"takeoverRequestedAt,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Encounter types that are coded for billing: outpatient visits are medical
+// records, inpatient stays are discharged admissions
+const (
+	ENCOUNTER_OUTPATIENT = "outpatient"
+	ENCOUNTER_INPATIENT  = "inpatient"
+)
+
+const (
+	// CODING_STATUS_UNCODED encounters have no codes yet
+	CODING_STATUS_UNCODED = "uncoded"
+	// CODING_STATUS_QUERIED encounters are waiting for the doctor to answer a coder's query
+	CODING_STATUS_QUERIED = "queried"
+	// CODING_STATUS_ANSWERED encounters are back with the coders after the doctor answered
+	CODING_STATUS_ANSWERED = "answered"
+	CODING_STATUS_CODED    = "coded"
+)
+
+// EncounterCoding is the coding state of a completed encounter. Encounters
+// enter the coders' worklist uncoded; a coder either assigns ICD-10
+// diagnosis and procedure codes or queries the doctor, whose answer puts the
+// encounter back on the worklist.
+type EncounterCoding struct {
+	EncounterType  string     `json:"encounterType"`
+	EncounterID    int        `json:"encounterId"`
+	PatientID      int        `json:"patientId"`
+	DoctorID       int        `json:"doctorId"`
+	EncounterDate  time.Time  `json:"encounterDate"`
+	Diagnosis      string     `json:"diagnosis,omitempty"`
+	Status         string     `json:"status"`
+	BillingBlocked bool       `json:"billingBlocked"`
+	DiagnosisCodes []string   `json:"diagnosisCodes"`
+	ProcedureCodes []string   `json:"procedureCodes"`
+	CodedBy        *int       `json:"codedBy,omitempty"`
+	CodedAt        *time.Time `json:"codedAt,omitempty"`
+	Query          string     `json:"query,omitempty"`
+	QueriedBy      *int       `json:"queriedBy,omitempty"`
+	QueriedAt      *time.Time `json:"queriedAt,omitempty"`
+	DoctorResponse string     `json:"doctorResponse,omitempty"`
+	RespondedAt    *time.Time `json:"respondedAt,omitempty"`
+}
+
+// EncounterCodes are the codes a coder assigns to an encounter
+type EncounterCodes struct {
+	DiagnosisCodes []string `json:"diagnosisCodes" validate:"required,min=1,max=25,dive,icd10"`
+	ProcedureCodes []string `json:"procedureCodes" validate:"max=25,dive,procedurecode"`
+}
+
+// ICD10Code is an entry in the ICD-10 code table
+type ICD10Code struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// StorageUnit is a vaccine fridge or freezer with a temperature sensor.
+// Readings outside [MinTemp, MaxTemp] (°C) open an excursion.
+type StorageUnit struct {
+	UnitID    int       `json:"id"`
+	Name      string    `json:"name" validate:"required,max=100"`
+	Location  string    `json:"location" validate:"max=200"`
+	MinTemp   *float64  `json:"minTemp"`
+	MaxTemp   *float64  `json:"maxTemp"`
+	CreatedAt time.Time `json:"createdAt"`
+	// SensorKey authenticates the unit's sensor. It is only returned when the
+	// unit is created or the key is rotated; the database keeps a hash.
+	SensorKey string `json:"sensorKey,omitempty"`
+	// OpenExcursion is set while the unit is out of range
+	OpenExcursion *TemperatureExcursion `json:"openExcursion,omitempty"`
+}
+
+// TemperatureReading is one sensor measurement in °C
+type TemperatureReading struct {
+	ReadingID   int       `json:"id"`
+	UnitID      int       `json:"unitId"`
+	Temperature *float64  `json:"temperature" validate:"required"`
+	RecordedAt  time.Time `json:"recordedAt"`
+	ReceivedAt  time.Time `json:"receivedAt"`
+}
+
+// TemperatureExcursion is a period a unit spent outside its thresholds.
+// It stays open (EndedAt nil) until a reading is back in range, and acts as
+// the pharmacy alert until acknowledged.
+type TemperatureExcursion struct {
+	ExcursionID    int            `json:"id"`
+	UnitID         int            `json:"unitId"`
+	UnitName       string         `json:"unitName"`
+	StartedAt      time.Time      `json:"startedAt"`
+	EndedAt        *time.Time     `json:"endedAt,omitempty"`
+	LowestTemp     float64        `json:"lowestTemp"`
+	HighestTemp    float64        `json:"highestTemp"`
+	MinTemp        float64        `json:"minTemp"`
+	MaxTemp        float64        `json:"maxTemp"`
+	AcknowledgedBy *int           `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt *time.Time     `json:"acknowledgedAt,omitempty"`
+	Notes          string         `json:"notes,omitempty"`
+	Batches        []VaccineBatch `json:"batches,omitempty"`
+}
+
+// VaccineBatch is a lot of vaccine held in a storage unit
+type VaccineBatch struct {
+	BatchID     int       `json:"id"`
+	UnitID      int       `json:"unitId" validate:"required,gt=0"`
+	VaccineName string    `json:"vaccineName" validate:"required,max=200"`
+	LotNumber   string    `json:"lotNumber" validate:"required,max=100"`
+	Quantity    int       `json:"quantity" validate:"gte=0"`
+	ExpiryDate  string    `json:"expiryDate" validate:"required,date"`
+	Quarantined bool      `json:"quarantined"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// ExcursionReport is an excursion with the readings taken during it and the
+// batches that were in the unit when it started
+type ExcursionReport struct {
+	Excursion       TemperatureExcursion `json:"excursion"`
+	DurationMinutes float64              `json:"durationMinutes"`
+	Readings        []TemperatureReading `json:"readings"`
+	AffectedBatches []VaccineBatch       `json:"affectedBatches"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Department groups staff, e.g. "cardiology" or "pediatrics". Retired
+// departments keep their members but can't be assigned new ones.
+type Department struct {
+	Code        string `json:"code" validate:"required,max=50"`
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description,omitempty" validate:"max=500"`
+	Active      bool   `json:"active"`
+}
+
+// DepartmentMember is a staff member assigned to a department
+type DepartmentMember struct {
+	UserID     int       `json:"userId"`
+	FullName   string    `json:"fullName"`
+	Role       string    `json:"role"`
+	AssignedAt time.Time `json:"assignedAt"`
+}
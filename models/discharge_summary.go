@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// DischargeSummary is the document a patient leaves hospital with. Its
+// content is a snapshot of the admission and the care given during it,
+// saved when the summary is generated, so later edits to the chart don't
+// change what the patient and their next clinician were given.
+type DischargeSummary struct {
+	SummaryID   int                     `json:"id"`
+	PatientID   int                     `json:"patientId"`
+	AdmissionID int                     `json:"admissionId"`
+	GeneratedBy StaffRef                `json:"generatedBy"`
+	GeneratedAt time.Time               `json:"generatedAt"`
+	Content     DischargeSummaryContent `json:"content"`
+}
+
+// DischargeSummaryContent is what a discharge summary says
+type DischargeSummaryContent struct {
+	Patient   DischargePatient   `json:"patient"`
+	Admission DischargeAdmission `json:"admission"`
+	Allergies []Allergy          `json:"allergies"`
+	// Diagnoses and Treatments are from the medical records of visits
+	// during the stay, in visit order
+	Diagnoses  []DischargeDiagnosis `json:"diagnoses"`
+	Treatments []DischargeTreatment `json:"treatments"`
+	// Prescriptions are those written during the stay
+	Prescriptions        []Prescription `json:"prescriptions"`
+	FollowUpInstructions string         `json:"followUpInstructions"`
+}
+
+// DischargePatient identifies the patient on a discharge summary
+type DischargePatient struct {
+	ID          int    `json:"id"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	DateOfBirth string `json:"dateOfBirth"`
+	Gender      string `json:"gender"`
+}
+
+// DischargeAdmission is the stay a discharge summary covers
+type DischargeAdmission struct {
+	ID           int       `json:"id"`
+	Reason       string    `json:"reason"`
+	Ward         string    `json:"ward"`
+	Bed          string    `json:"bed"`
+	AdmittedAt   time.Time `json:"admittedAt"`
+	AdmittedBy   StaffRef  `json:"admittedBy"`
+	DischargedAt time.Time `json:"dischargedAt"`
+	DischargedBy StaffRef  `json:"dischargedBy"`
+	// Notes is the discharge note written when the patient was discharged
+	Notes string `json:"notes,omitempty"`
+}
+
+// DischargeDiagnosis is a diagnosis made during the stay
+type DischargeDiagnosis struct {
+	RecordID  int      `json:"recordId"`
+	VisitDate string   `json:"visitDate"`
+	Diagnosis string   `json:"diagnosis"`
+	Codes     []string `json:"codes"`
+}
+
+// DischargeTreatment is a treatment plan made during the stay
+type DischargeTreatment struct {
+	RecordID  int      `json:"recordId"`
+	VisitDate string   `json:"visitDate"`
+	Plan      string   `json:"plan"`
+	Doctor    StaffRef `json:"doctor"`
+}
+
+// DischargeSummaryRequest is what the doctor adds when generating a
+// discharge summary; the rest is taken from the chart
+type DischargeSummaryRequest struct {
+	FollowUpInstructions string `json:"followUpInstructions" validate:"required,max=5000"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Document is a file, such as a scan, PDF or photo, attached to a patient
+// and optionally to one of their medical records. The file itself lives in
+// the document store under StorageKey.
+type Document struct {
+	DocumentID  int       `json:"id"`
+	PatientID   int       `json:"patientId"`
+	RecordID    *int      `json:"recordId,omitempty"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	SizeBytes   int64     `json:"sizeBytes"`
+	SHA256      string    `json:"sha256"`
+	Description string    `json:"description,omitempty"`
+	StorageKey  string    `json:"-"`
+	UploadedBy  int       `json:"uploadedBy"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+}
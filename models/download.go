@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	DOWNLOAD_MEDICAL_RECORDS   = "medical-records"
+	DOWNLOAD_PRESCRIPTIONS     = "prescriptions"
+	DOWNLOAD_DOCUMENT          = "document"
+	DOWNLOAD_DISCHARGE_SUMMARY = "discharge-summary"
+)
+
+// DownloadToken authorizes a single browser download of a file. Browsers
+// can't attach an Authorization header to a navigation, so the API mints a
+// short-lived token and the download URL carries it instead.
+type DownloadToken struct {
+	Token      string    `json:"token"`
+	Kind       string    `json:"kind"`
+	ResourceID int       `json:"resourceId"`
+	URL        string    `json:"url"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	UserID     int       `json:"-"`
+	// SessionID binds the token to the session that minted it; empty for basic auth
+	SessionID string `json:"-"`
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ENTITY_PATIENT           = "patient"
+	ENTITY_MEDICAL_RECORD    = "medical_record"
+	ENTITY_PRESCRIPTION      = "prescription"
+	ENTITY_LAB_ORDER         = "lab_order"
+	ENTITY_ADMISSION         = "admission"
+	ENTITY_PREAUTH           = "preauth"
+	ENTITY_CLAIM             = "claim"
+	ENTITY_DOCUMENT          = "document"
+	ENTITY_APPOINTMENT       = "appointment"
+	ENTITY_PATIENT_FLAG      = "patient_flag"
+	ENTITY_ALLERGY           = "allergy"
+	ENTITY_INTERPRETER       = "interpreter_booking"
+	ENTITY_USER              = "user"
+	ENTITY_EXPORT            = "export"
+	ENTITY_REFILL_REQUEST    = "refill_request"
+	ENTITY_BREAK_GLASS       = "break_glass"
+	ENTITY_REPORT_SCHEDULE   = "report_schedule"
+	ENTITY_REFERRAL          = "referral"
+	ENTITY_NOTE              = "note"
+	ENTITY_DISCHARGE_SUMMARY = "discharge_summary"
+	ENTITY_API_KEY           = "api_key"
+	ENTITY_WEBHOOK           = "webhook"
+	ENTITY_INSURANCE_POLICY  = "insurance_policy"
+)
+
+const (
+	EVENT_PATIENT_CREATED      = "patient_created"
+	EVENT_PATIENT_UPDATED      = "patient_updated"
+	EVENT_PATIENT_DELETED      = "patient_deleted"
+	EVENT_PATIENT_MERGED       = "patient_merged"
+	EVENT_RECORD_CREATED       = "record_created"
+	EVENT_NOTE_ADDED           = "note_added"
+	EVENT_NOTE_UPDATED         = "note_updated"
+	EVENT_NOTE_SIGNED          = "note_signed"
+	EVENT_PRESCRIPTION_CREATED = "prescription_created"
+	EVENT_PRESCRIPTION_SIGNED  = "prescription_signed"
+	EVENT_PRESCRIPTION_READY   = "prescription_ready"
+	EVENT_LAB_ORDERED          = "lab_ordered"
+	EVENT_LAB_RESULTED         = "lab_resulted"
+	EVENT_PATIENT_ADMITTED     = "patient_admitted"
+	EVENT_PATIENT_TRANSFERRED  = "patient_transferred"
+	EVENT_PATIENT_DISCHARGED   = "patient_discharged"
+)
+
+// ClinicalEvent is an immutable entry in the append-only event log
+type ClinicalEvent struct {
+	EventID    int             `json:"id"`
+	EntityType string          `json:"entityType"`
+	EntityID   int             `json:"entityId"`
+	EventType  string          `json:"eventType"`
+	Payload    json.RawMessage `json:"payload"`
+	OccurredAt time.Time       `json:"occurredAt"`
+}
+
+// EntityProjection is the state of an entity rebuilt by replaying its events
+type EntityProjection struct {
+	EntityType    string         `json:"entityType"`
+	EntityID      int            `json:"entityId"`
+	Version       int            `json:"version"`
+	LastEventType string         `json:"lastEventType"`
+	Deleted       bool           `json:"deleted"`
+	State         map[string]any `json:"state"`
+}
+
+// EntityChange announces a committed clinical event to live subscribers. It
+// carries no payload: clients refetch the entity through the usual
+// endpoints, which shape it for their role.
+type EntityChange struct {
+	EventID    int       `json:"id"`
+	EntityType string    `json:"entityType"`
+	EntityID   int       `json:"entityId"`
+	EventType  string    `json:"eventType"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// changeAudiences lists the roles, besides admins, that are sent live
+// changes to each entity type
+var changeAudiences = map[string][]string{
+	ENTITY_PATIENT:        {ROLE_DOCTOR, ROLE_NURSE, ROLE_PHARMACIST, ROLE_LAB_TECH},
+	ENTITY_MEDICAL_RECORD: {ROLE_DOCTOR, ROLE_NURSE, ROLE_CODER},
+	ENTITY_PRESCRIPTION:   {ROLE_DOCTOR, ROLE_NURSE, ROLE_PHARMACIST},
+	ENTITY_LAB_ORDER:      {ROLE_DOCTOR, ROLE_NURSE, ROLE_LAB_TECH},
+	ENTITY_ADMISSION:      {ROLE_DOCTOR, ROLE_NURSE, ROLE_HOUSEKEEPING},
+	ENTITY_NOTE:           {ROLE_DOCTOR},
+}
+
+// SeesChanges reports whether role is sent live changes to entityType
+func SeesChanges(role, entityType string) bool {
+	if role == ROLE_ADMIN {
+		return true
+	}
+	for _, allowed := range changeAudiences[entityType] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package models
+
+// Related records a listing can be asked to ?expand= into summaries
+const (
+	EXPAND_PATIENT = "patient"
+	EXPAND_DOCTOR  = "doctor"
+)
+
+// Expand is which related records a listing includes summaries of, joined
+// in the listing's own query rather than fetched one by one
+type Expand struct {
+	Patient bool
+	Doctor  bool
+}
+
+// PatientRef names the patient a listed item is about
+type PatientRef struct {
+	ID          int    `json:"id"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	DateOfBirth string `json:"dateOfBirth"`
+}
+
+// StaffRef names the staff member who wrote a listed item
+type StaffRef struct {
+	ID       int    `json:"id"`
+	FullName string `json:"fullName"`
+	Role     string `json:"role"`
+}
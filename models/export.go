@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+const (
+	EXPORT_AUDIT_LOG       = "audit-log"
+	EXPORT_CLINICAL_EVENTS = "clinical-events"
+)
+
+// Formats a download streamed straight from the database can be written in
+const (
+	STREAM_FORMAT_CSV    = "csv"
+	STREAM_FORMAT_NDJSON = "ndjson"
+)
+
+const (
+	EXPORT_STATUS_RUNNING   = "running"
+	EXPORT_STATUS_COMPLETED = "completed"
+	EXPORT_STATUS_FAILED    = "failed"
+)
+
+// Export is the manifest of a bulk export written as numbered NDJSON chunk
+// files. Chunks are listed as soon as they are written, so a client can
+// fetch them while the export is still running and resume any one with a
+// Range request, checking it against SHA256.
+type Export struct {
+	ExportID    int           `json:"id"`
+	Kind        string        `json:"kind"`
+	Status      string        `json:"status"`
+	Error       string        `json:"error,omitempty"`
+	RequestedBy int           `json:"requestedBy"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	CompletedAt *time.Time    `json:"completedAt,omitempty"`
+	TotalRows   int           `json:"totalRows"`
+	TotalBytes  int64         `json:"totalBytes"`
+	Chunks      []ExportChunk `json:"chunks"`
+}
+
+// ExportChunk is one file of an export
+type ExportChunk struct {
+	Index  int    `json:"index"`
+	Rows   int    `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	HEALTH_STATUS_OK     = "ok"
+	HEALTH_STATUS_FAILED = "failed"
+)
+
+// HealthReport is the result of a readiness check: ok only when every check
+// passed
+type HealthReport struct {
+	Status    string        `json:"status"`
+	CheckedAt time.Time     `json:"checkedAt"`
+	Checks    []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is one dependency probed by a readiness check
+type HealthCheck struct {
+	Name      string         `json:"name"`
+	Status    string         `json:"status"`
+	LatencyMs float64        `json:"latencyMs"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+const (
+	HOUSEKEEPING_STATUS_PENDING     = "pending"
+	HOUSEKEEPING_STATUS_IN_PROGRESS = "in_progress"
+	HOUSEKEEPING_STATUS_COMPLETED   = "completed"
+)
+
+// Reasons a bed was vacated
+const (
+	HOUSEKEEPING_REASON_DISCHARGE = "discharge"
+	HOUSEKEEPING_REASON_TRANSFER  = "transfer"
+)
+
+// HousekeepingTask is the cleaning of a vacated bed. The bed can't be
+// assigned again until its task is completed.
+type HousekeepingTask struct {
+	TaskID      int        `json:"id"`
+	BedID       int        `json:"bedId"`
+	BedLabel    string     `json:"bedLabel"`
+	WardID      int        `json:"wardId"`
+	WardName    string     `json:"wardName"`
+	AdmissionID *int       `json:"admissionId,omitempty"`
+	Reason      string     `json:"reason"`
+	Status      string     `json:"status"`
+	VacatedAt   time.Time  `json:"vacatedAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	StartedBy   *int       `json:"startedBy,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	CompletedBy *int       `json:"completedBy,omitempty"`
+	Notes       string     `json:"notes,omitempty"`
+}
+
+// WardTurnover summarises completed cleanings in a ward. Turnover runs from
+// the bed being vacated to cleaning completed; it is the wait for a
+// housekeeper plus the cleaning itself. Durations are in minutes.
+type WardTurnover struct {
+	WardID             int     `json:"wardId"`
+	WardName           string  `json:"wardName"`
+	Completed          int     `json:"completed"`
+	Pending            int     `json:"pending"`
+	AvgTurnoverMinutes float64 `json:"avgTurnoverMinutes"`
+	MaxTurnoverMinutes float64 `json:"maxTurnoverMinutes"`
+	AvgWaitMinutes     float64 `json:"avgWaitMinutes"`
+	AvgCleaningMinutes float64 `json:"avgCleaningMinutes"`
+}
+
+// TurnoverReport is the per-ward turnover for tasks completed in [From, To)
+type TurnoverReport struct {
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Wards       []WardTurnover `json:"wards"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+}
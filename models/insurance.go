@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+const (
+	INSURANCE_STATUS_UNVERIFIED = "unverified"
+	INSURANCE_STATUS_VERIFIED   = "verified"
+	INSURANCE_STATUS_REJECTED   = "rejected"
+)
+
+// InsurancePolicy is a patient's cover with a payer. Until billing staff
+// verify it with the payer it isn't applied to claims. Changing the cover
+// sets it back to unverified.
+type InsurancePolicy struct {
+	PolicyID     int    `json:"id"`
+	PatientID    int    `json:"patientId"`
+	Payer        string `json:"payer" validate:"required,max=100"`
+	PolicyNumber string `json:"policyNumber" validate:"required,max=100"`
+	// HolderName is the policyholder when the patient is a dependant on
+	// someone else's policy
+	HolderName    string `json:"holderName,omitempty" validate:"max=200"`
+	CoverageClass string `json:"coverageClass" validate:"required,max=50"`
+	// CoveragePercent of each claim, after the copay, is paid by the payer
+	CoveragePercent int `json:"coveragePercent" validate:"min=0,max=100"`
+	// CopayCents is paid by the patient on each claim before cover applies
+	CopayCents int    `json:"copayCents" validate:"gte=0"`
+	ValidFrom  string `json:"validFrom" validate:"required,date"`
+	// ValidTo is the last day of cover; empty for open-ended policies
+	ValidTo            string     `json:"validTo,omitempty" validate:"omitempty,date"`
+	VerificationStatus string     `json:"verificationStatus"`
+	VerifiedBy         *int       `json:"verifiedBy,omitempty"`
+	VerifiedAt         *time.Time `json:"verifiedAt,omitempty"`
+	VerificationNotes  string     `json:"verificationNotes,omitempty"`
+	CreatedBy          int        `json:"createdBy"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+}
+
+// CoversDate reports whether the policy is valid on date, a YYYY-MM-DD day
+func (p *InsurancePolicy) CoversDate(date string) bool {
+	return p.ValidFrom <= date && (p.ValidTo == "" || date <= p.ValidTo)
+}
+
+// InsuranceVerification records the payer's confirmation, or refusal, of a policy
+type InsuranceVerification struct {
+	Status string `json:"status" validate:"required,oneof=verified rejected"`
+	Notes  string `json:"notes" validate:"max=2000"`
+}
+
+// ClaimCoverage splits a claim's total between the payer and the patient
+// under its policy. The patient pays the copay, then the share of the rest
+// the policy doesn't cover.
+type ClaimCoverage struct {
+	TotalCents                 int `json:"totalCents"`
+	CopayCents                 int `json:"copayCents"`
+	CoveredCents               int `json:"coveredCents"`
+	PatientResponsibilityCents int `json:"patientResponsibilityCents"`
+}
+
+// ApplyCoverage splits totalCents under policy, rounding the payer's share down
+func ApplyCoverage(totalCents int, policy *InsurancePolicy) ClaimCoverage {
+	copay := min(policy.CopayCents, totalCents)
+	covered := (totalCents - copay) * policy.CoveragePercent / 100
+	return ClaimCoverage{
+		TotalCents:                 totalCents,
+		CopayCents:                 copay,
+		CoveredCents:               covered,
+		PatientResponsibilityCents: totalCents - covered,
+	}
+}
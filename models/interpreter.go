@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// How an interpreter booking is covered: by an interpreter on the hospital's
+// own roster, or by a request to an external agency
+const (
+	INTERPRETER_BOOKING_INTERNAL = "internal"
+	INTERPRETER_BOOKING_EXTERNAL = "external"
+)
+
+const (
+	// INTERPRETER_STATUS_RESERVED is an internal interpreter held for the appointment
+	INTERPRETER_STATUS_RESERVED = "reserved"
+	// INTERPRETER_STATUS_REQUESTED is an external request awaiting the agency's confirmation
+	INTERPRETER_STATUS_REQUESTED = "requested"
+	// INTERPRETER_STATUS_CONFIRMED is an external request the agency has confirmed
+	INTERPRETER_STATUS_CONFIRMED = "confirmed"
+	INTERPRETER_STATUS_CANCELLED = "cancelled"
+)
+
+// Interpreter is an interpreter on the hospital's roster
+type Interpreter struct {
+	InterpreterID int      `json:"id"`
+	FullName      string   `json:"fullName" validate:"required,max=100"`
+	Languages     []string `json:"languages" validate:"required,min=1,dive,required,max=50"`
+	Contact       string   `json:"contact,omitempty" validate:"max=100"`
+	Active        bool     `json:"active"`
+}
+
+// InterpreterBooking is the interpreter arranged for an appointment with a
+// patient who needs one
+type InterpreterBooking struct {
+	BookingID         int        `json:"id"`
+	AppointmentID     int        `json:"appointmentId"`
+	Language          string     `json:"language"`
+	Kind              string     `json:"kind"`
+	InterpreterID     *int       `json:"interpreterId,omitempty"`
+	InterpreterName   string     `json:"interpreterName,omitempty"`
+	Status            string     `json:"status"`
+	ExternalReference string     `json:"externalReference,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	ConfirmedAt       *time.Time `json:"confirmedAt,omitempty"`
+}
+
+// ScheduledAppointment is an appointment as listed on the clinic schedule
+type ScheduledAppointment struct {
+	Appointment
+	PatientName         string `json:"patientName"`
+	PreferredLanguage   string `json:"preferredLanguage,omitempty"`
+	InterpreterRequired bool   `json:"interpreterRequired"`
+}
+
+// ClinicSchedule is the day's appointments in start order. AwaitingInterpreter
+// counts appointments whose interpreter isn't secured yet: external requests
+// the agency hasn't confirmed.
+type ClinicSchedule struct {
+	Date                string                 `json:"date"`
+	Appointments        []ScheduledAppointment `json:"appointments"`
+	AwaitingInterpreter int                    `json:"awaitingInterpreter"`
+}
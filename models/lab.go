@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	LAB_STATUS_ORDERED   = "ordered"
+	LAB_STATUS_COMPLETED = "completed"
+	LAB_STATUS_CANCELLED = "cancelled"
+)
+
+const (
+	LAB_FLAG_NORMAL   = "normal"
+	LAB_FLAG_LOW      = "low"
+	LAB_FLAG_HIGH     = "high"
+	LAB_FLAG_CRITICAL = "critical"
+	LAB_FLAG_ABNORMAL = "abnormal"
+)
+
+// LabOrder is a test ordered by a doctor as part of a medical record
+type LabOrder struct {
+	LabOrderID int         `json:"id"`
+	PatientID  int         `json:"patientId"`
+	RecordID   int         `json:"recordId" validate:"required,gt=0"`
+	OrderedBy  int         `json:"orderedBy"`
+	TestName   string      `json:"testName" validate:"required,max=200"`
+	Priority   string      `json:"priority" validate:"omitempty,oneof=routine urgent stat"`
+	Status     string      `json:"status"`
+	Notes      string      `json:"notes" validate:"max=2000"`
+	OrderedAt  time.Time   `json:"orderedAt"`
+	Results    []LabResult `json:"results,omitempty"`
+}
+
+// LabResult is one measured value posted by lab staff against an order.
+// Flag is derived from the reference range when the value is numeric and no flag is given.
+type LabResult struct {
+	LabResultID    int       `json:"id"`
+	LabOrderID     int       `json:"labOrderId"`
+	Analyte        string    `json:"analyte" validate:"required,max=200"`
+	Value          string    `json:"value" validate:"required,max=100"`
+	Unit           string    `json:"unit" validate:"max=50"`
+	ReferenceLow   *float64  `json:"referenceLow,omitempty"`
+	ReferenceHigh  *float64  `json:"referenceHigh,omitempty"`
+	ReferenceRange string    `json:"referenceRange,omitempty" validate:"max=100"`
+	Flag           string    `json:"flag" validate:"omitempty,oneof=normal low high critical abnormal"`
+	Comment        string    `json:"comment" validate:"max=2000"`
+	ResultedBy     int       `json:"resultedBy"`
+	ResultedAt     time.Time `json:"resultedAt"`
+}
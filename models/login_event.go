@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// How a LoginEvent authenticated
+const (
+	// LOGIN_METHOD_BASIC is a password checked for a single request, as with
+	// HTTP basic auth
+	LOGIN_METHOD_BASIC = "basic"
+	// LOGIN_METHOD_SESSION is a password opening a session that still needs
+	// its second factor
+	LOGIN_METHOD_SESSION = "session"
+	// LOGIN_METHOD_2FA is a TOTP code, backup code or security key completing
+	// a session
+	LOGIN_METHOD_2FA = "2fa"
+)
+
+// Why a LoginEvent failed
+const (
+	LOGIN_FAILURE_UNKNOWN_USER  = "unknown_user"
+	LOGIN_FAILURE_PASSWORD      = "invalid_password"
+	LOGIN_FAILURE_DEACTIVATED   = "deactivated"
+	LOGIN_FAILURE_SECOND_FACTOR = "invalid_second_factor"
+)
+
+// LoginEvent is one authentication attempt, successful or not
+type LoginEvent struct {
+	LoginEventID int `json:"id"`
+	// UserID is zero when the username matched no account
+	UserID        int       `json:"userId,omitempty"`
+	Username      string    `json:"username"`
+	Method        string    `json:"method"`
+	Success       bool      `json:"success"`
+	FailureReason string    `json:"failureReason,omitempty"`
+	IPAddress     string    `json:"ipAddress"`
+	UserAgent     string    `json:"userAgent"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
@@ -0,0 +1,20 @@
+package models
+
+// Medication is a catalog entry prescriptions can reference instead of, or
+// as well as, a free-text medication name. Strength is stored normalized,
+// e.g. "500 mg" or "250 mg/5 ml".
+type Medication struct {
+	MedicationID int    `json:"id"`
+	Name         string `json:"name" validate:"required,max=200"`
+	Form         string `json:"form" validate:"required,max=50"`
+	Strength     string `json:"strength" validate:"required,max=50"`
+	Route        string `json:"route" validate:"required,max=50"`
+	// DrugClass groups entries for reporting, e.g. "Antibiotic"
+	DrugClass string `json:"drugClass,omitempty" validate:"max=100"`
+}
+
+// DisplayName names the entry the way it is written on a prescription,
+// e.g. "Amoxicillin 500 mg capsule"
+func (m *Medication) DisplayName() string {
+	return m.Name + " " + m.Strength + " " + m.Form
+}
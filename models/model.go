@@ -1,44 +1,125 @@
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
 const (
-	ROLE_ADMIN      = "Admin"
-	ROLE_DOCTOR     = "Doctor"
-	ROLE_NURSE      = "Nurse"
-	ROLE_PHARMACIST = "Pharmacist"
+	ROLE_ADMIN        = "Admin"
+	ROLE_DOCTOR       = "Doctor"
+	ROLE_NURSE        = "Nurse"
+	ROLE_PHARMACIST   = "Pharmacist"
+	ROLE_LAB_TECH     = "LabTechnician"
+	ROLE_HOUSEKEEPING = "Housekeeping"
+	ROLE_CODER        = "Coder"
+	// ROLE_PATIENT is a patient portal account, linked to one patient and
+	// confined to that patient's chart
+	ROLE_PATIENT = "Patient"
 )
 
+// Roles lists every assignable role
+func Roles() []string {
+	return []string{ROLE_ADMIN, ROLE_DOCTOR, ROLE_NURSE, ROLE_PHARMACIST, ROLE_LAB_TECH, ROLE_HOUSEKEEPING, ROLE_CODER, ROLE_PATIENT}
+}
+
+// CanonicalRole maps a case-insensitive role name (the web client sends
+// "doctor") to its stored form, reporting whether the role exists
+func CanonicalRole(role string) (string, bool) {
+	for _, known := range Roles() {
+		if strings.EqualFold(role, known) {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// Patient is a registered patient. Allergies summarises their active
+// allergies by substance: on create a comma-separated list is recorded as
+// allergies, and afterwards it is read-only since allergies are managed
+// through their own endpoints.
 type Patient struct {
 	PatientID        int    `json:"id"`
-	FirstName        string `json:"firstName"`
-	LastName         string `json:"lastName"`
-	DateOfBirth      string `json:"dateOfBirth"`
-	Gender           string `json:"gender"`
-	ContactInfo      string `json:"phone"`
-	Address          string `json:"address"`
-	MedicalHistory   string `json:"medicalHistory"`
-	Allergies        string `json:"allergies"`
-	EmergencyContact string `json:"emergencyContact"`
+	FirstName        string `json:"firstName" validate:"required,max=100"`
+	LastName         string `json:"lastName" validate:"required,max=100"`
+	DateOfBirth      string `json:"dateOfBirth" validate:"omitempty,pastdate"`
+	Gender           string `json:"gender" validate:"omitempty,gender"`
+	ContactInfo      string `json:"phone" validate:"max=50"`
+	Address          string `json:"address" validate:"max=255"`
+	MedicalHistory   string `json:"medicalHistory" validate:"max=5000"`
+	Allergies        string `json:"allergies" validate:"max=1000"`
+	EmergencyContact string `json:"emergencyContact" validate:"max=100"`
+	// PreferredLanguage is required when InterpreterRequired is set, so an
+	// interpreter can be booked with each appointment
+	PreferredLanguage   string `json:"preferredLanguage" validate:"required_if=InterpreterRequired true,max=50"`
+	InterpreterRequired bool   `json:"interpreterRequired"`
+	// MergedInto is set on a duplicate record merged into another patient;
+	// clients should follow it to the surviving record
+	MergedInto *int `json:"mergedInto,omitempty"`
 }
 
+// User is a staff or patient portal account. The 2FA secret and backup
+// code hashes are never serialized.
 type User struct {
 	UserID           int      `json:"id"`
-	Username         string   `json:"username"`
+	Username         string   `json:"username" validate:"required,min=3,max=50"`
 	PasswordHash     string   `json:"password_hash"`
-	Role             string   `json:"role"`
-	FullName         string   `json:"fullName"`
-	TwoFASecret      string   `json:"two_fa_secret"`
+	Role             string   `json:"role" validate:"required,role"`
+	FullName         string   `json:"fullName" validate:"required,max=100"`
+	TwoFASecret      string   `json:"-"`
 	TwoFAEnabled     bool     `json:"twoFactorEnabled"`
-	TwoFABackupCodes []string `json:"backupCodes"`
+	TwoFABackupCodes []string `json:"-"`
+	// PatientID is the patient a Patient account belongs to; staff accounts
+	// have none
+	PatientID *int `json:"patientId,omitempty" validate:"required_if=Role Patient,excluded_unless=Role Patient"`
+	// Notifications is how the user wants to be notified; users set it
+	// themselves through /api/me
+	Notifications NotificationPreferences `json:"notifications"`
+	// Active is false once an admin deactivates the account, which can then
+	// neither log in nor use its sessions
+	Active bool `json:"active"`
+	// LastLoginAt is when the user last completed a login, nil if never
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// Staff notification channels
+const (
+	NOTIFY_CHANNEL_EMAIL = "email"
+	NOTIFY_CHANNEL_SMS   = "sms"
+	NOTIFY_CHANNEL_NONE  = "none"
+)
+
+// NotificationPreferences is the channel a staff member is notified on and
+// their address on it
+type NotificationPreferences struct {
+	Channel string `json:"channel" validate:"omitempty,oneof=email sms none"`
+	Email   string `json:"email" validate:"required_if=Channel email,omitempty,email,max=254"`
+	Phone   string `json:"phone" validate:"required_if=Channel sms,omitempty,e164"`
+}
+
+// ProfileUpdate is what users may change about their own account without an admin
+type ProfileUpdate struct {
+	FullName      string                  `json:"fullName" validate:"required,max=100"`
+	Notifications NotificationPreferences `json:"notifications"`
 }
 
 type MedicalRecord struct {
 	RecordID      int    `json:"id"`
-	PatientID     int    `json:"patient_id"`
+	PatientID     int    `json:"patient_id" validate:"required,gt=0"`
 	DoctorID      int    `json:"doctor_id"`
-	VisitDate     string `json:"visit_date"`
-	Diagnosis     string `json:"diagnosis"`
-	TreatmentPlan string `json:"treatment_plan"`
-	DoctorNotes   string `json:"doctor_notes"`
+	VisitDate     string `json:"visit_date" validate:"required,date,notfarfuture"`
+	Diagnosis     string `json:"diagnosis" validate:"required,max=500"`
+	TreatmentPlan string `json:"treatment_plan" validate:"max=5000"`
+	DoctorNotes   string `json:"doctor_notes" validate:"max=10000"`
+	// DiagnosisCodes are the ICD-10 codes for the diagnosis, primary first
+	DiagnosisCodes []string `json:"diagnosis_codes" validate:"max=25,dive,icd10"`
+	// TemplateCode names the RecordTemplate the record was written from;
+	// Sections then holds its content, in the template's order
+	TemplateCode string          `json:"template_code,omitempty" validate:"max=50"`
+	Sections     []RecordSection `json:"sections,omitempty" validate:"max=30,dive"`
 }
 
 type MedicalRecordNurseView struct {
@@ -46,18 +127,118 @@ type MedicalRecordNurseView struct {
 	PatientID int    `json:"patient_id"`
 	VisitDate string `json:"visit_date"`
 	Diagnosis string `json:"diagnosis"`
+	// Patient is set when the listing was asked to ?expand=patient
+	Patient *PatientRef `json:"patient,omitempty"`
 }
 
 type Prescription struct {
 	PrescriptionID int    `json:"id"`
-	PatientID      int    `json:"patientId"`
+	PatientID      int    `json:"patientId" validate:"required,gt=0"`
 	DoctorID       int    `json:"doctor_id"`
-	PrescribedDate string `json:"prescribedDate"`
-	Medication     string `json:"medication"`
-	Dosage         string `json:"dosage"`
-	Status         string `json:"status"`
-	Duration       string `json:"duration"`
-	Instructions   string `json:"instructions"`
+	PrescribedDate string `json:"prescribedDate" validate:"omitempty,date,notfarfuture"`
+	Medication     string `json:"medication" validate:"required_without=MedicationID,max=200"`
+	// MedicationID references the medication catalog. It is set from the
+	// free-text medication when that matches exactly one catalog entry, and
+	// once set, Medication is the entry's name.
+	MedicationID *int   `json:"medicationId,omitempty"`
+	Dosage       string `json:"dosage" validate:"required,max=100"`
+	Status       string `json:"status" validate:"max=50"`
+	Duration     string `json:"duration" validate:"max=100"`
+	Instructions string `json:"instructions" validate:"max=2000"`
+	// RecordID is the medical record of the visit it was written at, when
+	// it was prescribed through the visit endpoints
+	RecordID *int `json:"recordId,omitempty"`
+	// RefillOf is the prescription this one refills, and RefillCount how
+	// many refills precede it in that chain
+	RefillOf    *int `json:"refillOf,omitempty"`
+	RefillCount int  `json:"refillCount"`
+	// SignedBy, SignedAt and SignatureHash record the prescriber's
+	// electronic signature. SignatureHash is the ContentHash they signed;
+	// it is empty for prescriptions written before signatures were required.
+	SignedBy      *int       `json:"signedBy,omitempty"`
+	SignedAt      *time.Time `json:"signedAt,omitempty"`
+	SignatureHash string     `json:"signatureHash,omitempty"`
+	// OverrideReason lets a doctor prescribe despite safety warnings; it is
+	// audit-logged rather than stored on the prescription
+	OverrideReason string `json:"overrideReason,omitempty" validate:"max=1000"`
+	// Patient and Doctor are set when the listing was asked to
+	// ?expand=patient,doctor
+	Patient *PatientRef `json:"patient,omitempty"`
+	Doctor  *StaffRef   `json:"doctor,omitempty"`
+}
+
+// PharmacistPrescription is a row of the pharmacy's dispensing worklist: a
+// prescription with the names of its patient and prescriber
+type PharmacistPrescription struct {
+	PrescriptionID int        `json:"id"`
+	PatientID      int        `json:"patientId"`
+	PatientName    string     `json:"patientName"`
+	PrescriberName string     `json:"prescriberName"`
+	PrescribedDate string     `json:"prescribedDate"`
+	Medication     string     `json:"medication"`
+	MedicationID   *int       `json:"medicationId,omitempty"`
+	Dosage         string     `json:"dosage"`
+	Duration       string     `json:"duration"`
+	Instructions   string     `json:"instructions"`
+	Status         string     `json:"status"`
+	ReadyAt        *time.Time `json:"readyAt,omitempty"`
+	RefillCount    int        `json:"refillCount"`
+}
+
+const (
+	// PRESCRIPTION_STATUS_UNSIGNED prescriptions wait for their prescriber's
+	// signature before the pharmacy may dispense them
+	PRESCRIPTION_STATUS_UNSIGNED = "unsigned"
+	PRESCRIPTION_STATUS_ACTIVE   = "active"
+	// PRESCRIPTION_STATUS_READY means the pharmacy has it ready for collection
+	PRESCRIPTION_STATUS_READY = "ready"
+)
+
+// ContentHash is the hex SHA-256 of what a prescriber signs: the patient,
+// prescriber, date, medication and directions. A signed prescription whose
+// hash no longer matches its SignatureHash was changed after signing.
+func (p *Prescription) ContentHash() string {
+	content, _ := json.Marshal(struct {
+		PatientID      int    `json:"patientId"`
+		DoctorID       int    `json:"doctorId"`
+		PrescribedDate string `json:"prescribedDate"`
+		Medication     string `json:"medication"`
+		MedicationID   *int   `json:"medicationId"`
+		Dosage         string `json:"dosage"`
+		Duration       string `json:"duration"`
+		Instructions   string `json:"instructions"`
+		RefillOf       *int   `json:"refillOf"`
+	}{p.PatientID, p.DoctorID, p.PrescribedDate, p.Medication, p.MedicationID, p.Dosage, p.Duration, p.Instructions, p.RefillOf})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// PrescriptionSignature re-authenticates the prescriber signing a
+// prescription with their password or a current 2FA code
+type PrescriptionSignature struct {
+	Password string `json:"password" validate:"required_without=Code,max=200"`
+	Code     string `json:"code" validate:"required_without=Password,max=20"`
+}
+
+// Fields prescription listings can be sorted by
+const (
+	PRESCRIPTION_SORT_ID              = "id"
+	PRESCRIPTION_SORT_PRESCRIBED_DATE = "prescribedDate"
+	PRESCRIPTION_SORT_MEDICATION      = "medication"
+)
+
+const (
+	WARNING_ALLERGY     = "allergy"
+	WARNING_INTERACTION = "interaction"
+)
+
+// PrescriptionWarning is a safety issue found when checking a new prescription
+type PrescriptionWarning struct {
+	Type                      string `json:"type"`
+	Severity                  string `json:"severity"`
+	Message                   string `json:"message"`
+	ConflictingDrug           string `json:"conflictingDrug,omitempty"`
+	ConflictingPrescriptionID int    `json:"conflictingPrescriptionId,omitempty"`
 }
 
 type TwoFASetup struct {
@@ -65,3 +246,20 @@ type TwoFASetup struct {
 	QRCodeUrl   string   `json:"qrCodeUrl"`   // Base64 encoded QR code data URL
 	BackupCodes []string `json:"backupCodes"` // Generated during enable
 }
+
+// TwoFAReset is a one-time token an admin issues to a user who has lost
+// their authenticator. The token is only returned when issued.
+type TwoFAReset struct {
+	UserID    int       `json:"userId"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type WebAuthnCredential struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"userId"`
+	CredentialID string     `json:"credentialId"`
+	Name         string     `json:"name"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Note is a timestamped clinical note on a medical record. Its author can
+// edit it until they sign it; a signed note is immutable, and is corrected
+// or extended with an addendum, a note of its own that names it.
+type Note struct {
+	NoteID   int      `json:"id"`
+	RecordID int      `json:"recordId"`
+	Author   StaffRef `json:"author"`
+	Body     string   `json:"body" validate:"required,max=10000"`
+	// AddendumTo is the signed note this one amends
+	AddendumTo *int       `json:"addendumTo,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+	SignedAt   *time.Time `json:"signedAt,omitempty"`
+}
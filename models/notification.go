@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	NOTIFICATION_STATUS_PENDING   = "pending"
+	NOTIFICATION_STATUS_SENDING   = "sending"
+	NOTIFICATION_STATUS_SENT      = "sent"
+	NOTIFICATION_STATUS_FAILED    = "failed"
+	NOTIFICATION_STATUS_CANCELLED = "cancelled"
+)
+
+const (
+	NOTIFICATION_APPOINTMENT_REMINDER = "appointment_reminder"
+	NOTIFICATION_PRESCRIPTION_READY   = "prescription_ready"
+	NOTIFICATION_SECURITY_ALERT       = "security_alert"
+	NOTIFICATION_REPORT               = "report"
+	// Interpreter requests and cancellations sent to the external agency
+	NOTIFICATION_INTERPRETER_REQUEST      = "interpreter_request"
+	NOTIFICATION_INTERPRETER_CANCELLATION = "interpreter_cancellation"
+)
+
+// Notification is a queued email, SMS or webhook message. The worker sends
+// it once NextAttemptAt has passed, retrying failures with backoff until
+// MaxAttempts is reached.
+type Notification struct {
+	NotificationID int        `json:"id"`
+	Kind           string     `json:"kind"`
+	Channel        string     `json:"channel"`
+	Recipient      string     `json:"recipient"`
+	Subject        string     `json:"subject,omitempty"`
+	Body           string     `json:"body"`
+	EntityType     string     `json:"entityType,omitempty"`
+	EntityID       int        `json:"entityId,omitempty"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	SentAt         *time.Time `json:"sentAt,omitempty"`
+}
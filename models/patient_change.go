@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PatientChange is one demographic field of a patient changed by an edit
+// or a merge. Clinical fields, kept encrypted, and allergies, which have
+// their own history, aren't tracked.
+type PatientChange struct {
+	ChangeID  int `json:"id"`
+	PatientID int `json:"patientId"`
+	// Field is the changed field's JSON name, e.g. dateOfBirth
+	Field     string    `json:"field"`
+	OldValue  string    `json:"oldValue"`
+	NewValue  string    `json:"newValue"`
+	ChangedBy StaffRef  `json:"changedBy"`
+	ChangedAt time.Time `json:"changedAt"`
+}
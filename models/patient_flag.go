@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Built-in flag types, seeded by the migration. Admins can add more.
+const (
+	FLAG_FALL_RISK          = "fall_risk"
+	FLAG_VIOLENCE_RISK      = "violence_risk"
+	FLAG_SAFEGUARDING       = "safeguarding"
+	FLAG_INTERPRETER_NEEDED = "interpreter_needed"
+)
+
+// PatientFlagType is a kind of flag that can be raised on a patient. Only
+// the roles in VisibleRoles (and admins) can see, raise or remove it.
+type PatientFlagType struct {
+	Code         string   `json:"code" validate:"required,max=50"`
+	Label        string   `json:"label" validate:"required,max=100"`
+	Description  string   `json:"description,omitempty" validate:"max=500"`
+	VisibleRoles []string `json:"visibleRoles" validate:"required,min=1,dive,role"`
+	Active       bool     `json:"active"`
+}
+
+// VisibleTo reports whether a user with role may see flags of this type
+func (t *PatientFlagType) VisibleTo(role string) bool {
+	if role == ROLE_ADMIN {
+		return true
+	}
+	for _, visible := range t.VisibleRoles {
+		if visible == role {
+			return true
+		}
+	}
+	return false
+}
+
+// PatientFlag is a risk or care flag raised on a patient. A removed flag is
+// kept for the record with who removed it and why.
+type PatientFlag struct {
+	FlagID        int        `json:"id"`
+	PatientID     int        `json:"patientId"`
+	Type          string     `json:"type" validate:"required"`
+	Label         string     `json:"label"`
+	Note          string     `json:"note,omitempty" validate:"max=1000"`
+	AddedBy       int        `json:"addedBy"`
+	AddedAt       time.Time  `json:"addedAt"`
+	RemovedBy     *int       `json:"removedBy,omitempty"`
+	RemovedAt     *time.Time `json:"removedAt,omitempty"`
+	RemovalReason string     `json:"removalReason,omitempty"`
+}
+
+// PatientSummary is the at-a-glance view of a patient. Flags always holds
+// every active flag the caller's role may see.
+type PatientSummary struct {
+	Patient *Patient      `json:"patient"`
+	Flags   []PatientFlag `json:"flags"`
+}
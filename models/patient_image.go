@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Kinds of PatientImage; a patient has at most one of each
+const (
+	PATIENT_IMAGE_PHOTO       = "photo"
+	PATIENT_IMAGE_ID_DOCUMENT = "id_document"
+)
+
+// PatientImage is a patient's photo or a scan of their ID document, shown
+// at check-in to confirm who the patient is. The image and a JPEG thumbnail
+// of it live in the document store.
+type PatientImage struct {
+	PatientID    int       `json:"patientId"`
+	Kind         string    `json:"kind"`
+	ContentType  string    `json:"contentType"`
+	SizeBytes    int64     `json:"sizeBytes"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	SHA256       string    `json:"sha256"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	UploadedBy   int       `json:"uploadedBy"`
+	UploadedAt   time.Time `json:"uploadedAt"`
+}
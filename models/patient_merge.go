@@ -0,0 +1,37 @@
+package models
+
+// PatientMerge reports what merging a duplicate patient into a primary one
+// moved, or would move in a dry run
+type PatientMerge struct {
+	PrimaryID   int  `json:"primaryId"`
+	DuplicateID int  `json:"duplicateId"`
+	DryRun      bool `json:"dryRun"`
+	// Moved counts the rows re-pointed to the primary patient
+	Moved PatientMergeCounts `json:"moved"`
+	// Kept counts the history left on the duplicate: past appointments,
+	// admissions and the claims billed for them, and policies the primary
+	// also holds
+	Kept PatientMergeCounts `json:"kept"`
+	// MergedFields lists the primary's demographic and clinical fields
+	// filled in or extended from the duplicate
+	MergedFields []string `json:"mergedFields"`
+	// FlagsRetired counts the duplicate's active flags removed because the
+	// primary already has one of the same type
+	FlagsRetired int `json:"flagsRetired"`
+}
+
+// PatientMergeCounts counts rows by kind
+type PatientMergeCounts struct {
+	MedicalRecords    int `json:"medicalRecords"`
+	LabOrders         int `json:"labOrders"`
+	Documents         int `json:"documents"`
+	Prescriptions     int `json:"prescriptions"`
+	Appointments      int `json:"appointments"`
+	Admissions        int `json:"admissions"`
+	Flags             int `json:"flags"`
+	Allergies         int `json:"allergies"`
+	PreAuthRequests   int `json:"preAuthRequests"`
+	Claims            int `json:"claims"`
+	InsurancePolicies int `json:"insurancePolicies"`
+	PatientImages     int `json:"patientImages"`
+}
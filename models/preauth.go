@@ -0,0 +1,94 @@
+package models
+
+import "time"
+
+const (
+	PREAUTH_ITEM_PROCEDURE  = "procedure"
+	PREAUTH_ITEM_MEDICATION = "medication"
+)
+
+const (
+	// PREAUTH_STATUS_PENDING requests haven't been sent to the payer yet
+	PREAUTH_STATUS_PENDING = "pending"
+	// PREAUTH_STATUS_SUBMITTED requests are awaiting the payer's decision
+	PREAUTH_STATUS_SUBMITTED = "submitted"
+	PREAUTH_STATUS_APPROVED  = "approved"
+	PREAUTH_STATUS_DENIED    = "denied"
+)
+
+const (
+	CLAIM_STATUS_DRAFT     = "draft"
+	CLAIM_STATUS_SUBMITTED = "submitted"
+)
+
+// PreAuthRequirement flags a procedure or medication that needs the payer's
+// approval before it can be billed. An empty Payer applies to every payer.
+type PreAuthRequirement struct {
+	RequirementID int       `json:"id"`
+	ItemType      string    `json:"itemType" validate:"required,oneof=procedure medication"`
+	Code          string    `json:"code" validate:"required,max=100"`
+	Payer         string    `json:"payer" validate:"max=100"`
+	Description   string    `json:"description" validate:"max=500"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// PreAuthRequest asks a payer to approve a procedure or medication for a patient
+type PreAuthRequest struct {
+	PreAuthID           int        `json:"id"`
+	PatientID           int        `json:"patientId" validate:"required,gt=0"`
+	ItemType            string     `json:"itemType" validate:"required,oneof=procedure medication"`
+	Code                string     `json:"code" validate:"required,max=100"`
+	Payer               string     `json:"payer" validate:"required,max=100"`
+	Justification       string     `json:"justification" validate:"required,max=5000"`
+	Status              string     `json:"status"`
+	AuthorizationNumber string     `json:"authorizationNumber,omitempty"`
+	PayerReference      string     `json:"payerReference,omitempty"`
+	RequestedBy         int        `json:"requestedBy"`
+	RequestedAt         time.Time  `json:"requestedAt"`
+	SubmittedAt         *time.Time `json:"submittedAt,omitempty"`
+	DecidedBy           *int       `json:"decidedBy,omitempty"`
+	DecidedAt           *time.Time `json:"decidedAt,omitempty"`
+	DecisionNotes       string     `json:"decisionNotes,omitempty"`
+}
+
+// PreAuthDecision records the payer's answer, e.g. one received by phone
+type PreAuthDecision struct {
+	Status              string `json:"status" validate:"required,oneof=approved denied"`
+	AuthorizationNumber string `json:"authorizationNumber" validate:"required_if=Status approved,max=100"`
+	Notes               string `json:"notes" validate:"max=2000"`
+}
+
+// Claim bills a payer for a patient's items
+type Claim struct {
+	ClaimID     int         `json:"id"`
+	PatientID   int         `json:"patientId" validate:"required,gt=0"`
+	Payer       string      `json:"payer" validate:"required,max=100"`
+	Status      string      `json:"status"`
+	Items       []ClaimItem `json:"items" validate:"required,min=1,max=100,dive"`
+	CreatedBy   int         `json:"createdBy"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	SubmittedBy *int        `json:"submittedBy,omitempty"`
+	SubmittedAt *time.Time  `json:"submittedAt,omitempty"`
+	// EncounterType and EncounterID name the visit or stay being billed;
+	// encounters of types that require coding block submission until coded
+	EncounterType string `json:"encounterType,omitempty" validate:"required_with=EncounterID,omitempty,oneof=outpatient inpatient"`
+	EncounterID   int    `json:"encounterId,omitempty" validate:"required_with=EncounterType,omitempty,gt=0"`
+	// PolicyID is the patient's insurance policy with the payer; when
+	// omitted, their verified policy valid today is linked, if any
+	PolicyID *int `json:"policyId,omitempty" validate:"omitempty,gt=0"`
+	// Coverage splits the claim's total under its policy
+	Coverage *ClaimCoverage `json:"coverage,omitempty"`
+}
+
+// ClaimItem is one billed procedure or medication. PreAuthID links the
+// approval it was billed under; when omitted, the patient's latest approved
+// request for the same item and payer is linked.
+type ClaimItem struct {
+	ItemID          int    `json:"id"`
+	ItemType        string `json:"itemType" validate:"required,oneof=procedure medication"`
+	Code            string `json:"code" validate:"required,max=100"`
+	Description     string `json:"description" validate:"max=500"`
+	AmountCents     int    `json:"amountCents" validate:"gte=0"`
+	PreAuthID       *int   `json:"preAuthId,omitempty" validate:"omitempty,gt=0"`
+	PreAuthRequired bool   `json:"preAuthRequired"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	PROBE_STATUS_OK     = "ok"
+	PROBE_STATUS_FAILED = "failed"
+)
+
+// ProbeResult reports a synthetic transaction run for an uptime monitor
+type ProbeResult struct {
+	Status     string      `json:"status"`
+	CheckedAt  time.Time   `json:"checkedAt"`
+	DurationMs float64     `json:"durationMs"`
+	Steps      []ProbeStep `json:"steps"`
+}
+
+// ProbeStep is one timed step of a probe. Steps after a failed one don't run.
+type ProbeStep struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
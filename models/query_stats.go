@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+	QUERY_STATS_SORT_TOTAL = "total"
+	QUERY_STATS_SORT_MEAN  = "mean"
+	QUERY_STATS_SORT_MAX   = "max"
+	QUERY_STATS_SORT_CALLS = "calls"
+)
+
+// QueryStats aggregates the database statements run since Since, when the
+// server started or the stats were last reset
+type QueryStats struct {
+	Since time.Time `json:"since"`
+	// SlowThresholdMs is the duration above which a statement is logged as
+	// slow; 0 when slow statements aren't logged
+	SlowThresholdMs float64 `json:"slowThresholdMs"`
+	// Dropped counts the runs of statements not tracked because the
+	// maximum number of distinct statements was reached
+	Dropped    int64       `json:"dropped"`
+	Statements []QueryStat `json:"statements"`
+}
+
+// QueryStat aggregates the runs of one statement. Statements carry only
+// placeholders, so they hold no patient data.
+type QueryStat struct {
+	Statement string  `json:"statement"`
+	Calls     int64   `json:"calls"`
+	Errors    int64   `json:"errors"`
+	SlowCalls int64   `json:"slowCalls"`
+	Rows      int64   `json:"rows"`
+	TotalMs   float64 `json:"totalMs"`
+	MeanMs    float64 `json:"meanMs"`
+	MaxMs     float64 `json:"maxMs"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import "time"
+
+const (
+	QUEUE_STATUS_WAITING   = "waiting"
+	QUEUE_STATUS_CALLED    = "called"
+	QUEUE_STATUS_COMPLETED = "completed"
+	// QUEUE_STATUS_LEFT is a patient who left, or didn't answer, before being seen
+	QUEUE_STATUS_LEFT = "left"
+)
+
+const (
+	QUEUE_PRIORITY_NORMAL = "normal"
+	QUEUE_PRIORITY_URGENT = "urgent"
+)
+
+// QueueEntry is a walk-in patient checked in to a department's queue.
+// Tickets are numbered from 1 each facility-local day in each department.
+type QueueEntry struct {
+	EntryID     int    `json:"id"`
+	Department  string `json:"department"`
+	Ticket      string `json:"ticket"`
+	PatientID   int    `json:"patientId"`
+	PatientName string `json:"patientName"`
+	Priority    string `json:"priority"`
+	Reason      string `json:"reason,omitempty"`
+	Status      string `json:"status"`
+	// Position is the place in the queue of a waiting patient, from 1
+	Position int `json:"position,omitempty"`
+	// EstimatedWaitMinutes is how long a waiting patient should expect to
+	// wait from now to be called
+	EstimatedWaitMinutes *int       `json:"estimatedWaitMinutes,omitempty"`
+	Room                 string     `json:"room,omitempty"`
+	CheckedInAt          time.Time  `json:"checkedInAt"`
+	CheckedInBy          int        `json:"checkedInBy"`
+	CalledAt             *time.Time `json:"calledAt,omitempty"`
+	CalledBy             *int       `json:"calledBy,omitempty"`
+	FinishedAt           *time.Time `json:"finishedAt,omitempty"`
+}
+
+// QueueCheckIn checks a walk-in patient in to a department's queue
+type QueueCheckIn struct {
+	PatientID int    `json:"patientId" validate:"required,gt=0"`
+	Priority  string `json:"priority" validate:"omitempty,oneof=normal urgent"`
+	Reason    string `json:"reason" validate:"max=500"`
+}
+
+// QueueCall calls the next waiting patient to a room
+type QueueCall struct {
+	Room string `json:"room" validate:"max=50"`
+}
+
+// Queue is a department's current queue for staff: the patients called
+// and being seen, then those waiting in the order they will be called
+type Queue struct {
+	Department string       `json:"department"`
+	Name       string       `json:"name"`
+	Called     []QueueEntry `json:"called"`
+	Waiting    []QueueEntry `json:"waiting"`
+	// AvgServiceMinutes is the recent time from being called to finished
+	// that wait estimates are based on
+	AvgServiceMinutes int       `json:"avgServiceMinutes"`
+	GeneratedAt       time.Time `json:"generatedAt"`
+}
+
+// QueueBoard is a department's queue for a waiting-room display. It shows
+// ticket numbers only, never who holds them.
+type QueueBoard struct {
+	Department  string             `json:"department"`
+	Name        string             `json:"name"`
+	NowServing  []QueueBoardTicket `json:"nowServing"`
+	Waiting     []QueueBoardTicket `json:"waiting"`
+	GeneratedAt time.Time          `json:"generatedAt"`
+}
+
+// QueueBoardTicket is one ticket on a queue display
+type QueueBoardTicket struct {
+	Ticket               string `json:"ticket"`
+	Room                 string `json:"room,omitempty"`
+	EstimatedWaitMinutes *int   `json:"estimatedWaitMinutes,omitempty"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// Built-in record templates, seeded by the migration. Admins can add more.
+const (
+	TEMPLATE_ANNUAL_PHYSICAL   = "annual_physical"
+	TEMPLATE_POST_OP_FOLLOW_UP = "post_op_follow_up"
+)
+
+// RecordTemplate is a kind of visit, e.g. an annual physical, whose record
+// is written as the template's sections. Retired templates keep the records
+// written from them but can't be used for new ones.
+type RecordTemplate struct {
+	Code        string            `json:"code" validate:"required,max=50"`
+	Name        string            `json:"name" validate:"required,max=100"`
+	Description string            `json:"description,omitempty" validate:"max=500"`
+	Sections    []TemplateSection `json:"sections" validate:"required,min=1,max=30,dive"`
+	Active      bool              `json:"active"`
+}
+
+// TemplateSection is one heading of a record template. Hint tells the
+// doctor what the section is for.
+type TemplateSection struct {
+	Key      string `json:"key" validate:"required,max=50"`
+	Title    string `json:"title" validate:"required,max=100"`
+	Hint     string `json:"hint,omitempty" validate:"max=500"`
+	Required bool   `json:"required"`
+}
+
+// RecordSection is the content a medical record gives for one of its
+// template's sections. Title is copied from the template when the record is
+// written, so renaming a section later doesn't change past records.
+type RecordSection struct {
+	Key     string `json:"key" validate:"required,max=50"`
+	Title   string `json:"title"`
+	Content string `json:"content" validate:"max=5000"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+const (
+	REFERRAL_URGENCY_ROUTINE   = "routine"
+	REFERRAL_URGENCY_URGENT    = "urgent"
+	REFERRAL_URGENCY_EMERGENCY = "emergency"
+)
+
+const (
+	REFERRAL_STATUS_PENDING  = "pending"
+	REFERRAL_STATUS_ACCEPTED = "accepted"
+	REFERRAL_STATUS_DECLINED = "declined"
+)
+
+// Directions of a doctor's referrals
+const (
+	// REFERRAL_DIRECTION_INBOUND referrals are to the doctor or to a
+	// department they practise in
+	REFERRAL_DIRECTION_INBOUND = "inbound"
+	// REFERRAL_DIRECTION_OUTBOUND referrals are from the doctor
+	REFERRAL_DIRECTION_OUTBOUND = "outbound"
+)
+
+// Referral hands a patient from one doctor to another, either a named
+// doctor or any doctor of a department (specialty). A department referral
+// is addressed to whoever accepts it.
+type Referral struct {
+	ReferralID     int    `json:"id"`
+	PatientID      int    `json:"patientId" validate:"required,gt=0"`
+	FromDoctorID   int    `json:"fromDoctorId"`
+	FromDoctorName string `json:"fromDoctorName,omitempty"`
+	ToDoctorID     *int   `json:"toDoctorId,omitempty" validate:"required_without=Specialty,omitempty,gt=0"`
+	ToDoctorName   string `json:"toDoctorName,omitempty"`
+	// Specialty is the department referred to; with a named doctor it is
+	// informational
+	Specialty     string     `json:"specialty,omitempty" validate:"max=100"`
+	Reason        string     `json:"reason" validate:"required,max=2000"`
+	Urgency       string     `json:"urgency" validate:"required,oneof=routine urgent emergency"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	DecidedAt     *time.Time `json:"decidedAt,omitempty"`
+	DecisionNotes string     `json:"decisionNotes,omitempty"`
+	// AppointmentID is the appointment booked on accepting, if any
+	AppointmentID *int `json:"appointmentId,omitempty"`
+}
+
+// ReferralDecision is the receiving doctor's answer to a referral. Accepting
+// with an appointment books the patient in with them.
+type ReferralDecision struct {
+	Status      string               `json:"status" validate:"required,oneof=accepted declined"`
+	Notes       string               `json:"notes" validate:"required_if=Status declined,max=2000"`
+	Appointment *ReferralAppointment `json:"appointment,omitempty" validate:"excluded_unless=Status accepted"`
+}
+
+// ReferralAppointment is when to see a referred patient
+type ReferralAppointment struct {
+	StartsAt time.Time `json:"startsAt" validate:"required"`
+	EndsAt   time.Time `json:"endsAt" validate:"required,gtfield=StartsAt"`
+}
+
+// UnmarshalJSON accepts startsAt and endsAt as RFC 3339 times or as
+// facility-local wall times
+func (a *ReferralAppointment) UnmarshalJSON(data []byte) error {
+	var body struct {
+		StartsAt timezone.Time `json:"startsAt"`
+		EndsAt   timezone.Time `json:"endsAt"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+	a.StartsAt, a.EndsAt = body.StartsAt.Time, body.EndsAt.Time
+	return nil
+}
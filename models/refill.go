@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	// REFILL_SOURCE_PATIENT requests came from the patient, e.g. by phone
+	REFILL_SOURCE_PATIENT = "patient"
+	// REFILL_SOURCE_FRONT_DESK requests were raised by front-desk staff
+	REFILL_SOURCE_FRONT_DESK = "front_desk"
+)
+
+const (
+	REFILL_STATUS_PENDING  = "pending"
+	REFILL_STATUS_APPROVED = "approved"
+	REFILL_STATUS_DENIED   = "denied"
+)
+
+// RefillRequest asks a doctor to renew a prescription. Approving it creates
+// the refill prescription, linked by RefillPrescriptionID.
+type RefillRequest struct {
+	RefillRequestID      int        `json:"id"`
+	PrescriptionID       int        `json:"prescriptionId"`
+	PatientID            int        `json:"patientId"`
+	Medication           string     `json:"medication"`
+	Source               string     `json:"source" validate:"required,oneof=patient front_desk"`
+	Notes                string     `json:"notes" validate:"max=2000"`
+	Status               string     `json:"status"`
+	RequestedBy          int        `json:"requestedBy"`
+	RequestedAt          time.Time  `json:"requestedAt"`
+	DecidedBy            *int       `json:"decidedBy,omitempty"`
+	DecidedAt            *time.Time `json:"decidedAt,omitempty"`
+	DecisionNotes        string     `json:"decisionNotes,omitempty"`
+	RefillPrescriptionID *int       `json:"refillPrescriptionId,omitempty"`
+}
+
+// RefillDecision is a doctor's answer to a refill request
+type RefillDecision struct {
+	Status string `json:"status" validate:"required,oneof=approved denied"`
+	Notes  string `json:"notes" validate:"required_if=Status denied,max=2000"`
+}
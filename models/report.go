@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+const (
+	REPORT_FREQUENCY_DAILY  = "daily"
+	REPORT_FREQUENCY_WEEKLY = "weekly"
+)
+
+// ReportDefinition describes one of the predefined reports and the columns
+// of its rows
+type ReportDefinition struct {
+	Name        string   `json:"name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Columns     []string `json:"columns"`
+}
+
+// Report is a report run over the facility-local dates From to To,
+// inclusive. Each row maps the definition's columns to their values.
+type Report struct {
+	ReportDefinition
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	GeneratedAt time.Time        `json:"generatedAt"`
+	Rows        []map[string]any `json:"rows"`
+}
+
+// ReportSchedule emails a report as CSV to Recipient every day, covering
+// the day before, or every Monday, covering the week before
+type ReportSchedule struct {
+	ScheduleID int        `json:"id"`
+	Report     string     `json:"report" validate:"required"`
+	Frequency  string     `json:"frequency" validate:"required,oneof=daily weekly"`
+	Recipient  string     `json:"recipient" validate:"required,email,max=254"`
+	CreatedBy  int        `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	NextRunAt  time.Time  `json:"nextRunAt"`
+	LastRunAt  *time.Time `json:"lastRunAt,omitempty"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// MonthCount is a count for one calendar month ("2006-01")
+type MonthCount struct {
+	Month string `json:"month"`
+	Count int    `json:"count"`
+}
+
+// DoctorVisits counts the visits (medical records) written by a doctor
+type DoctorVisits struct {
+	DoctorID   int    `json:"doctorId"`
+	DoctorName string `json:"doctorName"`
+	Visits     int    `json:"visits"`
+}
+
+// MedicationCount counts prescriptions of a medication. Names are grouped
+// case-insensitively.
+type MedicationCount struct {
+	Medication    string `json:"medication"`
+	Prescriptions int    `json:"prescriptions"`
+}
+
+// StatsTotals are hospital-wide totals, not limited to the date range
+type StatsTotals struct {
+	Patients          int `json:"patients"`
+	Users             int `json:"users"`
+	CurrentlyAdmitted int `json:"currentlyAdmitted"`
+	ActiveSessions    int `json:"activeSessions"`
+}
+
+// AdminStats feeds the admin dashboard. Everything except Totals covers
+// the dates From to To inclusive.
+type AdminStats struct {
+	From                      string            `json:"from"`
+	To                        string            `json:"to"`
+	Totals                    StatsTotals       `json:"totals"`
+	PatientsRegistered        int               `json:"patientsRegistered"`
+	Visits                    int               `json:"visits"`
+	Prescriptions             int               `json:"prescriptions"`
+	PatientsPerMonth          []MonthCount      `json:"patientsPerMonth"`
+	VisitsPerMonth            []MonthCount      `json:"visitsPerMonth"`
+	VisitsPerDoctor           []DoctorVisits    `json:"visitsPerDoctor"`
+	PrescriptionsByMedication []MedicationCount `json:"prescriptionsByMedication"`
+	GeneratedAt               time.Time         `json:"generatedAt"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Timeline entry types, also accepted by ?types= to filter the timeline
+const (
+	TIMELINE_MEDICAL_RECORD = "medical_record"
+	TIMELINE_PRESCRIPTION   = "prescription"
+	TIMELINE_LAB_RESULT     = "lab_result"
+	TIMELINE_ADMISSION      = "admission"
+)
+
+// TimelineEntry is one item in a patient's timeline. Item holds the record,
+// prescription, resulted lab order or admission as its own endpoint returns it.
+type TimelineEntry struct {
+	Type string `json:"type"`
+	ID   int    `json:"id"`
+	// OccurredAt orders the timeline: visits and prescriptions, which only
+	// have a date, are placed at the start of their facility-local day, lab
+	// orders at their latest result and admissions at admission
+	OccurredAt time.Time `json:"occurredAt"`
+	Item       any       `json:"item"`
+}
+
+// Timeline is one page of a patient's timeline, newest first
+type Timeline struct {
+	PatientID int             `json:"patientId"`
+	Entries   []TimelineEntry `json:"entries"`
+	// Total counts the entries matching the type filter across all pages
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// Visit is a medical record and the prescriptions written at the same
+// visit. They are created together or not at all; the prescriptions are
+// for the record's patient.
+type Visit struct {
+	Record        MedicalRecord  `json:"record"`
+	Prescriptions []Prescription `json:"prescriptions" validate:"max=20,dive"`
+}
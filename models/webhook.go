@@ -0,0 +1,118 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+const (
+	WEBHOOK_PATIENT_CREATED        = "patient.created"
+	WEBHOOK_PATIENT_UPDATED        = "patient.updated"
+	WEBHOOK_PATIENT_ADMITTED       = "patient.admitted"
+	WEBHOOK_PATIENT_DISCHARGED     = "patient.discharged"
+	WEBHOOK_PRESCRIPTION_CREATED   = "prescription.created"
+	WEBHOOK_PRESCRIPTION_DISPENSED = "prescription.dispensed"
+	WEBHOOK_LAB_ORDERED            = "lab.ordered"
+	WEBHOOK_LAB_RESULTED           = "lab.resulted"
+)
+
+const (
+	WEBHOOK_DELIVERY_PENDING   = "pending"
+	WEBHOOK_DELIVERY_SENDING   = "sending"
+	WEBHOOK_DELIVERY_DELIVERED = "delivered"
+	WEBHOOK_DELIVERY_FAILED    = "failed"
+)
+
+// webhookEvents maps the event types webhooks subscribe to onto the
+// clinical events that announce them. A prescription is dispensed when the
+// pharmacy marks it ready.
+var webhookEvents = map[string]string{
+	WEBHOOK_PATIENT_CREATED:        EVENT_PATIENT_CREATED,
+	WEBHOOK_PATIENT_UPDATED:        EVENT_PATIENT_UPDATED,
+	WEBHOOK_PATIENT_ADMITTED:       EVENT_PATIENT_ADMITTED,
+	WEBHOOK_PATIENT_DISCHARGED:     EVENT_PATIENT_DISCHARGED,
+	WEBHOOK_PRESCRIPTION_CREATED:   EVENT_PRESCRIPTION_CREATED,
+	WEBHOOK_PRESCRIPTION_DISPENSED: EVENT_PRESCRIPTION_READY,
+	WEBHOOK_LAB_ORDERED:            EVENT_LAB_ORDERED,
+	WEBHOOK_LAB_RESULTED:           EVENT_LAB_RESULTED,
+}
+
+// WebhookEventTypes lists the event types a webhook can subscribe to
+func WebhookEventTypes() []string {
+	types := make([]string, 0, len(webhookEvents))
+	for eventType := range webhookEvents {
+		types = append(types, eventType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// WebhookEventType returns the webhook event type announcing a clinical
+// event, false if webhooks aren't sent for it
+func WebhookEventType(clinicalEvent string) (string, bool) {
+	for eventType, event := range webhookEvents {
+		if event == clinicalEvent {
+			return eventType, true
+		}
+	}
+	return "", false
+}
+
+// Webhook is an external system's URL that is POSTed the events it
+// subscribes to, signed with its secret
+type Webhook struct {
+	WebhookID  int       `json:"id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"eventTypes"`
+	Active     bool      `json:"active"`
+	CreatedBy  int       `json:"createdBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// WebhookRequest registers a webhook or replaces one's settings
+type WebhookRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+	// URL must be HTTPS, other than for a receiver on this host
+	URL string `json:"url" validate:"required,url,max=2000"`
+	// Secret signs each delivery: X-Hospital-Signature carries
+	// "sha256=<hex HMAC-SHA256 of timestamp.body>", the timestamp being
+	// X-Hospital-Timestamp. It is never returned.
+	Secret     string   `json:"secret" validate:"required,min=16,max=256"`
+	EventTypes []string `json:"eventTypes" validate:"required,min=1,dive,oneof=patient.created patient.updated patient.admitted patient.discharged prescription.created prescription.dispensed lab.ordered lab.resulted"`
+	// Active defaults to true; an inactive webhook is sent nothing, and
+	// events from while it was inactive are not sent when it is reactivated
+	Active *bool `json:"active"`
+}
+
+// WebhookDelivery is one event's delivery to a webhook, retried with
+// backoff until it succeeds or runs out of attempts
+type WebhookDelivery struct {
+	DeliveryID     int        `json:"id"`
+	WebhookID      int        `json:"webhookId"`
+	EventID        int        `json:"eventId"`
+	EventType      string     `json:"eventType"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+}
+
+// WebhookPayload is the body POSTed for a delivery. Data is the clinical
+// event's payload: the entity, or its changed fields, after the change.
+// Receivers should use DeliveryID to ignore a delivery retried after they
+// had already accepted it.
+type WebhookPayload struct {
+	DeliveryID int             `json:"deliveryId"`
+	EventType  string          `json:"eventType"`
+	EventID    int             `json:"eventId"`
+	EntityType string          `json:"entityType"`
+	EntityID   int             `json:"entityId"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
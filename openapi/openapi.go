@@ -0,0 +1,314 @@
+// Package openapi generates the OpenAPI 3 document for the API. The paths
+// and methods come from walking the router, so every registered route is
+// listed; summaries, roles and request/response bodies come from the
+// annotations registered with Describe. Schemas are reflected from the Go
+// types, including the validate tags.
+package openapi
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/response"
+)
+
+// Param documents a query parameter
+type Param struct {
+	Name        string
+	Type        string // "string" (default), "integer" or "boolean"
+	Description string
+}
+
+// Operation annotates one route
+type Operation struct {
+	Summary     string
+	Description string
+	Tag         string
+	// Roles allowed besides admin; empty means any authenticated user
+	Roles []string
+	// Public operations need no credentials
+	Public bool
+	Query  []Param
+	// Body and Response are example values whose types describe the
+	// request and success response bodies; nil means none
+	Body     any
+	Response any
+	// BodyType is the request content type, application/json if unset. Use
+	// multipart/form-data with a Body struct that has File fields for uploads.
+	BodyType string
+	// Status is the success status, 200 if unset
+	Status int
+}
+
+// Spec collects annotations and builds the document from a router
+type Spec struct {
+	title   string
+	version string
+
+	mu         sync.Mutex
+	operations map[string]Operation
+
+	once     sync.Once
+	document map[string]any
+	err      error
+}
+
+func New(title, version string) *Spec {
+	return &Spec{title: title, version: version, operations: map[string]Operation{}}
+}
+
+// Describe annotates the route registered for method and path template,
+// e.g. Describe("GET", "/api/patients/{id}", Operation{...})
+func (s *Spec) Describe(method, path string, op Operation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[strings.ToUpper(method)+" "+path] = op
+}
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]+)?\}`)
+
+// Build walks the router and returns the OpenAPI document
+func (s *Spec) Build(router *mux.Router) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	components := &schemas{components: map[string]any{}}
+	errorSchema := components.of(response.ErrorEnvelope{})
+	paths := map[string]map[string]any{}
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouter prefixes carry no methods of their own
+			return nil
+		}
+
+		path := pathParam.ReplaceAllString(template, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		for _, method := range methods {
+			op := s.operations[method+" "+path]
+			paths[path][strings.ToLower(method)] = s.operation(components, errorSchema, method, path, op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   s.title,
+			"version": s.version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": components.components,
+			"securitySchemes": map[string]any{
+				"basicAuth": map[string]any{"type": "http", "scheme": "basic"},
+				"session":   map[string]any{"type": "apiKey", "in": "header", "name": "X-2FA-Session-ID"},
+				"sessionCookie": map[string]any{"type": "apiKey", "in": "cookie", "name": "hms_session",
+					"description": "Set by logging in with X-Session-Mode: cookie. State-changing requests must send the session's X-CSRF-Token."},
+				"apiKey": map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key",
+					"description": "For machine integrations. Issued by an admin with scopes; only the routes the scopes cover can be called."},
+			},
+		},
+		"security": []any{
+			map[string]any{"basicAuth": []string{}},
+			map[string]any{"session": []string{}},
+			map[string]any{"sessionCookie": []string{}},
+			map[string]any{"apiKey": []string{}},
+		},
+	}, nil
+}
+
+func (s *Spec) operation(components *schemas, errorSchema map[string]any, method, path string, op Operation) map[string]any {
+	operation := map[string]any{
+		"operationId": operationID(method, path),
+	}
+	if op.Summary != "" {
+		operation["summary"] = op.Summary
+	}
+	description := op.Description
+	if len(op.Roles) > 0 {
+		description = strings.TrimSpace(description + "\n\nRoles: Admin, " + strings.Join(op.Roles, ", "))
+	}
+	// x-roles lets generated clients check roles; absent means any authenticated user
+	switch {
+	case op.Public:
+	case len(op.Roles) > 0:
+		operation["x-roles"] = append([]string{"Admin"}, op.Roles...)
+	case strings.HasPrefix(path, "/api/admin/"):
+		operation["x-roles"] = []string{"Admin"}
+	}
+	if description != "" {
+		operation["description"] = description
+	}
+	tag := op.Tag
+	if tag == "" {
+		tag = defaultTag(path)
+	}
+	operation["tags"] = []string{tag}
+	if op.Public {
+		operation["security"] = []any{}
+	}
+
+	var parameters []any
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		parameters = append(parameters, map[string]any{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": paramType(match[1])},
+		})
+	}
+	for _, param := range op.Query {
+		paramType := param.Type
+		if paramType == "" {
+			paramType = "string"
+		}
+		query := map[string]any{"name": param.Name, "in": "query", "schema": map[string]any{"type": paramType}}
+		if param.Description != "" {
+			query["description"] = param.Description
+		}
+		parameters = append(parameters, query)
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if op.Body != nil {
+		bodyType := op.BodyType
+		if bodyType == "" {
+			bodyType = "application/json"
+		}
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				bodyType: map[string]any{"schema": components.of(op.Body)},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = map[string]any{
+			"application/json": map[string]any{"schema": components.of(op.Response)},
+		}
+	}
+	errorResponse := map[string]any{
+		"description": "Error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": errorSchema},
+		},
+	}
+	operation["responses"] = map[string]any{
+		fmt.Sprint(status): success,
+		"default":          errorResponse,
+	}
+
+	return operation
+}
+
+// Handler serves the document as JSON. It is built on the first request,
+// once every route has been registered.
+func (s *Spec) Handler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.once.Do(func() {
+			s.document, s.err = s.Build(router)
+		})
+		if s.err != nil {
+			response.WriteError(w, http.StatusInternalServerError, s.err.Error())
+			return
+		}
+		response.WriteJSON(w, http.StatusOK, s.document)
+	}
+}
+
+// SwaggerUI serves a Swagger UI page that loads the document from specURL.
+// The page replaces the API's Content-Security-Policy with one letting it
+// load Swagger UI from unpkg and run its one inline script.
+func SwaggerUI(specURL string) http.HandlerFunc {
+	script := fmt.Sprintf(swaggerScript, specURL)
+	page := fmt.Sprintf(swaggerPage, script)
+	sum := sha256.Sum256([]byte(script))
+	policy := "default-src 'none'; script-src https://unpkg.com 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'; " +
+		"style-src https://unpkg.com 'unsafe-inline'; img-src 'self' data: https://unpkg.com; connect-src 'self'; " +
+		"frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", policy)
+		w.Write([]byte(page))
+	}
+}
+
+const swaggerScript = `
+    window.onload = () => { window.ui = SwaggerUIBundle({ url: %q, dom_id: "#swagger-ui" }); };
+  `
+
+const swaggerPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Hospital Management System API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>%s</script>
+</body>
+</html>
+`
+
+// operationID derives a stable identifier, e.g. GET /api/patients/{id} -> getPatientsById
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/api"), "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "{") {
+			b.WriteString("By")
+			segment = strings.Trim(segment, "{}")
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// defaultTag groups unannotated routes by their first path segment after /api
+func defaultTag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/api/"), "/")
+	if len(segments) == 0 || segments[0] == "" {
+		return "misc"
+	}
+	return strings.TrimPrefix(segments[0], "/")
+}
+
+// paramType treats id, patientId and similar path parameters as integers
+func paramType(name string) string {
+	if name == "id" || strings.HasSuffix(name, "Id") || strings.HasSuffix(name, "ID") {
+		return "integer"
+	}
+	return "string"
+}
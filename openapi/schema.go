@@ -0,0 +1,178 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	fileType = reflect.TypeOf(File{})
+)
+
+// File is a file part of a multipart/form-data body
+type File []byte
+
+// schemas turns Go types into JSON schemas, collecting named structs under
+// components/schemas so they are emitted once and referenced by $ref
+type schemas struct {
+	components map[string]any
+}
+
+// of returns the schema for the type of v
+func (s *schemas) of(v any) map[string]any {
+	return s.forType(reflect.TypeOf(v))
+}
+
+func (s *schemas) forType(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == fileType:
+		return map[string]any{"type": "string", "format": "binary"}
+	case t.Kind() == reflect.Pointer:
+		schema := s.forType(t.Elem())
+		schema["nullable"] = true
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": s.forType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.forType(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s.components[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			s.components[t.Name()] = map[string]any{}
+			s.components[t.Name()] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object describes a struct's JSON fields, using validate tags for
+// required fields, lengths, bounds and enums
+func (s *schemas) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := s.object(field.Type)
+			for key, value := range embedded["properties"].(map[string]any) {
+				properties[key] = value
+			}
+			if fields, ok := embedded["required"].([]string); ok {
+				required = append(required, fields...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := s.forType(field.Type)
+		if applyValidation(schema, field.Tag.Get("validate")) {
+			required = append(required, name)
+		}
+		properties[name] = schema
+	}
+
+	object := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		object["required"] = required
+	}
+	return object
+}
+
+// applyValidation copies the validator rules that have a schema equivalent
+// onto schema and reports whether the field is required
+func applyValidation(schema map[string]any, tag string) bool {
+	if tag == "" || schema["$ref"] != nil {
+		return strings.Contains(tag, "required")
+	}
+
+	required := false
+	isString := schema["type"] == "string"
+	isNumber := schema["type"] == "integer" || schema["type"] == "number"
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "date", "pastdate":
+			schema["format"] = "date"
+		case "email":
+			schema["format"] = "email"
+		case "oneof":
+			var values []any
+			for _, value := range strings.Fields(param) {
+				values = append(values, value)
+			}
+			schema["enum"] = values
+		case "min", "max", "len", "gt", "gte", "lt", "lte":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			if isString {
+				switch name {
+				case "min":
+					schema["minLength"] = n
+				case "max":
+					schema["maxLength"] = n
+				case "len":
+					schema["minLength"], schema["maxLength"] = n, n
+				}
+				continue
+			}
+			if !isNumber {
+				continue
+			}
+			switch name {
+			case "min", "gte":
+				schema["minimum"] = n
+			case "max", "lte":
+				schema["maximum"] = n
+			case "gt":
+				schema["minimum"], schema["exclusiveMinimum"] = n, true
+			case "lt":
+				schema["maximum"], schema["exclusiveMaximum"] = n, true
+			}
+		}
+	}
+	return required
+}
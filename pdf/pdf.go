@@ -0,0 +1,266 @@
+// Package pdf writes plain text documents as PDF: a title, headings,
+// paragraphs and label/value fields, wrapped onto A4 pages. It uses the
+// standard Helvetica fonts every PDF reader has, so nothing is embedded;
+// characters those fonts can't show are written as "?".
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points, with the margins and type sizes used throughout
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	margin       = 56
+	labelWidth   = 130
+	titleSize    = 16
+	headingSize  = 12
+	bodySize     = 10
+	footerSize   = 8
+	lineSpacing  = 1.4
+	contentWidth = pageWidth - 2*margin
+)
+
+// Document is a PDF being laid out. Each method adds to the end of the
+// text, starting a new page when the current one is full.
+type Document struct {
+	title string
+	pages [][]textLine
+	y     float64
+}
+
+// textLine is one line of text positioned on a page
+type textLine struct {
+	x, y float64
+	size float64
+	bold bool
+	text string
+}
+
+// New starts a document with title as its heading and in each page's footer
+func New(title string) *Document {
+	d := &Document{title: title}
+	d.newPage()
+	d.write(0, contentWidth, titleSize, true, title)
+	d.y -= bodySize
+	return d
+}
+
+// Heading starts a section
+func (d *Document) Heading(text string) {
+	d.y -= bodySize
+	d.reserve(headingSize*lineSpacing + bodySize*lineSpacing)
+	d.write(0, contentWidth, headingSize, true, text)
+}
+
+// Paragraph adds text, wrapped to the page; line breaks in text are kept
+func (d *Document) Paragraph(text string) {
+	d.write(0, contentWidth, bodySize, false, text)
+}
+
+// Field adds a bold label with its value wrapped beside it
+func (d *Document) Field(label, value string) {
+	// The label sits on the value's first line, so that line must fit here
+	d.reserve(bodySize * lineSpacing)
+	page, y := len(d.pages)-1, d.y-bodySize*lineSpacing
+	d.write(labelWidth, contentWidth-labelWidth, bodySize, false, value)
+	label = fit(label, labelWidth-8, bodySize, true)
+	d.pages[page] = append(d.pages[page], textLine{x: margin, y: y, size: bodySize, bold: true, text: label})
+}
+
+// Bytes renders the document, numbering its pages
+func (d *Document) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		// Pages are objects 5, 7, 9, ..., each followed by its content
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		footer := fmt.Sprintf("%s - page %d of %d", d.title, i+1, len(d.pages))
+		page = append(page, textLine{x: margin, y: margin / 2, size: footerSize, text: footer})
+
+		var content strings.Builder
+		for _, line := range page {
+			font := "F1"
+			if line.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, line.size, line.x, line.y, escape(line.text))
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, len(offsets)+2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+	object(fmt.Sprintf("<< /Title (%s) /Producer (simple-hospital) >>", escape(d.title)))
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, len(offsets), xref)
+	return out.Bytes()
+}
+
+// write wraps text into the column at indent from the margin, adding each
+// line below the last
+func (d *Document) write(indent, width, size float64, bold bool, text string) {
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		for _, line := range wrap(paragraph, width, size, bold) {
+			d.reserve(size * lineSpacing)
+			d.y -= size * lineSpacing
+			page := len(d.pages) - 1
+			d.pages[page] = append(d.pages[page], textLine{x: margin + indent, y: d.y, size: size, bold: bold, text: line})
+		}
+	}
+}
+
+// reserve starts a new page unless height still fits above the bottom margin
+func (d *Document) reserve(height float64) {
+	if d.y-height < margin {
+		d.newPage()
+	}
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, nil)
+	d.y = pageHeight - margin
+}
+
+// wrap breaks text into lines no wider than width, splitting words only
+// when one is wider than a line by itself
+func wrap(text string, width, size float64, bold bool) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	line := ""
+	for _, word := range words {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(candidate, size, bold) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		for textWidth(word, size, bold) > width {
+			part := fit(word, width, size, bold)
+			if part == "" {
+				part = string([]rune(word)[:1])
+			}
+			lines = append(lines, part)
+			word = word[len(part):]
+		}
+		line = word
+	}
+	return append(lines, line)
+}
+
+// fit returns the longest prefix of text no wider than width
+func fit(text string, width, size float64, bold bool) string {
+	used := 0.0
+	for i, r := range text {
+		used += runeWidth(r, bold) * size / 1000
+		if used > width {
+			return text[:i]
+		}
+	}
+	return text
+}
+
+func textWidth(text string, size float64, bold bool) float64 {
+	total := 0.0
+	for _, r := range text {
+		total += runeWidth(r, bold)
+	}
+	return total * size / 1000
+}
+
+// runeWidth is the advance of r in thousandths of the type size
+func runeWidth(r rune, bold bool) float64 {
+	widths := &helvetica
+	if bold {
+		widths = &helveticaBold
+	}
+	if r >= ' ' && r <= '~' {
+		return float64(widths[r-' '])
+	}
+	return 556
+}
+
+// escape encodes text in WinAnsiEncoding as the body of a PDF string,
+// writing bytes outside ASCII as octal escapes
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		c, ok := winAnsi[r]
+		switch {
+		case ok:
+		case r >= ' ' && r <= '~', r >= 0xa0 && r <= 0xff:
+			c = byte(r)
+		case r == '\t':
+			c = ' '
+		default:
+			c = '?'
+		}
+
+		switch {
+		case c == '\\' || c == '(' || c == ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c > '~':
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// winAnsi maps the punctuation WinAnsiEncoding places in 0x80-0x9f, where
+// it differs from Latin-1
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// helvetica and helveticaBold are the fonts' advance widths for ' ' to '~',
+// from their Adobe font metrics
+var helvetica = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBold = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,109 @@
+// Package response writes JSON bodies and the standard error envelope:
+//
+//	{"error": {"code": "not_found", "message": "Patient not found", "details": ...}}
+package response
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+)
+
+// Error codes used in the envelope
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeValidationFailed = "validation_failed"
+	CodeInternal         = "internal_error"
+)
+
+// ErrorBody is the contents of the "error" field
+type ErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// ErrorEnvelope is the body of every error response
+type ErrorEnvelope struct {
+	Error ErrorBody `json:"error"`
+}
+
+// WriteJSON writes body as JSON with the given status
+func WriteJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// WriteError writes an error envelope whose code is derived from the status
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteErrorDetails(w, status, CodeForStatus(status), message, nil)
+}
+
+// WriteErrorDetails writes an error envelope with an explicit code and details
+func WriteErrorDetails(w http.ResponseWriter, status int, code, message string, details any) {
+	WriteJSON(w, status, ErrorEnvelope{Error: ErrorBody{Code: code, Message: message, Details: details}})
+}
+
+// WriteServiceError classifies an error returned by a service: missing rows
+// are 404, constraint violations are 409, queries cut off by the request
+// timeout are 503 and anything else is a 500
+func WriteServiceError(w http.ResponseWriter, err error, notFoundMessage string) {
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteError(w, http.StatusNotFound, notFoundMessage)
+		return
+	}
+
+	if database.IsInterrupted(err) {
+		WriteError(w, http.StatusServiceUnavailable, "Database query timed out")
+		return
+	}
+
+	if violation, ok := database.Violation(err); ok {
+		switch violation {
+		case database.ViolationUnique:
+			WriteError(w, http.StatusConflict, "A record with the same unique value already exists")
+		case database.ViolationForeignKey:
+			WriteError(w, http.StatusConflict, "The request conflicts with related records")
+		default:
+			WriteError(w, http.StatusConflict, err.Error())
+		}
+		return
+	}
+
+	log.Printf("Internal error: %v", err)
+	WriteError(w, http.StatusInternalServerError, err.Error())
+}
+
+// CodeForStatus maps an HTTP status to its default error code
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
@@ -0,0 +1,147 @@
+// Package server runs several HTTP listeners together and shuts them all
+// down gracefully when one fails or the process is asked to stop
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Listener describes one address the application serves on
+type Listener struct {
+	Name    string
+	Network string // "tcp" or "unix"
+	Address string
+	Server  *http.Server
+	// TLS serves HTTPS with the certificates in Server.TLSConfig
+	TLS bool
+}
+
+// Manager owns a set of listeners
+type Manager struct {
+	listeners       []Listener
+	shutdownTimeout time.Duration
+}
+
+func NewManager(shutdownTimeout time.Duration) *Manager {
+	return &Manager{shutdownTimeout: shutdownTimeout}
+}
+
+// Add registers a listener; it is bound when Run is called
+func (m *Manager) Add(listener Listener) {
+	m.listeners = append(m.listeners, listener)
+}
+
+type bound struct {
+	Listener
+	ln net.Listener
+}
+
+// Run binds every listener up front, so a port conflict is reported before
+// anything starts serving, then serves until ctx is cancelled, SIGINT/SIGTERM
+// arrives or a listener fails. All servers are then shut down together.
+func (m *Manager) Run(ctx context.Context) error {
+	var listeners []bound
+	for _, listener := range m.listeners {
+		ln, err := listen(listener)
+		if err != nil {
+			for _, b := range listeners {
+				b.ln.Close()
+			}
+			return fmt.Errorf("%s listener on %s: %v", listener.Name, listener.Address, err)
+		}
+		listeners = append(listeners, bound{Listener: listener, ln: ln})
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, len(listeners))
+	for _, b := range listeners {
+		go func(b bound) {
+			slog.Info("Listener started", "name", b.Name, "network", b.Network, "address", b.Address, "tls", b.TLS)
+
+			var err error
+			if b.TLS {
+				err = b.Server.ServeTLS(b.ln, "", "")
+			} else {
+				err = b.Server.Serve(b.ln)
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			} else if err != nil {
+				err = fmt.Errorf("%s listener: %v", b.Name, err)
+			}
+			errs <- err
+		}(b)
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutdown requested")
+	case runErr = <-errs:
+		slog.Error("Listener failed, shutting down", "error", runErr)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+	for _, b := range listeners {
+		if err := b.Server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Graceful shutdown failed", "name", b.Name, "error", err)
+			b.Server.Close()
+		}
+	}
+
+	slog.Info("All listeners stopped")
+	return runErr
+}
+
+func listen(listener Listener) (net.Listener, error) {
+	if listener.Network == "unix" {
+		// Remove a socket left behind by an unclean exit
+		if err := os.Remove(listener.Address); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		ln, err := net.Listen("unix", listener.Address)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(listener.Address, 0660); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	}
+
+	return net.Listen("tcp", listener.Address)
+}
+
+// RedirectToHTTPS redirects plain HTTP requests to the same path on httpsAddr's port
+func RedirectToHTTPS(httpsAddr string) http.Handler {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.Path
+		if len(r.URL.RawQuery) > 0 {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
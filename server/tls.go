@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSOptions configures where the HTTPS certificate comes from and how
+// clients of the mutual-TLS listener are verified
+type TLSOptions struct {
+	// CertFile and KeyFile hold the certificate and key, reloaded on SIGHUP
+	// so they can be rotated without a restart
+	CertFile string
+	KeyFile  string
+	// ACMEHosts, when set, obtains and renews certificates for these
+	// hostnames from an ACME CA (Let's Encrypt by default) instead
+	ACMEHosts []string
+	// ACMECacheDir keeps the ACME account key and certificates across restarts
+	ACMECacheDir string
+	// ACMEEmail is the contact address given to the CA
+	ACMEEmail string
+	// ACMEDirectoryURL overrides the CA, e.g. with Let's Encrypt staging
+	ACMEDirectoryURL string
+	// ClientCAFile holds the CAs that sign the client certificates of
+	// internal integrations; it is reloaded on SIGHUP too
+	ClientCAFile string
+}
+
+// TLSManager serves the certificate for the HTTPS listeners, from files or
+// ACME, and the CA pool the mutual-TLS listener verifies clients against
+type TLSManager struct {
+	opts      TLSOptions
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+	acme      *autocert.Manager
+}
+
+// NewTLSManager loads the certificate files, or sets up ACME when hosts are
+// configured, and the client CA file if any
+func NewTLSManager(opts TLSOptions) (*TLSManager, error) {
+	m := &TLSManager{opts: opts}
+	if len(opts.ACMEHosts) > 0 {
+		m.acme = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(opts.ACMEHosts...),
+			Cache:      autocert.DirCache(opts.ACMECacheDir),
+			Email:      opts.ACMEEmail,
+		}
+		if opts.ACMEDirectoryURL != "" {
+			m.acme.Client = &acme.Client{DirectoryURL: opts.ACMEDirectoryURL}
+		}
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload reads the certificate files and client CA file again. A failed
+// reload keeps serving what was loaded before.
+func (m *TLSManager) Reload() error {
+	if m.acme == nil {
+		cert, err := tls.LoadX509KeyPair(m.opts.CertFile, m.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("loading the TLS certificate: %v", err)
+		}
+		m.cert.Store(&cert)
+	}
+
+	if m.opts.ClientCAFile != "" {
+		data, err := os.ReadFile(m.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("loading the client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return errors.New("the client CA file holds no PEM certificates")
+		}
+		m.clientCAs.Store(pool)
+	}
+	return nil
+}
+
+// ReloadOnSIGHUP reloads the certificates whenever the process receives
+// SIGHUP, until ctx is done
+func (m *TLSManager) ReloadOnSIGHUP(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := m.Reload(); err != nil {
+				slog.Error("TLS reload failed; keeping the previous certificates", "error", err)
+			} else {
+				slog.Info("TLS certificates reloaded")
+			}
+		}
+	}
+}
+
+// MutualTLS reports whether a client CA file is configured
+func (m *TLSManager) MutualTLS() bool {
+	return m.opts.ClientCAFile != ""
+}
+
+// Config returns base with the managed certificate. The base settings, such
+// as the minimum version, apply on top of ACME's.
+func (m *TLSManager) Config(base *tls.Config) *tls.Config {
+	config := base.Clone()
+	if m.acme != nil {
+		config.GetCertificate = m.acme.GetCertificate
+		// TLS-ALPN-01 challenges are answered on the HTTPS port itself
+		config.NextProtos = append(config.NextProtos, "h2", "http/1.1", acme.ALPNProto)
+		return config
+	}
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return m.cert.Load(), nil
+	}
+	return config
+}
+
+// ClientAuthConfig returns Config(base) requiring a client certificate
+// signed by one of the client CAs, as loaded at the time of each handshake
+func (m *TLSManager) ClientAuthConfig(base *tls.Config) *tls.Config {
+	config := m.Config(base)
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		perHandshake := config.Clone()
+		perHandshake.GetConfigForClient = nil
+		perHandshake.ClientCAs = m.clientCAs.Load()
+		return perHandshake, nil
+	}
+	return config
+}
+
+// HTTPHandler answers ACME HTTP-01 challenges on the plain HTTP listener and
+// passes everything else to fallback
+func (m *TLSManager) HTTPHandler(fallback http.Handler) http.Handler {
+	if m.acme == nil {
+		return fallback
+	}
+	return m.acme.HTTPHandler(fallback)
+}
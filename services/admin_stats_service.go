@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// AdminStatsService computes the admin dashboard figures with SQL
+// aggregates. Unlike PublicStatsService the numbers are exact: they are
+// only served to admins.
+type AdminStatsService struct {
+	activeSessions func() int
+}
+
+// NewAdminStatsService reports activeSessions as the live session count
+func NewAdminStatsService(activeSessions func() int) *AdminStatsService {
+	return &AdminStatsService{activeSessions: activeSessions}
+}
+
+// GetStats reports the dates from to to, inclusive, listing the top
+// medications by prescription count
+func (s *AdminStatsService) GetStats(ctx context.Context, from, to time.Time, topMedications int) (*models.AdminStats, error) {
+	db := database.ReadDB(ctx)
+	fromDate, toDate := from.Format("2006-01-02"), to.Format("2006-01-02")
+	// registered_at is a UTC timestamp, so bound it by the start of the
+	// facility-local day after to
+	fromTime, untilTime := from.UTC(), to.AddDate(0, 0, 1).UTC()
+
+	stats := &models.AdminStats{
+		From:        fromDate,
+		To:          toDate,
+		GeneratedAt: time.Now(),
+	}
+
+	totals := `SELECT (SELECT COUNT(*) FROM Patients WHERE NOT synthetic), (SELECT COUNT(*) FROM Users),
+                  (SELECT COUNT(*) FROM Admissions WHERE status = 'admitted')`
+	if err := db.QueryRowContext(ctx, totals).Scan(&stats.Totals.Patients, &stats.Totals.Users, &stats.Totals.CurrentlyAdmitted); err != nil {
+		return nil, err
+	}
+	stats.Totals.ActiveSessions = s.activeSessions()
+
+	var err error
+	stats.PatientsPerMonth, err = registrationsPerMonth(ctx, db, fromTime, untilTime)
+	if err != nil {
+		return nil, err
+	}
+	stats.VisitsPerMonth, err = monthCounts(ctx, db, `SELECT substr(CAST(visit_date AS TEXT), 1, 7), COUNT(*) FROM MedicalRecords
+              WHERE visit_date >= ? AND visit_date <= ? GROUP BY 1 ORDER BY 1`, fromDate, toDate)
+	if err != nil {
+		return nil, err
+	}
+	for _, month := range stats.PatientsPerMonth {
+		stats.PatientsRegistered += month.Count
+	}
+	for _, month := range stats.VisitsPerMonth {
+		stats.Visits += month.Count
+	}
+
+	if stats.VisitsPerDoctor, err = s.visitsPerDoctor(ctx, db, fromDate, toDate); err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM Prescriptions WHERE prescribed_date >= ? AND prescribed_date <= ?`,
+		fromDate, toDate).Scan(&stats.Prescriptions)
+	if err != nil {
+		return nil, err
+	}
+	if stats.PrescriptionsByMedication, err = s.prescriptionsByMedication(ctx, db, fromDate, toDate, topMedications); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (s *AdminStatsService) visitsPerDoctor(ctx context.Context, db *sql.DB, from, to string) ([]models.DoctorVisits, error) {
+	query := `SELECT m.doctor_id, COALESCE(u.full_name, ''), COUNT(*)
+              FROM MedicalRecords m
+              LEFT JOIN Users u ON u.user_id = m.doctor_id
+              WHERE m.visit_date >= ? AND m.visit_date <= ?
+              GROUP BY m.doctor_id, u.full_name
+              ORDER BY COUNT(*) DESC, m.doctor_id`
+	rows, err := db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	doctors := []models.DoctorVisits{}
+	for rows.Next() {
+		var doctor models.DoctorVisits
+		if err := rows.Scan(&doctor.DoctorID, &doctor.DoctorName, &doctor.Visits); err != nil {
+			return nil, err
+		}
+		doctors = append(doctors, doctor)
+	}
+	return doctors, rows.Err()
+}
+
+func (s *AdminStatsService) prescriptionsByMedication(ctx context.Context, db *sql.DB, from, to string, limit int) ([]models.MedicationCount, error) {
+	query := `SELECT MIN(trim(medication)), COUNT(*)
+              FROM Prescriptions
+              WHERE prescribed_date >= ? AND prescribed_date <= ?
+              GROUP BY lower(trim(medication))
+              ORDER BY COUNT(*) DESC, lower(trim(medication))
+              LIMIT ?`
+	rows, err := db.QueryContext(ctx, query, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	medications := []models.MedicationCount{}
+	for rows.Next() {
+		var medication models.MedicationCount
+		if err := rows.Scan(&medication.Medication, &medication.Prescriptions); err != nil {
+			return nil, err
+		}
+		medications = append(medications, medication)
+	}
+	return medications, rows.Err()
+}
+
+// registrationsPerMonth counts patients registered in [from, until) by the
+// facility-local month, which SQL can't tell from a UTC timestamp
+func registrationsPerMonth(ctx context.Context, db *sql.DB, from, until time.Time) ([]models.MonthCount, error) {
+	rows, err := db.QueryContext(ctx, `SELECT registered_at FROM Patients WHERE registered_at >= ? AND registered_at < ? AND NOT synthetic`, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var registeredAt time.Time
+		if err := rows.Scan(&registeredAt); err != nil {
+			return nil, err
+		}
+		counts[timezone.In(registeredAt).Format("2006-01")]++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	months := []models.MonthCount{}
+	for month, count := range counts {
+		months = append(months, models.MonthCount{Month: month, Count: count})
+	}
+	slices.SortFunc(months, func(a, b models.MonthCount) int { return strings.Compare(a.Month, b.Month) })
+	return months, nil
+}
+
+// monthCounts runs a query returning (month, count) rows
+func monthCounts(ctx context.Context, db *sql.DB, query string, args ...any) ([]models.MonthCount, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	months := []models.MonthCount{}
+	for rows.Next() {
+		var month models.MonthCount
+		if err := rows.Scan(&month.Month, &month.Count); err != nil {
+			return nil, err
+		}
+		months = append(months, month)
+	}
+	return months, rows.Err()
+}
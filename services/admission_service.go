@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrBedUnavailable is returned when the requested bed is occupied, out of service
+	// or waiting to be cleaned
+	ErrBedUnavailable = errors.New("bed is occupied, out of service or awaiting cleaning")
+	// ErrAlreadyAdmitted is returned when admitting a patient who has an open admission
+	ErrAlreadyAdmitted = errors.New("patient is already admitted")
+	// ErrAdmissionClosed is returned when transferring or discharging a discharged admission
+	ErrAdmissionClosed = errors.New("admission is already discharged")
+)
+
+// AdmissionService manages wards, beds and inpatient admissions
+type AdmissionService struct {
+	events *EventService
+}
+
+func NewAdmissionService() *AdmissionService {
+	return &AdmissionService{
+		events: NewEventService(),
+	}
+}
+
+func (s *AdmissionService) CreateWard(ctx context.Context, ward *models.Ward) error {
+	result, err := database.GetDB().ExecContext(ctx, `INSERT INTO Wards (name, description) VALUES (?, ?)`, ward.Name, ward.Description)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	ward.WardID = int(id)
+	return nil
+}
+
+// GetWards lists the wards with their beds and who is in them
+func (s *AdmissionService) GetWards(ctx context.Context) ([]models.Ward, error) {
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT ward_id, name, COALESCE(description, '') FROM Wards ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	wards := []models.Ward{}
+	for rows.Next() {
+		var ward models.Ward
+		if err := rows.Scan(&ward.WardID, &ward.Name, &ward.Description); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		wards = append(wards, ward)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range wards {
+		beds, err := s.GetBeds(ctx, wards[i].WardID)
+		if err != nil {
+			return nil, err
+		}
+		wards[i].Beds = beds
+	}
+
+	return wards, nil
+}
+
+// CreateBed adds a bed to a ward
+func (s *AdmissionService) CreateBed(ctx context.Context, bed *models.Bed) error {
+	var exists int
+	if err := database.GetDB().QueryRowContext(ctx, `SELECT 1 FROM Wards WHERE ward_id = ?`, bed.WardID).Scan(&exists); err != nil {
+		return err
+	}
+
+	result, err := database.GetDB().ExecContext(ctx, `INSERT INTO Beds (ward_id, label, out_of_service) VALUES (?, ?, ?)`,
+		bed.WardID, bed.Label, bed.OutOfService)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	bed.BedID = int(id)
+	return nil
+}
+
+// SetBedOutOfService takes a bed out of (or back into) service. Occupied beds
+// can't be taken out of service; transfer the patient first.
+func (s *AdmissionService) SetBedOutOfService(ctx context.Context, bedID int, outOfService bool) error {
+	query := `UPDATE Beds SET out_of_service = ? WHERE bed_id = ?`
+	if outOfService {
+		query += ` AND NOT EXISTS (SELECT 1 FROM Admissions WHERE bed_id = Beds.bed_id AND status = 'admitted')`
+	}
+
+	result, err := database.GetDB().ExecContext(ctx, query, outOfService, bedID)
+	if err != nil {
+		return err
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		var exists int
+		if err := database.GetDB().QueryRowContext(ctx, `SELECT 1 FROM Beds WHERE bed_id = ?`, bedID).Scan(&exists); err != nil {
+			return err
+		}
+		return ErrBedUnavailable
+	}
+	return nil
+}
+
+// GetBeds lists a ward's beds with their current occupant or cleaning status
+func (s *AdmissionService) GetBeds(ctx context.Context, wardID int) ([]models.Bed, error) {
+	query := `SELECT b.bed_id, b.ward_id, b.label, b.out_of_service, a.admission_id, a.patient_id, COALESCE(h.status, '')
+              FROM Beds b
+              LEFT JOIN Admissions a ON a.bed_id = b.bed_id AND a.status = 'admitted'
+              LEFT JOIN HousekeepingTasks h ON h.bed_id = b.bed_id AND h.status <> 'completed'
+              WHERE b.ward_id = ? ORDER BY b.label`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, wardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	beds := []models.Bed{}
+	for rows.Next() {
+		var bed models.Bed
+		if err := rows.Scan(&bed.BedID, &bed.WardID, &bed.Label, &bed.OutOfService, &bed.AdmissionID, &bed.PatientID, &bed.Housekeeping); err != nil {
+			return nil, err
+		}
+		beds = append(beds, bed)
+	}
+
+	return beds, rows.Err()
+}
+
+// Admit admits a patient to a free bed
+func (s *AdmissionService) Admit(ctx context.Context, admission *models.Admission) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, admission.PatientID).Scan(&exists); err != nil {
+			return err
+		}
+
+		var open int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM Admissions WHERE patient_id = ? AND status = 'admitted'`, admission.PatientID).Scan(&open); err != nil {
+			return err
+		}
+		if open > 0 {
+			return ErrAlreadyAdmitted
+		}
+
+		if err := checkBedFree(ctx, tx, admission.BedID); err != nil {
+			return err
+		}
+
+		admission.Status = models.ADMISSION_STATUS_ADMITTED
+		admission.AdmittedAt = time.Now()
+
+		query := `INSERT INTO Admissions (patient_id, bed_id, admitted_by, reason, status, admitted_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, admission.PatientID, admission.BedID, admission.AdmittedBy, admission.Reason,
+			admission.Status, admission.AdmittedAt)
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		admission.AdmissionID = int(id)
+
+		return s.events.Append(ctx, tx, models.ENTITY_ADMISSION, admission.AdmissionID, models.EVENT_PATIENT_ADMITTED, admission)
+	})
+}
+
+// Transfer moves an admitted patient to another free bed
+func (s *AdmissionService) Transfer(ctx context.Context, admissionID, toBedID, userID int, reason string) (*models.BedTransfer, error) {
+	transfer := &models.BedTransfer{
+		AdmissionID:   admissionID,
+		ToBedID:       toBedID,
+		TransferredBy: userID,
+		Reason:        reason,
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		if err := tx.QueryRowContext(ctx, `SELECT bed_id, status FROM Admissions WHERE admission_id = ?`, admissionID).Scan(&transfer.FromBedID, &status); err != nil {
+			return err
+		}
+		if status != models.ADMISSION_STATUS_ADMITTED {
+			return ErrAdmissionClosed
+		}
+
+		if err := checkBedFree(ctx, tx, toBedID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE Admissions SET bed_id = ? WHERE admission_id = ?`, toBedID, admissionID); err != nil {
+			return err
+		}
+
+		transfer.TransferredAt = time.Now()
+		if err := openHousekeepingTask(ctx, tx, transfer.FromBedID, admissionID, models.HOUSEKEEPING_REASON_TRANSFER, transfer.TransferredAt); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO BedTransfers (admission_id, from_bed_id, to_bed_id, transferred_by, reason, transferred_at)
+              VALUES (?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, admissionID, transfer.FromBedID, toBedID, userID, reason, transfer.TransferredAt)
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		transfer.TransferID = int(id)
+
+		payload := map[string]any{"bedId": toBedID, "transfer": transfer}
+		return s.events.Append(ctx, tx, models.ENTITY_ADMISSION, admissionID, models.EVENT_PATIENT_TRANSFERRED, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// Discharge closes an admission with a discharge summary. The bed is queued
+// for cleaning and becomes assignable once housekeeping completes it.
+func (s *AdmissionService) Discharge(ctx context.Context, admissionID, userID int, summary string) (*models.Admission, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var bedID int
+		var status string
+		if err := tx.QueryRowContext(ctx, `SELECT bed_id, status FROM Admissions WHERE admission_id = ?`, admissionID).Scan(&bedID, &status); err != nil {
+			return err
+		}
+		if status != models.ADMISSION_STATUS_ADMITTED {
+			return ErrAdmissionClosed
+		}
+
+		now := time.Now()
+		query := `UPDATE Admissions SET status = ?, discharged_at = ?, discharged_by = ?, discharge_summary = ?
+              WHERE admission_id = ?`
+		if _, err := tx.ExecContext(ctx, query, models.ADMISSION_STATUS_DISCHARGED, now, userID, summary, admissionID); err != nil {
+			return err
+		}
+		if err := openHousekeepingTask(ctx, tx, bedID, admissionID, models.HOUSEKEEPING_REASON_DISCHARGE, now); err != nil {
+			return err
+		}
+
+		payload := map[string]any{
+			"status":           models.ADMISSION_STATUS_DISCHARGED,
+			"dischargedAt":     now,
+			"dischargedBy":     userID,
+			"dischargeSummary": summary,
+		}
+		return s.events.Append(ctx, tx, models.ENTITY_ADMISSION, admissionID, models.EVENT_PATIENT_DISCHARGED, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetAdmission(database.WithPrimaryReads(ctx), admissionID)
+}
+
+// checkBedFree fails with sql.ErrNoRows for an unknown bed and
+// ErrBedUnavailable if it is occupied, out of service or not yet cleaned
+func checkBedFree(ctx context.Context, tx *sql.Tx, bedID int) error {
+	var outOfService bool
+	var occupied, cleaning int
+	query := `SELECT b.out_of_service,
+                  (SELECT COUNT(*) FROM Admissions a WHERE a.bed_id = b.bed_id AND a.status = 'admitted'),
+                  (SELECT COUNT(*) FROM HousekeepingTasks h WHERE h.bed_id = b.bed_id AND h.status <> 'completed')
+              FROM Beds b WHERE b.bed_id = ?`
+	if err := tx.QueryRowContext(ctx, query, bedID).Scan(&outOfService, &occupied, &cleaning); err != nil {
+		return err
+	}
+	if outOfService || occupied > 0 || cleaning > 0 {
+		return ErrBedUnavailable
+	}
+	return nil
+}
+
+// GetAdmission returns an admission with its transfer history
+func (s *AdmissionService) GetAdmission(ctx context.Context, id int) (*models.Admission, error) {
+	admissions, err := s.queryAdmissions(ctx, `WHERE admission_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(admissions) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &admissions[0], nil
+}
+
+// GetAdmissions lists admissions, optionally filtered by status, newest first
+func (s *AdmissionService) GetAdmissions(ctx context.Context, status string) ([]models.Admission, error) {
+	if status == "" {
+		return s.queryAdmissions(ctx, `ORDER BY admitted_at DESC`)
+	}
+	return s.queryAdmissions(ctx, `WHERE status = ? ORDER BY admitted_at DESC`, status)
+}
+
+// GetAdmissionsByPatient lists a patient's admissions, newest first
+func (s *AdmissionService) GetAdmissionsByPatient(ctx context.Context, patientID int) ([]models.Admission, error) {
+	return s.queryAdmissions(ctx, `WHERE patient_id = ? ORDER BY admitted_at DESC`, patientID)
+}
+
+func (s *AdmissionService) queryAdmissions(ctx context.Context, clause string, args ...any) ([]models.Admission, error) {
+	query := `SELECT admission_id, patient_id, bed_id, admitted_by, reason, status, admitted_at,
+              discharged_at, discharged_by, COALESCE(discharge_summary, '')
+              FROM Admissions ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	admissions := []models.Admission{}
+	for rows.Next() {
+		var admission models.Admission
+		if err := rows.Scan(&admission.AdmissionID, &admission.PatientID, &admission.BedID, &admission.AdmittedBy,
+			&admission.Reason, &admission.Status, &admission.AdmittedAt, &admission.DischargedAt,
+			&admission.DischargedBy, &admission.DischargeSummary); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		admissions = append(admissions, admission)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range admissions {
+		transfers, err := s.getTransfers(ctx, admissions[i].AdmissionID)
+		if err != nil {
+			return nil, err
+		}
+		admissions[i].Transfers = transfers
+	}
+
+	return admissions, nil
+}
+
+func (s *AdmissionService) getTransfers(ctx context.Context, admissionID int) ([]models.BedTransfer, error) {
+	query := `SELECT transfer_id, admission_id, from_bed_id, to_bed_id, transferred_by, COALESCE(reason, ''), transferred_at
+              FROM BedTransfers WHERE admission_id = ? ORDER BY transferred_at`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, admissionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []models.BedTransfer
+	for rows.Next() {
+		var transfer models.BedTransfer
+		if err := rows.Scan(&transfer.TransferID, &transfer.AdmissionID, &transfer.FromBedID, &transfer.ToBedID,
+			&transfer.TransferredBy, &transfer.Reason, &transfer.TransferredAt); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, rows.Err()
+}
+
+// GetOccupancy counts occupied, available, awaiting-cleaning and
+// out-of-service beds per ward. It is computed from the live tables on every call.
+func (s *AdmissionService) GetOccupancy(ctx context.Context) (*models.Occupancy, error) {
+	query := `SELECT w.ward_id, w.name,
+                  COUNT(b.bed_id),
+                  COUNT(a.admission_id),
+                  COALESCE(SUM(CASE WHEN b.out_of_service AND a.admission_id IS NULL THEN 1 ELSE 0 END), 0),
+                  COALESCE(SUM(CASE WHEN NOT b.out_of_service AND a.admission_id IS NULL AND h.task_id IS NOT NULL THEN 1 ELSE 0 END), 0)
+              FROM Wards w
+              LEFT JOIN Beds b ON b.ward_id = w.ward_id
+              LEFT JOIN Admissions a ON a.bed_id = b.bed_id AND a.status = 'admitted'
+              LEFT JOIN HousekeepingTasks h ON h.bed_id = b.bed_id AND h.status <> 'completed'
+              GROUP BY w.ward_id, w.name
+              ORDER BY w.name`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occupancy := &models.Occupancy{
+		Wards:       []models.WardOccupancy{},
+		GeneratedAt: time.Now(),
+	}
+	for rows.Next() {
+		var ward models.WardOccupancy
+		if err := rows.Scan(&ward.WardID, &ward.WardName, &ward.TotalBeds, &ward.Occupied, &ward.OutOfService, &ward.Cleaning); err != nil {
+			return nil, err
+		}
+		ward.Available = ward.TotalBeds - ward.Occupied - ward.OutOfService - ward.Cleaning
+		ward.OccupancyRate = occupancyRate(ward.Occupied, ward.TotalBeds-ward.OutOfService)
+		occupancy.Wards = append(occupancy.Wards, ward)
+
+		occupancy.TotalBeds += ward.TotalBeds
+		occupancy.Occupied += ward.Occupied
+		occupancy.Available += ward.Available
+		occupancy.Cleaning += ward.Cleaning
+		occupancy.OutOfService += ward.OutOfService
+	}
+	occupancy.OccupancyRate = occupancyRate(occupancy.Occupied, occupancy.TotalBeds-occupancy.OutOfService)
+
+	return occupancy, rows.Err()
+}
+
+// occupancyRate is the share of in-service beds that are occupied
+func occupancyRate(occupied, inService int) float64 {
+	if inService <= 0 {
+		return 0
+	}
+	return float64(occupied) / float64(inService)
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+)
+
+// ErrAllergyRecorded is returned when recording an active allergy to a substance the patient already has one to
+var ErrAllergyRecorded = errors.New("patient already has an active allergy to this substance")
+
+// AllergyService records patients' allergies. Substances and reactions are
+// encrypted at rest, so duplicates are matched here rather than in SQL, and
+// the audit log records changes without naming the substance.
+type AllergyService struct {
+	audit *AuditService
+}
+
+func NewAllergyService() *AllergyService {
+	return &AllergyService{audit: NewAuditService()}
+}
+
+// GetAllergies lists a patient's active allergies in the order they were
+// recorded, followed by the inactive ones when includeInactive is set
+func (s *AllergyService) GetAllergies(ctx context.Context, patientID int, includeInactive bool) ([]models.Allergy, error) {
+	db := database.ReadDB(ctx)
+	if err := checkPatient(ctx, db, patientID); err != nil {
+		return nil, err
+	}
+
+	clause := `WHERE patient_id = ? AND active ORDER BY recorded_at, allergy_id`
+	if includeInactive {
+		clause = `WHERE patient_id = ? ORDER BY active DESC, recorded_at, allergy_id`
+	}
+	return queryAllergies(ctx, db, clause, patientID)
+}
+
+// AddAllergy records an allergy for allergy.PatientID
+func (s *AllergyService) AddAllergy(ctx context.Context, allergy *models.Allergy, userID int) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkPatient(ctx, tx, allergy.PatientID); err != nil {
+			return err
+		}
+		if err := checkAllergyRecorded(ctx, tx, allergy); err != nil {
+			return err
+		}
+
+		allergy.RecordedBy = &userID
+		if err := insertAllergy(ctx, tx, allergy); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_ALLERGY_ADDED, models.ENTITY_ALLERGY, allergy.AllergyID, allergyAuditDetails(allergy))
+	})
+}
+
+// UpdateAllergy replaces an allergy's details, e.g. to record a reaction or
+// mark it inactive once refuted
+func (s *AllergyService) UpdateAllergy(ctx context.Context, patientID, id int, allergy *models.Allergy, userID int) (*models.Allergy, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		existing, err := queryAllergies(ctx, tx, `WHERE allergy_id = ? AND patient_id = ?`, id, patientID)
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			return sql.ErrNoRows
+		}
+
+		allergy.AllergyID = id
+		allergy.PatientID = patientID
+		if err := checkAllergyRecorded(ctx, tx, allergy); err != nil {
+			return err
+		}
+
+		substance, reaction, err := sealAllergy(allergy)
+		if err != nil {
+			return err
+		}
+		query := `UPDATE Allergies SET substance = ?, reaction = ?, severity = ?, onset_date = ?, active = ?, updated_at = ?
+                  WHERE allergy_id = ?`
+		if _, err := tx.ExecContext(ctx, query, substance, reaction, allergy.Severity, allergy.OnsetDate, allergy.Active,
+			time.Now().UTC(), id); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_ALLERGY_UPDATED, models.ENTITY_ALLERGY, id, allergyAuditDetails(allergy))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := queryAllergies(ctx, database.GetDB(), `WHERE allergy_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(updated) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &updated[0], nil
+}
+
+// DeleteAllergy removes an allergy recorded in error. Allergies that no
+// longer apply should be marked inactive instead, which keeps them on record.
+func (s *AllergyService) DeleteAllergy(ctx context.Context, patientID, id, userID int) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM Allergies WHERE allergy_id = ? AND patient_id = ?`, id, patientID)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return sql.ErrNoRows
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_ALLERGY_DELETED, models.ENTITY_ALLERGY, id, map[string]any{"patientId": patientID})
+	})
+}
+
+// checkAllergyRecorded returns ErrAllergyRecorded if allergy is active and
+// the patient has another active allergy to the same substance
+func checkAllergyRecorded(ctx context.Context, q querier, allergy *models.Allergy) error {
+	if !allergy.Active {
+		return nil
+	}
+	recorded, err := queryAllergies(ctx, q, `WHERE patient_id = ? AND active AND allergy_id <> ?`, allergy.PatientID, allergy.AllergyID)
+	if err != nil {
+		return err
+	}
+	for _, other := range recorded {
+		if strings.EqualFold(strings.TrimSpace(other.Substance), strings.TrimSpace(allergy.Substance)) {
+			return ErrAllergyRecorded
+		}
+	}
+	return nil
+}
+
+// insertAllergy records allergy, setting its ID and recording time
+func insertAllergy(ctx context.Context, tx *sql.Tx, allergy *models.Allergy) error {
+	allergy.RecordedAt = time.Now().UTC()
+	query := `INSERT INTO Allergies (patient_id, substance, reaction, severity, onset_date, active, recorded_by, recorded_at)
+              VALUES (?, '', '', ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, allergy.PatientID, allergy.Severity, allergy.OnsetDate,
+		allergy.Active, allergy.RecordedBy, allergy.RecordedAt)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	allergy.AllergyID = int(id)
+
+	substance, reaction, err := sealAllergy(allergy)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE Allergies SET substance = ?, reaction = ? WHERE allergy_id = ?`, substance, reaction, allergy.AllergyID)
+	return err
+}
+
+// importAllergies records each substance in a free-text allergies list as
+// an active allergy, for patients registered with one, and returns the
+// patient's allergies summary
+func importAllergies(ctx context.Context, tx *sql.Tx, patientID int, allergies string) (string, error) {
+	var substances []string
+	for _, substance := range splitAllergies(allergies) {
+		duplicate := false
+		for _, recorded := range substances {
+			duplicate = duplicate || strings.EqualFold(recorded, substance)
+		}
+		if duplicate {
+			continue
+		}
+		if err := insertAllergy(ctx, tx, &models.Allergy{PatientID: patientID, Substance: substance, Active: true}); err != nil {
+			return "", err
+		}
+		substances = append(substances, substance)
+	}
+	return strings.Join(substances, ", "), nil
+}
+
+// allergySummaries returns the allergies summary of each patient with
+// active allergies: their substances in the order recorded. It covers
+// every patient when patientID is zero.
+func allergySummaries(ctx context.Context, q querier, patientID int) (map[int]string, error) {
+	clause := `WHERE active ORDER BY patient_id, recorded_at, allergy_id`
+	var args []any
+	if patientID != 0 {
+		clause = `WHERE patient_id = ? AND active ORDER BY recorded_at, allergy_id`
+		args = append(args, patientID)
+	}
+	allergies, err := queryAllergies(ctx, q, clause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := map[int]string{}
+	for _, allergy := range allergies {
+		if summary := summaries[allergy.PatientID]; summary != "" {
+			summaries[allergy.PatientID] = summary + ", " + allergy.Substance
+		} else {
+			summaries[allergy.PatientID] = allergy.Substance
+		}
+	}
+	return summaries, nil
+}
+
+func allergyAuditDetails(allergy *models.Allergy) map[string]any {
+	return map[string]any{"patientId": allergy.PatientID, "severity": allergy.Severity, "active": allergy.Active}
+}
+
+// sealAllergy encrypts the allergy's substance and reaction for storage in
+// its row, so allergy.AllergyID must be set
+func sealAllergy(allergy *models.Allergy) (substance, reaction string, err error) {
+	if substance, err = encryption.Seal(encryption.AllergySubstance, allergy.AllergyID, strings.TrimSpace(allergy.Substance)); err != nil {
+		return "", "", err
+	}
+	if reaction, err = encryption.Seal(encryption.AllergyReaction, allergy.AllergyID, allergy.Reaction); err != nil {
+		return "", "", err
+	}
+	return substance, reaction, nil
+}
+
+func queryAllergies(ctx context.Context, q querier, clause string, args ...any) ([]models.Allergy, error) {
+	query := `SELECT allergy_id, patient_id, substance, COALESCE(reaction, ''), severity, COALESCE(onset_date, ''), active,
+                  recorded_by, recorded_at, updated_at
+              FROM Allergies ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allergies := []models.Allergy{}
+	for rows.Next() {
+		var a models.Allergy
+		if err := rows.Scan(&a.AllergyID, &a.PatientID, &a.Substance, &a.Reaction, &a.Severity, &a.OnsetDate, &a.Active,
+			&a.RecordedBy, &a.RecordedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if a.Substance, err = encryption.Open(encryption.AllergySubstance, a.AllergyID, a.Substance); err != nil {
+			return nil, err
+		}
+		if a.Reaction, err = encryption.Open(encryption.AllergyReaction, a.AllergyID, a.Reaction); err != nil {
+			return nil, err
+		}
+		allergies = append(allergies, a)
+	}
+	return allergies, rows.Err()
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+const (
+	// apiKeyPrefixLength is how much of a key is kept in the clear to tell
+	// keys apart: "hak_" and eight hex digits
+	apiKeyPrefixLength = 12
+	// apiKeyUseInterval is how stale a key's last use may get before it is
+	// written again, so a busy analyzer doesn't write on every request
+	apiKeyUseInterval = time.Minute
+)
+
+var (
+	// ErrInvalidAPIKey is returned when authenticating with a key that is
+	// unknown, expired or revoked
+	ErrInvalidAPIKey = errors.New("API key is invalid, expired or revoked")
+	// ErrAPIKeyUser is returned when issuing a key for a user that can't
+	// have one: deactivated, or an admin or patient account
+	ErrAPIKeyUser = errors.New("API keys can only be issued to active staff accounts other than admins")
+	// ErrAPIKeyState is returned when rotating a key that is already
+	// revoked, expired or rotated, or revoking a revoked one
+	ErrAPIKeyState = errors.New("API key is already revoked, expired or rotated")
+	// ErrAPIKeyExpiry is returned when issuing a key that has already expired
+	ErrAPIKeyExpiry = errors.New("API key expiry must be in the future")
+)
+
+// APIKeyService manages the API keys that machine integrations, such as lab
+// analyzers and interface engines, use in place of an interactive login.
+// Each key belongs to a staff user, whose role still applies, and is limited
+// to its scopes' routes. Only a hash of the key is stored.
+type APIKeyService struct {
+	audit *AuditService
+}
+
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{audit: NewAuditService()}
+}
+
+// Issue mints a key for the request's user; the key is only ever returned here
+func (s *APIKeyService) Issue(ctx context.Context, request models.APIKeyRequest, adminID int) (*models.APIKey, error) {
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return nil, ErrAPIKeyExpiry
+	}
+
+	var key *models.APIKey
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var role string
+		var active bool
+		if err := tx.QueryRowContext(ctx, `SELECT role, active FROM Users WHERE user_id = ?`, request.UserID).Scan(&role, &active); err != nil {
+			return err
+		}
+		if !active || role == models.ROLE_ADMIN || role == models.ROLE_PATIENT {
+			return ErrAPIKeyUser
+		}
+
+		scopes := slices.Clone(request.Scopes)
+		slices.Sort(scopes)
+		var err error
+		key, err = s.insert(ctx, tx, request.UserID, request.Name, slices.Compact(scopes), request.ExpiresAt, adminID)
+		if err != nil {
+			return err
+		}
+
+		details := map[string]any{"userId": key.UserID, "name": key.Name, "prefix": key.Prefix, "scopes": key.Scopes}
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_API_KEY_ISSUED, models.ENTITY_API_KEY, key.KeyID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withKey(ctx, key)
+}
+
+// Rotate issues a new key with the same user, name, scopes and expiry as
+// keyID, and retires keyID: at once, or after graceMinutes so the
+// integration can switch over
+func (s *APIKeyService) Rotate(ctx context.Context, keyID, graceMinutes, adminID int) (*models.APIKey, error) {
+	var key *models.APIKey
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		old, err := getAPIKey(ctx, tx, `WHERE k.key_id = ?`, keyID)
+		if err != nil {
+			return err
+		}
+		if old.Status != models.API_KEY_ACTIVE || old.ReplacedBy != nil {
+			return ErrAPIKeyState
+		}
+
+		key, err = s.insert(ctx, tx, old.UserID, old.Name, old.Scopes, old.ExpiresAt, adminID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		if graceMinutes == 0 {
+			_, err = tx.ExecContext(ctx, `UPDATE ApiKeys SET revoked_at = ?, revoked_by = ?, replaced_by = ? WHERE key_id = ?`,
+				now, adminID, key.KeyID, keyID)
+		} else {
+			expiresAt := now.Add(time.Duration(graceMinutes) * time.Minute)
+			if old.ExpiresAt != nil && old.ExpiresAt.Before(expiresAt) {
+				expiresAt = *old.ExpiresAt
+			}
+			_, err = tx.ExecContext(ctx, `UPDATE ApiKeys SET expires_at = ?, replaced_by = ? WHERE key_id = ?`, expiresAt, key.KeyID, keyID)
+		}
+		if err != nil {
+			return err
+		}
+
+		details := map[string]any{"replacedBy": key.KeyID, "prefix": key.Prefix, "graceMinutes": graceMinutes}
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_API_KEY_ROTATED, models.ENTITY_API_KEY, keyID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withKey(ctx, key)
+}
+
+// Revoke stops keyID working at once
+func (s *APIKeyService) Revoke(ctx context.Context, keyID, adminID int) (*models.APIKey, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		key, err := getAPIKey(ctx, tx, `WHERE k.key_id = ?`, keyID)
+		if err != nil {
+			return err
+		}
+		if key.Status == models.API_KEY_REVOKED {
+			return ErrAPIKeyState
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE ApiKeys SET revoked_at = ?, revoked_by = ? WHERE key_id = ?`,
+			time.Now().UTC(), adminID, keyID); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_API_KEY_REVOKED, models.ENTITY_API_KEY, keyID, map[string]any{"prefix": key.Prefix})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetKey(ctx, keyID)
+}
+
+// GetKeys lists keys, newest first, optionally only userID's
+func (s *APIKeyService) GetKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	if userID != 0 {
+		return queryAPIKeys(ctx, database.ReadDB(ctx), `WHERE k.user_id = ? ORDER BY k.key_id DESC`, userID)
+	}
+	return queryAPIKeys(ctx, database.ReadDB(ctx), `ORDER BY k.key_id DESC`)
+}
+
+func (s *APIKeyService) GetKey(ctx context.Context, keyID int) (*models.APIKey, error) {
+	return getAPIKey(ctx, database.ReadDB(ctx), `WHERE k.key_id = ?`, keyID)
+}
+
+// Authenticate returns the active key matching the presented one. Keys of
+// users since made admins or patients no longer work. The caller still
+// checks that the user is active and the route is in the key's scopes.
+func (s *APIKeyService) Authenticate(ctx context.Context, presented string) (*models.APIKey, error) {
+	key, err := getAPIKey(ctx, database.DB, `WHERE k.key_hash = ?`, hashAPIKey(presented))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.Status != models.API_KEY_ACTIVE || key.Role == models.ROLE_ADMIN || key.Role == models.ROLE_PATIENT {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUseInterval {
+		if _, err := database.DB.ExecContext(ctx, `UPDATE ApiKeys SET last_used_at = ? WHERE key_id = ?`, now, key.KeyID); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", key.Prefix, err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// insert stores a new key and returns it with the key itself filled in
+func (s *APIKeyService) insert(ctx context.Context, tx *sql.Tx, userID int, name string, scopes []string, expiresAt *time.Time, adminID int) (*models.APIKey, error) {
+	secret := make([]byte, 28)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := &models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Key:       "hak_" + hex.EncodeToString(secret),
+		Scopes:    scopes,
+		CreatedBy: adminID,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+		Status:    models.API_KEY_ACTIVE,
+	}
+	key.Prefix = key.Key[:apiKeyPrefixLength]
+
+	query := `INSERT INTO ApiKeys (user_id, name, prefix, key_hash, scopes, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, userID, name, key.Prefix, hashAPIKey(key.Key), strings.Join(scopes, ","), adminID, key.CreatedAt, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	key.KeyID = int(id)
+	return key, nil
+}
+
+// withKey reloads key for its user's details, keeping the key itself
+func (s *APIKeyService) withKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	stored, err := s.GetKey(ctx, key.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	stored.Key = key.Key
+	return stored, nil
+}
+
+// getAPIKey returns the first key matching clause, or sql.ErrNoRows
+func getAPIKey(ctx context.Context, q querier, clause string, args ...any) (*models.APIKey, error) {
+	keys, err := queryAPIKeys(ctx, q, clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &keys[0], nil
+}
+
+func queryAPIKeys(ctx context.Context, q querier, clause string, args ...any) ([]models.APIKey, error) {
+	query := `SELECT k.key_id, k.user_id, u.username, u.role, k.name, k.prefix, k.scopes, k.created_by, k.created_at,
+                  k.expires_at, k.last_used_at, k.revoked_at, k.revoked_by, k.replaced_by
+              FROM ApiKeys k
+              JOIN Users u ON u.user_id = k.user_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var scopes string
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+		var revokedBy, replacedBy sql.NullInt64
+		if err := rows.Scan(&k.KeyID, &k.UserID, &k.Username, &k.Role, &k.Name, &k.Prefix, &scopes, &k.CreatedBy, &k.CreatedAt,
+			&expiresAt, &lastUsedAt, &revokedAt, &revokedBy, &replacedBy); err != nil {
+			return nil, err
+		}
+		k.Scopes = strings.Split(scopes, ",")
+		k.CreatedAt = timezone.In(k.CreatedAt)
+		for _, t := range []struct {
+			value sql.NullTime
+			field **time.Time
+		}{{expiresAt, &k.ExpiresAt}, {lastUsedAt, &k.LastUsedAt}, {revokedAt, &k.RevokedAt}} {
+			if t.value.Valid {
+				in := timezone.In(t.value.Time)
+				*t.field = &in
+			}
+		}
+		if revokedBy.Valid {
+			by := int(revokedBy.Int64)
+			k.RevokedBy = &by
+		}
+		if replacedBy.Valid {
+			id := int(replacedBy.Int64)
+			k.ReplacedBy = &id
+		}
+
+		switch {
+		case k.RevokedAt != nil:
+			k.Status = models.API_KEY_REVOKED
+		case k.ExpiresAt != nil && !now.Before(*k.ExpiresAt):
+			k.Status = models.API_KEY_EXPIRED
+		default:
+			k.Status = models.API_KEY_ACTIVE
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
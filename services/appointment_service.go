@@ -0,0 +1,453 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+var (
+	// ErrDoctorBooked is returned when the doctor already has an appointment in the slot
+	ErrDoctorBooked = errors.New("doctor already has an appointment at this time")
+	// ErrNoDoctorAvailable is returned when a booking without a doctor finds nobody eligible
+	ErrNoDoctorAvailable = errors.New("no qualified doctor is on duty and free at this time")
+	// ErrOffDuty is returned when booking a doctor outside their shifts or during their time off
+	ErrOffDuty = errors.New("doctor is not working at this time")
+	// ErrAppointmentClosed is returned when cancelling a cancelled or completed appointment
+	ErrAppointmentClosed = errors.New("appointment is no longer scheduled")
+)
+
+// AppointmentService books consultations and suggests which doctor should
+// take bookings that don't name one
+type AppointmentService struct {
+	notifications *NotificationService
+	interpreters  *InterpreterService
+}
+
+// NewAppointmentService drops the pending reminders of cancelled appointments
+// through notifications and books interpreters for patients who need one.
+// Reminders themselves are queued by ReminderService.
+func NewAppointmentService(notifications *NotificationService, interpreters *InterpreterService) *AppointmentService {
+	return &AppointmentService{notifications: notifications, interpreters: interpreters}
+}
+
+// AppointmentFilter narrows GetAppointments; zero fields are ignored
+type AppointmentFilter struct {
+	DoctorID  int
+	PatientID int
+	// Department selects appointments with the doctors assigned to it
+	Department string
+	From       time.Time
+	To         time.Time
+	Status     string
+}
+
+// Suggest picks the least-loaded doctor who practises specialty (any doctor
+// when it is empty), is rostered on duty for the whole slot and has no time
+// off or other appointment in it. Every doctor considered is listed with the
+// reasons they were or weren't eligible.
+func (s *AppointmentService) Suggest(ctx context.Context, specialty string, start, end time.Time) (*models.AssignmentSuggestion, error) {
+	return suggestDoctor(ctx, database.ReadDB(ctx), specialty, start, end)
+}
+
+// Book books an appointment. Without a doctor the suggested doctor is
+// assigned and the suggestion is returned in Assignment. A named doctor,
+// which is how reception overrides a suggestion, must still be working: on
+// a shift covering the slot, not on time off and without another
+// appointment in it. When the patient needs an interpreter one is booked
+// too and returned in Interpreter.
+func (s *AppointmentService) Book(ctx context.Context, appointment *models.Appointment) error {
+	appointment.StartsAt, appointment.EndsAt = appointment.StartsAt.UTC(), appointment.EndsAt.UTC()
+	appointment.Specialty = normalizeSpecialty(appointment.Specialty)
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var language string
+		var needsInterpreter bool
+		err := tx.QueryRowContext(ctx, `SELECT COALESCE(preferred_language, ''), interpreter_required
+              FROM Patients WHERE patient_id = ?`, appointment.PatientID).Scan(&language, &needsInterpreter)
+		if err != nil {
+			return err
+		}
+
+		if appointment.DoctorID == 0 {
+			suggestion, err := suggestDoctor(ctx, tx, appointment.Specialty, appointment.StartsAt, appointment.EndsAt)
+			if err != nil {
+				return err
+			}
+			if suggestion.Doctor == nil {
+				return ErrNoDoctorAvailable
+			}
+			appointment.DoctorID = suggestion.Doctor.DoctorID
+			appointment.Assignment = suggestion
+		} else {
+			if err := checkDoctor(ctx, tx, appointment.DoctorID); err != nil {
+				return err
+			}
+			if err := checkWorking(ctx, tx, appointment.DoctorID, appointment.StartsAt, appointment.EndsAt); err != nil {
+				return err
+			}
+			conflicts, err := countConflicts(ctx, tx, appointment.DoctorID, appointment.StartsAt, appointment.EndsAt)
+			if err != nil {
+				return err
+			}
+			if conflicts > 0 {
+				return ErrDoctorBooked
+			}
+		}
+
+		appointment.Status = models.APPOINTMENT_STATUS_SCHEDULED
+		appointment.CreatedAt = time.Now()
+
+		query := `INSERT INTO Appointments (patient_id, doctor_id, specialty, starts_at, ends_at, reason, status, booked_by, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, appointment.PatientID, appointment.DoctorID, appointment.Specialty,
+			appointment.StartsAt, appointment.EndsAt, appointment.Reason, appointment.Status, appointment.BookedBy,
+			appointment.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		appointment.AppointmentID = int(id)
+		if err := tx.QueryRowContext(ctx, `SELECT full_name FROM Users WHERE user_id = ?`, appointment.DoctorID).Scan(&appointment.DoctorName); err != nil {
+			return err
+		}
+
+		if needsInterpreter && language != "" {
+			appointment.Interpreter, err = s.interpreters.reserve(ctx, tx, appointment, language)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	appointment.StartsAt, appointment.EndsAt = timezone.In(appointment.StartsAt), timezone.In(appointment.EndsAt)
+	appointment.CreatedAt = timezone.In(appointment.CreatedAt)
+	return nil
+}
+
+// GetAppointment returns one appointment
+func (s *AppointmentService) GetAppointment(ctx context.Context, id int) (*models.Appointment, error) {
+	appointments, err := s.queryAppointments(ctx, `WHERE a.appointment_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(appointments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &appointments[0], nil
+}
+
+// PatientOf returns the ID of the patient an appointment is with
+func (s *AppointmentService) PatientOf(ctx context.Context, id int) (int, error) {
+	appointment, err := s.GetAppointment(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	return appointment.PatientID, nil
+}
+
+// GetAppointments lists appointments matching filter in start order
+func (s *AppointmentService) GetAppointments(ctx context.Context, filter AppointmentFilter) ([]models.Appointment, error) {
+	clause := `WHERE 1 = 1`
+	var args []any
+	if filter.DoctorID != 0 {
+		clause += ` AND a.doctor_id = ?`
+		args = append(args, filter.DoctorID)
+	}
+	if filter.PatientID != 0 {
+		clause += ` AND a.patient_id = ?`
+		args = append(args, filter.PatientID)
+	}
+	if filter.Department != "" {
+		clause += ` AND a.doctor_id IN (SELECT user_id FROM UserDepartments WHERE department_code = ?)`
+		args = append(args, normalizeDepartment(filter.Department))
+	}
+	if !filter.From.IsZero() {
+		clause += ` AND a.ends_at > ?`
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		clause += ` AND a.starts_at < ?`
+		args = append(args, filter.To.UTC())
+	}
+	if filter.Status != "" {
+		clause += ` AND a.status = ?`
+		args = append(args, filter.Status)
+	}
+	return s.queryAppointments(ctx, clause+` ORDER BY a.starts_at, a.appointment_id`, args...)
+}
+
+// GetSchedule returns the clinic schedule for the facility-local day that
+// day falls on: the day's appointments that aren't cancelled, with each
+// patient's language needs and the interpreter booked, optionally for one
+// doctor
+func (s *AppointmentService) GetSchedule(ctx context.Context, day time.Time, doctorID int) (*models.ClinicSchedule, error) {
+	day = timezone.StartOfDay(day)
+	appointments, err := s.GetAppointments(ctx, AppointmentFilter{DoctorID: doctorID, From: day, To: day.AddDate(0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := &models.ClinicSchedule{Date: day.Format("2006-01-02"), Appointments: []models.ScheduledAppointment{}}
+	for _, appointment := range appointments {
+		if appointment.Status == models.APPOINTMENT_STATUS_CANCELLED {
+			continue
+		}
+
+		entry := models.ScheduledAppointment{Appointment: appointment}
+		var firstName, lastName string
+		err := database.ReadDB(ctx).QueryRowContext(ctx, `SELECT first_name, last_name, COALESCE(preferred_language, ''), interpreter_required
+                  FROM Patients WHERE patient_id = ?`, appointment.PatientID).Scan(&firstName, &lastName, &entry.PreferredLanguage,
+			&entry.InterpreterRequired)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		entry.PatientName = strings.TrimSpace(firstName + " " + lastName)
+
+		if entry.Interpreter != nil && entry.Interpreter.Status == models.INTERPRETER_STATUS_REQUESTED {
+			schedule.AwaitingInterpreter++
+		}
+		schedule.Appointments = append(schedule.Appointments, entry)
+	}
+	return schedule, nil
+}
+
+// Cancel cancels a scheduled appointment, freeing the doctor's slot and the
+// interpreter booked for it and dropping its unsent reminder
+func (s *AppointmentService) Cancel(ctx context.Context, id int) (*models.Appointment, error) {
+	var affected int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE Appointments SET status = ? WHERE appointment_id = ? AND status = ?`,
+			models.APPOINTMENT_STATUS_CANCELLED, id, models.APPOINTMENT_STATUS_SCHEDULED)
+		if err != nil {
+			return err
+		}
+		affected, _ = result.RowsAffected()
+		if affected == 0 {
+			return nil
+		}
+		if err := s.interpreters.cancel(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err = s.notifications.CancelPending(ctx, tx, models.NOTIFICATION_APPOINTMENT_REMINDER, models.ENTITY_APPOINTMENT, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = database.WithPrimaryReads(ctx)
+	appointment, err := s.GetAppointment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, ErrAppointmentClosed
+	}
+	return appointment, nil
+}
+
+func (s *AppointmentService) queryAppointments(ctx context.Context, clause string, args ...any) ([]models.Appointment, error) {
+	query := `SELECT a.appointment_id, a.patient_id, a.doctor_id, COALESCE(u.full_name, ''), COALESCE(a.specialty, ''),
+                  a.starts_at, a.ends_at, COALESCE(a.reason, ''), a.status, a.booked_by, a.created_at
+              FROM Appointments a
+              LEFT JOIN Users u ON u.user_id = a.doctor_id ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appointments := []models.Appointment{}
+	for rows.Next() {
+		var appointment models.Appointment
+		if err := rows.Scan(&appointment.AppointmentID, &appointment.PatientID, &appointment.DoctorID, &appointment.DoctorName,
+			&appointment.Specialty, &appointment.StartsAt, &appointment.EndsAt, &appointment.Reason, &appointment.Status,
+			&appointment.BookedBy, &appointment.CreatedAt); err != nil {
+			return nil, err
+		}
+		appointment.StartsAt, appointment.EndsAt = timezone.In(appointment.StartsAt), timezone.In(appointment.EndsAt)
+		appointment.CreatedAt = timezone.In(appointment.CreatedAt)
+		appointments = append(appointments, appointment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return appointments, attachInterpreters(ctx, appointments)
+}
+
+// attachInterpreters fills in the interpreter booked for each appointment
+func attachInterpreters(ctx context.Context, appointments []models.Appointment) error {
+	ids := make([]int, len(appointments))
+	for i, appointment := range appointments {
+		ids[i] = appointment.AppointmentID
+	}
+	bookings, err := bookingsByAppointment(ctx, database.ReadDB(ctx), ids)
+	if err != nil {
+		return err
+	}
+	for i := range appointments {
+		appointments[i].Interpreter = bookings[appointments[i].AppointmentID]
+	}
+	return nil
+}
+
+// suggestDoctor scores every qualified doctor for the slot. Load is the
+// share of the covering shift already booked; ties go to the doctor with
+// fewer appointments in the shift, then the lower id so the pick is stable.
+func suggestDoctor(ctx context.Context, q querier, specialty string, start, end time.Time) (*models.AssignmentSuggestion, error) {
+	start, end = start.UTC(), end.UTC()
+	specialty = normalizeSpecialty(specialty)
+
+	suggestion := &models.AssignmentSuggestion{
+		Specialty:  specialty,
+		StartsAt:   start,
+		EndsAt:     end,
+		Candidates: []models.AssignmentCandidate{},
+	}
+
+	doctors, err := getDoctors(ctx, q, specialty, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var best *models.AssignmentCandidate
+	eligible := 0
+	for _, doctor := range doctors {
+		candidate, err := scoreCandidate(ctx, q, doctor, start, end)
+		if err != nil {
+			return nil, err
+		}
+		suggestion.Candidates = append(suggestion.Candidates, candidate)
+		if !candidate.Eligible {
+			continue
+		}
+		eligible++
+		if best == nil || candidate.Load < best.Load ||
+			(candidate.Load == best.Load && candidate.BookedInShift < best.BookedInShift) ||
+			(candidate.Load == best.Load && candidate.BookedInShift == best.BookedInShift && candidate.DoctorID < best.DoctorID) {
+			picked := candidate
+			best = &picked
+		}
+	}
+
+	switch {
+	case len(doctors) == 0 && specialty != "":
+		suggestion.Explanation = fmt.Sprintf("No doctor is registered with the specialty %q.", specialty)
+	case len(doctors) == 0:
+		suggestion.Explanation = "No doctors are registered."
+	case best == nil:
+		suggestion.Explanation = fmt.Sprintf("None of the %d qualified doctor(s) is on duty and free for the whole slot.", len(doctors))
+	default:
+		suggestion.Doctor = best
+		suggestion.Explanation = fmt.Sprintf("%s is on duty from %s to %s with %d minute(s) booked (%.0f%% of the shift), "+
+			"the lowest load of %d eligible doctor(s).", best.DoctorName, best.ShiftStartsAt.Format(time.RFC3339),
+			best.ShiftEndsAt.Format(time.RFC3339), best.BookedMinutes, best.Load*100, eligible)
+	}
+
+	return suggestion, nil
+}
+
+// scoreCandidate finds the doctor's shift covering the slot and how much of
+// it is already booked
+func scoreCandidate(ctx context.Context, q querier, doctor models.Doctor, start, end time.Time) (models.AssignmentCandidate, error) {
+	candidate := models.AssignmentCandidate{
+		DoctorID:   doctor.DoctorID,
+		DoctorName: doctor.FullName,
+		Eligible:   true,
+	}
+
+	var shiftStart, shiftEnd time.Time
+	query := `SELECT starts_at, ends_at FROM DutyShifts WHERE doctor_id = ? AND starts_at <= ? AND ends_at >= ?
+              ORDER BY starts_at LIMIT 1`
+	err := q.QueryRowContext(ctx, query, doctor.DoctorID, start, end).Scan(&shiftStart, &shiftEnd)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		candidate.Eligible = false
+		candidate.Reasons = append(candidate.Reasons, "not rostered on duty for the whole slot")
+	case err != nil:
+		return candidate, err
+	default:
+		shiftStart, shiftEnd = timezone.In(shiftStart), timezone.In(shiftEnd)
+		candidate.ShiftStartsAt, candidate.ShiftEndsAt = &shiftStart, &shiftEnd
+	}
+
+	var away int
+	query = `SELECT COUNT(*) FROM DoctorTimeOff WHERE doctor_id = ? AND starts_at < ? AND ends_at > ?`
+	if err := q.QueryRowContext(ctx, query, doctor.DoctorID, end, start).Scan(&away); err != nil {
+		return candidate, err
+	}
+	if away > 0 {
+		candidate.Eligible = false
+		candidate.Reasons = append(candidate.Reasons, "has time off during the slot")
+	}
+
+	conflicts, err := countConflicts(ctx, q, doctor.DoctorID, start, end)
+	if err != nil {
+		return candidate, err
+	}
+	if conflicts > 0 {
+		candidate.Eligible = false
+		candidate.Reasons = append(candidate.Reasons, "already has an appointment in the slot")
+	}
+
+	if candidate.ShiftStartsAt == nil {
+		return candidate, nil
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT starts_at, ends_at FROM Appointments
+              WHERE doctor_id = ? AND status = ? AND starts_at < ? AND ends_at > ?`,
+		doctor.DoctorID, models.APPOINTMENT_STATUS_SCHEDULED, shiftEnd, shiftStart)
+	if err != nil {
+		return candidate, err
+	}
+	defer rows.Close()
+
+	var booked time.Duration
+	for rows.Next() {
+		var bookedStart, bookedEnd time.Time
+		if err := rows.Scan(&bookedStart, &bookedEnd); err != nil {
+			return candidate, err
+		}
+		// Only the part of the appointment inside the shift counts
+		if bookedStart.Before(shiftStart) {
+			bookedStart = shiftStart
+		}
+		if bookedEnd.After(shiftEnd) {
+			bookedEnd = shiftEnd
+		}
+		booked += bookedEnd.Sub(bookedStart)
+		candidate.BookedInShift++
+	}
+	if err := rows.Err(); err != nil {
+		return candidate, err
+	}
+
+	candidate.BookedMinutes = int(booked.Minutes())
+	candidate.Load = float64(booked) / float64(shiftEnd.Sub(shiftStart))
+	if candidate.Eligible {
+		candidate.Reasons = append(candidate.Reasons,
+			fmt.Sprintf("on duty with %d appointment(s) already booked in the shift", candidate.BookedInShift))
+	}
+	return candidate, nil
+}
+
+// countConflicts counts the doctor's scheduled appointments overlapping the slot
+func countConflicts(ctx context.Context, q queryRower, doctorID int, start, end time.Time) (int, error) {
+	var conflicts int
+	query := `SELECT COUNT(*) FROM Appointments WHERE doctor_id = ? AND status = ? AND starts_at < ? AND ends_at > ?`
+	err := q.QueryRowContext(ctx, query, doctorID, models.APPOINTMENT_STATUS_SCHEDULED, end, start).Scan(&conflicts)
+	return conflicts, err
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+type AuditService struct{}
+
+func NewAuditService() *AuditService {
+	return &AuditService{}
+}
+
+// Log records an action, linking it into the audit log's hash chain. Pass
+// the transaction performing the action as exec so the audit entry is only
+// kept if the action commits; anything else gets a transaction of its own.
+func (s *AuditService) Log(ctx context.Context, exec execer, userID int, action, entityType string, entityID int, details any) error {
+	payload, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %v", err)
+	}
+	// Truncated to what PostgreSQL stores, so the hash verifies after a round trip
+	entry := &models.AuditLog{UserID: userID, Action: action, EntityType: entityType, EntityID: entityID,
+		Details: payload, CreatedAt: time.Now().UTC().Truncate(time.Microsecond)}
+
+	if tx, ok := exec.(*sql.Tx); ok {
+		return s.append(ctx, tx, entry)
+	}
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		return s.append(ctx, tx, entry)
+	})
+}
+
+// append chains entry to the last one and stores it. SQLite transactions
+// take the write lock as they begin and PostgreSQL ones lock the table here,
+// so no other entry can be appended in between.
+func (s *AuditService) append(ctx context.Context, tx *sql.Tx, entry *models.AuditLog) error {
+	if database.CurrentDialect().Name() == database.Postgres {
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE AuditLogs IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("failed to lock audit log: %v", err)
+		}
+	}
+
+	err := tx.QueryRowContext(ctx, `SELECT hash FROM AuditLogs ORDER BY audit_log_id DESC LIMIT 1`).Scan(&entry.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read audit chain: %v", err)
+	}
+	entry.Hash = entry.ChainHash(entry.PrevHash)
+
+	query := `INSERT INTO AuditLogs (user_id, action, entity_type, entity_id, details, created_at, prev_hash, hash)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	// Actions taken by the system rather than a user are logged with no user
+	user := sql.NullInt64{Int64: int64(entry.UserID), Valid: entry.UserID != 0}
+	if _, err := tx.ExecContext(ctx, query, user, entry.Action, entry.EntityType, entry.EntityID, string(entry.Details),
+		entry.CreatedAt, entry.PrevHash, entry.Hash); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	return nil
+}
+
+// ExportAll emits every audit log entry, oldest first, for a bulk export
+func (s *AuditService) ExportAll(ctx context.Context, emit func(row any) error) error {
+	return s.each(ctx, func(entry models.AuditLog) error {
+		return emit(entry)
+	})
+}
+
+// VerifyChain walks the audit log oldest first, recomputing each entry's hash
+// and checking it links to the one before, and reports the first break
+func (s *AuditService) VerifyChain(ctx context.Context) (*models.AuditChainVerification, error) {
+	result := &models.AuditChainVerification{}
+	prevHash := ""
+	errBroken := errors.New("broken")
+	err := s.each(ctx, func(entry models.AuditLog) error {
+		result.Checked++
+		switch {
+		case entry.PrevHash != prevHash:
+			result.Reason = "prevHash does not match the previous entry's hash; an entry was removed or reordered"
+		case entry.ChainHash(entry.PrevHash) != entry.Hash:
+			result.Reason = "hash does not match the entry's content; the entry was altered"
+		default:
+			prevHash = entry.Hash
+			return nil
+		}
+		result.BrokenAt = entry.AuditLogID
+		return errBroken
+	})
+	if err != nil && !errors.Is(err, errBroken) {
+		return nil, err
+	}
+
+	result.Valid = result.BrokenAt == 0
+	if result.Valid {
+		result.HeadHash = prevHash
+	}
+	return result, nil
+}
+
+// each reads every audit log entry, oldest first
+func (s *AuditService) each(ctx context.Context, fn func(entry models.AuditLog) error) error {
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT audit_log_id, COALESCE(user_id, 0), action, COALESCE(entity_type, ''),
+              COALESCE(entity_id, 0), COALESCE(details, ''), created_at, prev_hash, hash FROM AuditLogs ORDER BY audit_log_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditLog
+		var details string
+		if err := rows.Scan(&entry.AuditLogID, &entry.UserID, &entry.Action, &entry.EntityType, &entry.EntityID, &details,
+			&entry.CreatedAt, &entry.PrevHash, &entry.Hash); err != nil {
+			return err
+		}
+		if details != "" {
+			entry.Details = json.RawMessage(details)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+)
+
+const (
+	// CookieName is the httpOnly cookie holding the session ID of clients
+	// that chose cookie mode
+	CookieName = "hms_session"
+	// ModeHeader selects how the login's session ID is returned: "cookie"
+	// sets CookieName; anything else returns it in the body for X-Session-ID
+	ModeHeader = "X-Session-Mode"
+	// CSRFHeader carries the session's CSRF token on state-changing requests
+	// authenticated by the cookie
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// WantsCookie reports whether the client asked for cookie mode on this login
+func WantsCookie(r *http.Request) bool {
+	return r.Header.Get(ModeHeader) == "cookie"
+}
+
+// setCookie hands an authenticated session to the browser in a cookie that
+// scripts can't read and other sites can't send
+func setCookie(w http.ResponseWriter, session *Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    session.SessionID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// clearCookie tells the browser to drop the session cookie
+func clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// fromCookie reports whether the request's session came from the cookie
+// rather than a header. Only those requests need a CSRF token: a browser
+// attaches cookies to forged requests but never custom headers.
+func fromCookie(r *http.Request) bool {
+	return headerID(r) == "" && cookieID(r) != ""
+}
+
+func cookieID(r *http.Request) string {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// validCSRF reports whether a cookie-authenticated request may proceed: safe
+// methods always may, state-changing ones must echo the session's CSRF token
+func validCSRF(r *http.Request, session *Session) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	token := r.Header.Get(CSRFHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(session.CSRFToken)) == 1
+}
+
+// IssueCookie sets the cookie for a session that has just been authenticated
+// and swaps the session ID in body for its CSRF token. It returns false when
+// the session has gone.
+func IssueCookie(w http.ResponseWriter, store Store, sessionID string, body *AuthResponse) bool {
+	session, exists := store.Get(sessionID)
+	if !exists {
+		return false
+	}
+
+	setCookie(w, session)
+	body.SessionID = ""
+	body.CSRFToken = session.CSRFToken
+	return true
+}
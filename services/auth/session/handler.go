@@ -0,0 +1,608 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/dto"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// Handler exposes the login, 2FA and logout endpoints backed by the session store
+type Handler struct {
+	userService   *services.UserService
+	store         Store
+	notifications *services.NotificationService
+	resets        *services.TwoFAResetService
+	logins        *services.LoginEventService
+}
+
+// NewHandler raises security alerts through notifications and records every
+// authentication attempt through logins
+func NewHandler(userService *services.UserService, store Store, notifications *services.NotificationService, resets *services.TwoFAResetService,
+	logins *services.LoginEventService) *Handler {
+	return &Handler{
+		userService:   userService,
+		store:         store,
+		notifications: notifications,
+		resets:        resets,
+		logins:        logins,
+	}
+}
+
+// Login checks the password (basic auth or a JSON {username, password} body)
+// and starts a pending session that must be completed with a second factor
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+			writeJSONError(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+		username, password = req.Username, req.Password
+	}
+
+	user, err := authenticateUser(r, h.userService, h.logins, models.LOGIN_METHOD_SESSION, username, password)
+	if err != nil {
+		writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	RecordLogin(r, h.logins, user.UserID, user.Username, models.LOGIN_METHOD_SESSION, "", false)
+
+	secondFactors, err := secondFactors(r.Context(), h.userService, user)
+	if err != nil {
+		writeJSONError(w, "Failed to check 2FA methods", http.StatusInternalServerError)
+		return
+	}
+
+	if len(secondFactors) == 0 {
+		// User has neither TOTP nor a security key, require setup
+		writeJSON(w, http.StatusPreconditionRequired, AuthResponse{
+			Success:       false,
+			Message:       "2FA setup required",
+			Requires2FA:   true,
+			TempSessionID: "setup-required",
+		})
+		return
+	}
+
+	session, err := h.store.Create(user, false, clientFromRequest(r))
+	if err != nil {
+		writeJSONError(w, "Failed to create 2FA session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-New-2FA-Session-ID", session.SessionID)
+	writeJSON(w, http.StatusOK, AuthResponse{
+		Success:       true,
+		Message:       "2FA verification required",
+		Requires2FA:   true,
+		TempSessionID: session.SessionID,
+		SecondFactors: secondFactors,
+	})
+}
+
+// Verify2FA completes a pending session with a TOTP or backup code. In
+// cookie mode (X-Session-Mode: cookie) the session is set as a cookie and
+// the body carries its CSRF token instead of the session ID.
+func (h *Handler) Verify2FA(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SessionID     string `json:"sessionId"`
+		TempSessionID string `json:"tempSessionId"`
+		Code          string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = req.TempSessionID
+	}
+
+	// Only pending sessions can be verified; an authenticated one already was
+	session, exists := h.store.Get(sessionID)
+	if !exists || session.Authenticated {
+		writeJSONError(w, "Invalid or expired session. Please login again.", http.StatusUnauthorized)
+		return
+	}
+
+	valid, err := h.userService.GetTwoFAService().VerifyTwoFA(r.Context(), session.UserID, req.Code)
+	if err != nil || !valid {
+		RecordLogin(r, h.logins, session.UserID, session.Username, models.LOGIN_METHOD_2FA, models.LOGIN_FAILURE_SECOND_FACTOR, false)
+		writeJSONError(w, "Invalid 2FA code", http.StatusUnauthorized)
+		return
+	}
+
+	// Stateless session tokens are replaced once authenticated
+	sessionID, ok := h.store.MarkAuthenticated(sessionID)
+	if !ok {
+		writeJSONError(w, "Session expired during verification", http.StatusUnauthorized)
+		return
+	}
+	RecordLogin(r, h.logins, session.UserID, session.Username, models.LOGIN_METHOD_2FA, "", true)
+
+	user, err := h.userService.GetUser(r.Context(), session.UserID)
+	if err != nil {
+		writeJSONError(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+
+	body := AuthResponse{
+		Success:   true,
+		Message:   "2FA verification successful",
+		SessionID: sessionID,
+		User:      userInfo(user),
+	}
+	if WantsCookie(r) {
+		if !IssueCookie(w, h.store, sessionID, &body) {
+			writeJSONError(w, "Session expired during verification", http.StatusUnauthorized)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// Logout deletes the session named by header, cookie or ?sessionId=. A
+// cookie session needs its CSRF token, so other sites can't sign users out.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID := IDFromRequest(r)
+	if sessionID == "" {
+		sessionID = r.URL.Query().Get("sessionId")
+	}
+
+	if sessionID == "" {
+		writeJSONError(w, "No session ID provided", http.StatusBadRequest)
+		return
+	}
+
+	if fromCookie(r) {
+		if session, exists := h.store.Get(sessionID); exists && !validCSRF(r, session) {
+			writeJSONError(w, "Missing or invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		clearCookie(w)
+	}
+
+	h.store.Delete(sessionID)
+
+	writeJSON(w, http.StatusOK, AuthResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	})
+}
+
+// GetSessionInfo returns information about the current session. A cookie
+// session gets its CSRF token back, e.g. after a page reload, but not its ID.
+func (h *Handler) GetSessionInfo(w http.ResponseWriter, r *http.Request) {
+	sessionID := IDFromRequest(r)
+	if sessionID == "" {
+		writeJSONError(w, "No session ID provided", http.StatusBadRequest)
+		return
+	}
+
+	session, exists := h.store.Get(sessionID)
+	if !exists {
+		writeJSONError(w, "Invalid or expired session", http.StatusUnauthorized)
+		return
+	}
+
+	response := map[string]interface{}{
+		"sessionId": session.SessionID,
+		"user": &UserInfo{
+			ID:           session.UserID,
+			Username:     session.Username,
+			FullName:     session.FullName,
+			Role:         session.Role,
+			TwoFAEnabled: session.TwoFAEnabled,
+		},
+		"twoFactorVerified": session.Authenticated,
+		"createdAt":         session.CreatedAt,
+		"lastAccessedAt":    session.LastAccessedAt,
+		"expiresAt":         session.ExpiresAt,
+	}
+	if fromCookie(r) {
+		delete(response, "sessionId")
+		response["csrfToken"] = session.CSRFToken
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Transition exchanges basic auth credentials for a pending 2FA session
+func (h *Handler) Transition(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		writeJSONError(w, "Authorization required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := authenticateUser(r, h.userService, h.logins, models.LOGIN_METHOD_SESSION, username, password)
+	if err != nil {
+		writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	factors, err := secondFactors(r.Context(), h.userService, user)
+	if err != nil {
+		writeJSONError(w, "Failed to check 2FA methods", http.StatusInternalServerError)
+		return
+	}
+
+	if len(factors) == 0 {
+		writeJSON(w, http.StatusOK, AuthResponse{
+			Success:     true,
+			Message:     "User does not have 2FA enabled",
+			Requires2FA: false,
+		})
+		return
+	}
+
+	session, err := h.store.Create(user, false, clientFromRequest(r))
+	if err != nil {
+		writeJSONError(w, "Failed to create 2FA session", http.StatusInternalServerError)
+		return
+	}
+	RecordLogin(r, h.logins, user.UserID, user.Username, models.LOGIN_METHOD_SESSION, "", false)
+
+	w.Header().Set("X-New-2FA-Session-ID", session.SessionID)
+	writeJSON(w, http.StatusOK, AuthResponse{
+		Success:       true,
+		Message:       "2FA session created. Please provide your authentication code.",
+		Requires2FA:   true,
+		TempSessionID: session.SessionID,
+		SecondFactors: factors,
+	})
+}
+
+// Setup2FA generates a new TOTP secret for a basic-auth user. A user who
+// already has a second factor must prove it, see confirmEnrollment.
+func (h *Handler) Setup2FA(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		writeJSONError(w, "Authorization required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := authenticateUser(r, h.userService, h.logins, models.LOGIN_METHOD_BASIC, username, password)
+	if err != nil {
+		writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if !h.confirmEnrollment(w, r, user) {
+		return
+	}
+
+	setup, err := h.userService.GetTwoFAService().GenerateTwoFASetup(r.Context(), user.Username)
+	if err != nil {
+		writeJSONError(w, "Failed to generate 2FA setup", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, setup)
+}
+
+// Enable2FA enables TOTP for a basic-auth user after verifying a code for
+// the new secret. Like Setup2FA, replacing a second factor needs it too.
+func (h *Handler) Enable2FA(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		writeJSONError(w, "Authorization required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := authenticateUser(r, h.userService, h.logins, models.LOGIN_METHOD_BASIC, username, password)
+	if err != nil {
+		writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if !h.confirmEnrollment(w, r, user) {
+		return
+	}
+
+	var req struct {
+		Secret string `json:"secret"`
+		Code   string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	backupCodes, err := h.userService.GetTwoFAService().EnableTwoFA(r.Context(), user.UserID, req.Secret, req.Code)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":     "2FA enabled successfully",
+		"backupCodes": backupCodes,
+	})
+}
+
+// ClearAllSessions removes every session (admin only)
+func (h *Handler) ClearAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		writeJSONError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	if user.Role != models.ROLE_ADMIN {
+		writeJSONError(w, "Admin privileges required", http.StatusForbidden)
+		return
+	}
+
+	cleared := h.store.Clear()
+	h.notifications.SecurityAlert(r.Context(), "All sessions cleared",
+		fmt.Sprintf("%s (user %d) signed out every user by clearing %d session(s).", user.Username, user.UserID, cleared))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":         true,
+		"message":         "All sessions cleared",
+		"clearedSessions": cleared,
+	})
+}
+
+// IssueTwoFAReset mints a one-time 2FA reset token for a user who has lost
+// their authenticator (admin only). The token is shown once; hand it to the
+// user out of band.
+func (h *Handler) IssueTwoFAReset(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		writeJSONError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	reset, err := h.resets.Issue(r.Context(), userID, admin.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		writeJSONError(w, "Failed to issue 2FA reset", http.StatusInternalServerError)
+		return
+	}
+
+	h.notifications.SecurityAlert(r.Context(), "Two-factor reset issued",
+		fmt.Sprintf("%s (user %d) issued a two-factor reset for user %d.", admin.Username, admin.UserID, userID))
+	writeJSON(w, http.StatusCreated, reset)
+}
+
+// SetUserActive deactivates an account, signing it out everywhere, or
+// reactivates one (admin only). Body: {"active": false}.
+func (h *Handler) SetUserActive(w http.ResponseWriter, r *http.Request) {
+	admin, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		writeJSONError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Active *bool `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Active == nil {
+		writeJSONError(w, "Request body must be {\"active\": true|false}", http.StatusBadRequest)
+		return
+	}
+	if userID == admin.UserID && !*req.Active {
+		writeJSONError(w, "You cannot deactivate your own account", http.StatusConflict)
+		return
+	}
+
+	user, err := h.userService.SetActive(r.Context(), userID, *req.Active, admin.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeJSONError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		writeJSONError(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	if !user.Active {
+		ended := h.store.DeleteUser(userID)
+		h.notifications.SecurityAlert(r.Context(), "Account deactivated",
+			fmt.Sprintf("%s (user %d) deactivated %s (user %d); %d session(s) were signed out.",
+				admin.Username, admin.UserID, user.Username, userID, ended))
+	}
+	dto.WriteJSON(w, r, http.StatusOK, user)
+}
+
+// RedeemTwoFAReset turns off TOTP for a user who proves their password and
+// holds a reset token, and signs them out everywhere. They then enroll a new
+// authenticator with /2fa/setup and /2fa/enable.
+func (h *Handler) RedeemTwoFAReset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Token    string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := authenticateUser(r, h.userService, h.logins, models.LOGIN_METHOD_BASIC, req.Username, req.Password)
+	if err != nil {
+		writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.resets.Redeem(r.Context(), user.UserID, req.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFAReset) {
+			writeJSONError(w, "Invalid, expired or already used reset token", http.StatusUnauthorized)
+			return
+		}
+		writeJSONError(w, "Failed to reset 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	ended := h.store.DeleteUser(user.UserID)
+	h.notifications.SecurityAlert(r.Context(), "Two-factor authentication reset",
+		fmt.Sprintf("%s (user %d) redeemed a two-factor reset; %d session(s) were signed out.", user.Username, user.UserID, ended))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":       true,
+		"message":       "2FA reset. Set up a new authenticator to log in.",
+		"endedSessions": ended,
+	})
+}
+
+// ActiveSession describes one of the caller's sessions. ID identifies it for
+// revocation but, unlike the session ID, can't be used to authenticate.
+type ActiveSession struct {
+	ID             string    `json:"id"`
+	Device         string    `json:"device"`
+	IPAddress      string    `json:"ipAddress"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastAccessedAt time.Time `json:"lastAccessedAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	Current        bool      `json:"current"`
+}
+
+// ListSessions lists the caller's active sessions, newest first, marking
+// the one the request was made with
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		writeJSONError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	currentID := IDFromRequest(r)
+	sessions := []ActiveSession{}
+	for _, session := range h.store.List(user.UserID) {
+		sessions = append(sessions, ActiveSession{
+			ID:             publicID(session.SessionID),
+			Device:         session.UserAgent,
+			IPAddress:      session.IPAddress,
+			CreatedAt:      session.CreatedAt,
+			LastAccessedAt: session.LastAccessedAt,
+			ExpiresAt:      session.ExpiresAt,
+			Current:        session.SessionID == currentID,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the caller's sessions, named by the ID from
+// ListSessions
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		writeJSONError(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	for _, session := range h.store.List(user.UserID) {
+		if publicID(session.SessionID) != id {
+			continue
+		}
+
+		h.store.Delete(session.SessionID)
+		if session.SessionID == IDFromRequest(r) && fromCookie(r) {
+			clearCookie(w)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSONError(w, "Session not found", http.StatusNotFound)
+}
+
+// publicID derives a session's listing ID from its secret session ID
+func publicID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// confirmEnrollment keeps a password alone from enrolling a new
+// authenticator over an existing second factor: TOTP users must send a
+// current TOTP or backup code in X-2FA-Code, and security-key users enroll
+// from an authenticated session at /api/2fa. It writes the error response
+// when enrollment isn't allowed.
+func (h *Handler) confirmEnrollment(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	factors, err := secondFactors(r.Context(), h.userService, user)
+	if err != nil {
+		writeJSONError(w, "Failed to check 2FA methods", http.StatusInternalServerError)
+		return false
+	}
+	if len(factors) == 0 {
+		return true
+	}
+	if !slices.Contains(factors, SECOND_FACTOR_TOTP) {
+		writeJSONError(w, "Sign in with your security key and use /api/2fa/setup to add an authenticator", http.StatusForbidden)
+		return false
+	}
+
+	valid, err := h.userService.GetTwoFAService().VerifyTwoFA(r.Context(), user.UserID, r.Header.Get("X-2FA-Code"))
+	if err != nil || !valid {
+		RecordLogin(r, h.logins, user.UserID, user.Username, models.LOGIN_METHOD_2FA, models.LOGIN_FAILURE_SECOND_FACTOR, false)
+		writeJSONError(w, "2FA is already enabled; send a current 2FA code in X-2FA-Code to replace it", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// secondFactors lists the 2FA methods the user can complete login with. Any
+// at all means a password alone doesn't authenticate them.
+func secondFactors(ctx context.Context, userService *services.UserService, user *models.User) ([]string, error) {
+	var methods []string
+	if user.TwoFAEnabled {
+		methods = append(methods, SECOND_FACTOR_TOTP)
+	}
+
+	hasKeys, err := userService.GetWebAuthnService().HasCredentials(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if hasKeys {
+		methods = append(methods, SECOND_FACTOR_WEBAUTHN)
+	}
+
+	return methods, nil
+}
+
+func userInfo(user *models.User) *UserInfo {
+	return &UserInfo{
+		ID:           user.UserID,
+		Username:     user.Username,
+		FullName:     user.FullName,
+		Role:         strings.ToLower(user.Role),
+		TwoFAEnabled: user.TwoFAEnabled,
+	}
+}
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"errors"
+	"time"
+)
+
+// Lifetimes bounds how long sessions last. Authenticated sessions slide: a
+// request in the second half of a session's lifetime renews it, but never
+// past MaxAge after the login that created it.
+type Lifetimes struct {
+	// Pending is how long a user has to complete the second factor
+	Pending time.Duration
+	// Authenticated is how long an authenticated session lasts from its
+	// login or last renewal
+	Authenticated time.Duration
+	// IdleTimeout ends an authenticated session this long after its last
+	// request, however long it had left; zero disables it. Stateless session
+	// tokens don't record requests, so it doesn't apply to them.
+	IdleTimeout time.Duration
+	// MaxAge caps an authenticated session's age however often it is
+	// renewed; zero leaves renewal uncapped
+	MaxAge time.Duration
+}
+
+// DefaultLifetimes give a quarter of an hour for the second factor and a
+// day's session, which renewal can't extend
+var DefaultLifetimes = Lifetimes{
+	Pending:       15 * time.Minute,
+	Authenticated: 24 * time.Hour,
+	MaxAge:        24 * time.Hour,
+}
+
+// Validate reports lifetimes that would end sessions as soon as they start
+func (l Lifetimes) Validate() error {
+	switch {
+	case l.Pending <= 0:
+		return errors.New("the pending session lifetime must be positive")
+	case l.Authenticated <= 0:
+		return errors.New("the session lifetime must be positive")
+	case l.IdleTimeout < 0:
+		return errors.New("the idle timeout can't be negative")
+	case l.MaxAge < 0:
+		return errors.New("the maximum session age can't be negative")
+	}
+	return nil
+}
+
+// expiry is when a session created by a login at loginAt expires if it is
+// authenticated or renewed at now
+func (l Lifetimes) expiry(loginAt, now time.Time) time.Time {
+	expiresAt := now.Add(l.Authenticated)
+	if l.MaxAge > 0 && expiresAt.After(loginAt.Add(l.MaxAge)) {
+		return loginAt.Add(l.MaxAge)
+	}
+	return expiresAt
+}
+
+// renewalDue reports whether a request at now should renew session: it is
+// authenticated, has less than half its lifetime left, and renewing would
+// extend it. Renewing only then spares the store a write per request.
+func (l Lifetimes) renewalDue(session *Session, now time.Time) bool {
+	return session.Authenticated && session.ExpiresAt.Sub(now) < l.Authenticated/2 &&
+		l.expiry(session.CreatedAt, now).After(session.ExpiresAt)
+}
+
+// idle reports whether an authenticated session has gone unused for longer
+// than IdleTimeout
+func (l Lifetimes) idle(session *Session, now time.Time) bool {
+	return l.IdleTimeout > 0 && session.Authenticated && now.Sub(session.LastAccessedAt) > l.IdleTimeout
+}
@@ -0,0 +1,416 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/kinyaelgrande/simple-hospital/logging"
+	"github.com/kinyaelgrande/simple-hospital/metrics"
+	"github.com/kinyaelgrande/simple-hospital/middleware"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// AuthResponse is the response body of every authentication endpoint.
+// Errors also carry the standard error envelope alongside success/message,
+// which the login flow of the web client reads.
+type AuthResponse struct {
+	Success       bool                `json:"success"`
+	Message       string              `json:"message"`
+	Requires2FA   bool                `json:"requires2FA,omitempty"`
+	TempSessionID string              `json:"tempSessionId,omitempty"`
+	SecondFactors []string            `json:"secondFactors,omitempty"`
+	SessionID     string              `json:"sessionId,omitempty"`
+	CSRFToken     string              `json:"csrfToken,omitempty"`
+	User          *UserInfo           `json:"user,omitempty"`
+	Error         *response.ErrorBody `json:"error,omitempty"`
+}
+
+// UserInfo represents user information in responses
+type UserInfo struct {
+	ID           int    `json:"id"`
+	Username     string `json:"username"`
+	FullName     string `json:"fullName"`
+	Role         string `json:"role"`
+	TwoFAEnabled bool   `json:"twoFactorEnabled"`
+}
+
+// NewSessionHeader carries the session ID to use from then on when
+// verifying a code with X-2FA-Code, or renewing the session, replaced a
+// stateless session token
+const NewSessionHeader = "X-New-Session-ID"
+
+// APIKeyHeader carries a machine integration's API key
+const APIKeyHeader = "X-API-Key"
+
+// Second factors a login can be completed with, as listed in AuthResponse
+const (
+	// SECOND_FACTOR_TOTP also accepts backup codes
+	SECOND_FACTOR_TOTP     = "totp"
+	SECOND_FACTOR_WEBAUTHN = "webauthn"
+)
+
+// AuthMiddleware authenticates requests using an API key (X-API-Key), a
+// session (X-2FA-Session-ID or X-Session-ID header, or the session cookie)
+// or basic auth, with the 2FA code in X-2FA-Code. Cookie sessions must send
+// their CSRF token on state-changing requests. Sessions in use are renewed
+// as the store's lifetimes allow.
+type AuthMiddleware struct {
+	userService *services.UserService
+	store       Store
+	logins      *services.LoginEventService
+	apiKeys     *services.APIKeyService
+	lifetimes   Lifetimes
+}
+
+// NewAuthMiddleware records every authentication attempt through logins,
+// other than with API keys, which are recorded as their last use. lifetimes
+// must be the ones store was made with.
+func NewAuthMiddleware(userService *services.UserService, store Store, logins *services.LoginEventService, apiKeys *services.APIKeyService, lifetimes Lifetimes) *AuthMiddleware {
+	return &AuthMiddleware{
+		userService: userService,
+		store:       store,
+		logins:      logins,
+		apiKeys:     apiKeys,
+		lifetimes:   lifetimes,
+	}
+}
+
+// Authenticate puts the authenticated user in the request context or rejects the request
+func (am *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			am.handleAPIKey(w, r, next, key)
+			return
+		}
+
+		sessionID := IDFromRequest(r)
+		if sessionID == "" {
+			am.handleBasicAuth(w, r, next)
+			return
+		}
+
+		// Special handling for basic-auth transition to 2FA
+		if sessionID == "basic-auth" {
+			am.handleBasicAuthTo2FATransition(w, r, next)
+			return
+		}
+
+		// Check if we also have a 2FA code for verification. Only
+		// authenticated sessions are put in cookies, so it never applies there.
+		if r.Header.Get("X-2FA-Code") != "" && !fromCookie(r) {
+			am.handle2FAVerification(w, r, next, sessionID)
+			return
+		}
+
+		am.handleSession(w, r, next, sessionID)
+	})
+}
+
+// handleSession handles requests with an existing session
+func (am *AuthMiddleware) handleSession(w http.ResponseWriter, r *http.Request, next http.Handler, sessionID string) {
+	session, exists := am.store.Get(sessionID)
+	if !exists {
+		writeJSONError(w, "Invalid or expired session. Please login again.", http.StatusUnauthorized)
+		return
+	}
+
+	if !session.Authenticated {
+		writeJSONError(w, "2FA verification required. Please provide your authentication code.", http.StatusUnauthorized)
+		return
+	}
+
+	if fromCookie(r) && !validCSRF(r, session) {
+		writeJSONError(w, "Missing or invalid CSRF token", http.StatusForbidden)
+		return
+	}
+
+	if am.lifetimes.renewalDue(session, time.Now()) {
+		am.renew(w, r, sessionID)
+	}
+
+	am.serveAsUser(w, r, next, session.UserID)
+}
+
+// renew slides a session's expiry forward, handing a cookie client the
+// cookie with the new expiry and a header client any new session ID. A
+// failed renewal leaves the session as it was, still valid until it expires.
+func (am *AuthMiddleware) renew(w http.ResponseWriter, r *http.Request, sessionID string) {
+	renewed, ok := am.store.Renew(sessionID)
+	if !ok {
+		return
+	}
+
+	if fromCookie(r) {
+		setCookie(w, renewed)
+	} else if renewed.SessionID != sessionID {
+		w.Header().Set(NewSessionHeader, renewed.SessionID)
+	}
+	log.Printf("Renewed session %s of user %d until %s", logging.Fingerprint(sessionID), renewed.UserID, renewed.ExpiresAt.Format(time.RFC3339))
+}
+
+// handleAPIKey handles requests from machine integrations, which may only
+// call the routes their key's scopes cover
+func (am *AuthMiddleware) handleAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, presented string) {
+	key, err := am.apiKeys.Authenticate(r.Context(), presented)
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		metrics.FailedLogin()
+		log.Printf("Rejected API key %s from %s", logging.Fingerprint(presented), clientFromRequest(r).IPAddress)
+		writeJSONError(w, "Invalid, expired or revoked API key", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to authenticate API key: %v", err)
+		writeJSONError(w, "Failed to authenticate API key", http.StatusInternalServerError)
+		return
+	}
+
+	var template string
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ = route.GetPathTemplate()
+	}
+	if !models.APIKeyAllows(key.Scopes, r.Method, template) {
+		writeJSONError(w, "API key "+key.Prefix+" is not scoped for this endpoint", http.StatusForbidden)
+		return
+	}
+
+	am.serveAsUser(w, r, next, key.UserID)
+}
+
+// handle2FAVerification verifies the X-2FA-Code for a pending session and proceeds
+func (am *AuthMiddleware) handle2FAVerification(w http.ResponseWriter, r *http.Request, next http.Handler, sessionID string) {
+	session, exists := am.store.Get(sessionID)
+	if !exists || session.Authenticated {
+		writeJSONError(w, "Invalid or expired session. Please login again.", http.StatusUnauthorized)
+		return
+	}
+
+	valid, err := am.userService.GetTwoFAService().VerifyTwoFA(r.Context(), session.UserID, r.Header.Get("X-2FA-Code"))
+	if err != nil || !valid {
+		log.Printf("2FA verification failed for session %s: valid=%t, error=%v", logging.Fingerprint(sessionID), valid, err)
+		RecordLogin(r, am.logins, session.UserID, session.Username, models.LOGIN_METHOD_2FA, models.LOGIN_FAILURE_SECOND_FACTOR, false)
+		writeJSONError(w, "Invalid 2FA code", http.StatusUnauthorized)
+		return
+	}
+
+	authenticatedID, ok := am.store.MarkAuthenticated(sessionID)
+	if !ok {
+		writeJSONError(w, "Session expired during verification", http.StatusUnauthorized)
+		return
+	}
+	if authenticatedID != sessionID {
+		// A stateless session token was replaced; later requests need the new one
+		w.Header().Set(NewSessionHeader, authenticatedID)
+	}
+	RecordLogin(r, am.logins, session.UserID, session.Username, models.LOGIN_METHOD_2FA, "", true)
+
+	am.serveAsUser(w, r, next, session.UserID)
+}
+
+// handleBasicAuth handles traditional basic authentication
+func (am *AuthMiddleware) handleBasicAuth(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Hospital Management System"`)
+		writeJSONError(w, "Authorization required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := authenticateUser(r, am.userService, am.logins, models.LOGIN_METHOD_BASIC, username, password)
+	if err != nil {
+		log.Printf("Basic auth failed for user %s: %v", username, err)
+		writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	factors, err := secondFactors(r.Context(), am.userService, user)
+	if err != nil {
+		writeJSONError(w, "Failed to check 2FA methods", http.StatusInternalServerError)
+		return
+	}
+
+	if len(factors) > 0 {
+		// A code in this request completes the login, unless the user only
+		// has security keys, which need the session and WebAuthn flow
+		twoFACode := r.Header.Get("X-2FA-Code")
+		if twoFACode == "" || !slices.Contains(factors, SECOND_FACTOR_TOTP) {
+			session, err := am.store.Create(user, false, clientFromRequest(r))
+			if err != nil {
+				writeJSONError(w, "Failed to create 2FA session", http.StatusInternalServerError)
+				return
+			}
+			RecordLogin(r, am.logins, user.UserID, user.Username, models.LOGIN_METHOD_SESSION, "", false)
+
+			w.Header().Set("WWW-Authenticate", `Basic realm="Hospital Management System", 2FA required`)
+			writeJSON(w, http.StatusUnauthorized, AuthResponse{
+				Success:       false,
+				Message:       "2FA code required",
+				Requires2FA:   true,
+				TempSessionID: session.SessionID,
+				SecondFactors: factors,
+			})
+			return
+		}
+
+		valid, err := am.userService.GetTwoFAService().VerifyTwoFA(r.Context(), user.UserID, twoFACode)
+		if err != nil || !valid {
+			log.Printf("2FA verification failed for user %s: %v", username, err)
+			RecordLogin(r, am.logins, user.UserID, user.Username, models.LOGIN_METHOD_BASIC, models.LOGIN_FAILURE_SECOND_FACTOR, false)
+			writeJSONError(w, "Invalid 2FA code", http.StatusUnauthorized)
+			return
+		}
+	}
+	RecordLogin(r, am.logins, user.UserID, user.Username, models.LOGIN_METHOD_BASIC, "", true)
+
+	user.PasswordHash = ""
+	next.ServeHTTP(w, r.WithContext(middleware.SetUserContext(r.Context(), user)))
+}
+
+// handleBasicAuthTo2FATransition exchanges basic auth credentials for a pending 2FA session
+func (am *AuthMiddleware) handleBasicAuthTo2FATransition(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		writeJSONError(w, "Authorization required for 2FA transition", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := authenticateUser(r, am.userService, am.logins, models.LOGIN_METHOD_BASIC, username, password)
+	if err != nil {
+		writeJSONError(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	factors, err := secondFactors(r.Context(), am.userService, user)
+	if err != nil {
+		writeJSONError(w, "Failed to check 2FA methods", http.StatusInternalServerError)
+		return
+	}
+
+	if len(factors) == 0 {
+		RecordLogin(r, am.logins, user.UserID, user.Username, models.LOGIN_METHOD_BASIC, "", true)
+		user.PasswordHash = ""
+		next.ServeHTTP(w, r.WithContext(middleware.SetUserContext(r.Context(), user)))
+		return
+	}
+
+	session, err := am.store.Create(user, false, clientFromRequest(r))
+	if err != nil {
+		writeJSONError(w, "Failed to create 2FA session", http.StatusInternalServerError)
+		return
+	}
+	RecordLogin(r, am.logins, user.UserID, user.Username, models.LOGIN_METHOD_SESSION, "", false)
+
+	w.Header().Set("X-New-2FA-Session-ID", session.SessionID)
+	writeJSON(w, http.StatusUnauthorized, AuthResponse{
+		Success:       false,
+		Message:       "2FA verification required. Please provide your authentication code.",
+		Requires2FA:   true,
+		TempSessionID: session.SessionID,
+		SecondFactors: factors,
+	})
+}
+
+// serveAsUser loads the session's user into the request context and proceeds
+func (am *AuthMiddleware) serveAsUser(w http.ResponseWriter, r *http.Request, next http.Handler, userID int) {
+	user, err := am.userService.GetUser(r.Context(), userID)
+	if err != nil {
+		writeJSONError(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+	if !user.Active {
+		writeJSONError(w, "Account deactivated", http.StatusUnauthorized)
+		return
+	}
+
+	user.PasswordHash = ""
+	next.ServeHTTP(w, r.WithContext(middleware.SetUserContext(r.Context(), user)))
+}
+
+// IDFromRequest reads the session ID from either supported header, falling
+// back to the session cookie; empty for basic auth
+func IDFromRequest(r *http.Request) string {
+	if sessionID := headerID(r); sessionID != "" {
+		return sessionID
+	}
+	return cookieID(r)
+}
+
+// clientFromRequest describes the device and address a login comes from
+func clientFromRequest(r *http.Request) Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return Client{UserAgent: r.UserAgent(), IPAddress: ip}
+}
+
+func headerID(r *http.Request) string {
+	if sessionID := r.Header.Get("X-2FA-Session-ID"); sessionID != "" {
+		return sessionID
+	}
+	return r.Header.Get("X-Session-ID")
+}
+
+// authenticateUser validates username and password, refusing deactivated
+// accounts once the password is right. Failures are recorded as login
+// events by method; callers record the successes, which may still need a
+// second factor.
+func authenticateUser(r *http.Request, userService *services.UserService, logins *services.LoginEventService, method, username, password string) (*models.User, error) {
+	user, err := userService.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			metrics.FailedLogin()
+			RecordLogin(r, logins, 0, username, method, models.LOGIN_FAILURE_UNKNOWN_USER, false)
+		}
+		return nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		metrics.FailedLogin()
+		RecordLogin(r, logins, user.UserID, user.Username, method, models.LOGIN_FAILURE_PASSWORD, false)
+		return nil, err
+	}
+	if !user.Active {
+		RecordLogin(r, logins, user.UserID, user.Username, method, models.LOGIN_FAILURE_DEACTIVATED, false)
+		return nil, services.ErrUserDeactivated
+	}
+
+	return user, nil
+}
+
+// RecordLogin records an authentication attempt made with r, which failed
+// for reason unless it is empty. userID is zero when username matched no
+// account; completed is as for LoginEventService.Record. A failure to record
+// is logged rather than failing the login.
+func RecordLogin(r *http.Request, logins *services.LoginEventService, userID int, username, method, reason string, completed bool) {
+	client := clientFromRequest(r)
+	event := &models.LoginEvent{UserID: userID, Username: username, Method: method, Success: reason == "",
+		FailureReason: reason, IPAddress: client.IPAddress, UserAgent: client.UserAgent}
+	if err := logins.Record(r.Context(), event, completed); err != nil {
+		log.Printf("Failed to record login event for %s: %v", username, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	response.WriteJSON(w, statusCode, body)
+}
+
+func writeJSONError(w http.ResponseWriter, message string, statusCode int) {
+	writeJSON(w, statusCode, AuthResponse{
+		Success: false,
+		Message: message,
+		Error: &response.ErrorBody{
+			Code:    response.CodeForStatus(statusCode),
+			Message: message,
+		},
+	})
+}
@@ -0,0 +1,378 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/logging"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// errSessionGone is returned when updating a session that ended meanwhile
+var errSessionGone = errors.New("session no longer exists")
+
+// RedisOptions configures a RedisStore
+type RedisOptions struct {
+	// URL is a redis:// or rediss:// URL, e.g. redis://:secret@redis:6379/0;
+	// empty keeps sessions in memory
+	URL string
+	// KeyPrefix namespaces the store's keys, so servers sharing a Redis
+	// must use the same prefix to share sessions
+	KeyPrefix string
+	// Timeout bounds connecting and each command
+	Timeout time.Duration
+}
+
+// RedisStore keeps sessions in Redis so every server behind a load balancer
+// sees the same logins. Each session is a JSON value that expires with it;
+// sorted sets of session IDs scored by expiry index them by user and
+// overall.
+//
+// The Store interface has no errors, so a failing Redis is logged and reads
+// as no session: requests are refused rather than let through.
+type RedisStore struct {
+	client     *redis.Client
+	prefix     string
+	maxPerUser int
+	lifetimes  Lifetimes
+}
+
+// redisSession is a session as stored, which unlike the API shape includes
+// the CSRF token. The last access is kept under its own key so recording it
+// can't undo a concurrent MarkAuthenticated.
+type redisSession struct {
+	Session
+	CSRFToken string `json:"csrfToken"`
+}
+
+// NewRedisStore connects to the Redis in opts and checks it answers. Like
+// MemoryStore, maxPerUser caps a user's authenticated sessions.
+func NewRedisStore(opts RedisOptions, maxPerUser int, lifetimes Lifetimes) (*RedisStore, error) {
+	options, err := redis.ParseURL(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeout > 0 {
+		options.DialTimeout = opts.Timeout
+		options.ReadTimeout = opts.Timeout
+		options.WriteTimeout = opts.Timeout
+	}
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &RedisStore{client: client, prefix: opts.KeyPrefix, maxPerUser: maxPerUser, lifetimes: lifetimes}, nil
+}
+
+// Create creates a new session, pending unless authenticated is true
+func (s *RedisStore) Create(user *models.User, authenticated bool, client Client) (*Session, error) {
+	session, err := newSession(user, authenticated, client, s.lifetimes)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(session, "NX"); err != nil {
+		return nil, err
+	}
+	if authenticated {
+		s.enforceLimit(user.UserID)
+	}
+
+	log.Printf("Created session %s for user %d (%s), expires at %s", logging.Fingerprint(session.SessionID), user.UserID, user.Username, session.ExpiresAt.Format(time.RFC3339))
+	return session, nil
+}
+
+// Get retrieves a live session by ID and records the access. Sessions left
+// idle past the idle timeout are ended.
+func (s *RedisStore) Get(sessionID string) (*Session, bool) {
+	session := s.load(sessionID)
+	if session == nil {
+		return nil, false
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	if s.lifetimes.IdleTimeout > 0 {
+		get := s.client.Get(ctx, s.seenKey(sessionID))
+		s.check(get)
+		if millis, err := get.Int64(); err == nil {
+			session.LastAccessedAt = time.UnixMilli(millis)
+		}
+		if s.lifetimes.idle(session, now) {
+			s.Delete(sessionID)
+			return nil, false
+		}
+	}
+
+	session.LastAccessedAt = now
+	s.check(s.client.Set(ctx, s.seenKey(sessionID), now.UnixMilli(), time.Until(session.ExpiresAt)))
+	return session, true
+}
+
+// MarkAuthenticated marks a pending session as fully authenticated
+func (s *RedisStore) MarkAuthenticated(sessionID string) (string, bool) {
+	session := s.load(sessionID)
+	if session == nil || session.Authenticated {
+		return "", false
+	}
+
+	now := time.Now()
+	session.Authenticated = true
+	session.LastAccessedAt = now
+	session.ExpiresAt = s.lifetimes.expiry(session.CreatedAt, now)
+	// XX: a session ended meanwhile stays ended
+	if err := s.save(session, "XX"); err != nil {
+		return "", false
+	}
+	log.Printf("Marked session %s as authenticated, extended expiry to %s", logging.Fingerprint(sessionID), session.ExpiresAt.Format(time.RFC3339))
+	s.enforceLimit(session.UserID)
+	return sessionID, true
+}
+
+// Renew extends an authenticated session's expiry to its lifetime from
+// now, capped at its maximum age
+func (s *RedisStore) Renew(sessionID string) (*Session, bool) {
+	session := s.load(sessionID)
+	if session == nil || !session.Authenticated {
+		return nil, false
+	}
+
+	now := time.Now()
+	session.ExpiresAt = s.lifetimes.expiry(session.CreatedAt, now)
+	if err := s.save(session, "XX"); err != nil {
+		return nil, false
+	}
+	// The last access expires with the session, so it moves too
+	session.LastAccessedAt = now
+	s.check(s.client.Set(context.Background(), s.seenKey(sessionID), now.UnixMilli(), time.Until(session.ExpiresAt)))
+	return session, true
+}
+
+// enforceLimit ends a user's oldest authenticated sessions until they are
+// within maxPerUser. Servers logging the same user in at once may both end
+// sessions, leaving fewer than the limit, never more.
+func (s *RedisStore) enforceLimit(userID int) {
+	if s.maxPerUser <= 0 {
+		return
+	}
+
+	live := s.List(userID)
+	if len(live) <= s.maxPerUser {
+		return
+	}
+	// List is newest first
+	for _, session := range live[s.maxPerUser:] {
+		s.Delete(session.SessionID)
+		log.Printf("Ended session %s of user %d: over the limit of %d sessions", logging.Fingerprint(session.SessionID), userID, s.maxPerUser)
+	}
+}
+
+// List returns a user's live authenticated sessions, newest first
+func (s *RedisStore) List(userID int) []Session {
+	ctx := context.Background()
+	userKey := s.userKey(userID)
+	s.check(s.client.ZRemRangeByScore(ctx, userKey, "-inf", nowMillis()))
+	ids := s.members(userKey)
+	sessions := []Session{}
+	if len(ids) == 0 {
+		return sessions
+	}
+
+	keys := make([]string, 0, 2*len(ids))
+	for _, id := range ids {
+		keys = append(keys, s.sessionKey(id))
+	}
+	for _, id := range ids {
+		keys = append(keys, s.seenKey(id))
+	}
+	get := s.client.MGet(ctx, keys...)
+	s.check(get)
+	values := get.Val()
+	if len(values) != len(keys) {
+		return sessions
+	}
+
+	for i, id := range ids {
+		data, _ := values[i].(string)
+		if data == "" {
+			s.check(s.client.ZRem(ctx, userKey, id))
+			continue
+		}
+		session, err := decodeSession(data)
+		if err != nil {
+			log.Printf("Redis session store: session %s: %v", logging.Fingerprint(id), err)
+			continue
+		}
+		if seen, _ := values[len(ids)+i].(string); seen != "" {
+			if millis, err := strconv.ParseInt(seen, 10, 64); err == nil {
+				session.LastAccessedAt = time.UnixMilli(millis)
+			}
+		}
+		if session.Authenticated && time.Now().Before(session.ExpiresAt) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions
+}
+
+// Delete removes a session
+func (s *RedisStore) Delete(sessionID string) {
+	ctx := context.Background()
+	session := s.load(sessionID)
+	del := s.client.Del(ctx, s.sessionKey(sessionID), s.seenKey(sessionID))
+	if s.check(del); del.Val() > 0 {
+		log.Printf("Deleted session %s", logging.Fingerprint(sessionID))
+	}
+	s.check(s.client.ZRem(ctx, s.allKey(), sessionID))
+	if session != nil {
+		s.check(s.client.ZRem(ctx, s.userKey(session.UserID), sessionID))
+	}
+}
+
+// DeleteUser removes every session of a user and returns how many were removed
+func (s *RedisStore) DeleteUser(userID int) int {
+	ctx := context.Background()
+	userKey := s.userKey(userID)
+	count := 0
+	for _, id := range s.members(userKey) {
+		del := s.client.Del(ctx, s.sessionKey(id), s.seenKey(id))
+		if s.check(del); del.Val() > 0 {
+			count++
+		}
+		s.check(s.client.ZRem(ctx, s.allKey(), id))
+	}
+	s.check(s.client.Del(ctx, userKey))
+	if count > 0 {
+		log.Printf("Deleted %d session(s) of user %d", count, userID)
+	}
+	return count
+}
+
+// Count returns the current number of sessions across every server
+func (s *RedisStore) Count() int {
+	ctx := context.Background()
+	s.check(s.client.ZRemRangeByScore(ctx, s.allKey(), "-inf", nowMillis()))
+	count := s.client.ZCard(ctx, s.allKey())
+	s.check(count)
+	return int(count.Val())
+}
+
+// Clear removes every session and returns how many were removed
+func (s *RedisStore) Clear() int {
+	ctx := context.Background()
+	count := s.Count()
+	ids := s.members(s.allKey())
+	for start := 0; start < len(ids); start += 500 {
+		var keys []string
+		for _, id := range ids[start:min(start+500, len(ids))] {
+			keys = append(keys, s.sessionKey(id), s.seenKey(id))
+		}
+		s.check(s.client.Del(ctx, keys...))
+	}
+	s.check(s.client.Del(ctx, s.allKey()))
+
+	userKeys := s.client.Scan(ctx, 0, s.userKeyPrefix()+"*", 500).Iterator()
+	var keys []string
+	for userKeys.Next(ctx) {
+		keys = append(keys, userKeys.Val())
+	}
+	if err := userKeys.Err(); err != nil {
+		log.Printf("Redis session store: scan: %v", err)
+	}
+	for start := 0; start < len(keys); start += 500 {
+		s.check(s.client.Del(ctx, keys[start:min(start+500, len(keys))]...))
+	}
+	return count
+}
+
+// save writes a session, with mode NX for a new one and XX to update one
+// that must still exist, and indexes it by expiry
+func (s *RedisStore) save(session *Session, mode string) error {
+	data, err := json.Marshal(redisSession{Session: *session, CSRFToken: session.CSRFToken})
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return errSessionGone
+	}
+	ctx := context.Background()
+	err = s.client.SetArgs(ctx, s.sessionKey(session.SessionID), data, redis.SetArgs{Mode: mode, TTL: ttl}).Err()
+	if errors.Is(err, redis.Nil) {
+		return errSessionGone
+	} else if err != nil {
+		log.Printf("Redis session store: %v", err)
+		return err
+	}
+
+	userKey := s.userKey(session.UserID)
+	entry := redis.Z{Score: float64(session.ExpiresAt.UnixMilli()), Member: session.SessionID}
+	s.check(s.client.ZAdd(ctx, s.allKey(), entry))
+	s.check(s.client.ZAdd(ctx, userKey, entry))
+	// The user index outlives the session saved last, then goes
+	s.check(s.client.PExpire(ctx, userKey, max(s.lifetimes.Pending, s.lifetimes.Authenticated)))
+	return nil
+}
+
+// load returns a live session, or nil if there is none or Redis failed
+func (s *RedisStore) load(sessionID string) *Session {
+	get := s.client.Get(context.Background(), s.sessionKey(sessionID))
+	s.check(get)
+	data := get.Val()
+	if data == "" {
+		return nil
+	}
+	session, err := decodeSession(data)
+	if err != nil {
+		log.Printf("Redis session store: session %s: %v", logging.Fingerprint(sessionID), err)
+		return nil
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil
+	}
+	return session
+}
+
+// check logs a command's failure; a missing key isn't one. The command's
+// value is then its zero value, which reads as no session.
+func (s *RedisStore) check(cmd redis.Cmder) {
+	if err := cmd.Err(); err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Redis session store: %s: %v", cmd.Name(), err)
+	}
+}
+
+// members returns the session IDs in an index
+func (s *RedisStore) members(key string) []string {
+	ids := s.client.ZRange(context.Background(), key, 0, -1)
+	s.check(ids)
+	return ids.Val()
+}
+
+func (s *RedisStore) sessionKey(sessionID string) string { return s.prefix + "session:" + sessionID }
+func (s *RedisStore) seenKey(sessionID string) string    { return s.prefix + "session-seen:" + sessionID }
+func (s *RedisStore) userKey(userID int) string          { return s.userKeyPrefix() + strconv.Itoa(userID) }
+func (s *RedisStore) userKeyPrefix() string              { return s.prefix + "user-sessions:" }
+func (s *RedisStore) allKey() string                     { return s.prefix + "sessions" }
+
+func decodeSession(data string) (*Session, error) {
+	var stored redisSession
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, err
+	}
+	session := stored.Session
+	session.CSRFToken = stored.CSRFToken
+	return &session, nil
+}
+
+// nowMillis is the index score of sessions expiring now
+func nowMillis() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// newTestRedisStore returns a RedisStore on an in-process Redis, which the
+// test can fast-forward to expire keys
+func newTestRedisStore(t *testing.T, maxPerUser int, lifetimes Lifetimes) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store, err := NewRedisStore(RedisOptions{URL: "redis://" + server.Addr() + "/0", KeyPrefix: "test:", Timeout: time.Second}, maxPerUser, lifetimes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.client.Close() })
+	return store, server
+}
+
+func TestRedisStoreLogin(t *testing.T) {
+	store, _ := newTestRedisStore(t, 0, DefaultLifetimes)
+	user := &models.User{UserID: 1, Username: "dr.who", Role: models.ROLE_DOCTOR}
+
+	pending, err := store.Create(user, false, Client{UserAgent: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions := store.List(user.UserID); len(sessions) != 0 {
+		t.Fatalf("a pending session was listed: %+v", sessions)
+	}
+
+	if _, ok := store.MarkAuthenticated(pending.SessionID); !ok {
+		t.Fatal("the pending session wasn't authenticated")
+	}
+	if _, ok := store.MarkAuthenticated(pending.SessionID); ok {
+		t.Fatal("an authenticated session was authenticated again")
+	}
+	session, ok := store.Get(pending.SessionID)
+	if !ok {
+		t.Fatal("the authenticated session wasn't found")
+	}
+	if !session.Authenticated || !session.CreatedAt.Equal(pending.CreatedAt) || session.CSRFToken != pending.CSRFToken {
+		t.Fatalf("authenticated %+v from %+v", session, pending)
+	}
+	if sessions := store.List(user.UserID); len(sessions) != 1 || sessions[0].SessionID != pending.SessionID {
+		t.Fatalf("listed %+v", sessions)
+	}
+
+	store.Delete(pending.SessionID)
+	if _, ok := store.Get(pending.SessionID); ok {
+		t.Fatal("the deleted session was found")
+	}
+	if count := store.Count(); count != 0 {
+		t.Fatalf("%d sessions left", count)
+	}
+}
+
+func TestRedisStoreExpiry(t *testing.T) {
+	lifetimes := DefaultLifetimes
+	lifetimes.IdleTimeout = 10 * time.Minute
+	store, server := newTestRedisStore(t, 0, lifetimes)
+	user := &models.User{UserID: 1, Username: "dr.who", Role: models.ROLE_DOCTOR}
+
+	pending, err := store.Create(user, false, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.FastForward(lifetimes.Pending)
+	if _, ok := store.MarkAuthenticated(pending.SessionID); ok {
+		t.Fatal("an expired pending session was authenticated")
+	}
+
+	session, err := store.Create(user, true, Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The idle timeout is checked against the last access Get recorded
+	if _, ok := store.Get(session.SessionID); !ok {
+		t.Fatal("the new session wasn't found")
+	}
+	if err := server.Set(store.seenKey(session.SessionID), "0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get(session.SessionID); ok {
+		t.Fatal("an idle session was found")
+	}
+	if _, ok := store.Get(session.SessionID); ok {
+		t.Fatal("the idle session wasn't ended")
+	}
+}
+
+func TestRedisStoreLimit(t *testing.T) {
+	store, _ := newTestRedisStore(t, 2, DefaultLifetimes)
+	user := &models.User{UserID: 1, Username: "dr.who", Role: models.ROLE_DOCTOR}
+	other := &models.User{UserID: 2, Username: "nurse.joy", Role: models.ROLE_NURSE}
+
+	var sessions []*Session
+	for range 3 {
+		session, err := store.Create(user, true, Client{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+		// List orders by creation time
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := store.Create(other, true, Client{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.Get(sessions[0].SessionID); ok {
+		t.Fatal("the oldest session outlived the limit")
+	}
+	listed := store.List(user.UserID)
+	if len(listed) != 2 || listed[0].SessionID != sessions[2].SessionID || listed[1].SessionID != sessions[1].SessionID {
+		t.Fatalf("listed %+v, want the two newest sessions", listed)
+	}
+
+	if deleted := store.DeleteUser(user.UserID); deleted != 2 {
+		t.Fatalf("DeleteUser removed %d sessions, want 2", deleted)
+	}
+	if count := store.Count(); count != 1 {
+		t.Fatalf("%d sessions left, want the other user's", count)
+	}
+	if cleared := store.Clear(); cleared != 1 || store.Count() != 0 {
+		t.Fatalf("Clear removed %d sessions, want 1", cleared)
+	}
+}
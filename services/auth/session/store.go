@@ -0,0 +1,304 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/logging"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// Session is a login session. It starts pending (password verified) and
+// becomes Authenticated once the second factor has been verified. CreatedAt
+// is when the password was verified, and a session's maximum age counts
+// from it.
+type Session struct {
+	SessionID      string    `json:"sessionId"`
+	UserID         int       `json:"userId"`
+	Username       string    `json:"username"`
+	Role           string    `json:"role"`
+	FullName       string    `json:"fullName"`
+	TwoFAEnabled   bool      `json:"twoFactorEnabled"`
+	Authenticated  bool      `json:"authenticated"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastAccessedAt time.Time `json:"lastAccessedAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	UserAgent      string    `json:"userAgent,omitempty"`
+	IPAddress      string    `json:"ipAddress,omitempty"`
+	// CSRFToken must accompany state-changing requests that authenticate
+	// with the session cookie
+	CSRFToken string `json:"-"`
+}
+
+// Client describes where a session was started from
+type Client struct {
+	UserAgent string
+	IPAddress string
+}
+
+// Store persists sessions. Implementations must be safe for concurrent use
+// and return copies so callers can't mutate stored sessions.
+//
+// MarkAuthenticated only promotes pending sessions, keeping their CreatedAt,
+// and returns the ID the session goes by from then on, and
+// Renew the renewed session, whose ID is the same one unless the ID itself
+// carries the session's state.
+type Store interface {
+	Create(user *models.User, authenticated bool, client Client) (*Session, error)
+	Get(sessionID string) (*Session, bool)
+	MarkAuthenticated(sessionID string) (string, bool)
+	Renew(sessionID string) (*Session, bool)
+	List(userID int) []Session
+	Delete(sessionID string)
+	DeleteUser(userID int) int
+	Count() int
+	Clear() int
+}
+
+// MemoryStore keeps sessions in process memory
+type MemoryStore struct {
+	sessions map[string]*Session
+	mutex    sync.RWMutex
+	// maxPerUser caps a user's authenticated sessions; the oldest is ended
+	// when another login completes. Zero means no limit.
+	maxPerUser int
+	lifetimes  Lifetimes
+}
+
+func NewMemoryStore(maxPerUser int, lifetimes Lifetimes) *MemoryStore {
+	store := &MemoryStore{
+		sessions:   make(map[string]*Session),
+		maxPerUser: maxPerUser,
+		lifetimes:  lifetimes,
+	}
+
+	// Start cleanup goroutine
+	go store.cleanup()
+	return store
+}
+
+// Create creates a new session, pending unless authenticated is true
+func (s *MemoryStore) Create(user *models.User, authenticated bool, client Client) (*Session, error) {
+	session, err := newSession(user, authenticated, client, s.lifetimes)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.sessions[session.SessionID] = session
+	if authenticated {
+		s.enforceLimit(user.UserID)
+	}
+	s.mutex.Unlock()
+
+	log.Printf("Created session %s for user %d (%s), expires at %s", logging.Fingerprint(session.SessionID), user.UserID, user.Username, session.ExpiresAt.Format(time.RFC3339))
+	copy := *session
+	return &copy, nil
+}
+
+// Get retrieves a live session by ID and records the access. Sessions left
+// idle past the idle timeout are ended.
+func (s *MemoryStore) Get(sessionID string) (*Session, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return nil, false
+	}
+
+	now := time.Now()
+	if now.After(session.ExpiresAt) || s.lifetimes.idle(session, now) {
+		delete(s.sessions, sessionID)
+		return nil, false
+	}
+
+	session.LastAccessedAt = now
+	copy := *session
+	return &copy, true
+}
+
+// MarkAuthenticated marks a pending session as fully authenticated
+func (s *MemoryStore) MarkAuthenticated(sessionID string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists || session.Authenticated || time.Now().After(session.ExpiresAt) {
+		return "", false
+	}
+
+	session.Authenticated = true
+	session.ExpiresAt = s.lifetimes.expiry(session.CreatedAt, time.Now())
+	log.Printf("Marked session %s as authenticated, extended expiry to %s", logging.Fingerprint(sessionID), session.ExpiresAt.Format(time.RFC3339))
+	s.enforceLimit(session.UserID)
+	return sessionID, true
+}
+
+// Renew extends an authenticated session's expiry to its lifetime from
+// now, capped at its maximum age
+func (s *MemoryStore) Renew(sessionID string) (*Session, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists || !session.Authenticated || time.Now().After(session.ExpiresAt) {
+		return nil, false
+	}
+
+	session.ExpiresAt = s.lifetimes.expiry(session.CreatedAt, time.Now())
+	copy := *session
+	return &copy, true
+}
+
+// enforceLimit ends a user's oldest authenticated sessions until they are
+// within maxPerUser. The caller holds the lock.
+func (s *MemoryStore) enforceLimit(userID int) {
+	if s.maxPerUser <= 0 {
+		return
+	}
+
+	now := time.Now()
+	var live []*Session
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Authenticated && now.Before(session.ExpiresAt) {
+			live = append(live, session)
+		}
+	}
+	if len(live) <= s.maxPerUser {
+		return
+	}
+
+	sort.Slice(live, func(i, j int) bool { return live[i].CreatedAt.Before(live[j].CreatedAt) })
+	for _, session := range live[:len(live)-s.maxPerUser] {
+		delete(s.sessions, session.SessionID)
+		log.Printf("Ended session %s of user %d: over the limit of %d sessions", logging.Fingerprint(session.SessionID), userID, s.maxPerUser)
+	}
+}
+
+// List returns a user's live authenticated sessions, newest first
+func (s *MemoryStore) List(userID int) []Session {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	sessions := []Session{}
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.Authenticated && now.Before(session.ExpiresAt) {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions
+}
+
+// Delete removes a session
+func (s *MemoryStore) Delete(sessionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.sessions[sessionID]; exists {
+		log.Printf("Deleted session %s", logging.Fingerprint(sessionID))
+	}
+	delete(s.sessions, sessionID)
+}
+
+// DeleteUser removes every session of a user and returns how many were removed
+func (s *MemoryStore) DeleteUser(userID int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	count := 0
+	for sessionID, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, sessionID)
+			count++
+		}
+	}
+	if count > 0 {
+		log.Printf("Deleted %d session(s) of user %d", count, userID)
+	}
+	return count
+}
+
+// Count returns the current number of sessions
+func (s *MemoryStore) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.sessions)
+}
+
+// Clear removes every session and returns how many were removed
+func (s *MemoryStore) Clear() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	count := len(s.sessions)
+	s.sessions = make(map[string]*Session)
+	return count
+}
+
+// cleanup removes expired sessions
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mutex.Lock()
+		now := time.Now()
+		expiredCount := 0
+		for sessionID, session := range s.sessions {
+			if now.After(session.ExpiresAt) {
+				delete(s.sessions, sessionID)
+				expiredCount++
+			}
+		}
+		if expiredCount > 0 {
+			log.Printf("Cleaned up %d expired sessions", expiredCount)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// newSession starts a session for user with new random session ID and CSRF
+// token, expiring after the pending or authenticated lifetime
+func newSession(user *models.User, authenticated bool, client Client, lifetimes Lifetimes) (*Session, error) {
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		SessionID:      sessionID,
+		UserID:         user.UserID,
+		Username:       user.Username,
+		Role:           user.Role,
+		FullName:       user.FullName,
+		TwoFAEnabled:   user.TwoFAEnabled,
+		Authenticated:  authenticated,
+		CreatedAt:      now,
+		LastAccessedAt: now,
+		ExpiresAt:      now.Add(lifetimes.Pending),
+		UserAgent:      client.UserAgent,
+		IPAddress:      client.IPAddress,
+		CSRFToken:      csrfToken,
+	}
+	if authenticated {
+		session.ExpiresAt = lifetimes.expiry(now, now)
+	}
+	return session, nil
+}
+
+func newSessionID() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,270 @@
+package session
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+// tokenIssuer marks the JWTs this server signs as session tokens
+const tokenIssuer = "simple-hospital/session"
+
+// MinTokenSecretLength is the shortest secret TokenStore accepts, in bytes
+const MinTokenSecretLength = 32
+
+// TokenStore keeps no sessions at all: the session ID is a JWT signed with
+// a secret the servers share, carrying the user, their role and whether the
+// second factor has been verified. Any server holding the secret can check
+// it, so replicas need neither sticky sessions nor a shared session store.
+// Completing the second factor swaps the pending token for a new one, and
+// so does renewing it; a renewed token keeps the token ID, so revoking
+// either ends both.
+//
+// Tokens can't be deleted, so ending them early goes through the revocation
+// list in the database, checked on every request. With nothing to
+// enumerate, List is always empty and Count and the counts returned by
+// DeleteUser and Clear are zero. The claims only describe the session: the
+// user's role and account status are read from the database per request.
+type TokenStore struct {
+	secret      []byte
+	revocations *services.SessionRevocationService
+	lifetimes   Lifetimes
+}
+
+// tokenClaims is the payload of a session token. The subject is the user
+// ID. AuthTime is when the session was authenticated, which a renewed
+// token's IssuedAt isn't; tokens signed before renewal existed lack it.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Username      string           `json:"username"`
+	Role          string           `json:"role"`
+	FullName      string           `json:"name"`
+	TwoFAEnabled  bool             `json:"2fa"`
+	Authenticated bool             `json:"authenticated"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+}
+
+// NewTokenStore signs tokens with secret, at least MinTokenSecretLength
+// bytes, which every server must share. The idle timeout of lifetimes isn't
+// enforced.
+func NewTokenStore(secret []byte, revocations *services.SessionRevocationService, lifetimes Lifetimes) *TokenStore {
+	return &TokenStore{secret: secret, revocations: revocations, lifetimes: lifetimes}
+}
+
+// Create signs a new session token, pending unless authenticated is true.
+// The client isn't recorded.
+func (s *TokenStore) Create(user *models.User, authenticated bool, client Client) (*Session, error) {
+	session, err := newSession(user, authenticated, client, s.lifetimes)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sign(session); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Issued session token for user %d (%s), expires at %s", user.UserID, user.Username, session.ExpiresAt.Format(time.RFC3339))
+	return session, nil
+}
+
+// Get verifies a session token and returns its session unless it has
+// expired or been revoked
+func (s *TokenStore) Get(sessionID string) (*Session, bool) {
+	claims := s.verify(sessionID)
+	if claims == nil {
+		return nil, false
+	}
+
+	userID, _ := strconv.Atoi(claims.Subject)
+	createdAt := claims.IssuedAt.Time
+	if claims.AuthTime != nil {
+		createdAt = claims.AuthTime.Time
+	}
+	revoked, err := s.revocations.Revoked(context.Background(), claims.ID, userID, claims.IssuedAt.Time)
+	if err != nil {
+		log.Printf("Session token store: checking revocations: %v", err)
+		return nil, false
+	}
+	if revoked {
+		return nil, false
+	}
+
+	return &Session{
+		SessionID:      sessionID,
+		UserID:         userID,
+		Username:       claims.Username,
+		Role:           claims.Role,
+		FullName:       claims.FullName,
+		TwoFAEnabled:   claims.TwoFAEnabled,
+		Authenticated:  claims.Authenticated,
+		CreatedAt:      createdAt,
+		LastAccessedAt: time.Now(),
+		ExpiresAt:      claims.ExpiresAt.Time,
+		CSRFToken:      s.csrfToken(claims.ID),
+	}, true
+}
+
+// MarkAuthenticated exchanges a pending session token for an authenticated
+// one, which the caller must hand to the client. The pending token is
+// revoked so it can't be exchanged again.
+func (s *TokenStore) MarkAuthenticated(sessionID string) (string, bool) {
+	session, exists := s.Get(sessionID)
+	if !exists || session.Authenticated {
+		return "", false
+	}
+	claims := s.verify(sessionID)
+	if claims == nil {
+		return "", false
+	}
+	if err := s.revocations.Revoke(context.Background(), claims.ID, claims.ExpiresAt.Time); err != nil {
+		log.Printf("Session token store: revoking: %v", err)
+		return "", false
+	}
+
+	session.Authenticated = true
+	session.ExpiresAt = s.lifetimes.expiry(session.CreatedAt, time.Now())
+	var err error
+	if session.SessionID, err = newSessionID(); err != nil {
+		return "", false
+	}
+	if err := s.sign(session); err != nil {
+		log.Printf("Session token store: signing: %v", err)
+		return "", false
+	}
+
+	log.Printf("Issued authenticated session token for user %d, expires at %s", session.UserID, session.ExpiresAt.Format(time.RFC3339))
+	return session.SessionID, true
+}
+
+// Renew signs a new token for an authenticated session, expiring its
+// lifetime from now capped at its maximum age, which the caller must hand to
+// the client. The token ID, and so the CSRF token, stays the same.
+func (s *TokenStore) Renew(sessionID string) (*Session, bool) {
+	session, exists := s.Get(sessionID)
+	if !exists || !session.Authenticated {
+		return nil, false
+	}
+
+	claims := s.verify(sessionID)
+	if claims == nil {
+		return nil, false
+	}
+	session.ExpiresAt = s.lifetimes.expiry(session.CreatedAt, time.Now())
+	session.SessionID = claims.ID
+	if err := s.sign(session); err != nil {
+		log.Printf("Session token store: signing: %v", err)
+		return nil, false
+	}
+	return session, true
+}
+
+// List returns nothing: tokens aren't kept anywhere to list
+func (s *TokenStore) List(userID int) []Session {
+	return []Session{}
+}
+
+// Delete revokes a session token until it, or any renewal of it issued so
+// far, would have expired
+func (s *TokenStore) Delete(sessionID string) {
+	claims := s.verify(sessionID)
+	if claims == nil {
+		return
+	}
+	authTime := claims.IssuedAt.Time
+	if claims.AuthTime != nil {
+		authTime = claims.AuthTime.Time
+	}
+	until := claims.ExpiresAt.Time
+	if renewed := s.lifetimes.expiry(authTime, time.Now()); claims.Authenticated && renewed.After(until) {
+		until = renewed
+	}
+	if err := s.revocations.Revoke(context.Background(), claims.ID, until); err != nil {
+		log.Printf("Session token store: revoking: %v", err)
+		return
+	}
+	log.Printf("Revoked session token %s of user %s", claims.ID, claims.Subject)
+}
+
+// DeleteUser revokes every token issued to a user so far
+func (s *TokenStore) DeleteUser(userID int) int {
+	if err := s.revocations.RevokeUser(context.Background(), userID); err != nil {
+		log.Printf("Session token store: revoking user %d: %v", userID, err)
+		return 0
+	}
+	log.Printf("Revoked the session tokens of user %d", userID)
+	return 0
+}
+
+// Count returns zero: tokens aren't counted
+func (s *TokenStore) Count() int {
+	return 0
+}
+
+// Clear revokes every token issued so far
+func (s *TokenStore) Clear() int {
+	if err := s.revocations.RevokeAll(context.Background()); err != nil {
+		log.Printf("Session token store: revoking all: %v", err)
+		return 0
+	}
+	log.Printf("Revoked every session token")
+	return 0
+}
+
+// sign replaces the session's ID with a token carrying it. The random ID
+// newSession made becomes the token's ID, which revocations refer to.
+func (s *TokenStore) sign(session *Session) error {
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   strconv.Itoa(session.UserID),
+			ID:        session.SessionID,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+		},
+		AuthTime:      jwt.NewNumericDate(session.CreatedAt),
+		Username:      session.Username,
+		Role:          session.Role,
+		FullName:      session.FullName,
+		TwoFAEnabled:  session.TwoFAEnabled,
+		Authenticated: session.Authenticated,
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return err
+	}
+
+	session.CSRFToken = s.csrfToken(claims.ID)
+	session.SessionID = token
+	return nil
+}
+
+// verify returns the claims of a token this store signed that hasn't
+// expired, or nil
+func (s *TokenStore) verify(token string) *tokenClaims {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) { return s.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil || claims.ID == "" || claims.IssuedAt == nil {
+		return nil
+	}
+	return &claims
+}
+
+// csrfToken derives a session's CSRF token from its token ID, so it needn't
+// be stored
+func (s *TokenStore) csrfToken(tokenID string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("csrf:" + tokenID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -1,18 +1,25 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"image/png"
 	"log"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/metrics"
 	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
 )
@@ -23,45 +30,26 @@ func NewTwoFAService() *TwoFAService {
 	return &TwoFAService{}
 }
 
-// GenerateTwoFASetup generates 2FA setup information for a user
-func (s *TwoFAService) GenerateTwoFASetup(username string) (*models.TwoFASetup, error) {
-	// First check if user already has a secret
-	var existingSecret string
-	query := `SELECT two_fa_secret FROM Users WHERE username = ?`
-	err := database.GetDB().QueryRow(query, username).Scan(&existingSecret)
-
-	var secretKey string
-	if err != nil || existingSecret == "" {
-		// Generate a new secret key only if user doesn't have one
-		key, err := totp.Generate(totp.GenerateOpts{
-			Issuer:      "Hospital System",
-			AccountName: username,
-			Algorithm:   otp.AlgorithmSHA1,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate 2FA key: %v", err)
-		}
-		secretKey = key.Secret()
-
-		// Store the secret in database for future use
-		updateQuery := `UPDATE Users SET two_fa_secret = ? WHERE username = ?`
-		_, err = database.GetDB().Exec(updateQuery, secretKey, username)
-		if err != nil {
-			return nil, fmt.Errorf("failed to store 2FA secret: %v", err)
-		}
-	} else {
-		// Reuse existing secret
-		secretKey = existingSecret
+// GenerateTwoFASetup generates a new TOTP secret for a user to enroll. The
+// secret is only stored once EnableTwoFA confirms a code for it, so the
+// user's current secret is neither returned nor replaced here.
+func (s *TwoFAService) GenerateTwoFASetup(ctx context.Context, username string) (*models.TwoFASetup, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      "Hospital System",
+		AccountName: username,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate 2FA key: %v", err)
 	}
 
-	// Generate QR code as base64 using the secret directly
-	qrCode, err := s.generateQRCodeFromSecret(secretKey, username)
+	qrCode, err := s.generateQRCodeBase64(key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate QR code: %v", err)
 	}
 
 	setup := &models.TwoFASetup{
-		SecretKey:   secretKey,
+		SecretKey:   key.Secret(),
 		QRCodeUrl:   "data:image/png;base64," + qrCode,
 		BackupCodes: []string{}, // Empty during setup, filled during enable
 	}
@@ -70,9 +58,8 @@ func (s *TwoFAService) GenerateTwoFASetup(username string) (*models.TwoFASetup,
 }
 
 // EnableTwoFA enables 2FA for a user after verifying the code
-func (s *TwoFAService) EnableTwoFA(userID int, secret string, code string) ([]string, error) {
-	log.Printf("Enabling 2FA for user %d with code: %s", userID, code)
-	log.Printf("Secret: %s", secret)
+func (s *TwoFAService) EnableTwoFA(ctx context.Context, userID int, secret string, code string) ([]string, error) {
+	log.Printf("Enabling 2FA for user %d", userID)
 	log.Printf("Current server time: %s", time.Now().Format(time.RFC3339))
 
 	// Verify the TOTP code with time window tolerance
@@ -86,7 +73,6 @@ func (s *TwoFAService) EnableTwoFA(userID int, secret string, code string) ([]st
 			if err != nil {
 				continue
 			}
-			log.Printf("Testing code %s for time offset %d (time: %s)", testCode, i, testTime.Format(time.RFC3339))
 			if testCode == code {
 				log.Printf("2FA code validated with time offset: %d", i)
 				valid = true
@@ -96,7 +82,7 @@ func (s *TwoFAService) EnableTwoFA(userID int, secret string, code string) ([]st
 	}
 
 	if !valid {
-		log.Printf("2FA validation failed for user %d, code: %s", userID, code)
+		log.Printf("2FA validation failed for user %d", userID)
 		return nil, fmt.Errorf("invalid 2FA code")
 	}
 
@@ -105,15 +91,24 @@ func (s *TwoFAService) EnableTwoFA(userID int, secret string, code string) ([]st
 	// Generate backup codes
 	backupCodes := s.generateBackupCodes()
 
-	// Convert backup codes to JSON
-	backupCodesJSON, err := json.Marshal(backupCodes)
+	// Only the backup codes' hashes are stored
+	hashes := make([]string, len(backupCodes))
+	for i, backupCode := range backupCodes {
+		hashes[i] = hashBackupCode(backupCode)
+	}
+	backupCodesJSON, err := json.Marshal(hashes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal backup codes: %v", err)
 	}
 
+	sealed, err := encryption.Seal(encryption.UserTwoFASecret, userID, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt 2FA secret: %v", err)
+	}
+
 	// Update user in database
 	query := `UPDATE Users SET two_fa_secret = ?, two_fa_enabled = TRUE, two_fa_backup_codes = ? WHERE user_id = ?`
-	_, err = database.GetDB().Exec(query, secret, string(backupCodesJSON), userID)
+	_, err = database.GetDB().ExecContext(ctx, query, sealed, string(backupCodesJSON), userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update user: %v", err)
 	}
@@ -121,28 +116,31 @@ func (s *TwoFAService) EnableTwoFA(userID int, secret string, code string) ([]st
 	return backupCodes, nil
 }
 
-func (s *TwoFAService) DisableTwoFA(userID int) error {
+func (s *TwoFAService) DisableTwoFA(ctx context.Context, userID int) error {
 	query := `UPDATE Users SET two_fa_secret = '', two_fa_enabled = FALSE, two_fa_backup_codes = '' WHERE user_id = ?`
-	_, err := database.GetDB().Exec(query, userID)
+	_, err := database.GetDB().ExecContext(ctx, query, userID)
 	return err
 }
 
 // VerifyTwoFA verifies a 2FA code (TOTP or backup code)
-func (s *TwoFAService) VerifyTwoFA(userID int, code string) (bool, error) {
-	log.Printf("Verifying 2FA for user %d with code: %s", userID, code)
+func (s *TwoFAService) VerifyTwoFA(ctx context.Context, userID int, code string) (valid bool, err error) {
+	defer func() { metrics.TwoFAVerification(metrics.FACTOR_CODE, valid && err == nil) }()
+	log.Printf("Verifying 2FA for user %d", userID)
 
 	var secret string
 	var backupCodesJSON string
 	query := `SELECT two_fa_secret, two_fa_backup_codes FROM Users WHERE user_id = ? AND two_fa_enabled = TRUE`
-	err := database.GetDB().QueryRow(query, userID).Scan(&secret, &backupCodesJSON)
+	err = database.GetDB().QueryRowContext(ctx, query, userID).Scan(&secret, &backupCodesJSON)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, fmt.Errorf("2FA not enabled for user")
 		}
 		return false, fmt.Errorf("failed to get user 2FA info: %v", err)
 	}
+	if secret, err = encryption.Open(encryption.UserTwoFASecret, userID, secret); err != nil {
+		return false, err
+	}
 
-	log.Printf("User %d has 2FA secret: %s", userID, secret)
 	log.Printf("Current server time: %s", time.Now().Format(time.RFC3339))
 
 	// First check if it's a valid TOTP code with time tolerance
@@ -159,42 +157,44 @@ func (s *TwoFAService) VerifyTwoFA(userID int, code string) (bool, error) {
 		if err != nil {
 			continue
 		}
-		log.Printf("Testing TOTP code %s for time offset %d", testCode, i)
 		if testCode == code {
 			log.Printf("TOTP code validated with time offset: %d for user %d", i, userID)
 			return true, nil
 		}
 	}
 
-	// If not TOTP, check backup codes
-	var backupCodes []string
-	if err := json.Unmarshal([]byte(backupCodesJSON), &backupCodes); err != nil {
+	// If not TOTP, check the backup code hashes
+	var hashes []string
+	if err := json.Unmarshal([]byte(backupCodesJSON), &hashes); err != nil {
 		return false, fmt.Errorf("failed to parse backup codes: %v", err)
 	}
 
-	// Check if code matches any backup code
-	for i, backupCode := range backupCodes {
-		if code == backupCode {
-			// Remove used backup code
-			backupCodes = append(backupCodes[:i], backupCodes[i+1:]...)
-			updatedBackupCodesJSON, _ := json.Marshal(backupCodes)
-
-			// Update database with remaining backup codes
-			updateQuery := `UPDATE Users SET two_fa_backup_codes = ? WHERE user_id = ?`
-			database.GetDB().Exec(updateQuery, string(updatedBackupCodesJSON), userID)
+	hash := hashBackupCode(code)
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(stored)) != 1 {
+			continue
+		}
 
-			return true, nil
+		// Remove the used code. The guard on the old value makes a code
+		// redeemed concurrently by two logins count only once.
+		remaining, _ := json.Marshal(slices.Delete(hashes, i, i+1))
+		updateQuery := `UPDATE Users SET two_fa_backup_codes = ? WHERE user_id = ? AND two_fa_backup_codes = ?`
+		result, err := database.GetDB().ExecContext(ctx, updateQuery, string(remaining), userID, backupCodesJSON)
+		if err != nil {
+			return false, fmt.Errorf("failed to consume backup code: %v", err)
 		}
+		consumed, _ := result.RowsAffected()
+		return consumed == 1, nil
 	}
 
 	return false, nil
 }
 
 // GetUserTwoFAStatus gets the 2FA status for a user
-func (s *TwoFAService) GetUserTwoFAStatus(userID int) (bool, error) {
+func (s *TwoFAService) GetUserTwoFAStatus(ctx context.Context, userID int) (bool, error) {
 	var enabled bool
 	query := `SELECT two_fa_enabled FROM Users WHERE user_id = ?`
-	err := database.GetDB().QueryRow(query, userID).Scan(&enabled)
+	err := database.GetDB().QueryRowContext(ctx, query, userID).Scan(&enabled)
 	if err != nil {
 		return false, err
 	}
@@ -218,32 +218,6 @@ func (s *TwoFAService) generateQRCodeBase64(key *otp.Key) (string, error) {
 	return buf.String(), nil
 }
 
-// generateQRCodeFromSecret generates a QR code from an existing secret
-func (s *TwoFAService) generateQRCodeFromSecret(secret string, username string) (string, error) {
-	// Create TOTP URL manually
-	url := fmt.Sprintf("otpauth://totp/Hospital%%20System:%s?secret=%s&issuer=Hospital%%20System", username, secret)
-
-	// Create key from URL
-	key, err := otp.NewKeyFromURL(url)
-	if err != nil {
-		return "", fmt.Errorf("failed to create key from URL: %v", err)
-	}
-
-	// Generate QR code image
-	img, err := key.Image(200, 200)
-	if err != nil {
-		return "", err
-	}
-
-	// Encode to base64
-	var buf strings.Builder
-	encoder := base64.NewEncoder(base64.StdEncoding, &buf)
-	png.Encode(encoder, img)
-	encoder.Close()
-
-	return buf.String(), nil
-}
-
 // generateBackupCodes generates 10 backup codes
 func (s *TwoFAService) generateBackupCodes() []string {
 	codes := make([]string, 10)
@@ -253,6 +227,13 @@ func (s *TwoFAService) generateBackupCodes() []string {
 	return codes
 }
 
+// hashBackupCode is the stored form of a backup code. Codes carry 48 random
+// bits, so a fast hash is enough; entry is case-insensitive.
+func hashBackupCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
 // generateBackupCode generates a single backup code
 func (s *TwoFAService) generateBackupCode() string {
 	bytes := make([]byte, 6)
@@ -0,0 +1,358 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/metrics"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// webAuthnUser adapts a models.User and its stored credentials to the
+// webauthn.User interface
+type webAuthnUser struct {
+	user        *models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.user.UserID))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	if u.user.FullName != "" {
+		return u.user.FullName
+	}
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// ceremonyTTL bounds how long a registration or login ceremony can take
+const ceremonyTTL = 5 * time.Minute
+
+// WebAuthnService handles passkey/hardware key registration and assertion.
+// In-flight ceremonies are kept in the database, so the server finishing one
+// needn't be the one that began it.
+type WebAuthnService struct {
+	webAuthn *webauthn.WebAuthn
+}
+
+// NewWebAuthnService configures the relying party from WEBAUTHN_RP_ID and
+// WEBAUTHN_RP_ORIGINS (comma separated), defaulting to the local dev frontend
+func NewWebAuthnService() *WebAuthnService {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+
+	rpOrigins := []string{"https://localhost:5173", "http://localhost:5173"}
+	if origins := os.Getenv("WEBAUTHN_RP_ORIGINS"); origins != "" {
+		rpOrigins = strings.Split(origins, ",")
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "Hospital System",
+		RPOrigins:     rpOrigins,
+	})
+	if err != nil {
+		log.Fatal("Failed to configure WebAuthn:", err)
+	}
+
+	return &WebAuthnService{webAuthn: w}
+}
+
+// BeginRegistration starts registering a new credential for a user
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, user *models.User) (any, error) {
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exclude already registered authenticators so they aren't enrolled twice
+	exclusions := webauthn.Credentials(waUser.credentials).CredentialDescriptors()
+	options, session, err := s.webAuthn.BeginRegistration(waUser, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin registration: %v", err)
+	}
+
+	if err := s.saveCeremony(ctx, registrationKey(user.UserID), session); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// FinishRegistration verifies the authenticator response and stores the credential
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, user *models.User, name string, r *http.Request) (*models.WebAuthnCredential, error) {
+	session, err := s.takeCeremony(ctx, registrationKey(user.UserID))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, fmt.Errorf("no registration in progress")
+	}
+
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.FinishRegistration(waUser, *session, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify registration: %v", err)
+	}
+
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal credential: %v", err)
+	}
+
+	if name == "" {
+		name = "Security key"
+	}
+
+	stored := &models.WebAuthnCredential{
+		UserID:       user.UserID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:         name,
+		CreatedAt:    time.Now(),
+	}
+
+	query := `INSERT INTO WebAuthnCredentials (user_id, credential_id, name, credential_data, created_at)
+              VALUES (?, ?, ?, ?, ?)`
+	result, err := database.GetDB().ExecContext(ctx, query, stored.UserID, stored.CredentialID, stored.Name, string(credentialJSON), stored.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store credential: %v", err)
+	}
+
+	id, _ := result.LastInsertId()
+	stored.ID = int(id)
+	log.Printf("Registered WebAuthn credential %d for user %d", stored.ID, user.UserID)
+	return stored, nil
+}
+
+// BeginLogin starts an assertion ceremony bound to a pending 2FA session
+func (s *WebAuthnService) BeginLogin(ctx context.Context, user *models.User, sessionID string) (any, error) {
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(waUser.credentials) == 0 {
+		return nil, fmt.Errorf("no security keys registered")
+	}
+
+	options, session, err := s.webAuthn.BeginLogin(waUser)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin login: %v", err)
+	}
+
+	if err := s.saveCeremony(ctx, loginKey(sessionID), session); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// FinishLogin verifies the assertion for the 2FA session and updates the sign counter
+func (s *WebAuthnService) FinishLogin(ctx context.Context, user *models.User, sessionID string, r *http.Request) (err error) {
+	defer func() { metrics.TwoFAVerification(metrics.FACTOR_WEBAUTHN, err == nil) }()
+
+	session, err := s.takeCeremony(ctx, loginKey(sessionID))
+	if err != nil {
+		return err
+	}
+	if session == nil {
+		return fmt.Errorf("no login in progress")
+	}
+
+	waUser, err := s.loadUser(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	credential, err := s.webAuthn.FinishLogin(waUser, *session, r)
+	if err != nil {
+		return fmt.Errorf("failed to verify assertion: %v", err)
+	}
+
+	if credential.Authenticator.CloneWarning {
+		log.Printf("WebAuthn clone warning for user %d", user.UserID)
+		return fmt.Errorf("security key may have been cloned")
+	}
+
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("failed to marshal credential: %v", err)
+	}
+
+	query := `UPDATE WebAuthnCredentials SET credential_data = ?, last_used_at = ? WHERE credential_id = ?`
+	_, err = database.GetDB().ExecContext(ctx, query, string(credentialJSON), time.Now(), base64.RawURLEncoding.EncodeToString(credential.ID))
+	if err != nil {
+		return fmt.Errorf("failed to update credential: %v", err)
+	}
+
+	return nil
+}
+
+// HasCredentials reports whether the user has at least one registered security key
+func (s *WebAuthnService) HasCredentials(ctx context.Context, userID int) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM WebAuthnCredentials WHERE user_id = ?`
+	if err := database.GetDB().QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ListCredentials returns the user's registered security keys
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID int) ([]models.WebAuthnCredential, error) {
+	query := `SELECT webauthn_credential_id, user_id, credential_id, name, created_at, last_used_at
+              FROM WebAuthnCredentials WHERE user_id = ?`
+	rows, err := database.GetDB().QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+	for rows.Next() {
+		var credential models.WebAuthnCredential
+		var lastUsedAt sql.NullTime
+		err := rows.Scan(&credential.ID, &credential.UserID, &credential.CredentialID, &credential.Name,
+			&credential.CreatedAt, &lastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			credential.LastUsedAt = &lastUsedAt.Time
+		}
+		credentials = append(credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// DeleteCredential removes one of the user's security keys
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID int, id int) error {
+	result, err := database.GetDB().ExecContext(ctx, `DELETE FROM WebAuthnCredentials WHERE webauthn_credential_id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, _ := result.RowsAffected()
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// saveCeremony stores the state of a ceremony, replacing any earlier one
+// under the same key
+func (s *WebAuthnService) saveCeremony(ctx context.Context, key string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM WebAuthnCeremonies WHERE expires_at < ?`, now); err != nil {
+			return err
+		}
+		query := `INSERT INTO WebAuthnCeremonies (ceremony_key, session_data, expires_at) VALUES (?, ?, ?)
+                  ON CONFLICT (ceremony_key) DO UPDATE SET session_data = excluded.session_data, expires_at = excluded.expires_at`
+		_, err := tx.ExecContext(ctx, query, key, string(data), now.Add(ceremonyTTL))
+		return err
+	})
+}
+
+// takeCeremony removes and returns the state of a live ceremony, or nil if
+// there is none, so each can be finished once
+func (s *WebAuthnService) takeCeremony(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	var data string
+	var expiresAt time.Time
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `SELECT session_data, expires_at FROM WebAuthnCeremonies WHERE ceremony_key = ?`
+		if err := tx.QueryRowContext(ctx, query, key).Scan(&data, &expiresAt); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM WebAuthnCeremonies WHERE ceremony_key = ?`, key)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if time.Now().After(expiresAt) {
+		return nil, nil
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, fmt.Errorf("failed to parse ceremony: %v", err)
+	}
+	return &session, nil
+}
+
+// registrationKey and loginKey name a user's registration ceremony and the
+// login ceremony of a 2FA session. Session IDs are credentials, so only a
+// hash of one is stored.
+func registrationKey(userID int) string {
+	return "registration:" + strconv.Itoa(userID)
+}
+
+func loginKey(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return "login:" + hex.EncodeToString(sum[:])
+}
+
+// loadUser builds the webauthn.User for a user with their stored credentials
+func (s *WebAuthnService) loadUser(ctx context.Context, user *models.User) (*webAuthnUser, error) {
+	rows, err := database.GetDB().QueryContext(ctx, `SELECT credential_data FROM WebAuthnCredentials WHERE user_id = ?`, user.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load credentials: %v", err)
+	}
+	defer rows.Close()
+
+	waUser := &webAuthnUser{user: user}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(data), &credential); err != nil {
+			return nil, fmt.Errorf("failed to parse stored credential: %v", err)
+		}
+		waUser.credentials = append(waUser.credentials, credential)
+	}
+
+	return waUser, rows.Err()
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrUnknownBackup is returned for a name that isn't a backup in the directory
+	ErrUnknownBackup = errors.New("backup does not exist")
+	// ErrBackupUnsupported is returned when the database is PostgreSQL or in memory
+	ErrBackupUnsupported = database.ErrBackupUnsupported
+)
+
+const backupTimeLayout = "20060102T150405.000Z"
+
+// backupName matches the files Create writes; names from the API must match
+// it, which also keeps them inside the backup directory
+var backupName = regexp.MustCompile(`^hospital-\d{8}T\d{6}\.\d{3}Z\.db$`)
+
+// BackupService takes online backups of the SQLite database into dir, keeps
+// the newest keep of them and restores them. Restoring first backs up the
+// database it replaces, so a restore can itself be undone.
+type BackupService struct {
+	dir   string
+	keep  int
+	audit *AuditService
+	// mu stops backups and restores overlapping, e.g. the schedule backing up
+	// while an admin restores
+	mu sync.Mutex
+}
+
+// NewBackupService keeps backups in dir, deleting the oldest once there are
+// more than keep; zero keeps them all
+func NewBackupService(dir string, keep int) (*BackupService, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &BackupService{dir: dir, keep: keep, audit: NewAuditService()}, nil
+}
+
+// Create backs up the live database and prunes old backups. userID is the
+// admin who asked for it, or zero for the schedule and the command line.
+func (s *BackupService) Create(ctx context.Context, userID int) (*models.Backup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backup, err := s.create(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.audit.Log(ctx, database.GetDB(), userID, models.AUDIT_BACKUP_CREATED, "", 0,
+		map[string]any{"name": backup.Name, "sizeBytes": backup.SizeBytes}); err != nil {
+		return nil, err
+	}
+	if err := s.prune(); err != nil {
+		slog.Error("Failed to prune old backups", "dir", s.dir, "error", err)
+	}
+	return backup, nil
+}
+
+// create writes the backup under a temporary name and renames it once it is
+// complete, so a backup cut short is never listed or restored
+func (s *BackupService) create(ctx context.Context) (*models.Backup, error) {
+	createdAt := time.Now().UTC()
+	name := "hospital-" + createdAt.Format(backupTimeLayout) + ".db"
+	path := filepath.Join(s.dir, name)
+
+	partial := path + ".partial"
+	os.Remove(partial)
+	if err := database.Backup(ctx, partial); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	return s.stat(name)
+}
+
+// List returns the backups, newest first
+func (s *BackupService) List(ctx context.Context) ([]models.Backup, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []models.Backup{}
+	for _, entry := range entries {
+		if entry.IsDir() || !backupName.MatchString(entry.Name()) {
+			continue
+		}
+		backup, err := s.stat(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, *backup)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// Restore replaces the live database with the named backup after checking
+// its integrity and backing up the database it replaces. The restore is
+// audit-logged in the restored database, so the log records it even though
+// it loses every entry made since the backup.
+func (s *BackupService) Restore(ctx context.Context, name string, userID int) (*models.BackupRestore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restored, err := s.stat(name)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.dir, name)
+	if err := database.CheckBackup(ctx, path); err != nil {
+		return nil, err
+	}
+
+	// Not pruned, so it can't push out the backup being restored
+	safety, err := s.create(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up the database before restoring: %v", err)
+	}
+
+	if err := database.Restore(ctx, path); err != nil {
+		return nil, err
+	}
+	slog.Warn("Database restored from backup", "backup", name, "safetyBackup", safety.Name)
+
+	if err := s.audit.Log(ctx, database.GetDB(), userID, models.AUDIT_BACKUP_RESTORED, "", 0,
+		map[string]any{"name": name, "safetyBackup": safety.Name}); err != nil {
+		return nil, err
+	}
+	return &models.BackupRestore{Restored: *restored, SafetyBackup: *safety}, nil
+}
+
+// Run backs up the database every interval until ctx is cancelled. The first
+// backup is taken one interval after starting, not on every restart.
+func (s *BackupService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		backup, err := s.Create(ctx, 0)
+		if err != nil {
+			slog.Error("Scheduled backup failed", "error", err)
+			continue
+		}
+		slog.Info("Scheduled backup written", "backup", backup.Name, "bytes", backup.SizeBytes)
+	}
+}
+
+// prune deletes all but the newest keep backups
+func (s *BackupService) prune() error {
+	if s.keep <= 0 {
+		return nil
+	}
+	backups, err := s.List(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups[min(s.keep, len(backups)):] {
+		if err := os.Remove(filepath.Join(s.dir, backup.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BackupService) stat(name string) (*models.Backup, error) {
+	if !backupName.MatchString(name) {
+		return nil, ErrUnknownBackup
+	}
+	info, err := os.Stat(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnknownBackup
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, "hospital-"), ".db")
+	createdAt, err := time.Parse(backupTimeLayout, stamp)
+	if err != nil {
+		return nil, ErrUnknownBackup
+	}
+	return &models.Backup{Name: name, SizeBytes: info.Size(), CreatedAt: createdAt}, nil
+}
@@ -0,0 +1,293 @@
+package services_test
+
+// The benchmarks measure the database work behind the hot endpoints on a
+// temporary SQLite database seeded with a realistic amount of data, and
+// with -check fail when one misses its target in docs.md:
+//
+//	go test -run '^$' -bench . ./services -args -check
+//	go test -run '^$' -bench . ./services -args -patients 20000
+//
+// The data is seeded the first time a benchmark needs it, so the tests
+// don't pay for it. The load scenario for the whole server, run over the
+// network, is in loadtest/.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/auth/session"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	patients       = flag.Int("patients", 2000, "patients to seed for the benchmarks")
+	prescriptions  = flag.Int("prescriptions", 5, "prescriptions to seed per patient")
+	encrypt        = flag.Bool("encrypt", true, "encrypt sensitive columns, as production does")
+	statementCache = flag.Int("statement-cache", database.DefaultOptions().StatementCacheSize, "prepared statements each connection keeps; 0 disables the cache")
+	check          = flag.Bool("check", false, "fail a benchmark that misses its target")
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if bench.dir != "" {
+		database.GetDB().Close()
+		os.RemoveAll(bench.dir)
+	}
+	os.Exit(code)
+}
+
+// fixture is the seeded data the benchmarks read
+type fixture struct {
+	once sync.Once
+	err  error
+	// dir holds the database, once seeded
+	dir string
+
+	patients      *services.PatientService
+	prescriptions *services.PrescriptionService
+	users         *services.UserService
+	patientIDs    []int
+	doctor        *models.User
+	password      string
+}
+
+var bench fixture
+
+// seeded returns the fixture, seeding the database the first time
+func seeded(b *testing.B) *fixture {
+	b.Helper()
+	bench.once.Do(func() {
+		start := time.Now()
+		bench.err = quietly(bench.seed)
+		if bench.err == nil {
+			b.Logf("Seeded %d patients and %d prescriptions in %s", *patients, *patients**prescriptions, time.Since(start).Round(time.Millisecond))
+		}
+	})
+	if bench.err != nil {
+		b.Fatal("Seeding failed: ", bench.err)
+	}
+	return &bench
+}
+
+// seed opens a database in a temporary directory, then registers a doctor
+// and patients with prescriptions, each in its own transaction as through
+// the API
+func (f *fixture) seed() error {
+	dir, err := os.MkdirTemp("", "hms-bench-")
+	if err != nil {
+		return err
+	}
+
+	timezone.Init(time.UTC)
+	if *encrypt {
+		key := make([]byte, 32)
+		rand.Read(key)
+		keyring, err := encryption.NewKeyring("bench", map[string]string{"bench": base64.StdEncoding.EncodeToString(key)})
+		if err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		encryption.Init(keyring)
+	}
+
+	options := database.DefaultOptions()
+	options.Path = filepath.Join(dir, "bench.db")
+	options.StatementCacheSize = *statementCache
+	if err := database.Open(options); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("opening the database: %w", err)
+	}
+	f.dir = dir
+
+	ctx := context.Background()
+	f.patients = services.NewPatientService(services.NewSQLitePatientRepo())
+	f.prescriptions = services.NewPrescriptionService(services.NewSQLitePrescriptionRepo(), nil)
+	f.users = services.NewUserService(services.NewSQLiteUserRepo())
+	f.password = rand.Text()
+
+	f.doctor = &models.User{Username: "bench.doctor", Role: models.ROLE_DOCTOR, FullName: "Bench Doctor"}
+	if err := f.users.CreateUserWithPassword(ctx, f.doctor, f.password); err != nil {
+		return err
+	}
+
+	medications := []string{"Amoxicillin", "Metformin", "Lisinopril", "Atorvastatin", "Omeprazole"}
+	for i := range *patients {
+		patient := &models.Patient{
+			FirstName:        "Bench",
+			LastName:         fmt.Sprintf("Patient%d", i),
+			DateOfBirth:      "1970-01-01",
+			Gender:           "Other",
+			ContactInfo:      fmt.Sprintf("+1555%07d", i),
+			Address:          fmt.Sprintf("%d Bench Street", i),
+			MedicalHistory:   "Hypertension, managed with medication; annual review",
+			EmergencyContact: "Next of Kin",
+		}
+		if err := f.patients.CreatePatient(ctx, patient); err != nil {
+			return err
+		}
+		f.patientIDs = append(f.patientIDs, patient.PatientID)
+
+		for j := range *prescriptions {
+			prescription := &models.Prescription{
+				PatientID:      patient.PatientID,
+				DoctorID:       f.doctor.UserID,
+				PrescribedDate: time.Now().AddDate(0, 0, -j).Format("2006-01-02"),
+				Medication:     medications[j%len(medications)],
+				Dosage:         "500 mg",
+				Duration:       "7 days",
+			}
+			if err := f.prescriptions.CreatePrescription(ctx, prescription); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GET /api/patients
+func BenchmarkGetAllPatients(b *testing.B) {
+	f := seeded(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := f.patients.GetAllPatients(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+	checkTarget(b, 40*time.Millisecond)
+}
+
+// GET /api/patients/{id}/prescriptions
+func BenchmarkGetPrescriptionsByPatient(b *testing.B) {
+	f := seeded(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		id := f.patientIDs[mathrand.IntN(len(f.patientIDs))]
+		if _, _, err := f.prescriptions.GetPrescriptions(ctx, services.PrescriptionFilter{PatientID: id}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	checkTarget(b, 2*time.Millisecond)
+}
+
+// GET /api/prescriptions?limit=50&expand=patient,doctor
+func BenchmarkGetPrescriptionsExpand(b *testing.B) {
+	f := seeded(b)
+	ctx := context.Background()
+	filter := services.PrescriptionFilter{Limit: 50, Expand: models.Expand{Patient: true, Doctor: true}}
+	b.ReportAllocs()
+	for b.Loop() {
+		filter.Offset = mathrand.IntN(len(f.patientIDs))
+		if _, _, err := f.prescriptions.GetPrescriptions(ctx, filter); err != nil {
+			b.Fatal(err)
+		}
+	}
+	checkTarget(b, 5*time.Millisecond)
+}
+
+// Every request in a session: look the session up, then load the user for
+// their current role and status. With SESSION_MODE=stateless the lookup
+// verifies the token and checks the revocation list.
+func BenchmarkAuthSession(b *testing.B) {
+	f := seeded(b)
+	secret := make([]byte, session.MinTokenSecretLength)
+	rand.Read(secret)
+	stores := []struct {
+		name   string
+		store  session.Store
+		target time.Duration
+	}{
+		{"memory", session.NewMemoryStore(0, session.DefaultLifetimes), time.Millisecond},
+		{"stateless", session.NewTokenStore(secret, services.NewSessionRevocationService(), session.DefaultLifetimes), 2 * time.Millisecond},
+	}
+	for _, s := range stores {
+		b.Run(s.name, func(b *testing.B) {
+			ctx := context.Background()
+			var created *session.Session
+			err := quietly(func() (err error) {
+				created, err = s.store.Create(f.doctor, true, session.Client{})
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				found, ok := s.store.Get(created.SessionID)
+				if !ok {
+					b.Fatal("session not found")
+				}
+				if _, err := f.users.GetUser(ctx, found.UserID); err != nil {
+					b.Fatal(err)
+				}
+			}
+			checkTarget(b, s.target)
+		})
+	}
+}
+
+// POST /api/auth/2fa/initiate: bcrypt dominates, by design
+func BenchmarkAuthPassword(b *testing.B) {
+	f := seeded(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		user, err := f.users.GetUserByUsername(ctx, f.doctor.Username)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(f.password)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	checkTarget(b, 250*time.Millisecond)
+}
+
+// checkTarget fails the benchmark with -check when an operation took longer
+// than target, the most it may take on the reference machine (see docs.md)
+// at the default data size
+func checkTarget(b *testing.B, target time.Duration) {
+	b.Helper()
+	if !*check || b.N == 0 {
+		return
+	}
+	if perOp := b.Elapsed() / time.Duration(b.N); perOp > target {
+		b.Errorf("%s per operation, missing the %s target", perOp, target)
+	}
+}
+
+// quietly runs fn with the log and standard output discarded, so the
+// services' per-row chatter doesn't bury the results
+func quietly(fn func() error) error {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+
+	stdout := os.Stdout
+	os.Stdout = devNull
+	log.SetOutput(io.Discard)
+	defer func() {
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+	}()
+	return fn()
+}
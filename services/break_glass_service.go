@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// ErrBreakGlassRole is returned when a role that can't break glass asks to
+var ErrBreakGlassRole = errors.New("only nurses, lab technicians and pharmacists can request break-glass access")
+
+// BreakGlassService grants clinicians time-limited emergency access to a
+// patient's full medical records. Every grant raises a security alert to
+// the admins, and the grant and each read under it are audit-logged.
+type BreakGlassService struct {
+	duration      time.Duration
+	audit         *AuditService
+	notifications *NotificationService
+}
+
+// NewBreakGlassService grants access for duration and alerts through
+// notifications; nil sends nothing
+func NewBreakGlassService(duration time.Duration, notifications *NotificationService) *BreakGlassService {
+	return &BreakGlassService{
+		duration:      duration,
+		audit:         NewAuditService(),
+		notifications: notifications,
+	}
+}
+
+// Grant gives user access to the patient's records for the configured
+// duration, recording the reason
+func (s *BreakGlassService) Grant(ctx context.Context, user *models.User, access *models.BreakGlassAccess) error {
+	if !models.CanBreakGlass(user.Role) {
+		return ErrBreakGlassRole
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, access.PatientID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+
+		access.UserID = user.UserID
+		access.GrantedAt = time.Now().UTC()
+		access.ExpiresAt = access.GrantedAt.Add(s.duration)
+		query := `INSERT INTO BreakGlassAccess (user_id, patient_id, reason, granted_at, expires_at) VALUES (?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, access.UserID, access.PatientID, access.Reason, access.GrantedAt, access.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		access.AccessID = int(id)
+
+		details := map[string]any{
+			"patientId": access.PatientID,
+			"reason":    access.Reason,
+			"expiresAt": access.ExpiresAt,
+		}
+		return s.audit.Log(ctx, tx, user.UserID, models.AUDIT_BREAK_GLASS, models.ENTITY_BREAK_GLASS, access.AccessID, details)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.notifications.SecurityAlert(ctx, "Break-glass access",
+		fmt.Sprintf("%s (%s) used break-glass access to patient %d's medical records until %s. Reason: %s",
+			user.Username, user.Role, access.PatientID, timezone.In(access.ExpiresAt).Format("2006-01-02 15:04 MST"), access.Reason))
+	return nil
+}
+
+// Active returns the user's unexpired grant for the patient, or nil
+func (s *BreakGlassService) Active(ctx context.Context, userID, patientID int) (*models.BreakGlassAccess, error) {
+	grants, err := queryBreakGlass(ctx, database.ReadDB(ctx), `WHERE user_id = ? AND patient_id = ? AND expires_at > ?
+              ORDER BY expires_at DESC LIMIT 1`, userID, patientID, time.Now().UTC())
+	if err != nil || len(grants) == 0 {
+		return nil, err
+	}
+	return &grants[0], nil
+}
+
+// ActiveForRecord returns the user's unexpired grant for the patient the
+// medical record belongs to, or nil
+func (s *BreakGlassService) ActiveForRecord(ctx context.Context, userID, recordID int) (*models.BreakGlassAccess, error) {
+	grants, err := queryBreakGlass(ctx, database.ReadDB(ctx), `WHERE user_id = ? AND expires_at > ?
+              AND patient_id = (SELECT patient_id FROM MedicalRecords WHERE record_id = ?)
+              ORDER BY expires_at DESC LIMIT 1`, userID, time.Now().UTC(), recordID)
+	if err != nil || len(grants) == 0 {
+		return nil, err
+	}
+	return &grants[0], nil
+}
+
+// LogAccess audit-logs a read made under the grant
+func (s *BreakGlassService) LogAccess(ctx context.Context, access *models.BreakGlassAccess, entityType string, entityID int) error {
+	details := map[string]any{
+		"breakGlassId": access.AccessID,
+		"patientId":    access.PatientID,
+	}
+	return s.audit.Log(ctx, database.GetDB(), access.UserID, models.AUDIT_BREAK_GLASS_ACCESS, entityType, entityID, details)
+}
+
+// List returns grants, newest first; activeOnly leaves out expired ones
+func (s *BreakGlassService) List(ctx context.Context, activeOnly bool) ([]models.BreakGlassAccess, error) {
+	if activeOnly {
+		return queryBreakGlass(ctx, database.ReadDB(ctx), `WHERE expires_at > ? ORDER BY granted_at DESC`, time.Now().UTC())
+	}
+	return queryBreakGlass(ctx, database.ReadDB(ctx), `ORDER BY granted_at DESC`)
+}
+
+func queryBreakGlass(ctx context.Context, q *sql.DB, clause string, args ...any) ([]models.BreakGlassAccess, error) {
+	rows, err := q.QueryContext(ctx, `SELECT access_id, user_id, patient_id, reason, granted_at, expires_at
+              FROM BreakGlassAccess `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []models.BreakGlassAccess{}
+	for rows.Next() {
+		var access models.BreakGlassAccess
+		if err := rows.Scan(&access.AccessID, &access.UserID, &access.PatientID, &access.Reason, &access.GrantedAt, &access.ExpiresAt); err != nil {
+			return nil, err
+		}
+		grants = append(grants, access)
+	}
+	return grants, rows.Err()
+}
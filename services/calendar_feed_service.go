@@ -0,0 +1,242 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// ErrInvalidFeedToken is returned for a feed token that wasn't signed by
+// this server, has been replaced by a newer one, or was revoked
+var ErrInvalidFeedToken = errors.New("calendar feed token is invalid or has been revoked")
+
+const (
+	// feedPast and feedAhead bound the appointments a feed lists, relative
+	// to when it is fetched
+	feedPast  = 30 * 24 * time.Hour
+	feedAhead = 180 * 24 * time.Hour
+	// feedRefresh is how often subscribed calendars are asked to refetch
+	feedRefresh = "PT15M"
+)
+
+// CalendarFeedService publishes each doctor's appointments as an iCalendar
+// feed their phone calendar can subscribe to. The feed URL carries an HMAC
+// of the doctor and their feed's generation, so issuing a new URL or
+// revoking the feed invalidates the old one without storing the token.
+type CalendarFeedService struct {
+	appointments *AppointmentService
+	audit        *AuditService
+	key          []byte
+}
+
+// NewCalendarFeedService signs feed tokens with key; an empty key uses a
+// random one, valid until the process exits
+func NewCalendarFeedService(appointments *AppointmentService, key string) *CalendarFeedService {
+	secret := []byte(key)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &CalendarFeedService{appointments: appointments, audit: NewAuditService(), key: secret}
+}
+
+// Issue mints a new feed URL for the doctor, replacing any earlier one
+func (s *CalendarFeedService) Issue(ctx context.Context, doctorID, userID int) (*models.CalendarFeed, error) {
+	feed := &models.CalendarFeed{DoctorID: doctorID, IssuedBy: userID, IssuedAt: time.Now().UTC()}
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkDoctor(ctx, tx, doctorID); err != nil {
+			return err
+		}
+
+		var generation int
+		err := tx.QueryRowContext(ctx, `SELECT generation FROM CalendarFeeds WHERE doctor_id = ?`, doctorID).Scan(&generation)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		generation++
+
+		query := `INSERT INTO CalendarFeeds (doctor_id, generation, issued_by, issued_at) VALUES (?, ?, ?, ?)
+                  ON CONFLICT (doctor_id) DO UPDATE SET generation = excluded.generation, issued_by = excluded.issued_by,
+                      issued_at = excluded.issued_at, revoked_at = NULL`
+		if _, err := tx.ExecContext(ctx, query, doctorID, generation, userID, feed.IssuedAt); err != nil {
+			return err
+		}
+		feed.URL = fmt.Sprintf("/api/doctors/%d/appointments.ics?token=%s", doctorID, s.sign(doctorID, generation))
+
+		details := map[string]any{"generation": generation}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_CALENDAR_FEED_ISSUED, models.ENTITY_USER, doctorID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return feed, nil
+}
+
+// Revoke stops the doctor's feed URL working until a new one is issued
+func (s *CalendarFeedService) Revoke(ctx context.Context, doctorID, userID int) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE CalendarFeeds SET revoked_at = ? WHERE doctor_id = ? AND revoked_at IS NULL`,
+			time.Now().UTC(), doctorID)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return sql.ErrNoRows
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_CALENDAR_FEED_REVOKED, models.ENTITY_USER, doctorID, nil)
+	})
+}
+
+// Feed checks token and renders the doctor's appointments from feedPast ago
+// to feedAhead from now as an iCalendar file. Cancelled appointments are
+// kept so subscribed calendars drop them.
+func (s *CalendarFeedService) Feed(ctx context.Context, doctorID int, token string) ([]byte, error) {
+	var generation int
+	var doctorName string
+	var active bool
+	query := `SELECT f.generation, u.full_name, u.active
+              FROM CalendarFeeds f
+              JOIN Users u ON u.user_id = f.doctor_id
+              WHERE f.doctor_id = ? AND f.revoked_at IS NULL AND u.role = ?`
+	err := database.ReadDB(ctx).QueryRowContext(ctx, query, doctorID, models.ROLE_DOCTOR).Scan(&generation, &doctorName, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidFeedToken
+	} else if err != nil {
+		return nil, err
+	}
+	if !active || !hmac.Equal([]byte(token), []byte(s.sign(doctorID, generation))) {
+		return nil, ErrInvalidFeedToken
+	}
+
+	now := time.Now()
+	appointments, err := s.appointments.GetAppointments(ctx, AppointmentFilter{DoctorID: doctorID, From: now.Add(-feedPast), To: now.Add(feedAhead)})
+	if err != nil {
+		return nil, err
+	}
+
+	initials := map[int]string{}
+	for _, appointment := range appointments {
+		if _, ok := initials[appointment.PatientID]; ok {
+			continue
+		}
+		var firstName, lastName string
+		err := database.ReadDB(ctx).QueryRowContext(ctx, `SELECT first_name, last_name FROM Patients WHERE patient_id = ?`,
+			appointment.PatientID).Scan(&firstName, &lastName)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		initials[appointment.PatientID] = patientInitials(firstName, lastName)
+	}
+
+	return renderCalendar(doctorName, appointments, initials, now), nil
+}
+
+// sign is the feed token for a doctor's feed generation
+func (s *CalendarFeedService) sign(doctorID, generation int) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "appointments.ics:%d:%d", doctorID, generation)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// patientInitials identifies a patient on a calendar that is synced to the
+// doctor's phone and, usually, a cloud provider, without their full name
+func patientInitials(firstName, lastName string) string {
+	var initials string
+	for _, name := range []string{firstName, lastName} {
+		if r, _ := utf8.DecodeRuneInString(strings.TrimSpace(name)); r != utf8.RuneError {
+			initials += strings.ToUpper(string(r)) + "."
+		}
+	}
+	if initials == "" {
+		return "patient"
+	}
+	return initials
+}
+
+// renderCalendar encodes appointments as an RFC 5545 calendar. Events are
+// titled with the patient's initials; reasons for the visit are left out.
+func renderCalendar(doctorName string, appointments []models.Appointment, initials map[int]string, now time.Time) []byte {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		writeCalendarLine(&buf, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//simple-hospital//appointments//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escapeCalendarText("Appointments - "+doctorName))
+	line("REFRESH-INTERVAL;VALUE=DURATION", feedRefresh)
+	line("X-PUBLISHED-TTL", feedRefresh)
+	for _, appointment := range appointments {
+		summary := "Appointment: " + initials[appointment.PatientID]
+		description := fmt.Sprintf("Appointment #%d", appointment.AppointmentID)
+		if appointment.Specialty != "" {
+			description += "\n" + appointment.Specialty
+		}
+		if appointment.Interpreter != nil && appointment.Interpreter.Status != models.INTERPRETER_STATUS_CANCELLED {
+			description += "\nInterpreter: " + appointment.Interpreter.Language
+		}
+		status := "CONFIRMED"
+		if appointment.Status == models.APPOINTMENT_STATUS_CANCELLED {
+			status = "CANCELLED"
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("appointment-%d@simple-hospital", appointment.AppointmentID))
+		line("DTSTAMP", calendarTime(now))
+		line("CREATED", calendarTime(appointment.CreatedAt))
+		line("DTSTART", calendarTime(appointment.StartsAt))
+		line("DTEND", calendarTime(appointment.EndsAt))
+		line("SUMMARY", escapeCalendarText(summary))
+		line("DESCRIPTION", escapeCalendarText(description))
+		line("STATUS", status)
+		line("CLASS", "CONFIDENTIAL")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return buf.Bytes()
+}
+
+func calendarTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeCalendarText escapes a TEXT value's backslashes, separators and
+// newlines
+func escapeCalendarText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(value)
+}
+
+// writeCalendarLine ends a content line with CRLF, folding it onto
+// continuation lines so none is longer than 75 bytes. Folds don't split
+// UTF-8 characters.
+func writeCalendarLine(buf *bytes.Buffer, content string) {
+	limit := 75
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		buf.WriteString(content[:cut])
+		buf.WriteString("\r\n ")
+		content = content[cut:]
+		// The leading space counts towards the continuation line's length
+		limit = 74
+	}
+	buf.WriteString(content)
+	buf.WriteString("\r\n")
+}
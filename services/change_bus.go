@@ -0,0 +1,91 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// changeBuffer is how many changes a subscriber may fall behind by before
+// it is dropped
+const changeBuffer = 64
+
+// Changes is the process-wide bus that EventService publishes each clinical
+// event to once its transaction commits
+var Changes = NewChangeBus()
+
+// ChangeBus fans committed entity changes out to live subscribers, such as
+// the server-sent event streams. Publishing never blocks: a subscriber too
+// slow to keep up is dropped, and catches up from the event log when it
+// reconnects.
+type ChangeBus struct {
+	mu          sync.Mutex
+	subscribers map[*ChangeSubscription]struct{}
+	closed      bool
+}
+
+func NewChangeBus() *ChangeBus {
+	return &ChangeBus{subscribers: map[*ChangeSubscription]struct{}{}}
+}
+
+// ChangeSubscription receives changes on C until it is unsubscribed, dropped
+// or the bus is closed, when C is closed
+type ChangeSubscription struct {
+	C   <-chan models.EntityChange
+	c   chan models.EntityChange
+	bus *ChangeBus
+}
+
+// Subscribe starts receiving the changes published from now on
+func (b *ChangeBus) Subscribe() *ChangeSubscription {
+	c := make(chan models.EntityChange, changeBuffer)
+	sub := &ChangeSubscription{C: c, c: c, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(c)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops the subscription; it is safe to call more than once
+func (s *ChangeSubscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Publish sends change to every subscriber
+func (b *ChangeBus) Publish(change models.EntityChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		select {
+		case sub.c <- change:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Close ends every subscription, e.g. so streams finish on shutdown, and
+// refuses new ones
+func (b *ChangeBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+}
+
+// remove must be called with mu held
+func (b *ChangeBus) remove(sub *ChangeSubscription) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
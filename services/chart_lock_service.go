@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+const (
+	// chartLockTTL is how long a lock lasts without being refreshed; the
+	// editing client re-acquires it periodically as a heartbeat
+	chartLockTTL = 10 * time.Minute
+	// takeoverGrace is how long the holder has to respond to a takeover
+	// request before the requester may acquire the lock
+	takeoverGrace = 2 * time.Minute
+)
+
+// ErrNotLockHolder is returned when releasing a lock held by someone else
+var ErrNotLockHolder = errors.New("chart lock is held by another user")
+
+// ChartLockedError is returned when another user holds the chart lock
+type ChartLockedError struct {
+	Lock *models.ChartLock
+}
+
+func (e *ChartLockedError) Error() string {
+	return fmt.Sprintf("chart is being edited by %s until %s", e.Lock.HolderName, e.Lock.ExpiresAt.Format(time.RFC3339))
+}
+
+// ChartLockService manages advisory per-patient edit locks. Writes to a
+// patient's chart are refused while someone else holds its lock.
+type ChartLockService struct{}
+
+func NewChartLockService() *ChartLockService {
+	return &ChartLockService{}
+}
+
+// Acquire takes or refreshes the lock on a patient's chart. It fails with a
+// ChartLockedError while another user holds it, unless the caller requested a
+// takeover that the holder has not answered within the grace period.
+func (s *ChartLockService) Acquire(ctx context.Context, patientID, userID int) (*models.ChartLock, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, patientID).Scan(&exists); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		current, err := getChartLock(ctx, tx, patientID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if current != nil && current.HolderID == userID {
+			_, err := tx.ExecContext(ctx, `UPDATE ChartLocks SET expires_at = ? WHERE patient_id = ?`, now.Add(chartLockTTL), patientID)
+			return err
+		}
+
+		if current != nil && !takeoverDue(current, userID, now) {
+			return &ChartLockedError{Lock: current}
+		}
+
+		query := `INSERT INTO ChartLocks (patient_id, holder_id, acquired_at, expires_at, takeover_requested_by, takeover_requested_at)
+              VALUES (?, ?, ?, ?, NULL, NULL)
+              ON CONFLICT (patient_id) DO UPDATE SET holder_id = excluded.holder_id, acquired_at = excluded.acquired_at,
+                  expires_at = excluded.expires_at, takeover_requested_by = NULL, takeover_requested_at = NULL`
+		_, err = tx.ExecContext(ctx, query, patientID, userID, now, now.Add(chartLockTTL))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(database.WithPrimaryReads(ctx), patientID)
+}
+
+// takeoverDue reports whether userID asked to take over the lock long enough ago
+func takeoverDue(lock *models.ChartLock, userID int, now time.Time) bool {
+	return lock.TakeoverRequestedBy != nil && *lock.TakeoverRequestedBy == userID &&
+		now.Sub(*lock.TakeoverRequestedAt) >= takeoverGrace
+}
+
+// RequestTakeover asks the holder to hand over the chart. The holder sees the
+// request on the lock; if they don't release it within the grace period, the
+// requester can acquire the lock anyway.
+func (s *ChartLockService) RequestTakeover(ctx context.Context, patientID, userID int) (*models.ChartLock, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		current, err := getChartLock(ctx, tx, patientID)
+		if err != nil {
+			return err
+		}
+		if current.HolderID == userID {
+			return nil
+		}
+		if current.TakeoverRequestedBy != nil && *current.TakeoverRequestedBy == userID {
+			return nil
+		}
+
+		query := `UPDATE ChartLocks SET takeover_requested_by = ?, takeover_requested_at = ? WHERE patient_id = ?`
+		_, err = tx.ExecContext(ctx, query, userID, time.Now(), patientID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(database.WithPrimaryReads(ctx), patientID)
+}
+
+// Release drops the lock. Only the holder may release it unless force is set (admins).
+func (s *ChartLockService) Release(ctx context.Context, patientID, userID int, force bool) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		current, err := getChartLock(ctx, tx, patientID)
+		if err != nil {
+			return err
+		}
+		if current.HolderID != userID && !force {
+			return ErrNotLockHolder
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM ChartLocks WHERE patient_id = ?`, patientID)
+		return err
+	})
+}
+
+// Get returns the live lock on a patient's chart, or sql.ErrNoRows if there is none
+func (s *ChartLockService) Get(ctx context.Context, patientID int) (*models.ChartLock, error) {
+	return getChartLock(ctx, database.ReadDB(ctx), patientID)
+}
+
+// CheckWritable fails with a ChartLockedError if someone other than userID
+// holds the lock on the patient's chart. Unlocked charts are writable.
+func (s *ChartLockService) CheckWritable(ctx context.Context, patientID, userID int) error {
+	lock, err := getChartLock(ctx, database.GetDB(), patientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lock.HolderID != userID {
+		return &ChartLockedError{Lock: lock}
+	}
+	return nil
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getChartLock treats expired locks as absent
+func getChartLock(ctx context.Context, q queryRower, patientID int) (*models.ChartLock, error) {
+	query := `SELECT l.patient_id, l.holder_id, h.full_name, l.acquired_at, l.expires_at,
+                  l.takeover_requested_by, COALESCE(r.full_name, ''), l.takeover_requested_at
+              FROM ChartLocks l
+              JOIN Users h ON h.user_id = l.holder_id
+              LEFT JOIN Users r ON r.user_id = l.takeover_requested_by
+              WHERE l.patient_id = ? AND l.expires_at > ?`
+
+	var lock models.ChartLock
+	err := q.QueryRowContext(ctx, query, patientID, time.Now()).Scan(&lock.PatientID, &lock.HolderID, &lock.HolderName,
+		&lock.AcquiredAt, &lock.ExpiresAt, &lock.TakeoverRequestedBy, &lock.TakeoverRequesterName, &lock.TakeoverRequestedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+var (
+	// ErrClaimSubmitted is returned when submitting a claim a second time
+	ErrClaimSubmitted = errors.New("claim has already been submitted")
+	// ErrPreAuthMismatch is returned when a claim item names a pre-authorization
+	// for a different patient, payer or item
+	ErrPreAuthMismatch = errors.New("pre-authorization does not cover this claim item")
+	// ErrEncounterMismatch is returned when a claim names an encounter that
+	// isn't a completed encounter of the claim's patient
+	ErrEncounterMismatch = errors.New("encounter is not a completed encounter of this patient")
+	// ErrPolicyMismatch is returned when a claim names an insurance policy
+	// of another patient or payer
+	ErrPolicyMismatch = errors.New("insurance policy does not cover this patient and payer")
+	// ErrPolicyNotVerified is returned when submitting a claim whose
+	// insurance policy isn't verified
+	ErrPolicyNotVerified = errors.New("the claim's insurance policy is not verified")
+)
+
+// PreAuthMissingError lists the claim items that need an approved
+// pre-authorization before the claim can be submitted
+type PreAuthMissingError struct {
+	Items []models.ClaimItem
+}
+
+func (e *PreAuthMissingError) Error() string {
+	return fmt.Sprintf("%d claim item(s) need an approved pre-authorization", len(e.Items))
+}
+
+// ClaimService bills payers. Items flagged by a pre-authorization
+// requirement block submission until an approval is recorded for them, and
+// claims for an encounter that must be coded block until it is. A claim
+// linked to the patient's insurance policy with its payer is split into the
+// payer's cover and the patient's responsibility.
+type ClaimService struct {
+	coding *CodingService
+	audit  *AuditService
+}
+
+func NewClaimService(coding *CodingService) *ClaimService {
+	return &ClaimService{
+		coding: coding,
+		audit:  NewAuditService(),
+	}
+}
+
+// CreateClaim records a draft claim, linking it to the patient's insurance
+// policy and each item to its pre-authorization
+func (s *ClaimService) CreateClaim(ctx context.Context, claim *models.Claim) error {
+	claim.Status = models.CLAIM_STATUS_DRAFT
+	claim.CreatedAt = time.Now()
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, claim.PatientID).Scan(&exists); err != nil {
+			return err
+		}
+
+		var encounterType, encounterID any
+		if claim.EncounterType != "" {
+			encounter, err := s.coding.getEncounter(ctx, tx, claim.EncounterType, claim.EncounterID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrEncounterMismatch
+			}
+			if err != nil {
+				return err
+			}
+			if encounter.PatientID != claim.PatientID {
+				return ErrEncounterMismatch
+			}
+			encounterType, encounterID = claim.EncounterType, claim.EncounterID
+		}
+
+		if claim.PolicyID != nil {
+			if err := checkClaimPolicy(ctx, tx, claim, *claim.PolicyID); err != nil {
+				return err
+			}
+		} else if err := linkVerifiedPolicy(ctx, tx, claim); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `INSERT INTO Claims (patient_id, payer, status, created_by, created_at, encounter_type, encounter_id, policy_id)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			claim.PatientID, claim.Payer, claim.Status, claim.CreatedBy, claim.CreatedAt, encounterType, encounterID, claim.PolicyID)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		claim.ClaimID = int(id)
+
+		for i := range claim.Items {
+			item := &claim.Items[i]
+			if item.PreAuthID != nil {
+				if err := checkClaimPreAuth(ctx, tx, claim, item, *item.PreAuthID); err != nil {
+					return err
+				}
+			} else if err := linkApprovedPreAuth(ctx, tx, claim, item); err != nil {
+				return err
+			}
+
+			if item.PreAuthRequired, err = preAuthRequired(ctx, tx, item.ItemType, item.Code, claim.Payer); err != nil {
+				return err
+			}
+
+			result, err := tx.ExecContext(ctx, `INSERT INTO ClaimItems (claim_id, item_type, code, description, amount_cents, preauth_id)
+                  VALUES (?, ?, ?, ?, ?, ?)`, claim.ClaimID, item.ItemType, item.Code, item.Description, item.AmountCents, item.PreAuthID)
+			if err != nil {
+				return err
+			}
+			itemID, _ := result.LastInsertId()
+			item.ItemID = int(itemID)
+		}
+
+		if claim.PolicyID != nil {
+			policy, err := getPolicy(ctx, tx, *claim.PolicyID)
+			if err != nil {
+				return err
+			}
+			coverage := models.ApplyCoverage(claimTotal(claim), policy)
+			claim.Coverage = &coverage
+		}
+		return nil
+	})
+}
+
+// SubmitClaim submits a draft claim. It fails with *CodingIncompleteError
+// while its encounter must be coded and isn't, and with *PreAuthMissingError
+// while any flagged item lacks an approved pre-authorization. A claim
+// linked to an insurance policy can only be submitted while it is verified.
+func (s *ClaimService) SubmitClaim(ctx context.Context, id, userID int) (*models.Claim, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		claim, err := getClaim(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if claim.Status != models.CLAIM_STATUS_DRAFT {
+			return ErrClaimSubmitted
+		}
+		if claim.EncounterType != "" {
+			if err := s.coding.checkBillable(ctx, tx, claim.EncounterType, claim.EncounterID); err != nil {
+				return err
+			}
+		}
+
+		// Policies verified after the claim was drafted count too
+		if claim.PolicyID == nil {
+			if err := linkVerifiedPolicy(ctx, tx, claim); err != nil {
+				return err
+			}
+			if claim.PolicyID != nil {
+				if _, err := tx.ExecContext(ctx, `UPDATE Claims SET policy_id = ? WHERE claim_id = ?`, *claim.PolicyID, id); err != nil {
+					return err
+				}
+			}
+		}
+		if claim.PolicyID != nil {
+			var status string
+			if err := tx.QueryRowContext(ctx, `SELECT verification_status FROM InsurancePolicies WHERE policy_id = ?`, *claim.PolicyID).Scan(&status); err != nil {
+				return err
+			}
+			if status != models.INSURANCE_STATUS_VERIFIED {
+				return ErrPolicyNotVerified
+			}
+		}
+
+		missing := []models.ClaimItem{}
+		for i := range claim.Items {
+			item := &claim.Items[i]
+			if !item.PreAuthRequired {
+				continue
+			}
+
+			// Approvals recorded after the claim was drafted count too
+			if item.PreAuthID == nil {
+				if err := linkApprovedPreAuth(ctx, tx, claim, item); err != nil {
+					return err
+				}
+				if item.PreAuthID != nil {
+					if _, err := tx.ExecContext(ctx, `UPDATE ClaimItems SET preauth_id = ? WHERE item_id = ?`, *item.PreAuthID, item.ItemID); err != nil {
+						return err
+					}
+				}
+			}
+
+			approved := false
+			if item.PreAuthID != nil {
+				var status string
+				if err := tx.QueryRowContext(ctx, `SELECT status FROM PreAuthRequests WHERE preauth_id = ?`, *item.PreAuthID).Scan(&status); err != nil {
+					return err
+				}
+				approved = status == models.PREAUTH_STATUS_APPROVED
+			}
+			if !approved {
+				missing = append(missing, *item)
+			}
+		}
+		if len(missing) > 0 {
+			return &PreAuthMissingError{Items: missing}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE Claims SET status = ?, submitted_by = ?, submitted_at = ? WHERE claim_id = ?`,
+			models.CLAIM_STATUS_SUBMITTED, userID, time.Now(), id); err != nil {
+			return err
+		}
+
+		details := map[string]any{"payer": claim.Payer, "items": len(claim.Items)}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_CLAIM_SUBMITTED, models.ENTITY_CLAIM, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetClaim(database.WithPrimaryReads(ctx), id)
+}
+
+// GetClaims lists claims without their items, newest first, optionally by status
+func (s *ClaimService) GetClaims(ctx context.Context, status string) ([]models.Claim, error) {
+	query := `SELECT claim_id, patient_id, payer, status, created_by, created_at, submitted_by, submitted_at,
+                  COALESCE(encounter_type, ''), COALESCE(encounter_id, 0), policy_id FROM Claims`
+	var args []any
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	claims := []models.Claim{}
+	for rows.Next() {
+		var c models.Claim
+		if err := rows.Scan(&c.ClaimID, &c.PatientID, &c.Payer, &c.Status, &c.CreatedBy, &c.CreatedAt, &c.SubmittedBy, &c.SubmittedAt,
+			&c.EncounterType, &c.EncounterID, &c.PolicyID); err != nil {
+			return nil, err
+		}
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+func (s *ClaimService) GetClaim(ctx context.Context, id int) (*models.Claim, error) {
+	return getClaim(ctx, database.ReadDB(ctx), id)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	queryRower
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func getClaim(ctx context.Context, q querier, id int) (*models.Claim, error) {
+	var c models.Claim
+	err := q.QueryRowContext(ctx, `SELECT claim_id, patient_id, payer, status, created_by, created_at, submitted_by, submitted_at,
+                  COALESCE(encounter_type, ''), COALESCE(encounter_id, 0), policy_id
+              FROM Claims WHERE claim_id = ?`, id).
+		Scan(&c.ClaimID, &c.PatientID, &c.Payer, &c.Status, &c.CreatedBy, &c.CreatedAt, &c.SubmittedBy, &c.SubmittedAt,
+			&c.EncounterType, &c.EncounterID, &c.PolicyID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT item_id, item_type, code, COALESCE(description, ''), amount_cents, preauth_id
+              FROM ClaimItems WHERE claim_id = ? ORDER BY item_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	c.Items = []models.ClaimItem{}
+	for rows.Next() {
+		var item models.ClaimItem
+		if err := rows.Scan(&item.ItemID, &item.ItemType, &item.Code, &item.Description, &item.AmountCents, &item.PreAuthID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Items = append(c.Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range c.Items {
+		if c.Items[i].PreAuthRequired, err = preAuthRequired(ctx, q, c.Items[i].ItemType, c.Items[i].Code, c.Payer); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.PolicyID != nil {
+		policy, err := getPolicy(ctx, q, *c.PolicyID)
+		if err != nil {
+			return nil, err
+		}
+		coverage := models.ApplyCoverage(claimTotal(&c), policy)
+		c.Coverage = &coverage
+	}
+	return &c, nil
+}
+
+func claimTotal(claim *models.Claim) int {
+	total := 0
+	for _, item := range claim.Items {
+		total += item.AmountCents
+	}
+	return total
+}
+
+// checkClaimPolicy verifies that an explicitly linked policy is the patient's with the claim's payer
+func checkClaimPolicy(ctx context.Context, tx *sql.Tx, claim *models.Claim, policyID int) error {
+	var matches bool
+	err := tx.QueryRowContext(ctx, `SELECT patient_id = ? AND payer = ? FROM InsurancePolicies WHERE policy_id = ?`,
+		claim.PatientID, claim.Payer, policyID).Scan(&matches)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPolicyMismatch
+	}
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return ErrPolicyMismatch
+	}
+	return nil
+}
+
+// linkVerifiedPolicy sets the claim's PolicyID to the patient's verified
+// policy with its payer valid today, if there is one
+func linkVerifiedPolicy(ctx context.Context, tx *sql.Tx, claim *models.Claim) error {
+	policy, err := verifiedPolicy(ctx, tx, claim.PatientID, claim.Payer, timezone.Now().Format("2006-01-02"))
+	if err != nil || policy == nil {
+		return err
+	}
+	claim.PolicyID = &policy.PolicyID
+	return nil
+}
+
+// checkClaimPreAuth verifies that an explicitly linked request is for the same patient, payer and item
+func checkClaimPreAuth(ctx context.Context, tx *sql.Tx, claim *models.Claim, item *models.ClaimItem, preAuthID int) error {
+	var matches bool
+	err := tx.QueryRowContext(ctx, `SELECT patient_id = ? AND payer = ? AND item_type = ? AND code = ? FROM PreAuthRequests WHERE preauth_id = ?`,
+		claim.PatientID, claim.Payer, item.ItemType, item.Code, preAuthID).Scan(&matches)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPreAuthMismatch
+	}
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return ErrPreAuthMismatch
+	}
+	return nil
+}
+
+// linkApprovedPreAuth sets the item's PreAuthID to the patient's latest
+// approved request for the item and payer, if there is one
+func linkApprovedPreAuth(ctx context.Context, tx *sql.Tx, claim *models.Claim, item *models.ClaimItem) error {
+	var id int
+	err := tx.QueryRowContext(ctx, `SELECT preauth_id FROM PreAuthRequests
+              WHERE patient_id = ? AND payer = ? AND item_type = ? AND code = ? AND status = ?
+              ORDER BY decided_at DESC LIMIT 1`,
+		claim.PatientID, claim.Payer, item.ItemType, item.Code, models.PREAUTH_STATUS_APPROVED).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	item.PreAuthID = &id
+	return nil
+}
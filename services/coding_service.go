@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrCodingQueried is returned when coding or querying an encounter while
+	// the doctor has yet to answer a query on it
+	ErrCodingQueried = errors.New("encounter is waiting for the doctor to answer a coding query")
+	// ErrCodingNotQueried is returned when answering an encounter with no open query
+	ErrCodingNotQueried = errors.New("encounter has no open coding query")
+	// ErrNotEncounterDoctor is returned when a doctor answers a query on another doctor's encounter
+	ErrNotEncounterDoctor = errors.New("only the encounter's doctor can answer its coding query")
+)
+
+// CodingIncompleteError is returned when billing an encounter whose type
+// must be coded first and which isn't
+type CodingIncompleteError struct {
+	EncounterType string
+	EncounterID   int
+	Status        string
+}
+
+func (e *CodingIncompleteError) Error() string {
+	return fmt.Sprintf("%s encounter %d must be coded before billing (coding is %s)", e.EncounterType, e.EncounterID, e.Status)
+}
+
+// encounterSources selects completed encounters of each type as "r", joined
+// to their coding as "c"
+var encounterSources = map[string]string{
+	models.ENCOUNTER_OUTPATIENT: `SELECT r.record_id, r.patient_id, r.doctor_id, r.visit_date, COALESCE(r.diagnosis, ''), %s
+              FROM MedicalRecords r
+              LEFT JOIN EncounterCodings c ON c.encounter_type = 'outpatient' AND c.encounter_id = r.record_id
+              WHERE 1 = 1`,
+	models.ENCOUNTER_INPATIENT: `SELECT r.admission_id, r.patient_id, COALESCE(r.discharged_by, r.admitted_by), r.discharged_at, COALESCE(r.reason, ''), %s
+              FROM Admissions r
+              LEFT JOIN EncounterCodings c ON c.encounter_type = 'inpatient' AND c.encounter_id = r.admission_id
+              WHERE r.status = 'discharged'`,
+}
+
+// encounterKeys is the key column of each encounter source
+var encounterKeys = map[string]string{
+	models.ENCOUNTER_OUTPATIENT: "r.record_id",
+	models.ENCOUNTER_INPATIENT:  "r.admission_id",
+}
+
+const codingColumns = `COALESCE(c.status, 'uncoded'), COALESCE(c.diagnosis_codes, ''), COALESCE(c.procedure_codes, ''), c.coded_by, c.coded_at,
+                  COALESCE(c.query, ''), c.queried_by, c.queried_at, COALESCE(c.doctor_response, ''), c.responded_at`
+
+// CodingService runs the clinical coding workflow. Completed encounters -
+// outpatient visits and discharged inpatient stays - wait on the coders'
+// worklist until coded; coders can query the doctor instead, and the answer
+// returns the encounter to the worklist. Claims for encounter types that
+// require coding can't be submitted until the encounter is coded.
+type CodingService struct {
+	required []string
+	audit    *AuditService
+}
+
+// NewCodingService blocks billing of the required encounter types until coded
+func NewCodingService(required []string) *CodingService {
+	return &CodingService{required: required, audit: NewAuditService()}
+}
+
+// GetWorklist lists the encounters waiting for a coder, oldest first:
+// uncoded ones and those whose query the doctor has answered
+func (s *CodingService) GetWorklist(ctx context.Context, encounterType string) ([]models.EncounterCoding, error) {
+	return s.queryEncounters(ctx, database.ReadDB(ctx), encounterType,
+		` AND COALESCE(c.status, 'uncoded') IN ('uncoded', 'answered')`)
+}
+
+// GetQueries lists the encounters with an open query, oldest first; a
+// non-zero doctorID lists only that doctor's
+func (s *CodingService) GetQueries(ctx context.Context, doctorID int) ([]models.EncounterCoding, error) {
+	encounters, err := s.queryEncounters(ctx, database.ReadDB(ctx), "", ` AND c.status = 'queried'`)
+	if err != nil || doctorID == 0 {
+		return encounters, err
+	}
+
+	mine := []models.EncounterCoding{}
+	for _, encounter := range encounters {
+		if encounter.DoctorID == doctorID {
+			mine = append(mine, encounter)
+		}
+	}
+	return mine, nil
+}
+
+// GetEncounter returns the coding of one completed encounter
+func (s *CodingService) GetEncounter(ctx context.Context, encounterType string, id int) (*models.EncounterCoding, error) {
+	return s.getEncounter(ctx, database.ReadDB(ctx), encounterType, id)
+}
+
+// AssignCodes codes an encounter, replacing any earlier codes
+func (s *CodingService) AssignCodes(ctx context.Context, encounterType string, id int, codes models.EncounterCodes, userID int) (*models.EncounterCoding, error) {
+	diagnoses, procedures := normalizeCodes(codes.DiagnosisCodes), normalizeCodes(codes.ProcedureCodes)
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		encounter, err := s.getEncounter(ctx, tx, encounterType, id)
+		if err != nil {
+			return err
+		}
+		if encounter.Status == models.CODING_STATUS_QUERIED {
+			return ErrCodingQueried
+		}
+
+		query := `INSERT INTO EncounterCodings (encounter_type, encounter_id, status, diagnosis_codes, procedure_codes, coded_by, coded_at)
+                  VALUES (?, ?, ?, ?, ?, ?, ?)
+                  ON CONFLICT (encounter_type, encounter_id) DO UPDATE SET status = excluded.status,
+                      diagnosis_codes = excluded.diagnosis_codes, procedure_codes = excluded.procedure_codes,
+                      coded_by = excluded.coded_by, coded_at = excluded.coded_at`
+		if _, err := tx.ExecContext(ctx, query, encounterType, id, models.CODING_STATUS_CODED, strings.Join(diagnoses, ","),
+			strings.Join(procedures, ","), userID, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		details := map[string]any{"encounterType": encounterType, "encounterId": id, "diagnosisCodes": diagnoses,
+			"procedureCodes": procedures, "previousStatus": encounter.Status}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_ENCOUNTER_CODED, encounterEntity(encounterType), id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetEncounter(database.WithPrimaryReads(ctx), encounterType, id)
+}
+
+// Query routes an encounter back to its doctor when the coder disagrees with
+// or can't code from the documentation. Its billing is blocked again until
+// the doctor answers and it is coded.
+func (s *CodingService) Query(ctx context.Context, encounterType string, id int, question string, userID int) (*models.EncounterCoding, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		encounter, err := s.getEncounter(ctx, tx, encounterType, id)
+		if err != nil {
+			return err
+		}
+		if encounter.Status == models.CODING_STATUS_QUERIED {
+			return ErrCodingQueried
+		}
+
+		query := `INSERT INTO EncounterCodings (encounter_type, encounter_id, status, query, queried_by, queried_at)
+                  VALUES (?, ?, ?, ?, ?, ?)
+                  ON CONFLICT (encounter_type, encounter_id) DO UPDATE SET status = excluded.status, query = excluded.query,
+                      queried_by = excluded.queried_by, queried_at = excluded.queried_at, doctor_response = NULL, responded_at = NULL`
+		if _, err := tx.ExecContext(ctx, query, encounterType, id, models.CODING_STATUS_QUERIED, question, userID, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		details := map[string]any{"encounterType": encounterType, "encounterId": id, "doctorId": encounter.DoctorID, "query": question}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_CODING_QUERY, encounterEntity(encounterType), id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetEncounter(database.WithPrimaryReads(ctx), encounterType, id)
+}
+
+// Respond records the doctor's answer to a query and returns the encounter
+// to the coders. Only the encounter's doctor may answer unless override is set (admins).
+func (s *CodingService) Respond(ctx context.Context, encounterType string, id int, answer string, doctorID int, override bool) (*models.EncounterCoding, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		encounter, err := s.getEncounter(ctx, tx, encounterType, id)
+		if err != nil {
+			return err
+		}
+		if encounter.Status != models.CODING_STATUS_QUERIED {
+			return ErrCodingNotQueried
+		}
+		if encounter.DoctorID != doctorID && !override {
+			return ErrNotEncounterDoctor
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE EncounterCodings SET status = ?, doctor_response = ?, responded_at = ?
+                  WHERE encounter_type = ? AND encounter_id = ?`,
+			models.CODING_STATUS_ANSWERED, answer, time.Now().UTC(), encounterType, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetEncounter(database.WithPrimaryReads(ctx), encounterType, id)
+}
+
+// checkBillable returns a *CodingIncompleteError if the encounter's type
+// must be coded before billing and it isn't
+func (s *CodingService) checkBillable(ctx context.Context, q querier, encounterType string, id int) error {
+	if !slices.Contains(s.required, encounterType) {
+		return nil
+	}
+	encounter, err := s.getEncounter(ctx, q, encounterType, id)
+	if err != nil {
+		return err
+	}
+	if encounter.Status != models.CODING_STATUS_CODED {
+		return &CodingIncompleteError{EncounterType: encounterType, EncounterID: id, Status: encounter.Status}
+	}
+	return nil
+}
+
+func (s *CodingService) getEncounter(ctx context.Context, q querier, encounterType string, id int) (*models.EncounterCoding, error) {
+	encounters, err := s.queryEncounters(ctx, q, encounterType, ` AND `+encounterKeys[encounterType]+` = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(encounters) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &encounters[0], nil
+}
+
+// queryEncounters lists completed encounters of one type, or every type when
+// encounterType is empty, in date order. clause filters on r and c.
+func (s *CodingService) queryEncounters(ctx context.Context, q querier, encounterType, clause string, args ...any) ([]models.EncounterCoding, error) {
+	types := []string{models.ENCOUNTER_OUTPATIENT, models.ENCOUNTER_INPATIENT}
+	if encounterType != "" {
+		types = []string{encounterType}
+	}
+
+	encounters := []models.EncounterCoding{}
+	for _, encounterType := range types {
+		source, ok := encounterSources[encounterType]
+		if !ok {
+			return nil, fmt.Errorf("unknown encounter type %q", encounterType)
+		}
+
+		rows, err := q.QueryContext(ctx, fmt.Sprintf(source, codingColumns)+clause, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			e := models.EncounterCoding{EncounterType: encounterType}
+			var diagnoses, procedures string
+			var encounterDate any
+			if err := rows.Scan(&e.EncounterID, &e.PatientID, &e.DoctorID, &encounterDate, &e.Diagnosis, &e.Status, &diagnoses, &procedures,
+				&e.CodedBy, &e.CodedAt, &e.Query, &e.QueriedBy, &e.QueriedAt, &e.DoctorResponse, &e.RespondedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			// A visit is dated by its day, an admission by its discharge time
+			switch date := encounterDate.(type) {
+			case time.Time:
+				e.EncounterDate = date
+			case string:
+				e.EncounterDate = startOfDate(date)
+			}
+			e.DiagnosisCodes, e.ProcedureCodes = splitCodes(diagnoses), splitCodes(procedures)
+			e.BillingBlocked = slices.Contains(s.required, encounterType) && e.Status != models.CODING_STATUS_CODED
+			encounters = append(encounters, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(encounters, func(i, j int) bool {
+		return encounters[i].EncounterDate.Before(encounters[j].EncounterDate)
+	})
+	return encounters, nil
+}
+
+// encounterEntity is the entity an encounter is recorded as
+func encounterEntity(encounterType string) string {
+	if encounterType == models.ENCOUNTER_INPATIENT {
+		return models.ENTITY_ADMISSION
+	}
+	return models.ENTITY_MEDICAL_RECORD
+}
+
+// normalizeCodes upper-cases codes and drops repeats, keeping their order
+func normalizeCodes(codes []string) []string {
+	normalized := []string{}
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code != "" && !slices.Contains(normalized, code) {
+			normalized = append(normalized, code)
+		}
+	}
+	return normalized
+}
+
+func splitCodes(codes string) []string {
+	if codes == "" {
+		return []string{}
+	}
+	return strings.Split(codes, ",")
+}
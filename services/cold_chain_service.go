@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrInvalidSensorKey is returned when a reading's sensor key matches no storage unit
+	ErrInvalidSensorKey = errors.New("invalid sensor key")
+	// ErrInvalidThresholds is returned when the minimum temperature isn't below the maximum
+	ErrInvalidThresholds = errors.New("minimum temperature must be below maximum")
+)
+
+// ColdChainService records vaccine fridge temperatures, opens and closes
+// excursions as readings leave and re-enter a unit's range, and links
+// excursions to the vaccine batches they may have spoiled
+type ColdChainService struct {
+	defaultMinTemp float64
+	defaultMaxTemp float64
+}
+
+// NewColdChainService uses minTemp and maxTemp (°C) for units created without thresholds
+func NewColdChainService(minTemp, maxTemp float64) *ColdChainService {
+	return &ColdChainService{defaultMinTemp: minTemp, defaultMaxTemp: maxTemp}
+}
+
+// CreateUnit registers a storage unit and returns it with its sensor key,
+// which is not retrievable afterwards
+func (s *ColdChainService) CreateUnit(ctx context.Context, unit *models.StorageUnit) error {
+	if unit.MinTemp == nil {
+		unit.MinTemp = &s.defaultMinTemp
+	}
+	if unit.MaxTemp == nil {
+		unit.MaxTemp = &s.defaultMaxTemp
+	}
+	if *unit.MinTemp >= *unit.MaxTemp {
+		return ErrInvalidThresholds
+	}
+
+	key, hash, err := newSensorKey()
+	if err != nil {
+		return err
+	}
+
+	unit.CreatedAt = time.Now()
+	query := `INSERT INTO StorageUnits (name, location, min_temp, max_temp, sensor_key_hash, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := database.GetDB().ExecContext(ctx, query, unit.Name, unit.Location, *unit.MinTemp, *unit.MaxTemp, hash, unit.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	unit.UnitID = int(id)
+	unit.SensorKey = key
+	return nil
+}
+
+// RotateSensorKey replaces a unit's sensor key; the old key stops working immediately
+func (s *ColdChainService) RotateSensorKey(ctx context.Context, unitID int) (string, error) {
+	key, hash, err := newSensorKey()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE StorageUnits SET sensor_key_hash = ? WHERE unit_id = ?`, hash, unitID)
+	if err != nil {
+		return "", err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return "", sql.ErrNoRows
+	}
+	return key, nil
+}
+
+// SetThresholds changes the acceptable range for future readings
+func (s *ColdChainService) SetThresholds(ctx context.Context, unitID int, minTemp, maxTemp float64) error {
+	if minTemp >= maxTemp {
+		return ErrInvalidThresholds
+	}
+
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE StorageUnits SET min_temp = ?, max_temp = ? WHERE unit_id = ?`, minTemp, maxTemp, unitID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUnits lists storage units with any open excursion
+func (s *ColdChainService) GetUnits(ctx context.Context) ([]models.StorageUnit, error) {
+	query := `SELECT unit_id, name, COALESCE(location, ''), min_temp, max_temp, created_at FROM StorageUnits ORDER BY name`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	units := []models.StorageUnit{}
+	for rows.Next() {
+		var unit models.StorageUnit
+		if err := rows.Scan(&unit.UnitID, &unit.Name, &unit.Location, &unit.MinTemp, &unit.MaxTemp, &unit.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	open, err := s.queryExcursions(ctx, database.ReadDB(ctx), `WHERE e.ended_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	for i := range units {
+		for j := range open {
+			if open[j].UnitID == units[i].UnitID {
+				units[i].OpenExcursion = &open[j]
+			}
+		}
+	}
+
+	return units, nil
+}
+
+// RecordReadings stores readings from the sensor identified by sensorKey and
+// opens or closes excursions. Readings without a time are stamped now. It
+// returns the excursions opened by these readings.
+func (s *ColdChainService) RecordReadings(ctx context.Context, sensorKey string, readings []models.TemperatureReading) ([]models.TemperatureExcursion, error) {
+	now := time.Now()
+	for i := range readings {
+		if readings[i].RecordedAt.IsZero() {
+			readings[i].RecordedAt = now
+		}
+		readings[i].ReceivedAt = now
+	}
+	sort.SliceStable(readings, func(i, j int) bool { return readings[i].RecordedAt.Before(readings[j].RecordedAt) })
+
+	var opened []int
+	var unitName string
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		opened = nil
+
+		var unitID int
+		var minTemp, maxTemp float64
+		err := tx.QueryRowContext(ctx, `SELECT unit_id, name, min_temp, max_temp FROM StorageUnits WHERE sensor_key_hash = ?`,
+			hashSensorKey(sensorKey)).Scan(&unitID, &unitName, &minTemp, &maxTemp)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidSensorKey
+		}
+		if err != nil {
+			return err
+		}
+
+		for i := range readings {
+			reading := &readings[i]
+			reading.UnitID = unitID
+			result, err := tx.ExecContext(ctx, `INSERT INTO TemperatureReadings (unit_id, temperature, recorded_at, received_at) VALUES (?, ?, ?, ?)`,
+				unitID, *reading.Temperature, reading.RecordedAt, reading.ReceivedAt)
+			if err != nil {
+				return err
+			}
+			id, _ := result.LastInsertId()
+			reading.ReadingID = int(id)
+
+			excursionID, err := trackExcursion(ctx, tx, unitID, minTemp, maxTemp, reading)
+			if err != nil {
+				return err
+			}
+			if excursionID != 0 {
+				opened = append(opened, excursionID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	excursions := []models.TemperatureExcursion{}
+	for _, id := range opened {
+		excursion, err := s.GetExcursion(database.WithPrimaryReads(ctx), id)
+		if err != nil {
+			return nil, err
+		}
+		// Pharmacy staff see open excursions at GET /api/cold-chain/alerts
+		slog.Warn("Cold chain excursion", "unit", unitName, "excursion", id,
+			"temperature", excursion.HighestTemp, "min", excursion.MinTemp, "max", excursion.MaxTemp, "batches", len(excursion.Batches))
+		excursions = append(excursions, *excursion)
+	}
+
+	return excursions, nil
+}
+
+// trackExcursion applies one reading to the unit's excursion state and
+// returns the ID of the excursion it opened, if any
+func trackExcursion(ctx context.Context, tx *sql.Tx, unitID int, minTemp, maxTemp float64, reading *models.TemperatureReading) (int, error) {
+	temperature := *reading.Temperature
+	outOfRange := temperature < minTemp || temperature > maxTemp
+
+	var openID int
+	err := tx.QueryRowContext(ctx, `SELECT excursion_id FROM TemperatureExcursions WHERE unit_id = ? AND ended_at IS NULL`, unitID).Scan(&openID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	switch {
+	case outOfRange && openID == 0:
+		query := `INSERT INTO TemperatureExcursions (unit_id, started_at, lowest_temp, highest_temp, min_temp, max_temp) VALUES (?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, unitID, reading.RecordedAt, temperature, temperature, minTemp, maxTemp)
+		if err != nil {
+			return 0, err
+		}
+		id, _ := result.LastInsertId()
+
+		// Every batch in the unit when the excursion started may be affected
+		_, err = tx.ExecContext(ctx, `INSERT INTO ExcursionBatches (excursion_id, batch_id)
+              SELECT CAST(? AS INTEGER), batch_id FROM VaccineBatches WHERE unit_id = ?`, id, unitID)
+		return int(id), err
+	case outOfRange:
+		_, err := tx.ExecContext(ctx, `UPDATE TemperatureExcursions
+              SET lowest_temp = CASE WHEN lowest_temp < ? THEN lowest_temp ELSE ? END,
+                  highest_temp = CASE WHEN highest_temp > ? THEN highest_temp ELSE ? END
+              WHERE excursion_id = ?`, temperature, temperature, temperature, temperature, openID)
+		return 0, err
+	case openID != 0:
+		_, err := tx.ExecContext(ctx, `UPDATE TemperatureExcursions SET ended_at = ? WHERE excursion_id = ?`, reading.RecordedAt, openID)
+		return 0, err
+	}
+	return 0, nil
+}
+
+// GetReadings lists a unit's readings since the given time, newest first
+func (s *ColdChainService) GetReadings(ctx context.Context, unitID int, since time.Time) ([]models.TemperatureReading, error) {
+	query := `SELECT reading_id, unit_id, temperature, recorded_at, received_at FROM TemperatureReadings
+              WHERE unit_id = ? AND recorded_at >= ? ORDER BY recorded_at DESC`
+	return queryReadings(ctx, database.ReadDB(ctx), query, unitID, since)
+}
+
+func queryReadings(ctx context.Context, q *sql.DB, query string, args ...any) ([]models.TemperatureReading, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	readings := []models.TemperatureReading{}
+	for rows.Next() {
+		var reading models.TemperatureReading
+		if err := rows.Scan(&reading.ReadingID, &reading.UnitID, &reading.Temperature, &reading.RecordedAt, &reading.ReceivedAt); err != nil {
+			return nil, err
+		}
+		readings = append(readings, reading)
+	}
+	return readings, rows.Err()
+}
+
+// GetAlerts lists excursions pharmacy staff haven't acknowledged, open ones first
+func (s *ColdChainService) GetAlerts(ctx context.Context) ([]models.TemperatureExcursion, error) {
+	return s.queryExcursions(ctx, database.ReadDB(ctx), `WHERE e.acknowledged_at IS NULL ORDER BY e.ended_at IS NOT NULL, e.started_at DESC`)
+}
+
+// GetExcursions lists a unit's excursions, newest first
+func (s *ColdChainService) GetExcursions(ctx context.Context, unitID int) ([]models.TemperatureExcursion, error) {
+	return s.queryExcursions(ctx, database.ReadDB(ctx), `WHERE e.unit_id = ? ORDER BY e.started_at DESC`, unitID)
+}
+
+// GetExcursion returns an excursion with its affected batches
+func (s *ColdChainService) GetExcursion(ctx context.Context, id int) (*models.TemperatureExcursion, error) {
+	excursions, err := s.queryExcursions(ctx, database.ReadDB(ctx), `WHERE e.excursion_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(excursions) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	excursion := excursions[0]
+	excursion.Batches, err = s.queryBatches(ctx, `JOIN ExcursionBatches eb ON eb.batch_id = b.batch_id WHERE eb.excursion_id = ? ORDER BY b.batch_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	return &excursion, nil
+}
+
+// Acknowledge records that pharmacy staff have handled the excursion alert
+func (s *ColdChainService) Acknowledge(ctx context.Context, id, userID int, notes string) (*models.TemperatureExcursion, error) {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE TemperatureExcursions SET acknowledged_by = ?, acknowledged_at = ?, notes = ?
+              WHERE excursion_id = ?`, userID, time.Now(), notes, id)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.GetExcursion(database.WithPrimaryReads(ctx), id)
+}
+
+// GetExcursionReport gathers an excursion, its readings and the batches it affected
+func (s *ColdChainService) GetExcursionReport(ctx context.Context, id int) (*models.ExcursionReport, error) {
+	excursion, err := s.GetExcursion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	if excursion.EndedAt != nil {
+		end = *excursion.EndedAt
+	}
+	readings, err := queryReadings(ctx, database.ReadDB(ctx), `SELECT reading_id, unit_id, temperature, recorded_at, received_at FROM TemperatureReadings
+              WHERE unit_id = ? AND recorded_at >= ? AND recorded_at <= ? ORDER BY recorded_at`, excursion.UnitID, excursion.StartedAt, end)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := excursion.Batches
+	excursion.Batches = nil
+	if batches == nil {
+		batches = []models.VaccineBatch{}
+	}
+
+	return &models.ExcursionReport{
+		Excursion:       *excursion,
+		DurationMinutes: end.Sub(excursion.StartedAt).Minutes(),
+		Readings:        readings,
+		AffectedBatches: batches,
+	}, nil
+}
+
+func (s *ColdChainService) queryExcursions(ctx context.Context, q *sql.DB, clause string, args ...any) ([]models.TemperatureExcursion, error) {
+	query := `SELECT e.excursion_id, e.unit_id, u.name, e.started_at, e.ended_at, e.lowest_temp, e.highest_temp, e.min_temp, e.max_temp,
+                  e.acknowledged_by, e.acknowledged_at, COALESCE(e.notes, '')
+              FROM TemperatureExcursions e JOIN StorageUnits u ON u.unit_id = e.unit_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	excursions := []models.TemperatureExcursion{}
+	for rows.Next() {
+		var e models.TemperatureExcursion
+		err := rows.Scan(&e.ExcursionID, &e.UnitID, &e.UnitName, &e.StartedAt, &e.EndedAt, &e.LowestTemp, &e.HighestTemp,
+			&e.MinTemp, &e.MaxTemp, &e.AcknowledgedBy, &e.AcknowledgedAt, &e.Notes)
+		if err != nil {
+			return nil, err
+		}
+		excursions = append(excursions, e)
+	}
+	return excursions, rows.Err()
+}
+
+// CreateBatch records a vaccine batch stored in a unit. A batch placed in a
+// unit that is already out of range is linked to the open excursion.
+func (s *ColdChainService) CreateBatch(ctx context.Context, batch *models.VaccineBatch) error {
+	batch.CreatedAt = time.Now()
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM StorageUnits WHERE unit_id = ?`, batch.UnitID).Scan(&exists); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO VaccineBatches (unit_id, vaccine_name, lot_number, quantity, expiry_date, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, batch.UnitID, batch.VaccineName, batch.LotNumber, batch.Quantity, batch.ExpiryDate, batch.CreatedAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		batch.BatchID = int(id)
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO ExcursionBatches (excursion_id, batch_id)
+              SELECT excursion_id, ? FROM TemperatureExcursions WHERE unit_id = ? AND ended_at IS NULL`, batch.BatchID, batch.UnitID)
+		return err
+	})
+}
+
+// GetBatches lists vaccine batches, optionally only those in one unit
+func (s *ColdChainService) GetBatches(ctx context.Context, unitID int) ([]models.VaccineBatch, error) {
+	if unitID != 0 {
+		return s.queryBatches(ctx, `WHERE b.unit_id = ? ORDER BY b.expiry_date`, unitID)
+	}
+	return s.queryBatches(ctx, `ORDER BY b.expiry_date`)
+}
+
+// SetQuarantined marks a batch as quarantined (e.g. after an excursion) or releases it
+func (s *ColdChainService) SetQuarantined(ctx context.Context, batchID int, quarantined bool) error {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE VaccineBatches SET quarantined = ? WHERE batch_id = ?`, quarantined, batchID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *ColdChainService) queryBatches(ctx context.Context, clause string, args ...any) ([]models.VaccineBatch, error) {
+	query := `SELECT b.batch_id, b.unit_id, b.vaccine_name, b.lot_number, b.quantity, b.expiry_date, b.quarantined, b.created_at
+              FROM VaccineBatches b ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := []models.VaccineBatch{}
+	for rows.Next() {
+		var b models.VaccineBatch
+		if err := rows.Scan(&b.BatchID, &b.UnitID, &b.VaccineName, &b.LotNumber, &b.Quantity, &b.ExpiryDate, &b.Quarantined, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+// newSensorKey returns a random sensor key and the hash stored for it
+func newSensorKey() (key, hash string, err error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	key = "ccs_" + hex.EncodeToString(secret)
+	return key, hashSensorKey(key), nil
+}
+
+func hashSensorKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrUnknownDepartment is returned when assigning a user to a department that doesn't exist
+	ErrUnknownDepartment = errors.New("department does not exist")
+	// ErrDepartmentInactive is returned when assigning a user to a retired department
+	ErrDepartmentInactive = errors.New("department is no longer in use")
+	// ErrPatientDepartment is returned when assigning a patient's portal account to a department
+	ErrPatientDepartment = errors.New("patient accounts can't be assigned to departments")
+)
+
+// DepartmentService manages departments and the staff assigned to them.
+// Appointments and medical records belong to a department through their
+// doctor's assignment.
+type DepartmentService struct {
+	audit *AuditService
+}
+
+func NewDepartmentService() *DepartmentService {
+	return &DepartmentService{audit: NewAuditService()}
+}
+
+// GetDepartments lists every department, including retired ones
+func (s *DepartmentService) GetDepartments(ctx context.Context) ([]models.Department, error) {
+	return queryDepartments(ctx, database.ReadDB(ctx), `ORDER BY name, code`)
+}
+
+// SaveDepartment creates a department or updates the one with the same code
+func (s *DepartmentService) SaveDepartment(ctx context.Context, department *models.Department, userID int) error {
+	department.Code = normalizeDepartment(department.Code)
+	department.Name = strings.TrimSpace(department.Name)
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO Departments (code, name, description, active) VALUES (?, ?, ?, ?)
+                  ON CONFLICT (code) DO UPDATE SET name = excluded.name, description = excluded.description,
+                      active = excluded.active`
+		if _, err := tx.ExecContext(ctx, query, department.Code, department.Name, department.Description, department.Active); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_DEPARTMENT_SAVED, "", 0, department)
+	})
+}
+
+// GetMembers lists the staff assigned to a department by name, optionally
+// only those with role
+func (s *DepartmentService) GetMembers(ctx context.Context, code, role string) ([]models.DepartmentMember, error) {
+	db := database.ReadDB(ctx)
+	code = normalizeDepartment(code)
+	if _, err := getDepartment(ctx, db, code); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT u.user_id, u.full_name, COALESCE(u.role, ''), d.assigned_at
+              FROM UserDepartments d
+              JOIN Users u ON u.user_id = d.user_id
+              WHERE d.department_code = ?`
+	args := []any{code}
+	if role != "" {
+		query += ` AND u.role = ?`
+		args = append(args, role)
+	}
+	query += ` ORDER BY u.full_name, u.user_id`
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.DepartmentMember{}
+	for rows.Next() {
+		var m models.DepartmentMember
+		if err := rows.Scan(&m.UserID, &m.FullName, &m.Role, &m.AssignedAt); err != nil {
+			return nil, err
+		}
+		// Roles are shown lower-case, as the user endpoints show them
+		m.Role = strings.ToLower(m.Role)
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// GetUserDepartments lists the departments a user is assigned to
+func (s *DepartmentService) GetUserDepartments(ctx context.Context, userID int) ([]models.Department, error) {
+	db := database.ReadDB(ctx)
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT 1 FROM Users WHERE user_id = ?`, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	return queryDepartments(ctx, db, `WHERE code IN (SELECT department_code FROM UserDepartments WHERE user_id = ?)
+              ORDER BY name, code`, userID)
+}
+
+// SetUserDepartments replaces the departments a staff member is assigned
+// to on behalf of the admin adminID. Existing assignments keep their
+// original date; staff may stay in a department that has since been retired
+// but not join one.
+func (s *DepartmentService) SetUserDepartments(ctx context.Context, userID int, codes []string, adminID int) ([]models.Department, error) {
+	normalized := []string{}
+	for _, code := range codes {
+		if code = normalizeDepartment(code); code != "" && !slices.Contains(normalized, code) {
+			normalized = append(normalized, code)
+		}
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var role sql.NullString
+		if err := tx.QueryRowContext(ctx, `SELECT role FROM Users WHERE user_id = ?`, userID).Scan(&role); err != nil {
+			return err
+		}
+		if role.String == models.ROLE_PATIENT {
+			return ErrPatientDepartment
+		}
+
+		current, err := queryDepartments(ctx, tx, `WHERE code IN (SELECT department_code FROM UserDepartments WHERE user_id = ?)`, userID)
+		if err != nil {
+			return err
+		}
+		for _, code := range normalized {
+			if slices.ContainsFunc(current, func(d models.Department) bool { return d.Code == code }) {
+				continue
+			}
+			department, err := getDepartment(ctx, tx, code)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: %s", ErrUnknownDepartment, code)
+			} else if err != nil {
+				return err
+			}
+			if !department.Active {
+				return fmt.Errorf("%w: %s", ErrDepartmentInactive, code)
+			}
+			query := `INSERT INTO UserDepartments (user_id, department_code, assigned_at) VALUES (?, ?, ?)`
+			if _, err := tx.ExecContext(ctx, query, userID, code, time.Now().UTC()); err != nil {
+				return err
+			}
+		}
+		for _, department := range current {
+			if slices.Contains(normalized, department.Code) {
+				continue
+			}
+			query := `DELETE FROM UserDepartments WHERE user_id = ? AND department_code = ?`
+			if _, err := tx.ExecContext(ctx, query, userID, department.Code); err != nil {
+				return err
+			}
+		}
+
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_USER_DEPARTMENTS_SET, models.ENTITY_USER, userID,
+			map[string]any{"departments": normalized})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserDepartments(database.WithPrimaryReads(ctx), userID)
+}
+
+// departmentDoctors returns the IDs of the doctors assigned to a department
+func departmentDoctors(ctx context.Context, q querier, code string) ([]int, error) {
+	query := `SELECT d.user_id FROM UserDepartments d JOIN Users u ON u.user_id = d.user_id
+              WHERE d.department_code = ? AND u.role = ? ORDER BY d.user_id`
+	rows, err := q.QueryContext(ctx, query, normalizeDepartment(code), models.ROLE_DOCTOR)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// getDepartment returns sql.ErrNoRows if the department doesn't exist
+func getDepartment(ctx context.Context, q querier, code string) (*models.Department, error) {
+	departments, err := queryDepartments(ctx, q, `WHERE code = ?`, code)
+	if err != nil {
+		return nil, err
+	}
+	if len(departments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &departments[0], nil
+}
+
+// normalizeDepartment stores department codes lower-case so "Cardiology" and "cardiology" match
+func normalizeDepartment(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+func queryDepartments(ctx context.Context, q querier, clause string, args ...any) ([]models.Department, error) {
+	query := `SELECT code, name, COALESCE(description, ''), active FROM Departments ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	departments := []models.Department{}
+	for rows.Next() {
+		var d models.Department
+		if err := rows.Scan(&d.Code, &d.Name, &d.Description, &d.Active); err != nil {
+			return nil, err
+		}
+		departments = append(departments, d)
+	}
+	return departments, rows.Err()
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/pdf"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// ErrAdmissionOpen is returned when summarizing an admission the patient
+// hasn't been discharged from
+var ErrAdmissionOpen = errors.New("the patient hasn't been discharged from this admission yet")
+
+// DischargeSummaryService generates discharge summaries from the chart and
+// keeps them. The chart is read through its own services, so decryption
+// and ordering apply as usual; the summary's content is encrypted at rest
+// as a whole, since it repeats the diagnoses, allergies and notes.
+type DischargeSummaryService struct {
+	admissions    *AdmissionService
+	records       *MedicalRecordService
+	prescriptions *PrescriptionService
+	allergies     *AllergyService
+	audit         *AuditService
+}
+
+func NewDischargeSummaryService(records *MedicalRecordService, prescriptions *PrescriptionService) *DischargeSummaryService {
+	return &DischargeSummaryService{
+		admissions:    NewAdmissionService(),
+		records:       records,
+		prescriptions: prescriptions,
+		allergies:     NewAllergyService(),
+		audit:         NewAuditService(),
+	}
+}
+
+// Generate summarizes a discharged admission and saves the summary as
+// generated by userID. An admission may be summarized again, e.g. after a
+// late result; each summary is kept.
+func (s *DischargeSummaryService) Generate(ctx context.Context, admissionID int, request models.DischargeSummaryRequest, userID int) (*models.DischargeSummary, error) {
+	ctx = database.WithPrimaryReads(ctx)
+	admission, err := s.admissions.GetAdmission(ctx, admissionID)
+	if err != nil {
+		return nil, err
+	}
+	if admission.Status != models.ADMISSION_STATUS_DISCHARGED || admission.DischargedAt == nil || admission.DischargedBy == nil {
+		return nil, ErrAdmissionOpen
+	}
+
+	content, err := s.collect(ctx, admission)
+	if err != nil {
+		return nil, err
+	}
+	content.FollowUpInstructions = strings.TrimSpace(request.FollowUpInstructions)
+
+	summary := &models.DischargeSummary{
+		PatientID:   admission.PatientID,
+		AdmissionID: admissionID,
+		GeneratedAt: time.Now().UTC(),
+		Content:     *content,
+	}
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO DischargeSummaries (patient_id, admission_id, generated_by, generated_at, content) VALUES (?, ?, ?, ?, '')`
+		result, err := tx.ExecContext(ctx, query, summary.PatientID, admissionID, userID, summary.GeneratedAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		summary.SummaryID = int(id)
+		if err := storeDischargeSummary(ctx, tx, summary.SummaryID, &summary.Content); err != nil {
+			return err
+		}
+
+		if summary.GeneratedBy, err = staffRef(ctx, tx, userID); err != nil {
+			return err
+		}
+		details := map[string]any{"patientId": summary.PatientID, "admissionId": admissionID}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_DISCHARGE_SUMMARY_GENERATED, models.ENTITY_DISCHARGE_SUMMARY, summary.SummaryID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// collect reads what the summary says about admission from the chart
+func (s *DischargeSummaryService) collect(ctx context.Context, admission *models.Admission) (*models.DischargeSummaryContent, error) {
+	db := database.ReadDB(ctx)
+	content := &models.DischargeSummaryContent{Diagnoses: []models.DischargeDiagnosis{}, Treatments: []models.DischargeTreatment{}}
+
+	patient := &content.Patient
+	err := db.QueryRowContext(ctx, `SELECT patient_id, first_name, last_name, COALESCE(date_of_birth, ''), COALESCE(gender, '')
+              FROM Patients WHERE patient_id = ?`, admission.PatientID).
+		Scan(&patient.ID, &patient.FirstName, &patient.LastName, &patient.DateOfBirth, &patient.Gender)
+	if err != nil {
+		return nil, err
+	}
+
+	stay := &content.Admission
+	stay.ID, stay.Reason, stay.Notes = admission.AdmissionID, admission.Reason, admission.DischargeSummary
+	stay.AdmittedAt, stay.DischargedAt = admission.AdmittedAt, *admission.DischargedAt
+	err = db.QueryRowContext(ctx, `SELECT w.name, b.label FROM Beds b JOIN Wards w ON w.ward_id = b.ward_id WHERE b.bed_id = ?`, admission.BedID).
+		Scan(&stay.Ward, &stay.Bed)
+	if err != nil {
+		return nil, err
+	}
+	if stay.AdmittedBy, err = staffRef(ctx, db, admission.AdmittedBy); err != nil {
+		return nil, err
+	}
+	if stay.DischargedBy, err = staffRef(ctx, db, *admission.DischargedBy); err != nil {
+		return nil, err
+	}
+
+	if content.Allergies, err = s.allergies.GetAllergies(ctx, admission.PatientID, false); err != nil {
+		return nil, err
+	}
+
+	// Visits and prescriptions are dated by day, so the stay covers the
+	// whole of its first and last days
+	from := timezone.In(admission.AdmittedAt).Format("2006-01-02")
+	to := timezone.In(*admission.DischargedAt).Format("2006-01-02")
+
+	records, err := s.records.GetMedicalRecordsByPatient(ctx, admission.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].VisitDate < records[j].VisitDate })
+	doctors := map[int]models.StaffRef{}
+	for _, record := range records {
+		if day := record.VisitDate[:min(len(record.VisitDate), len("2006-01-02"))]; day < from || day > to {
+			continue
+		}
+		content.Diagnoses = append(content.Diagnoses, models.DischargeDiagnosis{RecordID: record.RecordID, VisitDate: record.VisitDate,
+			Diagnosis: record.Diagnosis, Codes: record.DiagnosisCodes})
+		if strings.TrimSpace(record.TreatmentPlan) == "" {
+			continue
+		}
+		doctor, ok := doctors[record.DoctorID]
+		if !ok {
+			if doctor, err = staffRef(ctx, db, record.DoctorID); err != nil {
+				return nil, err
+			}
+			doctors[record.DoctorID] = doctor
+		}
+		content.Treatments = append(content.Treatments, models.DischargeTreatment{RecordID: record.RecordID, VisitDate: record.VisitDate,
+			Plan: record.TreatmentPlan, Doctor: doctor})
+	}
+
+	filter := PrescriptionFilter{PatientID: admission.PatientID, From: from, To: to, Sort: models.PRESCRIPTION_SORT_PRESCRIBED_DATE}
+	prescriptions, _, err := s.prescriptions.GetPrescriptions(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	content.Prescriptions = make([]models.Prescription, len(prescriptions))
+	for i, prescription := range prescriptions {
+		content.Prescriptions[i] = *prescription
+	}
+	return content, nil
+}
+
+// GetSummaries lists a patient's discharge summaries, newest first
+func (s *DischargeSummaryService) GetSummaries(ctx context.Context, patientID int) ([]models.DischargeSummary, error) {
+	db := database.ReadDB(ctx)
+	if err := checkPatient(ctx, db, patientID); err != nil {
+		return nil, err
+	}
+	return queryDischargeSummaries(ctx, db, `WHERE d.patient_id = ? ORDER BY d.generated_at DESC, d.summary_id DESC`, patientID)
+}
+
+func (s *DischargeSummaryService) GetSummary(ctx context.Context, id int) (*models.DischargeSummary, error) {
+	summaries, err := queryDischargeSummaries(ctx, database.ReadDB(ctx), `WHERE d.summary_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(summaries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &summaries[0], nil
+}
+
+// DownloadSummary is the DownloadBuilder for discharge summaries: the
+// saved summary rendered as a PDF
+func (s *DischargeSummaryService) DownloadSummary(ctx context.Context, id int) (*Download, error) {
+	summary, err := s.GetSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		Filename:    fmt.Sprintf("discharge-summary-%d-%s.pdf", summary.AdmissionID, timezone.In(summary.GeneratedAt).Format("2006-01-02")),
+		ContentType: "application/pdf",
+		Body:        RenderDischargeSummary(summary),
+	}, nil
+}
+
+// RenderDischargeSummary lays a discharge summary out as a PDF
+func RenderDischargeSummary(summary *models.DischargeSummary) []byte {
+	content := summary.Content
+	doc := pdf.New("Discharge summary")
+
+	doc.Heading("Patient")
+	doc.Field("Name", content.Patient.FirstName+" "+content.Patient.LastName)
+	doc.Field("Patient ID", fmt.Sprint(content.Patient.ID))
+	doc.Field("Date of birth", content.Patient.DateOfBirth)
+	doc.Field("Gender", content.Patient.Gender)
+
+	stay := content.Admission
+	doc.Heading("Admission")
+	doc.Field("Admitted", formatDischargeTime(stay.AdmittedAt)+" by "+stay.AdmittedBy.FullName)
+	doc.Field("Discharged", formatDischargeTime(stay.DischargedAt)+" by "+stay.DischargedBy.FullName)
+	doc.Field("Ward", stay.Ward+", bed "+stay.Bed)
+	doc.Field("Reason", stay.Reason)
+	if stay.Notes != "" {
+		doc.Field("Discharge note", stay.Notes)
+	}
+
+	doc.Heading("Allergies")
+	if len(content.Allergies) == 0 {
+		doc.Paragraph("No known allergies")
+	}
+	for _, allergy := range content.Allergies {
+		line := allergy.Substance
+		if allergy.Severity != "" {
+			line += " (" + allergy.Severity + ")"
+		}
+		if allergy.Reaction != "" {
+			line += ": " + allergy.Reaction
+		}
+		doc.Paragraph(line)
+	}
+
+	doc.Heading("Diagnoses")
+	if len(content.Diagnoses) == 0 {
+		doc.Paragraph("None recorded during the stay")
+	}
+	for _, diagnosis := range content.Diagnoses {
+		text := diagnosis.Diagnosis
+		if len(diagnosis.Codes) > 0 {
+			text += " [" + strings.Join(diagnosis.Codes, ", ") + "]"
+		}
+		doc.Field(diagnosis.VisitDate, text)
+	}
+
+	doc.Heading("Treatment")
+	if len(content.Treatments) == 0 {
+		doc.Paragraph("None recorded during the stay")
+	}
+	for _, treatment := range content.Treatments {
+		doc.Field(treatment.VisitDate, treatment.Plan+" ("+treatment.Doctor.FullName+")")
+	}
+
+	doc.Heading("Prescriptions")
+	if len(content.Prescriptions) == 0 {
+		doc.Paragraph("None prescribed during the stay")
+	}
+	for _, prescription := range content.Prescriptions {
+		text := prescription.Medication + " " + prescription.Dosage
+		if prescription.Duration != "" {
+			text += " for " + prescription.Duration
+		}
+		if prescription.Instructions != "" {
+			text += ". " + prescription.Instructions
+		}
+		doc.Field(prescription.PrescribedDate, text)
+	}
+
+	doc.Heading("Follow-up instructions")
+	doc.Paragraph(content.FollowUpInstructions)
+
+	doc.Paragraph("")
+	doc.Paragraph(fmt.Sprintf("Generated by %s on %s", summary.GeneratedBy.FullName, formatDischargeTime(summary.GeneratedAt)))
+	return doc.Bytes()
+}
+
+func formatDischargeTime(t time.Time) string {
+	return timezone.In(t).Format("2 Jan 2006 15:04")
+}
+
+// storeDischargeSummary writes the content of the summary id, encrypted
+func storeDischargeSummary(ctx context.Context, tx *sql.Tx, id int, content *models.DischargeSummaryContent) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	return encryption.Store(ctx, tx, encryption.DischargeSummaryContent, id, string(data))
+}
+
+func queryDischargeSummaries(ctx context.Context, q querier, clause string, args ...any) ([]models.DischargeSummary, error) {
+	query := `SELECT d.summary_id, d.patient_id, d.admission_id, u.user_id, u.full_name, u.role, d.generated_at, d.content
+              FROM DischargeSummaries d JOIN Users u ON u.user_id = d.generated_by ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.DischargeSummary{}
+	for rows.Next() {
+		var summary models.DischargeSummary
+		var content string
+		err := rows.Scan(&summary.SummaryID, &summary.PatientID, &summary.AdmissionID, &summary.GeneratedBy.ID, &summary.GeneratedBy.FullName,
+			&summary.GeneratedBy.Role, &summary.GeneratedAt, &content)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = encryption.Open(encryption.DischargeSummaryContent, summary.SummaryID, content); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(content), &summary.Content); err != nil {
+			return nil, fmt.Errorf("discharge summary %d: %w", summary.SummaryID, err)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// staffRef names the user userID
+func staffRef(ctx context.Context, q queryRower, userID int) (models.StaffRef, error) {
+	var ref models.StaffRef
+	err := q.QueryRowContext(ctx, `SELECT user_id, full_name, role FROM Users WHERE user_id = ?`, userID).Scan(&ref.ID, &ref.FullName, &ref.Role)
+	return ref, err
+}
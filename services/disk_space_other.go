@@ -0,0 +1,10 @@
+//go:build !unix
+
+package services
+
+import "errors"
+
+// freeDiskSpace is only implemented on Unix; the disk check reports this error
+func freeDiskSpace(dir string) (uint64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
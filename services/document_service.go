@@ -0,0 +1,262 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/storage"
+)
+
+var (
+	// ErrUnsupportedDocumentType is returned for uploads that aren't a PDF or image
+	ErrUnsupportedDocumentType = errors.New("documents must be PDF, JPEG, PNG, GIF, WebP, BMP or TIFF files")
+	// ErrDocumentRecordMismatch is returned when attaching to another patient's medical record
+	ErrDocumentRecordMismatch = errors.New("medical record belongs to a different patient")
+)
+
+// documentTypes are the accepted content types, as detected from the file
+// contents rather than trusted from the upload
+var documentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"image/tiff":      true,
+}
+
+// DocumentService keeps patient documents: metadata in the database and
+// the files themselves in the document store
+type DocumentService struct {
+	store storage.Store
+	audit *AuditService
+}
+
+func NewDocumentService(store storage.Store) *DocumentService {
+	return &DocumentService{
+		store: store,
+		audit: NewAuditService(),
+	}
+}
+
+// DetectDocumentType returns the content type of data, or
+// ErrUnsupportedDocumentType if it isn't an accepted kind of document
+func DetectDocumentType(data []byte) (string, error) {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	// net/http doesn't sniff TIFF, the usual format for scanned pages
+	if bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*")) {
+		contentType = "image/tiff"
+	}
+	if !documentTypes[contentType] {
+		return "", ErrUnsupportedDocumentType
+	}
+	return contentType, nil
+}
+
+// Upload stores data and records doc. ContentType, size and checksum are
+// derived from data.
+func (s *DocumentService) Upload(ctx context.Context, doc *models.Document, data []byte) error {
+	contentType, err := DetectDocumentType(data)
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	var exists int
+	if err := db.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, doc.PatientID).Scan(&exists); err != nil {
+		return err
+	}
+	if doc.RecordID != nil {
+		var patientID int
+		if err := db.QueryRowContext(ctx, `SELECT patient_id FROM MedicalRecords WHERE record_id = ?`, *doc.RecordID).Scan(&patientID); err != nil {
+			return err
+		}
+		if patientID != doc.PatientID {
+			return ErrDocumentRecordMismatch
+		}
+	}
+
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+
+	doc.Filename = cleanFilename(doc.Filename)
+	doc.ContentType = contentType
+	doc.SizeBytes = int64(len(data))
+	doc.SHA256 = hex.EncodeToString(sum[:])
+	doc.StorageKey = fmt.Sprintf("patients/%d/%s", doc.PatientID, hex.EncodeToString(suffix))
+	doc.UploadedAt = time.Now()
+
+	if err := s.store.Put(ctx, doc.StorageKey, data, doc.ContentType); err != nil {
+		return fmt.Errorf("store document: %w", err)
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO Documents (patient_id, record_id, filename, content_type, size_bytes, sha256, description, storage_key, uploaded_by, uploaded_at)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, doc.PatientID, doc.RecordID, doc.Filename, doc.ContentType, doc.SizeBytes, doc.SHA256,
+			doc.Description, doc.StorageKey, doc.UploadedBy, doc.UploadedAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		doc.DocumentID = int(id)
+
+		details := map[string]any{"patientId": doc.PatientID, "filename": doc.Filename, "bytes": doc.SizeBytes}
+		return s.audit.Log(ctx, tx, doc.UploadedBy, models.AUDIT_DOCUMENT_UPLOADED, models.ENTITY_DOCUMENT, doc.DocumentID, details)
+	})
+	if err != nil {
+		if deleteErr := s.store.Delete(context.WithoutCancel(ctx), doc.StorageKey); deleteErr != nil {
+			slog.Error("Failed to remove orphaned document", "key", doc.StorageKey, "error", deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// GetDocuments lists a patient's documents, newest first, optionally only
+// those attached to one medical record
+func (s *DocumentService) GetDocuments(ctx context.Context, patientID int, recordID int) ([]models.Document, error) {
+	if recordID != 0 {
+		return s.queryDocuments(ctx, `WHERE patient_id = ? AND record_id = ? ORDER BY uploaded_at DESC`, patientID, recordID)
+	}
+	return s.queryDocuments(ctx, `WHERE patient_id = ? ORDER BY uploaded_at DESC`, patientID)
+}
+
+// GetRecordDocuments lists the documents attached to a medical record
+func (s *DocumentService) GetRecordDocuments(ctx context.Context, recordID int) ([]models.Document, error) {
+	return s.queryDocuments(ctx, `WHERE record_id = ? ORDER BY uploaded_at DESC`, recordID)
+}
+
+func (s *DocumentService) GetDocument(ctx context.Context, id int) (*models.Document, error) {
+	documents, err := s.queryDocuments(ctx, `WHERE document_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(documents) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &documents[0], nil
+}
+
+// OpenDocument returns a document and a reader for its contents, which the caller closes
+func (s *DocumentService) OpenDocument(ctx context.Context, id int) (*models.Document, io.ReadCloser, error) {
+	doc, err := s.GetDocument(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := s.store.Get(ctx, doc.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, fmt.Errorf("document %d is missing from storage", id)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, body, nil
+}
+
+// DownloadDocument is the DownloadBuilder for documents
+func (s *DocumentService) DownloadDocument(ctx context.Context, id int) (*Download, error) {
+	doc, body, err := s.OpenDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{Filename: doc.Filename, ContentType: doc.ContentType, Body: data}, nil
+}
+
+// DeleteDocument removes the record and then the stored file
+func (s *DocumentService) DeleteDocument(ctx context.Context, id, userID int) error {
+	doc, err := s.GetDocument(database.WithPrimaryReads(ctx), id)
+	if err != nil {
+		return err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM Documents WHERE document_id = ?`, id)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return sql.ErrNoRows
+		}
+
+		details := map[string]any{"patientId": doc.PatientID, "filename": doc.Filename, "sha256": doc.SHA256}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_DOCUMENT_DELETED, models.ENTITY_DOCUMENT, id, details)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The row is gone, so a failure here only leaves an unreachable file
+	if err := s.store.Delete(ctx, doc.StorageKey); err != nil {
+		slog.Error("Failed to remove deleted document from storage", "document", id, "key", doc.StorageKey, "error", err)
+	}
+	return nil
+}
+
+func (s *DocumentService) queryDocuments(ctx context.Context, clause string, args ...any) ([]models.Document, error) {
+	query := `SELECT document_id, patient_id, record_id, filename, content_type, size_bytes, sha256, COALESCE(description, ''),
+                  storage_key, uploaded_by, uploaded_at
+              FROM Documents ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []models.Document{}
+	for rows.Next() {
+		var d models.Document
+		err := rows.Scan(&d.DocumentID, &d.PatientID, &d.RecordID, &d.Filename, &d.ContentType, &d.SizeBytes, &d.SHA256, &d.Description,
+			&d.StorageKey, &d.UploadedBy, &d.UploadedAt)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, d)
+	}
+	return documents, rows.Err()
+}
+
+// cleanFilename keeps the base name of an uploaded file without characters
+// that would break a Content-Disposition header
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		name = "document"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
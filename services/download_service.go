@@ -0,0 +1,199 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// downloadTokenTTL is how long a minted download link stays valid
+const downloadTokenTTL = time.Minute
+
+var (
+	ErrUnknownDownload      = errors.New("unknown download kind")
+	ErrDownloadForbidden    = errors.New("role may not download this kind of file")
+	ErrInvalidDownloadToken = errors.New("download token is invalid, expired or already used")
+)
+
+// Download is a generated file
+type Download struct {
+	Filename    string
+	ContentType string
+	Body        []byte
+}
+
+// DownloadBuilder generates the file for a resource, e.g. a patient ID
+type DownloadBuilder func(ctx context.Context, resourceID int) (*Download, error)
+
+type downloadSource struct {
+	entityType string
+	roles      []string
+	build      DownloadBuilder
+}
+
+// DownloadService mints single-use download tokens and redeems them for
+// files. Subsystems register the kinds of file they can produce when they
+// are wired up in main. Tokens are kept in the database, hashed like 2FA
+// reset tokens, so any server can redeem a link another one minted.
+type DownloadService struct {
+	audit *AuditService
+
+	mu      sync.Mutex
+	sources map[string]downloadSource
+}
+
+func NewDownloadService() *DownloadService {
+	return &DownloadService{
+		audit:   NewAuditService(),
+		sources: map[string]downloadSource{},
+	}
+}
+
+// Register adds a kind of download whose resource IDs identify entityType
+// (for the audit log). roles lists who may download it besides admins; no
+// roles means any authenticated user.
+func (s *DownloadService) Register(kind, entityType string, roles []string, build DownloadBuilder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources[kind] = downloadSource{entityType: entityType, roles: roles, build: build}
+}
+
+// Issue mints a token for user to download kind/resourceID once within
+// downloadTokenTTL. sessionID binds the token to the caller's session, if any.
+func (s *DownloadService) Issue(ctx context.Context, user *models.User, kind string, resourceID int, sessionID string) (*models.DownloadToken, error) {
+	s.mu.Lock()
+	source, ok := s.sources[kind]
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, ErrUnknownDownload
+	}
+	if user.Role != models.ROLE_ADMIN && len(source.roles) > 0 && !slices.Contains(source.roles, user.Role) {
+		return nil, ErrDownloadForbidden
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	token := &models.DownloadToken{
+		Token:      hex.EncodeToString(secret),
+		Kind:       kind,
+		ResourceID: resourceID,
+		ExpiresAt:  now.Add(downloadTokenTTL),
+		UserID:     user.UserID,
+		SessionID:  sessionID,
+	}
+	token.URL = "/api/downloads/" + token.Token
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM DownloadTokens WHERE expires_at < ?`, now); err != nil {
+			return err
+		}
+		query := `INSERT INTO DownloadTokens (token_hash, kind, resource_id, user_id, session_id, expires_at) VALUES (?, ?, ?, ?, ?, ?)`
+		_, err := tx.ExecContext(ctx, query, hashDownloadToken(token.Token), kind, resourceID, user.UserID, sessionID, token.ExpiresAt)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Redeem consumes the token and generates its file. sessionActive reports
+// whether the session the token was minted in is still live. The download
+// is audit-logged against the user who minted the token.
+func (s *DownloadService) Redeem(ctx context.Context, value string, sessionActive func(sessionID string) bool) (*Download, error) {
+	var token models.DownloadToken
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `SELECT kind, resource_id, user_id, session_id, expires_at FROM DownloadTokens WHERE token_hash = ?`
+		err := tx.QueryRowContext(ctx, query, hashDownloadToken(value)).Scan(&token.Kind, &token.ResourceID, &token.UserID, &token.SessionID, &token.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		// Spent whether or not the download goes on to succeed
+		_, err = tx.ExecContext(ctx, `DELETE FROM DownloadTokens WHERE token_hash = ?`, hashDownloadToken(value))
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidDownloadToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	source, ok := s.sources[token.Kind]
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidDownloadToken
+	}
+	if token.SessionID != "" && !sessionActive(token.SessionID) {
+		return nil, ErrInvalidDownloadToken
+	}
+
+	download, err := source.build(ctx, token.ResourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]any{"filename": download.Filename, "bytes": len(download.Body)}
+	if err := s.audit.Log(ctx, database.GetDB(), token.UserID, models.AUDIT_DOWNLOAD_PREFIX+token.Kind, source.entityType, token.ResourceID, details); err != nil {
+		return nil, err
+	}
+
+	return download, nil
+}
+
+// hashDownloadToken is how a token is stored, so a copy of the database
+// can't be used to download files
+func hashDownloadToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CSVDownload encodes rows under header as a CSV file. Cells that a
+// spreadsheet would evaluate as formulas are prefixed with a quote.
+func CSVDownload(filename string, header []string, rows [][]string) (*Download, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if err := writer.Write(escapeFormulas(row)); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return &Download{Filename: filename, ContentType: "text/csv; charset=utf-8", Body: buf.Bytes()}, nil
+}
+
+// escapeFormulas prefixes cells that a spreadsheet would evaluate as
+// formulas with a quote, in place
+func escapeFormulas(row []string) []string {
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			row[i] = "'" + cell
+		}
+	}
+	return row
+}
@@ -0,0 +1,316 @@
+// Package encryption seals sensitive column values with AES-256-GCM before
+// they are written, and opens them when they are read.
+//
+// A sealed value is stored as "enc:v2:<key id>:<base64 nonce+ciphertext>".
+// The key id lets several keys be configured at once: new values are sealed
+// with the current key, values sealed with an older key still open, and
+// RewrapColumns re-seals them so the old key can be retired. Values without
+// the prefix are plaintext written before encryption was enabled and are
+// returned unchanged.
+//
+// The column name and the row's primary key are bound to each value as
+// additional data, so a value copied into another column or another row
+// fails to open. Values sealed as "enc:v1:", which bound only the column,
+// still open; RewrapColumns re-seals them in the current version.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// prefix marks values sealed for their row; legacyPrefix marks values
+// sealed for their column alone
+const (
+	prefix       = "enc:v2:"
+	legacyPrefix = "enc:v1:"
+)
+
+// ErrUnknownKey is returned when a value was sealed with a key that isn't configured
+var ErrUnknownKey = errors.New("value is encrypted with an unknown key")
+
+// Column identifies an encrypted column
+type Column struct {
+	Table    string
+	IDColumn string
+	Name     string
+}
+
+func (c Column) String() string {
+	return c.Table + "." + c.Name
+}
+
+// additionalData binds a value to the row id of column
+func (c Column) additionalData(id int) []byte {
+	return []byte(c.String() + ":" + strconv.Itoa(id))
+}
+
+// The encrypted columns
+var (
+	PatientMedicalHistory   = Column{"Patients", "patient_id", "medical_history"}
+	AllergySubstance        = Column{"Allergies", "allergy_id", "substance"}
+	AllergyReaction         = Column{"Allergies", "allergy_id", "reaction"}
+	NoteBody                = Column{"Notes", "note_id", "body"}
+	DischargeSummaryContent = Column{"DischargeSummaries", "summary_id", "content"}
+	UserTwoFASecret         = Column{"Users", "user_id", "two_fa_secret"}
+	WebhookSecret           = Column{"Webhooks", "webhook_id", "secret"}
+)
+
+// Columns lists every encrypted column
+var Columns = []Column{PatientMedicalHistory, AllergySubstance, AllergyReaction, NoteBody, DischargeSummaryContent, UserTwoFASecret, WebhookSecret}
+
+// Keyring holds the configured keys by id
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from base64-encoded 32-byte keys. New values
+// are sealed with current; the other keys only open existing values.
+func NewKeyring(current string, keys map[string]string) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current encryption key %q is not configured", current)
+	}
+
+	k := &Keyring{current: current, aeads: map[string]cipher.AEAD{}}
+	for id, encoded := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, base64-encoded", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// Seal encrypts value for the row id of column with the current key. Empty
+// values stay empty so "not set" is still visible without a key.
+func (k *Keyring) Seal(column Column, id int, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), column.additionalData(id))
+	return prefix + k.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value read from the row id of column. Plaintext values
+// are returned as they are.
+func (k *Keyring) Open(column Column, id int, value string) (string, error) {
+	keyID, data, legacy, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+
+	aead, known := k.aeads[keyID]
+	if !known {
+		return "", fmt.Errorf("%s: %w %q", column, ErrUnknownKey, keyID)
+	}
+	additionalData := column.additionalData(id)
+	if legacy {
+		additionalData = []byte(column.String())
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%s: malformed encrypted value", column)
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to decrypt value: %w", column, err)
+	}
+	return string(plaintext), nil
+}
+
+// isCurrent reports whether value is already sealed for its row with the
+// current key
+func (k *Keyring) isCurrent(value string) bool {
+	id, _, legacy, ok := parse(value)
+	return ok && !legacy && id == k.current
+}
+
+// parse splits a sealed value into its key id and data; legacy is set for
+// values sealed for their column alone
+func parse(value string) (id, data string, legacy, ok bool) {
+	rest, found := strings.CutPrefix(value, prefix)
+	if !found {
+		if rest, found = strings.CutPrefix(value, legacyPrefix); !found {
+			return "", "", false, false
+		}
+		legacy = true
+	}
+	id, data, ok = strings.Cut(rest, ":")
+	return id, data, legacy, ok
+}
+
+var (
+	mu      sync.RWMutex
+	keyring *Keyring
+)
+
+// Init installs the process-wide keyring used by Seal and Open. Without
+// one, values are written in plaintext and encrypted values fail to open.
+func Init(k *Keyring) {
+	mu.Lock()
+	defer mu.Unlock()
+	keyring = k
+}
+
+// Seal encrypts value for the row id of column with the installed keyring
+func Seal(column Column, id int, value string) (string, error) {
+	mu.RLock()
+	k := keyring
+	mu.RUnlock()
+	if k == nil {
+		return value, nil
+	}
+	return k.Seal(column, id, value)
+}
+
+// Open decrypts a value read from the row id of column with the installed
+// keyring
+func Open(column Column, id int, value string) (string, error) {
+	mu.RLock()
+	k := keyring
+	mu.RUnlock()
+	if k == nil {
+		if _, _, _, ok := parse(value); ok {
+			return "", fmt.Errorf("%s: value is encrypted but no encryption keys are configured", column)
+		}
+		return value, nil
+	}
+	return k.Open(column, id, value)
+}
+
+// Execer runs statements, like *sql.Tx
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Store seals value for the row id of column and writes it there. A row's
+// ID is part of what its values are sealed for, so rows are inserted
+// without their encrypted values, which are stored once the ID is known.
+func Store(ctx context.Context, db Execer, column Column, id int, value string) error {
+	if value == "" {
+		return nil
+	}
+	sealed, err := Seal(column, id, value)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, column.Table, column.Name, column.IDColumn), sealed, id)
+	return err
+}
+
+// RewrapColumns encrypts plaintext values and re-seals values under older
+// keys, or sealed for their column alone, with the current key for their
+// row, one table batch at a time. It is safe to run repeatedly and reports
+// how many values it rewrote.
+func RewrapColumns(ctx context.Context, db *sql.DB, k *Keyring) (int, error) {
+	total := 0
+	for _, column := range Columns {
+		n, err := rewrapColumn(ctx, db, k, column)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n > 0 {
+			log.Printf("Encrypted %d value(s) in %s with key %q", n, column, k.current)
+		}
+	}
+	return total, nil
+}
+
+func rewrapColumn(ctx context.Context, db *sql.DB, k *Keyring, column Column) (int, error) {
+	const batchSize = 500
+
+	rewritten := 0
+	lastID := 0
+	for {
+		query := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s > ? AND COALESCE(%s, '') <> '' ORDER BY %s LIMIT ?`,
+			column.IDColumn, column.Name, column.Table, column.IDColumn, column.Name, column.IDColumn)
+		rows, err := db.QueryContext(ctx, query, lastID, batchSize)
+		if err != nil {
+			return rewritten, err
+		}
+
+		type row struct {
+			id    int
+			value string
+		}
+		var batch []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.value); err != nil {
+				rows.Close()
+				return rewritten, err
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewritten, err
+		}
+		if len(batch) == 0 {
+			return rewritten, nil
+		}
+		lastID = batch[len(batch)-1].id
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return rewritten, err
+		}
+		update := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ? AND %s = ?`, column.Table, column.Name, column.IDColumn, column.Name)
+		for _, r := range batch {
+			if k.isCurrent(r.value) {
+				continue
+			}
+			plaintext, err := k.Open(column, r.id, r.value)
+			if err != nil {
+				tx.Rollback()
+				return rewritten, fmt.Errorf("%s %d: %w", column.Table, r.id, err)
+			}
+			sealed, err := k.Seal(column, r.id, plaintext)
+			if err != nil {
+				tx.Rollback()
+				return rewritten, err
+			}
+			// The value guard skips rows changed since the batch was read
+			result, err := tx.ExecContext(ctx, update, sealed, r.id, r.value)
+			if err != nil {
+				tx.Rollback()
+				return rewritten, err
+			}
+			affected, _ := result.RowsAffected()
+			rewritten += int(affected)
+		}
+		if err := tx.Commit(); err != nil {
+			return rewritten, err
+		}
+	}
+}
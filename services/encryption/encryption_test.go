@@ -0,0 +1,128 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newKey returns a random key, base64-encoded as configured
+func newKey() string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// sealLegacy seals value as enc:v1 did, for its column alone
+func sealLegacy(t *testing.T, k *Keyring, keyID string, column Column, value string) string {
+	t.Helper()
+	aead := k.aeads[keyID]
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(column.String()))
+	return legacyPrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed)
+}
+
+func TestSealBindsRow(t *testing.T) {
+	k, err := NewKeyring("k1", map[string]string{"k1": newKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := k.Seal(NoteBody, 1, "Chest clear")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := k.Open(NoteBody, 1, sealed); err != nil || got != "Chest clear" {
+		t.Fatalf("Open() = %q, %v; want the note", got, err)
+	}
+	if _, err := k.Open(NoteBody, 2, sealed); err == nil {
+		t.Error("a value copied to another row opened")
+	}
+	if _, err := k.Open(PatientMedicalHistory, 1, sealed); err == nil {
+		t.Error("a value copied to another column opened")
+	}
+
+	legacy := sealLegacy(t, k, "k1", NoteBody, "Chest clear")
+	if got, err := k.Open(NoteBody, 7, legacy); err != nil || got != "Chest clear" {
+		t.Errorf("Open() of an enc:v1 value = %q, %v; want the note", got, err)
+	}
+}
+
+func TestRewrapColumns(t *testing.T) {
+	old, current := newKey(), newKey()
+	k, err := NewKeyring("k2", map[string]string{"k1": old, "k2": current})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// Every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+
+	created := map[string]bool{}
+	for _, column := range Columns {
+		if created[column.Table] {
+			continue
+		}
+		created[column.Table] = true
+		var names string
+		for _, c := range Columns {
+			if c.Table == column.Table {
+				names += ", " + c.Name + " TEXT"
+			}
+		}
+		if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE %s (%s INTEGER PRIMARY KEY%s)`, column.Table, column.IDColumn, names)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v2, err := k.Seal(NoteBody, 3, "sealed for its row")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[int]string{
+		1: "plaintext",
+		2: sealLegacy(t, k, "k1", NoteBody, "sealed for its column"),
+		3: v2,
+	}
+	for id, value := range values {
+		if _, err := db.Exec(`INSERT INTO Notes (note_id, body) VALUES (?, ?)`, id, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := RewrapColumns(t.Context(), db, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("RewrapColumns() rewrote %d values, want 2", n)
+	}
+
+	want := map[int]string{1: "plaintext", 2: "sealed for its column", 3: "sealed for its row"}
+	for id, plaintext := range want {
+		var value string
+		if err := db.QueryRow(`SELECT body FROM Notes WHERE note_id = ?`, id).Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		if !k.isCurrent(value) {
+			t.Errorf("note %d is %q, not sealed for its row with the current key", id, value)
+		}
+		if got, err := k.Open(NoteBody, id, value); err != nil || got != plaintext {
+			t.Errorf("note %d opens to %q, %v; want %q", id, got, err, plaintext)
+		}
+	}
+
+	if n, err := RewrapColumns(t.Context(), db, k); err != nil || n != 0 {
+		t.Errorf("RewrapColumns() again = %d, %v; want nothing rewritten", n, err)
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx so events can be appended
+// in the same transaction as the state change they describe
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type EventService struct{}
+
+func NewEventService() *EventService {
+	return &EventService{}
+}
+
+// encryptedFields are the payload fields of each entity type's snapshot
+// that are encrypted at rest. The event log isn't, so Append leaves them out.
+var encryptedFields = map[string][]string{
+	models.ENTITY_PATIENT:        {"medicalHistory", "allergies"},
+	models.ENTITY_MEDICAL_RECORD: {"doctor_notes"},
+}
+
+// Append records a state change. The payload is stored as JSON and should be
+// the entity snapshot (or the changed fields) after the change, which is
+// recorded without its encryptedFields. The change is published on Changes
+// once exec, if it is a transaction, commits.
+func (s *EventService) Append(ctx context.Context, exec execer, entityType string, entityID int, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %v", err)
+	}
+	if fields := encryptedFields[entityType]; len(fields) > 0 {
+		if data, err = omitFields(data, fields); err != nil {
+			return fmt.Errorf("failed to marshal event payload: %v", err)
+		}
+	}
+
+	change := models.EntityChange{EntityType: entityType, EntityID: entityID, EventType: eventType, OccurredAt: time.Now().UTC()}
+	query := `INSERT INTO ClinicalEvents (entity_type, entity_id, event_type, payload, occurred_at)
+              VALUES (?, ?, ?, ?, ?)`
+	result, err := exec.ExecContext(ctx, query, entityType, entityID, eventType, string(data), change.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to append %s event: %v", eventType, err)
+	}
+	id, _ := result.LastInsertId()
+	change.EventID = int(id)
+
+	if tx, ok := exec.(*sql.Tx); ok {
+		database.AfterCommit(tx, func() { Changes.Publish(change) })
+	} else {
+		Changes.Publish(change)
+	}
+	return nil
+}
+
+// omitFields removes fields from data if it is a JSON object
+func omitFields(data []byte, fields []string) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return data, nil
+	}
+	for _, field := range fields {
+		delete(object, field)
+	}
+	return json.Marshal(object)
+}
+
+// GetEvents returns events in append order. Zero-valued filters are ignored;
+// afterID lets stream consumers resume from the last event they processed.
+func (s *EventService) GetEvents(ctx context.Context, entityType string, entityID int, afterID int, limit int) ([]models.ClinicalEvent, error) {
+	var conditions []string
+	var args []any
+
+	conditions = append(conditions, "event_id > ?")
+	args = append(args, afterID)
+	if entityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, entityType)
+	}
+	if entityID != 0 {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, entityID)
+	}
+
+	query := `SELECT event_id, entity_type, entity_id, event_type, payload, occurred_at
+              FROM ClinicalEvents WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY event_id`
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.ClinicalEvent{}
+	for rows.Next() {
+		var event models.ClinicalEvent
+		var payload string
+		err := rows.Scan(&event.EventID, &event.EntityType, &event.EntityID, &event.EventType, &payload, &event.OccurredAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// ExportAll emits every clinical event, oldest first, for a bulk export
+func (s *EventService) ExportAll(ctx context.Context, emit func(row any) error) error {
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT event_id, entity_type, entity_id, event_type, payload, occurred_at
+              FROM ClinicalEvents ORDER BY event_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.ClinicalEvent
+		var payload string
+		if err := rows.Scan(&event.EventID, &event.EntityType, &event.EntityID, &event.EventType, &payload, &event.OccurredAt); err != nil {
+			return err
+		}
+		event.Payload = json.RawMessage(payload)
+		if err := emit(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Project rebuilds a single entity's state from its events
+func (s *EventService) Project(ctx context.Context, entityType string, entityID int) (*models.EntityProjection, error) {
+	events, err := s.GetEvents(ctx, entityType, entityID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	projection := &models.EntityProjection{
+		EntityType: entityType,
+		EntityID:   entityID,
+		State:      map[string]any{},
+	}
+	for _, event := range events {
+		if err := applyEvent(projection, event); err != nil {
+			return nil, err
+		}
+	}
+
+	return projection, nil
+}
+
+// Replay rebuilds every entity of a type by replaying the full event log in order
+func (s *EventService) Replay(ctx context.Context, entityType string) ([]*models.EntityProjection, error) {
+	events, err := s.GetEvents(ctx, entityType, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	projections := map[int]*models.EntityProjection{}
+	var order []int
+	for _, event := range events {
+		projection, exists := projections[event.EntityID]
+		if !exists {
+			projection = &models.EntityProjection{
+				EntityType: event.EntityType,
+				EntityID:   event.EntityID,
+				State:      map[string]any{},
+			}
+			projections[event.EntityID] = projection
+			order = append(order, event.EntityID)
+		}
+
+		if err := applyEvent(projection, event); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*models.EntityProjection, 0, len(order))
+	for _, id := range order {
+		result = append(result, projections[id])
+	}
+	return result, nil
+}
+
+// applyEvent folds an event's payload into the projection
+func applyEvent(projection *models.EntityProjection, event models.ClinicalEvent) error {
+	var fields map[string]any
+	if err := json.Unmarshal(event.Payload, &fields); err != nil {
+		return fmt.Errorf("failed to parse payload of event %d: %v", event.EventID, err)
+	}
+
+	for key, value := range fields {
+		projection.State[key] = value
+	}
+
+	projection.Version++
+	projection.LastEventType = event.EventType
+	projection.Deleted = strings.HasSuffix(event.EventType, "_deleted")
+	return nil
+}
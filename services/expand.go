@@ -0,0 +1,64 @@
+package services
+
+import (
+	"database/sql"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// expandJoins returns the columns and LEFT JOINs that add the summaries
+// expand asks for to a listing query, given the listing's patient and
+// doctor key columns. Scan the columns with expandTargets.
+func expandJoins(expand models.Expand, patientColumn, doctorColumn string) (columns, joins string) {
+	if expand.Patient {
+		columns += `, xp.patient_id, xp.first_name, xp.last_name, xp.date_of_birth`
+		joins += ` LEFT JOIN Patients xp ON xp.patient_id = ` + patientColumn
+	}
+	if expand.Doctor {
+		columns += `, xd.user_id, xd.full_name, xd.role`
+		joins += ` LEFT JOIN Users xd ON xd.user_id = ` + doctorColumn
+	}
+	return columns, joins
+}
+
+// expandedRow receives the columns of expandJoins from a scanned row
+type expandedRow struct {
+	expand models.Expand
+
+	patientID                        sql.NullInt64
+	firstName, lastName, dateOfBirth sql.NullString
+	doctorID                         sql.NullInt64
+	doctorName, doctorRole           sql.NullString
+}
+
+// targets returns the Scan destinations of the expandJoins columns, to
+// append to those of the listing's own columns
+func (e *expandedRow) targets() []any {
+	var targets []any
+	if e.expand.Patient {
+		targets = append(targets, &e.patientID, &e.firstName, &e.lastName, &e.dateOfBirth)
+	}
+	if e.expand.Doctor {
+		targets = append(targets, &e.doctorID, &e.doctorName, &e.doctorRole)
+	}
+	return targets
+}
+
+// patient returns the scanned patient summary, nil when it wasn't asked
+// for or the patient is gone
+func (e *expandedRow) patient() *models.PatientRef {
+	if !e.patientID.Valid {
+		return nil
+	}
+	return &models.PatientRef{ID: int(e.patientID.Int64), FirstName: e.firstName.String, LastName: e.lastName.String,
+		DateOfBirth: e.dateOfBirth.String}
+}
+
+// doctor returns the scanned staff summary, nil when it wasn't asked for
+// or the account is gone
+func (e *expandedRow) doctor() *models.StaffRef {
+	if !e.doctorID.Valid {
+		return nil
+	}
+	return &models.StaffRef{ID: int(e.doctorID.Int64), FullName: e.doctorName.String, Role: e.doctorRole.String}
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	ErrUnknownExport = errors.New("unknown export kind")
+	ErrExportRunning = errors.New("export is still running")
+)
+
+// ExportSource emits the rows of one kind of export, in a stable order
+type ExportSource func(ctx context.Context, emit func(row any) error) error
+
+// ExportService writes bulk exports too large for one response as numbered
+// NDJSON chunk files under dir, each of at most chunkRows rows, recorded in
+// a manifest. A dropped connection then costs at most the rest of one chunk,
+// which can be resumed with a Range request. Subsystems register the kinds
+// of export they can produce when they are wired up in main.
+type ExportService struct {
+	dir       string
+	chunkRows int
+	audit     *AuditService
+
+	mu      sync.Mutex
+	sources map[string]ExportSource
+}
+
+func NewExportService(dir string, chunkRows int) (*ExportService, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &ExportService{
+		dir:       dir,
+		chunkRows: chunkRows,
+		audit:     NewAuditService(),
+		sources:   map[string]ExportSource{},
+	}, nil
+}
+
+// Register adds a kind of export
+func (s *ExportService) Register(kind string, source ExportSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources[kind] = source
+}
+
+// FailInterrupted marks exports left running by a previous process as
+// failed; their chunk files are kept until the export is deleted
+func (s *ExportService) FailInterrupted(ctx context.Context) error {
+	_, err := database.GetDB().ExecContext(ctx, `UPDATE Exports SET status = ?, error = ?, completed_at = ? WHERE status = ?`,
+		models.EXPORT_STATUS_FAILED, "interrupted by a server restart", time.Now(), models.EXPORT_STATUS_RUNNING)
+	return err
+}
+
+// Start records an export of kind and writes it in the background
+func (s *ExportService) Start(ctx context.Context, kind string, userID int) (*models.Export, error) {
+	s.mu.Lock()
+	source, ok := s.sources[kind]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownExport
+	}
+
+	var exportID int
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `INSERT INTO Exports (kind, status, requested_by, created_at) VALUES (?, ?, ?, ?)`,
+			kind, models.EXPORT_STATUS_RUNNING, userID, time.Now())
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		exportID = int(id)
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_EXPORT_STARTED, models.ENTITY_EXPORT, exportID, map[string]any{"kind": kind})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go s.run(exportID, source)
+	return s.GetExport(database.WithPrimaryReads(ctx), exportID)
+}
+
+// run writes the export's chunks and records its outcome. It isn't bound to
+// the request that started it.
+func (s *ExportService) run(exportID int, source ExportSource) {
+	ctx := context.Background()
+	status, message := models.EXPORT_STATUS_COMPLETED, ""
+	if err := s.write(ctx, exportID, source); err != nil {
+		slog.Error("Export failed", "export", exportID, "error", err)
+		status, message = models.EXPORT_STATUS_FAILED, err.Error()
+	}
+
+	_, err := database.GetDB().ExecContext(ctx, `UPDATE Exports SET status = ?, error = NULLIF(?, ''), completed_at = ? WHERE export_id = ?`,
+		status, message, time.Now(), exportID)
+	if err != nil {
+		slog.Error("Failed to record export outcome", "export", exportID, "error", err)
+	}
+}
+
+func (s *ExportService) write(ctx context.Context, exportID int, source ExportSource) error {
+	dir := s.exportDir(exportID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	var chunk *chunkWriter
+	index := 0
+	finish := func() error {
+		if chunk == nil {
+			return nil
+		}
+		done := chunk
+		chunk = nil
+		return s.closeChunk(ctx, exportID, done)
+	}
+
+	err := source(ctx, func(row any) error {
+		if chunk == nil {
+			index++
+			var err error
+			if chunk, err = newChunkWriter(s.chunkPath(exportID, index), index); err != nil {
+				return err
+			}
+		}
+		if err := chunk.write(row); err != nil {
+			return err
+		}
+		if chunk.rows >= s.chunkRows {
+			return finish()
+		}
+		return nil
+	})
+	if err != nil {
+		if chunk != nil {
+			chunk.abort()
+		}
+		return err
+	}
+	return finish()
+}
+
+// closeChunk moves a complete chunk into place and lists it in the manifest
+func (s *ExportService) closeChunk(ctx context.Context, exportID int, chunk *chunkWriter) error {
+	if err := chunk.close(); err != nil {
+		return err
+	}
+	_, err := database.GetDB().ExecContext(ctx, `INSERT INTO ExportChunks (export_id, chunk_index, rows, bytes, sha256) VALUES (?, ?, ?, ?, ?)`,
+		exportID, chunk.index, chunk.rows, chunk.bytes, hex.EncodeToString(chunk.hash.Sum(nil)))
+	return err
+}
+
+// GetExports lists exports, newest first, without their chunks
+func (s *ExportService) GetExports(ctx context.Context) ([]models.Export, error) {
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT e.export_id, e.kind, e.status, COALESCE(e.error, ''), e.requested_by,
+              e.created_at, e.completed_at, COALESCE(SUM(c.rows), 0), COALESCE(SUM(c.bytes), 0)
+              FROM Exports e LEFT JOIN ExportChunks c ON c.export_id = e.export_id
+              GROUP BY e.export_id ORDER BY e.export_id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []models.Export{}
+	for rows.Next() {
+		var export models.Export
+		if err := rows.Scan(&export.ExportID, &export.Kind, &export.Status, &export.Error, &export.RequestedBy,
+			&export.CreatedAt, &export.CompletedAt, &export.TotalRows, &export.TotalBytes); err != nil {
+			return nil, err
+		}
+		export.Chunks = []models.ExportChunk{}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+// GetExport returns an export's manifest
+func (s *ExportService) GetExport(ctx context.Context, exportID int) (*models.Export, error) {
+	db := database.ReadDB(ctx)
+	var export models.Export
+	err := db.QueryRowContext(ctx, `SELECT export_id, kind, status, COALESCE(error, ''), requested_by, created_at, completed_at
+              FROM Exports WHERE export_id = ?`, exportID).Scan(&export.ExportID, &export.Kind, &export.Status, &export.Error,
+		&export.RequestedBy, &export.CreatedAt, &export.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT chunk_index, rows, bytes, sha256 FROM ExportChunks WHERE export_id = ? ORDER BY chunk_index`, exportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	export.Chunks = []models.ExportChunk{}
+	for rows.Next() {
+		var chunk models.ExportChunk
+		if err := rows.Scan(&chunk.Index, &chunk.Rows, &chunk.Bytes, &chunk.SHA256); err != nil {
+			return nil, err
+		}
+		chunk.URL = fmt.Sprintf("/api/admin/exports/%d/chunks/%d", exportID, chunk.Index)
+		export.TotalRows += chunk.Rows
+		export.TotalBytes += chunk.Bytes
+		export.Chunks = append(export.Chunks, chunk)
+	}
+	return &export, rows.Err()
+}
+
+// OpenChunk opens a written chunk for serving. The caller closes the file.
+// A download is audit-logged when it starts, not on each resumed range.
+func (s *ExportService) OpenChunk(ctx context.Context, exportID, index, userID int, resumed bool) (*os.File, *models.ExportChunk, error) {
+	var chunk models.ExportChunk
+	var kind string
+	err := database.ReadDB(ctx).QueryRowContext(ctx, `SELECT c.chunk_index, c.rows, c.bytes, c.sha256, e.kind
+              FROM ExportChunks c JOIN Exports e ON e.export_id = c.export_id
+              WHERE c.export_id = ? AND c.chunk_index = ?`, exportID, index).Scan(&chunk.Index, &chunk.Rows, &chunk.Bytes, &chunk.SHA256, &kind)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(s.chunkPath(exportID, index))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !resumed {
+		details := map[string]any{"exportId": exportID, "chunk": index, "bytes": chunk.Bytes}
+		if err := s.audit.Log(ctx, database.GetDB(), userID, models.AUDIT_DOWNLOAD_PREFIX+"export:"+kind, models.ENTITY_EXPORT, exportID, details); err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+	}
+	return file, &chunk, nil
+}
+
+// DeleteExport removes a finished export and its files
+func (s *ExportService) DeleteExport(ctx context.Context, exportID, userID int) error {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		if err := tx.QueryRowContext(ctx, `SELECT status FROM Exports WHERE export_id = ?`, exportID).Scan(&status); err != nil {
+			return err
+		}
+		if status == models.EXPORT_STATUS_RUNNING {
+			return ErrExportRunning
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM ExportChunks WHERE export_id = ?`, exportID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM Exports WHERE export_id = ?`, exportID); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_EXPORT_DELETED, models.ENTITY_EXPORT, exportID, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.exportDir(exportID))
+}
+
+// ChunkFilename is the download name of an export chunk
+func ChunkFilename(kind string, exportID, index int) string {
+	return fmt.Sprintf("%s-%d-%06d.ndjson", kind, exportID, index)
+}
+
+func (s *ExportService) exportDir(exportID int) string {
+	return filepath.Join(s.dir, strconv.Itoa(exportID))
+}
+
+func (s *ExportService) chunkPath(exportID, index int) string {
+	return filepath.Join(s.exportDir(exportID), fmt.Sprintf("%06d.ndjson", index))
+}
+
+// chunkWriter writes one chunk to a temporary file, hashing it as it goes
+type chunkWriter struct {
+	path  string
+	file  *os.File
+	buf   *bufio.Writer
+	hash  hash.Hash
+	index int
+	rows  int
+	bytes int64
+}
+
+func newChunkWriter(path string, index int) (*chunkWriter, error) {
+	file, err := os.OpenFile(path+".part", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	chunk := &chunkWriter{path: path, file: file, hash: sha256.New(), index: index}
+	chunk.buf = bufio.NewWriter(io.MultiWriter(file, chunk.hash))
+	return chunk, nil
+}
+
+func (c *chunkWriter) write(row any) error {
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := c.buf.Write(line); err != nil {
+		return err
+	}
+	c.rows++
+	c.bytes += int64(len(line))
+	return nil
+}
+
+// close flushes the chunk to disk and renames it into place
+func (c *chunkWriter) close() error {
+	if err := c.buf.Flush(); err != nil {
+		c.abort()
+		return err
+	}
+	if err := c.file.Sync(); err != nil {
+		c.abort()
+		return err
+	}
+	if err := c.file.Close(); err != nil {
+		os.Remove(c.file.Name())
+		return err
+	}
+	return os.Rename(c.path+".part", c.path)
+}
+
+func (c *chunkWriter) abort() {
+	c.file.Close()
+	os.Remove(c.file.Name())
+}
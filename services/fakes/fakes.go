@@ -0,0 +1,481 @@
+// Package fakes provides in-memory implementations of the service
+// repositories for tests, e.g.
+//
+//	patients := services.NewPatientService(fakes.NewPatientRepo())
+//
+// They keep rows in maps guarded by a mutex, assign sequential IDs and
+// return sql.ErrNoRows for missing rows like the SQLite repositories. They
+// don't record clinical events or audit entries.
+package fakes
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+)
+
+var (
+	_ services.PatientRepo       = (*PatientRepo)(nil)
+	_ services.UserRepo          = (*UserRepo)(nil)
+	_ services.MedicalRecordRepo = (*MedicalRecordRepo)(nil)
+	_ services.PrescriptionRepo  = (*PrescriptionRepo)(nil)
+)
+
+// ErrDuplicateUsername mirrors the UNIQUE constraint on Users.username
+var ErrDuplicateUsername = errors.New("UNIQUE constraint failed: Users.username")
+
+// table is an ID-keyed set of rows returned in ID order
+type table[T any] struct {
+	mu     sync.Mutex
+	rows   map[int]T
+	nextID int
+}
+
+func newTable[T any]() table[T] {
+	return table[T]{rows: map[int]T{}, nextID: 1}
+}
+
+// insert stores row under a new ID and returns it
+func (t *table[T]) insert(row func(id int) T) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := t.nextID
+	t.nextID++
+	t.rows[id] = row(id)
+	return id
+}
+
+func (t *table[T]) get(id int) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	row, ok := t.rows[id]
+	if !ok {
+		return row, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (t *table[T]) put(id int, row T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.rows[id]; !ok {
+		return sql.ErrNoRows
+	}
+	t.rows[id] = row
+	return nil
+}
+
+func (t *table[T]) delete(id int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.rows[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(t.rows, id)
+	return nil
+}
+
+// list returns the rows matching keep, in ID order
+func (t *table[T]) list(keep func(T) bool) []T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ids := make([]int, 0, len(t.rows))
+	for id := range t.rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var rows []T
+	for _, id := range ids {
+		if keep == nil || keep(t.rows[id]) {
+			rows = append(rows, t.rows[id])
+		}
+	}
+	return rows
+}
+
+// PatientRepo is an in-memory services.PatientRepo
+type PatientRepo struct {
+	patients table[models.Patient]
+}
+
+func NewPatientRepo() *PatientRepo {
+	return &PatientRepo{patients: newTable[models.Patient]()}
+}
+
+func (r *PatientRepo) Create(ctx context.Context, patient *models.Patient) error {
+	patient.PatientID = r.patients.insert(func(id int) models.Patient {
+		row := *patient
+		row.PatientID = id
+		return row
+	})
+	return nil
+}
+
+func (r *PatientRepo) Get(ctx context.Context, id int) (*models.Patient, error) {
+	patient, err := r.patients.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+func (r *PatientRepo) List(ctx context.Context) ([]models.Patient, error) {
+	return r.patients.list(nil), nil
+}
+
+func (r *PatientRepo) Each(ctx context.Context, fn func(patient models.Patient) error) error {
+	for _, patient := range r.patients.list(nil) {
+		if err := fn(patient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PatientRepo) Update(ctx context.Context, id int, patient *models.Patient, changedBy int) error {
+	row := *patient
+	row.PatientID = id
+	return r.patients.put(id, row)
+}
+
+func (r *PatientRepo) Delete(ctx context.Context, id int) error {
+	return r.patients.delete(id)
+}
+
+// Changes lists nothing: the fake keeps no change history
+func (r *PatientRepo) Changes(ctx context.Context, patientID int) ([]models.PatientChange, error) {
+	return []models.PatientChange{}, nil
+}
+
+// UserRepo is an in-memory services.UserRepo
+type UserRepo struct {
+	users table[models.User]
+}
+
+func NewUserRepo() *UserRepo {
+	return &UserRepo{users: newTable[models.User]()}
+}
+
+func (r *UserRepo) Create(ctx context.Context, user *models.User) error {
+	if _, err := r.GetByUsername(ctx, user.Username); err == nil {
+		return ErrDuplicateUsername
+	}
+
+	user.Active = true
+	user.UserID = r.users.insert(func(id int) models.User {
+		row := *user
+		row.UserID = id
+		return row
+	})
+	return nil
+}
+
+func (r *UserRepo) Get(ctx context.Context, id int) (*models.User, error) {
+	user, err := r.users.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	matches := r.users.list(func(user models.User) bool { return user.Username == username })
+	if len(matches) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &matches[0], nil
+}
+
+func (r *UserRepo) List(ctx context.Context) ([]*models.User, error) {
+	var users []*models.User
+	for _, user := range r.users.list(nil) {
+		users = append(users, &user)
+	}
+	return users, nil
+}
+
+func (r *UserRepo) Search(ctx context.Context, filter services.UserFilter) ([]*models.User, int, error) {
+	query := strings.ToLower(filter.Query)
+	matching := r.users.list(func(user models.User) bool {
+		return (filter.Role == "" || user.Role == filter.Role) &&
+			(strings.Contains(strings.ToLower(user.Username), query) || strings.Contains(strings.ToLower(user.FullName), query)) &&
+			(filter.Active == nil || user.Active == *filter.Active)
+	})
+
+	page := matching[min(filter.Offset, len(matching)):]
+	if filter.Limit > 0 {
+		page = page[:min(filter.Limit, len(page))]
+	}
+	users := []*models.User{}
+	for _, user := range page {
+		users = append(users, &user)
+	}
+	return users, len(matching), nil
+}
+
+func (r *UserRepo) SetActive(ctx context.Context, id int, active bool) error {
+	user, err := r.users.get(id)
+	if err != nil {
+		return err
+	}
+	user.Active = active
+	return r.users.put(id, user)
+}
+
+func (r *UserRepo) UpdateRole(ctx context.Context, id int, role string) error {
+	user, err := r.users.get(id)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	return r.users.put(id, user)
+}
+
+func (r *UserRepo) SetPasswordHash(ctx context.Context, id int, hash string) error {
+	user, err := r.users.get(id)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	return r.users.put(id, user)
+}
+
+func (r *UserRepo) UpdateProfile(ctx context.Context, id int, profile *models.ProfileUpdate) error {
+	user, err := r.users.get(id)
+	if err != nil {
+		return err
+	}
+	user.FullName = profile.FullName
+	user.Notifications = profile.Notifications
+	return r.users.put(id, user)
+}
+
+// MedicalRecordRepo is an in-memory services.MedicalRecordRepo
+type MedicalRecordRepo struct {
+	records table[models.MedicalRecord]
+}
+
+func NewMedicalRecordRepo() *MedicalRecordRepo {
+	return &MedicalRecordRepo{records: newTable[models.MedicalRecord]()}
+}
+
+func (r *MedicalRecordRepo) Create(ctx context.Context, record *models.MedicalRecord) error {
+	record.RecordID = r.records.insert(func(id int) models.MedicalRecord {
+		row := *record
+		row.RecordID = id
+		return row
+	})
+	return nil
+}
+
+func (r *MedicalRecordRepo) Get(ctx context.Context, id int) (*models.MedicalRecord, error) {
+	record, err := r.records.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *MedicalRecordRepo) List(ctx context.Context) ([]models.MedicalRecord, error) {
+	return r.records.list(nil), nil
+}
+
+func (r *MedicalRecordRepo) ListByPatient(ctx context.Context, patientID int) ([]models.MedicalRecord, error) {
+	return r.records.list(func(record models.MedicalRecord) bool { return record.PatientID == patientID }), nil
+}
+
+func (r *MedicalRecordRepo) GetNurseView(ctx context.Context, id int) (*models.MedicalRecordNurseView, error) {
+	record, err := r.records.get(id)
+	if err != nil {
+		return nil, err
+	}
+	view := nurseView(record)
+	return &view, nil
+}
+
+// ListNurseView ignores filter.ExpandPatient: the fake has no patients to join
+func (r *MedicalRecordRepo) ListNurseView(ctx context.Context, filter services.MedicalRecordFilter) ([]models.MedicalRecordNurseView, error) {
+	if filter.DoctorIDs == nil {
+		return nurseViews(r.records.list(nil)), nil
+	}
+	return nurseViews(r.records.list(func(record models.MedicalRecord) bool {
+		return slices.Contains(filter.DoctorIDs, record.DoctorID)
+	})), nil
+}
+
+func (r *MedicalRecordRepo) ListNurseViewByPatient(ctx context.Context, patientID int) ([]models.MedicalRecordNurseView, error) {
+	records, _ := r.ListByPatient(ctx, patientID)
+	return nurseViews(records), nil
+}
+
+// nurseView drops the fields nurse_medical_records_view leaves out
+func nurseView(record models.MedicalRecord) models.MedicalRecordNurseView {
+	return models.MedicalRecordNurseView{
+		RecordID:  record.RecordID,
+		PatientID: record.PatientID,
+		VisitDate: record.VisitDate,
+		Diagnosis: record.Diagnosis,
+	}
+}
+
+func nurseViews(records []models.MedicalRecord) []models.MedicalRecordNurseView {
+	var views []models.MedicalRecordNurseView
+	for _, record := range records {
+		views = append(views, nurseView(record))
+	}
+	return views
+}
+
+// PrescriptionRepo is an in-memory services.PrescriptionRepo. Overrides are
+// kept in Overrides so tests can assert on them.
+type PrescriptionRepo struct {
+	prescriptions table[models.Prescription]
+
+	mu        sync.Mutex
+	Overrides []Override
+}
+
+// Override is a prescription created despite safety warnings
+type Override struct {
+	PrescriptionID int
+	UserID         int
+	Reason         string
+	Warnings       []models.PrescriptionWarning
+}
+
+func NewPrescriptionRepo() *PrescriptionRepo {
+	return &PrescriptionRepo{prescriptions: newTable[models.Prescription]()}
+}
+
+func (r *PrescriptionRepo) Create(ctx context.Context, prescription *models.Prescription) error {
+	prescription.PrescriptionID = r.prescriptions.insert(func(id int) models.Prescription {
+		row := *prescription
+		row.PrescriptionID = id
+		row.Status = models.PRESCRIPTION_STATUS_UNSIGNED
+		return row
+	})
+	prescription.Status = models.PRESCRIPTION_STATUS_UNSIGNED
+	return nil
+}
+
+func (r *PrescriptionRepo) CreateOverridden(ctx context.Context, prescription *models.Prescription, userID int, warnings []models.PrescriptionWarning) error {
+	if err := r.Create(ctx, prescription); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Overrides = append(r.Overrides, Override{
+		PrescriptionID: prescription.PrescriptionID,
+		UserID:         userID,
+		Reason:         prescription.OverrideReason,
+		Warnings:       warnings,
+	})
+	return nil
+}
+
+func (r *PrescriptionRepo) Get(ctx context.Context, id int) (*models.Prescription, error) {
+	prescription, err := r.prescriptions.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+// List ignores filter.Expand: the fake has no patients or users to join
+func (r *PrescriptionRepo) List(ctx context.Context, filter services.PrescriptionFilter) ([]*models.Prescription, int, error) {
+	matching := r.prescriptions.list(func(prescription models.Prescription) bool {
+		status := prescription.Status
+		if status == "" {
+			status = models.PRESCRIPTION_STATUS_ACTIVE
+		}
+		return (filter.PatientID == 0 || prescription.PatientID == filter.PatientID) &&
+			(filter.DoctorID == 0 || prescription.DoctorID == filter.DoctorID) &&
+			strings.Contains(strings.ToLower(prescription.Medication), strings.ToLower(filter.Medication)) &&
+			(filter.Status == "" || status == filter.Status) &&
+			(filter.From == "" || prescription.PrescribedDate >= filter.From) &&
+			(filter.To == "" || prescription.PrescribedDate <= filter.To)
+	})
+
+	// list returns ID order, so a stable sort breaks ties by ID
+	key := func(prescription models.Prescription) string {
+		switch filter.Sort {
+		case models.PRESCRIPTION_SORT_PRESCRIBED_DATE:
+			return prescription.PrescribedDate
+		case models.PRESCRIPTION_SORT_MEDICATION:
+			return strings.ToLower(prescription.Medication)
+		}
+		return ""
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return key(matching[i]) < key(matching[j]) })
+	if filter.Descending {
+		slices.Reverse(matching)
+	}
+
+	page := matching[min(filter.Offset, len(matching)):]
+	if filter.Limit > 0 {
+		page = page[:min(filter.Limit, len(page))]
+	}
+	prescriptions := []*models.Prescription{}
+	for _, prescription := range page {
+		prescriptions = append(prescriptions, &prescription)
+	}
+	return prescriptions, len(matching), nil
+}
+
+func (r *PrescriptionRepo) ListByPatient(ctx context.Context, patientID int) ([]models.Prescription, error) {
+	return r.prescriptions.list(func(prescription models.Prescription) bool { return prescription.PatientID == patientID }), nil
+}
+
+func (r *PrescriptionRepo) Sign(ctx context.Context, id, userID int) (*models.Prescription, error) {
+	prescription, err := r.prescriptions.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if prescription.Status != models.PRESCRIPTION_STATUS_UNSIGNED {
+		return nil, services.ErrPrescriptionSigned
+	}
+	if prescription.DoctorID != userID {
+		return nil, services.ErrPrescriptionSigner
+	}
+	now := time.Now()
+	prescription.Status = models.PRESCRIPTION_STATUS_ACTIVE
+	prescription.SignedBy, prescription.SignedAt = &userID, &now
+	prescription.SignatureHash = prescription.ContentHash()
+	if err := r.prescriptions.put(id, prescription); err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
+
+func (r *PrescriptionRepo) MarkReady(ctx context.Context, id, userID int) (*models.Prescription, error) {
+	prescription, err := r.prescriptions.get(id)
+	if err != nil {
+		return nil, err
+	}
+	switch prescription.Status {
+	case models.PRESCRIPTION_STATUS_UNSIGNED:
+		return nil, services.ErrPrescriptionUnsigned
+	case models.PRESCRIPTION_STATUS_READY:
+		return nil, services.ErrPrescriptionReady
+	}
+	prescription.Status = models.PRESCRIPTION_STATUS_READY
+	if err := r.prescriptions.put(id, prescription); err != nil {
+		return nil, err
+	}
+	return &prescription, nil
+}
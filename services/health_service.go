@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// HealthService checks whether the server's dependencies are usable, for
+// orchestrators deciding whether to send it traffic
+type HealthService struct {
+	timeout      time.Duration
+	minFreeBytes uint64
+}
+
+// NewHealthService fails a check that takes longer than timeout, and the
+// disk check once the SQLite file's filesystem has less than minFreeBytes
+// free
+func NewHealthService(timeout time.Duration, minFreeBytes uint64) *HealthService {
+	return &HealthService{timeout: timeout, minFreeBytes: minFreeBytes}
+}
+
+// Ready runs every check, timing each one; the report is ok only when they
+// all pass
+func (s *HealthService) Ready(ctx context.Context) *models.HealthReport {
+	report := &models.HealthReport{Status: models.HEALTH_STATUS_OK, CheckedAt: time.Now(), Checks: []models.HealthCheck{}}
+	for _, check := range s.checks() {
+		checkCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		started := time.Now()
+		details, err := check.run(checkCtx)
+		cancel()
+
+		result := models.HealthCheck{Name: check.name, Status: models.HEALTH_STATUS_OK,
+			LatencyMs: milliseconds(time.Since(started)), Details: details}
+		if err != nil {
+			result.Status = models.HEALTH_STATUS_FAILED
+			result.Error = err.Error()
+			report.Status = models.HEALTH_STATUS_FAILED
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// healthCheck probes one dependency, returning details worth reporting
+// even when it fails
+type healthCheck struct {
+	name string
+	run  func(ctx context.Context) (map[string]any, error)
+}
+
+// checks are the database, its replica when one serves reads, and the disk
+// when it is a SQLite file
+func (s *HealthService) checks() []healthCheck {
+	checks := []healthCheck{{"database", s.checkDatabase}}
+	if database.Replica() != nil {
+		checks = append(checks, healthCheck{"replica", s.checkReplica})
+	}
+	if path := database.PoolOptions().Path; database.CurrentDialect().Name() == database.SQLite && path != database.MemoryPath {
+		checks = append(checks, healthCheck{"disk", func(ctx context.Context) (map[string]any, error) {
+			return s.checkDisk(path)
+		}})
+	}
+	return checks
+}
+
+// checkDatabase pings the primary database and runs a trivial query, which
+// catches a pool that connects but can't serve statements
+func (s *HealthService) checkDatabase(ctx context.Context) (map[string]any, error) {
+	return checkPool(ctx, database.GetDB())
+}
+
+// checkReplica checks the read-only pool like the primary; reports and
+// lists fail while it is down
+func (s *HealthService) checkReplica(ctx context.Context) (map[string]any, error) {
+	return checkPool(ctx, database.Replica())
+}
+
+func checkPool(ctx context.Context, db *sql.DB) (map[string]any, error) {
+	if err := db.PingContext(ctx); err != nil {
+		return nil, err
+	}
+	var one int
+	if err := db.QueryRowContext(ctx, `SELECT 1`).Scan(&one); err != nil {
+		return nil, err
+	}
+
+	stats := db.Stats()
+	return map[string]any{"dialect": database.CurrentDialect().Name(), "openConnections": stats.OpenConnections,
+		"inUse": stats.InUse}, nil
+}
+
+// checkDisk fails when the filesystem holding the SQLite file is nearly
+// full, before writes start failing with "database or disk is full"
+func (s *HealthService) checkDisk(path string) (map[string]any, error) {
+	free, err := freeDiskSpace(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]any{"freeBytes": free, "minFreeBytes": s.minFreeBytes}
+	if free < s.minFreeBytes {
+		return details, fmt.Errorf("only %d bytes free, below the minimum of %d", free, s.minFreeBytes)
+	}
+	return details, nil
+}
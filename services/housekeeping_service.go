@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// ErrHousekeepingTaskState is returned when starting a task that isn't
+// pending or completing one that is already completed
+var ErrHousekeepingTaskState = errors.New("housekeeping task is not in a state that allows this")
+
+// HousekeepingService tracks the cleaning of vacated beds. Tasks are opened
+// by AdmissionService when a patient leaves a bed.
+type HousekeepingService struct{}
+
+func NewHousekeepingService() *HousekeepingService {
+	return &HousekeepingService{}
+}
+
+// openHousekeepingTask queues a vacated bed for cleaning, inside the
+// transaction that vacated it
+func openHousekeepingTask(ctx context.Context, tx *sql.Tx, bedID, admissionID int, reason string, vacatedAt time.Time) error {
+	query := `INSERT INTO HousekeepingTasks (bed_id, admission_id, reason, status, vacated_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, query, bedID, admissionID, reason, models.HOUSEKEEPING_STATUS_PENDING, vacatedAt)
+	return err
+}
+
+// GetTasks lists tasks, oldest vacated first. An empty status lists the
+// outstanding (pending and in-progress) tasks; wardID 0 means every ward.
+func (s *HousekeepingService) GetTasks(ctx context.Context, status string, wardID int) ([]models.HousekeepingTask, error) {
+	clause := `WHERE t.status <> 'completed'`
+	args := []any{}
+	if status != "" {
+		clause = `WHERE t.status = ?`
+		args = append(args, status)
+	}
+	if wardID != 0 {
+		clause += ` AND b.ward_id = ?`
+		args = append(args, wardID)
+	}
+	order := ` ORDER BY t.vacated_at`
+	if status == models.HOUSEKEEPING_STATUS_COMPLETED {
+		order = ` ORDER BY t.completed_at DESC LIMIT 200`
+	}
+	return queryHousekeepingTasks(ctx, database.ReadDB(ctx), clause+order, args...)
+}
+
+func (s *HousekeepingService) GetTask(ctx context.Context, id int) (*models.HousekeepingTask, error) {
+	tasks, err := queryHousekeepingTasks(ctx, database.ReadDB(ctx), `WHERE t.task_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &tasks[0], nil
+}
+
+// StartCleaning marks a pending task as in progress
+func (s *HousekeepingService) StartCleaning(ctx context.Context, id, userID int) (*models.HousekeepingTask, error) {
+	query := `UPDATE HousekeepingTasks SET status = ?, started_at = ?, started_by = ? WHERE task_id = ? AND status = ?`
+	err := s.transition(ctx, id, query, models.HOUSEKEEPING_STATUS_IN_PROGRESS, time.Now(), userID, id, models.HOUSEKEEPING_STATUS_PENDING)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTask(database.WithPrimaryReads(ctx), id)
+}
+
+// CompleteCleaning marks a task completed, making the bed assignable again.
+// A pending task can be completed directly; its start is recorded as now.
+func (s *HousekeepingService) CompleteCleaning(ctx context.Context, id, userID int, notes string) (*models.HousekeepingTask, error) {
+	now := time.Now()
+	query := `UPDATE HousekeepingTasks
+              SET status = ?, completed_at = ?, completed_by = ?, notes = ?,
+                  started_at = COALESCE(started_at, ?), started_by = COALESCE(started_by, ?)
+              WHERE task_id = ? AND status <> ?`
+	err := s.transition(ctx, id, query, models.HOUSEKEEPING_STATUS_COMPLETED, now, userID, notes, now, userID, id,
+		models.HOUSEKEEPING_STATUS_COMPLETED)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetTask(database.WithPrimaryReads(ctx), id)
+}
+
+// transition runs a guarded status update, telling an unknown task
+// (sql.ErrNoRows) apart from one in the wrong state
+func (s *HousekeepingService) transition(ctx context.Context, id int, query string, args ...any) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			return nil
+		}
+
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM HousekeepingTasks WHERE task_id = ?`, id).Scan(&exists); err != nil {
+			return err
+		}
+		return ErrHousekeepingTaskState
+	})
+}
+
+// GetTurnover reports per-ward turnover for cleanings completed in [from, to).
+// Pending counts the ward's outstanding tasks now.
+func (s *HousekeepingService) GetTurnover(ctx context.Context, from, to time.Time) (*models.TurnoverReport, error) {
+	db := database.ReadDB(ctx)
+	rows, err := db.QueryContext(ctx, `SELECT ward_id, name FROM Wards ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.TurnoverReport{From: from, To: to, Wards: []models.WardTurnover{}, GeneratedAt: time.Now()}
+	index := map[int]int{}
+	for rows.Next() {
+		var ward models.WardTurnover
+		if err := rows.Scan(&ward.WardID, &ward.WardName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[ward.WardID] = len(report.Wards)
+		report.Wards = append(report.Wards, ward)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	completed, err := queryHousekeepingTasks(ctx, db, `WHERE t.status = 'completed' AND t.completed_at >= ? AND t.completed_at < ?`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	// Summed in Go: SQLite has no duration type and the timestamps carry zone offsets
+	for _, task := range completed {
+		ward := &report.Wards[index[task.WardID]]
+		turnover := task.CompletedAt.Sub(task.VacatedAt).Minutes()
+		ward.Completed++
+		ward.AvgTurnoverMinutes += turnover
+		ward.AvgWaitMinutes += task.StartedAt.Sub(task.VacatedAt).Minutes()
+		ward.AvgCleaningMinutes += task.CompletedAt.Sub(*task.StartedAt).Minutes()
+		if turnover > ward.MaxTurnoverMinutes {
+			ward.MaxTurnoverMinutes = turnover
+		}
+	}
+
+	pending, err := db.QueryContext(ctx, `SELECT b.ward_id, COUNT(*) FROM HousekeepingTasks t JOIN Beds b ON b.bed_id = t.bed_id
+              WHERE t.status <> 'completed' GROUP BY b.ward_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer pending.Close()
+	for pending.Next() {
+		var wardID, count int
+		if err := pending.Scan(&wardID, &count); err != nil {
+			return nil, err
+		}
+		report.Wards[index[wardID]].Pending = count
+	}
+
+	for i := range report.Wards {
+		ward := &report.Wards[i]
+		if ward.Completed > 0 {
+			n := float64(ward.Completed)
+			ward.AvgTurnoverMinutes /= n
+			ward.AvgWaitMinutes /= n
+			ward.AvgCleaningMinutes /= n
+		}
+	}
+
+	return report, pending.Err()
+}
+
+func queryHousekeepingTasks(ctx context.Context, q querier, clause string, args ...any) ([]models.HousekeepingTask, error) {
+	query := `SELECT t.task_id, t.bed_id, b.label, b.ward_id, w.name, t.admission_id, t.reason, t.status, t.vacated_at,
+                  t.started_at, t.started_by, t.completed_at, t.completed_by, COALESCE(t.notes, '')
+              FROM HousekeepingTasks t
+              JOIN Beds b ON b.bed_id = t.bed_id
+              JOIN Wards w ON w.ward_id = b.ward_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []models.HousekeepingTask{}
+	for rows.Next() {
+		var t models.HousekeepingTask
+		err := rows.Scan(&t.TaskID, &t.BedID, &t.BedLabel, &t.WardID, &t.WardName, &t.AdmissionID, &t.Reason, &t.Status, &t.VacatedAt,
+			&t.StartedAt, &t.StartedBy, &t.CompletedAt, &t.CompletedBy, &t.Notes)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
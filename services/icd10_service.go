@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// ErrUnknownDiagnosisCode is returned when a medical record names a code
+// missing from the ICD-10 code table
+var ErrUnknownDiagnosisCode = errors.New("diagnosis code is not in the ICD-10 code table")
+
+// starterCodes is the built-in ICD-10 table loaded at startup
+//
+//go:embed codes/icd10.tsv
+var starterCodes []byte
+
+// ICD10Service holds the ICD-10 code table that medical record diagnosis
+// codes are checked against, and searches it for typeahead
+type ICD10Service struct{}
+
+func NewICD10Service() *ICD10Service {
+	return &ICD10Service{}
+}
+
+// LoadStarter loads the built-in starter table, keeping descriptions already
+// loaded from a fuller table
+func (s *ICD10Service) LoadStarter(ctx context.Context) (int, error) {
+	return s.load(ctx, bytes.NewReader(starterCodes), false)
+}
+
+// Seed loads a code table of tab-separated code and description lines,
+// replacing the descriptions of codes already present. Blank lines and lines
+// starting with # are skipped.
+func (s *ICD10Service) Seed(ctx context.Context, r io.Reader) (int, error) {
+	return s.load(ctx, r, true)
+}
+
+func (s *ICD10Service) load(ctx context.Context, r io.Reader, replace bool) (int, error) {
+	query := `INSERT INTO ICD10Codes (code, description) VALUES (?, ?) ON CONFLICT (code) DO NOTHING`
+	if replace {
+		query = `INSERT INTO ICD10Codes (code, description) VALUES (?, ?)
+              ON CONFLICT (code) DO UPDATE SET description = excluded.description`
+	}
+
+	loaded := 0
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		scanner := bufio.NewScanner(r)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			code, description, ok := strings.Cut(text, "\t")
+			code, description = strings.ToUpper(strings.TrimSpace(code)), strings.TrimSpace(description)
+			if !ok || code == "" || description == "" {
+				return fmt.Errorf("line %d: want a code and a description separated by a tab", line)
+			}
+			if _, err := tx.ExecContext(ctx, query, code, description); err != nil {
+				return err
+			}
+			loaded++
+		}
+		return scanner.Err()
+	})
+	return loaded, err
+}
+
+// Search finds up to limit codes for a typeahead: codes starting with q,
+// with or without the dot, come first in code order, then codes whose
+// description contains q
+func (s *ICD10Service) Search(ctx context.Context, q string, limit int) ([]models.ICD10Code, error) {
+	q = strings.TrimSpace(q)
+	codePrefix := escapeLike(strings.ToUpper(strings.ReplaceAll(q, ".", ""))) + "%"
+	words := escapeLike(strings.ToLower(q))
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT code, description FROM ICD10Codes
+              WHERE replace(code, '.', '') LIKE ? ESCAPE '\' OR lower(description) LIKE ? ESCAPE '\'
+              ORDER BY CASE WHEN replace(code, '.', '') LIKE ? ESCAPE '\' THEN 0 ELSE 1 END, code
+              LIMIT ?`, codePrefix, "%"+words+"%", codePrefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []models.ICD10Code{}
+	for rows.Next() {
+		var code models.ICD10Code
+		if err := rows.Scan(&code.Code, &code.Description); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// setDiagnosisCodes stores a medical record's diagnosis codes in order,
+// failing with ErrUnknownDiagnosisCode for codes not in the table
+func setDiagnosisCodes(ctx context.Context, tx *sql.Tx, recordID int, codes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM MedicalRecordDiagnosisCodes WHERE record_id = ?`, recordID); err != nil {
+		return err
+	}
+	for i, code := range codes {
+		var known int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM ICD10Codes WHERE code = ?`, code).Scan(&known); err != nil {
+			return err
+		}
+		if known == 0 {
+			return fmt.Errorf("%w: %s", ErrUnknownDiagnosisCode, code)
+		}
+		query := `INSERT INTO MedicalRecordDiagnosisCodes (record_id, code, position) VALUES (?, ?, ?)`
+		if _, err := tx.ExecContext(ctx, query, recordID, code, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachDiagnosisCodes fills in each record's diagnosis codes
+func attachDiagnosisCodes(ctx context.Context, q querier, records []models.MedicalRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(records))
+	byID := map[int]*models.MedicalRecord{}
+	for i := range records {
+		records[i].DiagnosisCodes = []string{}
+		args[i] = records[i].RecordID
+		byID[records[i].RecordID] = &records[i]
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := q.QueryContext(ctx, `SELECT record_id, code FROM MedicalRecordDiagnosisCodes
+              WHERE record_id IN (`+placeholders+`) ORDER BY record_id, position`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var recordID int
+		var code string
+		if err := rows.Scan(&recordID, &code); err != nil {
+			return err
+		}
+		record := byID[recordID]
+		record.DiagnosisCodes = append(record.DiagnosisCodes, code)
+	}
+	return rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards for use with ESCAPE '\'
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// ErrPolicyDates is returned when a policy's cover ends before it starts
+var ErrPolicyDates = errors.New("validTo must not be before validFrom")
+
+// InsuranceService keeps patients' insurance policies and their
+// verification with the payer. Claims apply a patient's verified policy to
+// split their total between the payer and the patient.
+type InsuranceService struct {
+	audit *AuditService
+}
+
+func NewInsuranceService() *InsuranceService {
+	return &InsuranceService{audit: NewAuditService()}
+}
+
+// CreatePolicy adds an unverified policy to its patient
+func (s *InsuranceService) CreatePolicy(ctx context.Context, policy *models.InsurancePolicy) error {
+	if policy.ValidTo != "" && policy.ValidTo < policy.ValidFrom {
+		return ErrPolicyDates
+	}
+	policy.VerificationStatus = models.INSURANCE_STATUS_UNVERIFIED
+	policy.CreatedAt = time.Now().UTC()
+	policy.UpdatedAt = policy.CreatedAt
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, policy.PatientID).Scan(&exists); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO InsurancePolicies (patient_id, payer, policy_number, holder_name, coverage_class, coverage_percent, copay_cents,
+                  valid_from, valid_to, verification_status, created_by, created_at, updated_at)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, policy.PatientID, policy.Payer, policy.PolicyNumber, policy.HolderName, policy.CoverageClass,
+			policy.CoveragePercent, policy.CopayCents, policy.ValidFrom, sql.NullString{String: policy.ValidTo, Valid: policy.ValidTo != ""}, policy.VerificationStatus,
+			policy.CreatedBy, policy.CreatedAt, policy.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		policy.PolicyID = int(id)
+
+		details := map[string]any{"patientId": policy.PatientID, "payer": policy.Payer, "coverageClass": policy.CoverageClass}
+		return s.audit.Log(ctx, tx, policy.CreatedBy, models.AUDIT_INSURANCE_POLICY_SAVED, models.ENTITY_INSURANCE_POLICY, policy.PolicyID, details)
+	})
+}
+
+// UpdatePolicy replaces a policy's details. The changed policy has to be
+// verified again before it applies to new claims.
+func (s *InsuranceService) UpdatePolicy(ctx context.Context, id int, policy *models.InsurancePolicy, userID int) (*models.InsurancePolicy, error) {
+	if policy.ValidTo != "" && policy.ValidTo < policy.ValidFrom {
+		return nil, ErrPolicyDates
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		existing, err := getPolicy(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE InsurancePolicies SET payer = ?, policy_number = ?, holder_name = ?, coverage_class = ?, coverage_percent = ?,
+                  copay_cents = ?, valid_from = ?, valid_to = ?, verification_status = ?, verified_by = NULL, verified_at = NULL,
+                  verification_notes = NULL, updated_at = ?
+              WHERE policy_id = ?`
+		if _, err := tx.ExecContext(ctx, query, policy.Payer, policy.PolicyNumber, policy.HolderName, policy.CoverageClass,
+			policy.CoveragePercent, policy.CopayCents, policy.ValidFrom, sql.NullString{String: policy.ValidTo, Valid: policy.ValidTo != ""}, models.INSURANCE_STATUS_UNVERIFIED,
+			time.Now().UTC(), id); err != nil {
+			return err
+		}
+
+		details := map[string]any{"patientId": existing.PatientID, "payer": policy.Payer, "coverageClass": policy.CoverageClass}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_INSURANCE_POLICY_SAVED, models.ENTITY_INSURANCE_POLICY, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPolicy(database.WithPrimaryReads(ctx), id)
+}
+
+// Verify records whether the payer confirmed the policy
+func (s *InsuranceService) Verify(ctx context.Context, id int, verification models.InsuranceVerification, userID int) (*models.InsurancePolicy, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		policy, err := getPolicy(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE InsurancePolicies SET verification_status = ?, verified_by = ?, verified_at = ?,
+                  verification_notes = ? WHERE policy_id = ?`,
+			verification.Status, userID, time.Now().UTC(), sql.NullString{String: verification.Notes, Valid: verification.Notes != ""}, id); err != nil {
+			return err
+		}
+
+		details := map[string]any{"patientId": policy.PatientID, "payer": policy.Payer, "status": verification.Status}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_INSURANCE_VERIFIED, models.ENTITY_INSURANCE_POLICY, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPolicy(database.WithPrimaryReads(ctx), id)
+}
+
+func (s *InsuranceService) GetPolicy(ctx context.Context, id int) (*models.InsurancePolicy, error) {
+	return getPolicy(ctx, database.ReadDB(ctx), id)
+}
+
+// GetPolicies lists a patient's policies, those starting latest first
+func (s *InsuranceService) GetPolicies(ctx context.Context, patientID int) ([]models.InsurancePolicy, error) {
+	var exists int
+	if err := database.ReadDB(ctx).QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, patientID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	return queryPolicies(ctx, database.ReadDB(ctx), `WHERE patient_id = ? ORDER BY valid_from DESC, policy_id DESC`, patientID)
+}
+
+func getPolicy(ctx context.Context, q querier, id int) (*models.InsurancePolicy, error) {
+	policies, err := queryPolicies(ctx, q, `WHERE policy_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &policies[0], nil
+}
+
+// verifiedPolicy returns the patient's verified policy with payer valid on
+// date, the one starting latest if several are; nil if there is none
+func verifiedPolicy(ctx context.Context, q querier, patientID int, payer, date string) (*models.InsurancePolicy, error) {
+	policies, err := queryPolicies(ctx, q, `WHERE patient_id = ? AND payer = ? AND verification_status = ? AND valid_from <= ?
+              AND (valid_to IS NULL OR valid_to >= ?)
+              ORDER BY valid_from DESC, policy_id DESC LIMIT 1`,
+		patientID, payer, models.INSURANCE_STATUS_VERIFIED, date, date)
+	if err != nil || len(policies) == 0 {
+		return nil, err
+	}
+	return &policies[0], nil
+}
+
+func queryPolicies(ctx context.Context, q querier, clause string, args ...any) ([]models.InsurancePolicy, error) {
+	query := `SELECT policy_id, patient_id, payer, policy_number, COALESCE(holder_name, ''), coverage_class, coverage_percent, copay_cents,
+                  valid_from, valid_to, verification_status, verified_by, verified_at, COALESCE(verification_notes, ''),
+                  created_by, created_at, updated_at
+              FROM InsurancePolicies ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []models.InsurancePolicy{}
+	for rows.Next() {
+		var p models.InsurancePolicy
+		var validTo sql.NullString
+		var verifiedBy sql.NullInt64
+		var verifiedAt sql.NullTime
+		if err := rows.Scan(&p.PolicyID, &p.PatientID, &p.Payer, &p.PolicyNumber, &p.HolderName, &p.CoverageClass, &p.CoveragePercent,
+			&p.CopayCents, &p.ValidFrom, &validTo, &p.VerificationStatus, &verifiedBy, &verifiedAt, &p.VerificationNotes,
+			&p.CreatedBy, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		p.ValidTo = validTo.String
+		if verifiedBy.Valid {
+			by := int(verifiedBy.Int64)
+			p.VerifiedBy = &by
+		}
+		if verifiedAt.Valid {
+			t := timezone.In(verifiedAt.Time)
+			p.VerifiedAt = &t
+		}
+		p.CreatedAt = timezone.In(p.CreatedAt)
+		p.UpdatedAt = timezone.In(p.UpdatedAt)
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
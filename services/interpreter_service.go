@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// ErrInterpreterBookingState is returned when confirming a booking that isn't
+// an outstanding external request
+var ErrInterpreterBookingState = errors.New("only requested external bookings can be confirmed")
+
+// InterpreterService keeps the interpreter roster and books interpreters for
+// appointments. A rostered interpreter who speaks the language and is free
+// is reserved; otherwise the request goes to the external agency.
+type InterpreterService struct {
+	notifications *NotificationService
+	agency        []notifications.Recipient
+}
+
+// NewInterpreterService sends external requests to the agency recipients
+// through notifications
+func NewInterpreterService(notifications *NotificationService, agency []notifications.Recipient) *InterpreterService {
+	return &InterpreterService{notifications: notifications, agency: agency}
+}
+
+// CreateInterpreter adds an interpreter to the roster
+func (s *InterpreterService) CreateInterpreter(ctx context.Context, interpreter *models.Interpreter) error {
+	interpreter.Languages = normalizeLanguages(interpreter.Languages)
+	result, err := database.GetDB().ExecContext(ctx, `INSERT INTO Interpreters (full_name, languages, contact, active) VALUES (?, ?, ?, ?)`,
+		interpreter.FullName, strings.Join(interpreter.Languages, ","), interpreter.Contact, interpreter.Active)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	interpreter.InterpreterID = int(id)
+	return nil
+}
+
+// UpdateInterpreter replaces an interpreter's details. Deactivating an
+// interpreter leaves their existing reservations in place.
+func (s *InterpreterService) UpdateInterpreter(ctx context.Context, id int, interpreter *models.Interpreter) error {
+	interpreter.InterpreterID = id
+	interpreter.Languages = normalizeLanguages(interpreter.Languages)
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE Interpreters SET full_name = ?, languages = ?, contact = ?, active = ?
+              WHERE interpreter_id = ?`,
+		interpreter.FullName, strings.Join(interpreter.Languages, ","), interpreter.Contact, interpreter.Active, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetInterpreters lists the roster, optionally only active interpreters
+// speaking language
+func (s *InterpreterService) GetInterpreters(ctx context.Context, language string) ([]models.Interpreter, error) {
+	interpreters, err := queryInterpreters(ctx, database.ReadDB(ctx), `ORDER BY full_name, interpreter_id`)
+	if err != nil || language == "" {
+		return interpreters, err
+	}
+
+	speakers := []models.Interpreter{}
+	for _, interpreter := range interpreters {
+		if interpreter.Active && speaks(interpreter, language) {
+			speakers = append(speakers, interpreter)
+		}
+	}
+	return speakers, nil
+}
+
+// GetBookings lists interpreter bookings, newest first, optionally with one status
+func (s *InterpreterService) GetBookings(ctx context.Context, status string) ([]models.InterpreterBooking, error) {
+	if status == "" {
+		return queryInterpreterBookings(ctx, database.ReadDB(ctx), `ORDER BY b.booking_id DESC`)
+	}
+	return queryInterpreterBookings(ctx, database.ReadDB(ctx), `WHERE b.status = ? ORDER BY b.booking_id DESC`, status)
+}
+
+// Confirm records the agency's confirmation of an external request
+func (s *InterpreterService) Confirm(ctx context.Context, id int, reference string) (*models.InterpreterBooking, error) {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE InterpreterBookings SET status = ?, external_reference = ?, confirmed_at = ?
+              WHERE booking_id = ? AND status = ?`,
+		models.INTERPRETER_STATUS_CONFIRMED, reference, time.Now().UTC(), id, models.INTERPRETER_STATUS_REQUESTED)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = database.WithPrimaryReads(ctx)
+	bookings, err := queryInterpreterBookings(ctx, database.ReadDB(ctx), `WHERE b.booking_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(bookings) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrInterpreterBookingState
+	}
+	return &bookings[0], nil
+}
+
+// reserve books an interpreter for a newly booked appointment within its
+// transaction. The least-booked free rostered speaker of the language is
+// reserved; when there is none the agency is sent a request.
+func (s *InterpreterService) reserve(ctx context.Context, tx *sql.Tx, appointment *models.Appointment, language string) (*models.InterpreterBooking, error) {
+	booking := &models.InterpreterBooking{
+		AppointmentID: appointment.AppointmentID,
+		Language:      language,
+		Kind:          models.INTERPRETER_BOOKING_EXTERNAL,
+		Status:        models.INTERPRETER_STATUS_REQUESTED,
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	interpreter, err := freeInterpreter(ctx, tx, language, appointment.StartsAt, appointment.EndsAt)
+	if err != nil {
+		return nil, err
+	}
+	if interpreter != nil {
+		booking.Kind = models.INTERPRETER_BOOKING_INTERNAL
+		booking.Status = models.INTERPRETER_STATUS_RESERVED
+		booking.InterpreterID = &interpreter.InterpreterID
+		booking.InterpreterName = interpreter.FullName
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO InterpreterBookings (appointment_id, language, kind, interpreter_id, status, created_at)
+              VALUES (?, ?, ?, ?, ?, ?)`,
+		booking.AppointmentID, booking.Language, booking.Kind, booking.InterpreterID, booking.Status, booking.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	booking.BookingID = int(id)
+
+	if booking.Kind == models.INTERPRETER_BOOKING_EXTERNAL {
+		body := fmt.Sprintf("Interpreter request %d: %s interpreter needed on %s from %s to %s UTC. Please confirm quoting the request number.",
+			booking.BookingID, language, appointment.StartsAt.Format("Mon 2 Jan 2006"), appointment.StartsAt.Format("15:04"),
+			appointment.EndsAt.Format("15:04"))
+		if err := s.notifyAgency(ctx, tx, models.NOTIFICATION_INTERPRETER_REQUEST, booking.BookingID, "Interpreter request", body); err != nil {
+			return nil, err
+		}
+	}
+	return booking, nil
+}
+
+// cancel releases the interpreter booked for a cancelled appointment. The
+// agency is told unless its request was never sent.
+func (s *InterpreterService) cancel(ctx context.Context, tx *sql.Tx, appointmentID int) error {
+	var bookingID int
+	var kind, status string
+	err := tx.QueryRowContext(ctx, `SELECT booking_id, kind, status FROM InterpreterBookings WHERE appointment_id = ?`,
+		appointmentID).Scan(&bookingID, &kind, &status)
+	if errors.Is(err, sql.ErrNoRows) || status == models.INTERPRETER_STATUS_CANCELLED {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE InterpreterBookings SET status = ? WHERE booking_id = ?`,
+		models.INTERPRETER_STATUS_CANCELLED, bookingID); err != nil {
+		return err
+	}
+	if kind != models.INTERPRETER_BOOKING_EXTERNAL {
+		return nil
+	}
+
+	unsent, err := s.notifications.CancelPending(ctx, tx, models.NOTIFICATION_INTERPRETER_REQUEST, models.ENTITY_INTERPRETER, bookingID)
+	if err != nil || unsent > 0 {
+		return err
+	}
+	body := fmt.Sprintf("Interpreter request %d has been cancelled; the appointment no longer needs an interpreter.", bookingID)
+	return s.notifyAgency(ctx, tx, models.NOTIFICATION_INTERPRETER_CANCELLATION, bookingID, "Interpreter request cancelled", body)
+}
+
+func (s *InterpreterService) notifyAgency(ctx context.Context, tx *sql.Tx, kind string, bookingID int, subject, body string) error {
+	for _, recipient := range s.agency {
+		err := s.notifications.Enqueue(ctx, tx, &models.Notification{
+			Kind:       kind,
+			Channel:    recipient.Channel,
+			Recipient:  recipient.Address,
+			Subject:    subject,
+			Body:       body,
+			EntityType: models.ENTITY_INTERPRETER,
+			EntityID:   bookingID,
+		}, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freeInterpreter returns the active rostered speaker of language with no
+// reservation overlapping the slot and the fewest reservations that day, or
+// nil if nobody is free
+func freeInterpreter(ctx context.Context, q querier, language string, start, end time.Time) (*models.Interpreter, error) {
+	interpreters, err := queryInterpreters(ctx, q, `WHERE active ORDER BY interpreter_id`)
+	if err != nil {
+		return nil, err
+	}
+
+	// An interpreter's load is counted over the facility-local day
+	dayStart := timezone.StartOfDay(start)
+	var best *models.Interpreter
+	bestLoad := 0
+	for _, interpreter := range interpreters {
+		if !speaks(interpreter, language) {
+			continue
+		}
+
+		var overlapping, load int
+		query := `SELECT COALESCE(SUM(CASE WHEN a.starts_at < ? AND a.ends_at > ? THEN 1 ELSE 0 END), 0), COUNT(*)
+                  FROM InterpreterBookings b
+                  JOIN Appointments a ON a.appointment_id = b.appointment_id
+                  WHERE b.interpreter_id = ? AND b.status = ? AND a.starts_at < ? AND a.ends_at > ?`
+		err := q.QueryRowContext(ctx, query, end, start, interpreter.InterpreterID, models.INTERPRETER_STATUS_RESERVED,
+			dayStart.AddDate(0, 0, 1).UTC(), dayStart.UTC()).Scan(&overlapping, &load)
+		if err != nil {
+			return nil, err
+		}
+		if overlapping > 0 {
+			continue
+		}
+		if best == nil || load < bestLoad {
+			picked := interpreter
+			best, bestLoad = &picked, load
+		}
+	}
+	return best, nil
+}
+
+// bookingsByAppointment returns the interpreter bookings of the appointments, keyed by appointment
+func bookingsByAppointment(ctx context.Context, q querier, appointmentIDs []int) (map[int]*models.InterpreterBooking, error) {
+	bookings := map[int]*models.InterpreterBooking{}
+	if len(appointmentIDs) == 0 {
+		return bookings, nil
+	}
+
+	args := make([]any, len(appointmentIDs))
+	for i, id := range appointmentIDs {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	list, err := queryInterpreterBookings(ctx, q, `WHERE b.appointment_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		bookings[list[i].AppointmentID] = &list[i]
+	}
+	return bookings, nil
+}
+
+func speaks(interpreter models.Interpreter, language string) bool {
+	for _, spoken := range interpreter.Languages {
+		if strings.EqualFold(spoken, strings.TrimSpace(language)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLanguages trims languages and drops blanks and repeats
+func normalizeLanguages(languages []string) []string {
+	normalized := []string{}
+	for _, language := range languages {
+		language = strings.TrimSpace(language)
+		if language == "" || speaks(models.Interpreter{Languages: normalized}, language) {
+			continue
+		}
+		normalized = append(normalized, language)
+	}
+	return normalized
+}
+
+func queryInterpreters(ctx context.Context, q querier, clause string, args ...any) ([]models.Interpreter, error) {
+	rows, err := q.QueryContext(ctx, `SELECT interpreter_id, full_name, languages, COALESCE(contact, ''), active FROM Interpreters `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	interpreters := []models.Interpreter{}
+	for rows.Next() {
+		var interpreter models.Interpreter
+		var languages string
+		if err := rows.Scan(&interpreter.InterpreterID, &interpreter.FullName, &languages, &interpreter.Contact, &interpreter.Active); err != nil {
+			return nil, err
+		}
+		interpreter.Languages = strings.Split(languages, ",")
+		interpreters = append(interpreters, interpreter)
+	}
+	return interpreters, rows.Err()
+}
+
+func queryInterpreterBookings(ctx context.Context, q querier, clause string, args ...any) ([]models.InterpreterBooking, error) {
+	query := `SELECT b.booking_id, b.appointment_id, b.language, b.kind, b.interpreter_id, COALESCE(i.full_name, ''), b.status,
+                  COALESCE(b.external_reference, ''), b.created_at, b.confirmed_at
+              FROM InterpreterBookings b
+              LEFT JOIN Interpreters i ON i.interpreter_id = b.interpreter_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []models.InterpreterBooking{}
+	for rows.Next() {
+		var b models.InterpreterBooking
+		if err := rows.Scan(&b.BookingID, &b.AppointmentID, &b.Language, &b.Kind, &b.InterpreterID, &b.InterpreterName, &b.Status,
+			&b.ExternalReference, &b.CreatedAt, &b.ConfirmedAt); err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+	return bookings, rows.Err()
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// ErrLabOrderClosed is returned when posting results to a completed or cancelled order
+var ErrLabOrderClosed = errors.New("lab order is no longer open")
+
+type LabService struct {
+	events *EventService
+}
+
+func NewLabService() *LabService {
+	return &LabService{
+		events: NewEventService(),
+	}
+}
+
+// CreateLabOrder orders a test against a medical record; the patient is taken from the record
+func (s *LabService) CreateLabOrder(ctx context.Context, order *models.LabOrder) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, `SELECT patient_id FROM MedicalRecords WHERE record_id = ?`, order.RecordID).Scan(&order.PatientID); err != nil {
+			return err
+		}
+
+		if order.Priority == "" {
+			order.Priority = "routine"
+		}
+		order.Status = models.LAB_STATUS_ORDERED
+		order.OrderedAt = time.Now()
+
+		query := `INSERT INTO LabOrders (patient_id, record_id, ordered_by, test_name, priority, status, notes, ordered_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, order.PatientID, order.RecordID, order.OrderedBy, order.TestName,
+			order.Priority, order.Status, order.Notes, order.OrderedAt)
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		order.LabOrderID = int(id)
+
+		return s.events.Append(ctx, tx, models.ENTITY_LAB_ORDER, order.LabOrderID, models.EVENT_LAB_ORDERED, order)
+	})
+}
+
+// AddResults posts results to an open order and marks it completed
+func (s *LabService) AddResults(ctx context.Context, orderID, resultedBy int, results []models.LabResult) ([]models.LabResult, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		if err := tx.QueryRowContext(ctx, `SELECT status FROM LabOrders WHERE lab_order_id = ?`, orderID).Scan(&status); err != nil {
+			return err
+		}
+		if status != models.LAB_STATUS_ORDERED {
+			return ErrLabOrderClosed
+		}
+
+		now := time.Now()
+		query := `INSERT INTO LabResults (lab_order_id, analyte, value, unit, reference_low, reference_high,
+              reference_range, flag, comment, resulted_by, resulted_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		for i := range results {
+			result := &results[i]
+			result.LabOrderID = orderID
+			result.ResultedBy = resultedBy
+			result.ResultedAt = now
+			if result.Flag == "" {
+				result.Flag = flagFor(result)
+			}
+			if result.ReferenceRange == "" && result.ReferenceLow != nil && result.ReferenceHigh != nil {
+				result.ReferenceRange = fmt.Sprintf("%g-%g", *result.ReferenceLow, *result.ReferenceHigh)
+			}
+
+			inserted, err := tx.ExecContext(ctx, query, orderID, result.Analyte, result.Value, result.Unit, result.ReferenceLow,
+				result.ReferenceHigh, result.ReferenceRange, result.Flag, result.Comment, resultedBy, now)
+			if err != nil {
+				return err
+			}
+			id, _ := inserted.LastInsertId()
+			result.LabResultID = int(id)
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE LabOrders SET status = ? WHERE lab_order_id = ?`, models.LAB_STATUS_COMPLETED, orderID); err != nil {
+			return err
+		}
+
+		payload := map[string]any{"status": models.LAB_STATUS_COMPLETED, "results": results}
+		return s.events.Append(ctx, tx, models.ENTITY_LAB_ORDER, orderID, models.EVENT_LAB_RESULTED, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// flagFor derives a flag from the reference range for numeric values
+func flagFor(result *models.LabResult) string {
+	value, err := strconv.ParseFloat(strings.TrimSpace(result.Value), 64)
+	if err != nil {
+		return models.LAB_FLAG_NORMAL
+	}
+	if result.ReferenceLow != nil && value < *result.ReferenceLow {
+		return models.LAB_FLAG_LOW
+	}
+	if result.ReferenceHigh != nil && value > *result.ReferenceHigh {
+		return models.LAB_FLAG_HIGH
+	}
+	return models.LAB_FLAG_NORMAL
+}
+
+// GetLabOrder returns an order with its results
+func (s *LabService) GetLabOrder(ctx context.Context, id int) (*models.LabOrder, error) {
+	orders, err := s.queryOrders(ctx, `WHERE lab_order_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &orders[0], nil
+}
+
+// GetLabOrders lists orders, optionally filtered by status, oldest first so lab staff work the queue in order
+func (s *LabService) GetLabOrders(ctx context.Context, status string) ([]models.LabOrder, error) {
+	if status == "" {
+		return s.queryOrders(ctx, `ORDER BY ordered_at`)
+	}
+	return s.queryOrders(ctx, `WHERE status = ? ORDER BY ordered_at`, status)
+}
+
+// GetLabOrdersByPatient lists a patient's orders and results, newest first
+func (s *LabService) GetLabOrdersByPatient(ctx context.Context, patientID int) ([]models.LabOrder, error) {
+	return s.queryOrders(ctx, `WHERE patient_id = ? ORDER BY ordered_at DESC`, patientID)
+}
+
+// GetLabOrdersByRecord lists the orders placed from a medical record
+func (s *LabService) GetLabOrdersByRecord(ctx context.Context, recordID int) ([]models.LabOrder, error) {
+	return s.queryOrders(ctx, `WHERE record_id = ? ORDER BY ordered_at`, recordID)
+}
+
+func (s *LabService) queryOrders(ctx context.Context, clause string, args ...any) ([]models.LabOrder, error) {
+	query := `SELECT lab_order_id, patient_id, record_id, ordered_by, test_name, priority, status, COALESCE(notes, ''), ordered_at
+              FROM LabOrders ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []models.LabOrder{}
+	for rows.Next() {
+		var order models.LabOrder
+		if err := rows.Scan(&order.LabOrderID, &order.PatientID, &order.RecordID, &order.OrderedBy, &order.TestName,
+			&order.Priority, &order.Status, &order.Notes, &order.OrderedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		results, err := s.getResults(ctx, orders[i].LabOrderID)
+		if err != nil {
+			return nil, err
+		}
+		orders[i].Results = results
+	}
+
+	return orders, nil
+}
+
+func (s *LabService) getResults(ctx context.Context, orderID int) ([]models.LabResult, error) {
+	query := `SELECT lab_result_id, lab_order_id, analyte, value, COALESCE(unit, ''), reference_low, reference_high,
+              COALESCE(reference_range, ''), flag, COALESCE(comment, ''), resulted_by, resulted_at
+              FROM LabResults WHERE lab_order_id = ? ORDER BY lab_result_id`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.LabResult
+	for rows.Next() {
+		var result models.LabResult
+		if err := rows.Scan(&result.LabResultID, &result.LabOrderID, &result.Analyte, &result.Value, &result.Unit,
+			&result.ReferenceLow, &result.ReferenceHigh, &result.ReferenceRange, &result.Flag, &result.Comment,
+			&result.ResultedBy, &result.ResultedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// basicLoginQuietPeriod is how long after recording a user's successful basic
+// auth login from a client further ones from it go unrecorded. Basic auth
+// sends the password with every request, so each one is a login.
+const basicLoginQuietPeriod = 15 * time.Minute
+
+// maxLoginUsername caps the username stored for a failed attempt, which is
+// whatever the client sent
+const maxLoginUsername = 100
+
+// LoginEventService records authentication attempts and each user's last
+// login
+type LoginEventService struct {
+	mu sync.Mutex
+	// basicLogins is when each user and client's last recorded basic auth
+	// login was
+	basicLogins map[string]time.Time
+}
+
+func NewLoginEventService() *LoginEventService {
+	return &LoginEventService{basicLogins: map[string]time.Time{}}
+}
+
+// Record stores an authentication attempt. A successful attempt that
+// completes a login, as opposed to a password opening a session that still
+// needs its second factor, also sets the user's last login.
+func (s *LoginEventService) Record(ctx context.Context, event *models.LoginEvent, completed bool) error {
+	event.CreatedAt = time.Now().UTC()
+	if len(event.Username) > maxLoginUsername {
+		event.Username = event.Username[:maxLoginUsername]
+	}
+	if event.Method == models.LOGIN_METHOD_BASIC && event.Success && completed && s.recentBasicLogin(event) {
+		return nil
+	}
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		user := sql.NullInt64{Int64: int64(event.UserID), Valid: event.UserID != 0}
+		reason := sql.NullString{String: event.FailureReason, Valid: event.FailureReason != ""}
+		query := `INSERT INTO LoginEvents (user_id, username, method, success, failure_reason, ip_address, user_agent, created_at)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, user, event.Username, event.Method, event.Success,
+			reason, event.IPAddress, event.UserAgent, event.CreatedAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		event.LoginEventID = int(id)
+
+		if event.Success && completed {
+			_, err = tx.ExecContext(ctx, `UPDATE Users SET last_login_at = ? WHERE user_id = ?`, event.CreatedAt, event.UserID)
+		}
+		return err
+	})
+}
+
+// recentBasicLogin reports whether a basic auth login by the same user from
+// the same client was recorded within basicLoginQuietPeriod, noting this one
+// if not
+func (s *LoginEventService) recentBasicLogin(event *models.LoginEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strconv.Itoa(event.UserID) + "\x00" + event.IPAddress + "\x00" + event.UserAgent
+	if last, ok := s.basicLogins[key]; ok && event.CreatedAt.Sub(last) < basicLoginQuietPeriod {
+		return true
+	}
+	for other, last := range s.basicLogins {
+		if event.CreatedAt.Sub(last) >= basicLoginQuietPeriod {
+			delete(s.basicLogins, other)
+		}
+	}
+	s.basicLogins[key] = event.CreatedAt
+	return false
+}
+
+// History returns a page of the user's authentication attempts, newest
+// first, and how many there are across all pages
+func (s *LoginEventService) History(ctx context.Context, userID, limit, offset int) ([]models.LoginEvent, int, error) {
+	db := database.ReadDB(ctx)
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM LoginEvents WHERE user_id = ?`, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT login_event_id, user_id, username, method, success, COALESCE(failure_reason, ''),
+                  ip_address, user_agent, created_at
+              FROM LoginEvents WHERE user_id = ?
+              ORDER BY created_at DESC, login_event_id DESC LIMIT ? OFFSET ?`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []models.LoginEvent{}
+	for rows.Next() {
+		var event models.LoginEvent
+		if err := rows.Scan(&event.LoginEventID, &event.UserID, &event.Username, &event.Method, &event.Success,
+			&event.FailureReason, &event.IPAddress, &event.UserAgent, &event.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
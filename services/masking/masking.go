@@ -0,0 +1,258 @@
+// Package masking produces de-identified copies of the database for staging
+// and development. Values are scrambled deterministically per patient: the
+// same patient masked with the same key always gets the same fake identity,
+// so relationships and repeated exports stay consistent.
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+)
+
+var firstNames = []string{
+	"Alex", "Jordan", "Taylor", "Morgan", "Casey", "Riley", "Jamie", "Avery", "Quinn", "Peyton",
+	"Rowan", "Sage", "Emerson", "Harper", "Finley", "Dakota", "Reese", "Skyler", "Kendall", "Logan",
+}
+
+var lastNames = []string{
+	"Smith", "Otieno", "Garcia", "Mwangi", "Nguyen", "Kamau", "Brown", "Wanjiru", "Lopez", "Kimani",
+	"Wilson", "Achieng", "Martin", "Njoroge", "Clark", "Mutua", "Lewis", "Chebet", "Walker", "Omondi",
+}
+
+var streets = []string{"Oak", "Maple", "Cedar", "Pine", "Elm", "Acacia", "Baobab", "Willow", "Birch", "Jacaranda"}
+
+var words = []string{
+	"patient", "reports", "stable", "review", "follow", "up", "mild", "symptoms", "noted", "advised",
+	"rest", "fluids", "monitor", "daily", "improving", "pain", "managed", "history", "unremarkable", "plan",
+}
+
+// Masker derives fake values from a secret key and a per-patient seed
+type Masker struct {
+	key []byte
+}
+
+func NewMasker(key string) *Masker {
+	return &Masker{key: []byte(key)}
+}
+
+// pick returns a stable pseudo-random number for (patientID, field)
+func (m *Masker) pick(patientID int, field string) uint64 {
+	mac := hmac.New(sha256.New, m.key)
+	fmt.Fprintf(mac, "%d:%s", patientID, field)
+	return binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+}
+
+func (m *Masker) FirstName(patientID int) string {
+	return firstNames[m.pick(patientID, "first_name")%uint64(len(firstNames))]
+}
+
+func (m *Masker) LastName(patientID int) string {
+	return lastNames[m.pick(patientID, "last_name")%uint64(len(lastNames))]
+}
+
+func (m *Masker) Phone(patientID int, field string) string {
+	n := m.pick(patientID, field)
+	return fmt.Sprintf("555-%03d-%04d", n%1000, (n/1000)%10000)
+}
+
+func (m *Masker) Address(patientID int) string {
+	n := m.pick(patientID, "address")
+	return fmt.Sprintf("%d %s Street", n%900+100, streets[(n/900)%uint64(len(streets))])
+}
+
+// DateOfBirth shifts a date by up to ±180 days so ages stay realistic
+func (m *Masker) DateOfBirth(patientID int, dob string) string {
+	parsed, err := time.Parse("2006-01-02", dob)
+	if err != nil {
+		return dob
+	}
+	shift := int(m.pick(patientID, "date_of_birth")%361) - 180
+	return parsed.AddDate(0, 0, shift).Format("2006-01-02")
+}
+
+// Text replaces free text with filler of roughly the same length.
+// salt distinguishes several notes belonging to the same patient.
+func (m *Masker) Text(patientID int, salt string, text string) string {
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+
+	count := len(strings.Fields(text))
+	filler := make([]string, count)
+	for i := range filler {
+		filler[i] = words[m.pick(patientID, fmt.Sprintf("%s:%d", salt, i))%uint64(len(words))]
+	}
+	return strings.Join(filler, " ")
+}
+
+// Export clones the live database into dstPath and masks the copy in place.
+// The live database is never modified.
+func Export(dstPath string, key string) error {
+	if database.CurrentDialect().Name() != database.SQLite {
+		return fmt.Errorf("masked export is only supported on SQLite")
+	}
+
+	if _, err := database.GetDB().Exec(`VACUUM INTO ?`, dstPath); err != nil {
+		return fmt.Errorf("failed to clone database: %v", err)
+	}
+
+	dst, err := sql.Open("sqlite3", dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to open export: %v", err)
+	}
+	defer dst.Close()
+
+	tx, err := dst.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	masker := NewMasker(key)
+	if err := maskPatients(tx, masker); err != nil {
+		return err
+	}
+	if err := maskClinicalNotes(tx, masker); err != nil {
+		return err
+	}
+	if err := stripSecrets(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Masked export written to %s", dstPath)
+	return nil
+}
+
+func maskPatients(tx *sql.Tx, masker *Masker) error {
+	rows, err := tx.Query(`SELECT patient_id, COALESCE(date_of_birth, ''), COALESCE(medical_history, '') FROM Patients`)
+	if err != nil {
+		return err
+	}
+
+	type patientRow struct {
+		id           int
+		dob, history string
+	}
+	var patients []patientRow
+	for rows.Next() {
+		var p patientRow
+		if err := rows.Scan(&p.id, &p.dob, &p.history); err != nil {
+			rows.Close()
+			return err
+		}
+		// Masking keeps the word count, so work from the plaintext
+		if p.history, err = encryption.Open(encryption.PatientMedicalHistory, p.id, p.history); err != nil {
+			rows.Close()
+			return err
+		}
+		patients = append(patients, p)
+	}
+	rows.Close()
+
+	for _, p := range patients {
+		query := `UPDATE Patients SET first_name = ?, last_name = ?, date_of_birth = ?, contact_info = ?,
+                  address = ?, emergency_contact = ?, medical_history = ? WHERE patient_id = ?`
+		_, err := tx.Exec(query, masker.FirstName(p.id), masker.LastName(p.id), masker.DateOfBirth(p.id, p.dob),
+			masker.Phone(p.id, "contact_info"), masker.Address(p.id), masker.Phone(p.id, "emergency_contact"),
+			masker.Text(p.id, "medical_history", p.history), p.id)
+		if err != nil {
+			return fmt.Errorf("failed to mask patient %d: %v", p.id, err)
+		}
+	}
+
+	// The change history and discharge summaries hold the real values the
+	// masking replaced
+	for _, statement := range []string{`DELETE FROM PatientChanges`, `DELETE FROM DischargeSummaries`} {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func maskClinicalNotes(tx *sql.Tx, masker *Masker) error {
+	type note struct {
+		id, patientID int
+		text          string
+	}
+
+	// open decrypts encrypted columns so masking can keep their word count;
+	// patientColumn is the expression for the row's patient
+	maskColumn := func(table, idColumn, patientColumn, column string, open func(id int, text string) (string, error)) error {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT %s, %s, COALESCE(%s, '') FROM %s`, idColumn, patientColumn, column, table))
+		if err != nil {
+			return err
+		}
+
+		var notes []note
+		for rows.Next() {
+			var n note
+			if err := rows.Scan(&n.id, &n.patientID, &n.text); err != nil {
+				rows.Close()
+				return err
+			}
+			if n.text, err = open(n.id, n.text); err != nil {
+				rows.Close()
+				return err
+			}
+			notes = append(notes, n)
+		}
+		rows.Close()
+
+		for _, n := range notes {
+			salt := fmt.Sprintf("%s.%s:%d", table, column, n.id)
+			query := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s = ?`, table, column, idColumn)
+			if _, err := tx.Exec(query, masker.Text(n.patientID, salt, n.text), n.id); err != nil {
+				return fmt.Errorf("failed to mask %s.%s: %v", table, column, err)
+			}
+		}
+		return nil
+	}
+
+	open := func(column encryption.Column) func(int, string) (string, error) {
+		return func(id int, text string) (string, error) { return encryption.Open(column, id, text) }
+	}
+	notePatient := `(SELECT patient_id FROM MedicalRecords WHERE MedicalRecords.record_id = Notes.record_id)`
+	if err := maskColumn("Notes", "note_id", notePatient, "body", open(encryption.NoteBody)); err != nil {
+		return err
+	}
+	if err := maskColumn("Allergies", "allergy_id", "patient_id", "substance", open(encryption.AllergySubstance)); err != nil {
+		return err
+	}
+	if err := maskColumn("Allergies", "allergy_id", "patient_id", "reaction", open(encryption.AllergyReaction)); err != nil {
+		return err
+	}
+	plaintext := func(_ int, text string) (string, error) { return text, nil }
+	return maskColumn("Prescriptions", "prescription_id", "patient_id", "instructions", plaintext)
+}
+
+// stripSecrets removes credentials, staff contact details and the event
+// history, whose payloads contain unmasked snapshots, from the copy
+func stripSecrets(tx *sql.Tx) error {
+	statements := []string{
+		`UPDATE Users SET two_fa_secret = '', two_fa_backup_codes = '', notify_email = '', notify_phone = ''`,
+		`DELETE FROM WebAuthnCredentials`,
+		`DROP TRIGGER IF EXISTS clinical_events_no_delete`,
+		`DELETE FROM ClinicalEvents`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("failed to strip secrets: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// SQLiteMedicalRecordRepo is the MedicalRecordRepo backed by the MedicalRecords
+// table and nurse_medical_records_view
+type SQLiteMedicalRecordRepo struct {
+	events *EventService
+}
+
+func NewSQLiteMedicalRecordRepo() *SQLiteMedicalRecordRepo {
+	return &SQLiteMedicalRecordRepo{
+		events: NewEventService(),
+	}
+}
+
+// Create stores the record, with its doctor notes, if any, as its first
+// note, by the record's doctor and unsigned
+func (r *SQLiteMedicalRecordRepo) Create(ctx context.Context, record *models.MedicalRecord) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		sections, err := marshalSections(record.Sections)
+		if err != nil {
+			return err
+		}
+		query := `INSERT INTO MedicalRecords (patient_id, doctor_id, visit_date, diagnosis, treatment_plan, template_code, sections)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, record.PatientID, record.DoctorID, record.VisitDate, record.Diagnosis,
+			record.TreatmentPlan, sql.NullString{String: record.TemplateCode, Valid: record.TemplateCode != ""}, sections)
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		record.RecordID = int(id)
+
+		if strings.TrimSpace(record.DoctorNotes) != "" {
+			note := &models.Note{RecordID: record.RecordID, Body: record.DoctorNotes}
+			if err := insertNote(ctx, tx, note, record.DoctorID); err != nil {
+				return err
+			}
+			record.DoctorNotes = note.Body
+		}
+
+		record.DiagnosisCodes = normalizeCodes(record.DiagnosisCodes)
+		if err := setDiagnosisCodes(ctx, tx, record.RecordID, record.DiagnosisCodes); err != nil {
+			return err
+		}
+
+		return r.events.Append(ctx, tx, models.ENTITY_MEDICAL_RECORD, record.RecordID, models.EVENT_RECORD_CREATED, record)
+	})
+}
+
+func (r *SQLiteMedicalRecordRepo) List(ctx context.Context) ([]models.MedicalRecord, error) {
+	var records []models.MedicalRecord
+
+	query := `SELECT record_id, patient_id, doctor_id, visit_date, diagnosis, treatment_plan, COALESCE(template_code, ''), sections FROM MedicalRecords`
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record models.MedicalRecord
+		var sections sql.NullString
+		err := rows.Scan(
+			&record.RecordID,
+			&record.PatientID,
+			&record.DoctorID,
+			&record.VisitDate,
+			&record.Diagnosis,
+			&record.TreatmentPlan,
+			&record.TemplateCode,
+			&sections,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := unmarshalSections(&record, sections); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := attachDiagnosisCodes(ctx, database.ReadDB(ctx), records); err != nil {
+		return nil, err
+	}
+	if err := attachNoteSummaries(ctx, database.ReadDB(ctx), records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r *SQLiteMedicalRecordRepo) Get(ctx context.Context, id int) (*models.MedicalRecord, error) {
+	var record models.MedicalRecord
+	var sections sql.NullString
+
+	query := `SELECT record_id, patient_id, doctor_id, visit_date, diagnosis, treatment_plan, COALESCE(template_code, ''), sections FROM MedicalRecords WHERE record_id = ?`
+
+	err := database.ReadDB(ctx).QueryRowContext(ctx, query, id).Scan(
+		&record.RecordID,
+		&record.PatientID,
+		&record.DoctorID,
+		&record.VisitDate,
+		&record.Diagnosis,
+		&record.TreatmentPlan,
+		&record.TemplateCode,
+		&sections,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalSections(&record, sections); err != nil {
+		return nil, err
+	}
+
+	records := []models.MedicalRecord{record}
+	if err := attachDiagnosisCodes(ctx, database.ReadDB(ctx), records); err != nil {
+		return nil, err
+	}
+	if err := attachNoteSummaries(ctx, database.ReadDB(ctx), records); err != nil {
+		return nil, err
+	}
+
+	return &records[0], nil
+}
+
+func (r *SQLiteMedicalRecordRepo) ListByPatient(ctx context.Context, patientID int) ([]models.MedicalRecord, error) {
+	query := "SELECT record_id, patient_id, doctor_id, visit_date, diagnosis, treatment_plan, COALESCE(template_code, ''), sections FROM MedicalRecords WHERE patient_id = ?"
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.MedicalRecord
+	for rows.Next() {
+		var record models.MedicalRecord
+		var sections sql.NullString
+		err := rows.Scan(&record.RecordID, &record.PatientID, &record.DoctorID, &record.VisitDate, &record.Diagnosis, &record.TreatmentPlan,
+			&record.TemplateCode, &sections)
+		if err != nil {
+			return nil, err
+		}
+		if err := unmarshalSections(&record, sections); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := attachDiagnosisCodes(ctx, database.ReadDB(ctx), records); err != nil {
+		return nil, err
+	}
+	if err := attachNoteSummaries(ctx, database.ReadDB(ctx), records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (r *SQLiteMedicalRecordRepo) GetNurseView(ctx context.Context, recordID int) (*models.MedicalRecordNurseView, error) {
+	query := "SELECT record_id, patient_id, visit_date, diagnosis FROM nurse_medical_records_view WHERE record_id = ?"
+	row := database.ReadDB(ctx).QueryRowContext(ctx, query, recordID)
+
+	var record models.MedicalRecordNurseView
+	err := row.Scan(&record.RecordID, &record.PatientID, &record.VisitDate, &record.Diagnosis)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (r *SQLiteMedicalRecordRepo) ListNurseViewByPatient(ctx context.Context, patientID int) ([]models.MedicalRecordNurseView, error) {
+	query := "SELECT record_id, patient_id, visit_date, diagnosis FROM nurse_medical_records_view WHERE patient_id = ?"
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.MedicalRecordNurseView
+	for rows.Next() {
+		var record models.MedicalRecordNurseView
+		err := rows.Scan(&record.RecordID, &record.PatientID, &record.VisitDate, &record.Diagnosis)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (r *SQLiteMedicalRecordRepo) ListNurseView(ctx context.Context, filter MedicalRecordFilter) ([]models.MedicalRecordNurseView, error) {
+	expand := models.Expand{Patient: filter.ExpandPatient}
+	columns, joins := expandJoins(expand, "v.patient_id", "")
+	query := "SELECT v.record_id, v.patient_id, v.visit_date, v.diagnosis" + columns + " FROM nurse_medical_records_view v" + joins
+	var args []any
+	if filter.DoctorIDs != nil {
+		if len(filter.DoctorIDs) == 0 {
+			return []models.MedicalRecordNurseView{}, nil
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(filter.DoctorIDs)), ", ")
+		query += " WHERE v.record_id IN (SELECT record_id FROM MedicalRecords WHERE doctor_id IN (" + placeholders + "))"
+		for _, id := range filter.DoctorIDs {
+			args = append(args, id)
+		}
+	}
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.MedicalRecordNurseView
+	for rows.Next() {
+		var record models.MedicalRecordNurseView
+		expanded := expandedRow{expand: expand}
+		err := rows.Scan(append([]any{&record.RecordID, &record.PatientID, &record.VisitDate, &record.Diagnosis}, expanded.targets()...)...)
+		if err != nil {
+			return nil, err
+		}
+		record.Patient = expanded.patient()
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// marshalSections encodes a templated record's sections for the sections
+// column, NULL for a record without them
+func marshalSections(sections []models.RecordSection) (sql.NullString, error) {
+	if len(sections) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(sections)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+func unmarshalSections(record *models.MedicalRecord, sections sql.NullString) error {
+	if !sections.Valid {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(sections.String), &record.Sections); err != nil {
+		return fmt.Errorf("medical record %d: %w", record.RecordID, err)
+	}
+	return nil
+}
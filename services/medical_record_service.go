@@ -1,164 +1,107 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 
 	"github.com/kinyaelgrande/simple-hospital/database"
 	"github.com/kinyaelgrande/simple-hospital/models"
 )
 
-type MedicalRecordService struct{}
-
-func NewMedicalRecordService() *MedicalRecordService {
-	return &MedicalRecordService{}
+type MedicalRecordService struct {
+	repo MedicalRecordRepo
 }
 
-func (s *MedicalRecordService) CreateMedicalRecord(record *models.MedicalRecord) error {
-	query := `INSERT INTO MedicalRecords (patient_id, doctor_id, visit_date, diagnosis, treatment_plan, doctor_notes)
-              VALUES (?, ?, ?, ?, ?, ?)`
-	result, err := database.GetDB().Exec(query, record.PatientID, record.DoctorID, record.VisitDate, record.Diagnosis,
-		record.TreatmentPlan, record.DoctorNotes)
-	if err != nil {
-		return err
-	}
-
-	id, _ := result.LastInsertId()
-	record.RecordID = int(id)
-	return nil
+func NewMedicalRecordService(repo MedicalRecordRepo) *MedicalRecordService {
+	return &MedicalRecordService{repo: repo}
 }
 
-func (s *MedicalRecordService) GetMedicalRecords() ([]models.MedicalRecord, error) {
-	var records []models.MedicalRecord
-
-	query := `SELECT record_id, patient_id, doctor_id, visit_date, diagnosis, treatment_plan, doctor_notes FROM MedicalRecords`
-
-	rows, err := database.GetDB().Query(query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var record models.MedicalRecord
-		err := rows.Scan(
-			&record.RecordID,
-			&record.PatientID,
-			&record.DoctorID,
-			&record.VisitDate,
-			&record.Diagnosis,
-			&record.TreatmentPlan,
-			&record.DoctorNotes,
-		)
-		if err != nil {
-			return nil, err
-		}
-		records = append(records, record)
+// CreateMedicalRecord stores a record, returning ErrUnknownPatient if its
+// patient doesn't exist. A record written from a template has its sections
+// checked and ordered against it, see applyRecordTemplate.
+func (s *MedicalRecordService) CreateMedicalRecord(ctx context.Context, record *models.MedicalRecord) error {
+	db := database.ReadDB(database.WithPrimaryReads(ctx))
+	var exists int
+	err := db.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, record.PatientID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrUnknownPatient, record.PatientID)
+	} else if err != nil {
+		return err
 	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
+	if err := applyRecordTemplate(ctx, db, record); err != nil {
+		return err
 	}
-
-	return records, nil
+	return s.repo.Create(ctx, record)
 }
 
-func (s *MedicalRecordService) GetMedicalRecord(id int) (*models.MedicalRecord, error) {
-	var record models.MedicalRecord
-
-	query := `SELECT record_id, patient_id, doctor_id, visit_date, diagnosis, treatment_plan, doctor_notes FROM MedicalRecords WHERE record_id = ?`
-
-	err := database.GetDB().QueryRow(query, id).Scan(
-		&record.RecordID,
-		&record.PatientID,
-		&record.DoctorID,
-		&record.VisitDate,
-		&record.Diagnosis,
-		&record.TreatmentPlan,
-		&record.DoctorNotes,
-	)
-	if err != nil {
-		return nil, err
-	}
+func (s *MedicalRecordService) GetMedicalRecords(ctx context.Context) ([]models.MedicalRecord, error) {
+	return s.repo.List(ctx)
+}
 
-	return &record, nil
+func (s *MedicalRecordService) GetMedicalRecord(ctx context.Context, id int) (*models.MedicalRecord, error) {
+	return s.repo.Get(ctx, id)
 }
 
-func (s *MedicalRecordService) GetMedicalRecordsByPatient(patientID int) ([]models.MedicalRecord, error) {
-	query := "SELECT record_id, patient_id, doctor_id, visit_date, diagnosis, treatment_plan, doctor_notes FROM MedicalRecords WHERE patient_id = ?"
-	rows, err := database.GetDB().Query(query, patientID)
+// PatientOf returns the ID of the patient a record is about
+func (s *MedicalRecordService) PatientOf(ctx context.Context, id int) (int, error) {
+	record, err := s.repo.Get(ctx, id)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var records []models.MedicalRecord
-	for rows.Next() {
-		var record models.MedicalRecord
-		err := rows.Scan(&record.RecordID, &record.PatientID, &record.DoctorID, &record.VisitDate, &record.Diagnosis, &record.TreatmentPlan, &record.DoctorNotes)
-		if err != nil {
-			return nil, err
-		}
-		records = append(records, record)
+		return 0, err
 	}
-
-	return records, nil
+	return record.PatientID, nil
 }
 
-func (s *MedicalRecordService) GetNurseRecord(recordID int) (*models.MedicalRecordNurseView, error) {
-	query := "SELECT record_id, patient_id, visit_date, diagnosis FROM nurse_medical_records_view WHERE record_id = ?"
-	row := database.GetDB().QueryRow(query, recordID)
+func (s *MedicalRecordService) GetMedicalRecordsByPatient(ctx context.Context, patientID int) ([]models.MedicalRecord, error) {
+	return s.repo.ListByPatient(ctx, patientID)
+}
 
-	var record models.MedicalRecordNurseView
-	err := row.Scan(&record.RecordID, &record.PatientID, &record.VisitDate, &record.Diagnosis)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no record found with ID %d", recordID)
-		}
-		return nil, err
+func (s *MedicalRecordService) GetNurseRecord(ctx context.Context, recordID int) (*models.MedicalRecordNurseView, error) {
+	record, err := s.repo.GetNurseView(ctx, recordID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no record found with ID %d", recordID)
 	}
-
-	return &record, nil
+	return record, err
 }
 
-func (s *MedicalRecordService) GetNurseRecordsByPatient(patientID int) ([]models.MedicalRecordNurseView, error) {
-	query := "SELECT record_id, patient_id, visit_date, diagnosis FROM nurse_medical_records_view WHERE patient_id = ?"
-	rows, err := database.GetDB().Query(query, patientID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+func (s *MedicalRecordService) GetNurseRecordsByPatient(ctx context.Context, patientID int) ([]models.MedicalRecordNurseView, error) {
+	return s.repo.ListNurseViewByPatient(ctx, patientID)
+}
 
-	var records []models.MedicalRecordNurseView
-	for rows.Next() {
-		var record models.MedicalRecordNurseView
-		err := rows.Scan(&record.RecordID, &record.PatientID, &record.VisitDate, &record.Diagnosis)
+// GetNurseViewRecords lists records in the nurse view, only those written by
+// the doctors assigned to department when it is set, with a summary of each
+// record's patient if expandPatient is set
+func (s *MedicalRecordService) GetNurseViewRecords(ctx context.Context, department string, expandPatient bool) ([]models.MedicalRecordNurseView, error) {
+	filter := MedicalRecordFilter{ExpandPatient: expandPatient}
+	if department != "" {
+		db := database.ReadDB(ctx)
+		if _, err := getDepartment(ctx, db, normalizeDepartment(department)); err != nil {
+			return nil, err
+		}
+		doctors, err := departmentDoctors(ctx, db, department)
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, record)
+		filter.DoctorIDs = doctors
 	}
-
-	return records, nil
+	return s.repo.ListNurseView(ctx, filter)
 }
 
-func (s *MedicalRecordService) GetNurseViewRecords() ([]models.MedicalRecordNurseView, error) {
-	query := "SELECT record_id, patient_id, visit_date, diagnosis FROM nurse_medical_records_view"
-	rows, err := database.GetDB().Query(query)
+// ExportPatientRecords builds a CSV of a patient's medical records, for download
+func (s *MedicalRecordService) ExportPatientRecords(ctx context.Context, patientID int) (*Download, error) {
+	records, err := s.repo.ListByPatient(ctx, patientID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var records []models.MedicalRecordNurseView
-	for rows.Next() {
-		var record models.MedicalRecordNurseView
-		err := rows.Scan(&record.RecordID, &record.PatientID, &record.VisitDate, &record.Diagnosis)
-		if err != nil {
-			return nil, err
-		}
-		records = append(records, record)
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		rows = append(rows, []string{strconv.Itoa(record.RecordID), record.VisitDate, record.Diagnosis,
+			record.TreatmentPlan, record.DoctorNotes, strconv.Itoa(record.DoctorID)})
 	}
 
-	return records, nil
+	return CSVDownload(fmt.Sprintf("patient-%d-medical-records.csv", patientID),
+		[]string{"record_id", "visit_date", "diagnosis", "treatment_plan", "doctor_notes", "doctor_id"}, rows)
 }
@@ -0,0 +1,47 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/fakes"
+)
+
+func TestNurseRecords(t *testing.T) {
+	ctx := context.Background()
+	repo := fakes.NewMedicalRecordRepo()
+	records := services.NewMedicalRecordService(repo)
+	record := &models.MedicalRecord{
+		PatientID:     4,
+		DoctorID:      2,
+		VisitDate:     "2026-03-01",
+		Diagnosis:     "Sprained ankle",
+		TreatmentPlan: "Rest, ice, compression",
+		DoctorNotes:   "Inversion injury playing football",
+	}
+	if err := repo.Create(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	want := models.MedicalRecordNurseView{RecordID: record.RecordID, PatientID: 4, VisitDate: "2026-03-01", Diagnosis: "Sprained ankle"}
+	view, err := records.GetNurseRecord(ctx, record.RecordID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *view != want {
+		t.Fatalf("nurse view %+v, want %+v", *view, want)
+	}
+	views, err := records.GetNurseRecordsByPatient(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(views) != 1 || views[0] != want {
+		t.Fatalf("nurse views of the patient %+v, want [%+v]", views, want)
+	}
+
+	if _, err := records.GetNurseRecord(ctx, record.RecordID+1); err == nil {
+		t.Fatal("an unknown record was found")
+	}
+}
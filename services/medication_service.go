@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/dosage"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// ErrUnknownMedication is returned when a prescription references a
+// medication ID missing from the catalog
+var ErrUnknownMedication = errors.New("medication is not in the medication catalog")
+
+// MedicationService holds the medication catalog prescriptions reference,
+// searches it for typeahead and links free-text prescriptions to it
+type MedicationService struct{}
+
+func NewMedicationService() *MedicationService {
+	return &MedicationService{}
+}
+
+// Search finds up to limit catalog entries for a typeahead: names starting
+// with q come first, then names containing it, each in name order
+func (s *MedicationService) Search(ctx context.Context, q string, limit int) ([]models.Medication, error) {
+	words := escapeLike(strings.ToLower(strings.TrimSpace(q)))
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT medication_id, name, form, strength, route, COALESCE(drug_class, '') FROM Medications
+              WHERE lower(name) LIKE ? ESCAPE '\'
+              ORDER BY CASE WHEN lower(name) LIKE ? ESCAPE '\' THEN 0 ELSE 1 END, lower(name), form, strength
+              LIMIT ?`, "%"+words+"%", words+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	medications := []models.Medication{}
+	for rows.Next() {
+		var medication models.Medication
+		if err := rows.Scan(&medication.MedicationID, &medication.Name, &medication.Form, &medication.Strength, &medication.Route, &medication.DrugClass); err != nil {
+			return nil, err
+		}
+		medications = append(medications, medication)
+	}
+	return medications, rows.Err()
+}
+
+func (s *MedicationService) Get(ctx context.Context, id int) (*models.Medication, error) {
+	var medication models.Medication
+	err := database.ReadDB(ctx).QueryRowContext(ctx, `SELECT medication_id, name, form, strength, route, COALESCE(drug_class, '') FROM Medications WHERE medication_id = ?`, id).
+		Scan(&medication.MedicationID, &medication.Name, &medication.Form, &medication.Strength, &medication.Route, &medication.DrugClass)
+	if err != nil {
+		return nil, err
+	}
+	return &medication, nil
+}
+
+// Create adds a catalog entry with its strength normalized and its form and
+// route lower-cased. An entry that already exists is a unique violation.
+func (s *MedicationService) Create(ctx context.Context, medication *models.Medication) error {
+	medication.Name = strings.TrimSpace(medication.Name)
+	medication.Form = strings.ToLower(strings.TrimSpace(medication.Form))
+	medication.Strength = dosage.NormalizeStrength(strings.TrimSpace(medication.Strength))
+	medication.Route = strings.ToLower(strings.TrimSpace(medication.Route))
+	medication.DrugClass = strings.TrimSpace(medication.DrugClass)
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `INSERT INTO Medications (name, form, strength, route, drug_class) VALUES (?, ?, ?, ?, ?)`,
+			medication.Name, medication.Form, medication.Strength, medication.Route, sql.NullString{String: medication.DrugClass, Valid: medication.DrugClass != ""})
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		medication.MedicationID = int(id)
+		return nil
+	})
+}
+
+// Resolve links a prescription to the catalog and normalizes its dosage.
+// A prescription naming a medication ID takes the entry's name; one with
+// only free text is linked when the text matches exactly one entry.
+func (s *MedicationService) Resolve(ctx context.Context, prescription *models.Prescription) error {
+	prescription.Dosage = dosage.NormalizeStrength(prescription.Dosage)
+
+	if prescription.MedicationID != nil {
+		medication, err := s.Get(database.WithPrimaryReads(ctx), *prescription.MedicationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %d", ErrUnknownMedication, *prescription.MedicationID)
+		} else if err != nil {
+			return err
+		}
+		prescription.Medication = medication.DisplayName()
+		return nil
+	}
+
+	catalog, err := s.entries(ctx)
+	if err != nil {
+		return err
+	}
+	if id, ok := dosage.Match(prescription.Medication, prescription.Dosage, catalog); ok {
+		prescription.MedicationID = &id
+	}
+	return nil
+}
+
+func (s *MedicationService) entries(ctx context.Context) ([]dosage.Entry, error) {
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT medication_id, name, strength FROM Medications`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []dosage.Entry
+	for rows.Next() {
+		var entry dosage.Entry
+		if err := rows.Scan(&entry.ID, &entry.Name, &entry.Strength); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+)
+
+var (
+	// ErrNoteSigned is returned when changing a signed note
+	ErrNoteSigned = errors.New("the note is signed and can't be changed; add an addendum instead")
+	// ErrNoteUnsigned is returned when adding an addendum to a note that can still be edited
+	ErrNoteUnsigned = errors.New("only a signed note can have an addendum; edit the note instead")
+	// ErrNotNoteAuthor is returned when someone other than its author edits or signs a note
+	ErrNotNoteAuthor = errors.New("only the note's author may edit or sign it")
+)
+
+// NoteService keeps the clinical notes on medical records. Bodies are
+// encrypted at rest; the event log and the audit log record who wrote and
+// signed which note, without its text.
+type NoteService struct {
+	events *EventService
+	audit  *AuditService
+}
+
+func NewNoteService() *NoteService {
+	return &NoteService{events: NewEventService(), audit: NewAuditService()}
+}
+
+// GetNotes lists a medical record's notes in the order they were written
+func (s *NoteService) GetNotes(ctx context.Context, recordID int) ([]models.Note, error) {
+	db := database.ReadDB(ctx)
+	if err := checkRecord(ctx, db, recordID); err != nil {
+		return nil, err
+	}
+	return queryNotes(ctx, db, `WHERE n.record_id = ? ORDER BY n.created_at, n.note_id`, recordID)
+}
+
+// AddNote writes an unsigned note by authorID on the record
+func (s *NoteService) AddNote(ctx context.Context, recordID int, note *models.Note, authorID int) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkRecord(ctx, tx, recordID); err != nil {
+			return err
+		}
+		note.RecordID = recordID
+		note.AddendumTo = nil
+		return s.insert(ctx, tx, note, authorID)
+	})
+}
+
+// AddAddendum writes an unsigned note by authorID amending the record's
+// signed note noteID
+func (s *NoteService) AddAddendum(ctx context.Context, recordID, noteID int, addendum *models.Note, authorID int) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		note, err := getNote(ctx, tx, recordID, noteID)
+		if err != nil {
+			return err
+		}
+		if note.SignedAt == nil {
+			return ErrNoteUnsigned
+		}
+		addendum.RecordID = recordID
+		addendum.AddendumTo = &noteID
+		return s.insert(ctx, tx, addendum, authorID)
+	})
+}
+
+// UpdateNote replaces the body of an unsigned note by userID
+func (s *NoteService) UpdateNote(ctx context.Context, recordID, noteID int, body string, userID int) (*models.Note, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := getEditableNote(ctx, tx, recordID, noteID, userID); err != nil {
+			return err
+		}
+		sealed, err := encryption.Seal(encryption.NoteBody, noteID, strings.TrimSpace(body))
+		if err != nil {
+			return err
+		}
+		if err := updateUnsignedNote(ctx, tx, `UPDATE Notes SET body = ?, updated_at = ? WHERE note_id = ? AND signed_at IS NULL`,
+			sealed, time.Now().UTC(), noteID); err != nil {
+			return err
+		}
+		return s.events.Append(ctx, tx, models.ENTITY_NOTE, noteID, models.EVENT_NOTE_UPDATED, map[string]any{"recordId": recordID})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getNote(ctx, database.GetDB(), recordID, noteID)
+}
+
+// SignNote signs an unsigned note by userID, after which it can't change
+func (s *NoteService) SignNote(ctx context.Context, recordID, noteID, userID int) (*models.Note, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		note, err := getEditableNote(ctx, tx, recordID, noteID, userID)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if err := updateUnsignedNote(ctx, tx, `UPDATE Notes SET signed_at = ? WHERE note_id = ? AND signed_at IS NULL`, now, noteID); err != nil {
+			return err
+		}
+		details := map[string]any{"recordId": recordID, "addendumTo": note.AddendumTo, "signedAt": now}
+		if err := s.events.Append(ctx, tx, models.ENTITY_NOTE, noteID, models.EVENT_NOTE_SIGNED, details); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_NOTE_SIGNED, models.ENTITY_NOTE, noteID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return getNote(ctx, database.GetDB(), recordID, noteID)
+}
+
+func (s *NoteService) insert(ctx context.Context, tx *sql.Tx, note *models.Note, authorID int) error {
+	if err := insertNote(ctx, tx, note, authorID); err != nil {
+		return err
+	}
+	details := map[string]any{"recordId": note.RecordID, "authorId": authorID, "addendumTo": note.AddendumTo}
+	return s.events.Append(ctx, tx, models.ENTITY_NOTE, note.NoteID, models.EVENT_NOTE_ADDED, details)
+}
+
+// insertNote stores an unsigned note by authorID, setting its ID, author and
+// creation time
+func insertNote(ctx context.Context, tx *sql.Tx, note *models.Note, authorID int) error {
+	note.Body = strings.TrimSpace(note.Body)
+	note.CreatedAt = time.Now().UTC()
+	note.UpdatedAt, note.SignedAt = nil, nil
+	result, err := tx.ExecContext(ctx, `INSERT INTO Notes (record_id, author_id, body, addendum_to, created_at) VALUES (?, ?, '', ?, ?)`,
+		note.RecordID, authorID, note.AddendumTo, note.CreatedAt)
+	if err != nil {
+		return err
+	}
+	id, _ := result.LastInsertId()
+	note.NoteID = int(id)
+	if err := encryption.Store(ctx, tx, encryption.NoteBody, note.NoteID, note.Body); err != nil {
+		return err
+	}
+
+	return tx.QueryRowContext(ctx, `SELECT user_id, full_name, role FROM Users WHERE user_id = ?`, authorID).
+		Scan(&note.Author.ID, &note.Author.FullName, &note.Author.Role)
+}
+
+// getNote returns the record's note noteID, or sql.ErrNoRows
+func getNote(ctx context.Context, q querier, recordID, noteID int) (*models.Note, error) {
+	notes, err := queryNotes(ctx, q, `WHERE n.note_id = ? AND n.record_id = ?`, noteID, recordID)
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &notes[0], nil
+}
+
+// getEditableNote returns the record's note noteID if userID may still
+// change it: it is theirs and unsigned
+func getEditableNote(ctx context.Context, q querier, recordID, noteID, userID int) (*models.Note, error) {
+	note, err := getNote(ctx, q, recordID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if note.SignedAt != nil {
+		return nil, ErrNoteSigned
+	}
+	if note.Author.ID != userID {
+		return nil, ErrNotNoteAuthor
+	}
+	return note, nil
+}
+
+// updateUnsignedNote runs an update guarded by signed_at IS NULL, failing
+// with ErrNoteSigned when the note was signed since it was read
+func updateUnsignedNote(ctx context.Context, tx *sql.Tx, query string, args ...any) error {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNoteSigned
+	}
+	return nil
+}
+
+func queryNotes(ctx context.Context, q querier, clause string, args ...any) ([]models.Note, error) {
+	query := `SELECT n.note_id, n.record_id, u.user_id, u.full_name, u.role, n.body, n.addendum_to, n.created_at, n.updated_at, n.signed_at
+              FROM Notes n JOIN Users u ON u.user_id = n.author_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []models.Note{}
+	for rows.Next() {
+		var note models.Note
+		var addendumTo sql.NullInt64
+		var updatedAt, signedAt sql.NullTime
+		err := rows.Scan(&note.NoteID, &note.RecordID, &note.Author.ID, &note.Author.FullName, &note.Author.Role, &note.Body,
+			&addendumTo, &note.CreatedAt, &updatedAt, &signedAt)
+		if err != nil {
+			return nil, err
+		}
+		if note.Body, err = encryption.Open(encryption.NoteBody, note.NoteID, note.Body); err != nil {
+			return nil, err
+		}
+		if addendumTo.Valid {
+			id := int(addendumTo.Int64)
+			note.AddendumTo = &id
+		}
+		if updatedAt.Valid {
+			note.UpdatedAt = &updatedAt.Time
+		}
+		if signedAt.Valid {
+			note.SignedAt = &signedAt.Time
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// attachNoteSummaries sets each record's DoctorNotes to the bodies of its
+// notes, addenda included, in the order they were written
+func attachNoteSummaries(ctx context.Context, q querier, records []models.MedicalRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	args := make([]any, len(records))
+	byID := map[int]*models.MedicalRecord{}
+	for i := range records {
+		records[i].DoctorNotes = ""
+		args[i] = records[i].RecordID
+		byID[records[i].RecordID] = &records[i]
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+	rows, err := q.QueryContext(ctx, `SELECT note_id, record_id, body FROM Notes
+              WHERE record_id IN (`+placeholders+`) ORDER BY record_id, created_at, note_id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteID, recordID int
+		var body string
+		if err := rows.Scan(&noteID, &recordID, &body); err != nil {
+			return err
+		}
+		if body, err = encryption.Open(encryption.NoteBody, noteID, body); err != nil {
+			return err
+		}
+		record := byID[recordID]
+		if record.DoctorNotes != "" {
+			record.DoctorNotes += "\n\n"
+		}
+		record.DoctorNotes += body
+	}
+	return rows.Err()
+}
+
+// checkRecord returns sql.ErrNoRows for an unknown medical record
+func checkRecord(ctx context.Context, db queryRower, recordID int) error {
+	var exists int
+	return db.QueryRowContext(ctx, `SELECT 1 FROM MedicalRecords WHERE record_id = ?`, recordID).Scan(&exists)
+}
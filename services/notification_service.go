@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+)
+
+// ErrNotificationState is returned when retrying a notification that hasn't failed
+var ErrNotificationState = errors.New("only failed notifications can be retried")
+
+const (
+	// notificationBatchSize bounds how many notifications one poll sends
+	notificationBatchSize = 20
+	// notificationLease is how long a claimed notification is reserved for
+	// the worker sending it; after that another worker may retry it
+	notificationLease = 5 * time.Minute
+	// maxNotificationBackoff caps the delay between retries
+	maxNotificationBackoff = time.Hour
+)
+
+// NotificationService queues notifications in the Notifications table and
+// delivers them from a worker goroutine started with Run. Queueing takes the
+// caller's transaction, so a notification is only sent if the change it
+// announces commits.
+type NotificationService struct {
+	providers          map[string]notifications.Provider
+	securityRecipients []notifications.Recipient
+	maxAttempts        int
+}
+
+// NewNotificationService sends through providers, keyed by channel, and
+// sends security alerts to securityRecipients. Failed sends are retried
+// until maxAttempts have been made.
+func NewNotificationService(providers map[string]notifications.Provider, securityRecipients []notifications.Recipient, maxAttempts int) *NotificationService {
+	return &NotificationService{
+		providers:          providers,
+		securityRecipients: securityRecipients,
+		maxAttempts:        max(maxAttempts, 1),
+	}
+}
+
+// Enqueue queues a notification to be sent at or after sendAt. Nothing is
+// queued for a channel without a provider or a blank recipient.
+func (s *NotificationService) Enqueue(ctx context.Context, exec execer, n *models.Notification, sendAt time.Time) error {
+	if s == nil || n.Recipient == "" || s.providers[n.Channel] == nil {
+		return nil
+	}
+
+	n.Status = models.NOTIFICATION_STATUS_PENDING
+	n.CreatedAt = time.Now().UTC()
+	n.NextAttemptAt = sendAt.UTC()
+	if n.NextAttemptAt.Before(n.CreatedAt) {
+		n.NextAttemptAt = n.CreatedAt
+	}
+
+	query := `INSERT INTO Notifications (kind, channel, recipient, subject, body, entity_type, entity_id, status, attempts, next_attempt_at, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?)`
+	result, err := exec.ExecContext(ctx, query, n.Kind, n.Channel, n.Recipient, n.Subject, n.Body, n.EntityType, n.EntityID,
+		n.Status, n.NextAttemptAt, n.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to queue notification: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	n.NotificationID = int(id)
+	return nil
+}
+
+// CancelPending cancels the unsent notifications of a kind about an entity,
+// e.g. the reminder for a cancelled appointment, returning how many it cancelled
+func (s *NotificationService) CancelPending(ctx context.Context, exec execer, kind, entityType string, entityID int) (int64, error) {
+	query := `UPDATE Notifications SET status = ?
+              WHERE kind = ? AND entity_type = ? AND entity_id = ? AND status = ?`
+	result, err := exec.ExecContext(ctx, query, models.NOTIFICATION_STATUS_CANCELLED, kind, entityType, entityID, models.NOTIFICATION_STATUS_PENDING)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SecurityAlert notifies the configured security recipients straight away.
+// Failing to queue an alert is logged rather than failing the action that
+// raised it.
+func (s *NotificationService) SecurityAlert(ctx context.Context, subject, body string) {
+	if s == nil {
+		return
+	}
+	for _, recipient := range s.securityRecipients {
+		n := &models.Notification{
+			Kind:      models.NOTIFICATION_SECURITY_ALERT,
+			Channel:   recipient.Channel,
+			Recipient: recipient.Address,
+			Subject:   subject,
+			Body:      body,
+		}
+		if err := s.Enqueue(ctx, database.GetDB(), n, time.Now()); err != nil {
+			slog.Error("Failed to queue security alert", "subject", subject, "error", err)
+		}
+	}
+}
+
+// GetNotifications lists the most recent notifications, optionally with one status
+func (s *NotificationService) GetNotifications(ctx context.Context, status string, limit int) ([]models.Notification, error) {
+	if status == "" {
+		return s.queryNotifications(ctx, `ORDER BY notification_id DESC LIMIT ?`, limit)
+	}
+	return s.queryNotifications(ctx, `WHERE status = ? ORDER BY notification_id DESC LIMIT ?`, status, limit)
+}
+
+// Retry requeues a failed notification for immediate delivery
+func (s *NotificationService) Retry(ctx context.Context, id int) (*models.Notification, error) {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE Notifications SET status = ?, attempts = 0, next_attempt_at = ?
+              WHERE notification_id = ? AND status = ?`,
+		models.NOTIFICATION_STATUS_PENDING, time.Now().UTC(), id, models.NOTIFICATION_STATUS_FAILED)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications, err := s.queryNotifications(database.WithPrimaryReads(ctx), `WHERE notification_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(notifications) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrNotificationState
+	}
+	return &notifications[0], nil
+}
+
+// Run delivers due notifications every interval until ctx is cancelled
+func (s *NotificationService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sent, err := s.deliverDue(ctx)
+			if err != nil {
+				slog.Error("Notification delivery failed", "error", err)
+			}
+			// A full batch means more are probably waiting
+			if err != nil || sent < notificationBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue claims and sends one batch of due notifications, returning how
+// many it attempted
+func (s *NotificationService) deliverDue(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	// Notifications left "sending" by a worker that died are picked up again
+	// once their lease runs out
+	due, err := s.queryNotifications(database.WithPrimaryReads(ctx), `WHERE status IN (?, ?) AND next_attempt_at <= ?
+              ORDER BY next_attempt_at LIMIT ?`,
+		models.NOTIFICATION_STATUS_PENDING, models.NOTIFICATION_STATUS_SENDING, now, notificationBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, n := range due {
+		claimed, err := s.claim(ctx, n.NotificationID, now)
+		if err != nil {
+			return 0, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := s.deliver(ctx, n); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// claim reserves a notification for this worker by pushing its next attempt
+// past the lease
+func (s *NotificationService) claim(ctx context.Context, id int, now time.Time) (bool, error) {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE Notifications SET status = ?, next_attempt_at = ?
+              WHERE notification_id = ? AND status IN (?, ?) AND next_attempt_at <= ?`,
+		models.NOTIFICATION_STATUS_SENDING, now.Add(notificationLease), id,
+		models.NOTIFICATION_STATUS_PENDING, models.NOTIFICATION_STATUS_SENDING, now)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// deliver sends a claimed notification and records the outcome
+func (s *NotificationService) deliver(ctx context.Context, n models.Notification) error {
+	attempts := n.Attempts + 1
+
+	var sendErr error
+	provider := s.providers[n.Channel]
+	if provider == nil {
+		sendErr = notifications.Permanent(fmt.Errorf("no %s provider is configured", n.Channel))
+	} else {
+		sendCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		sendErr = provider.Send(sendCtx, notifications.Message{
+			Kind:    n.Kind,
+			Channel: n.Channel,
+			To:      n.Recipient,
+			Subject: n.Subject,
+			Body:    n.Body,
+		})
+		cancel()
+	}
+
+	now := time.Now().UTC()
+	if sendErr == nil {
+		_, err := database.GetDB().ExecContext(ctx, `UPDATE Notifications SET status = ?, attempts = ?, sent_at = ?, last_error = NULL
+                  WHERE notification_id = ?`, models.NOTIFICATION_STATUS_SENT, attempts, now, n.NotificationID)
+		return err
+	}
+
+	status, next := models.NOTIFICATION_STATUS_PENDING, now.Add(notificationBackoff(attempts))
+	if notifications.IsPermanent(sendErr) || attempts >= s.maxAttempts {
+		status, next = models.NOTIFICATION_STATUS_FAILED, now
+		slog.Warn("Notification failed", "id", n.NotificationID, "kind", n.Kind, "channel", n.Channel, "attempts", attempts, "error", sendErr)
+	}
+	_, err := database.GetDB().ExecContext(ctx, `UPDATE Notifications SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?
+              WHERE notification_id = ?`, status, attempts, next, sendErr.Error(), n.NotificationID)
+	return err
+}
+
+// notificationBackoff doubles the delay after each failed attempt, from 30
+// seconds up to an hour
+func notificationBackoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < maxNotificationBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxNotificationBackoff)
+}
+
+func (s *NotificationService) queryNotifications(ctx context.Context, clause string, args ...any) ([]models.Notification, error) {
+	query := `SELECT notification_id, kind, channel, recipient, COALESCE(subject, ''), body, COALESCE(entity_type, ''),
+                  COALESCE(entity_id, 0), status, attempts, next_attempt_at, COALESCE(last_error, ''), created_at, sent_at
+              FROM Notifications ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.NotificationID, &n.Kind, &n.Channel, &n.Recipient, &n.Subject, &n.Body, &n.EntityType,
+			&n.EntityID, &n.Status, &n.Attempts, &n.NextAttemptAt, &n.LastError, &n.CreatedAt, &n.SentAt); err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,122 @@
+// Package notifications delivers messages to people outside the app by
+// email (SMTP), SMS (a Twilio-style HTTP API) or a webhook. Messages are
+// queued in the database and sent by NotificationService's worker, so
+// callers never wait on a provider.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ChannelEmail   = "email"
+	ChannelSMS     = "sms"
+	ChannelWebhook = "webhook"
+)
+
+// Message is one notification to one recipient. To is an email address for
+// email, a phone number in E.164 form for SMS and a free-form label (such as
+// a chat channel) passed through to the webhook.
+type Message struct {
+	Kind    string
+	Channel string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Provider sends messages on one channel
+type Provider interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// permanentError wraps failures that retrying can't fix, such as a
+// rejected phone number
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Options configures the providers. A channel whose settings are empty has
+// no provider and its notifications are not queued.
+type Options struct {
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// SMSBaseURL defaults to Twilio's API
+	SMSBaseURL    string
+	SMSAccountSID string
+	SMSAuthToken  string
+	SMSFrom       string
+
+	WebhookURL string
+	// WebhookSecret signs webhook bodies; empty sends them unsigned
+	WebhookSecret string
+}
+
+// Open creates a provider for every configured channel
+func Open(opts Options) (map[string]Provider, error) {
+	providers := map[string]Provider{}
+	if opts.SMTPAddr != "" {
+		if opts.SMTPFrom == "" {
+			return nil, errors.New("SMTP notifications need a from address")
+		}
+		providers[ChannelEmail] = NewSMTPProvider(opts.SMTPAddr, opts.SMTPUsername, opts.SMTPPassword, opts.SMTPFrom)
+	}
+	if opts.SMSAccountSID != "" {
+		if opts.SMSAuthToken == "" || opts.SMSFrom == "" {
+			return nil, errors.New("SMS notifications need an auth token and a from number")
+		}
+		providers[ChannelSMS] = NewSMSProvider(opts.SMSBaseURL, opts.SMSAccountSID, opts.SMSAuthToken, opts.SMSFrom)
+	}
+	if opts.WebhookURL != "" {
+		providers[ChannelWebhook] = NewWebhookProvider(opts.WebhookURL, opts.WebhookSecret)
+	}
+	return providers, nil
+}
+
+// Recipient is a channel and an address on it
+type Recipient struct {
+	Channel string
+	Address string
+}
+
+// ParseRecipients reads "channel:address" entries separated by commas, e.g.
+// "email:security@example.org,sms:+15550100,webhook:#security"
+func ParseRecipients(value string) ([]Recipient, error) {
+	var recipients []Recipient
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		channel, address, ok := strings.Cut(entry, ":")
+		address = strings.TrimSpace(address)
+		switch channel = strings.TrimSpace(channel); {
+		case !ok || address == "":
+			return nil, fmt.Errorf("invalid recipient %q, want channel:address", entry)
+		case channel != ChannelEmail && channel != ChannelSMS && channel != ChannelWebhook:
+			return nil, fmt.Errorf("invalid recipient %q: unknown channel %q", entry, channel)
+		}
+		recipients = append(recipients, Recipient{Channel: channel, Address: address})
+	}
+	return recipients, nil
+}
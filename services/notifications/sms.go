@@ -0,0 +1,64 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultSMSBaseURL = "https://api.twilio.com"
+
+// SMSProvider sends text messages through a Twilio-compatible API:
+// POST {base}/2010-04-01/Accounts/{sid}/Messages.json with a From, To and
+// Body form, authenticated with the account SID and auth token
+type SMSProvider struct {
+	endpoint   string
+	accountSID string
+	authToken  string
+	from       string
+	client     *http.Client
+}
+
+func NewSMSProvider(baseURL, accountSID, authToken, from string) *SMSProvider {
+	if baseURL == "" {
+		baseURL = defaultSMSBaseURL
+	}
+	return &SMSProvider{
+		endpoint:   strings.TrimSuffix(baseURL, "/") + "/2010-04-01/Accounts/" + url.PathEscape(accountSID) + "/Messages.json",
+		accountSID: accountSID,
+		authToken:  authToken,
+		from:       from,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *SMSProvider) Send(ctx context.Context, msg Message) error {
+	form := url.Values{"From": {p.from}, "To": {msg.To}, "Body": {msg.Body}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.accountSID, p.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("SMS provider returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	// Other 4xx responses reject the message itself, e.g. an invalid number
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SignatureHeader carries "sha256=<hex HMAC of timestamp.body>" when a
+// webhook secret is configured; TimestampHeader carries the Unix timestamp
+// so receivers can reject replays
+const (
+	SignatureHeader = "X-Hospital-Signature"
+	TimestampHeader = "X-Hospital-Timestamp"
+)
+
+// WebhookProvider POSTs each message as JSON to a fixed URL, e.g. a chat
+// integration or an on-call paging system
+type WebhookProvider struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookProvider(url, secret string) *WebhookProvider {
+	return &WebhookProvider{url: url, secret: secret, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+type webhookPayload struct {
+	Kind    string    `json:"kind"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject,omitempty"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sentAt"`
+}
+
+func (p *WebhookProvider) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(webhookPayload{Kind: msg.Kind, To: msg.To, Subject: msg.Subject, Body: msg.Body, SentAt: time.Now().UTC()})
+	if err != nil {
+		return Permanent(err)
+	}
+
+	if _, err := PostSigned(ctx, p.client, p.url, p.secret, body); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PostSigned POSTs body as JSON to url, signed with secret unless it is
+// empty, and returns the response status, zero if there was no response. A
+// status other than 2xx is an error. A URL that can't be requested is a
+// permanent error.
+func PostSigned(ctx context.Context, client *http.Client, url, secret string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
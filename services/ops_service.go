@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// ErrUnknownOpsAction is returned by Run for unregistered action names
+var ErrUnknownOpsAction = errors.New("unknown ops action")
+
+// OpsAction is a safe remediation on-call staff can trigger over the API
+type OpsAction struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	run         func(ctx context.Context) (any, error)
+}
+
+// OpsService is the registry of remediations exposed under /api/admin/ops.
+// Subsystems register their own actions (e.g. key rotation, webhook
+// re-delivery) when they are wired up in main.
+type OpsService struct {
+	actions map[string]OpsAction
+	caches  map[string]func()
+	audit   *AuditService
+	mutex   sync.RWMutex
+}
+
+func NewOpsService() *OpsService {
+	s := &OpsService{
+		actions: make(map[string]OpsAction),
+		caches:  make(map[string]func()),
+		audit:   NewAuditService(),
+	}
+
+	s.Register("recycle-db-connections", "Close idle database connections so new ones are opened", s.recycleDBConnections)
+	s.Register("flush-caches", "Flush every registered in-memory cache", s.flushCaches)
+	s.Register("reset-query-stats", "Discard the database query stats so they count from now", s.resetQueryStats)
+	return s
+}
+
+// Register adds a remediation; registering the same name twice replaces it
+func (s *OpsService) Register(name, description string, run func(ctx context.Context) (any, error)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.actions[name] = OpsAction{Name: name, Description: description, run: run}
+}
+
+// RegisterCache adds a cache emptied by the flush-caches action
+func (s *OpsService) RegisterCache(name string, flush func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.caches[name] = flush
+}
+
+// Actions lists the available remediations sorted by name
+func (s *OpsService) Actions() []OpsAction {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	actions := make([]OpsAction, 0, len(s.actions))
+	for _, action := range s.actions {
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Name < actions[j].Name })
+	return actions
+}
+
+// Run performs a remediation and audit-logs who ran it and the outcome.
+// It returns ErrUnknownOpsAction if no action has that name.
+func (s *OpsService) Run(ctx context.Context, name string, userID int) (any, error) {
+	s.mutex.RLock()
+	action, exists := s.actions[name]
+	s.mutex.RUnlock()
+	if !exists {
+		return nil, ErrUnknownOpsAction
+	}
+
+	result, runErr := action.run(ctx)
+
+	details := map[string]any{"result": result}
+	if runErr != nil {
+		details["error"] = runErr.Error()
+	}
+	if err := s.audit.Log(ctx, database.GetDB(), userID, models.AUDIT_OPS_PREFIX+name, "", 0, details); err != nil {
+		return result, err
+	}
+
+	return result, runErr
+}
+
+func (s *OpsService) recycleDBConnections(ctx context.Context) (any, error) {
+	db := database.GetDB()
+	before := db.Stats()
+
+	// Dropping the idle pool to zero closes idle connections immediately;
+	// in-use connections are returned to a fresh pool when released
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(database.PoolOptions().MaxIdleConns)
+
+	if err := db.PingContext(ctx); err != nil {
+		return nil, fmt.Errorf("database unreachable after recycle: %v", err)
+	}
+
+	after := db.Stats()
+	return map[string]any{
+		"closedIdle":      before.Idle,
+		"openBefore":      before.OpenConnections,
+		"openAfter":       after.OpenConnections,
+		"inUseDuringSwap": before.InUse,
+	}, nil
+}
+
+func (s *OpsService) flushCaches(ctx context.Context) (any, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	flushed := []string{}
+	for name, flush := range s.caches {
+		flush()
+		flushed = append(flushed, name)
+	}
+	sort.Strings(flushed)
+	return map[string]any{"flushed": flushed}, nil
+}
+
+func (s *OpsService) resetQueryStats(ctx context.Context) (any, error) {
+	return map[string]any{"statementsDiscarded": database.ResetQueryStats()}, nil
+}
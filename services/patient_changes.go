@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// patientDemographics returns the patient's tracked fields as stored, to
+// compare an edit against
+func patientDemographics(ctx context.Context, q queryRower, id int) (*models.Patient, error) {
+	var patient models.Patient
+	err := q.QueryRowContext(ctx, `SELECT first_name, last_name, COALESCE(date_of_birth, ''), COALESCE(gender, ''),
+                  COALESCE(contact_info, ''), COALESCE(address, ''), COALESCE(emergency_contact, ''),
+                  COALESCE(preferred_language, ''), interpreter_required
+              FROM Patients WHERE patient_id = ? AND NOT synthetic`, id).Scan(&patient.FirstName, &patient.LastName,
+		&patient.DateOfBirth, &patient.Gender, &patient.ContactInfo, &patient.Address, &patient.EmergencyContact,
+		&patient.PreferredLanguage, &patient.InterpreterRequired)
+	if err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+// diffPatient lists the tracked fields that differ between before and
+// after, by their JSON names
+func diffPatient(before, after *models.Patient) []models.PatientChange {
+	var changes []models.PatientChange
+	compare := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, models.PatientChange{Field: field, OldValue: old, NewValue: new})
+		}
+	}
+	compare("firstName", before.FirstName, after.FirstName)
+	compare("lastName", before.LastName, after.LastName)
+	compare("dateOfBirth", before.DateOfBirth, after.DateOfBirth)
+	compare("gender", before.Gender, after.Gender)
+	compare("phone", before.ContactInfo, after.ContactInfo)
+	compare("address", before.Address, after.Address)
+	compare("emergencyContact", before.EmergencyContact, after.EmergencyContact)
+	compare("preferredLanguage", before.PreferredLanguage, after.PreferredLanguage)
+	compare("interpreterRequired", strconv.FormatBool(before.InterpreterRequired), strconv.FormatBool(after.InterpreterRequired))
+	return changes
+}
+
+// recordPatientChanges stores the tracked fields changed from before to
+// after, within the transaction that changes them
+func recordPatientChanges(ctx context.Context, tx *sql.Tx, patientID int, before, after *models.Patient, changedBy int) error {
+	now := time.Now().UTC()
+	for _, change := range diffPatient(before, after) {
+		_, err := tx.ExecContext(ctx, `INSERT INTO PatientChanges (patient_id, field, old_value, new_value, changed_by, changed_at)
+              VALUES (?, ?, ?, ?, ?, ?)`, patientID, change.Field, change.OldValue, change.NewValue, changedBy, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrFlagTypeHidden is returned when the caller's role may not see a flag type
+	ErrFlagTypeHidden = errors.New("flag type is not visible to your role")
+	// ErrFlagTypeInactive is returned when raising a flag of a retired type
+	ErrFlagTypeInactive = errors.New("flag type is no longer in use")
+	// ErrFlagRaised is returned when the patient already has an active flag of the type
+	ErrFlagRaised = errors.New("patient already has this flag")
+	// ErrFlagRemoved is returned when removing a flag that was already removed
+	ErrFlagRemoved = errors.New("flag has already been removed")
+)
+
+// PatientFlagService manages risk and care flags on patients. Each flag type
+// is visible only to the roles configured on it, and raising or removing a
+// flag is audited.
+type PatientFlagService struct {
+	audit *AuditService
+}
+
+func NewPatientFlagService() *PatientFlagService {
+	return &PatientFlagService{audit: NewAuditService()}
+}
+
+// GetFlagTypes lists every flag type, including retired ones
+func (s *PatientFlagService) GetFlagTypes(ctx context.Context) ([]models.PatientFlagType, error) {
+	return queryFlagTypes(ctx, database.ReadDB(ctx), `ORDER BY code`)
+}
+
+// SaveFlagType creates a flag type or updates the one with the same code
+func (s *PatientFlagService) SaveFlagType(ctx context.Context, flagType *models.PatientFlagType, userID int) error {
+	roles := []string{}
+	for _, role := range flagType.VisibleRoles {
+		if canonical, ok := models.CanonicalRole(role); ok && !slices.Contains(roles, canonical) {
+			roles = append(roles, canonical)
+		}
+	}
+	flagType.Code = strings.ToLower(strings.TrimSpace(flagType.Code))
+	flagType.VisibleRoles = roles
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO PatientFlagTypes (code, label, description, visible_roles, active) VALUES (?, ?, ?, ?, ?)
+                  ON CONFLICT (code) DO UPDATE SET label = excluded.label, description = excluded.description,
+                      visible_roles = excluded.visible_roles, active = excluded.active`
+		if _, err := tx.ExecContext(ctx, query, flagType.Code, flagType.Label, flagType.Description,
+			strings.Join(flagType.VisibleRoles, ","), flagType.Active); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_FLAG_TYPE_SAVED, "", 0, flagType)
+	})
+}
+
+// GetFlags lists the flags on a patient that role may see, newest first.
+// Removed flags are only included when includeRemoved is set.
+func (s *PatientFlagService) GetFlags(ctx context.Context, patientID int, role string, includeRemoved bool) ([]models.PatientFlag, error) {
+	db := database.ReadDB(ctx)
+	if err := checkPatient(ctx, db, patientID); err != nil {
+		return nil, err
+	}
+
+	clause := `WHERE f.patient_id = ? AND f.removed_at IS NULL ORDER BY f.added_at DESC, f.flag_id DESC`
+	if includeRemoved {
+		clause = `WHERE f.patient_id = ? ORDER BY f.added_at DESC, f.flag_id DESC`
+	}
+	return queryFlags(ctx, db, role, clause, patientID)
+}
+
+// AddFlag raises a flag on a patient. The caller's role must be able to see
+// the flag type.
+func (s *PatientFlagService) AddFlag(ctx context.Context, flag *models.PatientFlag, role string) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkPatient(ctx, tx, flag.PatientID); err != nil {
+			return err
+		}
+
+		flagTypes, err := queryFlagTypes(ctx, tx, `WHERE code = ?`, flag.Type)
+		if err != nil {
+			return err
+		}
+		if len(flagTypes) == 0 || !flagTypes[0].VisibleTo(role) {
+			return ErrFlagTypeHidden
+		}
+		if !flagTypes[0].Active {
+			return ErrFlagTypeInactive
+		}
+
+		var raised int
+		err = tx.QueryRowContext(ctx, `SELECT 1 FROM PatientFlags WHERE patient_id = ? AND flag_type = ? AND removed_at IS NULL`,
+			flag.PatientID, flag.Type).Scan(&raised)
+		if err == nil {
+			return ErrFlagRaised
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		flag.Label = flagTypes[0].Label
+		flag.AddedAt = time.Now().UTC()
+		result, err := tx.ExecContext(ctx, `INSERT INTO PatientFlags (patient_id, flag_type, note, added_by, added_at) VALUES (?, ?, ?, ?, ?)`,
+			flag.PatientID, flag.Type, flag.Note, flag.AddedBy, flag.AddedAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		flag.FlagID = int(id)
+
+		details := map[string]any{"patientId": flag.PatientID, "type": flag.Type, "note": flag.Note}
+		return s.audit.Log(ctx, tx, flag.AddedBy, models.AUDIT_PATIENT_FLAG_ADDED, models.ENTITY_PATIENT_FLAG, flag.FlagID, details)
+	})
+}
+
+// RemoveFlag takes a flag down, recording who removed it and why. Flags the
+// caller's role can't see are reported as not found.
+func (s *PatientFlagService) RemoveFlag(ctx context.Context, patientID, flagID, userID int, role, reason string) (*models.PatientFlag, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		flags, err := queryFlags(ctx, tx, role, `WHERE f.flag_id = ? AND f.patient_id = ?`, flagID, patientID)
+		if err != nil {
+			return err
+		}
+		if len(flags) == 0 {
+			return sql.ErrNoRows
+		}
+		if flags[0].RemovedAt != nil {
+			return ErrFlagRemoved
+		}
+
+		query := `UPDATE PatientFlags SET removed_by = ?, removed_at = ?, removal_reason = ? WHERE flag_id = ?`
+		if _, err := tx.ExecContext(ctx, query, userID, time.Now().UTC(), reason, flagID); err != nil {
+			return err
+		}
+
+		details := map[string]any{"patientId": patientID, "type": flags[0].Type, "reason": reason}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_PATIENT_FLAG_REMOVED, models.ENTITY_PATIENT_FLAG, flagID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	flags, err := queryFlags(database.WithPrimaryReads(ctx), database.GetDB(), role, `WHERE f.flag_id = ?`, flagID)
+	if err != nil {
+		return nil, err
+	}
+	if len(flags) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &flags[0], nil
+}
+
+// checkPatient returns sql.ErrNoRows if the patient doesn't exist
+func checkPatient(ctx context.Context, db queryRower, patientID int) error {
+	var exists int
+	return db.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, patientID).Scan(&exists)
+}
+
+func queryFlagTypes(ctx context.Context, db querier, clause string, args ...any) ([]models.PatientFlagType, error) {
+	query := `SELECT code, label, COALESCE(description, ''), visible_roles, active FROM PatientFlagTypes ` + clause
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.PatientFlagType{}
+	for rows.Next() {
+		var t models.PatientFlagType
+		var roles string
+		if err := rows.Scan(&t.Code, &t.Label, &t.Description, &roles, &t.Active); err != nil {
+			return nil, err
+		}
+		t.VisibleRoles = strings.Split(roles, ",")
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// queryFlags returns the matching flags whose type role may see
+func queryFlags(ctx context.Context, db querier, role, clause string, args ...any) ([]models.PatientFlag, error) {
+	query := `SELECT f.flag_id, f.patient_id, f.flag_type, t.label, t.visible_roles, COALESCE(f.note, ''), f.added_by, f.added_at,
+                  f.removed_by, f.removed_at, COALESCE(f.removal_reason, '')
+              FROM PatientFlags f
+              JOIN PatientFlagTypes t ON t.code = f.flag_type ` + clause
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.PatientFlag{}
+	for rows.Next() {
+		var f models.PatientFlag
+		var roles string
+		if err := rows.Scan(&f.FlagID, &f.PatientID, &f.Type, &f.Label, &roles, &f.Note, &f.AddedBy, &f.AddedAt,
+			&f.RemovedBy, &f.RemovedAt, &f.RemovalReason); err != nil {
+			return nil, err
+		}
+		flagType := models.PatientFlagType{VisibleRoles: strings.Split(roles, ",")}
+		if !flagType.VisibleTo(role) {
+			continue
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/storage"
+)
+
+var (
+	// ErrUnsupportedImageType is returned for patient images that aren't a
+	// JPEG, PNG or GIF
+	ErrUnsupportedImageType = errors.New("patient images must be JPEG, PNG or GIF files")
+	// ErrImageDimensions is returned for images with more pixels than
+	// maxImagePixels, which would take too much memory to decode
+	ErrImageDimensions = errors.New("image dimensions are too large")
+)
+
+const (
+	// maxImagePixels caps the width times height of a patient image, about
+	// a 48-megapixel camera's
+	maxImagePixels = 50_000_000
+	// thumbnailSize is the longest side of a thumbnail, in pixels
+	thumbnailSize = 160
+)
+
+// PatientImageService keeps each patient's photo and ID document scan with
+// a thumbnail of each: metadata in the database and the files in the
+// document store
+type PatientImageService struct {
+	store storage.Store
+	audit *AuditService
+}
+
+func NewPatientImageService(store storage.Store) *PatientImageService {
+	return &PatientImageService{
+		store: store,
+		audit: NewAuditService(),
+	}
+}
+
+// Save stores data as the patient's image of img.Kind, replacing any they
+// had. ContentType, size, dimensions and checksum are derived from data.
+func (s *PatientImageService) Save(ctx context.Context, img *models.PatientImage, data []byte) error {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ErrUnsupportedImageType
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return ErrImageDimensions
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ErrUnsupportedImageType
+	}
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, thumbnailOf(decoded), &jpeg.Options{Quality: 85}); err != nil {
+		return err
+	}
+
+	var exists int
+	if err := database.GetDB().QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, img.PatientID).Scan(&exists); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+
+	img.ContentType = "image/" + format
+	img.SizeBytes = int64(len(data))
+	img.Width, img.Height = config.Width, config.Height
+	img.SHA256 = hex.EncodeToString(sum[:])
+	img.StorageKey = fmt.Sprintf("patients/%d/%s-%s", img.PatientID, img.Kind, hex.EncodeToString(suffix))
+	img.ThumbnailKey = img.StorageKey + "-thumbnail"
+	img.UploadedAt = time.Now()
+
+	if err := s.store.Put(ctx, img.StorageKey, data, img.ContentType); err != nil {
+		return fmt.Errorf("store patient image: %w", err)
+	}
+	if err := s.store.Put(ctx, img.ThumbnailKey, thumbnail.Bytes(), "image/jpeg"); err != nil {
+		s.removeFiles(context.WithoutCancel(ctx), img.StorageKey)
+		return fmt.Errorf("store patient image thumbnail: %w", err)
+	}
+
+	var previous *models.PatientImage
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		images, err := queryPatientImages(ctx, tx, `WHERE patient_id = ? AND kind = ?`, img.PatientID, img.Kind)
+		if err != nil {
+			return err
+		}
+		if len(images) > 0 {
+			previous = &images[0]
+		}
+
+		query := `INSERT INTO PatientImages (patient_id, kind, content_type, size_bytes, width, height, sha256, storage_key, thumbnail_key,
+                      uploaded_by, uploaded_at)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+                  ON CONFLICT (patient_id, kind) DO UPDATE SET content_type = excluded.content_type, size_bytes = excluded.size_bytes,
+                      width = excluded.width, height = excluded.height, sha256 = excluded.sha256, storage_key = excluded.storage_key,
+                      thumbnail_key = excluded.thumbnail_key, uploaded_by = excluded.uploaded_by, uploaded_at = excluded.uploaded_at`
+		if _, err := tx.ExecContext(ctx, query, img.PatientID, img.Kind, img.ContentType, img.SizeBytes, img.Width, img.Height, img.SHA256,
+			img.StorageKey, img.ThumbnailKey, img.UploadedBy, img.UploadedAt); err != nil {
+			return err
+		}
+
+		details := map[string]any{"kind": img.Kind, "bytes": img.SizeBytes, "sha256": img.SHA256}
+		return s.audit.Log(ctx, tx, img.UploadedBy, models.AUDIT_PATIENT_IMAGE_SAVED, models.ENTITY_PATIENT, img.PatientID, details)
+	})
+	if err != nil {
+		s.removeFiles(context.WithoutCancel(ctx), img.StorageKey, img.ThumbnailKey)
+		return err
+	}
+
+	// The row points at the new files, so a failure here only leaves the
+	// replaced ones unreachable
+	if previous != nil {
+		s.removeFiles(ctx, previous.StorageKey, previous.ThumbnailKey)
+	}
+	return nil
+}
+
+func (s *PatientImageService) GetImage(ctx context.Context, patientID int, kind string) (*models.PatientImage, error) {
+	images, err := queryPatientImages(ctx, database.ReadDB(ctx), `WHERE patient_id = ? AND kind = ?`, patientID, kind)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &images[0], nil
+}
+
+// OpenImage returns the patient's image of kind and a reader for it, or for
+// its thumbnail, which the caller closes
+func (s *PatientImageService) OpenImage(ctx context.Context, patientID int, kind string, thumbnail bool) (*models.PatientImage, io.ReadCloser, error) {
+	img, err := s.GetImage(ctx, patientID, kind)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := img.StorageKey
+	if thumbnail {
+		key = img.ThumbnailKey
+	}
+	body, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, fmt.Errorf("patient %d's %s is missing from storage", patientID, kind)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return img, body, nil
+}
+
+// DeleteImage removes the record and then the stored files
+func (s *PatientImageService) DeleteImage(ctx context.Context, patientID int, kind string, userID int) error {
+	img, err := s.GetImage(database.WithPrimaryReads(ctx), patientID, kind)
+	if err != nil {
+		return err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM PatientImages WHERE patient_id = ? AND kind = ?`, patientID, kind)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return sql.ErrNoRows
+		}
+
+		details := map[string]any{"kind": kind, "sha256": img.SHA256}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_PATIENT_IMAGE_DELETED, models.ENTITY_PATIENT, patientID, details)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.removeFiles(ctx, img.StorageKey, img.ThumbnailKey)
+	return nil
+}
+
+// removeFiles deletes stored files, logging rather than returning failures
+func (s *PatientImageService) removeFiles(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := s.store.Delete(ctx, key); err != nil {
+			slog.Error("Failed to remove patient image from storage", "key", key, "error", err)
+		}
+	}
+}
+
+// thumbnailOf scales img to fit in a thumbnailSize square, averaging up to
+// four by four samples from the area each thumbnail pixel covers
+func thumbnailOf(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scale := min(float64(thumbnailSize)/float64(width), float64(thumbnailSize)/float64(height), 1)
+	thumbWidth, thumbHeight := max(int(float64(width)*scale), 1), max(int(float64(height)*scale), 1)
+
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := range thumbHeight {
+		top, bottom := y*height/thumbHeight, max((y+1)*height/thumbHeight, y*height/thumbHeight+1)
+		for x := range thumbWidth {
+			left, right := x*width/thumbWidth, max((x+1)*width/thumbWidth, x*width/thumbWidth+1)
+			var r, g, b, a, n uint32
+			for sy := top; sy < bottom; sy += max((bottom-top)/4, 1) {
+				for sx := left; sx < right; sx += max((right-left)/4, 1) {
+					pr, pg, pb, pa := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			thumb.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return thumb
+}
+
+func queryPatientImages(ctx context.Context, q querier, clause string, args ...any) ([]models.PatientImage, error) {
+	query := `SELECT patient_id, kind, content_type, size_bytes, width, height, sha256, storage_key, thumbnail_key, uploaded_by, uploaded_at
+              FROM PatientImages ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []models.PatientImage{}
+	for rows.Next() {
+		var img models.PatientImage
+		err := rows.Scan(&img.PatientID, &img.Kind, &img.ContentType, &img.SizeBytes, &img.Width, &img.Height, &img.SHA256,
+			&img.StorageKey, &img.ThumbnailKey, &img.UploadedBy, &img.UploadedAt)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
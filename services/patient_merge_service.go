@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	ErrMergeSelf     = errors.New("a patient can't be merged into itself")
+	ErrPatientMerged = errors.New("patient has already been merged into another record")
+	ErrMergeAdmitted = errors.New("duplicate patient is currently admitted; discharge or transfer the admission first")
+)
+
+// errMergeDryRun rolls a dry-run merge back once it has been counted
+var errMergeDryRun = errors.New("dry run")
+
+// PatientMergeService folds duplicate patient registrations into one record
+type PatientMergeService struct {
+	audit  *AuditService
+	events *EventService
+}
+
+func NewPatientMergeService() *PatientMergeService {
+	return &PatientMergeService{audit: NewAuditService(), events: NewEventService()}
+}
+
+// Merge re-points the duplicate's medical records (with their lab orders
+// and documents), prescriptions, future appointments, flags, allergies,
+// pre-auth requests and outpatient claims to the primary patient, fills the
+// primary's empty fields from the duplicate and appends its history, then
+// marks the duplicate merged. Past appointments, admissions
+// and inpatient claims stay on the duplicate as history. A dry run reports
+// the same counts and changes nothing.
+func (s *PatientMergeService) Merge(ctx context.Context, primaryID, duplicateID, userID int, dryRun bool) (*models.PatientMerge, error) {
+	if primaryID == duplicateID {
+		return nil, ErrMergeSelf
+	}
+
+	merge := &models.PatientMerge{PrimaryID: primaryID, DuplicateID: duplicateID, DryRun: dryRun, MergedFields: []string{}}
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		primary, err := getMergePatient(ctx, tx, primaryID)
+		if err != nil {
+			return err
+		}
+		duplicate, err := getMergePatient(ctx, tx, duplicateID)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range []int{primaryID, duplicateID} {
+			lock, err := getChartLock(ctx, tx, id)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if lock != nil && lock.HolderID != userID {
+				return &ChartLockedError{Lock: lock}
+			}
+		}
+
+		var admitted int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM Admissions WHERE patient_id = ? AND status = 'admitted'`, duplicateID).Scan(&admitted); err != nil {
+			return err
+		}
+		if admitted > 0 {
+			return ErrMergeAdmitted
+		}
+
+		now := time.Now()
+		if err := s.moveRecords(ctx, tx, merge, userID, now); err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM Appointments WHERE patient_id = ?),
+                  (SELECT COUNT(*) FROM Admissions WHERE patient_id = ?), (SELECT COUNT(*) FROM Claims WHERE patient_id = ?),
+                  (SELECT COUNT(*) FROM InsurancePolicies WHERE patient_id = ?), (SELECT COUNT(*) FROM PatientImages WHERE patient_id = ?)`,
+			duplicateID, duplicateID, duplicateID, duplicateID, duplicateID).Scan(&merge.Kept.Appointments, &merge.Kept.Admissions, &merge.Kept.Claims,
+			&merge.Kept.InsurancePolicies, &merge.Kept.PatientImages)
+		if err != nil {
+			return err
+		}
+
+		before := *primary
+		merge.MergedFields = mergePatientFields(primary, duplicate)
+		if len(merge.MergedFields) > 0 {
+			history, err := sealPatient(primaryID, primary)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `UPDATE Patients SET date_of_birth = ?, gender = ?, contact_info = ?, address = ?, medical_history = ?,
+                  emergency_contact = ?, preferred_language = ?, interpreter_required = ? WHERE patient_id = ?`,
+				primary.DateOfBirth, primary.Gender, primary.ContactInfo, primary.Address, history, primary.EmergencyContact,
+				primary.PreferredLanguage, primary.InterpreterRequired, primaryID)
+			if err != nil {
+				return err
+			}
+			if err := recordPatientChanges(ctx, tx, primaryID, &before, primary, userID); err != nil {
+				return err
+			}
+			summaries, err := allergySummaries(ctx, tx, primaryID)
+			if err != nil {
+				return err
+			}
+			primary.Allergies = summaries[primaryID]
+			if err := s.events.Append(ctx, tx, models.ENTITY_PATIENT, primaryID, models.EVENT_PATIENT_UPDATED, primary); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE Patients SET merged_into = ?, merged_at = ? WHERE patient_id = ?`, primaryID, now, duplicateID); err != nil {
+			return err
+		}
+		if err := s.events.Append(ctx, tx, models.ENTITY_PATIENT, duplicateID, models.EVENT_PATIENT_MERGED, map[string]any{"mergedInto": primaryID}); err != nil {
+			return err
+		}
+		details := map[string]any{"primaryId": primaryID, "moved": merge.Moved, "kept": merge.Kept, "mergedFields": merge.MergedFields,
+			"flagsRetired": merge.FlagsRetired}
+		if err := s.audit.Log(ctx, tx, userID, models.AUDIT_PATIENT_MERGED, models.ENTITY_PATIENT, duplicateID, details); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return errMergeDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMergeDryRun) {
+		return nil, err
+	}
+	return merge, nil
+}
+
+// moveRecords re-points the duplicate's rows to the primary, counting them
+func (s *PatientMergeService) moveRecords(ctx context.Context, tx *sql.Tx, merge *models.PatientMerge, userID int, now time.Time) error {
+	primaryID, duplicateID := merge.PrimaryID, merge.DuplicateID
+
+	// The primary keeps its own active flag where both have one of a type
+	result, err := tx.ExecContext(ctx, `UPDATE PatientFlags SET removed_by = ?, removed_at = ?, removal_reason = ?
+              WHERE patient_id = ? AND removed_at IS NULL
+              AND flag_type IN (SELECT flag_type FROM PatientFlags WHERE patient_id = ? AND removed_at IS NULL)`,
+		userID, now, "Duplicate of the surviving record's flag on patient merge", duplicateID, primaryID)
+	if err != nil {
+		return err
+	}
+	retired, _ := result.RowsAffected()
+	merge.FlagsRetired = int(retired)
+
+	moves := []struct {
+		count *int
+		query string
+		args  []any
+	}{
+		{&merge.Moved.MedicalRecords, `UPDATE MedicalRecords SET patient_id = ? WHERE patient_id = ?`, nil},
+		{&merge.Moved.LabOrders, `UPDATE LabOrders SET patient_id = ? WHERE patient_id = ?`, nil},
+		{&merge.Moved.Documents, `UPDATE Documents SET patient_id = ? WHERE patient_id = ?`, nil},
+		{&merge.Moved.Prescriptions, `UPDATE Prescriptions SET patient_id = ? WHERE patient_id = ?`, nil},
+		{&merge.Moved.Appointments, `UPDATE Appointments SET patient_id = ? WHERE patient_id = ? AND starts_at > ?`, []any{now}},
+		{&merge.Moved.Flags, `UPDATE PatientFlags SET patient_id = ? WHERE patient_id = ?`, nil},
+		{&merge.Moved.Allergies, `UPDATE Allergies SET patient_id = ? WHERE patient_id = ?`, nil},
+		{&merge.Moved.PreAuthRequests, `UPDATE PreAuthRequests SET patient_id = ? WHERE patient_id = ?`, nil},
+		{&merge.Moved.Claims, `UPDATE Claims SET patient_id = ? WHERE patient_id = ? AND COALESCE(encounter_type, '') <> ?`,
+			[]any{models.ENCOUNTER_INPATIENT}},
+		// A policy the primary also holds stays with the duplicate
+		{&merge.Moved.InsurancePolicies, `UPDATE InsurancePolicies SET patient_id = ? WHERE patient_id = ? AND NOT EXISTS (
+              SELECT 1 FROM InsurancePolicies p WHERE p.patient_id = ? AND p.payer = InsurancePolicies.payer
+              AND p.policy_number = InsurancePolicies.policy_number)`, []any{primaryID}},
+		// The primary keeps its own photo or ID document where both have one
+		{&merge.Moved.PatientImages, `UPDATE PatientImages SET patient_id = ? WHERE patient_id = ? AND kind NOT IN (
+              SELECT kind FROM PatientImages WHERE patient_id = ?)`, []any{primaryID}},
+	}
+	for _, move := range moves {
+		result, err := tx.ExecContext(ctx, move.query, append([]any{primaryID, duplicateID}, move.args...)...)
+		if err != nil {
+			return err
+		}
+		moved, _ := result.RowsAffected()
+		*move.count = int(moved)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM ChartLocks WHERE patient_id = ?`, duplicateID)
+	return err
+}
+
+// getMergePatient loads a patient that hasn't been merged away
+func getMergePatient(ctx context.Context, tx *sql.Tx, id int) (*models.Patient, error) {
+	var patient models.Patient
+	query := `SELECT patient_id, first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, emergency_contact,
+                  COALESCE(preferred_language, ''), interpreter_required, merged_into
+              FROM Patients WHERE patient_id = ? AND NOT synthetic`
+	err := tx.QueryRowContext(ctx, query, id).Scan(&patient.PatientID, &patient.FirstName, &patient.LastName, &patient.DateOfBirth,
+		&patient.Gender, &patient.ContactInfo, &patient.Address, &patient.MedicalHistory, &patient.EmergencyContact,
+		&patient.PreferredLanguage, &patient.InterpreterRequired, &patient.MergedInto)
+	if err != nil {
+		return nil, err
+	}
+	if patient.MergedInto != nil {
+		return nil, ErrPatientMerged
+	}
+	if err := openPatient(&patient); err != nil {
+		return nil, err
+	}
+	return &patient, nil
+}
+
+// mergePatientFields fills the primary's empty fields from the duplicate.
+// Medical history is appended rather than dropped, since losing it is a
+// safety risk. It returns the JSON names of the fields
+// changed.
+func mergePatientFields(primary, duplicate *models.Patient) []string {
+	changed := []string{}
+	fill := func(name string, field *string, value string) {
+		if *field == "" && value != "" {
+			*field = value
+			changed = append(changed, name)
+		}
+	}
+	appendText := func(name string, field *string, value string) {
+		switch {
+		case value == "" || value == *field:
+		case *field == "":
+			*field = value
+			changed = append(changed, name)
+		default:
+			*field += "\n" + value
+			changed = append(changed, name)
+		}
+	}
+
+	// A blank date of birth reads back from the DATETIME column as the zero time
+	if strings.HasPrefix(primary.DateOfBirth, "0001-01-01") && !strings.HasPrefix(duplicate.DateOfBirth, "0001-01-01") {
+		primary.DateOfBirth = ""
+	}
+	fill("dateOfBirth", &primary.DateOfBirth, duplicate.DateOfBirth)
+	fill("gender", &primary.Gender, duplicate.Gender)
+	fill("phone", &primary.ContactInfo, duplicate.ContactInfo)
+	fill("address", &primary.Address, duplicate.Address)
+	fill("emergencyContact", &primary.EmergencyContact, duplicate.EmergencyContact)
+	fill("preferredLanguage", &primary.PreferredLanguage, duplicate.PreferredLanguage)
+	appendText("medicalHistory", &primary.MedicalHistory, duplicate.MedicalHistory)
+	if duplicate.InterpreterRequired && !primary.InterpreterRequired {
+		primary.InterpreterRequired = true
+		changed = append(changed, "interpreterRequired")
+	}
+	return changed
+}
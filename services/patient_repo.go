@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+)
+
+// SQLitePatientRepo is the PatientRepo backed by the Patients table
+type SQLitePatientRepo struct {
+	events *EventService
+}
+
+func NewSQLitePatientRepo() *SQLitePatientRepo {
+	return &SQLitePatientRepo{
+		events: NewEventService(),
+	}
+}
+
+// Create registers the patient, recording each substance in their
+// free-text allergies as an allergy
+func (r *SQLitePatientRepo) Create(ctx context.Context, patient *models.Patient) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO Patients (first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, emergency_contact,
+                  preferred_language, interpreter_required, registered_at)
+              VALUES (?, ?, ?, ?, ?, ?, '', ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, patient.FirstName, patient.LastName, patient.DateOfBirth, patient.Gender,
+			patient.ContactInfo, patient.Address, patient.EmergencyContact, patient.PreferredLanguage,
+			patient.InterpreterRequired, time.Now())
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		patient.PatientID = int(id)
+		if err := encryption.Store(ctx, tx, encryption.PatientMedicalHistory, patient.PatientID, patient.MedicalHistory); err != nil {
+			return err
+		}
+		if patient.Allergies, err = importAllergies(ctx, tx, patient.PatientID, patient.Allergies); err != nil {
+			return err
+		}
+
+		return r.events.Append(ctx, tx, models.ENTITY_PATIENT, patient.PatientID, models.EVENT_PATIENT_CREATED, patient)
+	})
+}
+
+func (r *SQLitePatientRepo) Get(ctx context.Context, id int) (*models.Patient, error) {
+	var patient models.Patient
+	query := `SELECT patient_id, first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, emergency_contact,
+                  COALESCE(preferred_language, ''), interpreter_required, merged_into
+              FROM Patients WHERE patient_id = ? AND NOT synthetic`
+	err := database.ReadDB(ctx).QueryRowContext(ctx, query, id).Scan(&patient.PatientID, &patient.FirstName, &patient.LastName, &patient.DateOfBirth,
+		&patient.Gender, &patient.ContactInfo, &patient.Address, &patient.MedicalHistory,
+		&patient.EmergencyContact, &patient.PreferredLanguage, &patient.InterpreterRequired, &patient.MergedInto)
+	if err != nil {
+		return nil, err
+	}
+	if err := openPatient(&patient); err != nil {
+		return nil, err
+	}
+
+	summaries, err := allergySummaries(ctx, database.ReadDB(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	patient.Allergies = summaries[id]
+	return &patient, nil
+}
+
+func (r *SQLitePatientRepo) List(ctx context.Context) ([]models.Patient, error) {
+	var patients []models.Patient
+	err := r.Each(ctx, func(patient models.Patient) error {
+		patients = append(patients, patient)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patients, nil
+}
+
+// Each calls fn with each listed patient as it is read from the cursor, so
+// exports hold one patient at a time rather than the whole table. The
+// allergy summaries, which are short, are loaded up front.
+func (r *SQLitePatientRepo) Each(ctx context.Context, fn func(patient models.Patient) error) error {
+	summaries, err := allergySummaries(ctx, database.ReadDB(ctx), 0)
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT patient_id, first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, emergency_contact,
+                           COALESCE(preferred_language, ''), interpreter_required
+                           FROM Patients WHERE merged_into IS NULL AND NOT synthetic ORDER BY patient_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var patient models.Patient
+		err := rows.Scan(&patient.PatientID, &patient.FirstName, &patient.LastName, &patient.DateOfBirth,
+			&patient.Gender, &patient.ContactInfo, &patient.Address, &patient.MedicalHistory,
+			&patient.EmergencyContact, &patient.PreferredLanguage, &patient.InterpreterRequired)
+		if err != nil {
+			return err
+		}
+		if err := openPatient(&patient); err != nil {
+			return err
+		}
+		patient.Allergies = summaries[patient.PatientID]
+		if err := fn(patient); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Update replaces the patient's details, recording the demographic fields
+// that change as made by changedBy. Their allergies are left as they are,
+// and patient.Allergies is set to their summary.
+func (r *SQLitePatientRepo) Update(ctx context.Context, id int, patient *models.Patient, changedBy int) error {
+	history, err := sealPatient(id, patient)
+	if err != nil {
+		return err
+	}
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		before, err := patientDemographics(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		query := `UPDATE Patients SET first_name = ?, last_name = ?, date_of_birth = ?, gender = ?,
+              contact_info = ?, address = ?, medical_history = ?, emergency_contact = ?,
+              preferred_language = ?, interpreter_required = ?
+              WHERE patient_id = ? AND NOT synthetic`
+		result, err := tx.ExecContext(ctx, query, patient.FirstName, patient.LastName, patient.DateOfBirth, patient.Gender,
+			patient.ContactInfo, patient.Address, history,
+			patient.EmergencyContact, patient.PreferredLanguage, patient.InterpreterRequired, id)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return sql.ErrNoRows
+		}
+		if err := recordPatientChanges(ctx, tx, id, before, patient, changedBy); err != nil {
+			return err
+		}
+
+		summaries, err := allergySummaries(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		patient.Allergies = summaries[id]
+
+		snapshot := *patient
+		snapshot.PatientID = id
+		return r.events.Append(ctx, tx, models.ENTITY_PATIENT, id, models.EVENT_PATIENT_UPDATED, snapshot)
+	})
+}
+
+func (r *SQLitePatientRepo) Delete(ctx context.Context, id int) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM Allergies WHERE patient_id = ?", id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM PatientChanges WHERE patient_id = ?", id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM Patients WHERE patient_id = ? AND NOT synthetic", id)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return sql.ErrNoRows
+		}
+
+		return r.events.Append(ctx, tx, models.ENTITY_PATIENT, id, models.EVENT_PATIENT_DELETED, map[string]any{"id": id})
+	})
+}
+
+// Changes lists the patient's demographic changes, newest first
+func (r *SQLitePatientRepo) Changes(ctx context.Context, patientID int) ([]models.PatientChange, error) {
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT c.change_id, c.patient_id, c.field, c.old_value, c.new_value,
+                  u.user_id, u.full_name, u.role, c.changed_at
+              FROM PatientChanges c JOIN Users u ON u.user_id = c.changed_by
+              WHERE c.patient_id = ? ORDER BY c.changed_at DESC, c.change_id DESC`, patientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.PatientChange{}
+	for rows.Next() {
+		var change models.PatientChange
+		err := rows.Scan(&change.ChangeID, &change.PatientID, &change.Field, &change.OldValue, &change.NewValue,
+			&change.ChangedBy.ID, &change.ChangedBy.FullName, &change.ChangedBy.Role, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// sealPatient encrypts the medical history of the patient with id for storage
+func sealPatient(id int, patient *models.Patient) (history string, err error) {
+	return encryption.Seal(encryption.PatientMedicalHistory, id, patient.MedicalHistory)
+}
+
+// openPatient decrypts the column sealed by sealPatient in place
+func openPatient(patient *models.Patient) (err error) {
+	patient.MedicalHistory, err = encryption.Open(encryption.PatientMedicalHistory, patient.PatientID, patient.MedicalHistory)
+	return err
+}
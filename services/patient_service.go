@@ -1,76 +1,113 @@
 package services
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
 	"github.com/kinyaelgrande/simple-hospital/database"
 	"github.com/kinyaelgrande/simple-hospital/models"
 )
 
-type PatientService struct{}
+var ErrUnknownStreamFormat = errors.New("format must be csv or ndjson")
 
-func NewPatientService() *PatientService {
-	return &PatientService{}
+type PatientService struct {
+	repo  PatientRepo
+	audit *AuditService
 }
 
-func (s *PatientService) CreatePatient(patient *models.Patient) error {
-	query := `INSERT INTO Patients (first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, allergies, emergency_contact)
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	result, err := database.GetDB().Exec(query, patient.FirstName, patient.LastName, patient.DateOfBirth, patient.Gender,
-		patient.ContactInfo, patient.Address, patient.MedicalHistory, patient.Allergies, patient.EmergencyContact)
-	if err != nil {
-		return err
-	}
+func NewPatientService(repo PatientRepo) *PatientService {
+	return &PatientService{repo: repo, audit: NewAuditService()}
+}
 
-	id, _ := result.LastInsertId()
-	patient.PatientID = int(id)
-	return nil
+func (s *PatientService) CreatePatient(ctx context.Context, patient *models.Patient) error {
+	return s.repo.Create(ctx, patient)
 }
 
-func (s *PatientService) GetPatient(id int) (*models.Patient, error) {
-	var patient models.Patient
-	query := `SELECT patient_id, first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, allergies, emergency_contact
-              FROM Patients WHERE patient_id = ?`
-	err := database.GetDB().QueryRow(query, id).Scan(&patient.PatientID, &patient.FirstName, &patient.LastName, &patient.DateOfBirth,
-		&patient.Gender, &patient.ContactInfo, &patient.Address, &patient.MedicalHistory,
-		&patient.Allergies, &patient.EmergencyContact)
-	if err != nil {
-		return nil, err
-	}
-	return &patient, nil
+func (s *PatientService) GetPatient(ctx context.Context, id int) (*models.Patient, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *PatientService) GetAllPatients(ctx context.Context) ([]models.Patient, error) {
+	return s.repo.List(ctx)
+}
+
+// EachPatient calls fn with each patient in turn, as GetAllPatients would
+// list them, without holding them all in memory
+func (s *PatientService) EachPatient(ctx context.Context, fn func(patient models.Patient) error) error {
+	return s.repo.Each(ctx, fn)
+}
+
+// UpdatePatient replaces the patient's details as changed by the user
+// changedBy, who is recorded against each demographic field that changes
+func (s *PatientService) UpdatePatient(ctx context.Context, id int, patient *models.Patient, changedBy int) error {
+	return s.repo.Update(ctx, id, patient, changedBy)
 }
 
-func (s *PatientService) GetAllPatients() ([]models.Patient, error) {
-	rows, err := database.GetDB().Query(`SELECT patient_id, first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, allergies, emergency_contact
-                           FROM Patients`)
-	if err != nil {
+// GetPatientChanges lists the patient's demographic changes, newest first.
+// It fails with sql.ErrNoRows for an unknown patient.
+func (s *PatientService) GetPatientChanges(ctx context.Context, id int) ([]models.PatientChange, error) {
+	if _, err := s.repo.Get(ctx, id); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var patients []models.Patient
-	for rows.Next() {
-		var patient models.Patient
-		err := rows.Scan(&patient.PatientID, &patient.FirstName, &patient.LastName, &patient.DateOfBirth,
-			&patient.Gender, &patient.ContactInfo, &patient.Address, &patient.MedicalHistory,
-			&patient.Allergies, &patient.EmergencyContact)
-		if err != nil {
-			return nil, err
+	return s.repo.Changes(ctx, id)
+}
+
+func (s *PatientService) DeletePatient(ctx context.Context, id int) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// patientExportColumns heads a CSV patient export
+var patientExportColumns = []string{"id", "firstName", "lastName", "dateOfBirth", "gender", "phone", "address",
+	"medicalHistory", "allergies", "emergencyContact", "preferredLanguage", "interpreterRequired"}
+
+// ExportPatients writes every patient to w as CSV or NDJSON, row by row as
+// they are read, and records the export in the audit log before the first
+// row. A write that blocks because the reader is slow holds the cursor with
+// it. It fails before writing anything for an unknown format.
+func (s *PatientService) ExportPatients(ctx context.Context, userID int, format string, w io.Writer) error {
+	var write func(patient models.Patient) error
+	var finish func() error
+	switch format {
+	case models.STREAM_FORMAT_CSV:
+		writer := csv.NewWriter(w)
+		if err := s.logExport(ctx, userID, format); err != nil {
+			return err
+		}
+		if err := writer.Write(patientExportColumns); err != nil {
+			return err
 		}
-		patients = append(patients, patient)
+		write = func(patient models.Patient) error {
+			return writer.Write(escapeFormulas([]string{strconv.Itoa(patient.PatientID), patient.FirstName, patient.LastName,
+				patient.DateOfBirth, patient.Gender, patient.ContactInfo, patient.Address, patient.MedicalHistory,
+				patient.Allergies, patient.EmergencyContact, patient.PreferredLanguage,
+				strconv.FormatBool(patient.InterpreterRequired)}))
+		}
+		finish = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case models.STREAM_FORMAT_NDJSON:
+		if err := s.logExport(ctx, userID, format); err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(w)
+		write = func(patient models.Patient) error { return encoder.Encode(patient) }
+		finish = func() error { return nil }
+	default:
+		return ErrUnknownStreamFormat
 	}
-	return patients, nil
-}
 
-func (s *PatientService) UpdatePatient(id int, patient *models.Patient) error {
-	query := `UPDATE Patients SET first_name = ?, last_name = ?, date_of_birth = ?, gender = ?,
-              contact_info = ?, address = ?, medical_history = ?, allergies = ?, emergency_contact = ?
-              WHERE patient_id = ?`
-	_, err := database.GetDB().Exec(query, patient.FirstName, patient.LastName, patient.DateOfBirth, patient.Gender,
-		patient.ContactInfo, patient.Address, patient.MedicalHistory, patient.Allergies,
-		patient.EmergencyContact, id)
-	return err
+	if err := s.repo.Each(ctx, write); err != nil {
+		return err
+	}
+	return finish()
 }
 
-func (s *PatientService) DeletePatient(id int) error {
-	_, err := database.GetDB().Exec("DELETE FROM Patients WHERE patient_id = ?", id)
-	return err
+func (s *PatientService) logExport(ctx context.Context, userID int, format string) error {
+	return s.audit.Log(ctx, database.GetDB(), userID, models.AUDIT_PATIENTS_EXPORTED, models.ENTITY_PATIENT, 0,
+		map[string]any{"format": format, "source": "api"})
 }
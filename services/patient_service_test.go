@@ -0,0 +1,62 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/fakes"
+)
+
+func TestUpdatePatient(t *testing.T) {
+	ctx := context.Background()
+	patients := services.NewPatientService(fakes.NewPatientRepo())
+	patient := &models.Patient{FirstName: "Grace", LastName: "Hopper", DateOfBirth: "1906-12-09"}
+	if err := patients.CreatePatient(ctx, patient); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := *patient
+	changed.Address = "1 Navy Yard"
+	if err := patients.UpdatePatient(ctx, patient.PatientID, &changed, 1); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := patients.GetPatient(ctx, patient.PatientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Address != "1 Navy Yard" || updated.PatientID != patient.PatientID {
+		t.Fatalf("updated to %+v", updated)
+	}
+
+	if err := patients.UpdatePatient(ctx, patient.PatientID+1, &changed, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("updating an unknown patient: want sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestGetPatientChanges(t *testing.T) {
+	ctx := context.Background()
+	patients := services.NewPatientService(fakes.NewPatientRepo())
+	if _, err := patients.GetPatientChanges(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("an unknown patient: want sql.ErrNoRows, got %v", err)
+	}
+
+	patient := &models.Patient{FirstName: "Grace", LastName: "Hopper", DateOfBirth: "1906-12-09"}
+	if err := patients.CreatePatient(ctx, patient); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := patients.GetPatientChanges(ctx, patient.PatientID)
+	if err != nil || changes == nil {
+		t.Fatalf("want an empty list, got %v, %v", changes, err)
+	}
+}
+
+func TestExportPatientsUnknownFormat(t *testing.T) {
+	patients := services.NewPatientService(fakes.NewPatientRepo())
+	if err := patients.ExportPatients(context.Background(), 1, "xml", nil); !errors.Is(err, services.ErrUnknownStreamFormat) {
+		t.Fatalf("want ErrUnknownStreamFormat, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+// Package payer submits insurance pre-authorization requests to payers that
+// offer an API. Payers without one are handled by staff, who record the
+// decision they receive by phone or portal.
+package payer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Request is what a payer needs to decide on a pre-authorization
+type Request struct {
+	// RequestID is the hospital's pre-authorization ID, for the payer's records
+	RequestID     int    `json:"requestId"`
+	PatientID     int    `json:"patientId"`
+	ItemType      string `json:"itemType"`
+	Code          string `json:"code"`
+	Justification string `json:"justification"`
+}
+
+// Decision is the payer's answer. Status is "submitted" while the payer is
+// still reviewing, then "approved" (with an AuthorizationNumber) or "denied".
+type Decision struct {
+	Reference           string `json:"reference"`
+	Status              string `json:"status"`
+	AuthorizationNumber string `json:"authorizationNumber"`
+	Notes               string `json:"notes"`
+}
+
+// Client talks to one payer's pre-authorization API
+type Client interface {
+	// Submit sends a request and returns the payer's reference for it
+	Submit(ctx context.Context, req Request) (*Decision, error)
+	// Status looks up a previously submitted request by the payer's reference
+	Status(ctx context.Context, reference string) (*Decision, error)
+}
+
+// HTTPClient speaks a plain JSON protocol: POST {base}/preauth submits a
+// Request and GET {base}/preauth/{reference} returns its Decision
+type HTTPClient struct {
+	base   string
+	client *http.Client
+}
+
+func NewHTTPClient(baseURL string) *HTTPClient {
+	return &HTTPClient{
+		base:   strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *HTTPClient) Submit(ctx context.Context, req Request) (*Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+"/preauth", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return c.do(httpReq)
+}
+
+func (c *HTTPClient) Status(ctx context.Context, reference string) (*Decision, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/preauth/"+url.PathEscape(reference), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(httpReq)
+}
+
+func (c *HTTPClient) do(req *http.Request) (*Decision, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("payer returned %s", resp.Status)
+	}
+
+	var decision Decision
+	if err := json.Unmarshal(data, &decision); err != nil {
+		return nil, fmt.Errorf("invalid payer response: %w", err)
+	}
+	return &decision, nil
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/payer"
+)
+
+var (
+	// ErrNoPayerAPI is returned when submitting to a payer without a registered API client
+	ErrNoPayerAPI = errors.New("payer has no API; record the decision manually")
+	// ErrPayerUnavailable wraps failures talking to a payer's API
+	ErrPayerUnavailable = errors.New("payer API request failed")
+	// ErrPreAuthNotPending is returned when submitting a request that was already sent
+	ErrPreAuthNotPending = errors.New("pre-authorization has already been submitted")
+	// ErrPreAuthNotSubmitted is returned when refreshing a request awaiting no payer decision
+	ErrPreAuthNotSubmitted = errors.New("pre-authorization is not awaiting a payer decision")
+	// ErrPreAuthDecided is returned when recording a decision on a decided request
+	ErrPreAuthDecided = errors.New("pre-authorization has already been decided")
+)
+
+// PreAuthService tracks insurance pre-authorizations for flagged procedures
+// and medications. Requests go to the payer's API when one is registered;
+// otherwise staff record the decision themselves.
+type PreAuthService struct {
+	audit  *AuditService
+	payers map[string]payer.Client
+}
+
+func NewPreAuthService() *PreAuthService {
+	return &PreAuthService{
+		audit:  NewAuditService(),
+		payers: map[string]payer.Client{},
+	}
+}
+
+// RegisterPayer routes requests for the named payer (case-insensitive) to client
+func (s *PreAuthService) RegisterPayer(name string, client payer.Client) {
+	s.payers[strings.ToLower(name)] = client
+}
+
+func (s *PreAuthService) CreateRequirement(ctx context.Context, requirement *models.PreAuthRequirement) error {
+	requirement.CreatedAt = time.Now()
+	query := `INSERT INTO PreAuthRequirements (item_type, code, payer, description, created_at) VALUES (?, ?, ?, ?, ?)`
+	result, err := database.GetDB().ExecContext(ctx, query, requirement.ItemType, requirement.Code, requirement.Payer,
+		requirement.Description, requirement.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	requirement.RequirementID = int(id)
+	return nil
+}
+
+func (s *PreAuthService) GetRequirements(ctx context.Context) ([]models.PreAuthRequirement, error) {
+	query := `SELECT requirement_id, item_type, code, payer, COALESCE(description, ''), created_at
+              FROM PreAuthRequirements ORDER BY item_type, code, payer`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requirements := []models.PreAuthRequirement{}
+	for rows.Next() {
+		var r models.PreAuthRequirement
+		if err := rows.Scan(&r.RequirementID, &r.ItemType, &r.Code, &r.Payer, &r.Description, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, r)
+	}
+	return requirements, rows.Err()
+}
+
+func (s *PreAuthService) DeleteRequirement(ctx context.Context, id int) error {
+	result, err := database.GetDB().ExecContext(ctx, `DELETE FROM PreAuthRequirements WHERE requirement_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateRequest records a pre-authorization request as pending
+func (s *PreAuthService) CreateRequest(ctx context.Context, req *models.PreAuthRequest) error {
+	var exists int
+	if err := database.GetDB().QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, req.PatientID).Scan(&exists); err != nil {
+		return err
+	}
+
+	req.Status = models.PREAUTH_STATUS_PENDING
+	req.RequestedAt = time.Now()
+	query := `INSERT INTO PreAuthRequests (patient_id, item_type, code, payer, justification, status, requested_by, requested_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := database.GetDB().ExecContext(ctx, query, req.PatientID, req.ItemType, req.Code, req.Payer, req.Justification,
+		req.Status, req.RequestedBy, req.RequestedAt)
+	if err != nil {
+		return err
+	}
+
+	id, _ := result.LastInsertId()
+	req.PreAuthID = int(id)
+	return nil
+}
+
+// GetRequests lists requests, newest first, optionally for one patient and/or status
+func (s *PreAuthService) GetRequests(ctx context.Context, patientID int, status string) ([]models.PreAuthRequest, error) {
+	var conditions []string
+	var args []any
+	if patientID != 0 {
+		conditions = append(conditions, "patient_id = ?")
+		args = append(args, patientID)
+	}
+	if status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, status)
+	}
+
+	clause := ""
+	if len(conditions) > 0 {
+		clause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	return queryPreAuthRequests(ctx, database.ReadDB(ctx), clause+" ORDER BY requested_at DESC", args...)
+}
+
+func (s *PreAuthService) GetRequest(ctx context.Context, id int) (*models.PreAuthRequest, error) {
+	requests, err := queryPreAuthRequests(ctx, database.ReadDB(ctx), `WHERE preauth_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &requests[0], nil
+}
+
+// Submit sends a pending request to the payer's API and records its answer
+func (s *PreAuthService) Submit(ctx context.Context, id, userID int) (*models.PreAuthRequest, error) {
+	req, err := s.GetRequest(database.WithPrimaryReads(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != models.PREAUTH_STATUS_PENDING {
+		return nil, ErrPreAuthNotPending
+	}
+	client, ok := s.payers[strings.ToLower(req.Payer)]
+	if !ok {
+		return nil, ErrNoPayerAPI
+	}
+
+	decision, err := client.Submit(ctx, payer.Request{
+		RequestID:     req.PreAuthID,
+		PatientID:     req.PatientID,
+		ItemType:      req.ItemType,
+		Code:          req.Code,
+		Justification: req.Justification,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPayerUnavailable, err)
+	}
+	if err := checkPayerDecision(decision); err != nil {
+		return nil, err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE PreAuthRequests SET status = ?, payer_reference = ?, submitted_at = ?
+              WHERE preauth_id = ? AND status = ?`, models.PREAUTH_STATUS_SUBMITTED, decision.Reference, time.Now(), id, models.PREAUTH_STATUS_PENDING)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return ErrPreAuthNotPending
+		}
+		if err := applyPayerDecision(ctx, tx, id, decision); err != nil {
+			return err
+		}
+
+		details := map[string]any{"payer": req.Payer, "reference": decision.Reference, "status": decision.Status}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_PREAUTH_SUBMITTED, models.ENTITY_PREAUTH, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRequest(database.WithPrimaryReads(ctx), id)
+}
+
+// Refresh asks the payer's API for the decision on a submitted request
+func (s *PreAuthService) Refresh(ctx context.Context, id int) (*models.PreAuthRequest, error) {
+	req, err := s.GetRequest(database.WithPrimaryReads(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != models.PREAUTH_STATUS_SUBMITTED || req.PayerReference == "" {
+		return nil, ErrPreAuthNotSubmitted
+	}
+	client, ok := s.payers[strings.ToLower(req.Payer)]
+	if !ok {
+		return nil, ErrNoPayerAPI
+	}
+
+	decision, err := client.Status(ctx, req.PayerReference)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPayerUnavailable, err)
+	}
+	if err := checkPayerDecision(decision); err != nil {
+		return nil, err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		return applyPayerDecision(ctx, tx, id, decision)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRequest(database.WithPrimaryReads(ctx), id)
+}
+
+// RecordDecision records a decision staff received outside the payer API
+func (s *PreAuthService) RecordDecision(ctx context.Context, id, userID int, decision *models.PreAuthDecision) (*models.PreAuthRequest, error) {
+	authorizationNumber := sql.NullString{String: decision.AuthorizationNumber, Valid: decision.Status == models.PREAUTH_STATUS_APPROVED}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE PreAuthRequests SET status = ?, authorization_number = ?, decided_by = ?, decided_at = ?, decision_notes = ?
+              WHERE preauth_id = ? AND status IN (?, ?)`, decision.Status, authorizationNumber, userID, time.Now(), decision.Notes,
+			id, models.PREAUTH_STATUS_PENDING, models.PREAUTH_STATUS_SUBMITTED)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			var exists int
+			if err := tx.QueryRowContext(ctx, `SELECT 1 FROM PreAuthRequests WHERE preauth_id = ?`, id).Scan(&exists); err != nil {
+				return err
+			}
+			return ErrPreAuthDecided
+		}
+
+		details := map[string]any{"status": decision.Status, "authorizationNumber": decision.AuthorizationNumber}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_PREAUTH_DECISION, models.ENTITY_PREAUTH, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRequest(database.WithPrimaryReads(ctx), id)
+}
+
+// checkPayerDecision rejects answers that don't fit the protocol
+func checkPayerDecision(decision *payer.Decision) error {
+	switch decision.Status {
+	case models.PREAUTH_STATUS_SUBMITTED, models.PREAUTH_STATUS_DENIED:
+	case models.PREAUTH_STATUS_APPROVED:
+		if decision.AuthorizationNumber == "" {
+			return fmt.Errorf("%w: approval without an authorization number", ErrPayerUnavailable)
+		}
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrPayerUnavailable, decision.Status)
+	}
+	if decision.Reference == "" {
+		return fmt.Errorf("%w: missing reference", ErrPayerUnavailable)
+	}
+	return nil
+}
+
+// applyPayerDecision stores a final decision from the payer's API; a
+// "submitted" answer leaves the request awaiting the payer
+func applyPayerDecision(ctx context.Context, tx *sql.Tx, id int, decision *payer.Decision) error {
+	if decision.Status == models.PREAUTH_STATUS_SUBMITTED {
+		return nil
+	}
+
+	authorizationNumber := sql.NullString{String: decision.AuthorizationNumber, Valid: decision.Status == models.PREAUTH_STATUS_APPROVED}
+	_, err := tx.ExecContext(ctx, `UPDATE PreAuthRequests SET status = ?, authorization_number = ?, decided_at = ?, decision_notes = ?
+              WHERE preauth_id = ? AND status = ?`, decision.Status, authorizationNumber, time.Now(), decision.Notes,
+		id, models.PREAUTH_STATUS_SUBMITTED)
+	return err
+}
+
+// preAuthRequired reports whether billing itemType/code to payerName needs an approved request
+func preAuthRequired(ctx context.Context, q queryRower, itemType, code, payerName string) (bool, error) {
+	var exists int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM PreAuthRequirements WHERE item_type = ? AND code = ? AND (payer = '' OR payer = ?)`,
+		itemType, code, payerName).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func queryPreAuthRequests(ctx context.Context, q *sql.DB, clause string, args ...any) ([]models.PreAuthRequest, error) {
+	query := `SELECT preauth_id, patient_id, item_type, code, payer, justification, status, COALESCE(authorization_number, ''),
+                  COALESCE(payer_reference, ''), requested_by, requested_at, submitted_at, decided_by, decided_at, COALESCE(decision_notes, '')
+              FROM PreAuthRequests ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.PreAuthRequest{}
+	for rows.Next() {
+		var r models.PreAuthRequest
+		err := rows.Scan(&r.PreAuthID, &r.PatientID, &r.ItemType, &r.Code, &r.Payer, &r.Justification, &r.Status, &r.AuthorizationNumber,
+			&r.PayerReference, &r.RequestedBy, &r.RequestedAt, &r.SubmittedAt, &r.DecidedBy, &r.DecidedAt, &r.DecisionNotes)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// SQLitePrescriptionRepo is the PrescriptionRepo backed by the Prescriptions table
+type SQLitePrescriptionRepo struct {
+	events *EventService
+	audit  *AuditService
+}
+
+func NewSQLitePrescriptionRepo() *SQLitePrescriptionRepo {
+	return &SQLitePrescriptionRepo{
+		events: NewEventService(),
+		audit:  NewAuditService(),
+	}
+}
+
+func (r *SQLitePrescriptionRepo) Create(ctx context.Context, prescription *models.Prescription) error {
+	return r.create(ctx, prescription, nil)
+}
+
+// CreateOverridden records the prescriber's reason and the warnings in the
+// audit log in the same transaction as the insert
+func (r *SQLitePrescriptionRepo) CreateOverridden(ctx context.Context, prescription *models.Prescription, userID int, warnings []models.PrescriptionWarning) error {
+	return r.create(ctx, prescription, func(tx *sql.Tx) error {
+		details := map[string]any{
+			"reason":   prescription.OverrideReason,
+			"warnings": warnings,
+		}
+		return r.audit.Log(ctx, tx, userID, models.AUDIT_PRESCRIPTION_OVERRIDE, models.ENTITY_PRESCRIPTION, prescription.PrescriptionID, details)
+	})
+}
+
+// create inserts the prescription and runs afterInsert, if any, in the same transaction
+func (r *SQLitePrescriptionRepo) create(ctx context.Context, prescription *models.Prescription, afterInsert func(tx *sql.Tx) error) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO Prescriptions (patient_id, doctor_id, prescribed_date, medication, medication_id, dosage, duration, instructions, record_id)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, prescription.PatientID, prescription.DoctorID, prescription.PrescribedDate,
+			prescription.Medication, prescription.MedicationID, prescription.Dosage, prescription.Duration, prescription.Instructions,
+			prescription.RecordID)
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		prescription.PrescriptionID = int(id)
+		prescription.Status = models.PRESCRIPTION_STATUS_UNSIGNED
+
+		if err := r.events.Append(ctx, tx, models.ENTITY_PRESCRIPTION, prescription.PrescriptionID, models.EVENT_PRESCRIPTION_CREATED, prescription); err != nil {
+			return err
+		}
+
+		if afterInsert != nil {
+			return afterInsert(tx)
+		}
+		return nil
+	})
+}
+
+// Sign records the prescriber's signature over the prescription's content,
+// which makes it active, as a clinical event and in the audit log
+func (r *SQLitePrescriptionRepo) Sign(ctx context.Context, id, userID int) (*models.Prescription, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var prescription models.Prescription
+		var signedAt sql.NullTime
+		query := `SELECT prescription_id, patient_id, doctor_id, prescribed_date, medication, medication_id, COALESCE(dosage, ''),
+                  COALESCE(duration, ''), COALESCE(instructions, ''), refill_of, signed_at
+              FROM Prescriptions WHERE prescription_id = ?`
+		err := tx.QueryRowContext(ctx, query, id).Scan(&prescription.PrescriptionID, &prescription.PatientID, &prescription.DoctorID,
+			&prescription.PrescribedDate, &prescription.Medication, &prescription.MedicationID, &prescription.Dosage,
+			&prescription.Duration, &prescription.Instructions, &prescription.RefillOf, &signedAt)
+		if err != nil {
+			return err
+		}
+		if signedAt.Valid {
+			return ErrPrescriptionSigned
+		}
+		if prescription.DoctorID != userID {
+			return ErrPrescriptionSigner
+		}
+
+		now := time.Now()
+		hash := prescription.ContentHash()
+		if _, err := tx.ExecContext(ctx, `UPDATE Prescriptions SET signed_by = ?, signed_at = ?, signature_hash = ? WHERE prescription_id = ?`,
+			userID, now, hash, id); err != nil {
+			return err
+		}
+
+		payload := map[string]any{"status": models.PRESCRIPTION_STATUS_ACTIVE, "signedAt": now, "signedBy": userID, "signatureHash": hash}
+		if err := r.events.Append(ctx, tx, models.ENTITY_PRESCRIPTION, id, models.EVENT_PRESCRIPTION_SIGNED, payload); err != nil {
+			return err
+		}
+		details := map[string]any{"patientId": prescription.PatientID, "signatureHash": hash}
+		return r.audit.Log(ctx, tx, userID, models.AUDIT_PRESCRIPTION_SIGNED, models.ENTITY_PRESCRIPTION, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(database.WithPrimaryReads(ctx), id)
+}
+
+// MarkReady sets ready_at and records the change as a clinical event
+func (r *SQLitePrescriptionRepo) MarkReady(ctx context.Context, id, userID int) (*models.Prescription, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var signedAt, readyAt sql.NullTime
+		if err := tx.QueryRowContext(ctx, `SELECT signed_at, ready_at FROM Prescriptions WHERE prescription_id = ?`, id).Scan(&signedAt, &readyAt); err != nil {
+			return err
+		}
+		if !signedAt.Valid {
+			return ErrPrescriptionUnsigned
+		}
+		if readyAt.Valid {
+			return ErrPrescriptionReady
+		}
+
+		now := time.Now()
+		if _, err := tx.ExecContext(ctx, `UPDATE Prescriptions SET ready_at = ?, ready_by = ? WHERE prescription_id = ?`, now, userID, id); err != nil {
+			return err
+		}
+
+		payload := map[string]any{"status": models.PRESCRIPTION_STATUS_READY, "readyAt": now, "readyBy": userID}
+		return r.events.Append(ctx, tx, models.ENTITY_PRESCRIPTION, id, models.EVENT_PRESCRIPTION_READY, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Get(database.WithPrimaryReads(ctx), id)
+}
+
+// prescriptionSortColumns maps the models.PRESCRIPTION_SORT_ fields to columns
+var prescriptionSortColumns = map[string]string{
+	models.PRESCRIPTION_SORT_ID:              "p.prescription_id",
+	models.PRESCRIPTION_SORT_PRESCRIBED_DATE: "p.prescribed_date",
+	models.PRESCRIPTION_SORT_MEDICATION:      "lower(p.medication)",
+}
+
+func (r *SQLitePrescriptionRepo) List(ctx context.Context, filter PrescriptionFilter) ([]*models.Prescription, int, error) {
+	clause := `WHERE 1 = 1`
+	var args []any
+	if filter.PatientID != 0 {
+		clause += ` AND p.patient_id = ?`
+		args = append(args, filter.PatientID)
+	}
+	if filter.DoctorID != 0 {
+		clause += ` AND p.doctor_id = ?`
+		args = append(args, filter.DoctorID)
+	}
+	if filter.Medication != "" {
+		clause += ` AND lower(p.medication) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(strings.ToLower(filter.Medication))+"%")
+	}
+	switch filter.Status {
+	case models.PRESCRIPTION_STATUS_UNSIGNED:
+		clause += ` AND p.signed_at IS NULL`
+	case models.PRESCRIPTION_STATUS_ACTIVE:
+		clause += ` AND p.signed_at IS NOT NULL AND p.ready_at IS NULL`
+	case models.PRESCRIPTION_STATUS_READY:
+		clause += ` AND p.ready_at IS NOT NULL`
+	}
+	if filter.From != "" {
+		clause += ` AND p.prescribed_date >= ?`
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		clause += ` AND p.prescribed_date <= ?`
+		args = append(args, filter.To)
+	}
+
+	db := database.ReadDB(ctx)
+	total := -1
+	if filter.Limit > 0 {
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM Prescriptions p `+clause, args...).Scan(&total); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	order := prescriptionSortColumns[filter.Sort]
+	if order == "" {
+		order = prescriptionSortColumns[models.PRESCRIPTION_SORT_ID]
+	}
+	direction := ` ASC`
+	if filter.Descending {
+		direction = ` DESC`
+	}
+	clause += ` ORDER BY ` + order + direction + `, p.prescription_id` + direction
+	if filter.Limit > 0 {
+		clause += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	columns, joins := expandJoins(filter.Expand, `p.patient_id`, `p.doctor_id`)
+	query := `SELECT p.prescription_id, p.patient_id, p.doctor_id, p.prescribed_date, p.medication, p.medication_id, p.dosage,
+                  p.duration, p.instructions, CASE WHEN p.signed_at IS NULL THEN 'unsigned' WHEN p.ready_at IS NULL THEN 'active' ELSE 'ready' END,
+                  p.record_id, p.refill_of, p.refill_count, p.signed_by, p.signed_at, COALESCE(p.signature_hash, '')` + columns + `
+              FROM Prescriptions p` + joins + ` ` + clause
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	prescriptions := []*models.Prescription{}
+	for rows.Next() {
+		var prescription models.Prescription
+		expanded := expandedRow{expand: filter.Expand}
+		err := rows.Scan(append([]any{&prescription.PrescriptionID, &prescription.PatientID, &prescription.DoctorID,
+			&prescription.PrescribedDate, &prescription.Medication, &prescription.MedicationID, &prescription.Dosage,
+			&prescription.Duration, &prescription.Instructions, &prescription.Status, &prescription.RecordID, &prescription.RefillOf,
+			&prescription.RefillCount, &prescription.SignedBy, &prescription.SignedAt, &prescription.SignatureHash}, expanded.targets()...)...)
+		if err != nil {
+			return nil, 0, err
+		}
+		prescription.Patient, prescription.Doctor = expanded.patient(), expanded.doctor()
+		prescriptions = append(prescriptions, &prescription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Unpaged, every match was returned
+	if total < 0 {
+		total = len(prescriptions)
+	}
+	return prescriptions, total, nil
+}
+
+func (r *SQLitePrescriptionRepo) Get(ctx context.Context, id int) (*models.Prescription, error) {
+	var prescription models.Prescription
+	query := `SELECT prescription_id, patient_id, doctor_id, prescribed_date, medication, medication_id, dosage, duration, instructions,
+                  CASE WHEN signed_at IS NULL THEN 'unsigned' WHEN ready_at IS NULL THEN 'active' ELSE 'ready' END, record_id, refill_of, refill_count,
+                  signed_by, signed_at, COALESCE(signature_hash, '')
+              FROM Prescriptions WHERE prescription_id = ?`
+	err := database.ReadDB(ctx).QueryRowContext(ctx, query, id).Scan(&prescription.PrescriptionID, &prescription.PatientID, &prescription.DoctorID,
+		&prescription.PrescribedDate, &prescription.Medication, &prescription.MedicationID, &prescription.Dosage,
+		&prescription.Duration, &prescription.Instructions, &prescription.Status, &prescription.RecordID, &prescription.RefillOf, &prescription.RefillCount,
+		&prescription.SignedBy, &prescription.SignedAt, &prescription.SignatureHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &prescription, nil
+}
+
+func (r *SQLitePrescriptionRepo) ListByPatient(ctx context.Context, patientId int) ([]models.Prescription, error) {
+	var prescriptions []models.Prescription
+	query := `SELECT prescription_id, patient_id, doctor_id, prescribed_date, medication, medication_id, dosage, duration, instructions,
+                  CASE WHEN signed_at IS NULL THEN 'unsigned' WHEN ready_at IS NULL THEN 'active' ELSE 'ready' END, record_id, refill_of, refill_count,
+                  signed_by, signed_at, COALESCE(signature_hash, '')
+              FROM Prescriptions WHERE patient_id = ?`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, patientId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var prescription models.Prescription
+		err := rows.Scan(&prescription.PrescriptionID, &prescription.PatientID, &prescription.DoctorID,
+			&prescription.PrescribedDate, &prescription.Medication, &prescription.MedicationID, &prescription.Dosage,
+			&prescription.Duration, &prescription.Instructions, &prescription.Status, &prescription.RecordID, &prescription.RefillOf, &prescription.RefillCount,
+			&prescription.SignedBy, &prescription.SignedAt, &prescription.SignatureHash)
+		if err != nil {
+			return nil, err
+		}
+
+		prescriptions = append(prescriptions, prescription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prescriptions, nil
+}
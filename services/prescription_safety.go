@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// allergyClasses maps allergy names recorded on patients to the drugs they cover,
+// so an allergy to "penicillin" also flags amoxicillin
+var allergyClasses = map[string][]string{
+	"penicillin": {"amoxicillin", "ampicillin", "piperacillin", "flucloxacillin", "benzylpenicillin"},
+	"sulfa":      {"sulfamethoxazole", "sulfasalazine", "sulfadiazine"},
+	"nsaid":      {"ibuprofen", "naproxen", "diclofenac", "aspirin", "indomethacin"},
+	"cephalosporin": {
+		"cefalexin", "cefuroxime", "ceftriaxone", "cefixime",
+	},
+}
+
+// defaultActiveDays is used when a prescription's duration can't be parsed
+const defaultActiveDays = 90
+
+var durationPattern = regexp.MustCompile(`(?i)(\d+)\s*(day|week|month|year)`)
+
+// CheckPrescription cross-checks a new prescription against the patient's
+// recorded allergies and the interaction table for their active prescriptions.
+// It resolves the prescription's catalog entry first, so a prescription
+// naming only a medication ID is checked by the entry's name. It always
+// reads from the primary so a replica can't hide a recent change.
+func (s *PrescriptionService) CheckPrescription(ctx context.Context, prescription *models.Prescription) ([]models.PrescriptionWarning, error) {
+	ctx = database.WithPrimaryReads(ctx)
+	if err := s.medications.Resolve(ctx, prescription); err != nil {
+		return nil, err
+	}
+	warnings := []models.PrescriptionWarning{}
+	medication := strings.ToLower(prescription.Medication)
+
+	if err := checkPatient(ctx, database.ReadDB(ctx), prescription.PatientID); errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownPatient, prescription.PatientID)
+	} else if err != nil {
+		return nil, err
+	}
+	allergies, err := queryAllergies(ctx, database.ReadDB(ctx), `WHERE patient_id = ? AND active ORDER BY recorded_at, allergy_id`,
+		prescription.PatientID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, allergy := range allergies {
+		substance := strings.ToLower(allergy.Substance)
+		if matchesAllergy(medication, substance) {
+			warnings = append(warnings, models.PrescriptionWarning{
+				Type:            models.WARNING_ALLERGY,
+				Severity:        "major",
+				Message:         allergyWarning(allergy),
+				ConflictingDrug: substance,
+			})
+		}
+	}
+
+	active, err := s.activePrescriptions(ctx, prescription.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	if len(active) == 0 {
+		return warnings, nil
+	}
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, `SELECT drug_a, drug_b, severity, description FROM DrugInteractions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var drugA, drugB, severity, description string
+		if err := rows.Scan(&drugA, &drugB, &severity, &description); err != nil {
+			return nil, err
+		}
+
+		for _, existing := range active {
+			current := strings.ToLower(existing.Medication)
+			if (strings.Contains(medication, drugA) && strings.Contains(current, drugB)) ||
+				(strings.Contains(medication, drugB) && strings.Contains(current, drugA)) {
+				warnings = append(warnings, models.PrescriptionWarning{
+					Type:                      models.WARNING_INTERACTION,
+					Severity:                  severity,
+					Message:                   fmt.Sprintf("Interacts with active prescription %s: %s", existing.Medication, description),
+					ConflictingDrug:           existing.Medication,
+					ConflictingPrescriptionID: existing.PrescriptionID,
+				})
+			}
+		}
+	}
+
+	return warnings, rows.Err()
+}
+
+// activePrescriptions returns the patient's prescriptions whose duration has not yet elapsed
+func (s *PrescriptionService) activePrescriptions(ctx context.Context, patientID int) ([]models.Prescription, error) {
+	prescriptions, err := s.GetPrescriptionsByPatient(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+
+	var active []models.Prescription
+	now := time.Now()
+	for _, prescription := range prescriptions {
+		prescribed, err := time.Parse("2006-01-02", prescription.PrescribedDate)
+		if err != nil {
+			// Undated prescriptions are assumed to still be active
+			active = append(active, prescription)
+			continue
+		}
+		if now.Before(prescribed.AddDate(0, 0, durationDays(prescription.Duration)+1)) {
+			active = append(active, prescription)
+		}
+	}
+	return active, nil
+}
+
+// durationDays parses durations such as "7 days", "2 weeks" or "3 months"
+func durationDays(duration string) int {
+	match := durationPattern.FindStringSubmatch(duration)
+	if match == nil {
+		return defaultActiveDays
+	}
+
+	count, _ := strconv.Atoi(match[1])
+	switch strings.ToLower(match[2]) {
+	case "week":
+		return count * 7
+	case "month":
+		return count * 30
+	case "year":
+		return count * 365
+	default:
+		return count
+	}
+}
+
+// splitAllergies splits a free-text allergies list into substances,
+// dropping "none" and "NKDA"
+func splitAllergies(allergies string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(allergies, func(r rune) bool {
+		return r == ',' || r == ';' || r == '\n'
+	}) {
+		name = strings.TrimSpace(name)
+		if name != "" && !strings.EqualFold(name, "none") && !strings.EqualFold(name, "nkda") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// allergyWarning describes the allergy a prescription conflicts with, with
+// its severity and reaction when recorded
+func allergyWarning(allergy models.Allergy) string {
+	message := "Patient has a recorded allergy to " + strings.ToLower(allergy.Substance)
+	if allergy.Severity != "" {
+		message = "Patient has a recorded " + allergy.Severity + " allergy to " + strings.ToLower(allergy.Substance)
+	}
+	if allergy.Reaction != "" {
+		message += " (" + allergy.Reaction + ")"
+	}
+	return message
+}
+
+func matchesAllergy(medication, allergy string) bool {
+	if strings.Contains(medication, allergy) {
+		return true
+	}
+	for class, drugs := range allergyClasses {
+		if !strings.Contains(allergy, class) {
+			continue
+		}
+		for _, drug := range drugs {
+			if strings.Contains(medication, drug) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,114 +1,224 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/kinyaelgrande/simple-hospital/database"
 	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/auth"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+	"golang.org/x/crypto/bcrypt"
 )
 
-type PrescriptionService struct{}
+// ErrPrescriptionReady is returned when marking a prescription ready twice
+var ErrPrescriptionReady = errors.New("prescription is already ready for collection")
+
+// ErrPrescriptionUnsigned is returned when dispensing a prescription its
+// prescriber hasn't signed
+var ErrPrescriptionUnsigned = errors.New("prescription has not been signed by its prescriber")
+
+// ErrPrescriptionSigned is returned when signing a prescription twice
+var ErrPrescriptionSigned = errors.New("prescription is already signed")
+
+// ErrPrescriptionSigner is returned when someone other than the prescriber
+// signs a prescription
+var ErrPrescriptionSigner = errors.New("only the prescribing doctor can sign a prescription")
+
+// ErrSignatureCredentials is returned when the password or code given to
+// sign a prescription is wrong
+var ErrSignatureCredentials = errors.New("invalid password or code")
+
+// ErrUnknownPatient is returned when a prescription or medical record is for
+// a patient that doesn't exist
+var ErrUnknownPatient = errors.New("patient does not exist")
+
+// PrescriptionFilter narrows, orders and pages GetPrescriptions; zero fields
+// are ignored
+type PrescriptionFilter struct {
+	PatientID int
+	DoctorID  int
+	// Medication matches prescriptions whose medication contains it,
+	// ignoring case
+	Medication string
+	// Status is unsigned, active or ready
+	Status string
+	// From and To bound the prescribed date, inclusive, as YYYY-MM-DD
+	From string
+	To   string
+	// Sort is one of the models.PRESCRIPTION_SORT_ fields; ties are broken by ID
+	Sort       string
+	Descending bool
+	// Limit caps the prescriptions returned, from Offset; zero returns all
+	Limit  int
+	Offset int
+	// Expand adds summaries of each prescription's patient and prescriber
+	Expand models.Expand
+}
 
-func NewPrescriptionService() *PrescriptionService {
-	return &PrescriptionService{}
+// PrescriptionService stores prescriptions through its repo. The safety
+// checks in CheckPrescription, the patient alerts, the medication catalog
+// and the pharmacy worklist query the database directly.
+type PrescriptionService struct {
+	repo          PrescriptionRepo
+	notifications *NotificationService
+	medications   *MedicationService
+	twoFA         *auth.TwoFAService
 }
 
-func (s *PrescriptionService) CreatePrescription(prescription *models.Prescription) error {
-	fmt.Printf("Creating prescription in service: PatientID=%d, DoctorID=%d, Date=%s, Medication=%s\n",
-		prescription.PatientID, prescription.DoctorID, prescription.PrescribedDate, prescription.Medication)
+// NewPrescriptionService stores prescriptions in repo and texts patients
+// through notifications when theirs is ready; nil sends nothing
+func NewPrescriptionService(repo PrescriptionRepo, notifications *NotificationService) *PrescriptionService {
+	return &PrescriptionService{repo: repo, notifications: notifications, medications: NewMedicationService(),
+		twoFA: auth.NewTwoFAService()}
+}
 
-	query := `INSERT INTO Prescriptions (patient_id, doctor_id, prescribed_date, medication, dosage, duration, instructions)
-              VALUES (?, ?, ?, ?, ?, ?, ?)`
-	result, err := database.GetDB().Exec(query, prescription.PatientID, prescription.DoctorID, prescription.PrescribedDate,
-		prescription.Medication, prescription.Dosage, prescription.Duration, prescription.Instructions)
-	if err != nil {
-		fmt.Printf("Error executing prescription insert query: %v\n", err)
+// CreatePrescription links the prescription to the medication catalog, see
+// MedicationService.Resolve, and stores it
+func (s *PrescriptionService) CreatePrescription(ctx context.Context, prescription *models.Prescription) error {
+	if err := s.medications.Resolve(ctx, prescription); err != nil {
 		return err
 	}
-
-	id, _ := result.LastInsertId()
-	prescription.PrescriptionID = int(id)
-	fmt.Printf("Prescription created successfully with ID: %d\n", prescription.PrescriptionID)
-	return nil
+	return s.repo.Create(ctx, prescription)
 }
 
-func (s *PrescriptionService) GetPrescriptions() ([]*models.Prescription, error) {
-	var prescriptions []*models.Prescription
-	query := `SELECT prescription_id, patient_id, doctor_id, prescribed_date, medication, dosage, duration, instructions
-              FROM Prescriptions`
-	rows, err := database.GetDB().Query(query)
-	if err != nil {
-		return nil, err
+// CreateOverriddenPrescription creates a prescription despite safety warnings,
+// recording the prescriber's reason and the warnings in the audit log
+func (s *PrescriptionService) CreateOverriddenPrescription(ctx context.Context, prescription *models.Prescription, userID int, warnings []models.PrescriptionWarning) error {
+	if err := s.medications.Resolve(ctx, prescription); err != nil {
+		return err
 	}
-	defer rows.Close()
+	return s.repo.CreateOverridden(ctx, prescription, userID, warnings)
+}
 
-	for rows.Next() {
-		var prescription models.Prescription
-		err := rows.Scan(&prescription.PrescriptionID, &prescription.PatientID, &prescription.DoctorID,
-			&prescription.PrescribedDate, &prescription.Medication, &prescription.Dosage,
-			&prescription.Duration, &prescription.Instructions)
-		if err != nil {
+// Sign records the prescriber's signature once they re-enter their password
+// or a 2FA code; only signed prescriptions can be dispensed
+func (s *PrescriptionService) Sign(ctx context.Context, id, userID int, signature models.PrescriptionSignature) (*models.Prescription, error) {
+	if signature.Password != "" {
+		var hash string
+		if err := database.GetDB().QueryRowContext(ctx, `SELECT password_hash FROM Users WHERE user_id = ?`, userID).Scan(&hash); err != nil {
 			return nil, err
 		}
-		prescriptions = append(prescriptions, &prescription)
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(signature.Password)) != nil {
+			return nil, ErrSignatureCredentials
+		}
+	} else if valid, err := s.twoFA.VerifyTwoFA(ctx, userID, signature.Code); err != nil || !valid {
+		// VerifyTwoFA fails when the user has no 2FA, which is a wrong code too
+		return nil, ErrSignatureCredentials
 	}
+	return s.repo.Sign(ctx, id, userID)
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+// GetPrescriptions returns the page of prescriptions filter selects and how
+// many match it across all pages
+func (s *PrescriptionService) GetPrescriptions(ctx context.Context, filter PrescriptionFilter) ([]*models.Prescription, int, error) {
+	return s.repo.List(ctx, filter)
+}
 
-	return prescriptions, nil
+func (s *PrescriptionService) GetPrescription(ctx context.Context, id int) (*models.Prescription, error) {
+	return s.repo.Get(ctx, id)
 }
 
-func (s *PrescriptionService) GetPrescription(id int) (*models.Prescription, error) {
-	var prescription models.Prescription
-	query := `SELECT prescription_id, patient_id, doctor_id, prescribed_date, medication, dosage, duration, instructions
-              FROM Prescriptions WHERE prescription_id = ?`
-	err := database.GetDB().QueryRow(query, id).Scan(&prescription.PrescriptionID, &prescription.PatientID, &prescription.DoctorID,
-		&prescription.PrescribedDate, &prescription.Medication, &prescription.Dosage,
-		&prescription.Duration, &prescription.Instructions)
+// PatientOf returns the ID of the patient a prescription is for
+func (s *PrescriptionService) PatientOf(ctx context.Context, id int) (int, error) {
+	prescription, err := s.repo.Get(ctx, id)
 	if err != nil {
-		return nil, err
-	}
-
-	// TODO: Implement status check
-	if prescription.Status == "" {
-		prescription.Status = "active"
+		return 0, err
 	}
+	return prescription.PatientID, nil
+}
 
-	return &prescription, nil
+func (s *PrescriptionService) GetPrescriptionsByPatient(ctx context.Context, patientID int) ([]models.Prescription, error) {
+	return s.repo.ListByPatient(ctx, patientID)
 }
 
-func (s *PrescriptionService) GetPrescriptionsByPatient(patientId int) ([]models.Prescription, error) {
-	var prescriptions []models.Prescription
-	query := `SELECT prescription_id, patient_id, doctor_id, prescribed_date, medication, dosage, duration, instructions
-              FROM Prescriptions WHERE patient_id = ?`
-	rows, err := database.GetDB().Query(query, patientId)
+// GetPharmacyWorklist lists prescriptions from pharmacist_prescriptions_view,
+// oldest first, optionally only those with the given status; without one,
+// those still unsigned are left out
+func (s *PrescriptionService) GetPharmacyWorklist(ctx context.Context, status string) ([]models.PharmacistPrescription, error) {
+	query := `SELECT prescription_id, patient_id, patient_name, prescriber_name, prescribed_date, medication, medication_id, dosage,
+                  duration, instructions, status, ready_at, refill_count
+              FROM pharmacist_prescriptions_view`
+	var args []any
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	} else {
+		// Prescriptions waiting for their prescriber's signature can't be
+		// dispensed yet, so the pharmacy only sees them when it asks
+		query += ` WHERE status <> ?`
+		args = append(args, models.PRESCRIPTION_STATUS_UNSIGNED)
+	}
+	query += ` ORDER BY prescribed_date, prescription_id`
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	worklist := []models.PharmacistPrescription{}
 	for rows.Next() {
-		var prescription models.Prescription
-		err := rows.Scan(&prescription.PrescriptionID, &prescription.PatientID, &prescription.DoctorID,
-			&prescription.PrescribedDate, &prescription.Medication, &prescription.Dosage,
-			&prescription.Duration, &prescription.Instructions)
+		var prescription models.PharmacistPrescription
+		err := rows.Scan(&prescription.PrescriptionID, &prescription.PatientID, &prescription.PatientName, &prescription.PrescriberName,
+			&prescription.PrescribedDate, &prescription.Medication, &prescription.MedicationID, &prescription.Dosage, &prescription.Duration,
+			&prescription.Instructions, &prescription.Status, &prescription.ReadyAt, &prescription.RefillCount)
 		if err != nil {
 			return nil, err
 		}
+		worklist = append(worklist, prescription)
+	}
+	return worklist, rows.Err()
+}
 
-		// TODO: Implement status check
-		if prescription.Status == "" {
-			prescription.Status = "active"
-		}
+// MarkReady records that the pharmacy has the prescription ready and texts
+// the patient to collect it. The message doesn't name the medication.
+func (s *PrescriptionService) MarkReady(ctx context.Context, id, userID int) (*models.Prescription, error) {
+	prescription, err := s.repo.MarkReady(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
 
-		prescriptions = append(prescriptions, prescription)
+	if s.notifications != nil {
+		var phone string
+		err := database.GetDB().QueryRowContext(ctx, `SELECT COALESCE(contact_info, '') FROM Patients WHERE patient_id = ?`,
+			prescription.PatientID).Scan(&phone)
+		if err == nil {
+			err = s.notifications.Enqueue(ctx, database.GetDB(), &models.Notification{
+				Kind:       models.NOTIFICATION_PRESCRIPTION_READY,
+				Channel:    notifications.ChannelSMS,
+				Recipient:  phone,
+				Body:       "Your prescription is ready for collection at the hospital pharmacy.",
+				EntityType: models.ENTITY_PRESCRIPTION,
+				EntityID:   prescription.PrescriptionID,
+			}, time.Now())
+		}
+		// The prescription is ready either way; a lost text isn't worth failing the request
+		if err != nil {
+			slog.Error("Failed to queue prescription ready notification", "prescription", id, "error", err)
+		}
 	}
 
-	if err := rows.Err(); err != nil {
+	return prescription, nil
+}
+
+// ExportPatientPrescriptions builds a CSV of a patient's prescriptions, for download
+func (s *PrescriptionService) ExportPatientPrescriptions(ctx context.Context, patientID int) (*Download, error) {
+	prescriptions, err := s.repo.ListByPatient(ctx, patientID)
+	if err != nil {
 		return nil, err
 	}
 
-	return prescriptions, nil
+	rows := make([][]string, 0, len(prescriptions))
+	for _, prescription := range prescriptions {
+		rows = append(rows, []string{strconv.Itoa(prescription.PrescriptionID), prescription.PrescribedDate, prescription.Medication,
+			prescription.Dosage, prescription.Duration, prescription.Instructions, prescription.Status})
+	}
+
+	return CSVDownload(fmt.Sprintf("patient-%d-prescriptions.csv", patientID),
+		[]string{"prescription_id", "prescribed_date", "medication", "dosage", "duration", "instructions", "status"}, rows)
 }
@@ -0,0 +1,72 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/fakes"
+)
+
+func TestMarkReady(t *testing.T) {
+	ctx := context.Background()
+	repo := fakes.NewPrescriptionRepo()
+	// Without a notification service, MarkReady texts no one
+	prescriptions := services.NewPrescriptionService(repo, nil)
+	prescription := &models.Prescription{PatientID: 3, DoctorID: 5, Medication: "Amoxicillin", Dosage: "500 mg"}
+	if err := repo.Create(ctx, prescription); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := prescriptions.MarkReady(ctx, prescription.PrescriptionID, 9); !errors.Is(err, services.ErrPrescriptionUnsigned) {
+		t.Fatalf("an unsigned prescription: want ErrPrescriptionUnsigned, got %v", err)
+	}
+	if _, err := repo.Sign(ctx, prescription.PrescriptionID, prescription.DoctorID); err != nil {
+		t.Fatal(err)
+	}
+	ready, err := prescriptions.MarkReady(ctx, prescription.PrescriptionID, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready.Status != models.PRESCRIPTION_STATUS_READY {
+		t.Fatalf("status %q, want %q", ready.Status, models.PRESCRIPTION_STATUS_READY)
+	}
+	if _, err := prescriptions.MarkReady(ctx, prescription.PrescriptionID, 9); !errors.Is(err, services.ErrPrescriptionReady) {
+		t.Fatalf("marking ready twice: want ErrPrescriptionReady, got %v", err)
+	}
+}
+
+func TestGetPrescriptions(t *testing.T) {
+	ctx := context.Background()
+	repo := fakes.NewPrescriptionRepo()
+	prescriptions := services.NewPrescriptionService(repo, nil)
+	for _, p := range []models.Prescription{
+		{PatientID: 1, Medication: "Metformin", PrescribedDate: "2026-01-03"},
+		{PatientID: 2, Medication: "Amoxicillin", PrescribedDate: "2026-01-01"},
+		{PatientID: 1, Medication: "Amoxicillin", PrescribedDate: "2026-01-02"},
+	} {
+		if err := repo.Create(ctx, &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, total, err := prescriptions.GetPrescriptions(ctx, services.PrescriptionFilter{
+		Medication: "amox",
+		Sort:       models.PRESCRIPTION_SORT_PRESCRIBED_DATE,
+		Descending: true,
+		Limit:      1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(page) != 1 || page[0].PrescribedDate != "2026-01-02" {
+		t.Fatalf("got %d of %d, want the newest of 2 amoxicillin prescriptions", len(page), total)
+	}
+
+	patientID, err := prescriptions.PatientOf(ctx, page[0].PrescriptionID)
+	if err != nil || patientID != 1 {
+		t.Fatalf("PatientOf = %d, %v; want 1", patientID, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package privacy adds calibrated noise to aggregate statistics before they
+// are published outside the hospital, and suppresses small counts, so that
+// published numbers can't be combined to single out individual patients.
+//
+// Noise is drawn from a Laplace distribution and seeded from a secret key,
+// the statistic's name and its true value. Asking for the same statistic
+// repeatedly returns the same noisy value instead of fresh samples that
+// could be averaged away, and a change in the data draws new noise rather
+// than moving the published value by exactly that change. The threshold is
+// applied to the noisy value, so suppression doesn't reveal the true count
+// either.
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+)
+
+// Count is a published count. Value is nil when the count was suppressed.
+type Count struct {
+	Value      *int `json:"value"`
+	Suppressed bool `json:"suppressed,omitempty"`
+}
+
+// Mean is a published average. Value is nil when it was suppressed.
+type Mean struct {
+	Value      *float64 `json:"value"`
+	Suppressed bool     `json:"suppressed,omitempty"`
+}
+
+// Publisher applies the noise and threshold to statistics
+type Publisher struct {
+	// epsilon is the privacy budget per statistic; smaller means more noise
+	epsilon float64
+	// minCount is the smallest count published; smaller groups are suppressed
+	minCount int
+	key      []byte
+}
+
+// NewPublisher creates a publisher. An empty key is replaced by a random one,
+// so noise stays stable for the life of the process.
+func NewPublisher(epsilon float64, minCount int, key string) *Publisher {
+	secret := []byte(key)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	if epsilon <= 0 {
+		epsilon = 1
+	}
+
+	return &Publisher{epsilon: epsilon, minCount: minCount, key: secret}
+}
+
+// Count publishes a count named name (e.g. "visits:2026-03"). One patient
+// changes a count by at most one, so the noise scale is 1/epsilon.
+func (p *Publisher) Count(name string, n int) Count {
+	noisy := int(math.Round(float64(n) + p.laplace(name, float64(n), 1/p.epsilon)))
+	if noisy < p.minCount {
+		return Count{Suppressed: true}
+	}
+	return Count{Value: &noisy}
+}
+
+// Mean publishes the average of values, each clamped to [lower, upper] to
+// bound any one patient's influence. Half the budget goes to the sum and
+// half to the count.
+func (p *Publisher) Mean(name string, values []float64, lower, upper float64) Mean {
+	sum := 0.0
+	for _, value := range values {
+		sum += math.Max(lower, math.Min(upper, value))
+	}
+
+	budget := p.epsilon / 2
+	noisySum := sum + p.laplace(name+":sum", sum, math.Max(math.Abs(lower), math.Abs(upper))/budget)
+	noisyCount := float64(len(values)) + p.laplace(name+":count", float64(len(values)), 1/budget)
+	if noisyCount < float64(p.minCount) {
+		return Mean{Suppressed: true}
+	}
+
+	mean := math.Max(lower, math.Min(upper, noisySum/noisyCount))
+	mean = math.Round(mean*10) / 10
+	return Mean{Value: &mean}
+}
+
+// laplace returns Laplace(0, scale) noise for the statistic name, whose
+// true value is value, derived deterministically from both
+func (p *Publisher) laplace(name string, value, scale float64) float64 {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(name))
+	mac.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+	bits := binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+
+	// Uniform in (-0.5, 0.5), excluding the endpoints
+	u := (float64(bits>>11)+0.5)/float64(uint64(1)<<53) - 0.5
+	return -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
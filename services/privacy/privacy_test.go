@@ -0,0 +1,41 @@
+package privacy
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	p := NewPublisher(1, 10, "test key")
+
+	first, again := p.Count("visits:2026-03", 40), p.Count("visits:2026-03", 40)
+	if first.Value == nil || again.Value == nil || *first.Value != *again.Value {
+		t.Fatalf("the same count published as %+v and %+v", first, again)
+	}
+
+	// One more visit must not show as exactly one more, and the threshold
+	// applies to the noisy count, so true counts just under it are
+	// sometimes published and ones just over it sometimes withheld
+	exactStep, publishedUnder, withheldOver := 0, 0, 0
+	const names = 200
+	for i := range names {
+		name := fmt.Sprintf("visits:%d", i)
+		before, after := p.Count(name, 40), p.Count(name, 41)
+		if *after.Value-*before.Value == 1 {
+			exactStep++
+		}
+		if !p.Count(name, 9).Suppressed {
+			publishedUnder++
+		}
+		if p.Count(name, 11).Suppressed {
+			withheldOver++
+		}
+	}
+	if exactStep > names/2 {
+		t.Errorf("%d of %d counts moved by exactly the one added", exactStep, names)
+	}
+	if publishedUnder == 0 || withheldOver == 0 {
+		t.Errorf("%d counts under the threshold were published and %d over it withheld; the threshold must apply to the noisy count",
+			publishedUnder, withheldOver)
+	}
+}
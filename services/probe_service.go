@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+)
+
+// syntheticHistory is written sealed and must read back unchanged, so the
+// probe exercises column encryption too
+const syntheticHistory = "synthetic probe"
+
+// ProbeService runs synthetic transactions for external uptime monitors.
+// Its patients are marked synthetic, which keeps them out of patient
+// lookups, lists and reports; any a failed probe leaves behind are purged.
+type ProbeService struct {
+	purgeAfter time.Duration
+}
+
+func NewProbeService(purgeAfter time.Duration) *ProbeService {
+	return &ProbeService{purgeAfter: purgeAfter}
+}
+
+// Synthetic creates, reads back and deletes a synthetic patient, timing each
+// step. It stops at the first step that fails.
+func (s *ProbeService) Synthetic(ctx context.Context) *models.ProbeResult {
+	result := &models.ProbeResult{Status: models.PROBE_STATUS_OK, CheckedAt: time.Now(), Steps: []models.ProbeStep{}}
+	var id int64
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"create", func() (err error) {
+			id, err = s.createPatient(ctx)
+			return err
+		}},
+		{"read", func() error { return s.readPatient(ctx, id) }},
+		{"delete", func() error { return s.deletePatient(ctx, id) }},
+	}
+
+	for _, step := range steps {
+		started := time.Now()
+		err := step.run()
+		probeStep := models.ProbeStep{Name: step.name, DurationMs: milliseconds(time.Since(started))}
+		if err != nil {
+			probeStep.Error = err.Error()
+			result.Status = models.PROBE_STATUS_FAILED
+		}
+		result.Steps = append(result.Steps, probeStep)
+		if err != nil {
+			break
+		}
+	}
+	result.DurationMs = milliseconds(time.Since(result.CheckedAt))
+	return result
+}
+
+func (s *ProbeService) createPatient(ctx context.Context) (int64, error) {
+	marker := make([]byte, 8)
+	if _, err := rand.Read(marker); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO Patients (first_name, last_name, date_of_birth, gender, contact_info, address, medical_history, emergency_contact,
+                  registered_at, synthetic)
+              VALUES (?, ?, '', '', '', '', '', '', ?, TRUE)`
+		result, err := tx.ExecContext(ctx, query, "Synthetic", "Probe "+hex.EncodeToString(marker), time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		id, _ = result.LastInsertId()
+		return encryption.Store(ctx, tx, encryption.PatientMedicalHistory, int(id), syntheticHistory)
+	})
+	return id, err
+}
+
+func (s *ProbeService) readPatient(ctx context.Context, id int64) error {
+	patient := models.Patient{PatientID: int(id)}
+	err := database.ReadDB(database.WithPrimaryReads(ctx)).QueryRowContext(ctx, `SELECT medical_history FROM Patients
+              WHERE patient_id = ? AND synthetic`, id).Scan(&patient.MedicalHistory)
+	if err != nil {
+		return err
+	}
+	if err := openPatient(&patient); err != nil {
+		return err
+	}
+	if patient.MedicalHistory != syntheticHistory {
+		return errors.New("synthetic patient read back differently than written")
+	}
+	return nil
+}
+
+func (s *ProbeService) deletePatient(ctx context.Context, id int64) error {
+	result, err := database.GetDB().ExecContext(ctx, `DELETE FROM Patients WHERE patient_id = ? AND synthetic`, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected != 1 {
+		return fmt.Errorf("deleted %d synthetic patients, expected 1", affected)
+	}
+	return nil
+}
+
+// Purge deletes synthetic patients older than the purge age, returning how many
+func (s *ProbeService) Purge(ctx context.Context) (int64, error) {
+	result, err := database.GetDB().ExecContext(ctx, `DELETE FROM Patients WHERE synthetic AND registered_at < ?`,
+		time.Now().UTC().Add(-s.purgeAfter))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Run purges leftover synthetic patients every purge age until ctx is cancelled
+func (s *ProbeService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.purgeAfter)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.Purge(ctx)
+		if err != nil {
+			slog.Error("Synthetic patient purge failed", "error", err)
+		} else if purged > 0 {
+			slog.Info("Purged synthetic patients", "count", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/services/privacy"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// maxStayDays caps each stay's contribution to the published average length of stay
+const maxStayDays = 60
+
+// MonthlyStats are the published figures for one calendar month
+type MonthlyStats struct {
+	Month                   string        `json:"month"`
+	Visits                  privacy.Count `json:"visits"`
+	Admissions              privacy.Count `json:"admissions"`
+	AverageLengthOfStayDays privacy.Mean  `json:"averageLengthOfStayDays"`
+}
+
+// PublicStats is the de-identified statistics report served without authentication
+type PublicStats struct {
+	Months      []MonthlyStats `json:"months"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+}
+
+// PublicStatsService computes aggregate statistics for publication. Every
+// figure passes through the privacy publisher: small counts are suppressed
+// and the rest carry noise.
+type PublicStatsService struct {
+	publisher *privacy.Publisher
+}
+
+func NewPublicStatsService(publisher *privacy.Publisher) *PublicStatsService {
+	return &PublicStatsService{publisher: publisher}
+}
+
+// GetStats reports the last `months` closed calendar months. The current
+// month is left out: its figures change with each visit and admission, and
+// publishing them live would show every one.
+func (s *PublicStatsService) GetStats(ctx context.Context, months int) (*PublicStats, error) {
+	now := timezone.Now()
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	start := end.AddDate(0, -months, 0)
+
+	visits, err := s.visitCounts(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	admissions, stays, err := s.admissionStats(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &PublicStats{Months: []MonthlyStats{}, GeneratedAt: now}
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		key := month.Format("2006-01")
+		stats.Months = append(stats.Months, MonthlyStats{
+			Month:                   key,
+			Visits:                  s.publisher.Count("visits:"+key, visits[key]),
+			Admissions:              s.publisher.Count("admissions:"+key, admissions[key]),
+			AverageLengthOfStayDays: s.publisher.Mean("length-of-stay:"+key, stays[key], 0, maxStayDays),
+		})
+	}
+
+	return stats, nil
+}
+
+// visitCounts counts medical record visits per month since start
+func (s *PublicStatsService) visitCounts(ctx context.Context, start time.Time) (map[string]int, error) {
+	query := `SELECT substr(CAST(visit_date AS TEXT), 1, 7), COUNT(*) FROM MedicalRecords
+              WHERE visit_date >= ? GROUP BY 1`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, start.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var month string
+		var count int
+		if err := rows.Scan(&month, &count); err != nil {
+			return nil, err
+		}
+		counts[month] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// admissionStats counts admissions per month since start and collects the
+// lengths of stay, in days, of those already discharged
+func (s *PublicStatsService) admissionStats(ctx context.Context, start time.Time) (map[string]int, map[string][]float64, error) {
+	query := `SELECT admitted_at, discharged_at FROM Admissions WHERE admitted_at >= ?`
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, start.UTC())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	stays := map[string][]float64{}
+	for rows.Next() {
+		var admittedAt time.Time
+		var dischargedAt *time.Time
+		if err := rows.Scan(&admittedAt, &dischargedAt); err != nil {
+			return nil, nil, err
+		}
+
+		month := timezone.In(admittedAt).Format("2006-01")
+		counts[month]++
+		if dischargedAt != nil {
+			stays[month] = append(stays[month], dischargedAt.Sub(admittedAt).Hours()/24)
+		}
+	}
+
+	return counts, stays, rows.Err()
+}
@@ -0,0 +1,20 @@
+package services
+
+import (
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// QueryStatsService reports the database statements the server has run,
+// for finding the slow and the frequent ones. The reset-query-stats ops
+// action starts the counts afresh.
+type QueryStatsService struct{}
+
+func NewQueryStatsService() *QueryStatsService {
+	return &QueryStatsService{}
+}
+
+// GetStats returns the limit statements largest by sortBy
+func (s *QueryStatsService) GetStats(sortBy string, limit int) models.QueryStats {
+	return database.QueryStats(sortBy, limit)
+}
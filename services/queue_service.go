@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+var (
+	// ErrAlreadyQueued is returned when checking in a patient who is already in the department's queue today
+	ErrAlreadyQueued = errors.New("patient is already in this queue")
+	// ErrQueueEmpty is returned when calling the next patient from a queue nobody is waiting in
+	ErrQueueEmpty = errors.New("no patients are waiting")
+	// ErrQueueEntryState is returned when completing an entry that hasn't been
+	// called, or finishing one that is already finished
+	ErrQueueEntryState = errors.New("queue entry is not in a state that allows this")
+)
+
+const (
+	// defaultQueueServiceTime is assumed per patient until a department has
+	// finished seeing some
+	defaultQueueServiceTime = 10 * time.Minute
+	// queueServiceSample is how many recently finished patients the
+	// service time is averaged over
+	queueServiceSample = 20
+)
+
+// QueueService runs the walk-in queues of departments. A queue is the
+// day's: tickets are numbered from 1 each facility-local day, and patients
+// still waiting at the end of the day drop off it.
+type QueueService struct{}
+
+func NewQueueService() *QueueService {
+	return &QueueService{}
+}
+
+// CheckIn adds a walk-in patient to the end of the department's queue, or
+// ahead of everyone of normal priority when urgent
+func (s *QueueService) CheckIn(ctx context.Context, department string, checkIn models.QueueCheckIn, userID int) (*models.QueueEntry, error) {
+	department = normalizeDepartment(department)
+	if checkIn.Priority == "" {
+		checkIn.Priority = models.QUEUE_PRIORITY_NORMAL
+	}
+	day := queueDay()
+
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		dept, err := getDepartment(ctx, tx, department)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUnknownDepartment
+		}
+		if err != nil {
+			return err
+		}
+		if !dept.Active {
+			return ErrDepartmentInactive
+		}
+		if err := checkPatient(ctx, tx, checkIn.PatientID); err != nil {
+			return err
+		}
+
+		var queued int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM QueueEntries
+                  WHERE department_code = ? AND queue_date = ? AND patient_id = ? AND status IN (?, ?)`,
+			department, day, checkIn.PatientID, models.QUEUE_STATUS_WAITING, models.QUEUE_STATUS_CALLED).Scan(&queued)
+		if err != nil {
+			return err
+		}
+		if queued > 0 {
+			return ErrAlreadyQueued
+		}
+
+		var ticket int
+		err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(ticket), 0) + 1 FROM QueueEntries WHERE department_code = ? AND queue_date = ?`,
+			department, day).Scan(&ticket)
+		if err != nil {
+			return err
+		}
+
+		query := `INSERT INTO QueueEntries (department_code, queue_date, ticket, patient_id, priority, reason, status, checked_in_by, checked_in_at)
+                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, department, day, ticket, checkIn.PatientID, checkIn.Priority, checkIn.Reason,
+			models.QUEUE_STATUS_WAITING, userID, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		id, _ = result.LastInsertId()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEntry(database.WithPrimaryReads(ctx), int(id))
+}
+
+// GetEntry returns a queue entry, with its place in the queue while it waits
+func (s *QueueService) GetEntry(ctx context.Context, id int) (*models.QueueEntry, error) {
+	entries, err := queryQueueEntries(ctx, database.ReadDB(ctx), `WHERE q.entry_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	entry := entries[0]
+	if entry.Status != models.QUEUE_STATUS_WAITING {
+		return &entry, nil
+	}
+
+	queue, err := s.GetQueue(ctx, entry.Department)
+	if err != nil {
+		return nil, err
+	}
+	for _, waiting := range queue.Waiting {
+		if waiting.EntryID == id {
+			return &waiting, nil
+		}
+	}
+	// Left over from an earlier day's queue
+	return &entry, nil
+}
+
+// GetQueue returns the department's queue today. Each waiting patient's
+// estimated wait is the patients ahead of them and those being seen, shared
+// among the staff seeing patients, at the department's recent average
+// service time.
+func (s *QueueService) GetQueue(ctx context.Context, department string) (*models.Queue, error) {
+	department = normalizeDepartment(department)
+	db := database.ReadDB(ctx)
+	dept, err := getDepartment(ctx, db, department)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := &models.Queue{
+		Department:  dept.Code,
+		Name:        dept.Name,
+		GeneratedAt: timezone.Now(),
+	}
+	day := queueDay()
+	queue.Called, err = queryQueueEntries(ctx, db, `WHERE q.department_code = ? AND q.queue_date = ? AND q.status = ?
+              ORDER BY q.called_at, q.entry_id`, department, day, models.QUEUE_STATUS_CALLED)
+	if err != nil {
+		return nil, err
+	}
+	queue.Waiting, err = queryQueueEntries(ctx, db, `WHERE q.department_code = ? AND q.queue_date = ? AND q.status = ?
+              ORDER BY CASE q.priority WHEN ? THEN 0 ELSE 1 END, q.checked_in_at, q.entry_id`,
+		department, day, models.QUEUE_STATUS_WAITING, models.QUEUE_PRIORITY_URGENT)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := averageServiceTime(ctx, db, department)
+	if err != nil {
+		return nil, err
+	}
+	queue.AvgServiceMinutes = ceilMinutes(service)
+	beingSeen := len(queue.Called)
+	for i := range queue.Waiting {
+		wait := ceilMinutes(time.Duration(i+beingSeen) * service / time.Duration(max(beingSeen, 1)))
+		queue.Waiting[i].Position = i + 1
+		queue.Waiting[i].EstimatedWaitMinutes = &wait
+	}
+	return queue, nil
+}
+
+// GetBoard returns the department's queue as a waiting-room display shows it
+func (s *QueueService) GetBoard(ctx context.Context, department string) (*models.QueueBoard, error) {
+	queue, err := s.GetQueue(ctx, department)
+	if err != nil {
+		return nil, err
+	}
+
+	board := &models.QueueBoard{
+		Department:  queue.Department,
+		Name:        queue.Name,
+		NowServing:  make([]models.QueueBoardTicket, len(queue.Called)),
+		Waiting:     make([]models.QueueBoardTicket, len(queue.Waiting)),
+		GeneratedAt: queue.GeneratedAt,
+	}
+	// Most recently called first, as boards announce them
+	for i, entry := range queue.Called {
+		board.NowServing[len(queue.Called)-1-i] = models.QueueBoardTicket{Ticket: entry.Ticket, Room: entry.Room}
+	}
+	for i, entry := range queue.Waiting {
+		board.Waiting[i] = models.QueueBoardTicket{Ticket: entry.Ticket, EstimatedWaitMinutes: entry.EstimatedWaitMinutes}
+	}
+	return board, nil
+}
+
+// CallNext calls the first waiting patient in the department's queue to
+// room. Calling the next patient finishes the caller's previous one in the
+// department, as completed.
+func (s *QueueService) CallNext(ctx context.Context, department, room string, userID int) (*models.QueueEntry, error) {
+	department = normalizeDepartment(department)
+	day := queueDay()
+
+	var id int
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := getDepartment(ctx, tx, department); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		_, err := tx.ExecContext(ctx, `UPDATE QueueEntries SET status = ?, finished_at = ?
+                  WHERE department_code = ? AND status = ? AND called_by = ?`,
+			models.QUEUE_STATUS_COMPLETED, now, department, models.QUEUE_STATUS_CALLED, userID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `SELECT entry_id FROM QueueEntries
+                  WHERE department_code = ? AND queue_date = ? AND status = ?
+                  ORDER BY CASE priority WHEN ? THEN 0 ELSE 1 END, checked_in_at, entry_id LIMIT 1`,
+			department, day, models.QUEUE_STATUS_WAITING, models.QUEUE_PRIORITY_URGENT).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrQueueEmpty
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE QueueEntries SET status = ?, room = ?, called_at = ?, called_by = ?
+                  WHERE entry_id = ?`, models.QUEUE_STATUS_CALLED, strings.TrimSpace(room), now, userID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEntry(database.WithPrimaryReads(ctx), id)
+}
+
+// Complete finishes a called patient as seen
+func (s *QueueService) Complete(ctx context.Context, id int) (*models.QueueEntry, error) {
+	return s.finish(ctx, id, models.QUEUE_STATUS_COMPLETED, models.QUEUE_STATUS_CALLED)
+}
+
+// Leave takes a patient who left, or didn't answer when called, off the queue
+func (s *QueueService) Leave(ctx context.Context, id int) (*models.QueueEntry, error) {
+	return s.finish(ctx, id, models.QUEUE_STATUS_LEFT, models.QUEUE_STATUS_WAITING, models.QUEUE_STATUS_CALLED)
+}
+
+// finish moves an entry in one of the from statuses to status, telling an
+// unknown entry (sql.ErrNoRows) apart from one in the wrong state
+func (s *QueueService) finish(ctx context.Context, id int, status string, from ...string) (*models.QueueEntry, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(from)), ", ")
+		args := []any{status, time.Now().UTC(), id}
+		for _, f := range from {
+			args = append(args, f)
+		}
+		result, err := tx.ExecContext(ctx, `UPDATE QueueEntries SET status = ?, finished_at = ?
+                  WHERE entry_id = ? AND status IN (`+placeholders+`)`, args...)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			return nil
+		}
+
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM QueueEntries WHERE entry_id = ?`, id).Scan(&exists); err != nil {
+			return err
+		}
+		return ErrQueueEntryState
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEntry(database.WithPrimaryReads(ctx), id)
+}
+
+// averageServiceTime averages the time from called to finished over the
+// department's recently completed patients
+func averageServiceTime(ctx context.Context, q querier, department string) (time.Duration, error) {
+	rows, err := q.QueryContext(ctx, `SELECT called_at, finished_at FROM QueueEntries
+              WHERE department_code = ? AND status = ? AND called_at IS NOT NULL
+              ORDER BY finished_at DESC LIMIT ?`, department, models.QUEUE_STATUS_COMPLETED, queueServiceSample)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// Summed in Go: SQLite has no duration type
+	var total time.Duration
+	count := 0
+	for rows.Next() {
+		var calledAt, finishedAt time.Time
+		if err := rows.Scan(&calledAt, &finishedAt); err != nil {
+			return 0, err
+		}
+		total += finishedAt.Sub(calledAt)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return defaultQueueServiceTime, nil
+	}
+	return total / time.Duration(count), nil
+}
+
+// queueDay is the facility-local date today's queues are kept under
+func queueDay() string {
+	return timezone.Now().Format("2006-01-02")
+}
+
+func ceilMinutes(d time.Duration) int {
+	return int(math.Ceil(d.Minutes()))
+}
+
+// queueTicket shows a ticket number with the department it is for, e.g. "CAR-007"
+func queueTicket(department string, number int) string {
+	prefix := []rune(strings.ToUpper(department))
+	if len(prefix) > 3 {
+		prefix = prefix[:3]
+	}
+	return fmt.Sprintf("%s-%03d", string(prefix), number)
+}
+
+func queryQueueEntries(ctx context.Context, q querier, clause string, args ...any) ([]models.QueueEntry, error) {
+	query := `SELECT q.entry_id, q.department_code, q.ticket, q.patient_id, COALESCE(p.first_name, ''), COALESCE(p.last_name, ''),
+                  q.priority, COALESCE(q.reason, ''), q.status, COALESCE(q.room, ''), q.checked_in_at, q.checked_in_by,
+                  q.called_at, q.called_by, q.finished_at
+              FROM QueueEntries q
+              LEFT JOIN Patients p ON p.patient_id = q.patient_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.QueueEntry{}
+	for rows.Next() {
+		var e models.QueueEntry
+		var ticket int
+		var firstName, lastName string
+		var calledAt, finishedAt sql.NullTime
+		var calledBy sql.NullInt64
+		if err := rows.Scan(&e.EntryID, &e.Department, &ticket, &e.PatientID, &firstName, &lastName, &e.Priority, &e.Reason,
+			&e.Status, &e.Room, &e.CheckedInAt, &e.CheckedInBy, &calledAt, &calledBy, &finishedAt); err != nil {
+			return nil, err
+		}
+		e.Ticket = queueTicket(e.Department, ticket)
+		e.PatientName = strings.TrimSpace(firstName + " " + lastName)
+		e.CheckedInAt = timezone.In(e.CheckedInAt)
+		if calledAt.Valid {
+			t := timezone.In(calledAt.Time)
+			e.CalledAt = &t
+		}
+		if calledBy.Valid {
+			by := int(calledBy.Int64)
+			e.CalledBy = &by
+		}
+		if finishedAt.Valid {
+			t := timezone.In(finishedAt.Time)
+			e.FinishedAt = &t
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrTemplateSectionKeys is returned when saving a template that uses a
+	// section key twice
+	ErrTemplateSectionKeys = errors.New("template section keys must be unique")
+	// ErrUnknownTemplate is returned when a medical record names a template
+	// that doesn't exist
+	ErrUnknownTemplate = errors.New("record template does not exist")
+	// ErrTemplateInactive is returned when writing a record from a retired template
+	ErrTemplateInactive = errors.New("record template is no longer in use")
+	// ErrRecordSections is returned when a record's sections don't fit its
+	// template: an unknown or repeated key, or a required section left empty
+	ErrRecordSections = errors.New("sections don't match the record template")
+)
+
+// RecordTemplateService manages the visit templates doctors write medical
+// records from, e.g. an annual physical, each a list of sections
+type RecordTemplateService struct {
+	audit *AuditService
+}
+
+func NewRecordTemplateService() *RecordTemplateService {
+	return &RecordTemplateService{audit: NewAuditService()}
+}
+
+// GetTemplates lists every template, including retired ones
+func (s *RecordTemplateService) GetTemplates(ctx context.Context) ([]models.RecordTemplate, error) {
+	return queryRecordTemplates(ctx, database.ReadDB(ctx), `ORDER BY name`)
+}
+
+func (s *RecordTemplateService) GetTemplate(ctx context.Context, code string) (*models.RecordTemplate, error) {
+	return getRecordTemplate(ctx, database.ReadDB(ctx), code)
+}
+
+// SaveTemplate creates a template or updates the one with the same code.
+// Records already written from it keep their sections.
+func (s *RecordTemplateService) SaveTemplate(ctx context.Context, template *models.RecordTemplate, userID int) error {
+	template.Code = strings.ToLower(strings.TrimSpace(template.Code))
+	seen := map[string]bool{}
+	for i := range template.Sections {
+		section := &template.Sections[i]
+		section.Key = strings.ToLower(strings.TrimSpace(section.Key))
+		if seen[section.Key] {
+			return fmt.Errorf("%w: %s", ErrTemplateSectionKeys, section.Key)
+		}
+		seen[section.Key] = true
+	}
+	sections, err := json.Marshal(template.Sections)
+	if err != nil {
+		return err
+	}
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO RecordTemplates (code, name, description, sections, active) VALUES (?, ?, ?, ?, ?)
+                  ON CONFLICT (code) DO UPDATE SET name = excluded.name, description = excluded.description,
+                      sections = excluded.sections, active = excluded.active`
+		if _, err := tx.ExecContext(ctx, query, template.Code, template.Name, template.Description, string(sections), template.Active); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_RECORD_TEMPLATE_SAVED, "", 0, template)
+	})
+}
+
+// applyRecordTemplate checks record's sections against its template and
+// puts them in the template's order with the template's titles, a section
+// the record leaves out being empty. A record without a template may not
+// have sections.
+func applyRecordTemplate(ctx context.Context, q querier, record *models.MedicalRecord) error {
+	if record.TemplateCode == "" {
+		if len(record.Sections) > 0 {
+			return fmt.Errorf("%w: sections need a template_code", ErrRecordSections)
+		}
+		return nil
+	}
+
+	record.TemplateCode = strings.ToLower(strings.TrimSpace(record.TemplateCode))
+	template, err := getRecordTemplate(ctx, q, record.TemplateCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrUnknownTemplate, record.TemplateCode)
+	} else if err != nil {
+		return err
+	}
+	if !template.Active {
+		return fmt.Errorf("%w: %s", ErrTemplateInactive, template.Code)
+	}
+
+	known := map[string]bool{}
+	for _, section := range template.Sections {
+		known[section.Key] = true
+	}
+	content := map[string]string{}
+	for _, section := range record.Sections {
+		key := strings.ToLower(strings.TrimSpace(section.Key))
+		if !known[key] {
+			return fmt.Errorf("%w: %s is not a section of %s", ErrRecordSections, key, template.Code)
+		}
+		if _, ok := content[key]; ok {
+			return fmt.Errorf("%w: %s is given twice", ErrRecordSections, key)
+		}
+		content[key] = strings.TrimSpace(section.Content)
+	}
+
+	sections := make([]models.RecordSection, 0, len(template.Sections))
+	for _, section := range template.Sections {
+		if section.Required && content[section.Key] == "" {
+			return fmt.Errorf("%w: %s is required", ErrRecordSections, section.Key)
+		}
+		sections = append(sections, models.RecordSection{Key: section.Key, Title: section.Title, Content: content[section.Key]})
+	}
+	record.Sections = sections
+	return nil
+}
+
+func getRecordTemplate(ctx context.Context, q querier, code string) (*models.RecordTemplate, error) {
+	templates, err := queryRecordTemplates(ctx, q, `WHERE code = ?`, code)
+	if err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &templates[0], nil
+}
+
+func queryRecordTemplates(ctx context.Context, q querier, clause string, args ...any) ([]models.RecordTemplate, error) {
+	query := `SELECT code, name, COALESCE(description, ''), sections, active FROM RecordTemplates ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.RecordTemplate{}
+	for rows.Next() {
+		var t models.RecordTemplate
+		var sections string
+		if err := rows.Scan(&t.Code, &t.Name, &t.Description, &sections, &t.Active); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(sections), &t.Sections); err != nil {
+			return nil, fmt.Errorf("record template %s: %w", t.Code, err)
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
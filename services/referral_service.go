@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+var (
+	// ErrSelfReferral is returned when a doctor refers a patient to themselves
+	ErrSelfReferral = errors.New("doctors can't refer patients to themselves")
+	// ErrNoSpecialist is returned for a department referral to a specialty no doctor practises
+	ErrNoSpecialist = errors.New("no doctor practises this specialty")
+	// ErrReferralDecided is returned when deciding a referral that was already accepted or declined
+	ErrReferralDecided = errors.New("referral has already been decided")
+	// ErrNotReferralRecipient is returned when a doctor decides a referral that isn't addressed to them or their department
+	ErrNotReferralRecipient = errors.New("referral is not addressed to you")
+)
+
+// ReferralFilter narrows GetReferrals; zero fields are ignored
+type ReferralFilter struct {
+	// DoctorID selects the doctor's referrals in Direction, or in both
+	// directions when Direction is empty
+	DoctorID int
+	// Direction is one of the models.REFERRAL_DIRECTION_ directions
+	Direction string
+	PatientID int
+	Status    string
+}
+
+// ReferralService tracks referrals between doctors until the receiving
+// doctor accepts or declines them, booking an appointment with them on
+// request
+type ReferralService struct {
+	appointments *AppointmentService
+	audit        *AuditService
+}
+
+func NewReferralService(appointments *AppointmentService) *ReferralService {
+	return &ReferralService{appointments: appointments, audit: NewAuditService()}
+}
+
+// Create records a pending referral from referral.FromDoctorID
+func (s *ReferralService) Create(ctx context.Context, referral *models.Referral) (*models.Referral, error) {
+	referral.Specialty = normalizeSpecialty(referral.Specialty)
+
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, referral.PatientID).Scan(&exists); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrUnknownPatient
+			}
+			return err
+		}
+
+		if referral.ToDoctorID != nil {
+			if *referral.ToDoctorID == referral.FromDoctorID {
+				return ErrSelfReferral
+			}
+			if err := checkDoctor(ctx, tx, *referral.ToDoctorID); err != nil {
+				return err
+			}
+		} else {
+			var specialists int
+			err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM DoctorSpecialties WHERE specialty = ? AND doctor_id <> ?`,
+				referral.Specialty, referral.FromDoctorID).Scan(&specialists)
+			if err != nil {
+				return err
+			}
+			if specialists == 0 {
+				return ErrNoSpecialist
+			}
+		}
+
+		query := `INSERT INTO Referrals (patient_id, from_doctor_id, to_doctor_id, specialty, reason, urgency, status, created_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, referral.PatientID, referral.FromDoctorID, referral.ToDoctorID, referral.Specialty,
+			referral.Reason, referral.Urgency, models.REFERRAL_STATUS_PENDING, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		id, _ = result.LastInsertId()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetReferral(database.WithPrimaryReads(ctx), int(id))
+}
+
+// GetReferrals lists referrals matching filter, most urgent first and then
+// oldest first, so a doctor's inbound list is their queue
+func (s *ReferralService) GetReferrals(ctx context.Context, filter ReferralFilter) ([]models.Referral, error) {
+	clause := `WHERE 1 = 1`
+	var args []any
+	inbound := `(r.to_doctor_id = ? OR (r.to_doctor_id IS NULL AND r.specialty IN (SELECT specialty FROM DoctorSpecialties WHERE doctor_id = ?)))`
+	if filter.DoctorID != 0 {
+		switch filter.Direction {
+		case models.REFERRAL_DIRECTION_INBOUND:
+			clause += ` AND ` + inbound
+			args = append(args, filter.DoctorID, filter.DoctorID)
+		case models.REFERRAL_DIRECTION_OUTBOUND:
+			clause += ` AND r.from_doctor_id = ?`
+			args = append(args, filter.DoctorID)
+		default:
+			clause += ` AND (r.from_doctor_id = ? OR ` + inbound + `)`
+			args = append(args, filter.DoctorID, filter.DoctorID, filter.DoctorID)
+		}
+	}
+	if filter.PatientID != 0 {
+		clause += ` AND r.patient_id = ?`
+		args = append(args, filter.PatientID)
+	}
+	if filter.Status != "" {
+		clause += ` AND r.status = ?`
+		args = append(args, filter.Status)
+	}
+	clause += ` ORDER BY CASE r.urgency WHEN 'emergency' THEN 0 WHEN 'urgent' THEN 1 ELSE 2 END, r.created_at, r.referral_id`
+	return queryReferrals(ctx, database.ReadDB(ctx), clause, args...)
+}
+
+func (s *ReferralService) GetReferral(ctx context.Context, id int) (*models.Referral, error) {
+	referrals, err := queryReferrals(ctx, database.ReadDB(ctx), `WHERE r.referral_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(referrals) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &referrals[0], nil
+}
+
+// Decide records the receiving doctor's decision: the named doctor, or for
+// a department referral any doctor of the department, who then becomes its
+// recipient. Accepting with an appointment books it with the doctor in the
+// same transaction, so the referral is only accepted if the booking succeeds.
+func (s *ReferralService) Decide(ctx context.Context, id, doctorID int, decision *models.ReferralDecision) (*models.Referral, error) {
+	err := database.InTx(ctx, func(ctx context.Context) error {
+		tx, _ := database.TxFromContext(ctx)
+
+		var referral models.Referral
+		err := tx.QueryRowContext(ctx, `SELECT patient_id, to_doctor_id, specialty, reason, status FROM Referrals WHERE referral_id = ?`, id).
+			Scan(&referral.PatientID, &referral.ToDoctorID, &referral.Specialty, &referral.Reason, &referral.Status)
+		if err != nil {
+			return err
+		}
+		if referral.Status != models.REFERRAL_STATUS_PENDING {
+			return ErrReferralDecided
+		}
+
+		if referral.ToDoctorID != nil {
+			if *referral.ToDoctorID != doctorID {
+				return ErrNotReferralRecipient
+			}
+		} else {
+			var practises int
+			err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM DoctorSpecialties WHERE doctor_id = ? AND specialty = ?`,
+				doctorID, referral.Specialty).Scan(&practises)
+			if err != nil {
+				return err
+			}
+			if practises == 0 {
+				return ErrNotReferralRecipient
+			}
+		}
+
+		var appointmentID sql.NullInt64
+		if decision.Status == models.REFERRAL_STATUS_ACCEPTED && decision.Appointment != nil {
+			appointment := &models.Appointment{
+				PatientID: referral.PatientID,
+				DoctorID:  doctorID,
+				Specialty: referral.Specialty,
+				StartsAt:  decision.Appointment.StartsAt,
+				EndsAt:    decision.Appointment.EndsAt,
+				Reason:    "Referral: " + referral.Reason,
+				BookedBy:  doctorID,
+			}
+			if err := s.appointments.Book(ctx, appointment); err != nil {
+				return err
+			}
+			appointmentID = sql.NullInt64{Int64: int64(appointment.AppointmentID), Valid: true}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE Referrals SET status = ?, to_doctor_id = ?, decided_at = ?, decision_notes = ?, appointment_id = ?
+              WHERE referral_id = ?`, decision.Status, doctorID, time.Now().UTC(), decision.Notes, appointmentID, id)
+		if err != nil {
+			return err
+		}
+
+		details := map[string]any{"status": decision.Status, "patientId": referral.PatientID}
+		if appointmentID.Valid {
+			details["appointmentId"] = appointmentID.Int64
+		}
+		return s.audit.Log(ctx, tx, doctorID, models.AUDIT_REFERRAL_DECISION, models.ENTITY_REFERRAL, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetReferral(database.WithPrimaryReads(ctx), id)
+}
+
+func queryReferrals(ctx context.Context, q querier, clause string, args ...any) ([]models.Referral, error) {
+	query := `SELECT r.referral_id, r.patient_id, r.from_doctor_id, f.full_name, r.to_doctor_id, COALESCE(t.full_name, ''), r.specialty,
+                  r.reason, r.urgency, r.status, r.created_at, r.decided_at, COALESCE(r.decision_notes, ''), r.appointment_id
+              FROM Referrals r
+              JOIN Users f ON f.user_id = r.from_doctor_id
+              LEFT JOIN Users t ON t.user_id = r.to_doctor_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrals := []models.Referral{}
+	for rows.Next() {
+		var r models.Referral
+		err := rows.Scan(&r.ReferralID, &r.PatientID, &r.FromDoctorID, &r.FromDoctorName, &r.ToDoctorID, &r.ToDoctorName, &r.Specialty,
+			&r.Reason, &r.Urgency, &r.Status, &r.CreatedAt, &r.DecidedAt, &r.DecisionNotes, &r.AppointmentID)
+		if err != nil {
+			return nil, err
+		}
+		referrals = append(referrals, r)
+	}
+	return referrals, rows.Err()
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+var (
+	// ErrRefillPending is returned when the prescription already has a refill request awaiting a doctor
+	ErrRefillPending = errors.New("prescription already has a pending refill request")
+	// ErrRefillDecided is returned when deciding a request that was already approved or denied
+	ErrRefillDecided = errors.New("refill request has already been decided")
+)
+
+// RefillService tracks refill requests from patients and the front desk
+// until a doctor approves or denies them
+type RefillService struct {
+	audit  *AuditService
+	events *EventService
+}
+
+func NewRefillService() *RefillService {
+	return &RefillService{audit: NewAuditService(), events: NewEventService()}
+}
+
+// CreateRequest records a pending refill request for the prescription
+func (s *RefillService) CreateRequest(ctx context.Context, prescriptionID int, req *models.RefillRequest) (*models.RefillRequest, error) {
+	var id int64
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var patientID int
+		err := tx.QueryRowContext(ctx, `SELECT patient_id FROM Prescriptions WHERE prescription_id = ?`, prescriptionID).Scan(&patientID)
+		if err != nil {
+			return err
+		}
+
+		var pending int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM RefillRequests WHERE prescription_id = ? AND status = ?`,
+			prescriptionID, models.REFILL_STATUS_PENDING).Scan(&pending)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrRefillPending
+		}
+
+		query := `INSERT INTO RefillRequests (prescription_id, patient_id, source, notes, status, requested_by, requested_at)
+              VALUES (?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, prescriptionID, patientID, req.Source, req.Notes, models.REFILL_STATUS_PENDING,
+			req.RequestedBy, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		id, _ = result.LastInsertId()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRequest(database.WithPrimaryReads(ctx), int(id))
+}
+
+// GetRequests lists requests, oldest first so the queue is worked in order,
+// optionally for one patient and/or status
+func (s *RefillService) GetRequests(ctx context.Context, patientID int, status string) ([]models.RefillRequest, error) {
+	var conditions []string
+	var args []any
+	if patientID != 0 {
+		conditions = append(conditions, "r.patient_id = ?")
+		args = append(args, patientID)
+	}
+	if status != "" {
+		conditions = append(conditions, "r.status = ?")
+		args = append(args, status)
+	}
+
+	clause := ""
+	if len(conditions) > 0 {
+		clause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	return queryRefillRequests(ctx, database.ReadDB(ctx), clause+" ORDER BY r.requested_at", args...)
+}
+
+func (s *RefillService) GetRequest(ctx context.Context, id int) (*models.RefillRequest, error) {
+	requests, err := queryRefillRequests(ctx, database.ReadDB(ctx), `WHERE r.refill_request_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &requests[0], nil
+}
+
+// Decide records a doctor's decision. Approving creates the refill: a copy of
+// the prescription dated today, prescribed by the deciding doctor, with the
+// refill count one higher, which the doctor then signs like any other.
+func (s *RefillService) Decide(ctx context.Context, id, doctorID int, decision *models.RefillDecision) (*models.RefillRequest, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var status string
+		var prescriptionID int
+		err := tx.QueryRowContext(ctx, `SELECT status, prescription_id FROM RefillRequests WHERE refill_request_id = ?`, id).Scan(&status, &prescriptionID)
+		if err != nil {
+			return err
+		}
+		if status != models.REFILL_STATUS_PENDING {
+			return ErrRefillDecided
+		}
+
+		var refillID sql.NullInt64
+		if decision.Status == models.REFILL_STATUS_APPROVED {
+			refill, err := s.createRefill(ctx, tx, prescriptionID, doctorID)
+			if err != nil {
+				return err
+			}
+			refillID = sql.NullInt64{Int64: int64(refill.PrescriptionID), Valid: true}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE RefillRequests SET status = ?, decided_by = ?, decided_at = ?, decision_notes = ?, refill_prescription_id = ?
+              WHERE refill_request_id = ?`, decision.Status, doctorID, time.Now().UTC(), decision.Notes, refillID, id)
+		if err != nil {
+			return err
+		}
+
+		details := map[string]any{"status": decision.Status, "prescriptionId": prescriptionID}
+		if refillID.Valid {
+			details["refillPrescriptionId"] = refillID.Int64
+		}
+		return s.audit.Log(ctx, tx, doctorID, models.AUDIT_REFILL_DECISION, models.ENTITY_REFILL_REQUEST, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRequest(database.WithPrimaryReads(ctx), id)
+}
+
+// createRefill inserts the refill of prescriptionID and records it as a clinical event
+func (s *RefillService) createRefill(ctx context.Context, tx *sql.Tx, prescriptionID, doctorID int) (*models.Prescription, error) {
+	var original models.Prescription
+	err := tx.QueryRowContext(ctx, `SELECT patient_id, medication, medication_id, COALESCE(dosage, ''), COALESCE(duration, ''), COALESCE(instructions, ''), refill_count
+              FROM Prescriptions WHERE prescription_id = ?`, prescriptionID).Scan(&original.PatientID, &original.Medication, &original.MedicationID,
+		&original.Dosage, &original.Duration, &original.Instructions, &original.RefillCount)
+	if err != nil {
+		return nil, err
+	}
+
+	refill := original
+	refill.DoctorID = doctorID
+	refill.PrescribedDate = timezone.Now().Format("2006-01-02")
+	refill.Status = models.PRESCRIPTION_STATUS_UNSIGNED
+	refill.RefillOf = &prescriptionID
+	refill.RefillCount = original.RefillCount + 1
+
+	query := `INSERT INTO Prescriptions (patient_id, doctor_id, prescribed_date, medication, medication_id, dosage, duration, instructions, refill_of, refill_count)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, refill.PatientID, refill.DoctorID, refill.PrescribedDate, refill.Medication, refill.MedicationID, refill.Dosage,
+		refill.Duration, refill.Instructions, refill.RefillOf, refill.RefillCount)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := result.LastInsertId()
+	refill.PrescriptionID = int(id)
+
+	if err := s.events.Append(ctx, tx, models.ENTITY_PRESCRIPTION, refill.PrescriptionID, models.EVENT_PRESCRIPTION_CREATED, refill); err != nil {
+		return nil, err
+	}
+	return &refill, nil
+}
+
+func queryRefillRequests(ctx context.Context, q *sql.DB, clause string, args ...any) ([]models.RefillRequest, error) {
+	query := `SELECT r.refill_request_id, r.prescription_id, r.patient_id, p.medication, r.source, COALESCE(r.notes, ''), r.status,
+                  r.requested_by, r.requested_at, r.decided_by, r.decided_at, COALESCE(r.decision_notes, ''), r.refill_prescription_id
+              FROM RefillRequests r
+              JOIN Prescriptions p ON p.prescription_id = r.prescription_id ` + clause
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.RefillRequest{}
+	for rows.Next() {
+		var r models.RefillRequest
+		err := rows.Scan(&r.RefillRequestID, &r.PrescriptionID, &r.PatientID, &r.Medication, &r.Source, &r.Notes, &r.Status,
+			&r.RequestedBy, &r.RequestedAt, &r.DecidedBy, &r.DecidedAt, &r.DecisionNotes, &r.RefillPrescriptionID)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
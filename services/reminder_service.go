@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// appointmentReminder is a reminder sent a fixed time before appointments
+type appointmentReminder struct {
+	name string
+	lead time.Duration
+	// wanted says whether the patient takes this reminder
+	wanted func(c reminderCandidate) bool
+}
+
+// appointmentReminders are sent in this order, longest lead first
+var appointmentReminders = []appointmentReminder{
+	{"24h", 24 * time.Hour, func(c reminderCandidate) bool { return c.dayBefore }},
+	{"1h", time.Hour, func(c reminderCandidate) bool { return c.hourBefore }},
+}
+
+// ReminderService texts patients reminders of their appointments from a
+// worker goroutine started with Run. Each reminder queued for an
+// appointment is recorded in AppointmentReminders in the same transaction,
+// so a reminder is queued once however many times the scan runs, across
+// restarts and between servers.
+type ReminderService struct {
+	notifications *NotificationService
+}
+
+// NewReminderService queues reminders through notifications (nil sends none)
+func NewReminderService(notifications *NotificationService) *ReminderService {
+	return &ReminderService{notifications: notifications}
+}
+
+// reminderCandidate is a scheduled appointment with a reminder due
+type reminderCandidate struct {
+	appointmentID int
+	startsAt      time.Time
+	doctorName    string
+	phone         string
+	dayBefore     bool
+	hourBefore    bool
+}
+
+// GetPreferences returns the patient's reminder preferences
+func (s *ReminderService) GetPreferences(ctx context.Context, patientID int) (*models.ReminderPreferences, error) {
+	db := database.ReadDB(ctx)
+	if err := checkPatient(ctx, db, patientID); err != nil {
+		return nil, err
+	}
+
+	prefs := &models.ReminderPreferences{PatientID: patientID}
+	var updatedBy int
+	var updatedAt time.Time
+	err := db.QueryRowContext(ctx, `SELECT day_before, hour_before, updated_by, updated_at FROM ReminderPreferences
+              WHERE patient_id = ?`, patientID).Scan(&prefs.DayBefore, &prefs.HourBefore, &updatedBy, &updatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		prefs.DayBefore, prefs.HourBefore = true, true
+	case err != nil:
+		return nil, err
+	default:
+		updatedAt = timezone.In(updatedAt)
+		prefs.UpdatedBy, prefs.UpdatedAt = &updatedBy, &updatedAt
+	}
+	return prefs, nil
+}
+
+// SetPreferences saves the patient's reminder preferences. Reminders
+// already queued are still sent; opting out stops the ones not yet due.
+func (s *ReminderService) SetPreferences(ctx context.Context, prefs *models.ReminderPreferences, userID int) error {
+	now := time.Now().UTC()
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkPatient(ctx, tx, prefs.PatientID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO ReminderPreferences (patient_id, day_before, hour_before, updated_by, updated_at)
+              VALUES (?, ?, ?, ?, ?)
+              ON CONFLICT (patient_id) DO UPDATE SET day_before = excluded.day_before, hour_before = excluded.hour_before,
+                  updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+			prefs.PatientID, prefs.DayBefore, prefs.HourBefore, userID, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	updatedAt := timezone.In(now)
+	prefs.UpdatedBy, prefs.UpdatedAt = &userID, &updatedAt
+	return nil
+}
+
+// Run queues the reminders that have come due every interval until ctx is
+// cancelled
+func (s *ReminderService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.remindDue(ctx); err != nil {
+			slog.Error("Appointment reminders failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// remindDue queues a reminder for each scheduled appointment that has
+// entered a reminder's lead time without one. An appointment booked or
+// found late, inside several leads at once, gets just the latest reminder;
+// the earlier ones are recorded as passed over.
+func (s *ReminderService) remindDue(ctx context.Context) error {
+	now := time.Now().UTC()
+	last := appointmentReminders[len(appointmentReminders)-1]
+	query := `SELECT a.appointment_id, a.starts_at, COALESCE(u.full_name, ''), COALESCE(p.contact_info, ''),
+                  COALESCE(rp.day_before, TRUE), COALESCE(rp.hour_before, TRUE)
+              FROM Appointments a
+              JOIN Patients p ON p.patient_id = a.patient_id
+              LEFT JOIN Users u ON u.user_id = a.doctor_id
+              LEFT JOIN ReminderPreferences rp ON rp.patient_id = a.patient_id
+              WHERE a.status = ? AND a.starts_at > ? AND a.starts_at <= ?
+                  AND NOT EXISTS (SELECT 1 FROM AppointmentReminders r WHERE r.appointment_id = a.appointment_id AND r.reminder = ?)
+              ORDER BY a.starts_at`
+	rows, err := database.ReadDB(database.WithPrimaryReads(ctx)).QueryContext(ctx, query, models.APPOINTMENT_STATUS_SCHEDULED,
+		now, now.Add(appointmentReminders[0].lead), last.name)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var due []reminderCandidate
+	for rows.Next() {
+		var c reminderCandidate
+		if err := rows.Scan(&c.appointmentID, &c.startsAt, &c.doctorName, &c.phone, &c.dayBefore, &c.hourBefore); err != nil {
+			return err
+		}
+		due = append(due, c)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, c := range due {
+		if err := s.remind(ctx, c, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remind records every reminder due for the appointment and queues the
+// latest, unless the patient has opted out of it. Nothing is queued when
+// another run has already recorded that reminder.
+func (s *ReminderService) remind(ctx context.Context, c reminderCandidate, now time.Time) error {
+	var due []appointmentReminder
+	for _, reminder := range appointmentReminders {
+		if !c.startsAt.Add(-reminder.lead).After(now) {
+			due = append(due, reminder)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	latest := due[len(due)-1]
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var claimed bool
+		for _, reminder := range due {
+			result, err := tx.ExecContext(ctx, `INSERT INTO AppointmentReminders (appointment_id, reminder, queued_at)
+                  VALUES (?, ?, ?) ON CONFLICT (appointment_id, reminder) DO NOTHING`, c.appointmentID, reminder.name, now)
+			if err != nil {
+				return err
+			}
+			affected, _ := result.RowsAffected()
+			claimed = affected > 0
+		}
+		if !claimed || !latest.wanted(c) {
+			return nil
+		}
+
+		local := timezone.In(c.startsAt)
+		n := &models.Notification{
+			Kind:      models.NOTIFICATION_APPOINTMENT_REMINDER,
+			Channel:   notifications.ChannelSMS,
+			Recipient: c.phone,
+			Body: fmt.Sprintf("Reminder: you have an appointment with %s on %s at %s.", c.doctorName,
+				local.Format("Mon 2 Jan 2006"), local.Format("15:04 MST")),
+			EntityType: models.ENTITY_APPOINTMENT,
+			EntityID:   c.appointmentID,
+		}
+		if err := s.notifications.Enqueue(ctx, tx, n, now); err != nil {
+			return err
+		}
+		if n.NotificationID == 0 {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE AppointmentReminders SET notification_id = ? WHERE appointment_id = ? AND reminder = ?`,
+			n.NotificationID, c.appointmentID, latest.name)
+		return err
+	})
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// ErrUnknownReport is returned for a report name that isn't predefined
+var ErrUnknownReport = errors.New("unknown report")
+
+// reportFunc runs a report over the facility-local dates from to to,
+// inclusive, passing each row to emit as it is read
+type reportFunc func(ctx context.Context, db *sql.DB, from, to time.Time, emit func(row []any) error) error
+
+type report struct {
+	models.ReportDefinition
+	run reportFunc
+}
+
+// reports are the predefined reports. They are aggregates only, so they are
+// safe to email.
+var reports = []report{
+	{models.ReportDefinition{Name: "new_patients", Title: "New patients",
+		Description: "Patients registered on each day of the range, excluding synthetic probe patients",
+		Columns:     []string{"date", "patients"}}, newPatientsReport},
+	{models.ReportDefinition{Name: "prescriptions_by_drug_class", Title: "Prescriptions by drug class",
+		Description: "Prescriptions written in the range by the drug class of their catalog entry; prescriptions not linked to the catalog count as Uncatalogued",
+		Columns:     []string{"drug_class", "prescriptions", "patients"}}, prescriptionsByDrugClassReport},
+	{models.ReportDefinition{Name: "visits_per_department", Title: "Visits per department",
+		Description: "Visits in the range by the department, i.e. specialty, of the doctor seen; a doctor with several specialties counts under the first alphabetically",
+		Columns:     []string{"department", "visits", "patients"}}, visitsPerDepartmentReport},
+}
+
+// ReportService runs the predefined reports and emails scheduled ones
+// through the notification queue from a worker started with Run
+type ReportService struct {
+	notifications *NotificationService
+}
+
+// NewReportService queues scheduled reports through notifications; nil
+// sends nothing
+func NewReportService(notifications *NotificationService) *ReportService {
+	return &ReportService{notifications: notifications}
+}
+
+// Definitions lists the predefined reports
+func (s *ReportService) Definitions() []models.ReportDefinition {
+	definitions := make([]models.ReportDefinition, len(reports))
+	for i, r := range reports {
+		definitions[i] = r.ReportDefinition
+	}
+	return definitions
+}
+
+// Definition describes the named report, failing with ErrUnknownReport
+func (s *ReportService) Definition(name string) (*models.ReportDefinition, error) {
+	r, err := findReport(name)
+	if err != nil {
+		return nil, err
+	}
+	return &r.ReportDefinition, nil
+}
+
+func findReport(name string) (*report, error) {
+	for i := range reports {
+		if reports[i].Name == name {
+			return &reports[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownReport, name)
+}
+
+// Report runs the named report over the dates from to to, inclusive
+func (s *ReportService) Report(ctx context.Context, name string, from, to time.Time) (*models.Report, error) {
+	r, err := findReport(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.Report{
+		ReportDefinition: r.ReportDefinition,
+		From:             from.Format("2006-01-02"),
+		To:               to.Format("2006-01-02"),
+		GeneratedAt:      time.Now(),
+		Rows:             []map[string]any{},
+	}
+	err = r.run(ctx, database.ReadDB(ctx), from, to, func(row []any) error {
+		values := make(map[string]any, len(row))
+		for i, column := range r.Columns {
+			values[column] = row[i]
+		}
+		result.Rows = append(result.Rows, values)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WriteCSV runs the named report, writing it to w as CSV row by row. It
+// fails before writing anything for an unknown report.
+func (s *ReportService) WriteCSV(ctx context.Context, name string, from, to time.Time, w io.Writer) error {
+	r, err := findReport(name)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(r.Columns); err != nil {
+		return err
+	}
+	err = r.run(ctx, database.ReadDB(ctx), from, to, func(row []any) error {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = fmt.Sprint(value)
+		}
+		return writer.Write(escapeFormulas(cells))
+	})
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func newPatientsReport(ctx context.Context, db *sql.DB, from, to time.Time, emit func(row []any) error) error {
+	rows, err := db.QueryContext(ctx, `SELECT registered_at FROM Patients WHERE registered_at >= ? AND registered_at < ? AND NOT synthetic`,
+		from.UTC(), to.AddDate(0, 0, 1).UTC())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// registered_at is a UTC timestamp, so the facility-local day is worked out here
+	counts := map[string]int{}
+	for rows.Next() {
+		var registeredAt time.Time
+		if err := rows.Scan(&registeredAt); err != nil {
+			return err
+		}
+		counts[timezone.In(registeredAt).Format("2006-01-02")]++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		if err := emit([]any{date, counts[date]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func prescriptionsByDrugClassReport(ctx context.Context, db *sql.DB, from, to time.Time, emit func(row []any) error) error {
+	return emitCounts(ctx, db, emit, `SELECT CASE WHEN p.medication_id IS NULL THEN 'Uncatalogued' ELSE COALESCE(m.drug_class, 'Unclassified') END,
+                  COUNT(*), COUNT(DISTINCT p.patient_id)
+              FROM Prescriptions p
+              LEFT JOIN Medications m ON m.medication_id = p.medication_id
+              WHERE p.prescribed_date >= ? AND p.prescribed_date <= ?
+              GROUP BY 1
+              ORDER BY 2 DESC, 1`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
+
+func visitsPerDepartmentReport(ctx context.Context, db *sql.DB, from, to time.Time, emit func(row []any) error) error {
+	return emitCounts(ctx, db, emit, `SELECT COALESCE((SELECT MIN(s.specialty) FROM DoctorSpecialties s WHERE s.doctor_id = m.doctor_id), 'Unassigned'),
+                  COUNT(*), COUNT(DISTINCT m.patient_id)
+              FROM MedicalRecords m
+              WHERE m.visit_date >= ? AND m.visit_date <= ?
+              GROUP BY 1
+              ORDER BY 2 DESC, 1`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+}
+
+// emitCounts runs a query returning (group, count, patients) rows
+func emitCounts(ctx context.Context, db *sql.DB, emit func(row []any) error, query string, args ...any) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var group string
+		var count, patients int
+		if err := rows.Scan(&group, &count, &patients); err != nil {
+			return err
+		}
+		if err := emit([]any{group, count, patients}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CreateSchedule schedules a report to be emailed, first at the next run
+// time for its frequency
+func (s *ReportService) CreateSchedule(ctx context.Context, schedule *models.ReportSchedule, userID int) error {
+	if _, err := findReport(schedule.Report); err != nil {
+		return err
+	}
+
+	schedule.CreatedBy = userID
+	schedule.CreatedAt = time.Now().UTC()
+	schedule.NextRunAt = nextReportRun(schedule.Frequency, schedule.CreatedAt)
+	schedule.LastRunAt = nil
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO ReportSchedules (report, frequency, recipient, created_by, created_at, next_run_at) VALUES (?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, schedule.Report, schedule.Frequency, schedule.Recipient,
+			schedule.CreatedBy, schedule.CreatedAt, schedule.NextRunAt)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		schedule.ScheduleID = int(id)
+		return nil
+	})
+}
+
+func (s *ReportService) GetSchedules(ctx context.Context) ([]models.ReportSchedule, error) {
+	return s.querySchedules(ctx, `ORDER BY schedule_id`)
+}
+
+// DeleteSchedule stops a scheduled report; a report already queued is still sent
+func (s *ReportService) DeleteSchedule(ctx context.Context, id int) error {
+	result, err := database.GetDB().ExecContext(ctx, `DELETE FROM ReportSchedules WHERE schedule_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Run emails the scheduled reports that are due every interval until ctx
+// is cancelled
+func (s *ReportService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sendDue(ctx); err != nil {
+			slog.Error("Scheduled reports failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDue queues every due report. A report that fails stays due and is
+// tried again on the next run.
+func (s *ReportService) sendDue(ctx context.Context) error {
+	now := time.Now().UTC()
+	due, err := s.querySchedules(database.WithPrimaryReads(ctx), `WHERE next_run_at <= ? ORDER BY next_run_at`, now)
+	if err != nil {
+		return err
+	}
+
+	for _, schedule := range due {
+		if err := s.send(ctx, schedule, now); err != nil {
+			slog.Error("Scheduled report failed", "schedule", schedule.ScheduleID, "report", schedule.Report, "error", err)
+		}
+	}
+	return nil
+}
+
+// send runs a due report over the period before its run time and queues it
+// as an email. Runs missed while the server was down are not caught up.
+func (s *ReportService) send(ctx context.Context, schedule models.ReportSchedule, now time.Time) error {
+	runDay := timezone.StartOfDay(timezone.In(schedule.NextRunAt))
+	to := runDay.AddDate(0, 0, -1)
+	from := to
+	if schedule.Frequency == models.REPORT_FREQUENCY_WEEKLY {
+		from = runDay.AddDate(0, 0, -7)
+	}
+
+	r, err := findReport(schedule.Report)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if err := s.WriteCSV(ctx, schedule.Report, from, to, &body); err != nil {
+		return err
+	}
+
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		// Claiming the run by moving it on keeps two servers from both sending it
+		result, err := tx.ExecContext(ctx, `UPDATE ReportSchedules SET next_run_at = ?, last_run_at = ?
+              WHERE schedule_id = ? AND next_run_at <= ?`,
+			nextReportRun(schedule.Frequency, now), now, schedule.ScheduleID, now)
+		if err != nil {
+			return err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return nil
+		}
+
+		period := from.Format("2006-01-02")
+		if !to.Equal(from) {
+			period += " to " + to.Format("2006-01-02")
+		}
+		n := &models.Notification{
+			Kind:       models.NOTIFICATION_REPORT,
+			Channel:    notifications.ChannelEmail,
+			Recipient:  schedule.Recipient,
+			Subject:    fmt.Sprintf("%s, %s", r.Title, period),
+			Body:       body.String(),
+			EntityType: models.ENTITY_REPORT_SCHEDULE,
+			EntityID:   schedule.ScheduleID,
+		}
+		return s.notifications.Enqueue(ctx, tx, n, now)
+	})
+}
+
+// nextReportRun is the facility-local midnight starting the next day, or
+// the next Monday for weekly reports, after t
+func nextReportRun(frequency string, t time.Time) time.Time {
+	next := timezone.StartOfDay(timezone.In(t)).AddDate(0, 0, 1)
+	if frequency == models.REPORT_FREQUENCY_WEEKLY {
+		for next.Weekday() != time.Monday {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next.UTC()
+}
+
+func (s *ReportService) querySchedules(ctx context.Context, clause string, args ...any) ([]models.ReportSchedule, error) {
+	query := `SELECT schedule_id, report, frequency, recipient, created_by, created_at, next_run_at, last_run_at
+              FROM ReportSchedules ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.ReportSchedule{}
+	for rows.Next() {
+		var schedule models.ReportSchedule
+		var lastRunAt sql.NullTime
+		err := rows.Scan(&schedule.ScheduleID, &schedule.Report, &schedule.Frequency, &schedule.Recipient,
+			&schedule.CreatedBy, &schedule.CreatedAt, &schedule.NextRunAt, &lastRunAt)
+		if err != nil {
+			return nil, err
+		}
+		if lastRunAt.Valid {
+			schedule.LastRunAt = &lastRunAt.Time
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// ReportFilename names a downloaded report, e.g. new_patients_2026-01-01_2026-01-31.csv
+func ReportFilename(name string, from, to time.Time) string {
+	return name + "_" + from.Format("2006-01-02") + "_" + to.Format("2006-01-02") + ".csv"
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// Repositories abstract storage for the core entities so the services built
+// on them can run against SQLite in production and against the in-memory
+// fakes in services/fakes in tests. Lookups of a missing row return
+// sql.ErrNoRows, which response.WriteServiceError maps to 404, whatever the
+// implementation.
+
+// PatientRepo stores patients. Writes also record the matching clinical event.
+type PatientRepo interface {
+	Create(ctx context.Context, patient *models.Patient) error
+	Get(ctx context.Context, id int) (*models.Patient, error)
+	List(ctx context.Context) ([]models.Patient, error)
+	// Each calls fn with the patients List would return, one at a time,
+	// stopping at fn's first error
+	Each(ctx context.Context, fn func(patient models.Patient) error) error
+	Update(ctx context.Context, id int, patient *models.Patient, changedBy int) error
+	Delete(ctx context.Context, id int) error
+	// Changes lists the demographic changes Update recorded, newest first
+	Changes(ctx context.Context, patientID int) ([]models.PatientChange, error)
+}
+
+// UserRepo stores staff accounts
+type UserRepo interface {
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id int) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	List(ctx context.Context) ([]*models.User, error)
+	Search(ctx context.Context, filter UserFilter) ([]*models.User, int, error)
+	UpdateProfile(ctx context.Context, id int, profile *models.ProfileUpdate) error
+	SetActive(ctx context.Context, id int, active bool) error
+	UpdateRole(ctx context.Context, id int, role string) error
+	SetPasswordHash(ctx context.Context, id int, hash string) error
+}
+
+// MedicalRecordFilter narrows ListNurseView
+type MedicalRecordFilter struct {
+	// DoctorIDs selects the records written by these doctors; nil selects
+	// every record and an empty list none
+	DoctorIDs []int
+	// ExpandPatient adds a summary of each record's patient; the nurse view
+	// has no doctor to expand
+	ExpandPatient bool
+}
+
+// MedicalRecordRepo stores medical records and serves the nurse view, which
+// omits treatment plans and doctor notes
+type MedicalRecordRepo interface {
+	Create(ctx context.Context, record *models.MedicalRecord) error
+	Get(ctx context.Context, id int) (*models.MedicalRecord, error)
+	List(ctx context.Context) ([]models.MedicalRecord, error)
+	ListByPatient(ctx context.Context, patientID int) ([]models.MedicalRecord, error)
+	GetNurseView(ctx context.Context, id int) (*models.MedicalRecordNurseView, error)
+	ListNurseView(ctx context.Context, filter MedicalRecordFilter) ([]models.MedicalRecordNurseView, error)
+	ListNurseViewByPatient(ctx context.Context, patientID int) ([]models.MedicalRecordNurseView, error)
+}
+
+// PrescriptionRepo stores prescriptions
+type PrescriptionRepo interface {
+	Create(ctx context.Context, prescription *models.Prescription) error
+	// CreateOverridden stores a prescription issued despite safety warnings
+	// together with the audit entry recording who overrode them and why
+	CreateOverridden(ctx context.Context, prescription *models.Prescription, userID int, warnings []models.PrescriptionWarning) error
+	Get(ctx context.Context, id int) (*models.Prescription, error)
+	// List returns the page of prescriptions filter selects and the number
+	// matching it across all pages
+	List(ctx context.Context, filter PrescriptionFilter) ([]*models.Prescription, int, error)
+	ListByPatient(ctx context.Context, patientID int) ([]models.Prescription, error)
+	// Sign records the prescriber's signature, failing with
+	// ErrPrescriptionSigner if userID didn't write the prescription and
+	// ErrPrescriptionSigned if it was already signed
+	Sign(ctx context.Context, id, userID int) (*models.Prescription, error)
+	// MarkReady records that the pharmacy has the prescription ready for
+	// collection, failing with ErrPrescriptionUnsigned if it isn't signed
+	// and ErrPrescriptionReady if it already was
+	MarkReady(ctx context.Context, id, userID int) (*models.Prescription, error)
+}
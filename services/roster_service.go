@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+var (
+	// ErrNotADoctor is returned when a roster or booking names a user who isn't a doctor
+	ErrNotADoctor = errors.New("user is not a doctor")
+	// ErrShiftOverlap is returned when a doctor's shifts would overlap
+	ErrShiftOverlap = errors.New("shift overlaps another shift for the same doctor")
+)
+
+// RosterService manages doctors' specialties, duty shifts and time off, and
+// works out when they are free to be booked
+type RosterService struct{}
+
+func NewRosterService() *RosterService {
+	return &RosterService{}
+}
+
+// GetDoctors lists doctors with their specialties, optionally only those
+// with specialty and those assigned to department
+func (s *RosterService) GetDoctors(ctx context.Context, specialty, department string) ([]models.Doctor, error) {
+	return getDoctors(ctx, database.ReadDB(ctx), normalizeSpecialty(specialty), normalizeDepartment(department))
+}
+
+// SetSpecialties replaces a doctor's specialties
+func (s *RosterService) SetSpecialties(ctx context.Context, doctorID int, specialties []string) (*models.Doctor, error) {
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkDoctor(ctx, tx, doctorID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM DoctorSpecialties WHERE doctor_id = ?`, doctorID); err != nil {
+			return err
+		}
+		for _, specialty := range specialties {
+			if specialty = normalizeSpecialty(specialty); specialty == "" {
+				continue
+			}
+			query := `INSERT INTO DoctorSpecialties (doctor_id, specialty) VALUES (?, ?) ON CONFLICT DO NOTHING`
+			if _, err := tx.ExecContext(ctx, query, doctorID, specialty); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doctors, err := getDoctors(ctx, database.GetDB(), "", "")
+	if err != nil {
+		return nil, err
+	}
+	for _, doctor := range doctors {
+		if doctor.DoctorID == doctorID {
+			return &doctor, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// CreateShift rosters a doctor on duty
+func (s *RosterService) CreateShift(ctx context.Context, shift *models.DutyShift) error {
+	shift.StartsAt, shift.EndsAt = shift.StartsAt.UTC(), shift.EndsAt.UTC()
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkDoctor(ctx, tx, shift.DoctorID); err != nil {
+			return err
+		}
+
+		var overlapping int
+		query := `SELECT COUNT(*) FROM DutyShifts WHERE doctor_id = ? AND starts_at < ? AND ends_at > ?`
+		if err := tx.QueryRowContext(ctx, query, shift.DoctorID, shift.EndsAt, shift.StartsAt).Scan(&overlapping); err != nil {
+			return err
+		}
+		if overlapping > 0 {
+			return ErrShiftOverlap
+		}
+
+		result, err := tx.ExecContext(ctx, `INSERT INTO DutyShifts (doctor_id, starts_at, ends_at, created_by) VALUES (?, ?, ?, ?)`,
+			shift.DoctorID, shift.StartsAt, shift.EndsAt, shift.CreatedBy)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		shift.ShiftID = int(id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	shift.StartsAt, shift.EndsAt = timezone.In(shift.StartsAt), timezone.In(shift.EndsAt)
+	return nil
+}
+
+// GetShifts lists shifts overlapping [from, to), optionally for one doctor
+func (s *RosterService) GetShifts(ctx context.Context, doctorID int, from, to time.Time) ([]models.DutyShift, error) {
+	query := `SELECT s.shift_id, s.doctor_id, COALESCE(u.full_name, ''), s.starts_at, s.ends_at, s.created_by
+              FROM DutyShifts s
+              LEFT JOIN Users u ON u.user_id = s.doctor_id
+              WHERE s.starts_at < ? AND s.ends_at > ?`
+	args := []any{to.UTC(), from.UTC()}
+	if doctorID != 0 {
+		query += ` AND s.doctor_id = ?`
+		args = append(args, doctorID)
+	}
+	query += ` ORDER BY s.starts_at, s.doctor_id`
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shifts := []models.DutyShift{}
+	for rows.Next() {
+		var shift models.DutyShift
+		if err := rows.Scan(&shift.ShiftID, &shift.DoctorID, &shift.DoctorName, &shift.StartsAt, &shift.EndsAt, &shift.CreatedBy); err != nil {
+			return nil, err
+		}
+		shift.StartsAt, shift.EndsAt = timezone.In(shift.StartsAt), timezone.In(shift.EndsAt)
+		shifts = append(shifts, shift)
+	}
+	return shifts, rows.Err()
+}
+
+// DeleteShift removes a shift. Appointments already booked in it are kept.
+func (s *RosterService) DeleteShift(ctx context.Context, id int) error {
+	result, err := database.GetDB().ExecContext(ctx, `DELETE FROM DutyShifts WHERE shift_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateTimeOff records a period the doctor is away. Appointments already
+// booked in it are kept for reception to rebook.
+func (s *RosterService) CreateTimeOff(ctx context.Context, timeOff *models.TimeOff) error {
+	timeOff.StartsAt, timeOff.EndsAt = timeOff.StartsAt.UTC(), timeOff.EndsAt.UTC()
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		if err := checkDoctor(ctx, tx, timeOff.DoctorID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `INSERT INTO DoctorTimeOff (doctor_id, starts_at, ends_at, reason, created_by) VALUES (?, ?, ?, ?, ?)`,
+			timeOff.DoctorID, timeOff.StartsAt, timeOff.EndsAt, timeOff.Reason, timeOff.CreatedBy)
+		if err != nil {
+			return err
+		}
+		id, _ := result.LastInsertId()
+		timeOff.TimeOffID = int(id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	timeOff.StartsAt, timeOff.EndsAt = timezone.In(timeOff.StartsAt), timezone.In(timeOff.EndsAt)
+	return nil
+}
+
+// GetTimeOff lists time off overlapping [from, to), optionally for one doctor
+func (s *RosterService) GetTimeOff(ctx context.Context, doctorID int, from, to time.Time) ([]models.TimeOff, error) {
+	query := `SELECT t.time_off_id, t.doctor_id, COALESCE(u.full_name, ''), t.starts_at, t.ends_at, COALESCE(t.reason, ''), t.created_by
+              FROM DoctorTimeOff t
+              LEFT JOIN Users u ON u.user_id = t.doctor_id
+              WHERE t.starts_at < ? AND t.ends_at > ?`
+	args := []any{to.UTC(), from.UTC()}
+	if doctorID != 0 {
+		query += ` AND t.doctor_id = ?`
+		args = append(args, doctorID)
+	}
+	query += ` ORDER BY t.starts_at, t.doctor_id`
+
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	periods := []models.TimeOff{}
+	for rows.Next() {
+		var timeOff models.TimeOff
+		if err := rows.Scan(&timeOff.TimeOffID, &timeOff.DoctorID, &timeOff.DoctorName, &timeOff.StartsAt, &timeOff.EndsAt,
+			&timeOff.Reason, &timeOff.CreatedBy); err != nil {
+			return nil, err
+		}
+		timeOff.StartsAt, timeOff.EndsAt = timezone.In(timeOff.StartsAt), timezone.In(timeOff.EndsAt)
+		periods = append(periods, timeOff)
+	}
+	return periods, rows.Err()
+}
+
+func (s *RosterService) DeleteTimeOff(ctx context.Context, id int) error {
+	result, err := database.GetDB().ExecContext(ctx, `DELETE FROM DoctorTimeOff WHERE time_off_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAvailability lists the doctor's open slots of the given length between
+// from and to. Slots start at the shift's start and every slot length after,
+// and are open when no time off or scheduled appointment overlaps them.
+func (s *RosterService) GetAvailability(ctx context.Context, doctorID int, from, to time.Time, slot time.Duration) (*models.Availability, error) {
+	db := database.ReadDB(ctx)
+	if err := checkDoctor(ctx, db, doctorID); err != nil {
+		return nil, err
+	}
+
+	availability := &models.Availability{
+		DoctorID:    doctorID,
+		From:        timezone.In(from),
+		To:          timezone.In(to),
+		SlotMinutes: int(slot.Minutes()),
+		Slots:       []models.Slot{},
+	}
+	if err := db.QueryRowContext(ctx, `SELECT full_name FROM Users WHERE user_id = ?`, doctorID).Scan(&availability.DoctorName); err != nil {
+		return nil, err
+	}
+
+	shifts, err := s.GetShifts(ctx, doctorID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := busyPeriods(ctx, db, doctorID, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, shift := range shifts {
+		for start := shift.StartsAt; !start.Add(slot).After(shift.EndsAt); start = start.Add(slot) {
+			end := start.Add(slot)
+			if start.Before(from) || end.After(to) || overlapsAny(busy, start, end) {
+				continue
+			}
+			availability.Slots = append(availability.Slots, models.Slot{StartsAt: timezone.In(start), EndsAt: timezone.In(end)})
+		}
+	}
+	return availability, nil
+}
+
+// checkWorking fails with ErrOffDuty unless one of the doctor's shifts
+// covers the whole slot and they have no time off in it
+func checkWorking(ctx context.Context, q queryRower, doctorID int, start, end time.Time) error {
+	var covering, away int
+	query := `SELECT (SELECT COUNT(*) FROM DutyShifts WHERE doctor_id = ? AND starts_at <= ? AND ends_at >= ?),
+                     (SELECT COUNT(*) FROM DoctorTimeOff WHERE doctor_id = ? AND starts_at < ? AND ends_at > ?)`
+	if err := q.QueryRowContext(ctx, query, doctorID, start, end, doctorID, end, start).Scan(&covering, &away); err != nil {
+		return err
+	}
+	if covering == 0 || away > 0 {
+		return ErrOffDuty
+	}
+	return nil
+}
+
+// busyPeriods lists the doctor's time off and scheduled appointments
+// overlapping [from, to)
+func busyPeriods(ctx context.Context, q querier, doctorID int, from, to time.Time) ([]models.Slot, error) {
+	rows, err := q.QueryContext(ctx, `SELECT starts_at, ends_at FROM DoctorTimeOff WHERE doctor_id = ? AND starts_at < ? AND ends_at > ?
+              UNION ALL
+              SELECT starts_at, ends_at FROM Appointments WHERE doctor_id = ? AND status = ? AND starts_at < ? AND ends_at > ?`,
+		doctorID, to, from, doctorID, models.APPOINTMENT_STATUS_SCHEDULED, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []models.Slot
+	for rows.Next() {
+		var period models.Slot
+		if err := rows.Scan(&period.StartsAt, &period.EndsAt); err != nil {
+			return nil, err
+		}
+		periods = append(periods, period)
+	}
+	return periods, rows.Err()
+}
+
+func overlapsAny(periods []models.Slot, start, end time.Time) bool {
+	for _, period := range periods {
+		if period.StartsAt.Before(end) && period.EndsAt.After(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDoctor fails with sql.ErrNoRows for an unknown user and ErrNotADoctor
+// for one with another role
+func checkDoctor(ctx context.Context, q queryRower, userID int) error {
+	var role sql.NullString
+	if err := q.QueryRowContext(ctx, `SELECT role FROM Users WHERE user_id = ?`, userID).Scan(&role); err != nil {
+		return err
+	}
+	if role.String != models.ROLE_DOCTOR {
+		return ErrNotADoctor
+	}
+	return nil
+}
+
+func getDoctors(ctx context.Context, q querier, specialty, department string) ([]models.Doctor, error) {
+	query := `SELECT u.user_id, u.full_name, COALESCE(d.specialty, '')
+              FROM Users u
+              LEFT JOIN DoctorSpecialties d ON d.doctor_id = u.user_id
+              WHERE u.role = ?`
+	args := []any{models.ROLE_DOCTOR}
+	if specialty != "" {
+		query += ` AND u.user_id IN (SELECT doctor_id FROM DoctorSpecialties WHERE specialty = ?)`
+		args = append(args, specialty)
+	}
+	if department != "" {
+		query += ` AND u.user_id IN (SELECT user_id FROM UserDepartments WHERE department_code = ?)`
+		args = append(args, department)
+	}
+	query += ` ORDER BY u.full_name, u.user_id, d.specialty`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	doctors := []models.Doctor{}
+	for rows.Next() {
+		var id int
+		var name, spec string
+		if err := rows.Scan(&id, &name, &spec); err != nil {
+			return nil, err
+		}
+		if len(doctors) == 0 || doctors[len(doctors)-1].DoctorID != id {
+			doctors = append(doctors, models.Doctor{DoctorID: id, FullName: name, Specialties: []string{}})
+		}
+		if spec != "" {
+			last := &doctors[len(doctors)-1]
+			last.Specialties = append(last.Specialties, spec)
+		}
+	}
+	return doctors, rows.Err()
+}
+
+// normalizeSpecialty stores specialties lower-case so "Cardiology" and "cardiology" match
+func normalizeSpecialty(specialty string) string {
+	return strings.ToLower(strings.TrimSpace(specialty))
+}
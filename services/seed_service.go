@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// demoMarker is the demo doctor's username; its presence means the demo data is loaded
+const demoMarker = "demo.doctor"
+
+// SeedService creates the first admin account and, for testing, loads demo
+// staff and patients
+type SeedService struct {
+	users    *UserService
+	patients *PatientService
+	visits   *VisitService
+}
+
+func NewSeedService(users *UserService, patients *PatientService, visits *VisitService) *SeedService {
+	return &SeedService{users: users, patients: patients, visits: visits}
+}
+
+// BootstrapAdmin creates the admin account username when no admin exists
+// yet. Its password is password, or a random one when password is empty,
+// which is returned so it can be shown once. created is false when an admin
+// already exists.
+func (s *SeedService) BootstrapAdmin(ctx context.Context, username, password string) (generated string, created bool, err error) {
+	users, err := s.users.GetUsers(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	for _, user := range users {
+		if user.Role == models.ROLE_ADMIN || user.Username == username {
+			return "", false, nil
+		}
+	}
+
+	if password == "" {
+		password = rand.Text()
+		generated = password
+	} else if len(password) < MinPasswordLength {
+		return "", false, fmt.Errorf("the initial admin password must be at least %d characters", MinPasswordLength)
+	}
+
+	admin := models.User{Username: username, Role: models.ROLE_ADMIN, FullName: "Administrator"}
+	if err := s.users.CreateUserWithPassword(ctx, &admin, password); err != nil {
+		return "", false, err
+	}
+	return generated, true, nil
+}
+
+// DemoSummary counts what SeedDemoData loaded
+type DemoSummary struct {
+	Users         int
+	Patients      int
+	Visits        int
+	Prescriptions int
+}
+
+// SeedDemoData loads demo staff, patients and visits for testing, once:
+// nothing is loaded if the demo staff already exist. The staff all sign in
+// with password, or a random one when it is empty, returned as generated.
+func (s *SeedService) SeedDemoData(ctx context.Context, password string) (summary DemoSummary, generated string, err error) {
+	if _, err := s.users.GetUserByUsername(ctx, demoMarker); err == nil {
+		return summary, "", nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return summary, "", err
+	}
+
+	if password == "" {
+		password = rand.Text()
+		generated = password
+	}
+
+	staff := []models.User{
+		{Username: demoMarker, Role: models.ROLE_DOCTOR, FullName: "Dr. Aline Uwase"},
+		{Username: "demo.nurse", Role: models.ROLE_NURSE, FullName: "Jean Bosco Habimana"},
+		{Username: "demo.pharmacist", Role: models.ROLE_PHARMACIST, FullName: "Grace Mukamana"},
+		{Username: "demo.labtech", Role: models.ROLE_LAB_TECH, FullName: "Eric Niyonzima"},
+	}
+	for i := range staff {
+		if err := s.users.CreateUserWithPassword(ctx, &staff[i], password); err != nil {
+			return summary, "", fmt.Errorf("demo user %s: %w", staff[i].Username, err)
+		}
+		summary.Users++
+	}
+	doctorID := staff[0].UserID
+
+	today := timezone.Now()
+	daysAgo := func(days int) string { return today.AddDate(0, 0, -days).Format("2006-01-02") }
+
+	for _, demo := range demoPatients {
+		patient := demo.patient
+		if err := s.patients.CreatePatient(ctx, &patient); err != nil {
+			return summary, "", fmt.Errorf("demo patient %s %s: %w", patient.FirstName, patient.LastName, err)
+		}
+		summary.Patients++
+
+		for _, v := range demo.visits {
+			visit := models.Visit{
+				Record: models.MedicalRecord{
+					PatientID:      patient.PatientID,
+					DoctorID:       doctorID,
+					VisitDate:      daysAgo(v.daysAgo),
+					Diagnosis:      v.diagnosis,
+					DiagnosisCodes: v.codes,
+					TreatmentPlan:  v.plan,
+				},
+			}
+			for _, p := range v.prescriptions {
+				p.PatientID = patient.PatientID
+				p.DoctorID = doctorID
+				p.PrescribedDate = visit.Record.VisitDate
+				visit.Prescriptions = append(visit.Prescriptions, p)
+			}
+			if err := s.visits.CreateVisit(ctx, &visit, doctorID, nil); err != nil {
+				return summary, "", fmt.Errorf("demo visit for %s %s: %w", patient.FirstName, patient.LastName, err)
+			}
+			// The demo doctor signs them as written, so the pharmacy has
+			// a worklist to show
+			for _, p := range visit.Prescriptions {
+				if _, err := s.visits.prescriptions.repo.Sign(ctx, p.PrescriptionID, doctorID); err != nil {
+					return summary, "", fmt.Errorf("signing demo prescription for %s %s: %w", patient.FirstName, patient.LastName, err)
+				}
+			}
+			summary.Visits++
+			summary.Prescriptions += len(visit.Prescriptions)
+		}
+	}
+	return summary, generated, nil
+}
+
+type demoVisit struct {
+	daysAgo       int
+	diagnosis     string
+	codes         []string
+	plan          string
+	prescriptions []models.Prescription
+}
+
+var demoPatients = []struct {
+	patient models.Patient
+	visits  []demoVisit
+}{
+	{
+		patient: models.Patient{FirstName: "Claudine", LastName: "Mukeshimana", DateOfBirth: "1968-03-14", Gender: "Female",
+			ContactInfo: "+250788100201", Address: "KG 11 Ave, Kigali", MedicalHistory: "Hypertension diagnosed 2015. Type 2 diabetes.",
+			Allergies: "Penicillin", EmergencyContact: "Patrick Mukeshimana +250788100202"},
+		visits: []demoVisit{
+			{daysAgo: 40, diagnosis: "Essential hypertension, poorly controlled", codes: []string{"I10"},
+				plan: "Increase amlodipine, recheck blood pressure in 4 weeks",
+				prescriptions: []models.Prescription{
+					{Medication: "Amlodipine", Dosage: "10mg once daily", Duration: "3 months", Instructions: "Take in the morning"},
+				}},
+			{daysAgo: 5, diagnosis: "Type 2 diabetes mellitus, routine review", codes: []string{"E11.9", "I10"},
+				plan: "Continue metformin; HbA1c in 3 months",
+				prescriptions: []models.Prescription{
+					{Medication: "Metformin", Dosage: "500mg twice daily", Duration: "3 months", Instructions: "Take with meals"},
+				}},
+		},
+	},
+	{
+		patient: models.Patient{FirstName: "Emmanuel", LastName: "Nshimiyimana", DateOfBirth: "1992-07-02", Gender: "Male",
+			ContactInfo: "+250788100301", Address: "Nyamirambo, Kigali", EmergencyContact: "Diane Uwimana +250788100302"},
+		visits: []demoVisit{
+			{daysAgo: 12, diagnosis: "Uncomplicated malaria", codes: []string{"B54"},
+				plan: "Artemether-lumefantrine for 3 days; return if fever persists",
+				prescriptions: []models.Prescription{
+					{Medication: "Artemether-lumefantrine", Dosage: "4 tablets twice daily", Duration: "3 days", Instructions: "Take with food"},
+					{Medication: "Paracetamol", Dosage: "1g every 8 hours as needed", Duration: "5 days"},
+				}},
+		},
+	},
+	{
+		patient: models.Patient{FirstName: "Aisha", LastName: "Uwimana", DateOfBirth: "2015-11-23", Gender: "Female",
+			ContactInfo: "+250788100401", Address: "Remera, Kigali", MedicalHistory: "Asthma since age 4.",
+			EmergencyContact: "Mariam Uwimana (mother) +250788100401"},
+		visits: []demoVisit{
+			{daysAgo: 20, diagnosis: "Asthma, mild exacerbation", codes: []string{"J45.909"},
+				plan: "Salbutamol inhaler with spacer; review inhaler technique",
+				prescriptions: []models.Prescription{
+					{Medication: "Salbutamol inhaler", Dosage: "2 puffs as needed", Duration: "1 month", Instructions: "Use with spacer"},
+				}},
+		},
+	},
+	{
+		patient: models.Patient{FirstName: "Pierre", LastName: "Habyarimana", DateOfBirth: "1955-01-30", Gender: "Male",
+			ContactInfo: "+250788100501", Address: "Huye", MedicalHistory: "Hyperlipidaemia.", Allergies: "Sulfa drugs",
+			PreferredLanguage: "Kinyarwanda", InterpreterRequired: true, EmergencyContact: "Chantal Habyarimana +250788100502"},
+		visits: []demoVisit{
+			{daysAgo: 60, diagnosis: "Hyperlipidaemia", codes: []string{"E78.5"},
+				plan: "Start statin, dietary advice, lipid panel in 3 months",
+				prescriptions: []models.Prescription{
+					{Medication: "Atorvastatin", Dosage: "20mg at night", Duration: "3 months"},
+				}},
+			{daysAgo: 2, diagnosis: "Community-acquired pneumonia", codes: []string{"J18.9"},
+				plan: "Oral antibiotics, chest X-ray, review in 48 hours",
+				prescriptions: []models.Prescription{
+					{Medication: "Amoxicillin", Dosage: "1g three times daily", Duration: "7 days"},
+				}},
+		},
+	},
+	{
+		patient: models.Patient{FirstName: "Josiane", LastName: "Ingabire", DateOfBirth: "1988-05-09", Gender: "Female",
+			ContactInfo: "+250788100601", Address: "Musanze", EmergencyContact: "Olivier Ingabire +250788100602"},
+		visits: []demoVisit{
+			{daysAgo: 8, diagnosis: "Urinary tract infection", codes: []string{"N39.0"},
+				plan: "Nitrofurantoin; increase fluid intake",
+				prescriptions: []models.Prescription{
+					{Medication: "Nitrofurantoin", Dosage: "100mg twice daily", Duration: "5 days"},
+				}},
+		},
+	},
+	{
+		patient: models.Patient{FirstName: "Samuel", LastName: "Mugisha", DateOfBirth: "2001-09-17", Gender: "Male",
+			ContactInfo: "+250788100701", Address: "Rubavu"},
+		visits: []demoVisit{
+			{daysAgo: 1, diagnosis: "Acute upper respiratory infection", codes: []string{"J06.9"},
+				plan: "Supportive care, fluids and rest"},
+		},
+	},
+	{
+		patient: models.Patient{FirstName: "Beatrice", LastName: "Nyirahabimana", DateOfBirth: "1979-12-04", Gender: "Female",
+			ContactInfo: "+250788100801", Address: "Rwamagana", MedicalHistory: "Gastritis.", EmergencyContact: "Innocent Nsengiyumva +250788100802"},
+		visits: []demoVisit{
+			{daysAgo: 15, diagnosis: "Gastritis", codes: []string{"K29.70"},
+				plan: "Omeprazole for 4 weeks, avoid NSAIDs",
+				prescriptions: []models.Prescription{
+					{Medication: "Omeprazole", Dosage: "20mg once daily", Duration: "4 weeks", Instructions: "Take before breakfast"},
+				}},
+		},
+	},
+	{
+		patient: models.Patient{FirstName: "Kevin", LastName: "Ishimwe", DateOfBirth: "2010-04-21", Gender: "Male",
+			ContactInfo: "+250788100901", Address: "Kicukiro, Kigali", EmergencyContact: "Solange Ishimwe (mother) +250788100901"},
+	},
+}
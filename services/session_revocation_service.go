@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+)
+
+// SessionRevocationService records which signed session tokens have been
+// ended before they expire. Stateless tokens can't be deleted, so logging
+// out revokes one token by ID, and signing a user out everywhere revokes
+// every token issued to them until then. Kept in the database, the
+// revocations apply on every server.
+type SessionRevocationService struct{}
+
+func NewSessionRevocationService() *SessionRevocationService {
+	return &SessionRevocationService{}
+}
+
+// Revoke ends the token tokenID, which expires at expiresAt anyway and is
+// forgotten then
+func (s *SessionRevocationService) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM RevokedSessions WHERE expires_at < ?`, now); err != nil {
+			return err
+		}
+		query := `INSERT INTO RevokedSessions (token_id, expires_at) VALUES (?, ?) ON CONFLICT (token_id) DO NOTHING`
+		_, err := tx.ExecContext(ctx, query, tokenID, expiresAt.UTC())
+		return err
+	})
+}
+
+// RevokeUser ends every token issued to a user so far
+func (s *SessionRevocationService) RevokeUser(ctx context.Context, userID int) error {
+	_, err := database.GetDB().ExecContext(ctx, `UPDATE Users SET sessions_revoked_at = ? WHERE user_id = ?`, time.Now().UTC(), userID)
+	return err
+}
+
+// RevokeAll ends every token issued so far
+func (s *SessionRevocationService) RevokeAll(ctx context.Context) error {
+	_, err := database.GetDB().ExecContext(ctx, `UPDATE Users SET sessions_revoked_at = ?`, time.Now().UTC())
+	return err
+}
+
+// Revoked reports whether the token tokenID, issued to userID at issuedAt,
+// has been revoked. A user who no longer exists has no valid tokens. It
+// reads the primary, so a revocation applies at once.
+func (s *SessionRevocationService) Revoked(ctx context.Context, tokenID string, userID int, issuedAt time.Time) (bool, error) {
+	query := `SELECT u.sessions_revoked_at, EXISTS (SELECT 1 FROM RevokedSessions WHERE token_id = ?)
+              FROM Users u WHERE u.user_id = ?`
+	var revokedAt sql.NullTime
+	var tokenRevoked bool
+	err := database.GetDB().QueryRowContext(ctx, query, tokenID, userID).Scan(&revokedAt, &tokenRevoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return tokenRevoked || (revokedAt.Valid && issuedAt.Before(revokedAt.Time)), nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+// TimelineService merges a patient's medical records, prescriptions, lab
+// results and admissions into one chronological feed. Items are read
+// through their own services so decryption and the nurse view apply as usual.
+type TimelineService struct {
+	patients      *PatientService
+	records       *MedicalRecordService
+	prescriptions *PrescriptionService
+	labs          *LabService
+	admissions    *AdmissionService
+}
+
+func NewTimelineService(patients *PatientService, records *MedicalRecordService, prescriptions *PrescriptionService) *TimelineService {
+	return &TimelineService{
+		patients:      patients,
+		records:       records,
+		prescriptions: prescriptions,
+		labs:          NewLabService(),
+		admissions:    NewAdmissionService(),
+	}
+}
+
+// GetTimeline returns limit entries from offset of the patient's timeline,
+// newest first, keeping only the given types (all when empty). nurseView
+// swaps medical records for their nurse view.
+func (s *TimelineService) GetTimeline(ctx context.Context, patientID int, types []string, nurseView bool, limit, offset int) (*models.Timeline, error) {
+	if _, err := s.patients.GetPatient(ctx, patientID); err != nil {
+		return nil, err
+	}
+
+	wanted := func(entryType string) bool {
+		return len(types) == 0 || slices.Contains(types, entryType)
+	}
+	var entries []models.TimelineEntry
+
+	if wanted(models.TIMELINE_MEDICAL_RECORD) {
+		if nurseView {
+			records, err := s.records.GetNurseRecordsByPatient(ctx, patientID)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				entries = append(entries, models.TimelineEntry{Type: models.TIMELINE_MEDICAL_RECORD, ID: record.RecordID,
+					OccurredAt: startOfDate(record.VisitDate), Item: record})
+			}
+		} else {
+			records, err := s.records.GetMedicalRecordsByPatient(ctx, patientID)
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				entries = append(entries, models.TimelineEntry{Type: models.TIMELINE_MEDICAL_RECORD, ID: record.RecordID,
+					OccurredAt: startOfDate(record.VisitDate), Item: record})
+			}
+		}
+	}
+
+	if wanted(models.TIMELINE_PRESCRIPTION) {
+		prescriptions, err := s.prescriptions.GetPrescriptionsByPatient(ctx, patientID)
+		if err != nil {
+			return nil, err
+		}
+		for _, prescription := range prescriptions {
+			entries = append(entries, models.TimelineEntry{Type: models.TIMELINE_PRESCRIPTION, ID: prescription.PrescriptionID,
+				OccurredAt: startOfDate(prescription.PrescribedDate), Item: prescription})
+		}
+	}
+
+	if wanted(models.TIMELINE_LAB_RESULT) {
+		orders, err := s.labs.GetLabOrdersByPatient(ctx, patientID)
+		if err != nil {
+			return nil, err
+		}
+		// Orders still awaiting results aren't results yet
+		for _, order := range orders {
+			if len(order.Results) == 0 {
+				continue
+			}
+			resultedAt := order.Results[0].ResultedAt
+			for _, result := range order.Results[1:] {
+				if result.ResultedAt.After(resultedAt) {
+					resultedAt = result.ResultedAt
+				}
+			}
+			entries = append(entries, models.TimelineEntry{Type: models.TIMELINE_LAB_RESULT, ID: order.LabOrderID,
+				OccurredAt: resultedAt, Item: order})
+		}
+	}
+
+	if wanted(models.TIMELINE_ADMISSION) {
+		admissions, err := s.admissions.GetAdmissionsByPatient(ctx, patientID)
+		if err != nil {
+			return nil, err
+		}
+		for _, admission := range admissions {
+			entries = append(entries, models.TimelineEntry{Type: models.TIMELINE_ADMISSION, ID: admission.AdmissionID,
+				OccurredAt: admission.AdmittedAt, Item: admission})
+		}
+	}
+
+	// Newest first; ties are broken by type and ID so pages are stable
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.OccurredAt.Equal(b.OccurredAt) {
+			return a.OccurredAt.After(b.OccurredAt)
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.ID > b.ID
+	})
+
+	timeline := &models.Timeline{
+		PatientID: patientID,
+		Entries:   []models.TimelineEntry{},
+		Total:     len(entries),
+		Limit:     limit,
+		Offset:    offset,
+	}
+	if offset < len(entries) {
+		timeline.Entries = entries[offset:min(offset+limit, len(entries))]
+	}
+	return timeline, nil
+}
+
+// startOfDate places a stored date, read back as YYYY-MM-DD or as a
+// timestamp, at the start of its facility-local day
+func startOfDate(value string) time.Time {
+	if len(value) < len("2006-01-02") {
+		return time.Time{}
+	}
+	day, err := timezone.ParseDate(value[:len("2006-01-02")])
+	if err != nil {
+		return time.Time{}
+	}
+	return day
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// twoFAResetTTL is how long an issued 2FA reset token can be redeemed
+const twoFAResetTTL = 24 * time.Hour
+
+// ErrInvalidTwoFAReset is returned when redeeming a reset token that is
+// unknown, expired, already used or issued to someone else
+var ErrInvalidTwoFAReset = errors.New("2FA reset token is invalid, expired or already used")
+
+// TwoFAResetService recovers users who have lost their authenticator. An
+// admin issues a one-time token, handed to the user out of band; redeeming
+// it turns TOTP off so the user can enroll a new device. Security keys are
+// left registered. Only a hash of the token is stored.
+type TwoFAResetService struct {
+	audit *AuditService
+}
+
+func NewTwoFAResetService() *TwoFAResetService {
+	return &TwoFAResetService{audit: NewAuditService()}
+}
+
+// Issue mints a reset token for userID, revoking any earlier unredeemed one
+func (s *TwoFAResetService) Issue(ctx context.Context, userID, adminID int) (*models.TwoFAReset, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	reset := &models.TwoFAReset{
+		UserID:    userID,
+		Token:     "tfr_" + hex.EncodeToString(secret),
+		ExpiresAt: now.Add(twoFAResetTTL),
+	}
+
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT 1 FROM Users WHERE user_id = ?`, userID).Scan(&exists); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM TwoFAResets WHERE user_id = ? AND redeemed_at IS NULL`, userID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO TwoFAResets (token_hash, user_id, issued_by, issued_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+			hashTwoFAReset(reset.Token), userID, adminID, now, reset.ExpiresAt); err != nil {
+			return err
+		}
+
+		details := map[string]any{"expiresAt": reset.ExpiresAt}
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_TWOFA_RESET_ISSUED, models.ENTITY_USER, userID, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reset, nil
+}
+
+// Redeem consumes userID's reset token and turns off their TOTP, clearing
+// the secret and backup codes
+func (s *TwoFAResetService) Redeem(ctx context.Context, userID int, token string) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var owner, issuedBy int
+		var expiresAt time.Time
+		var redeemedAt *time.Time
+		err := tx.QueryRowContext(ctx, `SELECT user_id, issued_by, expires_at, redeemed_at FROM TwoFAResets WHERE token_hash = ?`, hashTwoFAReset(token)).
+			Scan(&owner, &issuedBy, &expiresAt, &redeemedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidTwoFAReset
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if owner != userID || redeemedAt != nil || now.After(expiresAt) {
+			return ErrInvalidTwoFAReset
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE TwoFAResets SET redeemed_at = ? WHERE token_hash = ?`, now, hashTwoFAReset(token)); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE Users SET two_fa_secret = '', two_fa_enabled = FALSE, two_fa_backup_codes = '' WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+
+		return s.audit.Log(ctx, tx, userID, models.AUDIT_TWOFA_RESET, models.ENTITY_USER, userID, map[string]any{"issuedBy": issuedBy})
+	})
+}
+
+func hashTwoFAReset(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
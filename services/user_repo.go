@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+)
+
+// SQLiteUserRepo is the UserRepo backed by the Users table. Authentication
+// reads always go to the primary.
+type SQLiteUserRepo struct{}
+
+func NewSQLiteUserRepo() *SQLiteUserRepo {
+	return &SQLiteUserRepo{}
+}
+
+func (r *SQLiteUserRepo) Create(ctx context.Context, user *models.User) error {
+	if user.Notifications.Channel == "" {
+		user.Notifications.Channel = models.NOTIFY_CHANNEL_NONE
+	}
+
+	query := `INSERT INTO Users (username, password_hash, role, full_name, two_fa_secret, two_fa_enabled, two_fa_backup_codes,
+                  notify_channel, notify_email, notify_phone, patient_id)
+              VALUES (?, ?, ?, ?, '', ?, ?, ?, ?, ?, ?)`
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, user.Username, user.PasswordHash, user.Role, user.FullName,
+			user.TwoFAEnabled, "", user.Notifications.Channel, user.Notifications.Email, user.Notifications.Phone, user.PatientID)
+		if err != nil {
+			return err
+		}
+
+		id, _ := result.LastInsertId()
+		user.UserID = int(id)
+		user.Active = true
+		return encryption.Store(ctx, tx, encryption.UserTwoFASecret, user.UserID, user.TwoFASecret)
+	})
+}
+
+func (r *SQLiteUserRepo) List(ctx context.Context) ([]*models.User, error) {
+	users, _, err := r.Search(ctx, UserFilter{})
+	return users, err
+}
+
+// Search returns the page of users filter selects, by ID, and how many match
+// it across all pages
+func (r *SQLiteUserRepo) Search(ctx context.Context, filter UserFilter) ([]*models.User, int, error) {
+	clause := `WHERE 1 = 1`
+	var args []any
+	if filter.Role != "" {
+		clause += ` AND role = ?`
+		args = append(args, filter.Role)
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Query)) + "%"
+		clause += ` AND (lower(username) LIKE ? ESCAPE '\' OR lower(full_name) LIKE ? ESCAPE '\')`
+		args = append(args, pattern, pattern)
+	}
+	if filter.Active != nil {
+		clause += ` AND active = ?`
+		args = append(args, *filter.Active)
+	}
+
+	db := database.GetDB()
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM Users `+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	clause += ` ORDER BY user_id`
+	if filter.Limit > 0 {
+		clause += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	query := `SELECT user_id, username, password_hash, role, full_name, two_fa_secret, two_fa_enabled, two_fa_backup_codes,
+                  notify_channel, notify_email, notify_phone, patient_id, active, last_login_at
+              FROM Users ` + clause
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		var user models.User
+		var backupCodesJSON sql.NullString
+		var lastLogin sql.NullTime
+		err := rows.Scan(&user.UserID, &user.Username, &user.PasswordHash, &user.Role,
+			&user.FullName, &user.TwoFASecret, &user.TwoFAEnabled, &backupCodesJSON,
+			&user.Notifications.Channel, &user.Notifications.Email, &user.Notifications.Phone, &user.PatientID, &user.Active, &lastLogin)
+		if err != nil {
+			return nil, 0, err
+		}
+		if user.TwoFASecret, err = encryption.Open(encryption.UserTwoFASecret, user.UserID, user.TwoFASecret); err != nil {
+			return nil, 0, err
+		}
+		if lastLogin.Valid {
+			user.LastLoginAt = &lastLogin.Time
+		}
+
+		// Parse backup code hashes if they exist
+		if backupCodesJSON.Valid && backupCodesJSON.String != "" {
+			json.Unmarshal([]byte(backupCodesJSON.String), &user.TwoFABackupCodes)
+		}
+
+		users = append(users, &user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func (r *SQLiteUserRepo) Get(ctx context.Context, id int) (*models.User, error) {
+	return r.getBy(ctx, "user_id", id)
+}
+
+func (r *SQLiteUserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.getBy(ctx, "username", username)
+}
+
+// UpdateProfile changes the fields users may edit on their own account
+func (r *SQLiteUserRepo) UpdateProfile(ctx context.Context, id int, profile *models.ProfileUpdate) error {
+	query := `UPDATE Users SET full_name = ?, notify_channel = ?, notify_email = ?, notify_phone = ? WHERE user_id = ?`
+	result, err := database.GetDB().ExecContext(ctx, query, profile.FullName, profile.Notifications.Channel,
+		profile.Notifications.Email, profile.Notifications.Phone, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetActive activates or deactivates an account
+func (r *SQLiteUserRepo) SetActive(ctx context.Context, id int, active bool) error {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE Users SET active = ? WHERE user_id = ?`, active, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateRole changes an account's role
+func (r *SQLiteUserRepo) UpdateRole(ctx context.Context, id int, role string) error {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE Users SET role = ? WHERE user_id = ?`, role, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetPasswordHash replaces an account's password hash
+func (r *SQLiteUserRepo) SetPasswordHash(ctx context.Context, id int, hash string) error {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE Users SET password_hash = ? WHERE user_id = ?`, hash, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// getBy loads a single user by a unique column
+func (r *SQLiteUserRepo) getBy(ctx context.Context, column string, value any) (*models.User, error) {
+	var user models.User
+	var backupCodesJSON sql.NullString
+	var lastLogin sql.NullTime
+	query := `SELECT user_id, username, password_hash, role, full_name, two_fa_secret, two_fa_enabled, two_fa_backup_codes,
+                  notify_channel, notify_email, notify_phone, patient_id, active, last_login_at
+              FROM Users WHERE ` + column + ` = ?`
+	err := database.GetDB().QueryRowContext(ctx, query, value).Scan(&user.UserID, &user.Username, &user.PasswordHash, &user.Role,
+		&user.FullName, &user.TwoFASecret, &user.TwoFAEnabled, &backupCodesJSON,
+		&user.Notifications.Channel, &user.Notifications.Email, &user.Notifications.Phone, &user.PatientID, &user.Active, &lastLogin)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFASecret, err = encryption.Open(encryption.UserTwoFASecret, user.UserID, user.TwoFASecret); err != nil {
+		return nil, err
+	}
+	if lastLogin.Valid {
+		user.LastLoginAt = &lastLogin.Time
+	}
+
+	// Parse backup code hashes if they exist
+	if backupCodesJSON.Valid && backupCodesJSON.String != "" {
+		json.Unmarshal([]byte(backupCodesJSON.String), &user.TwoFABackupCodes)
+	}
+
+	return &user, nil
+}
@@ -1,10 +1,10 @@
 package services
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/kinyaelgrande/simple-hospital/database"
 	"github.com/kinyaelgrande/simple-hospital/models"
@@ -12,17 +12,47 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	// ErrUserDeactivated is returned when a deactivated account authenticates
+	ErrUserDeactivated = errors.New("user account is deactivated")
+	// ErrPatientRoleChange is returned for a role change to or from Patient;
+	// portal accounts belong to their patient, so they are created as such
+	ErrPatientRoleChange = errors.New("role can't be changed to or from Patient")
+)
+
+// MinPasswordLength is the shortest password an operator may set
+const MinPasswordLength = 12
+
+// UserFilter narrows and pages SearchUsers; zero fields are ignored
+type UserFilter struct {
+	// Role is one of the models.ROLE_ roles
+	Role string
+	// Query matches users whose username or full name contains it, ignoring
+	// case
+	Query  string
+	Active *bool
+	// Limit caps the users returned, from Offset; zero returns all
+	Limit  int
+	Offset int
+}
+
 type UserService struct {
-	twoFAService *auth.TwoFAService
+	repo            UserRepo
+	twoFAService    *auth.TwoFAService
+	webAuthnService *auth.WebAuthnService
+	audit           *AuditService
 }
 
-func NewUserService() *UserService {
+func NewUserService(repo UserRepo) *UserService {
 	return &UserService{
-		twoFAService: auth.NewTwoFAService(),
+		repo:            repo,
+		twoFAService:    auth.NewTwoFAService(),
+		webAuthnService: auth.NewWebAuthnService(),
+		audit:           NewAuditService(),
 	}
 }
 
-func (s *UserService) CreateUser(user *models.User) error {
+func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
 	user.PasswordHash = fmt.Sprintf("%s123", user.Username)
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.PasswordHash), bcrypt.DefaultCost)
 	if err != nil {
@@ -30,99 +60,119 @@ func (s *UserService) CreateUser(user *models.User) error {
 	}
 	user.PasswordHash = string(hashedPassword)
 
-	if strings.HasPrefix(user.Username, "doc") {
-		user.Role = models.ROLE_DOCTOR
-	}
-
-	if strings.HasPrefix(user.Username, "nrs") {
-		user.Role = models.ROLE_NURSE
+	if user.Role != models.ROLE_PATIENT {
+		user.PatientID = nil
+	} else if user.PatientID != nil {
+		var exists int
+		err := database.ReadDB(database.WithPrimaryReads(ctx)).QueryRowContext(ctx, `SELECT 1 FROM Patients WHERE patient_id = ?`, *user.PatientID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %d", ErrUnknownPatient, *user.PatientID)
+		} else if err != nil {
+			return err
+		}
 	}
 
-	if strings.HasPrefix(user.Username, "pha") {
-		user.Role = models.ROLE_PHARMACIST
-	}
+	return s.repo.Create(ctx, user)
+}
 
-	query := `INSERT INTO Users (username, password_hash, role, full_name, two_fa_secret, two_fa_enabled, two_fa_backup_codes)
-              VALUES (?, ?, ?, ?, ?, ?, ?)`
-	result, err := database.GetDB().Exec(query, user.Username, user.PasswordHash, user.Role, user.FullName,
-		user.TwoFASecret, user.TwoFAEnabled, "")
+// CreateUserWithPassword creates the account with the given password and
+// role as they are
+func (s *UserService) CreateUserWithPassword(ctx context.Context, user *models.User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
-
-	id, _ := result.LastInsertId()
-	user.UserID = int(id)
-	return nil
+	user.PasswordHash = string(hashedPassword)
+	return s.repo.Create(ctx, user)
 }
 
-func (s *UserService) GetUsers() ([]*models.User, error) {
-	var users []*models.User
-	query := `SELECT user_id, username, password_hash, role, full_name, two_fa_secret, two_fa_enabled, two_fa_backup_codes
-              FROM Users`
-	rows, err := database.GetDB().Query(query)
+// ResetPassword replaces an account's password. Sessions the account
+// already holds are left open.
+func (s *UserService) ResetPassword(ctx context.Context, id int, password string) error {
+	if len(password) < MinPasswordLength {
+		return fmt.Errorf("the password must be at least %d characters", MinPasswordLength)
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	return s.repo.SetPasswordHash(ctx, id, string(hashedPassword))
+}
 
-	for rows.Next() {
-		var user models.User
-		var backupCodesJSON sql.NullString
-		err := rows.Scan(&user.UserID, &user.Username, &user.PasswordHash, &user.Role,
-			&user.FullName, &user.TwoFASecret, &user.TwoFAEnabled, &backupCodesJSON)
-		if err != nil {
-			return nil, err
-		}
+func (s *UserService) GetUsers(ctx context.Context) ([]*models.User, error) {
+	return s.repo.List(ctx)
+}
 
-		// Parse backup codes if they exist
-		if backupCodesJSON.Valid && backupCodesJSON.String != "" {
-			json.Unmarshal([]byte(backupCodesJSON.String), &user.TwoFABackupCodes)
-		}
+// SearchUsers returns the page of users filter selects and how many match it
+// across all pages
+func (s *UserService) SearchUsers(ctx context.Context, filter UserFilter) ([]*models.User, int, error) {
+	return s.repo.Search(ctx, filter)
+}
 
-		users = append(users, &user)
-	}
+func (s *UserService) GetUser(ctx context.Context, id int) (*models.User, error) {
+	return s.repo.Get(ctx, id)
+}
 
-	return users, nil
+func (s *UserService) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return s.repo.GetByUsername(ctx, username)
 }
 
-func (s *UserService) GetUser(id int) (*models.User, error) {
-	var user models.User
-	var backupCodesJSON sql.NullString
-	query := `SELECT user_id, username, password_hash, role, full_name, two_fa_secret, two_fa_enabled, two_fa_backup_codes
-              FROM Users WHERE user_id = ?`
-	err := database.GetDB().QueryRow(query, id).Scan(&user.UserID, &user.Username, &user.PasswordHash, &user.Role,
-		&user.FullName, &user.TwoFASecret, &user.TwoFAEnabled, &backupCodesJSON)
-	if err != nil {
+// UpdateProfile applies a user's changes to their own account and returns
+// the updated account. A blank channel turns notifications off.
+func (s *UserService) UpdateProfile(ctx context.Context, id int, profile *models.ProfileUpdate) (*models.User, error) {
+	if profile.Notifications.Channel == "" {
+		profile.Notifications.Channel = models.NOTIFY_CHANNEL_NONE
+	}
+	if err := s.repo.UpdateProfile(ctx, id, profile); err != nil {
 		return nil, err
 	}
+	return s.repo.Get(ctx, id)
+}
 
-	// Parse backup codes if they exist
-	if backupCodesJSON.Valid && backupCodesJSON.String != "" {
-		json.Unmarshal([]byte(backupCodesJSON.String), &user.TwoFABackupCodes)
+// SetActive deactivates an account, or reactivates one, on behalf of the
+// admin adminID and returns it
+func (s *UserService) SetActive(ctx context.Context, id int, active bool, adminID int) (*models.User, error) {
+	action := models.AUDIT_USER_DEACTIVATED
+	if active {
+		action = models.AUDIT_USER_REACTIVATED
 	}
-
-	return &user, nil
+	if err := s.repo.SetActive(ctx, id, active); err != nil {
+		return nil, err
+	}
+	if err := s.audit.Log(ctx, database.GetDB(), adminID, action, models.ENTITY_USER, id, nil); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, id)
 }
 
-func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
-	var user models.User
-	var backupCodesJSON sql.NullString
-	query := `SELECT user_id, username, password_hash, role, full_name, two_fa_secret, two_fa_enabled, two_fa_backup_codes
-              FROM Users WHERE username = ?`
-	err := database.GetDB().QueryRow(query, username).Scan(&user.UserID, &user.Username, &user.PasswordHash, &user.Role,
-		&user.FullName, &user.TwoFASecret, &user.TwoFAEnabled, &backupCodesJSON)
+// ChangeRole gives an account a new role on behalf of the admin adminID and
+// returns it; the change takes effect on the user's next request
+func (s *UserService) ChangeRole(ctx context.Context, id int, role string, adminID int) (*models.User, error) {
+	user, err := s.repo.Get(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-
-	// Parse backup codes if they exist
-	if backupCodesJSON.Valid && backupCodesJSON.String != "" {
-		json.Unmarshal([]byte(backupCodesJSON.String), &user.TwoFABackupCodes)
+	if user.Role == role {
+		return user, nil
+	}
+	if user.Role == models.ROLE_PATIENT || role == models.ROLE_PATIENT {
+		return nil, ErrPatientRoleChange
 	}
 
-	return &user, nil
+	if err := s.repo.UpdateRole(ctx, id, role); err != nil {
+		return nil, err
+	}
+	if err := s.audit.Log(ctx, database.GetDB(), adminID, models.AUDIT_USER_ROLE_CHANGED, models.ENTITY_USER, id,
+		map[string]string{"from": user.Role, "to": role}); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, id)
 }
 
 func (s *UserService) GetTwoFAService() *auth.TwoFAService {
 	return s.twoFAService
 }
+
+func (s *UserService) GetWebAuthnService() *auth.WebAuthnService {
+	return s.webAuthnService
+}
@@ -0,0 +1,78 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services"
+	"github.com/kinyaelgrande/simple-hospital/services/fakes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	users := services.NewUserService(fakes.NewUserRepo())
+
+	// A staff account can't be linked to a patient's chart
+	patientID := 7
+	nurse := &models.User{Username: "nurse.joy", Role: models.ROLE_NURSE, FullName: "Nurse Joy", PatientID: &patientID}
+	if err := users.CreateUser(ctx, nurse); err != nil {
+		t.Fatal(err)
+	}
+	created, err := users.GetUser(ctx, nurse.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.PatientID != nil || !created.Active {
+		t.Fatalf("created %+v, want an active account with no patient", created)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(created.PasswordHash), []byte("nurse.joy123")) != nil {
+		t.Fatal("the initial password isn't <username>123")
+	}
+
+	if err := users.CreateUser(ctx, &models.User{Username: "nurse.joy", Role: models.ROLE_DOCTOR}); !errors.Is(err, fakes.ErrDuplicateUsername) {
+		t.Fatalf("a second nurse.joy: want ErrDuplicateUsername, got %v", err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx := context.Background()
+	users := services.NewUserService(fakes.NewUserRepo())
+	user := &models.User{Username: "dr.who", Role: models.ROLE_DOCTOR, FullName: "Dr Who"}
+	if err := users.CreateUserWithPassword(ctx, user, "initial password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := users.ResetPassword(ctx, user.UserID, "short"); err == nil {
+		t.Fatal("a short password was accepted")
+	}
+	if err := users.ResetPassword(ctx, user.UserID, "a much longer passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	reset, err := users.GetUser(ctx, user.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(reset.PasswordHash), []byte("a much longer passphrase")) != nil {
+		t.Fatal("the password wasn't replaced")
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	ctx := context.Background()
+	users := services.NewUserService(fakes.NewUserRepo())
+	user := &models.User{Username: "pharm.ada", Role: models.ROLE_PHARMACIST, FullName: "Ada"}
+	if err := users.CreateUserWithPassword(ctx, user, "initial password"); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := users.UpdateProfile(ctx, user.UserID, &models.ProfileUpdate{FullName: "Ada Lovelace"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.FullName != "Ada Lovelace" || updated.Notifications.Channel != models.NOTIFY_CHANNEL_NONE {
+		t.Fatalf("updated to %+v, want the new name and notifications off", updated)
+	}
+}
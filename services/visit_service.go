@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+)
+
+// VisitService creates a visit's medical record and prescriptions in one
+// transaction, so a failed prescription doesn't leave a record behind
+type VisitService struct {
+	records       *MedicalRecordService
+	prescriptions *PrescriptionService
+}
+
+func NewVisitService(records *MedicalRecordService, prescriptions *PrescriptionService) *VisitService {
+	return &VisitService{records: records, prescriptions: prescriptions}
+}
+
+// CheckPrescriptions runs the prescription safety checks on each of the
+// visit's prescriptions, returning their warnings by position
+func (s *VisitService) CheckPrescriptions(ctx context.Context, visit *models.Visit) ([][]models.PrescriptionWarning, error) {
+	warnings := make([][]models.PrescriptionWarning, len(visit.Prescriptions))
+	for i := range visit.Prescriptions {
+		found, err := s.prescriptions.CheckPrescription(ctx, &visit.Prescriptions[i])
+		if err != nil {
+			return nil, err
+		}
+		warnings[i] = found
+	}
+	return warnings, nil
+}
+
+// CheckPrescription runs the prescription safety checks on one prescription
+// of a visit
+func (s *VisitService) CheckPrescription(ctx context.Context, prescription *models.Prescription) ([]models.PrescriptionWarning, error) {
+	return s.prescriptions.CheckPrescription(ctx, prescription)
+}
+
+// GetRecord returns the medical record of an earlier visit, for dating its
+// prescriptions
+func (s *VisitService) GetRecord(ctx context.Context, recordID int) (*models.MedicalRecord, error) {
+	return s.records.GetMedicalRecord(ctx, recordID)
+}
+
+// CreateVisit creates the record and then each prescription, linked to it.
+// Prescriptions with warnings, as returned by CheckPrescriptions, are
+// created as overridden by userID.
+func (s *VisitService) CreateVisit(ctx context.Context, visit *models.Visit, userID int, warnings [][]models.PrescriptionWarning) error {
+	return database.InTx(ctx, func(ctx context.Context) error {
+		if err := s.records.CreateMedicalRecord(ctx, &visit.Record); err != nil {
+			return err
+		}
+
+		for i := range visit.Prescriptions {
+			visit.Prescriptions[i].RecordID = &visit.Record.RecordID
+		}
+		return s.createPrescriptions(ctx, visit.Prescriptions, userID, warnings)
+	})
+}
+
+// AddPrescriptions creates prescriptions written at an earlier visit in one
+// transaction, so either all of them are created or none. They must already
+// be for the visit's patient and linked to its record. Those with warnings
+// are created as overridden by userID, as in CreateVisit.
+func (s *VisitService) AddPrescriptions(ctx context.Context, prescriptions []models.Prescription, userID int, warnings [][]models.PrescriptionWarning) error {
+	return database.InTx(ctx, func(ctx context.Context) error {
+		return s.createPrescriptions(ctx, prescriptions, userID, warnings)
+	})
+}
+
+func (s *VisitService) createPrescriptions(ctx context.Context, prescriptions []models.Prescription, userID int, warnings [][]models.PrescriptionWarning) error {
+	for i := range prescriptions {
+		prescription := &prescriptions[i]
+		var err error
+		if i < len(warnings) && len(warnings[i]) > 0 {
+			err = s.prescriptions.CreateOverriddenPrescription(ctx, prescription, userID, warnings[i])
+		} else {
+			err = s.prescriptions.CreatePrescription(ctx, prescription)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
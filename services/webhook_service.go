@@ -0,0 +1,475 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kinyaelgrande/simple-hospital/database"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/services/encryption"
+	"github.com/kinyaelgrande/simple-hospital/services/notifications"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+const (
+	// webhookBatchSize bounds how many events one poll fans out to each
+	// webhook, and how many deliveries it sends
+	webhookBatchSize = 50
+	// webhookLease is how long a claimed delivery is reserved for the
+	// worker sending it; after that another worker may retry it
+	webhookLease = 5 * time.Minute
+)
+
+var (
+	// ErrWebhookURL is returned when registering a webhook at a plain HTTP
+	// URL on another host, which would send patient data unencrypted
+	ErrWebhookURL = errors.New("webhook URL must use https, other than for a receiver on this host")
+	// ErrWebhookDeliveryState is returned when retrying a delivery that hasn't failed
+	ErrWebhookDeliveryState = errors.New("only failed deliveries can be retried")
+)
+
+// WebhookService POSTs clinical events to the webhooks external systems
+// register, so they can follow changes without polling. A worker started
+// with Run reads the event log after each webhook's cursor, queues a
+// delivery for each event it subscribes to and sends due deliveries, signed
+// with the webhook's secret and retried with backoff. Deliveries are logged
+// with their outcome.
+type WebhookService struct {
+	client      *http.Client
+	maxAttempts int
+	audit       *AuditService
+}
+
+// NewWebhookService retries failed deliveries until maxAttempts have been made
+func NewWebhookService(maxAttempts int) *WebhookService {
+	return &WebhookService{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		maxAttempts: max(maxAttempts, 1),
+		audit:       NewAuditService(),
+	}
+}
+
+// Create registers a webhook, which is sent the events that happen from now on
+func (s *WebhookService) Create(ctx context.Context, request models.WebhookRequest, adminID int) (*models.Webhook, error) {
+	if err := checkWebhookURL(request.URL); err != nil {
+		return nil, err
+	}
+	var id int
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var lastEventID int
+		if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(event_id), 0) FROM ClinicalEvents`).Scan(&lastEventID); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		query := `INSERT INTO Webhooks (name, url, secret, event_types, active, last_event_id, created_by, created_at, updated_at)
+                  VALUES (?, ?, '', ?, ?, ?, ?, ?, ?)`
+		result, err := tx.ExecContext(ctx, query, request.Name, request.URL, webhookEventList(request.EventTypes),
+			request.Active == nil || *request.Active, lastEventID, adminID, now, now)
+		if err != nil {
+			return err
+		}
+		lastID, _ := result.LastInsertId()
+		id = int(lastID)
+		if err := encryption.Store(ctx, tx, encryption.WebhookSecret, id, request.Secret); err != nil {
+			return err
+		}
+
+		details := map[string]any{"name": request.Name, "url": request.URL, "eventTypes": request.EventTypes}
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_WEBHOOK_SAVED, models.ENTITY_WEBHOOK, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWebhook(database.WithPrimaryReads(ctx), id)
+}
+
+// Update replaces a webhook's settings and secret. A webhook reactivated
+// after being inactive is sent the events from then on, not those it missed.
+func (s *WebhookService) Update(ctx context.Context, id int, request models.WebhookRequest, adminID int) (*models.Webhook, error) {
+	if err := checkWebhookURL(request.URL); err != nil {
+		return nil, err
+	}
+	secret, err := encryption.Seal(encryption.WebhookSecret, id, request.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.WithTx(ctx, func(tx *sql.Tx) error {
+		var wasActive bool
+		if err := tx.QueryRowContext(ctx, `SELECT active FROM Webhooks WHERE webhook_id = ?`, id).Scan(&wasActive); err != nil {
+			return err
+		}
+		active := request.Active == nil || *request.Active
+
+		query := `UPDATE Webhooks SET name = ?, url = ?, secret = ?, event_types = ?, active = ?, updated_at = ? WHERE webhook_id = ?`
+		if _, err := tx.ExecContext(ctx, query, request.Name, request.URL, secret, webhookEventList(request.EventTypes), active,
+			time.Now().UTC(), id); err != nil {
+			return err
+		}
+		if active && !wasActive {
+			if _, err := tx.ExecContext(ctx, `UPDATE Webhooks SET last_event_id = (SELECT COALESCE(MAX(event_id), 0) FROM ClinicalEvents)
+                  WHERE webhook_id = ?`, id); err != nil {
+				return err
+			}
+		}
+
+		details := map[string]any{"name": request.Name, "url": request.URL, "eventTypes": request.EventTypes, "active": active}
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_WEBHOOK_SAVED, models.ENTITY_WEBHOOK, id, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetWebhook(database.WithPrimaryReads(ctx), id)
+}
+
+// Delete removes a webhook and its delivery log
+func (s *WebhookService) Delete(ctx context.Context, id, adminID int) error {
+	return database.WithTx(ctx, func(tx *sql.Tx) error {
+		var name string
+		if err := tx.QueryRowContext(ctx, `SELECT name FROM Webhooks WHERE webhook_id = ?`, id).Scan(&name); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM WebhookDeliveries WHERE webhook_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM Webhooks WHERE webhook_id = ?`, id); err != nil {
+			return err
+		}
+		return s.audit.Log(ctx, tx, adminID, models.AUDIT_WEBHOOK_DELETED, models.ENTITY_WEBHOOK, id, map[string]any{"name": name})
+	})
+}
+
+func (s *WebhookService) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	return queryWebhooks(ctx, `ORDER BY webhook_id`)
+}
+
+func (s *WebhookService) GetWebhook(ctx context.Context, id int) (*models.Webhook, error) {
+	webhooks, err := queryWebhooks(ctx, `WHERE webhook_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(webhooks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &webhooks[0], nil
+}
+
+// GetDeliveries lists a webhook's most recent deliveries, optionally with one status
+func (s *WebhookService) GetDeliveries(ctx context.Context, webhookID int, status string, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return queryWebhookDeliveries(ctx, `WHERE webhook_id = ? ORDER BY delivery_id DESC LIMIT ?`, webhookID, limit)
+	}
+	return queryWebhookDeliveries(ctx, `WHERE webhook_id = ? AND status = ? ORDER BY delivery_id DESC LIMIT ?`, webhookID, status, limit)
+}
+
+// RetryDelivery requeues a failed delivery for immediate sending
+func (s *WebhookService) RetryDelivery(ctx context.Context, webhookID, deliveryID int) (*models.WebhookDelivery, error) {
+	result, err := database.GetDB().ExecContext(ctx, `UPDATE WebhookDeliveries SET status = ?, attempts = 0, next_attempt_at = ?
+              WHERE delivery_id = ? AND webhook_id = ? AND status = ?`,
+		models.WEBHOOK_DELIVERY_PENDING, time.Now().UTC(), deliveryID, webhookID, models.WEBHOOK_DELIVERY_FAILED)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := queryWebhookDeliveries(database.WithPrimaryReads(ctx), `WHERE delivery_id = ? AND webhook_id = ?`, deliveryID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrWebhookDeliveryState
+	}
+	return &deliveries[0], nil
+}
+
+// Run queues and sends deliveries every interval until ctx is cancelled
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.queueEvents(ctx); err != nil {
+			slog.Error("Queueing webhook deliveries failed", "error", err)
+		}
+		for {
+			sent, err := s.deliverDue(ctx)
+			if err != nil {
+				slog.Error("Webhook delivery failed", "error", err)
+			}
+			// A full batch means more are probably waiting
+			if err != nil || sent < webhookBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queueEvents moves each active webhook's cursor through the event log,
+// queueing a delivery for each event it subscribes to
+func (s *WebhookService) queueEvents(ctx context.Context) error {
+	webhooks, err := queryWebhooks(database.WithPrimaryReads(ctx), `WHERE active = ?`, true)
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		for {
+			queued, err := s.queueWebhookEvents(ctx, webhook)
+			if err != nil {
+				return err
+			}
+			if queued < webhookBatchSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// queueWebhookEvents queues one batch of the events after webhook's cursor,
+// returning how many events it read
+func (s *WebhookService) queueWebhookEvents(ctx context.Context, webhook models.Webhook) (int, error) {
+	read := 0
+	err := database.WithTx(ctx, func(tx *sql.Tx) error {
+		var lastEventID int
+		if err := tx.QueryRowContext(ctx, `SELECT last_event_id FROM Webhooks WHERE webhook_id = ?`, webhook.WebhookID).Scan(&lastEventID); err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT event_id, event_type FROM ClinicalEvents WHERE event_id > ? ORDER BY event_id LIMIT ?`,
+			lastEventID, webhookBatchSize)
+		if err != nil {
+			return err
+		}
+		type event struct {
+			id        int
+			eventType string
+		}
+		var events []event
+		for rows.Next() {
+			var e event
+			if err := rows.Scan(&e.id, &e.eventType); err != nil {
+				rows.Close()
+				return err
+			}
+			events = append(events, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		read = len(events)
+		if read == 0 {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		for _, e := range events {
+			eventType, ok := models.WebhookEventType(e.eventType)
+			if !ok || !slices.Contains(webhook.EventTypes, eventType) {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO WebhookDeliveries (webhook_id, event_id, event_type, status, attempts, next_attempt_at, created_at)
+                  VALUES (?, ?, ?, ?, 0, ?, ?)`,
+				webhook.WebhookID, e.id, eventType, models.WEBHOOK_DELIVERY_PENDING, now, now); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE Webhooks SET last_event_id = ? WHERE webhook_id = ?`, events[len(events)-1].id, webhook.WebhookID)
+		return err
+	})
+	return read, err
+}
+
+// deliverDue claims and sends one batch of due deliveries, returning how
+// many it attempted
+func (s *WebhookService) deliverDue(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	// Deliveries left "sending" by a worker that died are picked up again
+	// once their lease runs out
+	due, err := queryWebhookDeliveries(database.WithPrimaryReads(ctx), `WHERE status IN (?, ?) AND next_attempt_at <= ?
+              ORDER BY next_attempt_at LIMIT ?`,
+		models.WEBHOOK_DELIVERY_PENDING, models.WEBHOOK_DELIVERY_SENDING, now, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range due {
+		result, err := database.GetDB().ExecContext(ctx, `UPDATE WebhookDeliveries SET status = ?, next_attempt_at = ?
+                  WHERE delivery_id = ? AND status IN (?, ?) AND next_attempt_at <= ?`,
+			models.WEBHOOK_DELIVERY_SENDING, now.Add(webhookLease), d.DeliveryID,
+			models.WEBHOOK_DELIVERY_PENDING, models.WEBHOOK_DELIVERY_SENDING, now)
+		if err != nil {
+			return 0, err
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+		if err := s.deliver(ctx, d); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), nil
+}
+
+// deliver sends a claimed delivery and records the outcome
+func (s *WebhookService) deliver(ctx context.Context, d models.WebhookDelivery) error {
+	attempts := d.Attempts + 1
+	status, sendErr := s.send(ctx, d)
+
+	now := time.Now().UTC()
+	if sendErr == nil {
+		_, err := database.GetDB().ExecContext(ctx, `UPDATE WebhookDeliveries SET status = ?, attempts = ?, response_status = ?, delivered_at = ?,
+                  last_error = NULL WHERE delivery_id = ?`, models.WEBHOOK_DELIVERY_DELIVERED, attempts, status, now, d.DeliveryID)
+		return err
+	}
+
+	next := now.Add(notificationBackoff(attempts))
+	deliveryStatus := models.WEBHOOK_DELIVERY_PENDING
+	if notifications.IsPermanent(sendErr) || attempts >= s.maxAttempts {
+		deliveryStatus, next = models.WEBHOOK_DELIVERY_FAILED, now
+		slog.Warn("Webhook delivery failed", "id", d.DeliveryID, "webhook", d.WebhookID, "event", d.EventType, "attempts", attempts, "error", sendErr)
+	}
+	var responseStatus any
+	if status != 0 {
+		responseStatus = status
+	}
+	_, err := database.GetDB().ExecContext(ctx, `UPDATE WebhookDeliveries SET status = ?, attempts = ?, next_attempt_at = ?, response_status = ?,
+              last_error = ? WHERE delivery_id = ?`, deliveryStatus, attempts, next, responseStatus, sendErr.Error(), d.DeliveryID)
+	return err
+}
+
+// send POSTs a delivery's event to its webhook, returning the response status
+func (s *WebhookService) send(ctx context.Context, d models.WebhookDelivery) (int, error) {
+	var webhookURL, secret string
+	var active bool
+	err := database.GetDB().QueryRowContext(ctx, `SELECT url, secret, active FROM Webhooks WHERE webhook_id = ?`, d.WebhookID).
+		Scan(&webhookURL, &secret, &active)
+	if err != nil {
+		return 0, err
+	}
+	if !active {
+		return 0, notifications.Permanent(errors.New("webhook is inactive"))
+	}
+	if secret, err = encryption.Open(encryption.WebhookSecret, d.WebhookID, secret); err != nil {
+		return 0, notifications.Permanent(err)
+	}
+
+	payload := models.WebhookPayload{DeliveryID: d.DeliveryID, EventType: d.EventType, EventID: d.EventID}
+	var data string
+	err = database.GetDB().QueryRowContext(ctx, `SELECT entity_type, entity_id, payload, occurred_at FROM ClinicalEvents WHERE event_id = ?`, d.EventID).
+		Scan(&payload.EntityType, &payload.EntityID, &data, &payload.OccurredAt)
+	if err != nil {
+		return 0, err
+	}
+	payload.Data = json.RawMessage(data)
+	payload.OccurredAt = payload.OccurredAt.UTC()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, notifications.Permanent(err)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	return notifications.PostSigned(sendCtx, s.client, webhookURL, secret, body)
+}
+
+// checkWebhookURL refuses URLs that would send events unencrypted to
+// another host
+func checkWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebhookURL, err)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return ErrWebhookURL
+}
+
+// webhookEventList stores event types sorted and without repeats
+func webhookEventList(eventTypes []string) string {
+	sorted := slices.Clone(eventTypes)
+	slices.Sort(sorted)
+	return strings.Join(slices.Compact(sorted), ",")
+}
+
+func queryWebhooks(ctx context.Context, clause string, args ...any) ([]models.Webhook, error) {
+	query := `SELECT webhook_id, name, url, event_types, active, created_by, created_at, updated_at FROM Webhooks ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		var eventTypes string
+		if err := rows.Scan(&w.WebhookID, &w.Name, &w.URL, &eventTypes, &w.Active, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		w.EventTypes = strings.Split(eventTypes, ",")
+		w.CreatedAt = timezone.In(w.CreatedAt)
+		w.UpdatedAt = timezone.In(w.UpdatedAt)
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func queryWebhookDeliveries(ctx context.Context, clause string, args ...any) ([]models.WebhookDelivery, error) {
+	query := `SELECT delivery_id, webhook_id, event_id, event_type, status, attempts, next_attempt_at, COALESCE(response_status, 0),
+                  COALESCE(last_error, ''), created_at, delivered_at
+              FROM WebhookDeliveries ` + clause
+	rows, err := database.ReadDB(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.DeliveryID, &d.WebhookID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.ResponseStatus, &d.LastError, &d.CreatedAt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		d.NextAttemptAt = timezone.In(d.NextAttemptAt)
+		d.CreatedAt = timezone.In(d.CreatedAt)
+		if deliveredAt.Valid {
+			t := timezone.In(deliveredAt.Time)
+			d.DeliveredAt = &t
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
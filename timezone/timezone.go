@@ -0,0 +1,151 @@
+// Package timezone converts between UTC, which every timestamp is stored in,
+// and the facility's local time, which people schedule in.
+//
+// The API accepts times either as RFC 3339 with an offset or as facility-local
+// wall times without one ("2026-03-29T09:30"). A wall time that doesn't exist
+// (skipped when clocks go forward) or happens twice (repeated when clocks go
+// back) is refused rather than guessed; send it with an offset instead.
+package timezone
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNonexistentLocalTime is returned for a wall time skipped by a DST transition
+	ErrNonexistentLocalTime = errors.New("local time does not exist in the facility time zone")
+	// ErrAmbiguousLocalTime is returned for a wall time that occurs twice in a DST transition
+	ErrAmbiguousLocalTime = errors.New("local time is ambiguous in the facility time zone; include an offset")
+)
+
+// localLayouts are the accepted wall time formats, without an offset
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"}
+
+const dateLayout = "2006-01-02"
+
+var (
+	mu       sync.RWMutex
+	location = time.UTC
+)
+
+// Init sets the facility time zone. Until it is called the facility is on UTC.
+func Init(loc *time.Location) {
+	mu.Lock()
+	defer mu.Unlock()
+	location = loc
+}
+
+// Location returns the facility time zone
+func Location() *time.Location {
+	mu.RLock()
+	defer mu.RUnlock()
+	return location
+}
+
+// In returns t in the facility time zone, for responses
+func In(t time.Time) time.Time {
+	return t.In(Location())
+}
+
+// Now returns the current facility-local time
+func Now() time.Time {
+	return In(time.Now())
+}
+
+// StartOfDay returns facility-local midnight of the day t falls on
+func StartOfDay(t time.Time) time.Time {
+	t = In(t)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// ParseDate parses a YYYY-MM-DD date as the start of that facility-local day.
+// The day ends at start.AddDate(0, 0, 1), which is 23 or 25 hours later
+// across a DST transition.
+func ParseDate(value string) (time.Time, error) {
+	day, err := time.ParseInLocation(dateLayout, value, Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a YYYY-MM-DD date", value)
+	}
+	return day, nil
+}
+
+// Parse parses an RFC 3339 time, or a facility-local wall time without an
+// offset, and returns it in UTC
+func Parse(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), nil
+	}
+
+	for _, layout := range localLayouts {
+		wall, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		t, err := resolve(wall, Location())
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s: %w", value, err)
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not an RFC 3339 time or a local time such as 2025-01-31T09:00", value)
+}
+
+// resolve finds the instant the wall clock in loc shows wall (read as UTC
+// fields), failing when there is none or more than one
+func resolve(wall time.Time, loc *time.Location) (time.Time, error) {
+	// The offsets in force a day either side cover any transition near wall
+	var offsets []int
+	for _, probe := range []time.Time{wall.Add(-26 * time.Hour), wall, wall.Add(26 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		if !slices.Contains(offsets, offset) {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	var found []time.Time
+	for _, offset := range offsets {
+		candidate := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if sameWallClock(candidate, wall) && !slices.ContainsFunc(found, candidate.Equal) {
+			found = append(found, candidate)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return time.Time{}, ErrNonexistentLocalTime
+	case 1:
+		return found[0], nil
+	default:
+		return time.Time{}, ErrAmbiguousLocalTime
+	}
+}
+
+func sameWallClock(t, wall time.Time) bool {
+	return t.Year() == wall.Year() && t.YearDay() == wall.YearDay() && t.Hour() == wall.Hour() &&
+		t.Minute() == wall.Minute() && t.Second() == wall.Second()
+}
+
+// Time is a time.Time decoded with Parse, for request bodies that accept
+// facility-local wall times
+type Time struct {
+	time.Time
+}
+
+func (t *Time) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" || value == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	parsed, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
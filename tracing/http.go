@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries each request's ID on the response: the caller's
+// own if it sent a usable one, otherwise the trace ID, so a reported ID
+// finds the request's trace
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID keeps caller-supplied IDs short and safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request ctx belongs to, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Middleware starts a server span named after the matched route template
+// (e.g. GET /api/patients/{id}) for each request, continuing the caller's
+// trace from a traceparent header, and puts the span and request ID in the
+// request's context for the database spans under it. It must be installed
+// with Router.Use, before the other middleware, so the route is known and
+// their time is included.
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		if template := routeTemplate(r); template != "" {
+			span.SetAttributes(attribute.String("http.route", template))
+		}
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = traceID(span)
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		span.SetAttributes(attribute.String("http.request.id", requestID))
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, requestID)))
+	}), "", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		if template := routeTemplate(r); template != "" {
+			return r.Method + " " + template
+		}
+		return r.Method
+	}))
+}
+
+// routeTemplate returns the path template of the route r matched, or ""
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, _ := route.GetPathTemplate()
+	return template
+}
+
+// traceID is the hex trace ID of span, or a random ID of the same shape
+// when the request isn't part of a trace, e.g. with tracing off
+func traceID(span trace.Span) string {
+	if id := span.SpanContext().TraceID(); id.IsValid() {
+		return id.String()
+	}
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,58 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	var exports atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" && r.Header.Get("X-Api-Key") == "secret" {
+			exports.Add(1)
+		}
+	}))
+	defer collector.Close()
+	if err := Init(Options{Endpoint: collector.URL + "/v1/traces", Headers: map[string]string{"X-Api-Key": "secret"}, ServiceName: "test", SampleRatio: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var statement trace.Span
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/api/patients/{id}", func(w http.ResponseWriter, r *http.Request) {
+		statement = Child(r.Context(), "SELECT", trace.SpanKindClient)
+		End(statement, nil)
+	})
+
+	// A caller's sampled trace is continued, and its ID is the request ID
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/patients/7", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if id := recorder.Header().Get(RequestIDHeader); id != traceID {
+		t.Fatalf("request ID %q, want the trace ID %q", id, traceID)
+	}
+	if !statement.SpanContext().IsValid() || statement.SpanContext().TraceID().String() != traceID {
+		t.Fatalf("the statement span %v isn't in the request's trace", statement.SpanContext())
+	}
+
+	// Outside a request there is nothing to trace
+	if span := Child(context.Background(), "SELECT", trace.SpanKindClient); span.SpanContext().IsValid() {
+		t.Fatal("a statement outside a request was traced")
+	}
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if exports.Load() == 0 {
+		t.Fatal("no spans reached the collector")
+	}
+}
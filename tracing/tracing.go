@@ -0,0 +1,97 @@
+// Package tracing sets up the OpenTelemetry SDK to record a span for each
+// HTTP request and the database statements it runs, and export them to a
+// collector over OTLP/HTTP. Incoming W3C traceparent headers are honoured so
+// the server's spans join the caller's trace.
+//
+// Server spans are started by Middleware, with otelhttp; client spans for
+// database statements are started with Child under them. New traces are
+// sampled at a ratio and the rest follow the caller's decision. Without an
+// endpoint nothing is recorded, but every request still gets a request ID.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentation names the server's own spans in the tracing backend
+const instrumentation = "github.com/kinyaelgrande/simple-hospital/tracing"
+
+// Options configures the exporter
+type Options struct {
+	// Endpoint is the collector's OTLP/HTTP traces URL, e.g.
+	// http://collector:4318/v1/traces; empty disables tracing
+	Endpoint string
+	// Headers are sent with every export, e.g. a vendor API key
+	Headers map[string]string
+	// ServiceName identifies the server in the tracing backend
+	ServiceName string
+	// SampleRatio is the share of new traces recorded, from 0 to 1. Requests
+	// continuing a caller's trace follow the caller's sampling decision.
+	SampleRatio float64
+}
+
+// provider is the SDK's tracer provider once Init has set one up
+var provider *sdktrace.TracerProvider
+
+// Init starts exporting spans as opts describes; call Shutdown before
+// exiting to send the last batch. Trace context is propagated either way.
+func Init(opts Options) error {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if opts.Endpoint == "" {
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(opts.Endpoint),
+		otlptracehttp.WithHeaders(opts.Headers),
+	)
+	if err != nil {
+		return err
+	}
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", opts.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(min(max(opts.SampleRatio, 0), 1)))),
+	)
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+// Shutdown sends the spans not yet exported, giving up when ctx is done
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Child starts a span under the one ctx carries, for operations like
+// database statements that are only worth tracing as part of a request.
+// When ctx has no recorded span the span records nothing. The caller must
+// End it.
+func Child(ctx context.Context, name string, kind trace.SpanKind) trace.Span {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return noop.Span{}
+	}
+	_, span := otel.Tracer(instrumentation).Start(ctx, name, trace.WithSpanKind(kind))
+	return span
+}
+
+// End finishes span, marking it failed when err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,184 @@
+// Package validation checks request payloads against the `validate` struct
+// tags on the models and reports field-level errors as 422 responses.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kinyaelgrande/simple-hospital/models"
+	"github.com/kinyaelgrande/simple-hospital/response"
+	"github.com/kinyaelgrande/simple-hospital/timezone"
+)
+
+const dateLayout = "2006-01-02"
+
+// farFutureDays is how far ahead a visit or prescription may be dated
+// before the date is taken to be a typo
+const farFutureDays = 30
+
+var (
+	// icd10Code matches an ICD-10 diagnosis code such as I10 or S72.001A
+	icd10Code = regexp.MustCompile(`^[A-Z][0-9][0-9A-Z](\.[0-9A-Z]{1,4})?$`)
+	// procedureCode matches a CPT code (99213, 0001F) or an ICD-10-PCS code (0DTJ4ZZ)
+	procedureCode = regexp.MustCompile(`^([0-9]{4}[0-9A-Z]|[0-9A-HJ-NP-Z]{7})$`)
+)
+
+var validate = newValidator()
+
+// FieldError describes why a single field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is returned by Struct when one or more fields are invalid
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldError := range e {
+		messages[i] = fieldError.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	// Report fields by their JSON names so clients can map errors to inputs
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("date", func(fl validator.FieldLevel) bool {
+		_, err := time.Parse(dateLayout, fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("pastdate", func(fl validator.FieldLevel) bool {
+		date, err := timezone.ParseDate(fl.Field().String())
+		return err == nil && !date.After(timezone.Now())
+	})
+	v.RegisterValidation("notfarfuture", func(fl validator.FieldLevel) bool {
+		date, err := timezone.ParseDate(fl.Field().String())
+		return err == nil && !date.After(timezone.StartOfDay(timezone.Now()).AddDate(0, 0, farFutureDays))
+	})
+	v.RegisterValidation("gender", func(fl validator.FieldLevel) bool {
+		switch strings.ToLower(fl.Field().String()) {
+		case "male", "female", "other":
+			return true
+		}
+		return false
+	})
+	v.RegisterValidation("role", func(fl validator.FieldLevel) bool {
+		_, ok := models.CanonicalRole(fl.Field().String())
+		return ok
+	})
+	v.RegisterValidation("icd10", func(fl validator.FieldLevel) bool {
+		return icd10Code.MatchString(strings.ToUpper(strings.TrimSpace(fl.Field().String())))
+	})
+	v.RegisterValidation("procedurecode", func(fl validator.FieldLevel) bool {
+		return procedureCode.MatchString(strings.ToUpper(strings.TrimSpace(fl.Field().String())))
+	})
+
+	return v
+}
+
+// Struct validates v and returns Errors if any field is invalid
+func Struct(v any) error {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	// Anonymous request structs have no name to strip from the namespace
+	structName := reflect.Indirect(reflect.ValueOf(v)).Type().Name()
+
+	fieldErrors := make(Errors, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		field := strings.TrimPrefix(fieldError.Namespace(), structName+".")
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Message: message(field, fieldError),
+		})
+	}
+	return fieldErrors
+}
+
+// message describes the failure for field, the JSON path such as
+// "firstName" or "results[0].analyte"
+func message(field string, fe validator.FieldError) string {
+	unit := "characters"
+	if fe.Kind() == reflect.Slice {
+		unit = "items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "max":
+		return fmt.Sprintf("%s must be at most %s %s", field, fe.Param(), unit)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s %s", field, fe.Param(), unit)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "gte":
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "required_if":
+		other, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("%s is required when %s is %s", field, strings.ToLower(other[:1])+other[1:], value)
+	case "excluded_unless":
+		other, value, _ := strings.Cut(fe.Param(), " ")
+		return fmt.Sprintf("%s is only allowed when %s is %s", field, strings.ToLower(other[:1])+other[1:], value)
+	case "required_without":
+		other := fe.Param()
+		return fmt.Sprintf("%s is required without %s", field, strings.ToLower(other[:1])+other[1:])
+	case "gtfield":
+		other := fe.Param()
+		return fmt.Sprintf("%s must be after %s", field, strings.ToLower(other[:1])+other[1:])
+	case "date":
+		return fmt.Sprintf("%s must be a date in YYYY-MM-DD format", field)
+	case "pastdate":
+		return fmt.Sprintf("%s must be a valid date that is not in the future", field)
+	case "notfarfuture":
+		return fmt.Sprintf("%s must be a valid date at most %d days in the future", field, farFutureDays)
+	case "gender":
+		return fmt.Sprintf("%s must be one of Male, Female, Other", field)
+	case "role":
+		return fmt.Sprintf("%s must be one of %s", field, strings.Join(models.Roles(), ", "))
+	case "icd10":
+		return fmt.Sprintf("%s must be an ICD-10 diagnosis code such as I10 or S72.001A", field)
+	case "procedurecode":
+		return fmt.Sprintf("%s must be a CPT or ICD-10-PCS procedure code", field)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("%s is invalid", field)
+	}
+}
+
+// WriteError writes err as a 422 error envelope whose details list the invalid fields
+func WriteError(w http.ResponseWriter, err error) {
+	var fieldErrors Errors
+	if !errors.As(err, &fieldErrors) {
+		response.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.WriteErrorDetails(w, http.StatusUnprocessableEntity, response.CodeValidationFailed, "Validation failed", fieldErrors)
+}